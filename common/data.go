@@ -9,3 +9,10 @@ type PluginDesc struct {
 	Type int
 	Stop bool
 }
+
+type ImportDesc struct {
+	Content string
+	// The conflict policy: skip, replace or fail
+	Policy string
+	DryRun bool
+}
@@ -0,0 +1,142 @@
+package common
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"github.com/ugorji/go/codec"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The csv codec decodes a delimited line into a map. The schemaId is the comma separated column names.
+// If no column names specified, the columns will be named as col0, col1...
+type csvCodec struct {
+	delimiter rune
+	cols      []string
+}
+
+func newCsvCodec(conf *CodecConf) (MessageCodec, error) {
+	c := &csvCodec{delimiter: ','}
+	if conf.Delimiter != "" {
+		r, size := utf8.DecodeRuneInString(conf.Delimiter)
+		if size != len(conf.Delimiter) || r == '\n' || r == '\r' || r == '"' {
+			return nil, fmt.Errorf("invalid delimiter %s, must be a single character", conf.Delimiter)
+		}
+		c.delimiter = r
+	}
+	if conf.SchemaId != "" {
+		for _, col := range strings.Split(conf.SchemaId, ",") {
+			c.cols = append(c.cols, strings.TrimSpace(col))
+		}
+	}
+	return c, nil
+}
+
+func (c *csvCodec) Decode(payload []byte) (map[string]interface{}, error) {
+	r := csv.NewReader(bytes.NewReader(payload))
+	r.Comma = c.delimiter
+	r.FieldsPerRecord = -1
+	record, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("fail to read csv record: %v", err)
+	}
+	if len(c.cols) > 0 && len(c.cols) != len(record) {
+		return nil, fmt.Errorf("csv record has %d columns but %d are defined in schema", len(record), len(c.cols))
+	}
+	result := make(map[string]interface{}, len(record))
+	for i, v := range record {
+		var k string
+		if len(c.cols) > 0 {
+			k = c.cols[i]
+		} else {
+			k = "col" + strconv.Itoa(i)
+		}
+		result[k] = parseCsvValue(v)
+	}
+	return result, nil
+}
+
+// Infer the value type like the json decoder does: numbers as float64, true/false as bool and others as string
+func parseCsvValue(v string) interface{} {
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return f
+	}
+	if b, err := strconv.ParseBool(v); err == nil && (v == "true" || v == "false") {
+		return b
+	}
+	return v
+}
+
+func (c *csvCodec) Encode(data interface{}) ([]byte, error) {
+	var rows []map[string]interface{}
+	switch dt := data.(type) {
+	case map[string]interface{}:
+		rows = []map[string]interface{}{dt}
+	case []map[string]interface{}:
+		rows = dt
+	default:
+		return nil, fmt.Errorf("csv format cannot encode %T", data)
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = c.delimiter
+	for _, row := range rows {
+		cols := c.cols
+		if len(cols) == 0 {
+			cols = make([]string, 0, len(row))
+			for k := range row {
+				cols = append(cols, k)
+			}
+			sort.Strings(cols)
+		}
+		record := make([]string, len(cols))
+		for i, col := range cols {
+			if s, err := ToString(row[col], CONVERT_ALL); err == nil {
+				record[i] = s
+			} else {
+				record[i] = ToStringAlways(row[col])
+			}
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+type msgpackCodec struct {
+	handle *codec.MsgpackHandle
+}
+
+func newMsgpackCodec(_ *CodecConf) (MessageCodec, error) {
+	h := &codec.MsgpackHandle{}
+	h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	h.RawToString = true
+	h.SignedInteger = true
+	h.WriteExt = true
+	return &msgpackCodec{handle: h}, nil
+}
+
+func (c *msgpackCodec) Decode(payload []byte) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	if err := codec.NewDecoderBytes(payload, c.handle).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *msgpackCodec) Encode(data interface{}) ([]byte, error) {
+	var b []byte
+	if err := codec.NewEncoderBytes(&b, c.handle).Encode(data); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -1,27 +1,144 @@
 package common
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
 )
 
 const (
-	FORMAT_BINARY = "binary"
-	FORMAT_JSON   = "json"
+	FORMAT_BINARY   = "binary"
+	FORMAT_JSON     = "json"
+	FORMAT_CSV      = "csv"
+	FORMAT_MSGPACK  = "msgpack"
+	FORMAT_PROTOBUF = "protobuf"
+	FORMAT_AVRO     = "avro"
 
 	DEFAULT_FIELD = "self"
 )
 
+// MessageCodec converts between the raw payload of a source/sink and the map based message used inside the rule
+type MessageCodec interface {
+	Decode(payload []byte) (map[string]interface{}, error)
+	// Encode the data which is either a map[string]interface{} or a []map[string]interface{}
+	Encode(data interface{}) ([]byte, error)
+}
+
+// CodecConf is the codec related properties which can be set in the source conf, stream options or sink action
+type CodecConf struct {
+	SchemaId  string `json:"schemaId"`
+	Delimiter string `json:"delimiter"`
+}
+
+type CodecFactory func(conf *CodecConf) (MessageCodec, error)
+
+var (
+	codecs = map[string]CodecFactory{
+		FORMAT_JSON: func(_ *CodecConf) (MessageCodec, error) {
+			return &jsonCodec{}, nil
+		},
+		FORMAT_BINARY: func(_ *CodecConf) (MessageCodec, error) {
+			return &binaryCodec{}, nil
+		},
+		FORMAT_CSV:     newCsvCodec,
+		FORMAT_MSGPACK: newMsgpackCodec,
+	}
+	codecLock = sync.RWMutex{}
+)
+
+// RegisterCodec registers a codec factory for the format. Codecs which depend on other modules like protobuf are
+// registered by those modules during init
+func RegisterCodec(format string, factory CodecFactory) {
+	codecLock.Lock()
+	defer codecLock.Unlock()
+	codecs[strings.ToLower(format)] = factory
+}
+
+func IsFormatSupported(format string) bool {
+	codecLock.RLock()
+	defer codecLock.RUnlock()
+	_, ok := codecs[strings.ToLower(format)]
+	return ok
+}
+
+func GetCodec(format string, conf *CodecConf) (MessageCodec, error) {
+	if format == "" {
+		format = FORMAT_JSON
+	}
+	if conf == nil {
+		conf = &CodecConf{}
+	}
+	codecLock.RLock()
+	f, ok := codecs[strings.ToLower(format)]
+	codecLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("invalid format %s", format)
+	}
+	return f(conf)
+}
+
+// GetCodecFromProps creates the codec by the format, schemaId and delimiter properties of a source or sink
+func GetCodecFromProps(props map[string]interface{}) (MessageCodec, error) {
+	var format string
+	if f, ok := props["format"]; ok {
+		if fs, ok := f.(string); ok {
+			format = fs
+		} else {
+			return nil, fmt.Errorf("invalid format property %v, must be a string", f)
+		}
+	}
+	conf := &CodecConf{}
+	if err := MapToStruct(props, conf); err != nil {
+		return nil, fmt.Errorf("read codec properties %v fail with error: %v", props, err)
+	}
+	return GetCodec(format, conf)
+}
+
 func MessageDecode(payload []byte, format string) (map[string]interface{}, error) {
+	c, err := GetCodec(format, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Decode(payload)
+}
+
+type jsonCodec struct{}
+
+func (c *jsonCodec) Decode(payload []byte) (map[string]interface{}, error) {
 	result := make(map[string]interface{})
-	switch strings.ToLower(format) {
-	case FORMAT_JSON:
-		e := json.Unmarshal(payload, &result)
-		return result, e
-	case FORMAT_BINARY:
-		result[DEFAULT_FIELD] = payload
-		return result, nil
-	}
-	return nil, fmt.Errorf("invalid format %s", format)
+	e := json.Unmarshal(payload, &result)
+	return result, e
+}
+
+func (c *jsonCodec) Encode(data interface{}) ([]byte, error) {
+	return json.Marshal(data)
+}
+
+type binaryCodec struct{}
+
+func (c *binaryCodec) Decode(payload []byte) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	result[DEFAULT_FIELD] = payload
+	return result, nil
+}
+
+func (c *binaryCodec) Encode(data interface{}) ([]byte, error) {
+	var v interface{}
+	switch dt := data.(type) {
+	case map[string]interface{}:
+		v = dt[DEFAULT_FIELD]
+	case []map[string]interface{}:
+		if len(dt) == 1 {
+			v = dt[0][DEFAULT_FIELD]
+		}
+	}
+	switch vt := v.(type) {
+	case []byte:
+		return vt, nil
+	case string: // bytea fields are base64 encoded in the json result
+		return base64.StdEncoding.DecodeString(vt)
+	}
+	return nil, fmt.Errorf("binary format can only encode a single message with bytea field %s", DEFAULT_FIELD)
 }
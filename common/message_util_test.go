@@ -49,3 +49,107 @@ func TestMessageDecode(t *testing.T) {
 		}
 	}
 }
+
+func TestCodec(t *testing.T) {
+	var tests = []struct {
+		format  string
+		conf    *CodecConf
+		payload []byte
+		result  map[string]interface{}
+		encoded []byte
+		err     string
+	}{
+		{
+			format:  "csv",
+			conf:    &CodecConf{SchemaId: "id,name,temperature,online"},
+			payload: []byte(`1,"john, jr",23.5,true`),
+			result: map[string]interface{}{
+				"id":          1.0,
+				"name":        "john, jr",
+				"temperature": 23.5,
+				"online":      true,
+			},
+			encoded: []byte(`1,"john, jr",23.5,true`),
+		}, {
+			format:  "CSV",
+			conf:    &CodecConf{Delimiter: "|"},
+			payload: []byte(`a|b|3`),
+			result: map[string]interface{}{
+				"col0": "a",
+				"col1": "b",
+				"col2": 3.0,
+			},
+			encoded: []byte(`a|b|3`),
+		}, {
+			format:  "csv",
+			conf:    &CodecConf{SchemaId: "a,b"},
+			payload: []byte(`1,2,3`),
+			err:     "csv record has 3 columns but 2 are defined in schema",
+		}, {
+			format:  "csv",
+			conf:    &CodecConf{Delimiter: "||"},
+			payload: []byte(`1,2,3`),
+			err:     "invalid delimiter ||, must be a single character",
+		}, {
+			format:  "json",
+			payload: []byte(`{"a":1,"b":"hello"}`),
+			result: map[string]interface{}{
+				"a": 1.0,
+				"b": "hello",
+			},
+			encoded: []byte(`{"a":1,"b":"hello"}`),
+		}, {
+			format: "thrift",
+			err:    "invalid format thrift",
+		},
+	}
+	for i, tt := range tests {
+		c, err := GetCodec(tt.format, tt.conf)
+		if err == nil {
+			var result map[string]interface{}
+			result, err = c.Decode(tt.payload)
+			if err == nil {
+				if !reflect.DeepEqual(tt.result, result) {
+					t.Errorf("%d decode result mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.result, result)
+				}
+				encoded, err := c.Encode(result)
+				if err != nil {
+					t.Errorf("%d encode error: %v", i, err)
+				} else if !reflect.DeepEqual(tt.encoded, encoded) {
+					t.Errorf("%d encode result mismatch:\n\nexp=%s\n\ngot=%s\n\n", i, tt.encoded, encoded)
+				}
+			}
+		}
+		if !reflect.DeepEqual(tt.err, Errstring(err)) {
+			t.Errorf("%d error mismatch:\n\nexp=%s\n\ngot=%s\n\n", i, tt.err, err)
+		}
+	}
+}
+
+func TestMsgpackCodec(t *testing.T) {
+	c, err := GetCodec(FORMAT_MSGPACK, nil)
+	if err != nil {
+		t.Errorf("get codec error: %v", err)
+		return
+	}
+	data := map[string]interface{}{
+		"id":     int64(12),
+		"name":   "sensor",
+		"temp":   26.3,
+		"values": []interface{}{int64(1), int64(2)},
+		"inner":  map[string]interface{}{"a": "b"},
+	}
+	payload, err := c.Encode(data)
+	if err != nil {
+		t.Errorf("encode error: %v", err)
+		return
+	}
+	result, err := c.Decode(payload)
+	if err != nil {
+		t.Errorf("decode error: %v", err)
+		return
+	}
+	if !reflect.DeepEqual(data, result) {
+		t.Errorf("result mismatch:\n\nexp=%v\n\ngot=%v\n\n", data, result)
+	}
+}
@@ -125,6 +125,15 @@ func ParseTime(t string, f string) (time.Time, error) {
 	}
 }
 
+// ParseTimeInLocation is like ParseTime but interprets the time without zone information in the given location
+func ParseTimeInLocation(t string, f string, loc *time.Location) (time.Time, error) {
+	if f, err := convertFormat(f); err != nil {
+		return time.Now(), err
+	} else {
+		return time.ParseInLocation(f, t, loc)
+	}
+}
+
 func FormatTime(time time.Time, f string) (string, error) {
 	if f, err := convertFormat(f); err != nil {
 		return "", err
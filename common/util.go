@@ -65,21 +65,67 @@ type tlsConf struct {
 	Keyfile  string `yaml:"keyfile"`
 }
 
+// AuthConf configures the authentication of the REST API and the CLI. If it is not set, all requests are accepted as
+// the admin role.
+type AuthConf struct {
+	// The static api tokens and their roles
+	Tokens []*TokenConf `yaml:"tokens"`
+	// Verify the JWT bearer tokens by the public key
+	Jwt *JwtConf `yaml:"jwt"`
+	// Verify the client certificates of the REST API by the CA
+	Mtls *MtlsConf `yaml:"mtls"`
+}
+
+type TokenConf struct {
+	Token string `yaml:"token"`
+	Role  string `yaml:"role"`
+}
+
+type JwtConf struct {
+	// The PEM file of the public key or the certificate to verify the signature
+	PublicKeyFile string `yaml:"publicKeyFile"`
+	// If set, the iss and aud claims must match
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	// The claim of the role, default to role
+	RoleClaim string `yaml:"roleClaim"`
+}
+
+type MtlsConf struct {
+	CaFile string `yaml:"caFile"`
+	// The role of the clients whose certificates do not have a role as the organizational unit, default to viewer
+	Role string `yaml:"role"`
+}
+
+// ReconcileConf enables the declarative management. The server converges the streams, tables, rules and services to
+// the manifest periodically.
+type ReconcileConf struct {
+	// The manifest file or the folder of the manifest files in yaml or json
+	Path string `yaml:"path"`
+	// The interval in seconds to check the manifest and the drift, default to 30
+	Interval int `yaml:"interval"`
+	// Delete the streams, tables, rules and services which are not in the manifest
+	Prune bool `yaml:"prune"`
+}
+
 type KuiperConf struct {
 	Basic struct {
-		Debug          bool     `yaml:"debug"`
-		ConsoleLog     bool     `yaml:"consoleLog"`
-		FileLog        bool     `yaml:"fileLog"`
-		RotateTime     int      `yaml:"rotateTime"`
-		MaxAge         int      `yaml:"maxAge"`
-		Ip             string   `yaml:"ip"`
-		Port           int      `yaml:"port"`
-		RestIp         string   `yaml:"restIp"`
-		RestPort       int      `yaml:"restPort"`
-		RestTls        *tlsConf `yaml:"restTls"`
-		Prometheus     bool     `yaml:"prometheus"`
-		PrometheusPort int      `yaml:"prometheusPort"`
-		PluginHosts    string   `yaml:"pluginHosts"`
+		Debug          bool           `yaml:"debug"`
+		ConsoleLog     bool           `yaml:"consoleLog"`
+		FileLog        bool           `yaml:"fileLog"`
+		RotateTime     int            `yaml:"rotateTime"`
+		MaxAge         int            `yaml:"maxAge"`
+		Ip             string         `yaml:"ip"`
+		Port           int            `yaml:"port"`
+		RestIp         string         `yaml:"restIp"`
+		RestPort       int            `yaml:"restPort"`
+		RestTls        *tlsConf       `yaml:"restTls"`
+		Authentication *AuthConf      `yaml:"authentication"`
+		SecretKeyFile  string         `yaml:"secretKeyFile"`
+		Reconcile      *ReconcileConf `yaml:"reconcile"`
+		Prometheus     bool           `yaml:"prometheus"`
+		PrometheusPort int            `yaml:"prometheusPort"`
+		PluginHosts    string         `yaml:"pluginHosts"`
 	}
 	Rule api.RuleOption
 	Sink struct {
@@ -3,9 +3,15 @@ package main
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/emqx/kuiper/xstream/api"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -18,6 +24,15 @@ type fileSink struct {
 	file    *os.File
 	mux     sync.Mutex
 	cancel  context.CancelFunc
+	// For exactly once qos, the results are written to the pending file of the checkpoint and appended to the file
+	// when the checkpoint completes
+	tpc bool
+}
+
+// The commit marker records the last committed checkpoint and the file size after committing it
+type commitMarker struct {
+	CheckpointId int64 `json:"checkpointId"`
+	Size         int64 `json:"size"`
 }
 
 func (m *fileSink) Configure(props map[string]interface{}) error {
@@ -58,7 +73,12 @@ func (m *fileSink) Open(ctx api.StreamContext) error {
 		for {
 			select {
 			case <-t.C:
-				m.save(logger)
+				m.mux.Lock()
+				tpc := m.tpc
+				m.mux.Unlock()
+				if !tpc {
+					m.save(logger)
+				}
 			case <-exeCtx.Done():
 				logger.Info("file sink done")
 				return
@@ -104,12 +124,188 @@ func (m *fileSink) Collect(ctx api.StreamContext, item interface{}) error {
 	return nil
 }
 
+func (m *fileSink) Begin(_ api.StreamContext) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.results = make([][]byte, 0)
+	if m.tpc {
+		return nil
+	}
+	m.tpc = true
+	// Record the initial size so that the file can be recovered if the first commit is interrupted
+	marker, err := m.readMarker()
+	if err != nil || marker != nil {
+		return err
+	}
+	fi, err := m.file.Stat()
+	if err != nil {
+		return err
+	}
+	return m.writeMarker(&commitMarker{Size: fi.Size()})
+}
+
+// Write the results of the transaction to the pending file
+func (m *fileSink) PreCommit(ctx api.StreamContext, checkpointId int64) error {
+	m.mux.Lock()
+	results := m.results
+	m.results = make([][]byte, 0)
+	m.mux.Unlock()
+	var b strings.Builder
+	for _, r := range results {
+		b.Write(r)
+		b.WriteString("\n")
+	}
+	ctx.GetLogger().Debugf("file sink pre-commits checkpoint %d", checkpointId)
+	return writeFileSync(m.pendingFile(checkpointId), []byte(b.String()))
+}
+
+// Append the pending files up to the checkpoint to the file. Before appending, the file is truncated to the size
+// recorded in the commit marker in case the last commit is interrupted.
+func (m *fileSink) Commit(ctx api.StreamContext, checkpointId int64) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	ids, err := m.pendingIds()
+	if err != nil {
+		return err
+	}
+	marker, err := m.readMarker()
+	if err != nil {
+		return err
+	}
+	if marker == nil {
+		fi, err := m.file.Stat()
+		if err != nil {
+			return err
+		}
+		marker = &commitMarker{Size: fi.Size()}
+	}
+	for _, id := range ids {
+		if id > checkpointId {
+			break
+		}
+		pf := m.pendingFile(id)
+		if id > marker.CheckpointId {
+			c, err := ioutil.ReadFile(pf)
+			if err != nil {
+				return err
+			}
+			if err := m.file.Truncate(marker.Size); err != nil {
+				return err
+			}
+			if _, err := m.file.Write(c); err != nil {
+				return err
+			}
+			if err := m.file.Sync(); err != nil {
+				return err
+			}
+			fi, err := m.file.Stat()
+			if err != nil {
+				return err
+			}
+			marker = &commitMarker{CheckpointId: id, Size: fi.Size()}
+			if err := m.writeMarker(marker); err != nil {
+				return err
+			}
+			ctx.GetLogger().Debugf("file sink commits checkpoint %d", id)
+		}
+		if err := os.Remove(pf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove all the uncommitted pending files
+func (m *fileSink) Abort(ctx api.StreamContext) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.results = make([][]byte, 0)
+	ids, err := m.pendingIds()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		ctx.GetLogger().Infof("file sink aborts checkpoint %d", id)
+		if err := os.Remove(m.pendingFile(id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *fileSink) pendingFile(checkpointId int64) string {
+	return fmt.Sprintf("%s.%d.pending", m.path, checkpointId)
+}
+
+func (m *fileSink) pendingIds() ([]int64, error) {
+	files, err := filepath.Glob(m.path + ".*.pending")
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for _, f := range files {
+		s := strings.TrimSuffix(strings.TrimPrefix(f, m.path+"."), ".pending")
+		if id, err := strconv.ParseInt(s, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// Return nil if the marker does not exist
+func (m *fileSink) readMarker() (*commitMarker, error) {
+	c, err := ioutil.ReadFile(m.path + ".commit")
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	marker := &commitMarker{}
+	if err := json.Unmarshal(c, marker); err != nil {
+		return nil, fmt.Errorf("invalid commit marker %s: %v", c, err)
+	}
+	return marker, nil
+}
+
+func (m *fileSink) writeMarker(marker *commitMarker) error {
+	c, err := json.Marshal(marker)
+	if err != nil {
+		return err
+	}
+	return writeFileSync(m.path+".commit", c)
+}
+
+// Write to a temp file and rename it so that the file is either complete or not existed
+func writeFileSync(name string, data []byte) error {
+	tmp := name + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
 func (m *fileSink) Close(ctx api.StreamContext) error {
 	if m.cancel != nil {
 		m.cancel()
 	}
 	if m.file != nil {
-		m.save(ctx.GetLogger())
+		// The uncommitted transaction is discarded and will be recomputed after restarting
+		if !m.tpc {
+			m.save(ctx.GetLogger())
+		}
 		return m.file.Close()
 	}
 	return nil
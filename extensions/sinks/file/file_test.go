@@ -0,0 +1,128 @@
+package main
+
+import (
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/xstream/api"
+	"github.com/emqx/kuiper/xstream/contexts"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func newTestSink(t *testing.T, ctx api.StreamContext, p string) *fileSink {
+	s := &fileSink{}
+	if err := s.Configure(map[string]interface{}{"path": p, "interval": float64(3600000)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestFileSinkTwoPhaseCommit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fileSink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := path.Join(dir, "result.txt")
+	contextLogger := common.Log.WithField("rule", "TestFileSinkTwoPhaseCommit")
+	ctx := contexts.WithValue(contexts.Background(), contexts.LoggerKey, contextLogger)
+	content := func() string {
+		c, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(c)
+	}
+	pending := func() []int64 {
+		ids, err := (&fileSink{path: p}).pendingIds()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ids
+	}
+
+	s := newTestSink(t, ctx, p)
+	if err := s.Begin(ctx); err != nil {
+		t.Fatal(err)
+	}
+	s.Collect(ctx, []byte("a"))
+	s.Collect(ctx, []byte("b"))
+	// Pre-commit writes the results to the pending file only
+	if err := s.PreCommit(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := ioutil.ReadFile(s.pendingFile(1)); err != nil || string(c) != "a\nb\n" {
+		t.Errorf("pending file of checkpoint 1 mismatch, got %q %v", c, err)
+	}
+	if c := content(); c != "" {
+		t.Errorf("the pre-committed results should not be written to the file, got %q", c)
+	}
+	if m, err := s.readMarker(); err != nil || !reflect.DeepEqual(m, &commitMarker{}) {
+		t.Errorf("commit marker mismatch after pre-commit, got %v %v", m, err)
+	}
+
+	// Commit appends the pending file to the file
+	if err := s.Begin(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Commit(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if c := content(); c != "a\nb\n" {
+		t.Errorf("file content mismatch after commit, got %q", c)
+	}
+	if ids := pending(); len(ids) != 0 {
+		t.Errorf("the committed pending files should be removed, got %v", ids)
+	}
+	if m, err := s.readMarker(); err != nil || !reflect.DeepEqual(m, &commitMarker{CheckpointId: 1, Size: 4}) {
+		t.Errorf("commit marker mismatch after commit, got %v %v", m, err)
+	}
+
+	// Pre-commit two checkpoints and crash while committing checkpoint 2
+	s.Collect(ctx, []byte("c"))
+	if err := s.PreCommit(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	s.Collect(ctx, []byte("d"))
+	if err := s.PreCommit(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.file.WriteString("partial"); err != nil {
+		t.Fatal(err)
+	}
+	s.Close(ctx)
+	if ids := pending(); !reflect.DeepEqual(ids, []int64{2, 3}) {
+		t.Errorf("pending checkpoints mismatch, got %v", ids)
+	}
+
+	// Recover from checkpoint 2: commit it and abort the others
+	s = newTestSink(t, ctx, p)
+	defer s.Close(ctx)
+	if err := s.Commit(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Abort(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Begin(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if c := content(); c != "a\nb\nc\n" {
+		t.Errorf("file content mismatch after recovery, got %q", c)
+	}
+	if ids := pending(); len(ids) != 0 {
+		t.Errorf("the aborted pending files should be removed, got %v", ids)
+	}
+	// Commit is idempotent
+	if err := s.Commit(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if c := content(); c != "a\nb\nc\n" {
+		t.Errorf("file content mismatch after committing again, got %q", c)
+	}
+}
@@ -13,6 +13,7 @@ type zmqSource struct {
 	srv           string
 	topic         string
 	messageFormat string
+	codec         common.MessageCodec
 	cancel        context.CancelFunc
 }
 
@@ -29,6 +30,11 @@ func (s *zmqSource) Configure(topic string, props map[string]interface{}) error
 	} else {
 		s.messageFormat = f.(string)
 	}
+	c, err := common.GetCodecFromProps(props)
+	if err != nil {
+		return err
+	}
+	s.codec = c
 	return nil
 }
 
@@ -66,7 +72,7 @@ func (s *zmqSource) Open(ctx api.StreamContext, consumer chan<- api.SourceTuple,
 			if s.topic != "" {
 				meta["topic"] = string(msgs[0])
 			}
-			result, e := common.MessageDecode(m, s.messageFormat)
+			result, e := s.codec.Decode(m)
 			if e != nil {
 				logger.Errorf("Invalid data format, cannot decode %v to %s format with error %s", m, s.messageFormat, e)
 			} else {
@@ -3,6 +3,7 @@ package plugins
 import (
 	"archive/zip"
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -19,6 +20,7 @@ import (
 
 	"github.com/emqx/kuiper/common"
 	"github.com/emqx/kuiper/common/kv"
+	"github.com/emqx/kuiper/plugins/portable"
 	"github.com/emqx/kuiper/xstream/api"
 )
 
@@ -81,12 +83,14 @@ const (
 	SOURCE PluginType = iota
 	SINK
 	FUNCTION
+	// The portable plugins run as child processes. A portable plugin can provide sources, sinks and functions together.
+	PORTABLE
 )
 
 const DELETED = "$deleted"
 
 var (
-	PluginTypes = []string{"sources", "sinks", "functions"}
+	PluginTypes = []string{"sources", "sinks", "functions", "portables"}
 	once        sync.Once
 	singleton   *Manager
 )
@@ -229,6 +233,11 @@ func GetSource(t string) (api.Source, error) {
 	if p, ok := getSourceFromNative(t); ok {
 		return p, nil
 	}
+	if pm, err := portable.GetManager(); err == nil {
+		if p, ok := pm.Source(t); ok {
+			return p, nil
+		}
+	}
 
 	nf, err := getPlugin(t, SOURCE)
 	if err != nil {
@@ -251,6 +260,11 @@ func GetSink(t string) (api.Sink, error) {
 	if p, ok := getSinkFromNative(t); ok {
 		return p, nil
 	}
+	if pm, err := portable.GetManager(); err == nil {
+		if p, ok := pm.Sink(t); ok {
+			return p, nil
+		}
+	}
 
 	nf, err := getPlugin(t, SINK)
 	if err != nil {
@@ -295,6 +309,8 @@ type Manager struct {
 	etcDir    string
 	registry  *Registry
 	db        kv.KeyValue
+	// The registrations of the installed plugins by type/name
+	installDb kv.KeyValue
 }
 
 func NewPluginManager() (*Manager, error) {
@@ -348,6 +364,7 @@ func NewPluginManager() (*Manager, error) {
 			etcDir:    etcDir,
 			registry:  registry,
 			db:        db,
+			installDb: kv.GetDefaultKVStore(path.Join(dbDir, "pluginInstalls")),
 		}
 		if err := singleton.readSourceMetaDir(); nil != err {
 			common.Log.Errorf("readSourceMetaDir:%v", err)
@@ -384,6 +401,13 @@ func findAll(t PluginType, pluginDir string) (result map[string]string, err erro
 }
 
 func (m *Manager) List(t PluginType) (result []string, err error) {
+	if t == PORTABLE {
+		pm, err := portable.GetManager()
+		if err != nil {
+			return nil, err
+		}
+		return pm.List(), nil
+	}
 	return m.registry.List(t), nil
 }
 
@@ -397,6 +421,17 @@ func (m *Manager) GetSymbol(s string) (result string, ok bool) {
 
 func (m *Manager) Register(t PluginType, j Plugin) error {
 	name, uri, shellParas := j.GetName(), j.GetFile(), j.GetShellParas()
+	if t == PORTABLE {
+		pm, err := portable.GetManager()
+		if err != nil {
+			return err
+		}
+		if err := pm.Register(name, uri, shellParas); err != nil {
+			return err
+		}
+		m.saveInstallation(t, j)
+		return nil
+	}
 	//Validation
 	name = strings.Trim(name, " ")
 	if name == "" {
@@ -463,6 +498,7 @@ func (m *Manager) Register(t PluginType, j Plugin) error {
 		return fmt.Errorf("fail to install plugin: %s", err)
 	}
 	m.registry.Store(t, name, version)
+	m.saveInstallation(t, j)
 
 	switch t {
 	case SINK:
@@ -511,6 +547,18 @@ func (m *Manager) Delete(t PluginType, name string, stop bool) error {
 	if name == "" {
 		return fmt.Errorf("invalid name %s: should not be empty", name)
 	}
+	// The portable plugin is unloaded at once so it does not need to stop Kuiper
+	if t == PORTABLE {
+		pm, err := portable.GetManager()
+		if err != nil {
+			return err
+		}
+		if err := pm.Delete(name); err != nil {
+			return err
+		}
+		m.deleteInstallation(t, name)
+		return nil
+	}
 	soPath, err := getSoFilePath(m, t, name, true)
 	if err != nil {
 		return err
@@ -569,6 +617,7 @@ func (m *Manager) Delete(t PluginType, name string, stop bool) error {
 		return errors.New(strings.Join(results, "\n"))
 	} else {
 		m.registry.Store(t, name, DELETED)
+		m.deleteInstallation(t, name)
 		if stop {
 			go func() {
 				time.Sleep(1 * time.Second)
@@ -579,6 +628,13 @@ func (m *Manager) Delete(t PluginType, name string, stop bool) error {
 	}
 }
 func (m *Manager) Get(t PluginType, name string) (map[string]interface{}, bool) {
+	if t == PORTABLE {
+		pm, err := portable.GetManager()
+		if err != nil {
+			return nil, false
+		}
+		return pm.Get(name)
+	}
 	v, ok := m.registry.Get(t, name)
 	if strings.HasPrefix(v, "v") {
 		v = v[1:]
@@ -603,6 +659,50 @@ func (m *Manager) Get(t PluginType, name string) (map[string]interface{}, bool)
 	return nil, false
 }
 
+// saveInstallation keeps the registration of a plugin so that the plugin can be exported and installed again in
+// another node. The errors are ignored because the plugin is already installed.
+func (m *Manager) saveInstallation(t PluginType, j Plugin) {
+	b, err := json.Marshal(j)
+	if err != nil {
+		common.Log.Errorf("fail to encode the registration of plugin %s: %v", j.GetName(), err)
+		return
+	}
+	if err := m.installDb.Open(); err != nil {
+		common.Log.Errorf("fail to save the registration of plugin %s: %v", j.GetName(), err)
+		return
+	}
+	defer m.installDb.Close()
+	if err := m.installDb.Set(PluginTypes[t]+"/"+j.GetName(), string(b)); err != nil {
+		common.Log.Errorf("fail to save the registration of plugin %s: %v", j.GetName(), err)
+	}
+}
+
+func (m *Manager) deleteInstallation(t PluginType, name string) {
+	if err := m.installDb.Open(); err != nil {
+		return
+	}
+	defer m.installDb.Close()
+	m.installDb.Delete(PluginTypes[t] + "/" + name)
+}
+
+// GetInstallation returns the registration of an installed plugin. The plugins which are installed manually or before
+// the registrations are kept do not have it.
+func (m *Manager) GetInstallation(t PluginType, name string) (Plugin, bool) {
+	if err := m.installDb.Open(); err != nil {
+		return nil, false
+	}
+	defer m.installDb.Close()
+	var v string
+	if ok, _ := m.installDb.Get(PluginTypes[t]+"/"+name, &v); !ok {
+		return nil, false
+	}
+	j := NewPluginByType(t)
+	if err := json.Unmarshal([]byte(v), j); err != nil {
+		return nil, false
+	}
+	return j, true
+}
+
 // Start implement xsql.FunctionRegister
 
 func (m *Manager) HasFunction(name string) bool {
@@ -0,0 +1,549 @@
+package portable
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/xsql"
+	"github.com/emqx/kuiper/xstream/api"
+)
+
+const (
+	SOURCE = iota
+	SINK
+	FUNCTION
+)
+
+var (
+	mutex     sync.Mutex
+	singleton *Manager //Do not call this directly, use GetManager
+
+	// The plugin and symbol names are also used as the file names, so only the identifiers are allowed
+	symbolPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// symbolChecker reports whether the symbol of the type is provided by Kuiper or the native plugins
+	symbolChecker func(t int, name string) bool
+)
+
+// SetSymbolChecker sets the checker of the built-in and native symbols so that a portable plugin cannot shadow them or
+// overwrite their configurations
+func SetSymbolChecker(f func(t int, name string) bool) {
+	symbolChecker = f
+}
+
+// PluginMeta is the manifest of a portable plugin. It is the <name>.json file in the plugin zip file.
+type PluginMeta struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// The language which the plugin is written in, only for information
+	Language string `json:"language"`
+	// The path of the executable relative to the plugin folder
+	Executable string   `json:"executable"`
+	Sources    []string `json:"sources"`
+	Sinks      []string `json:"sinks"`
+	Functions  []string `json:"functions"`
+}
+
+type portablePlugin struct {
+	meta *PluginMeta
+	ins  *pluginIns
+}
+
+// Manager installs the portable plugins and runs each of them as a child process. Different from the go plugins, a
+// portable plugin can be deleted without restarting Kuiper.
+type Manager struct {
+	pluginDir string
+	etcDir    string
+
+	sync.RWMutex
+	plugins map[string]*portablePlugin
+	// 3 maps for source/sink/function. In each map, key is the symbol name, value is the plugin name
+	symbols []map[string]string
+}
+
+// GetManager returns the manager which starts all the installed plugins when it is created
+func GetManager() (*Manager, error) {
+	return getManager(true)
+}
+
+// GetRegistry returns the manager which only reads the manifests of the installed plugins when it is created. The
+// plugin processes are started when their sources, sinks or functions are used for the first time. It is for the
+// processes which do not manage the plugins such as the rule test.
+func GetRegistry() (*Manager, error) {
+	return getManager(false)
+}
+
+func getManager(run bool) (*Manager, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if singleton == nil {
+		dir, err := common.GetPluginsLoc()
+		if err != nil {
+			return nil, fmt.Errorf("cannot find plugins folder: %s", err)
+		}
+		etcDir, err := common.GetConfLoc()
+		if err != nil {
+			return nil, fmt.Errorf("cannot find etc folder: %s", err)
+		}
+		pluginDir := path.Join(dir, "portables")
+		if err := os.MkdirAll(pluginDir, os.ModePerm); err != nil {
+			return nil, fmt.Errorf("cannot create portable plugins folder: %s", err)
+		}
+		m := &Manager{
+			pluginDir: pluginDir,
+			etcDir:    etcDir,
+			plugins:   make(map[string]*portablePlugin),
+			symbols:   []map[string]string{make(map[string]string), make(map[string]string), make(map[string]string)},
+		}
+		m.loadAll(run)
+		singleton = m
+	}
+	return singleton, nil
+}
+
+// loadAll registers the installed plugins and starts them if run is true. The plugins fail to start are still registered
+// so that they can be deleted, and they are started again when they are used.
+func (m *Manager) loadAll(run bool) {
+	files, err := ioutil.ReadDir(m.pluginDir)
+	if err != nil {
+		common.Log.Errorf("fail to read portable plugins folder: %v", err)
+		return
+	}
+	for _, file := range files {
+		if !file.IsDir() {
+			continue
+		}
+		name := file.Name()
+		meta, err := readMeta(path.Join(m.pluginDir, name, name+".json"))
+		if err != nil {
+			common.Log.Errorf("fail to load portable plugin %s: %v", name, err)
+			continue
+		}
+		meta.Name = name
+		pp := &portablePlugin{
+			meta: meta,
+			ins:  newPluginIns(name, path.Join(m.pluginDir, name, meta.Executable), path.Join(m.pluginDir, name)),
+		}
+		if err := m.storeSymbols(pp); err != nil {
+			common.Log.Errorf("fail to load portable plugin %s: %v", name, err)
+			continue
+		}
+		m.plugins[name] = pp
+		if !run {
+			continue
+		}
+		if err := pp.ins.run(); err != nil {
+			common.Log.Errorf("fail to start portable plugin %s: %v", name, err)
+		}
+	}
+}
+
+func readMeta(file string) (*PluginMeta, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the plugin json file: %v", err)
+	}
+	meta := &PluginMeta{}
+	if err := json.Unmarshal(b, meta); err != nil {
+		return nil, fmt.Errorf("invalid plugin json file: %v", err)
+	}
+	if meta.Executable == "" {
+		return nil, fmt.Errorf("invalid plugin json file: missing executable")
+	}
+	return meta, nil
+}
+
+func (m *Manager) storeSymbols(pp *portablePlugin) error {
+	m.Lock()
+	defer m.Unlock()
+	lists := [][]string{pp.meta.Sources, pp.meta.Sinks, pp.meta.Functions}
+	for t, l := range lists {
+		for _, s := range l {
+			if n, ok := m.symbols[t][s]; ok {
+				return fmt.Errorf("symbol %s already exists in plugin %s", s, n)
+			}
+		}
+	}
+	for t, l := range lists {
+		for _, s := range l {
+			m.symbols[t][s] = pp.meta.Name
+		}
+	}
+	return nil
+}
+
+func (m *Manager) removeSymbols(pp *portablePlugin) {
+	m.Lock()
+	defer m.Unlock()
+	for t, l := range [][]string{pp.meta.Sources, pp.meta.Sinks, pp.meta.Functions} {
+		for _, s := range l {
+			delete(m.symbols[t], s)
+		}
+	}
+}
+
+func (m *Manager) List() []string {
+	m.RLock()
+	defer m.RUnlock()
+	result := make([]string, 0, len(m.plugins))
+	for k := range m.plugins {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (m *Manager) Get(name string) (map[string]interface{}, bool) {
+	m.RLock()
+	pp, ok := m.plugins[name]
+	m.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	status := "stopped"
+	if pp.ins.isRunning() {
+		status = "running"
+	}
+	return map[string]interface{}{
+		"name":       name,
+		"version":    strings.TrimPrefix(pp.meta.Version, "v"),
+		"language":   pp.meta.Language,
+		"executable": pp.meta.Executable,
+		"sources":    pp.meta.Sources,
+		"sinks":      pp.meta.Sinks,
+		"functions":  pp.meta.Functions,
+		"status":     status,
+	}, true
+}
+
+// Register downloads the plugin zip file, installs and starts the plugin
+func (m *Manager) Register(name, uri string, shellParas []string) error {
+	name = strings.Trim(name, " ")
+	if name == "" {
+		return fmt.Errorf("invalid name %s: should not be empty", name)
+	}
+	if !common.IsValidUrl(uri) || !strings.HasSuffix(uri, ".zip") {
+		return fmt.Errorf("invalid uri %s", uri)
+	}
+	m.RLock()
+	_, ok := m.plugins[name]
+	m.RUnlock()
+	if ok {
+		return fmt.Errorf("invalid name %s: duplicate", name)
+	}
+	zipPath := path.Join(m.pluginDir, name+".zip")
+	//clean up: delete zip file and unzip files in error
+	defer os.Remove(zipPath)
+	//download
+	err := common.DownloadFile(zipPath, uri)
+	if err != nil {
+		return fmt.Errorf("fail to download file %s: %s", uri, err)
+	}
+	meta, err := m.install(name, zipPath, shellParas)
+	if err != nil {
+		return fmt.Errorf("fail to install plugin: %s", err)
+	}
+	pp := &portablePlugin{
+		meta: meta,
+		ins:  newPluginIns(name, path.Join(m.pluginDir, name, meta.Executable), path.Join(m.pluginDir, name)),
+	}
+	if err := m.storeSymbols(pp); err != nil {
+		m.uninstall(meta)
+		return fmt.Errorf("fail to install plugin: %s", err)
+	}
+	if err := m.start(pp); err != nil {
+		m.removeSymbols(pp)
+		m.uninstall(meta)
+		return fmt.Errorf("fail to install plugin: %s", err)
+	}
+	m.Lock()
+	m.plugins[name] = pp
+	m.Unlock()
+	common.Log.Infof("install portable plugin %s", name)
+	return nil
+}
+
+// start runs the plugin and verifies it provides all the symbols in the manifest
+func (m *Manager) start(pp *portablePlugin) error {
+	if err := pp.ins.run(); err != nil {
+		return err
+	}
+	info := pp.ins.getInfo()
+	var funcs []string
+	for _, f := range info.Functions {
+		funcs = append(funcs, f.Name)
+	}
+	for _, c := range []struct {
+		t        string
+		expected []string
+		actual   []string
+	}{
+		{"source", pp.meta.Sources, info.Sources},
+		{"sink", pp.meta.Sinks, info.Sinks},
+		{"function", pp.meta.Functions, funcs},
+	} {
+		for _, s := range c.expected {
+			found := false
+			for _, a := range c.actual {
+				if a == s {
+					found = true
+					break
+				}
+			}
+			if !found {
+				pp.ins.stop()
+				return fmt.Errorf("plugin %s does not provide %s %s", pp.meta.Name, c.t, s)
+			}
+		}
+	}
+	return nil
+}
+
+// Delete stops the plugin process and removes the plugin files. The rules using the plugin will fail until they are
+// restarted with the plugin installed again.
+func (m *Manager) Delete(name string) error {
+	name = strings.Trim(name, " ")
+	m.Lock()
+	pp, ok := m.plugins[name]
+	delete(m.plugins, name)
+	m.Unlock()
+	if !ok {
+		return common.NewErrorWithCode(common.NOT_FOUND, fmt.Sprintf("invalid name %s: not exist", name))
+	}
+	pp.ins.stop()
+	m.removeSymbols(pp)
+	for _, f := range pp.meta.Functions {
+		xsql.UnloadFunction(f)
+	}
+	return m.uninstall(pp.meta)
+}
+
+// Shutdown stops all the plugin processes
+func (m *Manager) Shutdown() {
+	m.RLock()
+	defer m.RUnlock()
+	for _, pp := range m.plugins {
+		pp.ins.stop()
+	}
+}
+
+func (m *Manager) uninstall(meta *PluginMeta) error {
+	var results []string
+	paths := []string{path.Join(m.pluginDir, meta.Name)}
+	for _, s := range meta.Sources {
+		p := path.Join(m.etcDir, "sources", s+".yaml")
+		if _, err := os.Stat(p); err == nil {
+			paths = append(paths, p)
+		}
+	}
+	for _, p := range paths {
+		if err := os.RemoveAll(p); err != nil {
+			results = append(results, err.Error())
+		}
+	}
+	if len(results) > 0 {
+		return fmt.Errorf("%s", strings.Join(results, "\n"))
+	}
+	return nil
+}
+
+// install unzips the plugin files into the plugin folder except the source configuration yaml files which are put in
+// the etc/sources folder. If there is an install.sh, it is run after unzipping.
+func (m *Manager) install(name, src string, shellParas []string) (*PluginMeta, error) {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var meta *PluginMeta
+	for _, file := range r.File {
+		if file.Name == name+".json" {
+			rc, err := file.Open()
+			if err != nil {
+				return nil, err
+			}
+			b, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+			meta = &PluginMeta{}
+			if err := json.Unmarshal(b, meta); err != nil {
+				return nil, fmt.Errorf("invalid plugin json file: %v", err)
+			}
+			break
+		}
+	}
+	if meta == nil {
+		return nil, fmt.Errorf("invalid zip file: plugin json file %s.json is missing", name)
+	}
+	if meta.Name == "" {
+		meta.Name = name
+	} else if meta.Name != name {
+		return nil, fmt.Errorf("invalid plugin json file: name %s does not match the plugin name %s", meta.Name, name)
+	}
+	if meta.Executable == "" {
+		return nil, fmt.Errorf("invalid plugin json file: missing executable")
+	}
+	if len(meta.Sources)+len(meta.Sinks)+len(meta.Functions) == 0 {
+		return nil, fmt.Errorf("invalid plugin json file: no source, sink or function is provided")
+	}
+	// Validate before writing any file because the failed installation removes the source configurations
+	if err := m.validateSymbols(meta); err != nil {
+		return nil, fmt.Errorf("invalid plugin json file: %v", err)
+	}
+
+	dir := path.Join(m.pluginDir, name)
+	confDir := path.Join(m.etcDir, "sources")
+	yamlFiles := make(map[string]bool)
+	for _, s := range meta.Sources {
+		yamlFiles[s+".yaml"] = true
+	}
+	needInstall := false
+	for _, file := range r.File {
+		var target string
+		if yamlFiles[file.Name] {
+			target = filepath.Join(confDir, file.Name)
+			if !strings.HasPrefix(target, filepath.Clean(confDir)+string(os.PathSeparator)) {
+				m.uninstall(meta)
+				return nil, fmt.Errorf("invalid file path %s in the zip file", file.Name)
+			}
+		} else {
+			target = filepath.Join(dir, file.Name)
+			if !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+				m.uninstall(meta)
+				return nil, fmt.Errorf("invalid file path %s in the zip file", file.Name)
+			}
+			if file.Name == "install.sh" {
+				needInstall = true
+			}
+		}
+		if err := common.UnzipTo(file, target); err != nil {
+			m.uninstall(meta)
+			return nil, err
+		}
+	}
+	if _, err := os.Stat(path.Join(dir, meta.Executable)); err != nil {
+		m.uninstall(meta)
+		return nil, fmt.Errorf("invalid zip file: executable %s is missing", meta.Executable)
+	}
+	if needInstall {
+		//run install script if there is
+		cmd := exec.Command("/bin/sh", append([]string{path.Join(dir, "install.sh")}, shellParas...)...)
+		cmd.Dir = dir
+		var outb, errb bytes.Buffer
+		cmd.Stdout = &outb
+		cmd.Stderr = &errb
+		if err := cmd.Run(); err != nil {
+			common.Log.Infof(`err:%v stdout:%s stderr:%s`, err, outb.String(), errb.String())
+			m.uninstall(meta)
+			return nil, err
+		}
+		common.Log.Infof(`run install script:%s`, outb.String())
+	}
+	return meta, nil
+}
+
+// validateSymbols checks the names of the plugin and its symbols. A symbol must not be provided by Kuiper, the native
+// plugins or the other portable plugins, otherwise the configuration of the source will be overwritten when installing
+// and removed when uninstalling.
+func (m *Manager) validateSymbols(meta *PluginMeta) error {
+	if !symbolPattern.MatchString(meta.Name) {
+		return fmt.Errorf("invalid plugin name %s", meta.Name)
+	}
+	m.RLock()
+	defer m.RUnlock()
+	for t, c := range []struct {
+		name    string
+		symbols []string
+	}{
+		{"source", meta.Sources},
+		{"sink", meta.Sinks},
+		{"function", meta.Functions},
+	} {
+		for _, s := range c.symbols {
+			if !symbolPattern.MatchString(s) {
+				return fmt.Errorf("invalid %s name %s", c.name, s)
+			}
+			if n, ok := m.symbols[t][s]; ok {
+				return fmt.Errorf("%s %s already exists in plugin %s", c.name, s, n)
+			}
+			if (t == FUNCTION && xsql.IsBuiltinFunc(s)) || (symbolChecker != nil && symbolChecker(t, s)) {
+				return fmt.Errorf("%s %s already exists", c.name, s)
+			}
+		}
+	}
+	return nil
+}
+
+// Source returns a new instance of the portable source
+func (m *Manager) Source(name string) (api.Source, bool) {
+	pp, ok := m.getBySymbol(SOURCE, name)
+	if !ok {
+		return nil, false
+	}
+	return &PortableSource{symbol: name, plugin: pp.ins}, true
+}
+
+// Sink returns a new instance of the portable sink
+func (m *Manager) Sink(name string) (api.Sink, bool) {
+	pp, ok := m.getBySymbol(SINK, name)
+	if !ok {
+		return nil, false
+	}
+	return &PortableSink{symbol: name, plugin: pp.ins}, true
+}
+
+func (m *Manager) getBySymbol(t int, name string) (*portablePlugin, bool) {
+	m.RLock()
+	defer m.RUnlock()
+	pn, ok := m.symbols[t][name]
+	if !ok {
+		return nil, false
+	}
+	pp, ok := m.plugins[pn]
+	return pp, ok
+}
+
+// Start implement xsql.FunctionRegister
+
+func (m *Manager) HasFunction(name string) bool {
+	_, ok := m.getBySymbol(FUNCTION, name)
+	return ok
+}
+
+func (m *Manager) Function(name string) (api.Function, error) {
+	pp, ok := m.getBySymbol(FUNCTION, name)
+	if !ok {
+		return nil, fmt.Errorf("function %s not found", name)
+	}
+	if err := pp.ins.run(); err != nil {
+		return nil, err
+	}
+	info := pp.ins.getInfo()
+	if info == nil {
+		return nil, fmt.Errorf("plugin %s is not running", pp.meta.Name)
+	}
+	f := &PortableFunc{symbol: name, plugin: pp.ins}
+	for _, fi := range info.Functions {
+		if fi.Name == name {
+			f.isAgg = fi.Aggregate
+			break
+		}
+	}
+	return f, nil
+}
+
+// End Implement FunctionRegister
@@ -0,0 +1,223 @@
+package portable
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/emqx/kuiper/xsql"
+)
+
+// The commands sent from Kuiper to the plugin process
+const (
+	CMD_INFO          = "info"
+	CMD_PING          = "ping"
+	CMD_SOURCE_START  = "source_start"
+	CMD_SOURCE_STOP   = "source_stop"
+	CMD_SINK_START    = "sink_start"
+	CMD_SINK_COLLECT  = "sink_collect"
+	CMD_SINK_STOP     = "sink_stop"
+	CMD_FUNC_VALIDATE = "func_validate"
+	CMD_FUNC_EXEC     = "func_exec"
+)
+
+// The events sent from the plugin process to Kuiper without a command
+const (
+	EVENT_DATA  = "data"
+	EVENT_ERROR = "error"
+)
+
+// The types of the function arguments in the validate command
+const (
+	ARG_STRING  = "string"
+	ARG_INTEGER = "integer"
+	ARG_NUMBER  = "number"
+	ARG_BOOLEAN = "boolean"
+	ARG_FIELD   = "field"
+	ARG_CALL    = "call"
+	ARG_EXPR    = "expr"
+)
+
+// Command is sent from Kuiper to the plugin through the stdin of the plugin process. Each command is a json object in
+// a single line. The plugin must reply each command with the same id.
+type Command struct {
+	Id         int64                  `json:"id"`
+	Cmd        string                 `json:"cmd"`
+	Symbol     string                 `json:"symbol,omitempty"`
+	Instance   string                 `json:"instance,omitempty"`
+	Meta       *RuntimeMeta           `json:"meta,omitempty"`
+	DataSource string                 `json:"datasource,omitempty"`
+	Props      map[string]interface{} `json:"props,omitempty"`
+	Args       []interface{}          `json:"args,omitempty"`
+	Data       interface{}            `json:"data,omitempty"`
+}
+
+// RuntimeMeta tells the plugin which rule and operator a source, sink or function instance runs in
+type RuntimeMeta struct {
+	RuleId     string `json:"ruleId"`
+	OpId       string `json:"opId"`
+	InstanceId int    `json:"instanceId"`
+	FuncId     int    `json:"funcId,omitempty"`
+}
+
+// Reply is sent from the plugin to Kuiper through the stdout of the plugin process. A reply with a non-zero id is the
+// result of the command with that id. A reply with the event set is an event of a running source instance.
+type Reply struct {
+	Id     int64           `json:"id,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+
+	Event    string                 `json:"event,omitempty"`
+	Instance string                 `json:"instance,omitempty"`
+	Message  map[string]interface{} `json:"message,omitempty"`
+	Meta     map[string]interface{} `json:"meta,omitempty"`
+}
+
+// PluginInfo is the result of the info command which lists the symbols provided by the plugin
+type PluginInfo struct {
+	Sources   []string    `json:"sources"`
+	Sinks     []string    `json:"sinks"`
+	Functions []*FuncInfo `json:"functions"`
+}
+
+type FuncInfo struct {
+	Name      string `json:"name"`
+	Aggregate bool   `json:"aggregate"`
+}
+
+// ArgDesc describes an argument expression of a function call for the validate command
+type ArgDesc struct {
+	Type   string      `json:"type"`
+	Value  interface{} `json:"value,omitempty"`
+	Stream string      `json:"stream,omitempty"`
+	Name   string      `json:"name,omitempty"`
+}
+
+// EncodeArgs converts the argument expressions of a function call to the argument descriptions
+func EncodeArgs(args []interface{}) []interface{} {
+	result := make([]interface{}, len(args))
+	for i, arg := range args {
+		var d *ArgDesc
+		switch t := arg.(type) {
+		case *xsql.StringLiteral:
+			d = &ArgDesc{Type: ARG_STRING, Value: t.Val}
+		case *xsql.IntegerLiteral:
+			d = &ArgDesc{Type: ARG_INTEGER, Value: t.Val}
+		case *xsql.NumberLiteral:
+			d = &ArgDesc{Type: ARG_NUMBER, Value: t.Val}
+		case *xsql.BooleanLiteral:
+			d = &ArgDesc{Type: ARG_BOOLEAN, Value: t.Val}
+		case *xsql.FieldRef:
+			d = &ArgDesc{Type: ARG_FIELD, Stream: string(t.StreamName), Name: t.Name}
+		case *xsql.Call:
+			d = &ArgDesc{Type: ARG_CALL, Name: t.Name}
+		default:
+			d = &ArgDesc{Type: ARG_EXPR}
+		}
+		result[i] = d
+	}
+	return result
+}
+
+// DecodeArgs converts the argument descriptions back to the expressions. The arguments other than the literals, the
+// field references and the function calls are converted to nil.
+func DecodeArgs(args []interface{}) ([]interface{}, error) {
+	result := make([]interface{}, len(args))
+	for i, arg := range args {
+		b, err := json.Marshal(arg)
+		if err != nil {
+			return nil, err
+		}
+		d := &ArgDesc{}
+		if err := Unmarshal(b, d); err != nil {
+			return nil, err
+		}
+		switch d.Type {
+		case ARG_STRING:
+			s, _ := d.Value.(string)
+			result[i] = &xsql.StringLiteral{Val: s}
+		case ARG_INTEGER:
+			v, _ := d.Value.(int)
+			result[i] = &xsql.IntegerLiteral{Val: v}
+		case ARG_NUMBER:
+			switch v := d.Value.(type) {
+			case int:
+				result[i] = &xsql.NumberLiteral{Val: float64(v)}
+			case float64:
+				result[i] = &xsql.NumberLiteral{Val: v}
+			}
+		case ARG_BOOLEAN:
+			v, _ := d.Value.(bool)
+			result[i] = &xsql.BooleanLiteral{Val: v}
+		case ARG_FIELD:
+			result[i] = &xsql.FieldRef{StreamName: xsql.StreamName(d.Stream), Name: d.Name}
+		case ARG_CALL:
+			result[i] = &xsql.Call{Name: d.Name}
+		}
+	}
+	return result, nil
+}
+
+// Unmarshal decodes the json data like json.Unmarshal but decodes the integers as int instead of float64 so that the
+// values keep the same types as in Kuiper.
+func Unmarshal(data []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+	convertAll(v)
+	return nil
+}
+
+func convertAll(v interface{}) {
+	switch t := v.(type) {
+	case *interface{}:
+		*t = convertNumbers(*t)
+	case *[]interface{}:
+		*t = convertNumbers(*t).([]interface{})
+	case *map[string]interface{}:
+		*t = convertNumbers(*t).(map[string]interface{})
+	case *Command:
+		t.Props = convertMap(t.Props)
+		t.Args = convertNumbers(t.Args).([]interface{})
+		t.Data = convertNumbers(t.Data)
+	case *Reply:
+		t.Message = convertMap(t.Message)
+		t.Meta = convertMap(t.Meta)
+	case *ArgDesc:
+		t.Value = convertNumbers(t.Value)
+	}
+}
+
+func convertMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	return convertNumbers(m).(map[string]interface{})
+}
+
+func convertNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if !strings.ContainsAny(t.String(), ".eE") {
+			if i, err := t.Int64(); err == nil {
+				return int(i)
+			}
+		}
+		f, _ := t.Float64()
+		return f
+	case []interface{}:
+		for i, e := range t {
+			t[i] = convertNumbers(e)
+		}
+		return t
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = convertNumbers(e)
+		}
+		return t
+	default:
+		return v
+	}
+}
@@ -0,0 +1,165 @@
+package portable
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/emqx/kuiper/xstream/api"
+)
+
+// PortableSource runs the source in the plugin process and receives the data as the events of its instance
+type PortableSource struct {
+	symbol     string
+	plugin     *pluginIns
+	datasource string
+	props      map[string]interface{}
+	instance   string
+}
+
+func (s *PortableSource) Configure(datasource string, props map[string]interface{}) error {
+	s.datasource = datasource
+	s.props = props
+	return nil
+}
+
+func (s *PortableSource) Open(ctx api.StreamContext, consumer chan<- api.SourceTuple, errCh chan<- error) {
+	logger := ctx.GetLogger()
+	s.instance = newInstanceId("source")
+	receiver := newEventReceiver()
+	err := s.plugin.startInstance(&Command{
+		Cmd:        CMD_SOURCE_START,
+		Symbol:     s.symbol,
+		Instance:   s.instance,
+		Meta:       newRuntimeMeta(ctx),
+		DataSource: s.datasource,
+		Props:      s.props,
+	}, receiver)
+	if err != nil {
+		errCh <- fmt.Errorf("fail to start portable source %s: %v", s.symbol, err)
+		return
+	}
+	logger.Infof("Successfully start portable source %s of plugin %s", s.symbol, s.plugin.name)
+	defer func() {
+		s.plugin.removeReceiver(s.instance)
+		if n := atomic.LoadInt64(&receiver.dropped); n > 0 {
+			logger.Warnf("Portable source %s dropped %d events in total", s.symbol, n)
+		}
+	}()
+	for {
+		select {
+		case r := <-receiver.ch:
+			select {
+			case consumer <- api.NewDefaultSourceTuple(r.Message, r.Meta):
+			case <-ctx.Done():
+				return
+			}
+		case r := <-receiver.errCh:
+			select {
+			case errCh <- fmt.Errorf("%s", r.Error):
+			case <-ctx.Done():
+			}
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *PortableSource) Close(ctx api.StreamContext) error {
+	if s.instance == "" {
+		return nil
+	}
+	ctx.GetLogger().Infof("Closing portable source %s", s.symbol)
+	return s.plugin.stopInstance(CMD_SOURCE_STOP, s.instance)
+}
+
+// PortableSink runs the sink in the plugin process and sends the data to it by the collect command
+type PortableSink struct {
+	symbol   string
+	plugin   *pluginIns
+	props    map[string]interface{}
+	instance string
+}
+
+func (s *PortableSink) Configure(props map[string]interface{}) error {
+	s.props = props
+	return nil
+}
+
+func (s *PortableSink) Open(ctx api.StreamContext) error {
+	s.instance = newInstanceId("sink")
+	err := s.plugin.startInstance(&Command{
+		Cmd:      CMD_SINK_START,
+		Symbol:   s.symbol,
+		Instance: s.instance,
+		Meta:     newRuntimeMeta(ctx),
+		Props:    s.props,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("fail to start portable sink %s: %v", s.symbol, err)
+	}
+	ctx.GetLogger().Infof("Successfully start portable sink %s of plugin %s", s.symbol, s.plugin.name)
+	return nil
+}
+
+// Collect sends the data to the plugin. The encoded data of the []byte type is sent as a string.
+func (s *PortableSink) Collect(_ api.StreamContext, data interface{}) error {
+	if b, ok := data.([]byte); ok {
+		data = string(b)
+	}
+	_, err := s.plugin.call(&Command{
+		Cmd:      CMD_SINK_COLLECT,
+		Instance: s.instance,
+		Data:     data,
+	}, callTimeout)
+	return err
+}
+
+func (s *PortableSink) Close(ctx api.StreamContext) error {
+	if s.instance == "" {
+		return nil
+	}
+	ctx.GetLogger().Infof("Closing portable sink %s", s.symbol)
+	return s.plugin.stopInstance(CMD_SINK_STOP, s.instance)
+}
+
+// PortableFunc calls the function in the plugin process
+type PortableFunc struct {
+	symbol string
+	plugin *pluginIns
+	isAgg  bool
+}
+
+func (f *PortableFunc) Validate(args []interface{}) error {
+	_, err := f.plugin.call(&Command{
+		Cmd:    CMD_FUNC_VALIDATE,
+		Symbol: f.symbol,
+		Args:   EncodeArgs(args),
+	}, callTimeout)
+	return err
+}
+
+func (f *PortableFunc) Exec(args []interface{}, ctx api.FunctionContext) (interface{}, bool) {
+	meta := newRuntimeMeta(ctx)
+	meta.FuncId = ctx.GetFuncId()
+	r, err := f.plugin.call(&Command{
+		Cmd:    CMD_FUNC_EXEC,
+		Symbol: f.symbol,
+		Meta:   meta,
+		Args:   args,
+	}, callTimeout)
+	if err != nil {
+		return fmt.Errorf("run %s function error: %v", f.symbol, err), false
+	}
+	var result interface{}
+	if len(r) > 0 {
+		if err := Unmarshal(r, &result); err != nil {
+			return fmt.Errorf("run %s function error: invalid result %s", f.symbol, r), false
+		}
+	}
+	return result, true
+}
+
+func (f *PortableFunc) IsAggregate() bool {
+	return f.isAgg
+}
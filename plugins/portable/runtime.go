@@ -0,0 +1,455 @@
+package portable
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/xstream/api"
+)
+
+var (
+	// The timeout of a command except the ones sent by the running source and sink instances
+	callTimeout = 10 * time.Second
+	// The interval and the timeout of the ping command to check the health of the plugin process
+	healthInterval = 5 * time.Second
+	healthTimeout  = 3 * time.Second
+	// The plugin process is killed and restarted if the health check fails for these times in a row
+	healthRetries = 3
+	// The restart interval is doubled for each failure until the max interval
+	restartInterval    = time.Second
+	maxRestartInterval = 30 * time.Second
+	// The time to wait for the plugin process to exit by itself after closing its stdin
+	stopTimeout = 2 * time.Second
+	// The number of the data events buffered for a source instance. The events are dropped if the buffer is full.
+	eventBufferSize = 1024
+)
+
+// The event channels of a running source instance. The events are sent without blocking so that a slow rule does not
+// block the replies and the health check of the whole plugin process.
+type eventReceiver struct {
+	ch chan *Reply
+	// The error event is kept separately so that it is not dropped
+	errCh chan *Reply
+	// The count of the dropped data events
+	dropped int64
+}
+
+func newEventReceiver() *eventReceiver {
+	return &eventReceiver{
+		ch:    make(chan *Reply, eventBufferSize),
+		errCh: make(chan *Reply, 1),
+	}
+}
+
+// pluginIns is the running process of a plugin. All the source, sink and function instances of a plugin share the
+// same process, and the commands are multiplexed by the instance id. The process is restarted automatically if it
+// exits unexpectedly or fails the health check, and the running source and sink instances are started again in the
+// new process.
+type pluginIns struct {
+	name       string
+	executable string
+	dir        string
+
+	seq int64
+	sync.Mutex
+	// below fields are guarded by the mutex
+	stdin   io.WriteCloser
+	process *exec.Cmd
+	exited  chan struct{}
+	running bool
+	// The process is ready after the running instances are started again
+	ready     bool
+	stopped   bool
+	info      *PluginInfo
+	pending   map[int64]chan *Reply
+	instances map[string]*Command
+	receivers map[string]*eventReceiver
+
+	writeLock sync.Mutex
+	done      chan struct{}
+	// The process is launched once, either when the plugin is loaded or when it is used for the first time. If the
+	// launch fails, it is tried again when the plugin is used next time.
+	launchLock sync.Mutex
+	launched   bool
+}
+
+func newPluginIns(name, executable, dir string) *pluginIns {
+	return &pluginIns{
+		name:       name,
+		executable: executable,
+		dir:        dir,
+		pending:    make(map[int64]chan *Reply),
+		instances:  make(map[string]*Command),
+		receivers:  make(map[string]*eventReceiver),
+		done:       make(chan struct{}),
+	}
+}
+
+// run starts the process and keeps it healthy until stop is called. It only starts the process for the first successful
+// call, the later calls do nothing.
+func (p *pluginIns) run() error {
+	p.launchLock.Lock()
+	defer p.launchLock.Unlock()
+	if p.launched {
+		return nil
+	}
+	if err := p.start(); err != nil {
+		return err
+	}
+	p.launched = true
+	go p.healthCheck()
+	return nil
+}
+
+func (p *pluginIns) start() error {
+	cmd := exec.Command(p.executable)
+	cmd.Dir = p.dir
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("fail to start plugin %s: %v", p.name, err)
+	}
+	common.Log.Infof("portable plugin %s is started with pid %d", p.name, cmd.Process.Pid)
+	exited := make(chan struct{})
+	go p.log(stderr)
+	go func() {
+		p.read(stdout)
+		err := cmd.Wait()
+		close(exited)
+		p.onExit(cmd, err)
+	}()
+	p.Lock()
+	if p.stopped {
+		p.Unlock()
+		_ = cmd.Process.Kill()
+		return fmt.Errorf("plugin %s is stopped", p.name)
+	}
+	p.stdin = stdin
+	p.process = cmd
+	p.exited = exited
+	p.running = true
+	p.Unlock()
+
+	r, err := p.request(&Command{Cmd: CMD_INFO}, callTimeout, false)
+	if err == nil {
+		info := &PluginInfo{}
+		if err = json.Unmarshal(r, info); err == nil {
+			p.Lock()
+			p.info = info
+			p.Unlock()
+		}
+	}
+	if err != nil {
+		// Detach the process before killing it so that it will not be restarted
+		p.Lock()
+		p.process = nil
+		p.running = false
+		p.Unlock()
+		_ = cmd.Process.Kill()
+		<-exited
+		return fmt.Errorf("fail to get the info of plugin %s: %v", p.name, err)
+	}
+	// Restart the running instances
+	p.Lock()
+	commands := make([]*Command, 0, len(p.instances))
+	for _, c := range p.instances {
+		commands = append(commands, c)
+	}
+	p.Unlock()
+	for _, c := range commands {
+		if _, err := p.request(c, callTimeout, false); err != nil {
+			common.Log.Errorf("fail to restart instance %s of portable plugin %s: %v", c.Instance, p.name, err)
+		}
+	}
+	p.Lock()
+	p.ready = p.process == cmd
+	p.Unlock()
+	return nil
+}
+
+// read dispatches the replies and the events from the stdout of the process until it is closed
+func (p *pluginIns) read(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		r := &Reply{}
+		if err := Unmarshal(scanner.Bytes(), r); err != nil {
+			common.Log.Errorf("portable plugin %s sends invalid reply %s: %v", p.name, scanner.Text(), err)
+			continue
+		}
+		if r.Id != 0 {
+			p.Lock()
+			ch, ok := p.pending[r.Id]
+			delete(p.pending, r.Id)
+			p.Unlock()
+			if ok {
+				ch <- r
+			}
+			continue
+		}
+		p.Lock()
+		rc, ok := p.receivers[r.Instance]
+		p.Unlock()
+		if !ok {
+			common.Log.Debugf("portable plugin %s sends %s event to the stopped instance %s", p.name, r.Event, r.Instance)
+			continue
+		}
+		p.dispatch(rc, r)
+	}
+}
+
+// dispatch sends the event to the source instance without blocking
+func (p *pluginIns) dispatch(rc *eventReceiver, r *Reply) {
+	var ch chan *Reply
+	switch r.Event {
+	case EVENT_DATA:
+		ch = rc.ch
+	case EVENT_ERROR:
+		ch = rc.errCh
+	default:
+		common.Log.Errorf("portable plugin %s sends unknown event %s to instance %s", p.name, r.Event, r.Instance)
+		return
+	}
+	select {
+	case ch <- r:
+	default:
+		n := atomic.AddInt64(&rc.dropped, 1)
+		if n == 1 || n%int64(eventBufferSize) == 0 {
+			common.Log.Warnf("portable plugin %s drops %d %s events of instance %s because the rule does not consume them in time", p.name, n, r.Event, r.Instance)
+		}
+	}
+}
+
+// log forwards the stderr of the process to the Kuiper log
+func (p *pluginIns) log(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		common.Log.Infof("[portable plugin %s] %s", p.name, scanner.Text())
+	}
+}
+
+func (p *pluginIns) onExit(cmd *exec.Cmd, err error) {
+	p.Lock()
+	if p.process != cmd {
+		p.Unlock()
+		return
+	}
+	p.running = false
+	p.ready = false
+	for id, ch := range p.pending {
+		ch <- &Reply{Id: id, Error: fmt.Sprintf("plugin %s exited", p.name)}
+		delete(p.pending, id)
+	}
+	stopped := p.stopped
+	p.Unlock()
+	if stopped {
+		common.Log.Infof("portable plugin %s is stopped", p.name)
+		return
+	}
+	common.Log.Errorf("portable plugin %s exited unexpectedly: %v", p.name, err)
+	interval := restartInterval
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-time.After(interval):
+		}
+		err := p.start()
+		if err == nil {
+			return
+		}
+		common.Log.Errorf("fail to restart portable plugin %s: %v", p.name, err)
+		interval *= 2
+		if interval > maxRestartInterval {
+			interval = maxRestartInterval
+		}
+	}
+}
+
+func (p *pluginIns) healthCheck() {
+	ticker := time.NewTicker(healthInterval)
+	defer ticker.Stop()
+	failures := 0
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+		if !p.isRunning() {
+			failures = 0
+			continue
+		}
+		if _, err := p.request(&Command{Cmd: CMD_PING}, healthTimeout, false); err != nil {
+			failures++
+			common.Log.Warnf("health check of portable plugin %s fails %d times: %v", p.name, failures, err)
+			if failures >= healthRetries {
+				failures = 0
+				p.kill()
+			}
+		} else {
+			failures = 0
+		}
+	}
+}
+
+func (p *pluginIns) isRunning() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.ready
+}
+
+// kill terminates the process. It will be restarted unless the plugin is stopped.
+func (p *pluginIns) kill() {
+	p.Lock()
+	cmd := p.process
+	p.Unlock()
+	if cmd != nil && cmd.Process != nil {
+		_ = cmd.Process.Kill()
+	}
+}
+
+// stop closes the stdin of the process so that it exits gracefully, and kills it after the timeout
+func (p *pluginIns) stop() {
+	p.Lock()
+	if p.stopped {
+		p.Unlock()
+		return
+	}
+	p.stopped = true
+	close(p.done)
+	stdin, exited := p.stdin, p.exited
+	p.Unlock()
+	if stdin == nil {
+		return
+	}
+	_ = stdin.Close()
+	select {
+	case <-exited:
+	case <-time.After(stopTimeout):
+		p.kill()
+		<-exited
+	}
+}
+
+func (p *pluginIns) getInfo() *PluginInfo {
+	p.Lock()
+	defer p.Unlock()
+	return p.info
+}
+
+// call sends the command and waits for the result
+func (p *pluginIns) call(c *Command, timeout time.Duration) (json.RawMessage, error) {
+	return p.request(c, timeout, true)
+}
+
+// request sends the command if the process is running. The commands of the sources, sinks and functions are only sent
+// after the process is ready.
+func (p *pluginIns) request(c *Command, timeout time.Duration, waitReady bool) (json.RawMessage, error) {
+	id := atomic.AddInt64(&p.seq, 1)
+	cmd := *c
+	cmd.Id = id
+	b, err := json.Marshal(&cmd)
+	if err != nil {
+		return nil, fmt.Errorf("fail to encode command %s: %v", c.Cmd, err)
+	}
+	ch := make(chan *Reply, 1)
+	p.Lock()
+	if !p.running || (waitReady && !p.ready) {
+		p.Unlock()
+		return nil, fmt.Errorf("plugin %s is not running", p.name)
+	}
+	p.pending[id] = ch
+	stdin := p.stdin
+	p.Unlock()
+
+	p.writeLock.Lock()
+	_, err = stdin.Write(append(b, '\n'))
+	p.writeLock.Unlock()
+	if err != nil {
+		p.Lock()
+		delete(p.pending, id)
+		p.Unlock()
+		return nil, fmt.Errorf("fail to send command %s to plugin %s: %v", c.Cmd, p.name, err)
+	}
+	select {
+	case r := <-ch:
+		if r.Error != "" {
+			return nil, fmt.Errorf("%s", r.Error)
+		}
+		return r.Result, nil
+	case <-time.After(timeout):
+		p.Lock()
+		delete(p.pending, id)
+		p.Unlock()
+		return nil, fmt.Errorf("command %s to plugin %s timeout", c.Cmd, p.name)
+	}
+}
+
+// startInstance starts a source or sink instance and remembers it to start again after the process restarts
+func (p *pluginIns) startInstance(c *Command, receiver *eventReceiver) error {
+	if err := p.run(); err != nil {
+		return err
+	}
+	p.Lock()
+	p.instances[c.Instance] = c
+	if receiver != nil {
+		p.receivers[c.Instance] = receiver
+	}
+	p.Unlock()
+	if _, err := p.call(c, callTimeout); err != nil {
+		p.Lock()
+		delete(p.instances, c.Instance)
+		delete(p.receivers, c.Instance)
+		p.Unlock()
+		return err
+	}
+	return nil
+}
+
+// removeReceiver stops dispatching the events to the source instance
+func (p *pluginIns) removeReceiver(instance string) {
+	p.Lock()
+	delete(p.receivers, instance)
+	p.Unlock()
+}
+
+func (p *pluginIns) stopInstance(cmd string, instance string) error {
+	p.Lock()
+	delete(p.instances, instance)
+	delete(p.receivers, instance)
+	p.Unlock()
+	_, err := p.call(&Command{Cmd: cmd, Instance: instance}, callTimeout)
+	return err
+}
+
+var instanceSeq int64
+
+func newInstanceId(t string) string {
+	return fmt.Sprintf("%s%d", t, atomic.AddInt64(&instanceSeq, 1))
+}
+
+func newRuntimeMeta(ctx api.StreamContext) *RuntimeMeta {
+	return &RuntimeMeta{
+		RuleId:     ctx.GetRuleId(),
+		OpId:       ctx.GetOpId(),
+		InstanceId: ctx.GetInstanceId(),
+	}
+}
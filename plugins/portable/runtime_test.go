@@ -0,0 +1,73 @@
+package portable
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadWithoutConsumer(t *testing.T) {
+	p := newPluginIns("test", "", "")
+	rc := newEventReceiver()
+	p.receivers["source1"] = rc
+	p.receivers["source2"] = newEventReceiver()
+	p.removeReceiver("source2")
+	reply := make(chan *Reply, 1)
+	p.pending[1] = reply
+
+	var lines []string
+	for i := 0; i < eventBufferSize+100; i++ {
+		lines = append(lines, fmt.Sprintf(`{"event":"data","instance":"source1","message":{"i":%d}}`, i))
+	}
+	lines = append(lines,
+		`{"event":"data","instance":"source2","message":{"i":0}}`,
+		`{"event":"error","instance":"source1","error":"source error"}`,
+		`{"id":1,"result":"pong"}`,
+	)
+	done := make(chan struct{})
+	go func() {
+		p.read(strings.NewReader(strings.Join(lines, "\n")))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("read is blocked by the source instance which does not consume the events")
+	}
+	select {
+	case r := <-reply:
+		if string(r.Result) != `"pong"` {
+			t.Errorf("reply mismatch, got %s", r.Result)
+		}
+	default:
+		t.Errorf("the reply is not received")
+	}
+	if len(rc.ch) != eventBufferSize || rc.dropped != 100 {
+		t.Errorf("expect %d buffered and 100 dropped events, got %d buffered and %d dropped", eventBufferSize, len(rc.ch), rc.dropped)
+	}
+	if r := <-rc.ch; fmt.Sprint(r.Message["i"]) != "0" {
+		t.Errorf("the first event mismatch, got %v", r.Message)
+	}
+	select {
+	case r := <-rc.errCh:
+		if r.Error != "source error" {
+			t.Errorf("error event mismatch, got %s", r.Error)
+		}
+	default:
+		t.Errorf("the error event is dropped")
+	}
+}
+
+func TestRunAgainAfterFailure(t *testing.T) {
+	p := newPluginIns("test", "/nonexistent/plugin", "")
+	defer p.stop()
+	if err := p.run(); err == nil || !strings.HasPrefix(err.Error(), "fail to start plugin test") {
+		t.Fatalf("expect start error but got %v", err)
+	}
+	// The executable is installed later but it is not a valid plugin
+	p.executable = "/bin/true"
+	if err := p.run(); err == nil || !strings.HasPrefix(err.Error(), "fail to get the info of plugin test") {
+		t.Errorf("expect the plugin is started again but got %v", err)
+	}
+}
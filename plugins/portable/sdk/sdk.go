@@ -0,0 +1,340 @@
+// Package sdk is the Go SDK to write the portable plugins of Kuiper. A portable plugin is an executable which talks to
+// Kuiper by its stdin and stdout. The sources, sinks and functions implement the same interfaces of the go plugins.
+//
+//	func main() {
+//		sdk.Start(&sdk.PluginConfig{
+//			Sources:   map[string]sdk.NewSourceFunc{"random": func() api.Source { return &random{} }},
+//			Functions: map[string]sdk.NewFunctionFunc{"echo": func() api.Function { return &echo{} }},
+//		})
+//	}
+package sdk
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/plugins/portable"
+	"github.com/emqx/kuiper/xstream/api"
+	"github.com/emqx/kuiper/xstream/contexts"
+	"github.com/emqx/kuiper/xstream/states"
+)
+
+type NewSourceFunc func() api.Source
+type NewSinkFunc func() api.Sink
+type NewFunctionFunc func() api.Function
+
+// PluginConfig defines the symbols provided by the plugin. The key of each map is the symbol name.
+type PluginConfig struct {
+	Sources   map[string]NewSourceFunc
+	Sinks     map[string]NewSinkFunc
+	Functions map[string]NewFunctionFunc
+}
+
+// Start serves the plugin by the stdin and the stdout until Kuiper closes the stdin. The stdout is used by the
+// protocol so the plugin must not print to it. The log of the plugin is printed to the stderr which is forwarded to
+// the Kuiper log.
+func Start(conf *PluginConfig) {
+	common.Log.SetOutput(os.Stderr)
+	if err := Serve(conf, os.Stdin, os.Stdout); err != nil {
+		common.Log.Fatal(err)
+	}
+}
+
+type runningIns struct {
+	ctx    api.StreamContext
+	cancel context.CancelFunc
+	source api.Source
+	sink   api.Sink
+}
+
+type server struct {
+	conf *PluginConfig
+	out  io.Writer
+
+	writeLock sync.Mutex
+	sync.Mutex
+	// below fields are guarded by the mutex
+	instances map[string]*runningIns
+	functions map[string]api.Function
+	contexts  map[string]api.StreamContext
+}
+
+// Serve reads the commands from the reader and writes the replies to the writer until the reader is closed
+func Serve(conf *PluginConfig, in io.Reader, out io.Writer) error {
+	s := &server{
+		conf:      conf,
+		out:       out,
+		instances: make(map[string]*runningIns),
+		functions: make(map[string]api.Function),
+		contexts:  make(map[string]api.StreamContext),
+	}
+	defer s.closeAll()
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	var wg sync.WaitGroup
+	for scanner.Scan() {
+		c := &portable.Command{}
+		if err := portable.Unmarshal(scanner.Bytes(), c); err != nil {
+			common.Log.Errorf("invalid command %s: %v", scanner.Text(), err)
+			continue
+		}
+		wg.Add(1)
+		// Kuiper waits for the reply before sending the next command of the same instance, so the commands can run
+		// concurrently
+		go func() {
+			defer wg.Done()
+			result, err := s.handle(c)
+			r := &portable.Reply{Id: c.Id}
+			if err != nil {
+				r.Error = err.Error()
+			} else if result != nil {
+				b, err := json.Marshal(result)
+				if err != nil {
+					r.Error = fmt.Sprintf("fail to encode the result: %v", err)
+				} else {
+					r.Result = b
+				}
+			}
+			s.send(r)
+		}()
+	}
+	wg.Wait()
+	return scanner.Err()
+}
+
+func (s *server) send(r *portable.Reply) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		common.Log.Errorf("fail to encode reply: %v", err)
+		return
+	}
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	if _, err := s.out.Write(append(b, '\n')); err != nil {
+		common.Log.Errorf("fail to send reply: %v", err)
+	}
+}
+
+func (s *server) handle(c *portable.Command) (interface{}, error) {
+	switch c.Cmd {
+	case portable.CMD_INFO:
+		return s.info(), nil
+	case portable.CMD_PING:
+		return nil, nil
+	case portable.CMD_SOURCE_START:
+		return nil, s.startSource(c)
+	case portable.CMD_SINK_START:
+		return nil, s.startSink(c)
+	case portable.CMD_SINK_COLLECT:
+		ins, ok := s.getIns(c.Instance)
+		if !ok || ins.sink == nil {
+			return nil, fmt.Errorf("sink instance %s is not found", c.Instance)
+		}
+		data := c.Data
+		if str, ok := data.(string); ok {
+			data = []byte(str)
+		}
+		return nil, ins.sink.Collect(ins.ctx, data)
+	case portable.CMD_SOURCE_STOP, portable.CMD_SINK_STOP:
+		return nil, s.stop(c.Instance)
+	case portable.CMD_FUNC_VALIDATE:
+		f, err := s.getFunction(c.Symbol)
+		if err != nil {
+			return nil, err
+		}
+		args, err := portable.DecodeArgs(c.Args)
+		if err != nil {
+			return nil, err
+		}
+		return nil, f.Validate(args)
+	case portable.CMD_FUNC_EXEC:
+		f, err := s.getFunction(c.Symbol)
+		if err != nil {
+			return nil, err
+		}
+		if c.Meta == nil {
+			return nil, fmt.Errorf("missing meta of function %s", c.Symbol)
+		}
+		ctx, err := s.getContext(c.Meta)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := f.Exec(c.Args, contexts.NewDefaultFuncContext(ctx, c.Meta.FuncId))
+		if !ok {
+			if e, isErr := r.(error); isErr {
+				return nil, e
+			}
+			return nil, fmt.Errorf("%v", r)
+		}
+		return r, nil
+	default:
+		return nil, fmt.Errorf("unknown command %s", c.Cmd)
+	}
+}
+
+func (s *server) info() *portable.PluginInfo {
+	info := &portable.PluginInfo{
+		Sources:   make([]string, 0, len(s.conf.Sources)),
+		Sinks:     make([]string, 0, len(s.conf.Sinks)),
+		Functions: make([]*portable.FuncInfo, 0, len(s.conf.Functions)),
+	}
+	for k := range s.conf.Sources {
+		info.Sources = append(info.Sources, k)
+	}
+	for k := range s.conf.Sinks {
+		info.Sinks = append(info.Sinks, k)
+	}
+	for k := range s.conf.Functions {
+		f, err := s.getFunction(k)
+		if err == nil {
+			info.Functions = append(info.Functions, &portable.FuncInfo{Name: k, Aggregate: f.IsAggregate()})
+		}
+	}
+	return info
+}
+
+func newContext(meta *portable.RuntimeMeta) (api.StreamContext, error) {
+	if meta == nil {
+		meta = &portable.RuntimeMeta{}
+	}
+	store, err := states.CreateStore(meta.RuleId, api.AtMostOnce)
+	if err != nil {
+		return nil, err
+	}
+	return contexts.Background().WithMeta(meta.RuleId, meta.OpId, store).WithInstance(meta.InstanceId), nil
+}
+
+// getContext returns the context of the function instances of an operator so that their states are kept
+func (s *server) getContext(meta *portable.RuntimeMeta) (api.StreamContext, error) {
+	key := fmt.Sprintf("%s/%s/%d", meta.RuleId, meta.OpId, meta.InstanceId)
+	s.Lock()
+	defer s.Unlock()
+	if ctx, ok := s.contexts[key]; ok {
+		return ctx, nil
+	}
+	ctx, err := newContext(meta)
+	if err != nil {
+		return nil, err
+	}
+	s.contexts[key] = ctx
+	return ctx, nil
+}
+
+func (s *server) getFunction(name string) (api.Function, error) {
+	s.Lock()
+	defer s.Unlock()
+	if f, ok := s.functions[name]; ok {
+		return f, nil
+	}
+	nf, ok := s.conf.Functions[name]
+	if !ok {
+		return nil, fmt.Errorf("function %s is not found", name)
+	}
+	f := nf()
+	s.functions[name] = f
+	return f, nil
+}
+
+func (s *server) getIns(instance string) (*runningIns, bool) {
+	s.Lock()
+	defer s.Unlock()
+	ins, ok := s.instances[instance]
+	return ins, ok
+}
+
+func (s *server) startSource(c *portable.Command) error {
+	nf, ok := s.conf.Sources[c.Symbol]
+	if !ok {
+		return fmt.Errorf("source %s is not found", c.Symbol)
+	}
+	source := nf()
+	if err := source.Configure(c.DataSource, c.Props); err != nil {
+		return err
+	}
+	ctx, err := newContext(c.Meta)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := ctx.WithCancel()
+	s.Lock()
+	s.instances[c.Instance] = &runningIns{ctx: ctx, cancel: cancel, source: source}
+	s.Unlock()
+
+	consumer := make(chan api.SourceTuple)
+	errCh := make(chan error)
+	go source.Open(ctx, consumer, errCh)
+	go func() {
+		for {
+			select {
+			case t := <-consumer:
+				s.send(&portable.Reply{Event: portable.EVENT_DATA, Instance: c.Instance, Message: t.Message(), Meta: t.Meta()})
+			case err := <-errCh:
+				s.send(&portable.Reply{Event: portable.EVENT_ERROR, Instance: c.Instance, Error: err.Error()})
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *server) startSink(c *portable.Command) error {
+	nf, ok := s.conf.Sinks[c.Symbol]
+	if !ok {
+		return fmt.Errorf("sink %s is not found", c.Symbol)
+	}
+	sink := nf()
+	if err := sink.Configure(c.Props); err != nil {
+		return err
+	}
+	ctx, err := newContext(c.Meta)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := ctx.WithCancel()
+	if err := sink.Open(ctx); err != nil {
+		cancel()
+		return err
+	}
+	s.Lock()
+	s.instances[c.Instance] = &runningIns{ctx: ctx, cancel: cancel, sink: sink}
+	s.Unlock()
+	return nil
+}
+
+func (s *server) stop(instance string) error {
+	s.Lock()
+	ins, ok := s.instances[instance]
+	delete(s.instances, instance)
+	s.Unlock()
+	if !ok {
+		return nil
+	}
+	return closeIns(ins)
+}
+
+func closeIns(ins *runningIns) error {
+	ins.cancel()
+	if ins.source != nil {
+		return ins.source.Close(ins.ctx)
+	}
+	return ins.sink.Close(ins.ctx)
+}
+
+func (s *server) closeAll() {
+	s.Lock()
+	instances := s.instances
+	s.instances = make(map[string]*runningIns)
+	s.Unlock()
+	for id, ins := range instances {
+		if err := closeIns(ins); err != nil {
+			common.Log.Errorf("fail to close instance %s: %v", id, err)
+		}
+	}
+}
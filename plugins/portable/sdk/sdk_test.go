@@ -0,0 +1,375 @@
+package sdk
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/plugins/portable"
+	"github.com/emqx/kuiper/xsql"
+	"github.com/emqx/kuiper/xstream/api"
+	"github.com/emqx/kuiper/xstream/contexts"
+	"github.com/emqx/kuiper/xstream/states"
+)
+
+// The test binary runs as the plugin process if this env is set
+const pluginEnv = "KUIPER_PORTABLE_TEST_PLUGIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(pluginEnv) == "1" {
+		Start(&PluginConfig{
+			Sources: map[string]NewSourceFunc{
+				"counter": func() api.Source { return &counterSource{} },
+			},
+			Sinks: map[string]NewSinkFunc{
+				"collector": func() api.Sink { return &collectorSink{} },
+			},
+			Functions: map[string]NewFunctionFunc{
+				"echo":      func() api.Function { return &echoFunc{} },
+				"total":     func() api.Function { return &totalFunc{} },
+				"collected": func() api.Function { return &collectedFunc{} },
+				"crash":     func() api.Function { return &crashFunc{} },
+			},
+		})
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+type counterSource struct {
+	max int
+}
+
+func (s *counterSource) Configure(_ string, props map[string]interface{}) error {
+	s.max, _ = props["max"].(int)
+	return nil
+}
+
+func (s *counterSource) Open(ctx api.StreamContext, consumer chan<- api.SourceTuple, _ chan<- error) {
+	for i := 1; i <= s.max; i++ {
+		select {
+		case consumer <- api.NewDefaultSourceTuple(map[string]interface{}{"count": i}, map[string]interface{}{"rule": ctx.GetRuleId()}):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *counterSource) Close(_ api.StreamContext) error {
+	return nil
+}
+
+var (
+	collected []interface{}
+	lock      sync.Mutex
+)
+
+type collectorSink struct{}
+
+func (s *collectorSink) Configure(_ map[string]interface{}) error {
+	return nil
+}
+
+func (s *collectorSink) Open(_ api.StreamContext) error {
+	return nil
+}
+
+func (s *collectorSink) Collect(_ api.StreamContext, data interface{}) error {
+	lock.Lock()
+	defer lock.Unlock()
+	collected = append(collected, string(data.([]byte)))
+	return nil
+}
+
+func (s *collectorSink) Close(_ api.StreamContext) error {
+	return nil
+}
+
+type echoFunc struct{}
+
+func (f *echoFunc) Validate(args []interface{}) error {
+	if len(args) != 1 {
+		return fmt.Errorf("echo function only supports 1 parameter but got %d", len(args))
+	}
+	if _, ok := args[0].(*xsql.FieldRef); !ok {
+		return fmt.Errorf("the parameter of echo function must be a field")
+	}
+	return nil
+}
+
+func (f *echoFunc) Exec(args []interface{}, ctx api.FunctionContext) (interface{}, bool) {
+	if err := ctx.IncrCounter("calls", 1); err != nil {
+		return err, false
+	}
+	c, _ := ctx.GetCounter("calls")
+	return []interface{}{args[0], c}, true
+}
+
+func (f *echoFunc) IsAggregate() bool {
+	return false
+}
+
+type totalFunc struct{}
+
+func (f *totalFunc) Validate(_ []interface{}) error {
+	return nil
+}
+
+func (f *totalFunc) Exec(args []interface{}, _ api.FunctionContext) (interface{}, bool) {
+	sum := 0
+	for _, v := range args[0].([]interface{}) {
+		sum += v.(int)
+	}
+	return sum, true
+}
+
+func (f *totalFunc) IsAggregate() bool {
+	return true
+}
+
+type collectedFunc struct{}
+
+func (f *collectedFunc) Validate(_ []interface{}) error {
+	return nil
+}
+
+func (f *collectedFunc) Exec(_ []interface{}, _ api.FunctionContext) (interface{}, bool) {
+	lock.Lock()
+	defer lock.Unlock()
+	return collected, true
+}
+
+func (f *collectedFunc) IsAggregate() bool {
+	return false
+}
+
+type crashFunc struct{}
+
+func (f *crashFunc) Validate(_ []interface{}) error {
+	return nil
+}
+
+func (f *crashFunc) Exec(_ []interface{}, _ api.FunctionContext) (interface{}, bool) {
+	os.Exit(1)
+	return nil, false
+}
+
+func (f *crashFunc) IsAggregate() bool {
+	return false
+}
+
+// createZip packages the test binary as a portable plugin
+func createZip(t *testing.T, file string, manifest string) {
+	exe, err := filepath.Abs(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := zip.NewWriter(f)
+	files := map[string]string{
+		"run.sh": fmt.Sprintf("#!/bin/sh\n%s=1 exec %s\n", pluginEnv, exe),
+	}
+	if manifest != "" {
+		files["portableTest.json"] = manifest
+	}
+	for name, content := range files {
+		h := &zip.FileHeader{Name: name, Method: zip.Deflate}
+		h.SetMode(0755)
+		fw, err := w.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPortablePlugin(t *testing.T) {
+	dir := t.TempDir()
+	createZip(t, filepath.Join(dir, "valid.zip"), `{"version":"v1.0.0","language":"go","executable":"run.sh","sources":["counter"],"sinks":["collector"],"functions":["echo","total","collected","crash"]}`)
+	createZip(t, filepath.Join(dir, "missing.zip"), `{"executable":"run.sh","functions":["echo","unknown"]}`)
+	createZip(t, filepath.Join(dir, "nojson.zip"), "")
+	createZip(t, filepath.Join(dir, "traversal.zip"), `{"executable":"run.sh","sources":["../kuiper"]}`)
+	createZip(t, filepath.Join(dir, "builtin.zip"), `{"executable":"run.sh","functions":["echo","count"]}`)
+	createZip(t, filepath.Join(dir, "conf.zip"), `{"executable":"run.sh","sources":["mqtt"]}`)
+	portable.SetSymbolChecker(func(t int, name string) bool {
+		return t == portable.SOURCE && name == "mqtt"
+	})
+	defer portable.SetSymbolChecker(nil)
+	pm, err := portable.GetManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		file string
+		err  string
+	}{
+		{
+			file: "nojson.zip",
+			err:  "fail to install plugin: invalid zip file: plugin json file portableTest.json is missing",
+		}, {
+			file: "traversal.zip",
+			err:  "fail to install plugin: invalid plugin json file: invalid source name ../kuiper",
+		}, {
+			file: "builtin.zip",
+			err:  "fail to install plugin: invalid plugin json file: function count already exists",
+		}, {
+			file: "conf.zip",
+			err:  "fail to install plugin: invalid plugin json file: source mqtt already exists",
+		}, {
+			file: "missing.zip",
+			err:  "fail to install plugin: plugin portableTest does not provide function unknown",
+		}, {
+			file: "valid.zip",
+		}, {
+			file: "valid.zip",
+			err:  "invalid name portableTest: duplicate",
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		err := pm.Register("portableTest", "file://"+filepath.Join(dir, tt.file), nil)
+		if !reflect.DeepEqual(tt.err, common.Errstring(err)) {
+			t.Errorf("%d. %s: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.file, tt.err, err)
+		}
+	}
+	defer pm.Delete("portableTest")
+	etcDir, err := common.GetConfLoc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(etcDir, "kuiper.yaml")); err != nil {
+		t.Errorf("the configuration is removed by the invalid plugin: %v", err)
+	}
+	if r, ok := pm.Get("portableTest"); !ok || r["status"] != "running" || r["version"] != "1.0.0" {
+		t.Errorf("describe mismatch, got %v", r)
+	}
+
+	store, err := states.CreateStore("rule1", api.AtMostOnce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := contexts.Background().WithMeta("rule1", "op1", store).WithCancel()
+	defer cancel()
+	fctx := contexts.NewDefaultFuncContext(ctx, 1)
+
+	// Functions
+	f, err := pm.Function("echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Validate([]interface{}{&xsql.FieldRef{Name: "a"}}); err != nil {
+		t.Errorf("validate error: %v", err)
+	}
+	if err := f.Validate([]interface{}{&xsql.StringLiteral{Val: "a"}}); common.Errstring(err) != "the parameter of echo function must be a field" {
+		t.Errorf("validate error mismatch, got %v", err)
+	}
+	for i, arg := range []interface{}{1, 2.5, map[string]interface{}{"a": "b", "c": []interface{}{1, true}}} {
+		r, ok := f.Exec([]interface{}{arg}, fctx)
+		if exp := []interface{}{arg, i + 1}; !ok || !reflect.DeepEqual(exp, r) {
+			t.Errorf("echo result mismatch:\n  exp=%v\n  got=%v", exp, r)
+		}
+	}
+	f, _ = pm.Function("total")
+	if !f.IsAggregate() {
+		t.Errorf("total should be an aggregate function")
+	}
+	if r, ok := f.Exec([]interface{}{[]interface{}{1, 2, 3}}, fctx); !ok || r != 6 {
+		t.Errorf("total result mismatch, got %v", r)
+	}
+
+	// Source
+	s, ok := pm.Source("counter")
+	if !ok {
+		t.Fatal("source counter not found")
+	}
+	s.Configure("", map[string]interface{}{"max": 3})
+	consumer := make(chan api.SourceTuple)
+	errCh := make(chan error)
+	go s.Open(ctx, consumer, errCh)
+	for i := 1; i <= 3; i++ {
+		select {
+		case tuple := <-consumer:
+			if !reflect.DeepEqual(map[string]interface{}{"count": i}, tuple.Message()) || !reflect.DeepEqual(map[string]interface{}{"rule": "rule1"}, tuple.Meta()) {
+				t.Errorf("source tuple mismatch, got %v %v", tuple.Message(), tuple.Meta())
+			}
+		case err := <-errCh:
+			t.Fatalf("source error: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("source timeout")
+		}
+	}
+	if err := s.Close(ctx); err != nil {
+		t.Errorf("close source error: %v", err)
+	}
+
+	// Sink
+	sink, ok := pm.Sink("collector")
+	if !ok {
+		t.Fatal("sink collector not found")
+	}
+	sink.Configure(map[string]interface{}{})
+	if err := sink.Open(ctx); err != nil {
+		t.Fatalf("open sink error: %v", err)
+	}
+	if err := sink.Collect(ctx, []byte(`[{"a":1}]`)); err != nil {
+		t.Errorf("collect error: %v", err)
+	}
+	f, _ = pm.Function("collected")
+	if r, _ := f.Exec(nil, fctx); !reflect.DeepEqual([]interface{}{`[{"a":1}]`}, r) {
+		t.Errorf("collected mismatch, got %v", r)
+	}
+
+	// Restart after crash
+	f, _ = pm.Function("crash")
+	if _, ok := f.Exec(nil, fctx); ok {
+		t.Errorf("crash should fail")
+	}
+	f, _ = pm.Function("collected")
+	restarted := false
+	for i := 0; i < 50; i++ {
+		if r, ok := f.Exec(nil, fctx); ok {
+			// The sink is opened again in the new process, but the collected data are lost
+			if r != nil {
+				t.Errorf("collected should be empty after restart, got %v", r)
+			}
+			restarted = true
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !restarted {
+		t.Fatalf("plugin is not restarted")
+	}
+	if err := sink.Collect(ctx, []byte(`[{"a":2}]`)); err != nil {
+		t.Errorf("collect after restart error: %v", err)
+	}
+	if err := sink.Close(ctx); err != nil {
+		t.Errorf("close sink error: %v", err)
+	}
+
+	// Delete
+	if err := pm.Delete("portableTest"); err != nil {
+		t.Errorf("delete error: %v", err)
+	}
+	if pm.HasFunction("echo") {
+		t.Errorf("function echo still exists after deleted")
+	}
+	if _, ok := pm.Get("portableTest"); ok {
+		t.Errorf("plugin still exists after deleted")
+	}
+}
@@ -131,3 +131,31 @@ func getFunctionsFromNative(name string) (api.Function, bool) {
 		return nil, false
 	}
 }
+
+// HasNativeSymbol reports whether the source, sink or function is provided by a native plugin
+func HasNativeSymbol(t PluginType, name string) bool {
+	var ok bool
+	regLock.RLock()
+	switch t {
+	case SOURCE:
+		_, ok = registeredSources[name]
+	case SINK:
+		_, ok = registeredSinks[name]
+	case FUNCTION:
+		_, ok = registeredFunctions[name]
+	}
+	regLock.RUnlock()
+	if ok {
+		return true
+	}
+	m, err := NewPluginManager()
+	if err != nil {
+		return false
+	}
+	if t == FUNCTION {
+		_, ok = m.GetSymbol(name)
+	} else {
+		_, ok = m.registry.Get(t, name)
+	}
+	return ok
+}
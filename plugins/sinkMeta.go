@@ -337,6 +337,8 @@ func (us *uiSinks) modifyOption(option *api.RuleOption) {
 			baseOption.Fields[i].Default = option.IsEventTime
 		case `lateTol`:
 			baseOption.Fields[i].Default = option.LateTol
+		case `allowedLateness`:
+			baseOption.Fields[i].Default = option.AllowedLateness
 		case `concurrency`:
 			baseOption.Fields[i].Default = option.Concurrency
 		case `bufferLength`:
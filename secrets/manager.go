@@ -0,0 +1,360 @@
+// Package secrets keeps the credentials used by the sources, sinks and services. The secrets are encrypted by the key
+// in a local key file and saved in the kv store. The properties refer to a secret by `$secret:name` as the whole value
+// or by `{{secret "name"}}` inside a string, and the references are resolved right before the properties are passed
+// to Configure. So the secret values never appear in the saved rules, the configuration files or the describe outputs.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/common/kv"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	keyFileName = "secret.key"
+	// The value shown in the describe outputs
+	Redacted = "******"
+)
+
+var (
+	mutex     sync.Mutex
+	singleton *Manager //Do not call this directly, use GetManager
+
+	nameRegex = regexp.MustCompile(`^[A-Za-z0-9_\-.]+$`)
+	// The reference inside a string like `password is {{secret "pwd"}}`
+	templateRegex = regexp.MustCompile(`{{\s*secret\s+"([^"]*)"\s*}}`)
+)
+
+const refPrefix = "$secret:"
+
+// SecretCreationRequest is the payload to create or update a secret by the REST API and the CLI
+type SecretCreationRequest struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Manager saves the encrypted secrets in the kv store
+type Manager struct {
+	sync.RWMutex
+	db   kv.KeyValue
+	aead cipher.AEAD
+}
+
+func GetManager() (*Manager, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if singleton == nil {
+		dbDir, err := common.GetDataLoc()
+		if err != nil {
+			return nil, fmt.Errorf("cannot find db folder: %s", err)
+		}
+		keyFile := path.Join(dbDir, keyFileName)
+		if common.Config != nil && common.Config.Basic.SecretKeyFile != "" {
+			keyFile = common.Config.Basic.SecretKeyFile
+		}
+		key, err := loadKey(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret key: %v", err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret key: %v", err)
+		}
+		db := kv.GetDefaultKVStore(path.Join(dbDir, "secrets"))
+		err = db.Open()
+		if err != nil {
+			return nil, fmt.Errorf("cannot open secret db: %s", err)
+		}
+		singleton = &Manager{
+			db:   db,
+			aead: aead,
+		}
+	}
+	return singleton, nil
+}
+
+// loadKey reads the base64 encoded AES-256 key from the key file. A new key is generated if the file does not exist.
+func loadKey(keyFile string) ([]byte, error) {
+	b, err := ioutil.ReadFile(keyFile)
+	if os.IsNotExist(err) {
+		key := make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, fmt.Errorf("cannot generate secret key: %v", err)
+		}
+		common.Log.Infof("create secret key file %s", keyFile)
+		if err := ioutil.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(key)), 0600); err != nil {
+			return nil, fmt.Errorf("cannot write secret key file: %v", err)
+		}
+		return key, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot read secret key file: %v", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key file %s: %v", keyFile, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid secret key file %s: the key must be 32 bytes but got %d", keyFile, len(key))
+	}
+	return key, nil
+}
+
+func validateName(name string) error {
+	if !nameRegex.MatchString(name) {
+		return fmt.Errorf("invalid secret name %s, only letters, digits, '_', '-' and '.' are allowed", name)
+	}
+	return nil
+}
+
+// The name is the additional data so that an encrypted value cannot be moved to another secret
+func (m *Manager) encrypt(name string, value string) ([]byte, error) {
+	nonce := make([]byte, m.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return m.aead.Seal(nonce, nonce, []byte(value), []byte(name)), nil
+}
+
+func (m *Manager) decrypt(name string, data []byte) (string, error) {
+	ns := m.aead.NonceSize()
+	if len(data) < ns {
+		return "", fmt.Errorf("fail to decrypt secret %s: invalid data", name)
+	}
+	b, err := m.aead.Open(nil, data[:ns], data[ns:], []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("fail to decrypt secret %s, the key may be changed", name)
+	}
+	return string(b), nil
+}
+
+func (m *Manager) Create(name string, value string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	b, err := m.encrypt(name, value)
+	if err != nil {
+		return fmt.Errorf("fail to encrypt secret %s: %v", name, err)
+	}
+	m.Lock()
+	defer m.Unlock()
+	if err := m.db.Setnx(name, b); err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			return fmt.Errorf("secret %s already exists", name)
+		}
+		return err
+	}
+	return nil
+}
+
+// Update replaces the value of an existing secret. The rules take the new value when they are restarted.
+func (m *Manager) Update(name string, value string) error {
+	b, err := m.encrypt(name, value)
+	if err != nil {
+		return fmt.Errorf("fail to encrypt secret %s: %v", name, err)
+	}
+	m.Lock()
+	defer m.Unlock()
+	var old []byte
+	if ok, _ := m.db.Get(name, &old); !ok {
+		return common.NewErrorWithCode(common.NOT_FOUND, fmt.Sprintf("secret %s is not found", name))
+	}
+	return m.db.Set(name, b)
+}
+
+func (m *Manager) Delete(name string) error {
+	m.Lock()
+	defer m.Unlock()
+	var old []byte
+	if ok, _ := m.db.Get(name, &old); !ok {
+		return common.NewErrorWithCode(common.NOT_FOUND, fmt.Sprintf("secret %s is not found", name))
+	}
+	return m.db.Delete(name)
+}
+
+// List returns the names of the secrets. The values are never returned by the manager APIs.
+func (m *Manager) List() ([]string, error) {
+	m.RLock()
+	defer m.RUnlock()
+	keys, err := m.db.Keys()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Describe returns the secret with the redacted value
+func (m *Manager) Describe(name string) (map[string]string, error) {
+	m.RLock()
+	defer m.RUnlock()
+	var b []byte
+	if ok, _ := m.db.Get(name, &b); !ok {
+		return nil, common.NewErrorWithCode(common.NOT_FOUND, fmt.Sprintf("secret %s is not found", name))
+	}
+	return map[string]string{"name": name, "value": Redacted}, nil
+}
+
+func (m *Manager) get(name string) (string, error) {
+	m.RLock()
+	defer m.RUnlock()
+	var b []byte
+	ok, err := m.db.Get(name, &b)
+	if err != nil {
+		return "", fmt.Errorf("fail to read secret %s: %v", name, err)
+	}
+	if !ok {
+		return "", fmt.Errorf("secret %s is not found", name)
+	}
+	return m.decrypt(name, b)
+}
+
+// The secrets are only resolved in the credential properties whose names contain one of the keywords, and in all the
+// values nested in them such as the headers. The references in the other properties such as the data template, the
+// topics or the urls are kept as is, so that the secrets cannot be sent out in the data.
+var credentialKeywords = []string{"password", "passwd", "username", "token", "secret", "credential", "apikey", "auth", "headers"}
+
+func isCredential(key string) bool {
+	lk := strings.ToLower(key)
+	for _, k := range credentialKeywords {
+		if strings.Contains(lk, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns a copy of the properties whose secret references in the credential properties are replaced by the
+// values. The properties are returned directly if there is no reference to resolve.
+func Resolve(props map[string]interface{}) (map[string]interface{}, error) {
+	if !hasRef(props, false) {
+		return props, nil
+	}
+	m, err := GetManager()
+	if err != nil {
+		return nil, err
+	}
+	r, err := m.resolve(props, false)
+	if err != nil {
+		return nil, err
+	}
+	return r.(map[string]interface{}), nil
+}
+
+func hasRef(v interface{}, cred bool) bool {
+	switch t := v.(type) {
+	case string:
+		return cred && (strings.HasPrefix(t, refPrefix) || templateRegex.MatchString(t))
+	case map[string]interface{}:
+		for k, e := range t {
+			if hasRef(e, cred || isCredential(k)) {
+				return true
+			}
+		}
+	case map[interface{}]interface{}:
+		for k, e := range t {
+			if hasRef(e, cred || isCredential(fmt.Sprint(k))) {
+				return true
+			}
+		}
+	case map[string]string:
+		for k, e := range t {
+			if hasRef(e, cred || isCredential(k)) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, e := range t {
+			if hasRef(e, cred) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m *Manager) resolve(v interface{}, cred bool) (interface{}, error) {
+	switch t := v.(type) {
+	case string:
+		if !cred {
+			return t, nil
+		}
+		return m.resolveString(t)
+	case map[string]interface{}:
+		r := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			re, err := m.resolve(e, cred || isCredential(k))
+			if err != nil {
+				return nil, err
+			}
+			r[k] = re
+		}
+		return r, nil
+	case map[interface{}]interface{}:
+		r := make(map[interface{}]interface{}, len(t))
+		for k, e := range t {
+			re, err := m.resolve(e, cred || isCredential(fmt.Sprint(k)))
+			if err != nil {
+				return nil, err
+			}
+			r[k] = re
+		}
+		return r, nil
+	case map[string]string:
+		r := make(map[string]string, len(t))
+		for k, e := range t {
+			re, err := m.resolve(e, cred || isCredential(k))
+			if err != nil {
+				return nil, err
+			}
+			r[k] = re.(string)
+		}
+		return r, nil
+	case []interface{}:
+		r := make([]interface{}, len(t))
+		for i, e := range t {
+			re, err := m.resolve(e, cred)
+			if err != nil {
+				return nil, err
+			}
+			r[i] = re
+		}
+		return r, nil
+	default:
+		return v, nil
+	}
+}
+
+func (m *Manager) resolveString(s string) (string, error) {
+	if strings.HasPrefix(s, refPrefix) {
+		return m.get(strings.TrimPrefix(s, refPrefix))
+	}
+	var err error
+	r := templateRegex.ReplaceAllStringFunc(s, func(ref string) string {
+		if err != nil {
+			return ""
+		}
+		var v string
+		v, err = m.get(templateRegex.FindStringSubmatch(ref)[1])
+		return v
+	})
+	if err != nil {
+		return "", err
+	}
+	return r, nil
+}
@@ -0,0 +1,149 @@
+package secrets
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestManager(t *testing.T) {
+	m, err := GetManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Delete("testPwd")
+	var tests = []struct {
+		name  string
+		value string
+		err   string
+	}{
+		{
+			name:  "testPwd",
+			value: "p@ss",
+		}, {
+			name:  "testPwd",
+			value: "other",
+			err:   "secret testPwd already exists",
+		}, {
+			name:  "bad name",
+			value: "v",
+			err:   "invalid secret name bad name, only letters, digits, '_', '-' and '.' are allowed",
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		err := m.Create(tt.name, tt.value)
+		if !reflect.DeepEqual(tt.err, common.Errstring(err)) {
+			t.Errorf("%d. %s: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.name, tt.err, err)
+		}
+	}
+
+	// The value is encrypted in the kv store
+	var raw []byte
+	if ok, err := m.db.Get("testPwd", &raw); !ok || err != nil {
+		t.Fatalf("secret is not saved: %v", err)
+	}
+	if strings.Contains(string(raw), "p@ss") {
+		t.Errorf("secret is saved in plain text")
+	}
+	if v, err := m.get("testPwd"); err != nil || v != "p@ss" {
+		t.Errorf("get secret mismatch, got %s %v", v, err)
+	}
+	if r, err := m.Describe("testPwd"); err != nil || !reflect.DeepEqual(map[string]string{"name": "testPwd", "value": Redacted}, r) {
+		t.Errorf("describe secret mismatch, got %v %v", r, err)
+	}
+	if l, err := m.List(); err != nil || !reflect.DeepEqual([]string{"testPwd"}, l) {
+		t.Errorf("list secrets mismatch, got %v %v", l, err)
+	}
+	if err := m.Update("testPwd", "new"); err != nil {
+		t.Errorf("update secret error: %v", err)
+	}
+	if v, _ := m.get("testPwd"); v != "new" {
+		t.Errorf("updated secret mismatch, got %s", v)
+	}
+	if err := m.Update("testUnknown", "new"); common.Errstring(err) != "secret testUnknown is not found" {
+		t.Errorf("update unknown secret error mismatch, got %v", err)
+	}
+	// The encrypted value cannot be used by another secret
+	if _, err := m.decrypt("testOther", raw); common.Errstring(err) != "fail to decrypt secret testOther, the key may be changed" {
+		t.Errorf("decrypt with another name error mismatch, got %v", err)
+	}
+	if err := m.Delete("testPwd"); err != nil {
+		t.Errorf("delete secret error: %v", err)
+	}
+	if err := m.Delete("testPwd"); common.Errstring(err) != "secret testPwd is not found" {
+		t.Errorf("delete unknown secret error mismatch, got %v", err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	m, err := GetManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Create("testUser", "admin")
+	m.Create("testToken", "abc123")
+	defer m.Delete("testUser")
+	defer m.Delete("testToken")
+	var tests = []struct {
+		props  map[string]interface{}
+		result map[string]interface{}
+		err    string
+	}{
+		{
+			props:  map[string]interface{}{"server": "tcp://127.0.0.1:1883", "qos": 1},
+			result: map[string]interface{}{"server": "tcp://127.0.0.1:1883", "qos": 1},
+		}, {
+			props:  map[string]interface{}{"username": "$secret:testUser", "password": "{{secret \"testToken\"}}"},
+			result: map[string]interface{}{"username": "admin", "password": "abc123"},
+		}, {
+			props: map[string]interface{}{
+				"headers": map[string]interface{}{"Authorization": "Bearer {{ secret \"testToken\" }}"},
+				"tokens":  []interface{}{"{{secret \"testUser\"}}:{{secret \"testToken\"}}", 1},
+				"yaml":    map[interface{}]interface{}{"token": "$secret:testToken"},
+			},
+			result: map[string]interface{}{
+				"headers": map[string]interface{}{"Authorization": "Bearer abc123"},
+				"tokens":  []interface{}{"admin:abc123", 1},
+				"yaml":    map[interface{}]interface{}{"token": "abc123"},
+			},
+		}, {
+			props: map[string]interface{}{"password": "$secret:testUnknown"},
+			err:   "secret testUnknown is not found",
+		}, {
+			// The secrets are not resolved in the properties which are not credentials
+			props: map[string]interface{}{
+				"dataTemplate": "{{.temperature}} {{secret \"testToken\"}}",
+				"topic":        "$secret:testToken",
+				"url":          "http://{{secret \"testUser\"}}@host",
+				"password":     "$secret:testToken",
+			},
+			result: map[string]interface{}{
+				"dataTemplate": "{{.temperature}} {{secret \"testToken\"}}",
+				"topic":        "$secret:testToken",
+				"url":          "http://{{secret \"testUser\"}}@host",
+				"password":     "abc123",
+			},
+		}, {
+			props:  map[string]interface{}{"dataTemplate": "{{secret \"testUnknown\"}}"},
+			result: map[string]interface{}{"dataTemplate": "{{secret \"testUnknown\"}}"},
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		r, err := Resolve(tt.props)
+		if !reflect.DeepEqual(tt.err, common.Errstring(err)) {
+			t.Errorf("%d: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.err, err)
+		} else if !reflect.DeepEqual(tt.result, r) {
+			t.Errorf("%d: result mismatch:\n  exp=%v\n  got=%v\n\n", i, tt.result, r)
+		}
+	}
+	// The original properties are not changed
+	props := map[string]interface{}{"password": "$secret:testToken"}
+	Resolve(props)
+	if props["password"] != "$secret:testToken" {
+		t.Errorf("the original properties are changed: %v", props)
+	}
+}
@@ -0,0 +1,588 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"io/ioutil"
+	"math"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// The avro codec encodes and decodes the avro binary datum of a record without the object container header. The schemaId
+// is the name of the schema file in the same schema folder of the external services, like
+// `etc/services/schemas/$schemaId.avsc`. The int and long values are decoded as int64, the float and double values as
+// float64, the bytes and fixed values as []byte and the enum values as string. The union values are decoded as the value
+// of the branch; when encoding, the first branch which accepts the value is used.
+type avroCodec struct {
+	schema *avroSchema
+}
+
+type avroSchema struct {
+	Type string
+	// The full name of the record, enum and fixed types
+	Name     string
+	Fields   []*avroField
+	Symbols  []string
+	Items    *avroSchema
+	Values   *avroSchema
+	Size     int
+	Branches []*avroSchema
+}
+
+type avroField struct {
+	Name       string
+	Schema     *avroSchema
+	Default    interface{}
+	HasDefault bool
+}
+
+var avroPrimitives = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true, "float": true, "double": true, "bytes": true, "string": true,
+}
+
+func newAvroCodec(conf *common.CodecConf) (common.MessageCodec, error) {
+	if conf.SchemaId == "" {
+		return nil, fmt.Errorf("schemaId is required for avro format")
+	}
+	if strings.ContainsAny(conf.SchemaId, `/\`) || strings.Contains(conf.SchemaId, "..") {
+		return nil, fmt.Errorf("invalid schemaId %s for avro format, must be the name of the schema file", conf.SchemaId)
+	}
+	dir := "etc/services/schemas/"
+	if common.IsTesting {
+		dir = "services/test/schemas/"
+	}
+	schemaDir, err := common.GetLoc(dir)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(path.Join(schemaDir, conf.SchemaId+".avsc"))
+	if err != nil {
+		return nil, fmt.Errorf("fail to read schema file %s.avsc: %v", conf.SchemaId, err)
+	}
+	s, err := parseAvroSchema(content)
+	if err != nil {
+		return nil, fmt.Errorf("fail to parse schema file %s.avsc: %v", conf.SchemaId, err)
+	}
+	if s.Type != "record" {
+		return nil, fmt.Errorf("the schema of avro format must be a record but got %s", s.Type)
+	}
+	return &avroCodec{schema: s}, nil
+}
+
+func (c *avroCodec) Decode(payload []byte) (map[string]interface{}, error) {
+	r := &avroReader{buf: payload}
+	v, err := r.read(c.schema)
+	if err != nil {
+		return nil, fmt.Errorf("fail to decode avro record %s: %v", c.schema.Name, err)
+	}
+	if n := len(payload) - r.pos; n > 0 {
+		return nil, fmt.Errorf("fail to decode avro record %s: %d bytes left", c.schema.Name, n)
+	}
+	return v.(map[string]interface{}), nil
+}
+
+func (c *avroCodec) Encode(data interface{}) ([]byte, error) {
+	switch dt := data.(type) {
+	case []map[string]interface{}:
+		if len(dt) != 1 {
+			return nil, fmt.Errorf("avro format can only encode a single message, set sendSingle to true")
+		}
+		data = dt[0]
+	case map[string]interface{}:
+	default:
+		return nil, fmt.Errorf("avro format cannot encode %T", data)
+	}
+	var buf bytes.Buffer
+	if err := writeAvro(&buf, c.schema, data); err != nil {
+		return nil, fmt.Errorf("fail to encode avro record %s: %v", c.schema.Name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+func parseAvroSchema(content []byte) (*avroSchema, error) {
+	var v interface{}
+	if err := json.Unmarshal(content, &v); err != nil {
+		return nil, err
+	}
+	p := &avroSchemaParser{named: make(map[string]*avroSchema)}
+	return p.parse(v, "")
+}
+
+// The parser keeps the named types so that they can be referred by name later, including the recursive references
+type avroSchemaParser struct {
+	named map[string]*avroSchema
+}
+
+func (p *avroSchemaParser) parse(v interface{}, namespace string) (*avroSchema, error) {
+	switch t := v.(type) {
+	case string:
+		if avroPrimitives[t] {
+			return &avroSchema{Type: t}, nil
+		}
+		if s, ok := p.named[t]; ok {
+			return s, nil
+		}
+		if s, ok := p.named[namespace+"."+t]; ok && namespace != "" {
+			return s, nil
+		}
+		return nil, fmt.Errorf("unknown type %s", t)
+	case []interface{}:
+		s := &avroSchema{Type: "union"}
+		for _, b := range t {
+			bs, err := p.parse(b, namespace)
+			if err != nil {
+				return nil, err
+			}
+			if bs.Type == "union" {
+				return nil, fmt.Errorf("union cannot contain union directly")
+			}
+			s.Branches = append(s.Branches, bs)
+		}
+		return s, nil
+	case map[string]interface{}:
+		typ, ok := t["type"].(string)
+		if !ok {
+			if t["type"] == nil {
+				return nil, fmt.Errorf("type is required")
+			}
+			return p.parse(t["type"], namespace)
+		}
+		switch typ {
+		case "record", "error", "enum", "fixed":
+			return p.parseNamed(typ, t, namespace)
+		case "array":
+			items, err := p.parse(t["items"], namespace)
+			if err != nil {
+				return nil, err
+			}
+			return &avroSchema{Type: typ, Items: items}, nil
+		case "map":
+			values, err := p.parse(t["values"], namespace)
+			if err != nil {
+				return nil, err
+			}
+			return &avroSchema{Type: typ, Values: values}, nil
+		default:
+			// The primitive or named type with attributes like the logical type
+			return p.parse(typ, namespace)
+		}
+	}
+	return nil, fmt.Errorf("invalid schema %v", v)
+}
+
+func (p *avroSchemaParser) parseNamed(typ string, t map[string]interface{}, namespace string) (*avroSchema, error) {
+	name, ok := t["name"].(string)
+	if !ok || name == "" {
+		return nil, fmt.Errorf("name is required for %s", typ)
+	}
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		namespace = name[:i]
+	} else {
+		if ns, ok := t["namespace"].(string); ok {
+			namespace = ns
+		}
+		if namespace != "" {
+			name = namespace + "." + name
+		}
+	}
+	if _, ok := p.named[name]; ok {
+		return nil, fmt.Errorf("type %s is defined more than once", name)
+	}
+	s := &avroSchema{Type: typ, Name: name}
+	p.named[name] = s
+	switch typ {
+	case "record", "error":
+		s.Type = "record"
+		fields, ok := t["fields"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("fields are required for record %s", name)
+		}
+		for _, f := range fields {
+			fm, ok := f.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid field %v of record %s", f, name)
+			}
+			fn, ok := fm["name"].(string)
+			if !ok || fn == "" {
+				return nil, fmt.Errorf("field name is required for record %s", name)
+			}
+			fs, err := p.parse(fm["type"], namespace)
+			if err != nil {
+				return nil, fmt.Errorf("invalid field %s of record %s: %v", fn, name, err)
+			}
+			field := &avroField{Name: fn, Schema: fs}
+			field.Default, field.HasDefault = fm["default"]
+			s.Fields = append(s.Fields, field)
+		}
+	case "enum":
+		symbols, ok := t["symbols"].([]interface{})
+		if !ok || len(symbols) == 0 {
+			return nil, fmt.Errorf("symbols are required for enum %s", name)
+		}
+		for _, sym := range symbols {
+			ss, ok := sym.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid symbol %v of enum %s", sym, name)
+			}
+			s.Symbols = append(s.Symbols, ss)
+		}
+	case "fixed":
+		size, ok := t["size"].(float64)
+		if !ok || size < 0 || size != math.Trunc(size) {
+			return nil, fmt.Errorf("invalid size %v of fixed %s", t["size"], name)
+		}
+		s.Size = int(size)
+	}
+	return s, nil
+}
+
+type avroReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *avroReader) readLong() (int64, error) {
+	var (
+		v     uint64
+		shift uint
+	)
+	for {
+		if r.pos >= len(r.buf) {
+			return 0, fmt.Errorf("unexpected end of payload")
+		}
+		b := r.buf[r.pos]
+		r.pos++
+		v |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		shift += 7
+		if shift > 63 {
+			return 0, fmt.Errorf("invalid variable length integer")
+		}
+	}
+	// Zigzag decoding
+	return int64(v>>1) ^ -int64(v&1), nil
+}
+
+func (r *avroReader) readBytes(n int) ([]byte, error) {
+	if n < 0 || n > len(r.buf)-r.pos {
+		return nil, fmt.Errorf("invalid length %d", n)
+	}
+	b := make([]byte, n)
+	copy(b, r.buf[r.pos:r.pos+n])
+	r.pos += n
+	return b, nil
+}
+
+// Read the item count of the next block of the array or map. The block with a negative count has its size in bytes
+func (r *avroReader) readBlockCount() (int64, error) {
+	n, err := r.readLong()
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		if _, err := r.readLong(); err != nil {
+			return 0, err
+		}
+		n = -n
+	}
+	return n, nil
+}
+
+func (r *avroReader) read(s *avroSchema) (interface{}, error) {
+	switch s.Type {
+	case "null":
+		return nil, nil
+	case "boolean":
+		b, err := r.readBytes(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0] != 0, nil
+	case "int", "long":
+		return r.readLong()
+	case "float":
+		b, err := r.readBytes(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), nil
+	case "double":
+		b, err := r.readBytes(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	case "bytes", "string":
+		n, err := r.readLong()
+		if err != nil {
+			return nil, err
+		}
+		b, err := r.readBytes(int(n))
+		if err != nil {
+			return nil, err
+		}
+		if s.Type == "string" {
+			return string(b), nil
+		}
+		return b, nil
+	case "fixed":
+		return r.readBytes(s.Size)
+	case "enum":
+		i, err := r.readLong()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || i >= int64(len(s.Symbols)) {
+			return nil, fmt.Errorf("invalid index %d of enum %s", i, s.Name)
+		}
+		return s.Symbols[i], nil
+	case "record":
+		m := make(map[string]interface{}, len(s.Fields))
+		for _, f := range s.Fields {
+			v, err := r.read(f.Schema)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %v", f.Name, err)
+			}
+			m[f.Name] = v
+		}
+		return m, nil
+	case "array":
+		a := make([]interface{}, 0)
+		for {
+			n, err := r.readBlockCount()
+			if err != nil {
+				return nil, err
+			}
+			if n == 0 {
+				return a, nil
+			}
+			for ; n > 0; n-- {
+				v, err := r.read(s.Items)
+				if err != nil {
+					return nil, err
+				}
+				a = append(a, v)
+			}
+		}
+	case "map":
+		m := make(map[string]interface{})
+		for {
+			n, err := r.readBlockCount()
+			if err != nil {
+				return nil, err
+			}
+			if n == 0 {
+				return m, nil
+			}
+			for ; n > 0; n-- {
+				k, err := r.read(&avroSchema{Type: "string"})
+				if err != nil {
+					return nil, err
+				}
+				v, err := r.read(s.Values)
+				if err != nil {
+					return nil, err
+				}
+				m[k.(string)] = v
+			}
+		}
+	case "union":
+		i, err := r.readLong()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || i >= int64(len(s.Branches)) {
+			return nil, fmt.Errorf("invalid union branch %d", i)
+		}
+		return r.read(s.Branches[i])
+	}
+	return nil, fmt.Errorf("unsupported type %s", s.Type)
+}
+
+func writeLong(buf *bytes.Buffer, v int64) {
+	// Zigzag encoding
+	u := uint64((v << 1) ^ (v >> 63))
+	for u >= 0x80 {
+		buf.WriteByte(byte(u) | 0x80)
+		u >>= 7
+	}
+	buf.WriteByte(byte(u))
+}
+
+func writeAvro(buf *bytes.Buffer, s *avroSchema, v interface{}) error {
+	switch s.Type {
+	case "null":
+		if v != nil {
+			return fmt.Errorf("expect null but got %v", v)
+		}
+	case "boolean":
+		b, err := common.ToBool(v, common.STRICT)
+		if err != nil {
+			return err
+		}
+		if b {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case "int", "long":
+		i, err := common.ToInt64(v, common.STRICT)
+		if err != nil {
+			return err
+		}
+		if s.Type == "int" && (i < math.MinInt32 || i > math.MaxInt32) {
+			return fmt.Errorf("value %d overflows int", i)
+		}
+		writeLong(buf, i)
+	case "float":
+		f, err := common.ToFloat64(v, common.CONVERT_SAMEKIND)
+		if err != nil {
+			return err
+		}
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], math.Float32bits(float32(f)))
+		buf.Write(b[:])
+	case "double":
+		f, err := common.ToFloat64(v, common.CONVERT_SAMEKIND)
+		if err != nil {
+			return err
+		}
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(f))
+		buf.Write(b[:])
+	case "bytes", "fixed":
+		b, err := toAvroBytes(v)
+		if err != nil {
+			return err
+		}
+		if s.Type == "fixed" {
+			if len(b) != s.Size {
+				return fmt.Errorf("expect %d bytes for fixed %s but got %d", s.Size, s.Name, len(b))
+			}
+		} else {
+			writeLong(buf, int64(len(b)))
+		}
+		buf.Write(b)
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("expect string but got %[1]T(%[1]v)", v)
+		}
+		writeLong(buf, int64(len(str)))
+		buf.WriteString(str)
+	case "enum":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("expect string for enum %s but got %[2]T(%[2]v)", s.Name, v)
+		}
+		for i, sym := range s.Symbols {
+			if sym == str {
+				writeLong(buf, int64(i))
+				return nil
+			}
+		}
+		return fmt.Errorf("%s is not a symbol of enum %s", str, s.Name)
+	case "record":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expect map for record %s but got %[2]T(%[2]v)", s.Name, v)
+		}
+		for _, f := range s.Fields {
+			fv, ok := m[f.Name]
+			if !ok {
+				if f.HasDefault {
+					fv = f.Default
+				} else if !isNullable(f.Schema) {
+					return fmt.Errorf("field %s is required", f.Name)
+				}
+			}
+			if err := writeAvro(buf, f.Schema, fv); err != nil {
+				return fmt.Errorf("field %s: %v", f.Name, err)
+			}
+		}
+	case "array":
+		if v == nil {
+			return fmt.Errorf("expect array but got nil")
+		}
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return fmt.Errorf("expect array but got %[1]T(%[1]v)", v)
+		}
+		if rv.Len() > 0 {
+			writeLong(buf, int64(rv.Len()))
+			for i := 0; i < rv.Len(); i++ {
+				if err := writeAvro(buf, s.Items, rv.Index(i).Interface()); err != nil {
+					return err
+				}
+			}
+		}
+		buf.WriteByte(0)
+	case "map":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expect map but got %[1]T(%[1]v)", v)
+		}
+		if len(m) > 0 {
+			// Sort the keys so that the same map is always encoded into the same bytes
+			keys := make([]string, 0, len(m))
+			for k := range m {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			writeLong(buf, int64(len(m)))
+			for _, k := range keys {
+				writeLong(buf, int64(len(k)))
+				buf.WriteString(k)
+				if err := writeAvro(buf, s.Values, m[k]); err != nil {
+					return err
+				}
+			}
+		}
+		buf.WriteByte(0)
+	case "union":
+		for i, b := range s.Branches {
+			var bb bytes.Buffer
+			if err := writeAvro(&bb, b, v); err == nil {
+				writeLong(buf, int64(i))
+				buf.Write(bb.Bytes())
+				return nil
+			}
+		}
+		return fmt.Errorf("no branch of the union accepts %[1]T(%[1]v)", v)
+	default:
+		return fmt.Errorf("unsupported type %s", s.Type)
+	}
+	return nil
+}
+
+func isNullable(s *avroSchema) bool {
+	if s.Type == "null" {
+		return true
+	}
+	for _, b := range s.Branches {
+		if b.Type == "null" {
+			return true
+		}
+	}
+	return false
+}
+
+// The bytea fields are base64 encoded in the json result like the binary format
+func toAvroBytes(v interface{}) ([]byte, error) {
+	switch b := v.(type) {
+	case []byte:
+		return b, nil
+	case string:
+		return base64.StdEncoding.DecodeString(b)
+	}
+	return nil, fmt.Errorf("expect bytes but got %[1]T(%[1]v)", v)
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/jhump/protoreflect/desc"
+	"strings"
+)
+
+func init() {
+	common.RegisterCodec(common.FORMAT_PROTOBUF, newProtobufCodec)
+	common.RegisterCodec(common.FORMAT_AVRO, newAvroCodec)
+}
+
+// The protobuf codec finds the message type by the schemaId in the format of `$fileName.$messageName`.
+// The schema file is located in the same schema folder of the external services, like `etc/services/schemas/$fileName.proto`
+type protobufCodec struct {
+	descriptor *wrappedProtoDescriptor
+	md         *desc.MessageDescriptor
+}
+
+func newProtobufCodec(conf *common.CodecConf) (common.MessageCodec, error) {
+	if conf.SchemaId == "" {
+		return nil, fmt.Errorf("schemaId is required for protobuf format")
+	}
+	parts := strings.SplitN(conf.SchemaId, ".", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid schemaId %s for protobuf format, must be in the format of $fileName.$messageName", conf.SchemaId)
+	}
+	d, err := parse(PROTOBUFF, parts[0]+".proto")
+	if err != nil {
+		return nil, fmt.Errorf("fail to parse schema file %s.proto: %v", parts[0], err)
+	}
+	pd, ok := d.(*wrappedProtoDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("invalid descriptor for schema %s", parts[0])
+	}
+	md := pd.FindMessage(parts[1])
+	if md == nil && pd.GetPackage() != "" {
+		md = pd.FindMessage(pd.GetPackage() + "." + parts[1])
+	}
+	if md == nil {
+		return nil, fmt.Errorf("message type %s not found in schema file %s.proto", parts[1], parts[0])
+	}
+	return &protobufCodec{descriptor: pd, md: md}, nil
+}
+
+func (c *protobufCodec) Decode(payload []byte) (map[string]interface{}, error) {
+	m := c.descriptor.MessageFactory().NewDynamicMessage(c.md)
+	if err := m.Unmarshal(payload); err != nil {
+		return nil, fmt.Errorf("fail to decode protobuf message %s: %v", c.md.GetName(), err)
+	}
+	if r, ok := decodeMessage(m, c.md).(map[string]interface{}); ok {
+		return r, nil
+	}
+	return nil, fmt.Errorf("message %s cannot be decoded as a map", c.md.GetName())
+}
+
+func (c *protobufCodec) Encode(data interface{}) ([]byte, error) {
+	switch dt := data.(type) {
+	case []map[string]interface{}:
+		if len(dt) != 1 {
+			return nil, fmt.Errorf("protobuf format can only encode a single message, set sendSingle to true")
+		}
+		data = dt[0]
+	case map[string]interface{}:
+	default:
+		return nil, fmt.Errorf("protobuf format cannot encode %T", data)
+	}
+	m, err := c.descriptor.encodeMap(c.md, data)
+	if err != nil {
+		return nil, fmt.Errorf("fail to encode protobuf message %s: %v", c.md.GetName(), err)
+	}
+	return m.Marshal()
+}
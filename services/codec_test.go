@@ -0,0 +1,192 @@
+package services
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"reflect"
+	"testing"
+)
+
+func TestProtobufCodec(t *testing.T) {
+	tests := []struct {
+		schemaId string
+		data     map[string]interface{}
+		result   map[string]interface{}
+		err      string
+	}{
+		{
+			schemaId: "hw.HelloRequest",
+			data:     map[string]interface{}{"name": "world"},
+			result:   map[string]interface{}{"name": "world"},
+		}, {
+			schemaId: "hw.helloworld.Response",
+			data:     map[string]interface{}{"code": 200.0, "msg": "ok"},
+			result:   map[string]interface{}{"code": int64(200), "msg": "ok"},
+		}, {
+			schemaId: "hw.Box",
+			data:     map[string]interface{}{"x": 1, "y": 2, "w": 3, "h": 4},
+			result:   map[string]interface{}{"x": int64(1), "y": int64(2), "w": int64(3), "h": int64(4)},
+		}, {
+			schemaId: "hw.NotExist",
+			err:      "message type NotExist not found in schema file hw.proto",
+		}, {
+			schemaId: "hw",
+			err:      "invalid schemaId hw for protobuf format, must be in the format of $fileName.$messageName",
+		}, {
+			schemaId: "",
+			err:      "schemaId is required for protobuf format",
+		},
+	}
+	for i, tt := range tests {
+		c, err := common.GetCodec(common.FORMAT_PROTOBUF, &common.CodecConf{SchemaId: tt.schemaId})
+		if err != nil {
+			if !reflect.DeepEqual(tt.err, common.Errstring(err)) {
+				t.Errorf("%d error mismatch:\n\nexp=%s\n\ngot=%s\n\n", i, tt.err, err)
+			}
+			continue
+		}
+		payload, err := c.Encode(tt.data)
+		if err != nil {
+			t.Errorf("%d encode error: %v", i, err)
+			continue
+		}
+		result, err := c.Decode(payload)
+		if err != nil {
+			t.Errorf("%d decode error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt.result, result) {
+			t.Errorf("%d result mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.result, result)
+		}
+	}
+}
+
+func TestAvroCodec(t *testing.T) {
+	tests := []struct {
+		schemaId string
+		data     map[string]interface{}
+		payload  []byte
+		result   map[string]interface{}
+		err      string
+	}{
+		{
+			schemaId: "point",
+			data:     map[string]interface{}{"x": 64.0, "y": -2, "label": "ab"},
+			payload:  []byte{0x80, 0x01, 0x03, 0x04, 'a', 'b'},
+			result:   map[string]interface{}{"x": int64(64), "y": int64(-2), "label": "ab"},
+		}, {
+			schemaId: "sensor",
+			data: map[string]interface{}{
+				"id":          1.0,
+				"name":        "sensor1",
+				"temperature": 23,
+				"ratio":       0.5,
+				"online":      true,
+				"tags":        []interface{}{"a", "b"},
+				"props":       map[string]interface{}{"x": 1, "y": 2.0},
+				"status":      "FAIL",
+				"location":    map[string]interface{}{"lat": 31.2, "lng": 121.5},
+				"reading":     2.5,
+				"checksum":    []byte{1, 2},
+				"raw":         "aGVsbG8=",
+			},
+			result: map[string]interface{}{
+				"id":          int64(1),
+				"name":        "sensor1",
+				"temperature": 23.0,
+				"ratio":       0.5,
+				"online":      true,
+				"tags":        []interface{}{"a", "b"},
+				"props":       map[string]interface{}{"x": int64(1), "y": int64(2)},
+				"status":      "FAIL",
+				"location":    map[string]interface{}{"lat": 31.2, "lng": 121.5},
+				"backup":      nil,
+				"reading":     2.5,
+				"checksum":    []byte{1, 2},
+				"raw":         []byte("hello"),
+				"count":       int64(0),
+			},
+		}, {
+			schemaId: "sensor",
+			data: map[string]interface{}{
+				"id":          2,
+				"name":        "sensor2",
+				"temperature": 20.5,
+				"ratio":       1,
+				"online":      false,
+				"tags":        []interface{}{},
+				"props":       map[string]interface{}{},
+				"status":      "OK",
+				"backup":      map[string]interface{}{"lat": 0, "lng": 0},
+				"reading":     3.0,
+				"checksum":    []byte{0, 0},
+				"raw":         []byte{},
+				"count":       5,
+			},
+			result: map[string]interface{}{
+				"id":          int64(2),
+				"name":        "sensor2",
+				"temperature": 20.5,
+				"ratio":       1.0,
+				"online":      false,
+				"tags":        []interface{}{},
+				"props":       map[string]interface{}{},
+				"status":      "OK",
+				"location":    nil,
+				"backup":      map[string]interface{}{"lat": 0.0, "lng": 0.0},
+				"reading":     int64(3),
+				"checksum":    []byte{0, 0},
+				"raw":         []byte{},
+				"count":       int64(5),
+			},
+		}, {
+			schemaId: "sensor",
+			data:     map[string]interface{}{"name": "sensor3"},
+			err:      "fail to encode avro record demo.Sensor: field id is required",
+		}, {
+			schemaId: "sensor",
+			data: map[string]interface{}{
+				"id": 1, "name": "sensor4", "temperature": 20, "ratio": 1, "online": true, "tags": []interface{}{},
+				"props": map[string]interface{}{}, "status": "UNKNOWN", "checksum": []byte{0, 0}, "raw": []byte{},
+			},
+			err: "fail to encode avro record demo.Sensor: field status: UNKNOWN is not a symbol of enum demo.Status",
+		}, {
+			schemaId: "point",
+			payload:  []byte{0x02, 0x03, 0x04, 'a'},
+			err:      "fail to decode avro record Point: field label: invalid length 2",
+		}, {
+			schemaId: "point",
+			payload:  []byte{0x02, 0x03, 0x00, 0x00},
+			err:      "fail to decode avro record Point: 1 bytes left",
+		}, {
+			schemaId: "../point",
+			err:      "invalid schemaId ../point for avro format, must be the name of the schema file",
+		}, {
+			schemaId: "",
+			err:      "schemaId is required for avro format",
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		c, err := common.GetCodec(common.FORMAT_AVRO, &common.CodecConf{SchemaId: tt.schemaId})
+		if err == nil && tt.data != nil {
+			var payload []byte
+			payload, err = c.Encode(tt.data)
+			if err == nil && tt.payload != nil && !reflect.DeepEqual(tt.payload, payload) {
+				t.Errorf("%d payload mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.payload, payload)
+			}
+			if err == nil {
+				tt.payload = payload
+			}
+		}
+		var result map[string]interface{}
+		if err == nil {
+			result, err = c.Decode(tt.payload)
+		}
+		if !reflect.DeepEqual(tt.err, common.Errstring(err)) {
+			t.Errorf("%d error mismatch:\n\nexp=%s\n\ngot=%s\n\n", i, tt.err, err)
+		} else if err == nil && !reflect.DeepEqual(tt.result, result) {
+			t.Errorf("%d result mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.result, result)
+		}
+	}
+}
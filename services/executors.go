@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/secrets"
 	"github.com/emqx/kuiper/xstream/api"
 	"github.com/golang/protobuf/proto"
 	"github.com/jhump/protoreflect/dynamic"
@@ -55,7 +56,11 @@ func NewExecutor(i *interfaceInfo) (executor, error) {
 			return nil, fmt.Errorf("invalid descriptor type for rest")
 		}
 		o := &restOption{}
-		e := common.MapToStruct(i.Options, o)
+		props, e := secrets.Resolve(i.Options)
+		if e != nil {
+			return nil, e
+		}
+		e = common.MapToStruct(props, o)
 		if e != nil {
 			return nil, fmt.Errorf("incorrect rest option: %v", e)
 		}
@@ -29,6 +29,8 @@ type Manager struct {
 	etcDir     string
 	serviceKV  kv.KeyValue
 	functionKV kv.KeyValue
+	// The file urls of the services created by the api
+	fileKV kv.KeyValue
 }
 
 func GetServiceManager() (*Manager, error) {
@@ -57,6 +59,11 @@ func GetServiceManager() (*Manager, error) {
 		if err != nil {
 			return nil, fmt.Errorf("cannot open function db: %s", err)
 		}
+		filedb := kv.GetDefaultKVStore(path.Join(dbDir, "serviceFiles"))
+		err = filedb.Open()
+		if err != nil {
+			return nil, fmt.Errorf("cannot open service file db: %s", err)
+		}
 		singleton = &Manager{
 			executorPool: &sync.Map{},
 			serviceBuf:   &sync.Map{},
@@ -65,6 +72,7 @@ func GetServiceManager() (*Manager, error) {
 			etcDir:     etcDir,
 			serviceKV:  sdb,
 			functionKV: fdb,
+			fileKV:     filedb,
 		}
 	}
 	if !singleton.loaded && !common.IsTesting { // To boost the testing perf
@@ -309,7 +317,13 @@ func (m *Manager) Create(r *ServiceCreationRequest) error {
 		return err
 	}
 	// init file to serviceKV
-	return m.initFile(name + ".json")
+	if err := m.initFile(name + ".json"); err != nil {
+		return err
+	}
+	if err := m.fileKV.Set(name, uri); err != nil {
+		common.Log.Errorf("fail to save the file url of service %s: %v", name, err)
+	}
+	return nil
 }
 
 func (m *Manager) Delete(name string) error {
@@ -319,6 +333,7 @@ func (m *Manager) Delete(name string) error {
 	}
 	m.deleteServiceFuncs(name)
 	m.serviceBuf.Delete(name)
+	m.fileKV.Delete(name)
 	err := m.serviceKV.Delete(name)
 	if err != nil {
 		return err
@@ -343,6 +358,14 @@ func (m *Manager) Get(name string) (*serviceInfo, error) {
 	return r, nil
 }
 
+// GetFile returns the file url which the service is created from. The services defined by the files in etc/services
+// do not have it.
+func (m *Manager) GetFile(name string) (string, bool) {
+	var uri string
+	ok, _ := m.fileKV.Get(name, &uri)
+	return uri, ok
+}
+
 func (m *Manager) Update(req *ServiceCreationRequest) error {
 	err := m.Delete(req.Name)
 	if err != nil {
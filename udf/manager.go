@@ -0,0 +1,193 @@
+package udf
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/common/kv"
+	"github.com/emqx/kuiper/xsql"
+	"github.com/emqx/kuiper/xstream/api"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	mutex     sync.Mutex
+	singleton *Manager //Do not call this directly, use GetManager
+)
+
+// Manager saves the user-defined functions in the kv store and provides them to the rules as a function register
+type Manager struct {
+	db kv.KeyValue
+	// The parsed function statements by the lowercase name
+	funcBuf *sync.Map
+}
+
+func GetManager() (*Manager, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if singleton == nil {
+		dbDir, err := common.GetDataLoc()
+		if err != nil {
+			return nil, fmt.Errorf("cannot find db folder: %s", err)
+		}
+		db := kv.GetDefaultKVStore(path.Join(dbDir, "udfs"))
+		err = db.Open()
+		if err != nil {
+			return nil, fmt.Errorf("cannot open function db: %s", err)
+		}
+		singleton = &Manager{
+			db:      db,
+			funcBuf: &sync.Map{},
+		}
+	}
+	return singleton, nil
+}
+
+// Create verifies the function body and saves the function
+func (m *Manager) Create(stmt *xsql.FunctionStmt, statement string) error {
+	for _, r := range xsql.FuncRegisters {
+		if r != xsql.FunctionRegister(m) && r.HasFunction(stmt.Name) {
+			return fmt.Errorf("function %s already exists", stmt.Name)
+		}
+	}
+	if err := m.checkCycle(stmt, []string{stmt.Name}, make(map[string]bool)); err != nil {
+		return err
+	}
+	if _, err := newFunction(stmt); err != nil {
+		return err
+	}
+	name := strings.ToLower(stmt.Name)
+	if err := m.db.Setnx(name, statement); err != nil {
+		return err
+	}
+	m.funcBuf.Store(name, stmt)
+	return nil
+}
+
+// checkCycle verifies that the sql function does not call the function being created through the stored functions.
+// The path is the function names from the created one to the current one.
+func (m *Manager) checkCycle(stmt *xsql.FunctionStmt, path []string, visited map[string]bool) error {
+	if stmt.Language == xsql.FUNC_LANG_STARLARK {
+		return nil
+	}
+	for _, c := range xsql.GetFunctionCalls(stmt.Body) {
+		if strings.EqualFold(c, path[0]) {
+			return fmt.Errorf("function %s calls itself by %s -> %s", path[0], strings.Join(path, " -> "), c)
+		}
+		name := strings.ToLower(c)
+		if visited[name] {
+			continue
+		}
+		visited[name] = true
+		callee, ok := m.getFunction(name)
+		if !ok {
+			continue
+		}
+		if err := m.checkCycle(callee, append(path, callee.Name), visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Manager) Drop(name string) error {
+	lowerName := strings.ToLower(name)
+	if _, ok := m.getFunction(lowerName); !ok {
+		return common.NewErrorWithCode(common.NOT_FOUND, fmt.Sprintf("function %s is not found", name))
+	}
+	if err := m.db.Delete(lowerName); err != nil {
+		return err
+	}
+	m.funcBuf.Delete(lowerName)
+	xsql.UnloadFunction(name)
+	return nil
+}
+
+func (m *Manager) List() ([]string, error) {
+	keys, err := m.db.Keys()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (m *Manager) Describe(name string) (*xsql.FunctionStmt, error) {
+	stmt, ok := m.getFunction(strings.ToLower(name))
+	if !ok {
+		return nil, common.NewErrorWithCode(common.NOT_FOUND, fmt.Sprintf("function %s is not found", name))
+	}
+	return stmt, nil
+}
+
+// GetStatement returns the create statement of the function
+func (m *Manager) GetStatement(name string) (string, error) {
+	var statement string
+	if ok, _ := m.db.Get(strings.ToLower(name), &statement); !ok {
+		return "", common.NewErrorWithCode(common.NOT_FOUND, fmt.Sprintf("function %s is not found", name))
+	}
+	return statement, nil
+}
+
+func (m *Manager) getFunction(name string) (*xsql.FunctionStmt, bool) {
+	if s, ok := m.funcBuf.Load(name); ok {
+		return s.(*xsql.FunctionStmt), true
+	}
+	var statement string
+	if ok, _ := m.db.Get(name, &statement); !ok {
+		return nil, false
+	}
+	s, err := xsql.NewParser(strings.NewReader(statement)).ParseCreateStmt()
+	if err != nil {
+		common.Log.Errorf("fail to parse the definition of function %s: %v", name, err)
+		return nil, false
+	}
+	stmt, ok := s.(*xsql.FunctionStmt)
+	if !ok {
+		common.Log.Errorf("the definition of function %s is not a function statement", name)
+		return nil, false
+	}
+	m.funcBuf.Store(name, stmt)
+	return stmt, true
+}
+
+// Start Implement FunctionRegister
+
+func (m *Manager) HasFunction(name string) bool {
+	_, ok := m.getFunction(strings.ToLower(name))
+	return ok
+}
+
+func (m *Manager) Function(name string) (api.Function, error) {
+	stmt, ok := m.getFunction(strings.ToLower(name))
+	if !ok {
+		return nil, fmt.Errorf("function %s not found", name)
+	}
+	return newFunction(stmt)
+}
+
+// End Implement FunctionRegister
+
+func newFunction(stmt *xsql.FunctionStmt) (api.Function, error) {
+	switch stmt.Language {
+	case xsql.FUNC_LANG_STARLARK:
+		return newStarlarkFunc(stmt)
+	default:
+		return xsql.NewSqlFunction(stmt)
+	}
+}
+
+// IsAggregate returns whether the function is an aggregate function. The type of a sql function may be inferred from
+// its body.
+func IsAggregate(stmt *xsql.FunctionStmt) (bool, error) {
+	if stmt.FuncType != "" {
+		return stmt.FuncType == xsql.FUNC_TYPE_AGGREGATE, nil
+	}
+	f, err := newFunction(stmt)
+	if err != nil {
+		return false, err
+	}
+	return f.IsAggregate(), nil
+}
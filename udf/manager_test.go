@@ -0,0 +1,207 @@
+package udf
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/xsql"
+	"github.com/emqx/kuiper/xstream/api"
+	"github.com/emqx/kuiper/xstream/contexts"
+	"github.com/emqx/kuiper/xstream/states"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var m *Manager
+
+func init() {
+	m, _ = GetManager()
+	xsql.InitFuncRegisters(m)
+}
+
+func createFunction(statement string) error {
+	stmt, err := xsql.NewParser(strings.NewReader(statement)).ParseCreateStmt()
+	if err != nil {
+		return err
+	}
+	return m.Create(stmt.(*xsql.FunctionStmt), statement)
+}
+
+func TestManager_Create(t *testing.T) {
+	var tests = []struct {
+		s   string
+		err string
+	}{
+		{
+			s: `CREATE FUNCTION udfSquare(a) AS "a * a"`,
+		}, {
+			s:   `CREATE FUNCTION udfSquare(b) AS "b * b"`,
+			err: "Item udfsquare already exists",
+		}, {
+			s:   `CREATE FUNCTION udfBad(a) AS "a * b"`,
+			err: "unknown parameter b in the body of function udfBad",
+		}, {
+			s:   `CREATE FUNCTION udfBad(a) AS "a * 2 a"`,
+			err: "invalid body of function udfBad: found \"a\", expected EOF.",
+		}, {
+			s:   `CREATE FUNCTION udfBad(a) AS "max(a) - min(a)" WITH (TYPE="scalar")`,
+			err: "scalar function udfBad cannot call aggregate functions",
+		}, {
+			s:   `CREATE FUNCTION udfBad(a) AS "lag(a)"`,
+			err: "analytic function lag is not allowed in the body of function udfBad",
+		}, {
+			s:   `CREATE FUNCTION udfBad(a) AS "udfUnknown(a)"`,
+			err: "invalid body of function udfBad: error getting function udfUnknown: not found",
+		}, {
+			s:   `CREATE FUNCTION udfBad(a) AS "return a +" WITH (LANGUAGE="starlark")`,
+			err: "invalid body of function udfBad: udfBad.star:3:1: got newline, want primary expression",
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		err := createFunction(tt.s)
+		if !reflect.DeepEqual(tt.err, common.Errstring(err)) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		}
+	}
+	if keys, _ := m.List(); !contains(keys, "udfsquare") || contains(keys, "udfbad") {
+		t.Errorf("function list mismatch, got %v", keys)
+	}
+	if stmt, err := m.Describe("UDFSQUARE"); err != nil {
+		t.Errorf("describe error: %v", err)
+	} else if exp := (&xsql.FunctionStmt{Name: "udfSquare", Params: []string{"a"}, Body: "a * a", Language: "sql"}); !reflect.DeepEqual(exp, stmt) {
+		t.Errorf("describe mismatch:\n  exp=%#v\n  got=%#v", exp, stmt)
+	}
+	if err := m.Drop("udfSquare"); err != nil {
+		t.Errorf("drop error: %v", err)
+	}
+	if err := m.Drop("udfSquare"); common.Errstring(err) != "function udfSquare is not found" {
+		t.Errorf("drop again error mismatch, got %v", err)
+	}
+	if m.HasFunction("udfSquare") {
+		t.Errorf("function udfSquare still exists after dropped")
+	}
+}
+
+func TestManager_CreateCycle(t *testing.T) {
+	var tests = []struct {
+		s   string
+		err string
+	}{
+		{
+			s: `CREATE FUNCTION udfCycleA(a) AS "a + 1"`,
+		}, {
+			s: `CREATE FUNCTION udfCycleB(a) AS "udfCycleA(a) * 2"`,
+		}, {
+			s: `CREATE FUNCTION udfCycleC(a) AS "udfCycleB(a) + udfCycleA(a)"`,
+		}, {
+			s:   `CREATE FUNCTION udfCycleSelf(a) AS "udfCycleSelf(a - 1)"`,
+			err: "function udfCycleSelf calls itself by udfCycleSelf -> udfCycleSelf",
+		},
+	}
+	defer func() {
+		for _, n := range []string{"udfCycleC", "udfCycleB", "udfCycleA"} {
+			m.Drop(n)
+		}
+	}()
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		err := createFunction(tt.s)
+		if !reflect.DeepEqual(tt.err, common.Errstring(err)) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		}
+	}
+	// Replace udfCycleA to call the functions which call it
+	if err := m.Drop("udfCycleA"); err != nil {
+		t.Errorf("drop error: %v", err)
+	}
+	err := createFunction(`CREATE FUNCTION udfCycleA(a) AS "abs(udfCycleC(a))"`)
+	if exp := "function udfCycleA calls itself by udfCycleA -> udfCycleC -> udfCycleB -> udfCycleA"; common.Errstring(err) != exp {
+		t.Errorf("create cycle error mismatch:\n  exp=%s\n  got=%v", exp, err)
+	}
+	if m.HasFunction("udfCycleA") {
+		t.Errorf("function udfCycleA is created with a cycle")
+	}
+}
+
+func contains(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func TestFunctions(t *testing.T) {
+	definitions := []string{
+		`CREATE FUNCTION udfHypot(x, y) AS "sqrt(power(x, 2) + power(y, 2))"`,
+		`CREATE FUNCTION udfRoundHypot(x, y) AS "round(udfHypot(x, y))"`,
+		`CREATE FUNCTION udfSpread(a) AS "max(a) - min(a)"`,
+		`CREATE FUNCTION udfClamp(v, lo, hi) AS "if v < lo:\n    return lo\nif v > hi:\n    return hi\nreturn v" WITH (LANGUAGE="starlark")`,
+		`CREATE FUNCTION udfWavg(v, w) AS "t = 0.0\ns = 0\nfor i in range(len(v)):\n    t += v[i] * w[i]\n    s += w[i]\nreturn t / s" WITH (LANGUAGE="starlark", TYPE="aggregate")`,
+		`CREATE FUNCTION udfKeys(o) AS "return sorted(o.keys())" WITH (LANGUAGE="starlark")`,
+	}
+	for _, d := range definitions {
+		if err := createFunction(d); err != nil {
+			t.Errorf("create function %s error: %v", d, err)
+			return
+		}
+	}
+	defer func() {
+		for _, n := range []string{"udfRoundHypot", "udfHypot", "udfSpread", "udfClamp", "udfWavg", "udfKeys"} {
+			m.Drop(n)
+		}
+	}()
+	var tests = []struct {
+		sql string
+		r   []interface{}
+	}{
+		{
+			sql: `SELECT udfHypot(3, 4), udfRoundHypot(a, b), udfClamp(a, 2, 4), udfClamp(b, 2, 4), udfKeys(o) FROM demo`,
+			r:   []interface{}{float64(5), float64(2), 2, 2, []interface{}{"x", "y"}},
+		}, {
+			sql: `SELECT udfSpread(a), udfWavg(a, b), udfClamp(a, 2, 4) FROM demo GROUP BY TUMBLINGWINDOW(ss, 10)`,
+			r:   []interface{}{int64(4), float64(3.4), 2},
+		},
+	}
+	data := xsql.WindowTuplesSet{{
+		Emitter: "demo",
+		Tuples: []xsql.Tuple{{
+			Emitter: "demo",
+			Message: xsql.Message{"a": 1, "b": 2, "o": map[string]interface{}{"y": 1, "x": 2}},
+		}, {
+			Emitter: "demo",
+			Message: xsql.Message{"a": 5, "b": 3},
+		}},
+	}}
+	store, err := states.CreateStore("testUdfFunctions", api.AtMostOnce)
+	if err != nil {
+		t.Errorf("create store error: %s", err)
+		return
+	}
+	ctx := contexts.Background().WithMeta("testUdfFunctions", "op1", store)
+	fv, afv := xsql.NewFunctionValuersForOp(ctx, xsql.FuncRegisters)
+	afv.SetData(data)
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		stmt, err := xsql.NewParser(strings.NewReader(tt.sql)).Parse()
+		if err != nil {
+			t.Errorf("%d. parse sql %s error: %s", i, tt.sql, err)
+			continue
+		}
+		var ve *xsql.ValuerEval
+		if xsql.IsAggStatement(stmt) {
+			ve = &xsql.ValuerEval{Valuer: xsql.MultiAggregateValuer(data, fv, &data[0].Tuples[0], fv, afv)}
+		} else {
+			ve = &xsql.ValuerEval{Valuer: xsql.MultiValuer(&data[0].Tuples[0], fv)}
+		}
+		var r []interface{}
+		for _, f := range stmt.Fields {
+			r = append(r, ve.Eval(f.Expr))
+		}
+		if !reflect.DeepEqual(tt.r, r) {
+			t.Errorf("%d. %s\n\nresult mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.sql, tt.r, r)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package udf
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/xsql"
+	"github.com/emqx/kuiper/xstream/api"
+	"go.starlark.net/starlark"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The max execution steps of a function call so that a long computation cannot block the rule
+const maxExecutionSteps = 1000000
+
+// starlarkFunc runs the function body in the starlark interpreter. The body is wrapped as a starlark function of the
+// parameters, so it must return the result by the return statement. The arguments of an aggregate function are the
+// lists of the values in the group.
+type starlarkFunc struct {
+	name   string
+	params []string
+	isAgg  bool
+	fn     starlark.Value
+}
+
+func newStarlarkFunc(stmt *xsql.FunctionStmt) (api.Function, error) {
+	var src strings.Builder
+	src.WriteString(fmt.Sprintf("def main(%s):\n", strings.Join(stmt.Params, ", ")))
+	for _, line := range strings.Split(stmt.Body, "\n") {
+		src.WriteString("    " + strings.TrimRight(line, "\r") + "\n")
+	}
+	thread := &starlark.Thread{Name: stmt.Name}
+	globals, err := starlark.ExecFile(thread, stmt.Name+".star", src.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body of function %s: %v", stmt.Name, err)
+	}
+	globals.Freeze()
+	return &starlarkFunc{
+		name:   stmt.Name,
+		params: stmt.Params,
+		isAgg:  stmt.FuncType == xsql.FUNC_TYPE_AGGREGATE,
+		fn:     globals["main"],
+	}, nil
+}
+
+func (f *starlarkFunc) Validate(args []interface{}) error {
+	if len(args) != len(f.params) {
+		return fmt.Errorf("The arguments for %s should be %d.", f.name, len(f.params))
+	}
+	return nil
+}
+
+func (f *starlarkFunc) IsAggregate() bool {
+	return f.isAgg
+}
+
+func (f *starlarkFunc) Exec(args []interface{}, _ api.FunctionContext) (interface{}, bool) {
+	sargs := make(starlark.Tuple, len(args))
+	for i, arg := range args {
+		v, err := toStarlark(arg)
+		if err != nil {
+			return fmt.Errorf("run %s function error: %v", f.name, err), false
+		}
+		sargs[i] = v
+	}
+	thread := &starlark.Thread{Name: f.name}
+	thread.SetMaxExecutionSteps(maxExecutionSteps)
+	r, err := starlark.Call(thread, f.fn, sargs, nil)
+	if err != nil {
+		return fmt.Errorf("run %s function error: %v", f.name, err), false
+	}
+	result, err := fromStarlark(r)
+	if err != nil {
+		return fmt.Errorf("run %s function error: %v", f.name, err), false
+	}
+	return result, true
+}
+
+func toStarlark(v interface{}) (starlark.Value, error) {
+	switch t := v.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(t), nil
+	case int:
+		return starlark.MakeInt(t), nil
+	case int64:
+		return starlark.MakeInt64(t), nil
+	case float64:
+		return starlark.Float(t), nil
+	case string:
+		return starlark.String(t), nil
+	case time.Time:
+		return starlark.MakeInt64(common.TimeToUnixMilli(t)), nil
+	case []interface{}:
+		elems := make([]starlark.Value, len(t))
+		for i, e := range t {
+			sv, err := toStarlark(e)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = sv
+		}
+		return starlark.NewList(elems), nil
+	case xsql.Message:
+		return toStarlark(map[string]interface{}(t))
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		d := starlark.NewDict(len(t))
+		for _, k := range keys {
+			sv, err := toStarlark(t[k])
+			if err != nil {
+				return nil, err
+			}
+			if err := d.SetKey(starlark.String(k), sv); err != nil {
+				return nil, err
+			}
+		}
+		return d, nil
+	default:
+		return nil, fmt.Errorf("unsupported argument type %T", v)
+	}
+}
+
+func fromStarlark(v starlark.Value) (interface{}, error) {
+	switch t := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(t), nil
+	case starlark.Int:
+		i, ok := t.Int64()
+		if !ok {
+			return nil, fmt.Errorf("int result %s is out of range", t)
+		}
+		return int(i), nil
+	case starlark.Float:
+		return float64(t), nil
+	case starlark.String:
+		return string(t), nil
+	case *starlark.Dict:
+		result := make(map[string]interface{}, t.Len())
+		for _, item := range t.Items() {
+			k, ok := item[0].(starlark.String)
+			if !ok {
+				return nil, fmt.Errorf("the key of the dict result must be a string but found %s", item[0].Type())
+			}
+			e, err := fromStarlark(item[1])
+			if err != nil {
+				return nil, err
+			}
+			result[string(k)] = e
+		}
+		return result, nil
+	case starlark.Indexable: // list and tuple
+		result := make([]interface{}, t.Len())
+		for i := range result {
+			e, err := fromStarlark(t.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			result[i] = e
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("unsupported result type %s", v.Type())
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/emqx/kuiper/common"
 	"math"
 	"reflect"
+	"regexp"
 	"sort"
 	"strings"
 	"time"
@@ -48,6 +49,16 @@ type Table struct {
 func (t *Table) source() {}
 func (ss *Table) node()  {}
 
+// SubQuery is a select statement used as the source of another statement. It is named by the alias.
+// The walk does not go into the subquery as its fields belong to a different scope.
+type SubQuery struct {
+	Stmt  *SelectStatement
+	Alias string
+}
+
+func (sq *SubQuery) source() {}
+func (sq *SubQuery) node()   {}
+
 type JoinType int
 
 const (
@@ -82,6 +93,7 @@ type Statement interface {
 }
 
 type SelectStatement struct {
+	Distinct   bool
 	Fields     Fields
 	Sources    Sources
 	Joins      Joins
@@ -89,6 +101,7 @@ type SelectStatement struct {
 	Dimensions Dimensions
 	Having     Expr
 	SortFields SortFields
+	Limit      *Limit
 }
 
 func (ss *SelectStatement) Stmt() {}
@@ -144,6 +157,17 @@ type Wildcard struct {
 	Token Token
 }
 
+// LambdaExpr is the lambda argument of the higher-order functions, such as x -> x * 2
+type LambdaExpr struct {
+	Param string
+	Body  Expr
+}
+
+// LambdaParamRef refers to the parameter of the enclosing lambda expression
+type LambdaParamRef struct {
+	Name string
+}
+
 type Dimension struct {
 	Expr Expr
 }
@@ -155,6 +179,14 @@ type SortField struct {
 
 type SortFields []SortField
 
+// Limit is applied to each result set, such as the result of a window. If By is set, the limit is applied to each
+// group of the rows which have the same values of the By columns
+type Limit struct {
+	Count  int
+	Offset int
+	By     []string
+}
+
 type Dimensions []Dimension
 
 func (f *Field) expr() {}
@@ -178,6 +210,12 @@ func (be *IndexExpr) node() {}
 func (w *Wildcard) expr() {}
 func (w *Wildcard) node() {}
 
+func (le *LambdaExpr) expr() {}
+func (le *LambdaExpr) node() {}
+
+func (lr *LambdaParamRef) expr() {}
+func (lr *LambdaParamRef) node() {}
+
 func (bl *BooleanLiteral) expr()    {}
 func (bl *BooleanLiteral) literal() {}
 func (bl *BooleanLiteral) node()    {}
@@ -228,6 +266,15 @@ func (sf SortFields) node() {}
 type Call struct {
 	Name string
 	Args []Expr
+	// Distinct is set if the aggregate function only takes the distinct values like count(DISTINCT x)
+	Distinct bool
+	// FuncId is the unique id of the analytic function call in the statement to distinguish its states
+	FuncId int
+	// Partition is the PARTITION BY clause of the analytic function call. Each partition key has its own states
+	Partition []Expr
+	// CacheKey is the key of the tuple field which caches the result of the aggregate function call. It is set by the
+	// planner if the window calculates the aggregate function incrementally
+	CacheKey string
 }
 
 func (c *Call) expr()    {}
@@ -272,6 +319,7 @@ type Window struct {
 	Length     *IntegerLiteral
 	Interval   *IntegerLiteral
 	Filter     Expr
+	Partition  []Expr
 }
 
 func (w *Window) expr()    {}
@@ -313,6 +361,42 @@ type BinaryExpr struct {
 func (fe *BinaryExpr) expr() {}
 func (be *BinaryExpr) node() {}
 
+// ValueSetExpr is the right hand side of IN and NOT IN. It is either a list of expressions like `(1, 2, 3)`
+// or an expression which is evaluated to an array.
+type ValueSetExpr struct {
+	LiteralExprs []Expr
+	ArrayExpr    Expr
+}
+
+func (c *ValueSetExpr) expr() {}
+func (c *ValueSetExpr) node() {}
+
+// BetweenExpr is the right hand side of BETWEEN and NOT BETWEEN. Both bounds are inclusive.
+type BetweenExpr struct {
+	Lower  Expr
+	Higher Expr
+}
+
+func (b *BetweenExpr) expr() {}
+func (b *BetweenExpr) node() {}
+
+// LikePattern is the right hand side of LIKE and NOT LIKE. The pattern is compiled when parsing if it is a string
+// literal, otherwise it is compiled in each evaluation.
+type LikePattern struct {
+	Expr    Expr
+	Pattern *regexp.Regexp
+}
+
+func (l *LikePattern) expr() {}
+func (l *LikePattern) node() {}
+
+type NotExpr struct {
+	Expr Expr
+}
+
+func (n *NotExpr) expr() {}
+func (n *NotExpr) node() {}
+
 type FieldRef struct {
 	StreamName StreamName
 	Name       string
@@ -340,6 +424,8 @@ type Options struct {
 	TIMESTAMP         string
 	TIMESTAMP_FORMAT  string
 	RETAIN_SIZE       int
+	SCHEMAID          string
+	KIND              string
 }
 
 func (o Options) node() {}
@@ -360,6 +446,17 @@ var StreamTypeMap = map[StreamType]string{
 	TypeTable:  "table",
 }
 
+// The kind of table. A scan table is fully loaded into memory from its source while a lookup table queries the
+// external store on demand when joining
+const (
+	TABLE_KIND_SCAN   = "scan"
+	TABLE_KIND_LOOKUP = "lookup"
+)
+
+func (ss *StreamStmt) IsLookupTable() bool {
+	return ss.StreamType == TypeTable && strings.EqualFold(ss.Options.KIND, TABLE_KIND_LOOKUP)
+}
+
 type StreamStmt struct {
 	Name         StreamName
 	StreamFields StreamFields
@@ -476,6 +573,51 @@ func (dss *DropTableStatement) Stmt()           {}
 func (dss *DropTableStatement) node()           {}
 func (dss *DropTableStatement) GetName() string { return dss.Name }
 
+// The languages and types of the user-defined functions
+const (
+	FUNC_LANG_SQL      = "sql"
+	FUNC_LANG_STARLARK = "starlark"
+
+	FUNC_TYPE_SCALAR    = "scalar"
+	FUNC_TYPE_AGGREGATE = "aggregate"
+)
+
+// FunctionStmt defines a user-defined function. The body is an expression of the parameters for the sql language
+// or the statements of the function body for a script language. An empty type of the sql function is inferred
+// from whether the body calls aggregate functions.
+type FunctionStmt struct {
+	Name     string
+	Params   []string
+	Body     string
+	Language string
+	FuncType string
+}
+
+func (fs *FunctionStmt) node() {}
+func (fs *FunctionStmt) Stmt() {}
+
+type ShowFunctionsStatement struct {
+}
+
+type DescribeFunctionStatement struct {
+	Name string
+}
+
+type DropFunctionStatement struct {
+	Name string
+}
+
+func (ss *ShowFunctionsStatement) Stmt() {}
+func (ss *ShowFunctionsStatement) node() {}
+
+func (dss *DescribeFunctionStatement) Stmt()           {}
+func (dss *DescribeFunctionStatement) node()           {}
+func (dss *DescribeFunctionStatement) GetName() string { return dss.Name }
+
+func (dss *DropFunctionStatement) Stmt()           {}
+func (dss *DropFunctionStatement) node()           {}
+func (dss *DropFunctionStatement) GetName() string { return dss.Name }
+
 type Visitor interface {
 	Visit(Node) Visitor
 }
@@ -499,6 +641,9 @@ func Walk(v Visitor, node Node) {
 		for _, expr := range n.Args {
 			Walk(v, expr)
 		}
+		for _, expr := range n.Partition {
+			Walk(v, expr)
+		}
 
 	case Dimensions:
 		Walk(v, n.GetWindow())
@@ -510,6 +655,9 @@ func Walk(v Visitor, node Node) {
 		Walk(v, n.Length)
 		Walk(v, n.Interval)
 		Walk(v, n.Filter)
+		for _, expr := range n.Partition {
+			Walk(v, expr)
+		}
 
 	case *Field:
 		Walk(v, n.Expr)
@@ -522,6 +670,25 @@ func Walk(v Visitor, node Node) {
 	case *ParenExpr:
 		Walk(v, n.Expr)
 
+	case *LambdaExpr:
+		Walk(v, n.Body)
+
+	case *NotExpr:
+		Walk(v, n.Expr)
+
+	case *ValueSetExpr:
+		for _, expr := range n.LiteralExprs {
+			Walk(v, expr)
+		}
+		Walk(v, n.ArrayExpr)
+
+	case *BetweenExpr:
+		Walk(v, n.Lower)
+		Walk(v, n.Higher)
+
+	case *LikePattern:
+		Walk(v, n.Expr)
+
 	case *SelectStatement:
 		Walk(v, n.Fields)
 		Walk(v, n.Dimensions)
@@ -597,6 +764,12 @@ type CallValuer interface {
 	Call(name string, args []interface{}) (interface{}, bool)
 }
 
+// AnalyticCallValuer evaluates the analytic function calls which keep states for each call and partition key
+type AnalyticCallValuer interface {
+	CallValuer
+	AnalyticCall(name string, funcId int, key string, args []interface{}) (interface{}, bool)
+}
+
 type AggregateCallValuer interface {
 	CallValuer
 	GetAllTuples() AggregateData
@@ -1145,6 +1318,19 @@ func (a multiValuer) Call(name string, args []interface{}) (interface{}, bool) {
 	return nil, false
 }
 
+func (a multiValuer) AnalyticCall(name string, funcId int, key string, args []interface{}) (interface{}, bool) {
+	for _, valuer := range a {
+		if valuer, ok := valuer.(AnalyticCallValuer); ok {
+			if v, ok := valuer.AnalyticCall(name, funcId, key, args); ok {
+				return v, true
+			} else {
+				return fmt.Errorf("call func %s error: %v", name, v), false
+			}
+		}
+	}
+	return nil, false
+}
+
 type multiAggregateValuer struct {
 	data AggregateData
 	multiValuer
@@ -1159,9 +1345,26 @@ func MultiAggregateValuer(data AggregateData, singleCallValuer CallValuer, value
 	}
 }
 
+// isAgg checks the custom functions by the instances of the rule so that the running rules are not affected when the
+// functions are deleted or redefined
+func (a *multiAggregateValuer) isAgg(name string) bool {
+	lowerName := strings.ToLower(name)
+	if _, ok := aggFuncMap[lowerName]; ok {
+		return true
+	}
+	if IsBuiltinFunc(lowerName) {
+		return false
+	}
+	for _, valuer := range a.multiValuer {
+		if av, ok := valuer.(*AggregateFunctionValuer); ok {
+			return av.isCustomAgg(name)
+		}
+	}
+	return isCustomAggFunc(lowerName)
+}
+
 func (a *multiAggregateValuer) Call(name string, args []interface{}) (interface{}, bool) {
-	// assume the aggFuncMap already cache the custom agg funcs in isAggFunc()
-	_, isAgg := aggFuncMap[name]
+	isAgg := a.isAgg(name)
 	for _, valuer := range a.multiValuer {
 		if a, ok := valuer.(AggregateCallValuer); ok && isAgg {
 			if v, ok := a.Call(name, args); ok {
@@ -1219,13 +1422,22 @@ func (v *ValuerEval) Eval(expr Expr) interface{} {
 	case *IndexExpr:
 		return &BracketEvalResult{Start: expr.Index, End: expr.Index}
 	case *Call:
+		if expr.CacheKey != "" {
+			if val, ok := v.Valuer.Value(expr.CacheKey); ok {
+				return val
+			}
+		}
 		if valuer, ok := v.Valuer.(CallValuer); ok {
 			var args []interface{}
 			if len(expr.Args) > 0 {
 				args = make([]interface{}, len(expr.Args))
 				for i, arg := range expr.Args {
 					if aggreValuer, ok := valuer.(AggregateCallValuer); isAggFunc(expr) && ok {
-						args[i] = aggreValuer.GetAllTuples().AggregateEval(arg, aggreValuer.GetSingleCallValuer())
+						vals := aggreValuer.GetAllTuples().AggregateEval(arg, aggreValuer.GetSingleCallValuer())
+						if expr.Distinct {
+							vals = distinctValues(vals)
+						}
+						args[i] = vals
 					} else {
 						args[i] = v.Eval(arg)
 						if _, ok := args[i].(error); ok {
@@ -1234,6 +1446,17 @@ func (v *ValuerEval) Eval(expr Expr) interface{} {
 					}
 				}
 			}
+			if isAnalyticFunc(expr.Name) {
+				if av, ok := valuer.(AnalyticCallValuer); ok {
+					key, err := v.evalPartitionKey(expr.Partition)
+					if err != nil {
+						return err
+					}
+					val, _ := av.AnalyticCall(expr.Name, expr.FuncId, key, args)
+					return val
+				}
+				return fmt.Errorf("analytic function %s is not supported in this context", expr.Name)
+			}
 			val, _ := valuer.Call(expr.Name, args)
 			return val
 		}
@@ -1259,14 +1482,44 @@ func (v *ValuerEval) Eval(expr Expr) interface{} {
 	case *Wildcard:
 		val, _ := v.Valuer.Value("")
 		return val
+	case *LambdaExpr:
+		return lambdaFunc(func(x interface{}) interface{} {
+			ve := &ValuerEval{Valuer: MultiValuer(&lambdaValuer{name: expr.Param, value: x}, v.Valuer)}
+			return ve.Eval(expr.Body)
+		})
+	case *LambdaParamRef:
+		val, _ := v.Valuer.Value(expr.Name)
+		return val
 	case *CaseExpr:
 		return v.evalCase(expr)
+	case *NotExpr:
+		return v.evalNot(expr)
 	default:
 		return nil
 	}
 }
 
+// Evaluate the PARTITION BY expressions to the key of the partition. Return an empty key if no partition
+func (v *ValuerEval) evalPartitionKey(partition []Expr) (string, error) {
+	if len(partition) == 0 {
+		return "", nil
+	}
+	values := make([]string, len(partition))
+	for i, p := range partition {
+		pv := v.Eval(p)
+		if err, ok := pv.(error); ok {
+			return "", fmt.Errorf("evaluate partition key %s error: %v", p, err)
+		}
+		values[i] = fmt.Sprintf("%v", pv)
+	}
+	return strings.Join(values, ","), nil
+}
+
 func (v *ValuerEval) evalBinaryExpr(expr *BinaryExpr) interface{} {
+	switch expr.OP {
+	case IN, NOTIN, BETWEEN, NOTBETWEEN, LIKE, NOTLIKE, ISNULL, ISNOTNULL:
+		return v.evalPredicate(expr)
+	}
 	lhs := v.Eval(expr.LHS)
 	switch val := lhs.(type) {
 	case map[string]interface{}:
@@ -1318,6 +1571,166 @@ func (v *ValuerEval) evalCase(expr *CaseExpr) interface{} {
 	return nil
 }
 
+func (v *ValuerEval) evalNot(expr *NotExpr) interface{} {
+	switch r := v.Eval(expr.Expr).(type) {
+	case error:
+		return r
+	case bool:
+		return !r
+	case nil:
+		return nil
+	default:
+		return fmt.Errorf("invalid operation NOT %[1]T(%[1]v)", r)
+	}
+}
+
+func (v *ValuerEval) evalPredicate(expr *BinaryExpr) interface{} {
+	lhs := v.Eval(expr.LHS)
+	if _, ok := lhs.(error); ok {
+		return lhs
+	}
+	var r interface{}
+	switch expr.OP {
+	case ISNULL:
+		return lhs == nil
+	case ISNOTNULL:
+		return lhs != nil
+	case IN, NOTIN:
+		r = v.evalIn(lhs, expr.RHS)
+	case BETWEEN, NOTBETWEEN:
+		r = v.evalBetween(lhs, expr.RHS)
+	case LIKE, NOTLIKE:
+		r = v.evalLike(lhs, expr.RHS)
+	}
+	if b, ok := r.(bool); ok && (expr.OP == NOTIN || expr.OP == NOTBETWEEN || expr.OP == NOTLIKE) {
+		return !b
+	}
+	return r
+}
+
+func (v *ValuerEval) evalIn(lhs interface{}, expr Expr) interface{} {
+	set, ok := expr.(*ValueSetExpr)
+	if !ok {
+		return fmt.Errorf("invalid value set %v for IN operation", expr)
+	}
+	var values []interface{}
+	if set.ArrayExpr != nil {
+		arr := v.Eval(set.ArrayExpr)
+		switch t := arr.(type) {
+		case error:
+			return t
+		case nil:
+			return false
+		}
+		if !isSliceOrArray(arr) {
+			return fmt.Errorf("invalid operation %[1]T(%[1]v) IN %[2]T(%[2]v), the right side must be an array", lhs, arr)
+		}
+		val := reflect.ValueOf(arr)
+		for i := 0; i < val.Len(); i++ {
+			values = append(values, val.Index(i).Interface())
+		}
+	} else {
+		for _, e := range set.LiteralExprs {
+			r := v.Eval(e)
+			if _, ok := r.(error); ok {
+				return r
+			}
+			values = append(values, r)
+		}
+	}
+	for _, val := range values {
+		switch r := v.simpleDataEval(lhs, val, EQ).(type) {
+		case error:
+			return r
+		case bool:
+			if r {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (v *ValuerEval) evalBetween(lhs interface{}, expr Expr) interface{} {
+	b, ok := expr.(*BetweenExpr)
+	if !ok {
+		return fmt.Errorf("invalid bounds %v for BETWEEN operation", expr)
+	}
+	lower := v.Eval(b.Lower)
+	if _, ok := lower.(error); ok {
+		return lower
+	}
+	higher := v.Eval(b.Higher)
+	if _, ok := higher.(error); ok {
+		return higher
+	}
+	r := v.simpleDataEval(lhs, lower, GTE)
+	if ge, ok := r.(bool); !ok || !ge {
+		return r
+	}
+	return v.simpleDataEval(lhs, higher, LTE)
+}
+
+func (v *ValuerEval) evalLike(lhs interface{}, expr Expr) interface{} {
+	l, ok := expr.(*LikePattern)
+	if !ok {
+		return fmt.Errorf("invalid pattern %v for LIKE operation", expr)
+	}
+	if lhs == nil {
+		return false
+	}
+	str, ok := lhs.(string)
+	if !ok {
+		return fmt.Errorf("invalid operation %[1]T(%[1]v) LIKE, the left side must be a string", lhs)
+	}
+	re := l.Pattern
+	if re == nil {
+		p := v.Eval(l.Expr)
+		switch t := p.(type) {
+		case error:
+			return t
+		case string:
+			var err error
+			if re, err = compileLikePattern(t); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("invalid LIKE pattern %[1]T(%[1]v), must be a string", p)
+		}
+	}
+	return re.MatchString(str)
+}
+
+// Convert the LIKE pattern to a regular expression. The `%` matches any sequence of characters and the `_` matches
+// any single character. Use `\` to escape them.
+func compileLikePattern(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("(?s)^")
+	escape := false
+	for _, c := range pattern {
+		if escape {
+			b.WriteString(regexp.QuoteMeta(string(c)))
+			escape = false
+			continue
+		}
+		switch c {
+		case '\\':
+			escape = true
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	if escape {
+		return nil, fmt.Errorf("invalid LIKE pattern %s, ends with escape character", pattern)
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
 func isSliceOrArray(v interface{}) bool {
 	kind := reflect.ValueOf(v).Kind()
 	return kind == reflect.Array || kind == reflect.Slice
@@ -2,7 +2,10 @@ package xsql
 
 import (
 	"fmt"
+	"github.com/emqx/kuiper/common"
 	"github.com/emqx/kuiper/xstream/api"
+	"math"
+	"sort"
 	"strings"
 )
 
@@ -24,6 +27,11 @@ func NewAggregateFunctionValuers(p *funcRuntime) (*FunctionValuer, *AggregateFun
 	}
 }
 
+func (v *AggregateFunctionValuer) isCustomAgg(name string) bool {
+	nf, _, err := v.fv.runtime.getCustom(name)
+	return err == nil && nf.IsAggregate()
+}
+
 func (v *AggregateFunctionValuer) SetData(data AggregateData) {
 	v.data = data
 }
@@ -169,6 +177,74 @@ func (v *AggregateFunctionValuer) Call(name string, args []interface{}) (interfa
 		return 0, true
 	case "collect":
 		return args[0], true
+	case "stddev", "stddevs", "var", "vars":
+		arg0 := args[0].([]interface{})
+		vals, err := sliceToFloats(arg0)
+		if err != nil {
+			return fmt.Errorf("run %s function error: %v", lowerName, err), false
+		}
+		sample := lowerName == "stddevs" || lowerName == "vars"
+		r, ok := variance(vals, sample)
+		if !ok {
+			return nil, true
+		}
+		if lowerName == "stddev" || lowerName == "stddevs" {
+			return math.Sqrt(r), true
+		}
+		return r, true
+	case "median", "percentile_cont", "percentile_disc":
+		arg0 := args[0].([]interface{})
+		p := 0.5
+		if lowerName != "median" {
+			arg1, ok := args[1].([]interface{})
+			if !ok || len(arg1) == 0 {
+				return fmt.Errorf("run %s function error: missing the percentile", lowerName), false
+			}
+			var err error
+			p, err = common.ToFloat64(getFirstValidArg(arg1), common.CONVERT_SAMEKIND)
+			if err != nil || p < 0 || p > 1 {
+				return fmt.Errorf("run %s function error: the percentile must be a number between 0 and 1 but got %v", lowerName, getFirstValidArg(arg1)), false
+			}
+		}
+		if len(arg0) > percentileExactLimit {
+			t, err := sliceToTDigest(arg0)
+			if err != nil {
+				return fmt.Errorf("run %s function error: %v", lowerName, err), false
+			}
+			if t.count == 0 {
+				return nil, true
+			}
+			if lowerName == "percentile_disc" {
+				return t.percentileDisc(p), true
+			}
+			return t.percentileCont(p), true
+		}
+		vals, err := sliceToFloats(arg0)
+		if err != nil {
+			return fmt.Errorf("run %s function error: %v", lowerName, err), false
+		}
+		if len(vals) == 0 {
+			return nil, true
+		}
+		sort.Float64s(vals)
+		if lowerName == "percentile_disc" {
+			return percentileDisc(vals, p), true
+		}
+		return percentileCont(vals, p), true
+	case "mode":
+		arg0 := args[0].([]interface{})
+		return sliceMode(arg0), true
+	case "first_value":
+		arg0 := args[0].([]interface{})
+		return getFirstValidArg(arg0), true
+	case "last_value":
+		arg0 := args[0].([]interface{})
+		for i := len(arg0) - 1; i >= 0; i-- {
+			if arg0[i] != nil {
+				return arg0[i], true
+			}
+		}
+		return nil, true
 	case "deduplicate":
 		v1, ok1 := args[0].([]interface{})
 		v2, ok2 := args[1].([]interface{})
@@ -315,7 +391,7 @@ func sliceFloatMin(s []interface{}, min float64) (float64, error) {
 func sliceStringMin(s []interface{}, min string) (string, error) {
 	for _, v := range s {
 		if vs, ok := v.(string); ok {
-			if min < vs {
+			if min > vs {
 				min = vs
 			}
 		} else if v != nil {
@@ -325,6 +401,132 @@ func sliceStringMin(s []interface{}, min string) (string, error) {
 	return min, nil
 }
 
+// Convert the non-null numbers to float64 for the statistical functions
+func sliceToFloats(s []interface{}) ([]float64, error) {
+	result := make([]float64, 0, len(s))
+	for _, v := range s {
+		f, ok, err := toStatFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result = append(result, f)
+		}
+	}
+	return result, nil
+}
+
+// Add the non-null numbers to the t-digest without keeping all of them
+func sliceToTDigest(s []interface{}) (*tDigest, error) {
+	t := newTDigest()
+	for _, v := range s {
+		f, ok, err := toStatFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			t.add(f)
+		}
+	}
+	return t, nil
+}
+
+// Return false for the null value
+func toStatFloat(v interface{}) (float64, bool, error) {
+	switch vt := v.(type) {
+	case int:
+		return float64(vt), true, nil
+	case int64:
+		return float64(vt), true, nil
+	case float64:
+		return vt, true, nil
+	case nil:
+		return 0, false, nil
+	default:
+		return 0, false, fmt.Errorf("requires number but found %[1]T(%[1]v)", v)
+	}
+}
+
+// Calculate the variance in one pass by Welford's algorithm. Return false if there are not enough values.
+func variance(s []float64, sample bool) (float64, bool) {
+	var (
+		mean, m2 float64
+		n        int
+	)
+	for _, v := range s {
+		n++
+		delta := v - mean
+		mean += delta / float64(n)
+		m2 += delta * (v - mean)
+	}
+	if sample {
+		if n < 2 {
+			return 0, false
+		}
+		return m2 / float64(n-1), true
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return m2 / float64(n), true
+}
+
+// The percentile with linear interpolation between the adjacent values. The slice must be sorted and not empty.
+func percentileCont(s []float64, p float64) float64 {
+	pos := p * float64(len(s)-1)
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+	return s[lower] + (s[upper]-s[lower])*(pos-float64(lower))
+}
+
+// The first value whose cumulative distribution is not less than the percentile. The slice must be sorted and not empty.
+func percentileDisc(s []float64, p float64) float64 {
+	i := int(math.Ceil(p*float64(len(s)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return s[i]
+}
+
+// The most frequent non-null value. If there are multiple ones, return the one which appears first.
+func sliceMode(s []interface{}) interface{} {
+	var (
+		counts = make(map[string]int)
+		keys   = make([]string, len(s))
+		max    int
+	)
+	for i, v := range s {
+		if v == nil {
+			continue
+		}
+		keys[i] = fmt.Sprintf("%v", v)
+		counts[keys[i]]++
+		if counts[keys[i]] > max {
+			max = counts[keys[i]]
+		}
+	}
+	for i, v := range s {
+		if v != nil && counts[keys[i]] == max {
+			return v
+		}
+	}
+	return nil
+}
+
+// Remove the duplicate values and keep the first occurrence of each value
+func distinctValues(s []interface{}) []interface{} {
+	keyset := make(map[string]bool)
+	result := make([]interface{}, 0, len(s))
+	for _, v := range s {
+		key := fmt.Sprintf("%v", v)
+		if !keyset[key] {
+			keyset[key] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
 func dedup(r []interface{}, col []interface{}, all bool) (interface{}, error) {
 	keyset := make(map[string]bool)
 	result := make([]interface{}, 0)
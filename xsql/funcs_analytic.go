@@ -0,0 +1,179 @@
+package xsql
+
+import (
+	"encoding/gob"
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/xstream/api"
+	"reflect"
+	"strings"
+)
+
+// The analytic functions are evaluated for each event and keep the states of the previous events. The states are
+// saved in the function context by the key of the function name and partition so that they are checkpointed.
+var analyticFuncMap = map[string]string{"lag": "",
+	"latest":      "",
+	"changed_col": "", "had_changed": "",
+	"acc_sum": "", "acc_avg": "",
+}
+
+func init() {
+	gob.Register([]interface{}{})
+}
+
+func isAnalyticFunc(name string) bool {
+	_, ok := analyticFuncMap[strings.ToLower(name)]
+	return ok
+}
+
+func (fv *FunctionValuer) AnalyticCall(name string, funcId int, key string, args []interface{}) (interface{}, bool) {
+	lowerName := strings.ToLower(name)
+	if _, ok := analyticFuncMap[lowerName]; !ok {
+		return nil, false
+	}
+	fctx, err := fv.runtime.getAnalytic(funcId)
+	if err != nil {
+		return err, false
+	}
+	return analyticCall(lowerName, args, fctx, fmt.Sprintf("%s_%s", lowerName, key))
+}
+
+func analyticCall(name string, args []interface{}, fctx api.FunctionContext, key string) (interface{}, bool) {
+	state, err := fctx.GetState(key)
+	if err != nil {
+		return err, false
+	}
+	switch name {
+	case "lag":
+		n := 1
+		if len(args) > 1 {
+			n, err = common.ToInt(args[1], common.STRICT)
+			if err != nil || n < 1 {
+				return fmt.Errorf("the 2nd parameter of lag must be a positive integer but got %v", args[1]), false
+			}
+		}
+		var def interface{}
+		if len(args) > 2 {
+			def = args[2]
+		}
+		var history []interface{}
+		if state != nil {
+			history = state.([]interface{})
+		}
+		r := def
+		if len(history) == n {
+			r = history[0]
+			history = history[1:]
+		}
+		// Copy the history so that the saved state is never modified
+		next := make([]interface{}, 0, n)
+		next = append(append(next, history...), args[0])
+		if err := fctx.PutState(key, next); err != nil {
+			return err, false
+		}
+		return r, true
+	case "latest":
+		if args[0] != nil {
+			if err := fctx.PutState(key, args[0]); err != nil {
+				return err, false
+			}
+			return args[0], true
+		}
+		if state != nil {
+			return state, true
+		}
+		if len(args) > 1 {
+			return args[1], true
+		}
+		return nil, true
+	case "changed_col":
+		ignoreNull, ok := args[0].(bool)
+		if !ok {
+			return fmt.Errorf("the 1st parameter of changed_col must be a bool but got %v", args[0]), false
+		}
+		if ignoreNull && args[1] == nil {
+			return nil, true
+		}
+		// The state wraps the value so that a nil value can be distinguished from the missing state
+		if state != nil && reflect.DeepEqual(state.([]interface{})[0], args[1]) {
+			return nil, true
+		}
+		if err := fctx.PutState(key, []interface{}{args[1]}); err != nil {
+			return err, false
+		}
+		return args[1], true
+	case "had_changed":
+		ignoreNull, ok := args[0].(bool)
+		if !ok {
+			return fmt.Errorf("the 1st parameter of had_changed must be a bool but got %v", args[0]), false
+		}
+		values := args[1:]
+		if state == nil {
+			// A nil value means not received yet if ignoring null
+			state = make([]interface{}, len(values))
+			if !ignoreNull {
+				if err := fctx.PutState(key, values); err != nil {
+					return err, false
+				}
+				return true, true
+			}
+		}
+		prev := state.([]interface{})
+		next := make([]interface{}, len(values))
+		changed := false
+		for i, v := range values {
+			if ignoreNull && v == nil {
+				next[i] = prev[i]
+				continue
+			}
+			if (ignoreNull && prev[i] == nil) || !reflect.DeepEqual(prev[i], v) {
+				changed = true
+			}
+			next[i] = v
+		}
+		if changed {
+			if err := fctx.PutState(key, next); err != nil {
+				return err, false
+			}
+		}
+		return changed, true
+	case "acc_sum", "acc_avg":
+		// The state is the sum and the count of the non-null values
+		acc := []interface{}{float64(0), int64(0)}
+		if state != nil {
+			acc = state.([]interface{})
+		}
+		if args[0] != nil {
+			v, err := common.ToFloat64(args[0], common.CONVERT_SAMEKIND)
+			if err != nil {
+				return fmt.Errorf("the parameter of %s must be a number but got %v", name, args[0]), false
+			}
+			acc = []interface{}{acc[0].(float64) + v, acc[1].(int64) + 1}
+			if err := fctx.PutState(key, acc); err != nil {
+				return err, false
+			}
+		}
+		if acc[1].(int64) == 0 {
+			return nil, true
+		}
+		if name == "acc_sum" {
+			return acc[0], true
+		}
+		return acc[0].(float64) / float64(acc[1].(int64)), true
+	}
+	return fmt.Errorf("unknown analytic function %s", name), false
+}
+
+// HasAnalyticFuncs returns true if the node calls any analytic function
+func HasAnalyticFuncs(node Node) bool {
+	if node == nil {
+		return false
+	}
+	var r = false
+	WalkFunc(node, func(n Node) {
+		if f, ok := n.(*Call); ok && isAnalyticFunc(f.Name) {
+			r = true
+		}
+	})
+	return r
+}
@@ -0,0 +1,60 @@
+package xsql
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/xstream/api"
+	"github.com/emqx/kuiper/xstream/contexts"
+	"github.com/emqx/kuiper/xstream/states"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnalyticFuncs(t *testing.T) {
+	var tests = []struct {
+		m Message
+		r []interface{}
+	}{
+		{
+			m: map[string]interface{}{"id": float64(1), "temp": float64(10), "status": "on"},
+			r: []interface{}{nil, float64(10), "on", true, float64(10), float64(10)},
+		}, {
+			m: map[string]interface{}{"id": float64(2), "temp": float64(20), "status": "on"},
+			r: []interface{}{nil, float64(20), nil, true, float64(20), float64(15)},
+		}, {
+			m: map[string]interface{}{"id": float64(1), "status": "off"},
+			r: []interface{}{float64(10), float64(20), "off", true, float64(10), float64(15)},
+		}, {
+			m: map[string]interface{}{"id": float64(1), "temp": float64(30), "status": "off"},
+			r: []interface{}{nil, float64(30), nil, true, float64(40), float64(20)},
+		}, {
+			m: map[string]interface{}{"id": float64(2), "temp": float64(30), "status": "off"},
+			r: []interface{}{float64(20), float64(30), nil, false, float64(50), float64(22.5)},
+		},
+	}
+	sql := `SELECT lag(temp) OVER (PARTITION BY id), latest(temp), changed_col(true, status), had_changed(true, status, temp),
+		acc_sum(temp) OVER (PARTITION BY id), acc_avg(temp) FROM demo`
+	stmt, err := NewParser(strings.NewReader(sql)).Parse()
+	if err != nil {
+		t.Errorf("parse sql %s error: %s", sql, err)
+		return
+	}
+	store, err := states.CreateStore("testAnalyticFuncs", api.AtMostOnce)
+	if err != nil {
+		t.Errorf("create store error: %s", err)
+		return
+	}
+	ctx := contexts.Background().WithMeta("testAnalyticFuncs", "op1", store)
+	fv, _ := NewFunctionValuersForOp(ctx, nil)
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		ve := &ValuerEval{Valuer: MultiValuer(&Tuple{Emitter: "demo", Message: tt.m}, fv)}
+		var r []interface{}
+		for _, f := range stmt.Fields {
+			r = append(r, ve.Eval(f.Expr))
+		}
+		if !reflect.DeepEqual(tt.r, r) {
+			t.Errorf("%d. %v\n\nresult mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.m, tt.r, r)
+		}
+	}
+}
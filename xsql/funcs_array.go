@@ -0,0 +1,253 @@
+package xsql
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var arrayFuncMap = map[string]string{"array_concat": "",
+	"array_contains": "", "array_distinct": "", "array_filter": "", "array_map": "", "array_position": "",
+	"array_slice":      "",
+	"object_construct": "", "object_keys": "", "object_values": "",
+	"unnest": "",
+	"zip":    "",
+}
+
+// The higher-order functions whose second argument is a lambda expression
+var lambdaFuncMap = map[string]string{"array_filter": "", "array_map": ""}
+
+// The evaluated lambda expression which evaluates the body with the parameter
+type lambdaFunc func(interface{}) interface{}
+
+// lambdaValuer provides the value of the lambda parameter
+type lambdaValuer struct {
+	name  string
+	value interface{}
+}
+
+func (lv *lambdaValuer) Value(key string) (interface{}, bool) {
+	if strings.EqualFold(key, lv.name) {
+		return lv.value, true
+	}
+	return nil, false
+}
+
+func (lv *lambdaValuer) Meta(_ string) (interface{}, bool) {
+	return nil, false
+}
+
+// IsUnnest returns true if the expression is the call of unnest which expands the array into multiple rows
+func IsUnnest(expr Expr) bool {
+	c, ok := expr.(*Call)
+	return ok && strings.EqualFold(c.Name, "unnest")
+}
+
+// Convert the slice of any type to []interface{}
+func toArray(name string, arg interface{}) ([]interface{}, error) {
+	if a, ok := arg.([]interface{}); ok {
+		return a, nil
+	}
+	v := reflect.ValueOf(arg)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("run %s function error: expect array but found %[2]T(%[2]v)", name, arg)
+	}
+	result := make([]interface{}, v.Len())
+	for i := range result {
+		result[i] = v.Index(i).Interface()
+	}
+	return result, nil
+}
+
+func toObject(name string, arg interface{}) (map[string]interface{}, error) {
+	switch m := arg.(type) {
+	case map[string]interface{}:
+		return m, nil
+	case Message:
+		return m, nil
+	default:
+		return nil, fmt.Errorf("run %s function error: expect object but found %[2]T(%[2]v)", name, arg)
+	}
+}
+
+// The numbers are equal if their values are equal regardless of the types
+func valueEqual(a, b interface{}) bool {
+	if fa, err := common.ToFloat64(a, common.CONVERT_SAMEKIND); err == nil {
+		if fb, err := common.ToFloat64(b, common.CONVERT_SAMEKIND); err == nil {
+			return fa == fb
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func arrayCall(name string, args []interface{}) (interface{}, bool) {
+	switch name {
+	case "array_concat":
+		result := make([]interface{}, 0)
+		for _, arg := range args {
+			if arg == nil {
+				continue
+			}
+			a, err := toArray(name, arg)
+			if err != nil {
+				return err, false
+			}
+			result = append(result, a...)
+		}
+		return result, true
+	case "object_construct":
+		result := make(map[string]interface{}, len(args)/2)
+		for i := 0; i+1 < len(args); i += 2 {
+			k, ok := args[i].(string)
+			if !ok {
+				return fmt.Errorf("run object_construct function error: expect string key but found %[1]T(%[1]v)", args[i]), false
+			}
+			if args[i+1] != nil {
+				result[k] = args[i+1]
+			}
+		}
+		return result, true
+	case "zip":
+		arrays := make([][]interface{}, len(args))
+		l := -1
+		for i, arg := range args {
+			if arg == nil {
+				return nil, true
+			}
+			a, err := toArray(name, arg)
+			if err != nil {
+				return err, false
+			}
+			arrays[i] = a
+			if l < 0 || len(a) < l {
+				l = len(a)
+			}
+		}
+		result := make([]interface{}, l)
+		for i := range result {
+			tuple := make([]interface{}, len(arrays))
+			for j, a := range arrays {
+				tuple[j] = a[i]
+			}
+			result[i] = tuple
+		}
+		return result, true
+	}
+	// The other functions return null for the null array or object
+	if args[0] == nil {
+		return nil, true
+	}
+	switch name {
+	case "object_keys", "object_values":
+		m, err := toObject(name, args[0])
+		if err != nil {
+			return err, false
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		result := make([]interface{}, len(keys))
+		for i, k := range keys {
+			if name == "object_keys" {
+				result[i] = k
+			} else {
+				result[i] = m[k]
+			}
+		}
+		return result, true
+	}
+	a, err := toArray(name, args[0])
+	if err != nil {
+		return err, false
+	}
+	switch name {
+	case "array_contains":
+		for _, v := range a {
+			if valueEqual(v, args[1]) {
+				return true, true
+			}
+		}
+		return false, true
+	case "array_position":
+		for i, v := range a {
+			if valueEqual(v, args[1]) {
+				return i, true
+			}
+		}
+		return -1, true
+	case "array_distinct":
+		result := make([]interface{}, 0, len(a))
+		for _, v := range a {
+			found := false
+			for _, r := range result {
+				if valueEqual(v, r) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				result = append(result, v)
+			}
+		}
+		return result, true
+	case "array_slice":
+		start, err := common.ToInt(args[1], common.STRICT)
+		if err != nil {
+			return fmt.Errorf("the 2nd parameter of array_slice must be an integer but got %v", args[1]), false
+		}
+		end := len(a)
+		if len(args) > 2 {
+			end, err = common.ToInt(args[2], common.STRICT)
+			if err != nil {
+				return fmt.Errorf("the 3rd parameter of array_slice must be an integer but got %v", args[2]), false
+			}
+		}
+		start, end = sliceIndex(start, len(a)), sliceIndex(end, len(a))
+		if start >= end {
+			return []interface{}{}, true
+		}
+		return a[start:end], true
+	case "array_map", "array_filter":
+		f, ok := args[1].(lambdaFunc)
+		if !ok {
+			return fmt.Errorf("the 2nd parameter of %s must be a lambda expression", name), false
+		}
+		result := make([]interface{}, 0, len(a))
+		for _, v := range a {
+			r := f(v)
+			if e, ok := r.(error); ok {
+				return fmt.Errorf("run %s function error: %v", name, e), false
+			}
+			if name == "array_map" {
+				result = append(result, r)
+			} else if b, ok := r.(bool); ok && b {
+				result = append(result, v)
+			} else if !ok && r != nil {
+				return fmt.Errorf("run array_filter function error: the lambda must return bool but found %[1]T(%[1]v)", r), false
+			}
+		}
+		return result, true
+	case "unnest":
+		// The array is expanded into multiple rows by the project
+		return a, true
+	default:
+		return fmt.Errorf("unknown function name %s", name), false
+	}
+}
+
+// Convert the possibly negative index to the position in the array of the length
+func sliceIndex(i, l int) int {
+	if i < 0 {
+		i += l
+		if i < 0 {
+			i = 0
+		}
+	} else if i > l {
+		i = l
+	}
+	return i
+}
@@ -23,8 +23,16 @@ func validateFuncs(funcName string, args []Expr) error {
 		return validateJsonFunc(lowerName, args)
 	} else if _, ok := otherFuncMap[lowerName]; ok {
 		return validateOtherFunc(lowerName, args)
+	} else if _, ok := dateTimeFuncMap[lowerName]; ok {
+		return validateDateTimeFunc(lowerName, args)
+	} else if _, ok := arrayFuncMap[lowerName]; ok {
+		return validateArrayFunc(lowerName, args)
 	} else if _, ok := aggFuncMap[lowerName]; ok {
 		return validateAggFunc(lowerName, args)
+	} else if _, ok := analyticFuncMap[lowerName]; ok {
+		return validateAnalyticFunc(lowerName, args)
+	} else if lowerName == "lead" {
+		return fmt.Errorf("lead is not supported because the following events are unknown when the current event is processed.")
 	} else {
 		nf, _, err := parserFuncRuntime.getCustom(funcName)
 		if err != nil {
@@ -325,6 +333,169 @@ func validateOtherFunc(name string, args []Expr) error {
 	return nil
 }
 
+func validateArrayFunc(name string, args []Expr) error {
+	len := len(args)
+	switch name {
+	case "array_concat", "zip":
+		if len == 0 {
+			return fmt.Errorf("The arguments for %s should be at least one.\n", name)
+		}
+	case "object_construct":
+		if len%2 != 0 {
+			return fmt.Errorf("The arguments for object_construct should be key value pairs.")
+		}
+		for i := 0; i < len; i += 2 {
+			if isNumericArg(args[i]) || isTimeArg(args[i]) || isBooleanArg(args[i]) {
+				return produceErrInfo(name, i, "string")
+			}
+		}
+	case "array_contains", "array_position":
+		if err := validateLen(name, 2, len); err != nil {
+			return err
+		}
+	case "array_distinct", "object_keys", "object_values", "unnest":
+		if err := validateLen(name, 1, len); err != nil {
+			return err
+		}
+	case "array_slice":
+		if len != 2 && len != 3 {
+			return fmt.Errorf("The arguments for array_slice should be 2 or 3.")
+		}
+		for i := 1; i < len; i++ {
+			if isFloatArg(args[i]) || isTimeArg(args[i]) || isBooleanArg(args[i]) || isStringArg(args[i]) {
+				return produceErrInfo(name, i, "int")
+			}
+		}
+	case "array_map", "array_filter":
+		if err := validateLen(name, 2, len); err != nil {
+			return err
+		}
+		if _, ok := args[1].(*LambdaExpr); !ok {
+			return produceErrInfo(name, 1, "lambda expression")
+		}
+	}
+	if name != "object_construct" && name != "array_concat" && name != "zip" && len > 0 {
+		if isNumericArg(args[0]) || isTimeArg(args[0]) || isBooleanArg(args[0]) || isStringArg(args[0]) {
+			if strings.HasPrefix(name, "object_") {
+				return produceErrInfo(name, 0, "object")
+			}
+			return produceErrInfo(name, 0, "array")
+		}
+	}
+	return nil
+}
+
+func validateDateTimeFunc(name string, args []Expr) error {
+	len := len(args)
+	// The count of the required arguments, the optional time zone argument can follow
+	required := 0
+	switch name {
+	case "now":
+		return validateLen(name, 0, len)
+	case "convert_tz":
+		if err := validateLen(name, 2, len); err != nil {
+			return err
+		}
+		return validateTimeZoneArg(name, 1, args[1])
+	case "date_add", "date_diff":
+		if err := validateLen(name, 3, len); err != nil {
+			return err
+		}
+		if name == "date_add" && (isFloatArg(args[1]) || isTimeArg(args[1]) || isBooleanArg(args[1]) || isStringArg(args[1])) {
+			return produceErrInfo(name, 1, "int")
+		}
+		return validateTimeUnitArg(name, args[0])
+	case "date_trunc", "extract":
+		required = 2
+	case "to_char", "to_timestamp":
+		required = 2
+	case "day_of_week", "hour_of_day":
+		required = 1
+	}
+	if len < required || len > required+1 {
+		return fmt.Errorf("The arguments for %s should be %d or %d.", name, required, required+1)
+	}
+	if len > required {
+		if err := validateTimeZoneArg(name, required, args[required]); err != nil {
+			return err
+		}
+	}
+	switch name {
+	case "date_trunc", "extract":
+		return validateTimeUnitArg(name, args[0])
+	case "to_char", "to_timestamp":
+		if name == "to_timestamp" && (isNumericArg(args[0]) || isTimeArg(args[0]) || isBooleanArg(args[0])) {
+			return produceErrInfo(name, 0, "string")
+		}
+		if isNumericArg(args[1]) || isTimeArg(args[1]) || isBooleanArg(args[1]) {
+			return produceErrInfo(name, 1, "string")
+		}
+	}
+	return nil
+}
+
+func validateTimeUnitArg(name string, arg Expr) error {
+	if s, ok := arg.(*StringLiteral); ok {
+		if _, err := getTimeUnit(name, s.Val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateTimeZoneArg(name string, index int, arg Expr) error {
+	if isNumericArg(arg) || isTimeArg(arg) || isBooleanArg(arg) {
+		return produceErrInfo(name, index, "string")
+	}
+	if s, ok := arg.(*StringLiteral); ok {
+		if _, err := getLocation(s.Val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateAnalyticFunc(name string, args []Expr) error {
+	len := len(args)
+	switch name {
+	case "lag":
+		if len < 1 || len > 3 {
+			return fmt.Errorf("the arguments for lag should be 1 to 3")
+		}
+		if len > 1 {
+			if isFloatArg(args[1]) || isTimeArg(args[1]) || isBooleanArg(args[1]) || isStringArg(args[1]) {
+				return produceErrInfo(name, 1, "int")
+			}
+			if s, ok := args[1].(*IntegerLiteral); ok && s.Val < 1 {
+				return fmt.Errorf("The offset of lag should be a positive integer.")
+			}
+		}
+	case "latest":
+		if len != 1 && len != 2 {
+			return fmt.Errorf("the arguments for latest should be 1 or 2")
+		}
+	case "changed_col", "had_changed":
+		if name == "changed_col" {
+			if err := validateLen(name, 2, len); err != nil {
+				return err
+			}
+		} else if len < 2 {
+			return fmt.Errorf("the arguments for had_changed should be at least 2")
+		}
+		if isNumericArg(args[0]) || isTimeArg(args[0]) || isStringArg(args[0]) {
+			return produceErrInfo(name, 0, "boolean")
+		}
+	case "acc_sum", "acc_avg":
+		if err := validateLen(name, 1, len); err != nil {
+			return err
+		}
+		if isStringArg(args[0]) || isTimeArg(args[0]) || isBooleanArg(args[0]) {
+			return produceErrInfo(name, 0, "number - float or int")
+		}
+	}
+	return nil
+}
+
 func validateJsonFunc(name string, args []Expr) error {
 	len := len(args)
 	if err := validateLen(name, 2, len); err != nil {
@@ -361,6 +532,37 @@ func validateAggFunc(name string, args []Expr) error {
 		if !isBooleanArg(args[1]) {
 			return produceErrInfo(name, 1, "bool")
 		}
+	case "stddev", "stddevs", "var", "vars", "median":
+		if err := validateLen(name, 1, len); err != nil {
+			return err
+		}
+		if isStringArg(args[0]) || isTimeArg(args[0]) || isBooleanArg(args[0]) {
+			return produceErrInfo(name, 0, "number - float or int")
+		}
+	case "percentile_cont", "percentile_disc":
+		if err := validateLen(name, 2, len); err != nil {
+			return err
+		}
+		if isStringArg(args[0]) || isTimeArg(args[0]) || isBooleanArg(args[0]) {
+			return produceErrInfo(name, 0, "number - float or int")
+		}
+		if !isNumericArg(args[1]) {
+			return produceErrInfo(name, 1, "number literal")
+		}
+		var p float64
+		switch a := args[1].(type) {
+		case *IntegerLiteral:
+			p = float64(a.Val)
+		case *NumberLiteral:
+			p = a.Val
+		}
+		if p < 0 || p > 1 {
+			return fmt.Errorf("The percentile of %s should be between 0 and 1.", name)
+		}
+	case "mode", "first_value", "last_value":
+		if err := validateLen(name, 1, len); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -408,11 +610,13 @@ func isBooleanArg(arg Expr) bool {
 		return true
 	case *BinaryExpr:
 		switch t.OP {
-		case AND, OR, EQ, NEQ, LT, LTE, GT, GTE:
+		case AND, OR, EQ, NEQ, LT, LTE, GT, GTE, IN, NOTIN, BETWEEN, NOTBETWEEN, LIKE, NOTLIKE, ISNULL, ISNOTNULL:
 			return true
 		default:
 			return false
 		}
+	case *NotExpr:
+		return true
 	default:
 		return false
 	}
@@ -466,6 +466,130 @@ func TestFuncValidator(t *testing.T) {
 			stmt: nil,
 			err:  "Expect bool type for 2 parameter of function deduplicate.",
 		},
+		{
+			s:    `SELECT stddev("abc") from tbl`,
+			stmt: nil,
+			err:  "Expect number - float or int type for 1 parameter of function stddev.",
+		},
+		{
+			s:    `SELECT percentile_cont(temp) from tbl`,
+			stmt: nil,
+			err:  "The arguments for percentile_cont should be 2.",
+		},
+		{
+			s:    `SELECT percentile_disc(temp, abc) from tbl`,
+			stmt: nil,
+			err:  "Expect number literal type for 2 parameter of function percentile_disc.",
+		},
+		{
+			s:    `SELECT percentile_cont(temp, 1.5) from tbl`,
+			stmt: nil,
+			err:  "The percentile of percentile_cont should be between 0 and 1.",
+		},
+		{
+			s:    `SELECT mode(temp, 1) from tbl`,
+			stmt: nil,
+			err:  "The arguments for mode should be 1.",
+		},
+		{
+			s:    `SELECT abs(DISTINCT temp) from tbl`,
+			stmt: nil,
+			err:  "DISTINCT is only allowed in the aggregate function with one argument, but found abs.",
+		},
+		{
+			s: `SELECT extract(hour FROM ts) from tbl`,
+			stmt: &SelectStatement{
+				Fields: []Field{
+					{
+						AName: "",
+						Name:  "extract",
+						Expr:  &Call{Name: "extract", Args: []Expr{&StringLiteral{Val: "hour"}, &FieldRef{Name: "ts", StreamName: DEFAULT_STREAM}}},
+					},
+				},
+				Sources: []Source{&Table{Name: "tbl"}},
+			},
+		},
+		{
+			s:    `SELECT extract(decade FROM ts) from tbl`,
+			stmt: nil,
+			err:  "invalid time unit decade for function extract",
+		},
+		{
+			s:    `SELECT date_trunc(dow, ts) from tbl`,
+			stmt: nil,
+			err:  "invalid time unit dow for function date_trunc",
+		},
+		{
+			s:    `SELECT date_add(day, 1.5, ts) from tbl`,
+			stmt: nil,
+			err:  "Expect int type for 2 parameter of function date_add.",
+		},
+		{
+			s:    `SELECT hour_of_day(ts, "Mars/Base") from tbl`,
+			stmt: nil,
+			err:  "invalid time zone Mars/Base",
+		},
+		{
+			s:    `SELECT to_char(ts) from tbl`,
+			stmt: nil,
+			err:  "The arguments for to_char should be 2 or 3.",
+		},
+		{
+			s:    `SELECT now(ts) from tbl`,
+			stmt: nil,
+			err:  "The arguments for now should be 0.",
+		},
+		{
+			s: `SELECT array_map(a, x -> x * 2) from tbl`,
+			stmt: &SelectStatement{
+				Fields: []Field{
+					{
+						AName: "",
+						Name:  "array_map",
+						Expr: &Call{Name: "array_map", Args: []Expr{
+							&FieldRef{Name: "a", StreamName: DEFAULT_STREAM},
+							&LambdaExpr{Param: "x", Body: &BinaryExpr{OP: MUL, LHS: &LambdaParamRef{Name: "x"}, RHS: &IntegerLiteral{Val: 2}}},
+						}},
+					},
+				},
+				Sources: []Source{&Table{Name: "tbl"}},
+			},
+		},
+		{
+			s:    `SELECT array_map(a, 1) from tbl`,
+			stmt: nil,
+			err:  "found \"1\", expected lambda expression like x -> expr in function array_map.",
+		},
+		{
+			s:    `SELECT array_filter(a, x -> x > avg(b)) from tbl`,
+			stmt: nil,
+			err:  "Not allowed to call aggregate functions in lambda expression.",
+		},
+		{
+			s:    `SELECT array_slice(a, "1") from tbl`,
+			stmt: nil,
+			err:  "Expect int type for 2 parameter of function array_slice.",
+		},
+		{
+			s:    `SELECT object_keys(1) from tbl`,
+			stmt: nil,
+			err:  "Expect object type for 1 parameter of function object_keys.",
+		},
+		{
+			s:    `SELECT object_construct("a") from tbl`,
+			stmt: nil,
+			err:  "The arguments for object_construct should be key value pairs.",
+		},
+		{
+			s:    `SELECT unnest(a), unnest(b) from tbl`,
+			stmt: nil,
+			err:  "Only one unnest function is allowed in the select fields.",
+		},
+		{
+			s:    `SELECT a from tbl WHERE array_contains(unnest(a), 1)`,
+			stmt: nil,
+			err:  "The unnest function can only be used as a select field.",
+		},
 	}
 
 	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
@@ -0,0 +1,321 @@
+package xsql
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The date time functions accept the timestamp as the milliseconds since the epoch, the time value or the string
+// in ISO 8601 format. The returned timestamps are the milliseconds since the epoch. The calendar is in UTC unless
+// a time zone is specified by the optional argument or by the offset of the ISO 8601 string.
+var dateTimeFuncMap = map[string]string{"now": "",
+	"convert_tz": "",
+	"date_add":   "", "date_diff": "", "date_trunc": "", "day_of_week": "",
+	"extract":     "",
+	"hour_of_day": "",
+	"to_char":     "", "to_timestamp": "",
+}
+
+// The functions whose first argument is the time unit which can be written as an identifier
+var dateTimeUnitFuncMap = map[string]string{"date_add": "", "date_diff": "", "date_trunc": "", "extract": ""}
+
+var timeUnits = map[string]string{
+	"year":    "year",
+	"quarter": "quarter",
+	"month":   "month",
+	"week":    "week",
+	"day":     "day", "dd": "day",
+	"hour": "hour", "hh": "hour",
+	"minute": "minute", "mi": "minute",
+	"second": "second", "ss": "second",
+	"millisecond": "millisecond", "ms": "millisecond",
+}
+
+// The units which can only be extracted
+var extractUnits = map[string]string{"dow": "dow", "doy": "doy"}
+
+// Cache the loaded locations because loading reads the time zone database
+var locations sync.Map
+
+// Convert the identifier of the time unit to a string literal so that it is not evaluated as a field
+func convertTimeUnitArg(name string, args []Expr) {
+	if _, ok := dateTimeUnitFuncMap[strings.ToLower(name)]; !ok || len(args) == 0 {
+		return
+	}
+	switch a := args[0].(type) {
+	case *FieldRef:
+		if a.StreamName == DEFAULT_STREAM || a.StreamName == "" {
+			args[0] = &StringLiteral{Val: strings.ToLower(a.Name)}
+		}
+	case *TimeLiteral:
+		args[0] = &StringLiteral{Val: strings.ToLower(a.Val.String())}
+	}
+}
+
+func getTimeUnit(name string, arg interface{}) (string, error) {
+	s, ok := arg.(string)
+	if ok {
+		if u, ok := timeUnits[strings.ToLower(s)]; ok {
+			return u, nil
+		}
+		if u, ok := extractUnits[strings.ToLower(s)]; ok && name == "extract" {
+			return u, nil
+		}
+	}
+	return "", fmt.Errorf("invalid time unit %v for function %s", arg, name)
+}
+
+func getLocation(arg interface{}) (*time.Location, error) {
+	name, ok := arg.(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid time zone %v", arg)
+	}
+	if l, ok := locations.Load(name); ok {
+		return l.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %s", name)
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// Convert the argument to time in the location of the optional time zone argument
+func toTime(arg interface{}, tz []interface{}) (time.Time, error) {
+	t, err := common.InterfaceToTime(arg, "")
+	if err != nil {
+		return t, err
+	}
+	if len(tz) > 0 {
+		loc, err := getLocation(tz[0])
+		if err != nil {
+			return t, err
+		}
+		t = t.In(loc)
+	}
+	return t, nil
+}
+
+func dateTimeCall(name string, args []interface{}) (interface{}, bool) {
+	switch name {
+	case "now":
+		return common.GetNowInMilli(), true
+	case "to_timestamp":
+		if args[0] == nil {
+			return nil, true
+		}
+		loc := time.UTC
+		if len(args) > 2 {
+			l, err := getLocation(args[2])
+			if err != nil {
+				return err, false
+			}
+			loc = l
+		}
+		t, err := common.ParseTimeInLocation(common.ToStringAlways(args[0]), common.ToStringAlways(args[1]), loc)
+		if err != nil {
+			return err, false
+		}
+		return common.TimeToUnixMilli(t), true
+	}
+	// The other functions have the timestamp argument
+	tsIndex := 0
+	if _, ok := dateTimeUnitFuncMap[name]; ok {
+		tsIndex = 1
+	}
+	if name == "date_add" || name == "date_diff" {
+		tsIndex = 2
+	}
+	if args[tsIndex] == nil || (name == "date_diff" && args[1] == nil) {
+		return nil, true
+	}
+	var unit string
+	if tsIndex > 0 {
+		u, err := getTimeUnit(name, args[0])
+		if err != nil {
+			return err, false
+		}
+		unit = u
+	}
+	switch name {
+	case "convert_tz":
+		t, err := toTime(args[0], args[1:])
+		if err != nil {
+			return err, false
+		}
+		return t.Format(common.JSISO), true
+	case "date_add":
+		t, err := common.InterfaceToTime(args[2], "")
+		if err != nil {
+			return err, false
+		}
+		n, err := common.ToInt(args[1], common.STRICT)
+		if err != nil {
+			return fmt.Errorf("the 2nd parameter of date_add must be an integer but got %v", args[1]), false
+		}
+		return common.TimeToUnixMilli(addTime(t, unit, n)), true
+	case "date_diff":
+		t1, err := common.InterfaceToTime(args[1], "")
+		if err != nil {
+			return err, false
+		}
+		t2, err := common.InterfaceToTime(args[2], "")
+		if err != nil {
+			return err, false
+		}
+		return diffTime(t1, t2.In(t1.Location()), unit), true
+	case "date_trunc":
+		t, err := toTime(args[1], args[2:])
+		if err != nil {
+			return err, false
+		}
+		return common.TimeToUnixMilli(truncTime(t, unit)), true
+	case "extract":
+		t, err := toTime(args[1], args[2:])
+		if err != nil {
+			return err, false
+		}
+		return extractTime(t, unit), true
+	case "to_char":
+		t, err := toTime(args[0], args[2:])
+		if err != nil {
+			return err, false
+		}
+		if s, err := common.FormatTime(t, common.ToStringAlways(args[1])); err == nil {
+			return s, true
+		} else {
+			return err, false
+		}
+	case "day_of_week":
+		t, err := toTime(args[0], args[1:])
+		if err != nil {
+			return err, false
+		}
+		return int(t.Weekday()), true
+	case "hour_of_day":
+		t, err := toTime(args[0], args[1:])
+		if err != nil {
+			return err, false
+		}
+		return t.Hour(), true
+	default:
+		return fmt.Errorf("unknown function name %s", name), false
+	}
+}
+
+// Truncate the time to the start of the unit in its location. The week starts from Monday
+func truncTime(t time.Time, unit string) time.Time {
+	y, m, d := t.Date()
+	loc := t.Location()
+	switch unit {
+	case "year":
+		return time.Date(y, 1, 1, 0, 0, 0, 0, loc)
+	case "quarter":
+		return time.Date(y, m-(m-1)%3, 1, 0, 0, 0, 0, loc)
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, loc)
+	case "week":
+		return time.Date(y, m, d-(int(t.Weekday())+6)%7, 0, 0, 0, 0, loc)
+	case "day":
+		return time.Date(y, m, d, 0, 0, 0, 0, loc)
+	case "hour":
+		return time.Date(y, m, d, t.Hour(), 0, 0, 0, loc)
+	case "minute":
+		return time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, loc)
+	case "second":
+		return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), 0, loc)
+	default:
+		return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond()/1e6*1e6, loc)
+	}
+}
+
+// Add n units to the time. The year, quarter and month are added by the calendar
+func addTime(t time.Time, unit string, n int) time.Time {
+	switch unit {
+	case "year":
+		return t.AddDate(n, 0, 0)
+	case "quarter":
+		return t.AddDate(0, 3*n, 0)
+	case "month":
+		return t.AddDate(0, n, 0)
+	case "week":
+		return t.AddDate(0, 0, 7*n)
+	case "day":
+		return t.AddDate(0, 0, n)
+	default:
+		return t.Add(time.Duration(n) * unitDuration(unit))
+	}
+}
+
+// Return the count of the whole units from t1 to t2, negative if t2 is before t1
+func diffTime(t1, t2 time.Time, unit string) int64 {
+	switch unit {
+	case "year", "quarter", "month":
+		y1, m1, _ := t1.Date()
+		y2, m2, _ := t2.Date()
+		months := (y2-y1)*12 + int(m2-m1)
+		if months > 0 && t1.AddDate(0, months, 0).After(t2) {
+			months--
+		} else if months < 0 && t1.AddDate(0, months, 0).Before(t2) {
+			months++
+		}
+		switch unit {
+		case "year":
+			return int64(months / 12)
+		case "quarter":
+			return int64(months / 3)
+		}
+		return int64(months)
+	case "week":
+		return int64(t2.Sub(t1) / (7 * 24 * time.Hour))
+	case "day":
+		return int64(t2.Sub(t1) / (24 * time.Hour))
+	default:
+		return int64(t2.Sub(t1) / unitDuration(unit))
+	}
+}
+
+func unitDuration(unit string) time.Duration {
+	switch unit {
+	case "hour":
+		return time.Hour
+	case "minute":
+		return time.Minute
+	case "second":
+		return time.Second
+	default:
+		return time.Millisecond
+	}
+}
+
+func extractTime(t time.Time, unit string) int {
+	switch unit {
+	case "year":
+		return t.Year()
+	case "quarter":
+		return (int(t.Month())-1)/3 + 1
+	case "month":
+		return int(t.Month())
+	case "week":
+		_, w := t.ISOWeek()
+		return w
+	case "day":
+		return t.Day()
+	case "hour":
+		return t.Hour()
+	case "minute":
+		return t.Minute()
+	case "second":
+		return t.Second()
+	case "millisecond":
+		return t.Nanosecond() / 1e6
+	case "dow":
+		return int(t.Weekday())
+	default: // doy
+		return t.YearDay()
+	}
+}
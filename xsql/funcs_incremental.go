@@ -0,0 +1,186 @@
+package xsql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The aggregate functions which can be calculated incrementally by accumulating the values one by one
+var incrementalFuncMap = map[string]string{"avg": "",
+	"count": "",
+	"max":   "", "min": "",
+	"sum": "",
+}
+
+// GetIncrementalAggFuncs returns all the aggregate function calls in the node. If any of them cannot be calculated
+// incrementally, return false
+func GetIncrementalAggFuncs(node Node) ([]*Call, bool) {
+	var (
+		result []*Call
+		valid  = true
+	)
+	WalkFunc(node, func(n Node) {
+		if c, ok := n.(*Call); ok && isAggFunc(c) {
+			if isIncrementalAggFunc(c) {
+				result = append(result, c)
+			} else {
+				valid = false
+			}
+		}
+	})
+	return result, valid
+}
+
+func isIncrementalAggFunc(c *Call) bool {
+	if _, ok := incrementalFuncMap[strings.ToLower(c.Name)]; !ok {
+		return false
+	}
+	return !c.Distinct && len(c.Args) == 1 && !HasAggFuncs(c.Args[0]) && !HasAnalyticFuncs(c.Args[0])
+}
+
+const (
+	accNone = iota
+	accInt
+	accFloat
+	accString
+)
+
+// Accumulator keeps the running result of an incremental aggregate function. The result is the same as calculating
+// the function with all the values at once. All fields are exported to be saved in the checkpoints.
+type Accumulator struct {
+	Name string
+	// The type of the first non-null value, all the other values must be of the same type
+	Kind int
+	// The count of the non-null values
+	Count    int
+	IntSum   int
+	FloatSum float64
+	// The max or min value
+	Value interface{}
+	Err   string
+}
+
+func NewAccumulator(name string) *Accumulator {
+	return &Accumulator{Name: strings.ToLower(name)}
+}
+
+// Add the value of a tuple to the accumulator
+func (a *Accumulator) Add(v interface{}) {
+	if a.Err != "" || v == nil {
+		return
+	}
+	if e, ok := v.(error); ok {
+		a.Err = e.Error()
+		return
+	}
+	a.Count++
+	if a.Name == "count" {
+		return
+	}
+	var kind int
+	switch vt := v.(type) {
+	case int:
+		kind = accInt
+	case int64:
+		kind = accInt
+		v = int(vt)
+	case float64:
+		kind = accFloat
+	case string:
+		kind = accString
+	default:
+		a.Err = fmt.Sprintf("run %s function error: found invalid arg %[2]T(%[2]v)", a.Name, v)
+		return
+	}
+	if a.Kind == accNone {
+		if kind == accString && a.Name != "max" && a.Name != "min" {
+			a.Err = fmt.Sprintf("run %s function error: found invalid arg %[2]T(%[2]v)", a.Name, v)
+			return
+		}
+		a.Kind = kind
+		a.Value = v
+	} else if a.Kind != kind {
+		a.Err = fmt.Sprintf("requires %s but found %[2]T(%[2]v)", kindName(a.Kind), v)
+		return
+	}
+	switch a.Name {
+	case "sum", "avg":
+		if kind == accInt {
+			a.IntSum += v.(int)
+		} else {
+			a.FloatSum += v.(float64)
+		}
+	case "max":
+		if compareAccValue(v, a.Value) > 0 {
+			a.Value = v
+		}
+	case "min":
+		if compareAccValue(v, a.Value) < 0 {
+			a.Value = v
+		}
+	}
+}
+
+// Result returns the result of the aggregate function. If there is any error during the accumulation, return the error
+func (a *Accumulator) Result() interface{} {
+	if a.Err != "" {
+		return errors.New(a.Err)
+	}
+	switch a.Name {
+	case "count":
+		return a.Count
+	case "avg":
+		switch a.Kind {
+		case accInt:
+			return a.IntSum / a.Count
+		case accFloat:
+			return a.FloatSum / float64(a.Count)
+		}
+		return 0
+	case "sum":
+		switch a.Kind {
+		case accInt:
+			return a.IntSum
+		case accFloat:
+			return a.FloatSum
+		}
+		return nil
+	default:
+		return a.Value
+	}
+}
+
+func kindName(kind int) string {
+	switch kind {
+	case accInt:
+		return "int"
+	case accFloat:
+		return "float64"
+	default:
+		return "string"
+	}
+}
+
+// Compare the values of the same kind
+func compareAccValue(a, b interface{}) int {
+	switch at := a.(type) {
+	case int:
+		bt := b.(int)
+		if at > bt {
+			return 1
+		} else if at < bt {
+			return -1
+		}
+	case float64:
+		bt := b.(float64)
+		if at > bt {
+			return 1
+		} else if at < bt {
+			return -1
+		}
+	case string:
+		return strings.Compare(at, b.(string))
+	}
+	return 0
+}
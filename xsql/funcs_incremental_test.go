@@ -0,0 +1,102 @@
+package xsql
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"reflect"
+	"testing"
+)
+
+func TestAccumulator(t *testing.T) {
+	var tests = []struct {
+		name   string
+		values []interface{}
+		r      interface{}
+		err    string
+	}{
+		{
+			name:   "count",
+			values: []interface{}{1, nil, "a", 2.5},
+			r:      3,
+		}, {
+			name:   "sum",
+			values: []interface{}{1, nil, 2, 3},
+			r:      6,
+		}, {
+			name:   "sum",
+			values: []interface{}{1.5, 2.5},
+			r:      float64(4),
+		}, {
+			name:   "sum",
+			values: []interface{}{nil, nil},
+			r:      nil,
+		}, {
+			name:   "sum",
+			values: []interface{}{1, 2.5},
+			err:    "requires int but found float64(2.5)",
+		}, {
+			name:   "sum",
+			values: []interface{}{"a"},
+			err:    "run sum function error: found invalid arg string(a)",
+		}, {
+			name:   "avg",
+			values: []interface{}{1, 2, nil},
+			r:      1,
+		}, {
+			name:   "avg",
+			values: []interface{}{1.0, 2.0},
+			r:      1.5,
+		}, {
+			name:   "avg",
+			values: []interface{}{nil},
+			r:      0,
+		}, {
+			name:   "max",
+			values: []interface{}{3, nil, 5, 4},
+			r:      5,
+		}, {
+			name:   "max",
+			values: []interface{}{"b", "c", "a"},
+			r:      "c",
+		}, {
+			name:   "min",
+			values: []interface{}{3.5, 1.5, 2.5},
+			r:      1.5,
+		}, {
+			name:   "min",
+			values: []interface{}{"b", "c", "a"},
+			r:      "a",
+		}, {
+			name:   "min",
+			values: []interface{}{nil},
+			r:      nil,
+		}, {
+			name:   "max",
+			values: []interface{}{"a", 1},
+			err:    "requires string but found int(1)",
+		},
+	}
+	_, afv := NewAggregateFunctionValuers(nil)
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		acc := NewAccumulator(tt.name)
+		for _, v := range tt.values {
+			acc.Add(v)
+		}
+		r := acc.Result()
+		var err error
+		if e, ok := r.(error); ok {
+			err, r = e, nil
+		}
+		if !reflect.DeepEqual(tt.err, common.Errstring(err)) {
+			t.Errorf("%d. %s(%v) error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.name, tt.values, tt.err, err)
+		} else if !reflect.DeepEqual(tt.r, r) {
+			t.Errorf("%d. %s(%v)\n\nresult mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.name, tt.values, tt.r, r)
+		}
+		// Must be the same as calculating all the values at once
+		exp, _ := afv.Call(tt.name, []interface{}{tt.values})
+		if !reflect.DeepEqual(fmt.Sprintf("%v", exp), fmt.Sprintf("%v", acc.Result())) {
+			t.Errorf("%d. %s(%v)\n\nresult differs from the aggregate function:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.name, tt.values, exp, acc.Result())
+		}
+	}
+}
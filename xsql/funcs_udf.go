@@ -0,0 +1,215 @@
+package xsql
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/xstream/api"
+	"strings"
+	"sync"
+)
+
+// The max depth of the sql functions calling each other
+const maxSqlFuncDepth = 32
+
+type sqlFuncDepthKey struct{}
+
+// sqlFuncContext passes the depth of the sql function calls to the functions called in the body. The error of
+// exceeding the max depth is shared by all the levels so that it is returned as is instead of wrapped by each level.
+type sqlFuncContext struct {
+	api.StreamContext
+	depth    int
+	exceeded *error
+}
+
+func (c *sqlFuncContext) Value(key interface{}) interface{} {
+	if _, ok := key.(sqlFuncDepthKey); ok {
+		return c
+	}
+	return c.StreamContext.Value(key)
+}
+
+// sqlFunc is the user-defined function whose body is a sql expression of the parameters. An aggregate sql function
+// evaluates the aggregate functions in the body over the values of the parameters in the group.
+type sqlFunc struct {
+	name   string
+	params []string
+	body   Expr
+	isAgg  bool
+
+	once     sync.Once
+	runtime  *funcRuntime
+	depth    int
+	exceeded *error
+}
+
+// NewSqlFunction parses the body of the user-defined function of the sql language
+func NewSqlFunction(stmt *FunctionStmt) (api.Function, error) {
+	p := NewParser(strings.NewReader(stmt.Body))
+	body, err := p.ParseExpr()
+	if err != nil {
+		return nil, fmt.Errorf("invalid body of function %s: %v", stmt.Name, err)
+	}
+	if tok, lit := p.scanIgnoreWhitespace(); tok != EOF {
+		return nil, fmt.Errorf("invalid body of function %s: found %q, expected EOF.", stmt.Name, lit)
+	}
+	c := &bodyChecker{name: stmt.Name, params: stmt.Params}
+	Walk(c, body)
+	if c.err != nil {
+		return nil, c.err
+	}
+	isAgg := HasAggFuncs(body)
+	switch stmt.FuncType {
+	case FUNC_TYPE_SCALAR:
+		if isAgg {
+			return nil, fmt.Errorf("scalar function %s cannot call aggregate functions", stmt.Name)
+		}
+	case FUNC_TYPE_AGGREGATE:
+		if !isAgg {
+			return nil, fmt.Errorf("aggregate function %s must call aggregate functions", stmt.Name)
+		}
+	}
+	return &sqlFunc{
+		name:   stmt.Name,
+		params: stmt.Params,
+		body:   body,
+		isAgg:  isAgg,
+	}, nil
+}
+
+// GetFunctionCalls returns the names of the functions called in the sql or the expression. The sql is only scanned
+// without validating the called functions so that it works even if the functions do not exist yet or call each other.
+func GetFunctionCalls(sql string) []string {
+	var (
+		s       = NewScanner(strings.NewReader(sql))
+		calls   []string
+		prevTok Token
+		prevLit string
+	)
+	for {
+		tok, lit := s.Scan()
+		switch tok {
+		case EOF:
+			return calls
+		case WS:
+			continue
+		case LPAREN:
+			if prevTok == IDENT {
+				calls = append(calls, prevLit)
+			}
+		}
+		prevTok, prevLit = tok, lit
+	}
+}
+
+// bodyChecker verifies that the body of the sql function only refers to its parameters
+type bodyChecker struct {
+	name   string
+	params []string
+	err    error
+}
+
+func (c *bodyChecker) Visit(n Node) Visitor {
+	if c.err != nil {
+		return nil
+	}
+	switch e := n.(type) {
+	case *BinaryExpr:
+		// The right side of the json arrow is the key of the object instead of a parameter
+		if e.OP == ARROW {
+			Walk(c, e.LHS)
+			return nil
+		}
+	case *FieldRef:
+		if !c.isParam(e) {
+			c.err = fmt.Errorf("unknown parameter %s in the body of function %s", e.Name, c.name)
+		}
+	case *Wildcard:
+		c.err = fmt.Errorf("wildcard is not allowed in the body of function %s", c.name)
+	case *MetaRef:
+		c.err = fmt.Errorf("meta %s is not allowed in the body of function %s", e.Name, c.name)
+	case *Call:
+		if _, ok := analyticFuncMap[strings.ToLower(e.Name)]; ok {
+			c.err = fmt.Errorf("analytic function %s is not allowed in the body of function %s", e.Name, c.name)
+		}
+	}
+	return c
+}
+
+func (c *bodyChecker) isParam(f *FieldRef) bool {
+	if f.StreamName != DEFAULT_STREAM && f.StreamName != "" {
+		return false
+	}
+	for _, p := range c.params {
+		if strings.EqualFold(p, f.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *sqlFunc) Validate(args []interface{}) error {
+	return validateLen(f.name, len(f.params), len(args))
+}
+
+func (f *sqlFunc) IsAggregate() bool {
+	return f.isAgg
+}
+
+func (f *sqlFunc) Exec(args []interface{}, ctx api.FunctionContext) (interface{}, bool) {
+	f.once.Do(func() {
+		f.depth, f.exceeded = 1, new(error)
+		if ctx == nil {
+			f.runtime = NewFuncRuntime(nil, FuncRegisters)
+			return
+		}
+		if c, ok := ctx.Value(sqlFuncDepthKey{}).(*sqlFuncContext); ok {
+			f.depth, f.exceeded = c.depth+1, c.exceeded
+		}
+		f.runtime = NewFuncRuntime(&sqlFuncContext{StreamContext: ctx, depth: f.depth, exceeded: f.exceeded}, FuncRegisters)
+	})
+	if f.depth > maxSqlFuncDepth {
+		*f.exceeded = fmt.Errorf("run %s function error: the sql functions call each other more than %d levels", f.name, maxSqlFuncDepth)
+		return *f.exceeded, false
+	}
+	if f.depth == 1 {
+		*f.exceeded = nil
+	}
+	fv, afv := NewAggregateFunctionValuers(f.runtime)
+	var ve *ValuerEval
+	if f.isAgg {
+		// Each argument is the values of the parameter in the group, evaluate the body over the rows of the parameters
+		var tuples []Tuple
+		for i, arg := range args {
+			values, ok := arg.([]interface{})
+			if !ok {
+				return fmt.Errorf("run %s function error: expect the values of the group but found %[2]T(%[2]v)", f.name, arg), false
+			}
+			for j, v := range values {
+				if j >= len(tuples) {
+					tuples = append(tuples, Tuple{Message: make(Message, len(f.params))})
+				}
+				tuples[j].Message[strings.ToLower(f.params[i])] = v
+			}
+		}
+		data := WindowTuplesSet{{Tuples: tuples}}
+		afv.SetData(data)
+		first := &Tuple{Message: Message{}}
+		if len(tuples) > 0 {
+			first = &tuples[0]
+		}
+		ve = &ValuerEval{Valuer: MultiAggregateValuer(data, fv, first, fv, afv)}
+	} else {
+		m := make(Message, len(f.params))
+		for i, p := range f.params {
+			m[strings.ToLower(p)] = args[i]
+		}
+		ve = &ValuerEval{Valuer: MultiValuer(m, fv)}
+	}
+	r := ve.Eval(f.body)
+	if e, ok := r.(error); ok {
+		if *f.exceeded != nil {
+			return *f.exceeded, false
+		}
+		return fmt.Errorf("run %s function error: %v", f.name, e), false
+	}
+	return r, true
+}
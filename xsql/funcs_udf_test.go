@@ -0,0 +1,63 @@
+package xsql
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/xstream/api"
+	"github.com/emqx/kuiper/xstream/contexts"
+	"reflect"
+	"testing"
+)
+
+// loopRegister provides the sql functions calling each other without checking the cycles
+type loopRegister map[string]string
+
+func (r loopRegister) HasFunction(name string) bool {
+	_, ok := r[name]
+	return ok
+}
+
+func (r loopRegister) Function(name string) (api.Function, error) {
+	return &sqlFunc{
+		name:   name,
+		params: []string{"a"},
+		body:   &Call{Name: r[name], Args: []Expr{&FieldRef{Name: "a", StreamName: DEFAULT_STREAM}}},
+	}, nil
+}
+
+func TestSqlFuncDepth(t *testing.T) {
+	saved := FuncRegisters
+	defer func() {
+		FuncRegisters = saved
+	}()
+	FuncRegisters = []FunctionRegister{loopRegister{"ping": "pong", "pong": "ping", "self": "self", "leaf": "abs"}}
+	var tests = []struct {
+		name string
+		r    interface{}
+		err  string
+	}{
+		{
+			name: "leaf",
+			r:    1,
+		}, {
+			name: "self",
+			err:  "run self function error: the sql functions call each other more than 32 levels",
+		}, {
+			name: "ping",
+			err:  "run ping function error: the sql functions call each other more than 32 levels",
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		f, _ := FuncRegisters[0].Function(tt.name)
+		r, ok := f.Exec([]interface{}{-1}, contexts.NewDefaultFuncContext(contexts.Background(), 0))
+		var err string
+		if !ok {
+			err = common.Errstring(r.(error))
+			r = nil
+		}
+		if tt.err != err || !reflect.DeepEqual(tt.r, r) {
+			t.Errorf("%d. %s\n\nresult mismatch:\n\nexp=%v %s\n\ngot=%v %s\n\n", i, tt.name, tt.r, tt.err, r, err)
+		}
+	}
+}
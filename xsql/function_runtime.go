@@ -1,8 +1,10 @@
 package xsql
 
 import (
+	"fmt"
 	"github.com/emqx/kuiper/xstream/api"
 	"github.com/emqx/kuiper/xstream/contexts"
+	"strings"
 	"sync"
 )
 
@@ -11,6 +13,7 @@ import (
 type funcRuntime struct {
 	sync.Mutex
 	regs          map[string]*funcReg
+	analytics     map[int]api.FunctionContext
 	parentCtx     api.StreamContext
 	funcRegisters []FunctionRegister
 }
@@ -28,36 +31,71 @@ func NewFuncRuntime(ctx api.StreamContext, registers []FunctionRegister) *funcRu
 }
 
 func (fp *funcRuntime) getCustom(name string) (api.Function, api.FunctionContext, error) {
+	fp.Lock()
+	if reg, ok := fp.regs[name]; ok {
+		fp.Unlock()
+		return reg.ins, reg.ctx, nil
+	}
+	fp.Unlock()
+	var (
+		nf  api.Function
+		err error
+	)
+	// Check service extension and plugin extension if set. Create the function without the lock because creating
+	// a user-defined function parses its body which may call other custom functions.
+	for _, r := range fp.funcRegisters {
+		if r.HasFunction(name) {
+			nf, err = r.Function(name)
+			if err != nil {
+				return nil, nil, err
+			}
+			break
+		}
+	}
+	if nf == nil {
+		return nil, nil, NotFoundErr
+	}
 	fp.Lock()
 	defer fp.Unlock()
 	if fp.regs == nil {
 		fp.regs = make(map[string]*funcReg)
 	}
-	if reg, ok := fp.regs[name]; !ok {
-		var (
-			nf  api.Function
-			err error
-		)
-		// Check service extension and plugin extension if set
-		for _, r := range fp.funcRegisters {
-			if r.HasFunction(name) {
-				nf, err = r.Function(name)
-				if err != nil {
-					return nil, nil, err
-				}
-				break
-			}
-		}
-		if nf == nil {
-			return nil, nil, NotFoundErr
-		}
-		fctx := contexts.NewDefaultFuncContext(fp.parentCtx, len(fp.regs))
-		fp.regs[name] = &funcReg{
-			ins: nf,
-			ctx: fctx,
-		}
-		return nf, fctx, nil
-	} else {
+	if reg, ok := fp.regs[name]; ok {
 		return reg.ins, reg.ctx, nil
 	}
+	fctx := contexts.NewDefaultFuncContext(fp.parentCtx, len(fp.regs))
+	fp.regs[name] = &funcReg{
+		ins: nf,
+		ctx: fctx,
+	}
+	return nf, fctx, nil
+}
+
+// Remove the cached instance of the custom function
+func (fp *funcRuntime) remove(name string) {
+	fp.Lock()
+	defer fp.Unlock()
+	for n := range fp.regs {
+		if strings.EqualFold(n, name) {
+			delete(fp.regs, n)
+		}
+	}
+}
+
+// Get the function context of the analytic function call by its id in the statement
+func (fp *funcRuntime) getAnalytic(funcId int) (api.FunctionContext, error) {
+	fp.Lock()
+	defer fp.Unlock()
+	if fp.parentCtx == nil {
+		return nil, fmt.Errorf("analytic function is not supported without the stream context")
+	}
+	if fp.analytics == nil {
+		fp.analytics = make(map[int]api.FunctionContext)
+	}
+	fctx, ok := fp.analytics[funcId]
+	if !ok {
+		fctx = contexts.NewAnalyticFuncContext(fp.parentCtx, funcId)
+		fp.analytics[funcId] = fctx
+	}
+	return fctx, nil
 }
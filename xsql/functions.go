@@ -2,8 +2,10 @@ package xsql
 
 import (
 	"errors"
+	"fmt"
 	"github.com/emqx/kuiper/xstream/api"
 	"strings"
+	"sync"
 )
 
 // ONLY use NewFunctionValuer function to initialize
@@ -38,6 +40,24 @@ var aggFuncMap = map[string]string{"avg": "",
 	"sum":         "",
 	"collect":     "",
 	"deduplicate": "",
+	"stddev":      "", "stddevs": "", "var": "", "vars": "",
+	"median": "", "percentile_cont": "", "percentile_disc": "",
+	"mode":        "",
+	"first_value": "", "last_value": "",
+}
+
+// The custom aggregate functions which are found when planning the rules. The map is guarded by customAggLock because
+// the functions can be deleted by the rest api while the rules are being planned.
+var (
+	customAggFuncMap = map[string]string{}
+	customAggLock    sync.RWMutex
+)
+
+func isCustomAggFunc(lowerName string) bool {
+	customAggLock.RLock()
+	defer customAggLock.RUnlock()
+	_, ok := customAggFuncMap[lowerName]
+	return ok
 }
 
 var funcWithAsteriskSupportMap = map[string]string{
@@ -102,8 +122,14 @@ func (fv *FunctionValuer) Call(name string, args []interface{}) (interface{}, bo
 		return jsonCall(lowerName, args)
 	} else if _, ok := otherFuncMap[lowerName]; ok {
 		return otherCall(lowerName, args)
+	} else if _, ok := dateTimeFuncMap[lowerName]; ok {
+		return dateTimeCall(lowerName, args)
+	} else if _, ok := arrayFuncMap[lowerName]; ok {
+		return arrayCall(lowerName, args)
 	} else if _, ok := aggFuncMap[lowerName]; ok {
 		return nil, false
+	} else if _, ok := analyticFuncMap[lowerName]; ok {
+		return fmt.Errorf("analytic function %s must be evaluated with its states", name), false
 	} else {
 		nf, fctx, err := fv.runtime.getCustom(name)
 		switch err {
@@ -143,10 +169,24 @@ func IsAggStatement(stmt *SelectStatement) bool {
 	return r
 }
 
+// IsBuiltinFunc returns true if the name is a built-in function which cannot be defined by the users
+func IsBuiltinFunc(name string) bool {
+	lowerName := strings.ToLower(name)
+	for _, m := range []map[string]string{mathFuncMap, strFuncMap, convFuncMap, hashFuncMap, jsonFuncMap, otherFuncMap,
+		dateTimeFuncMap, arrayFuncMap, aggFuncMap, analyticFuncMap} {
+		if _, ok := m[lowerName]; ok {
+			return true
+		}
+	}
+	return false
+}
+
 func isAggFunc(f *Call) bool {
 	fn := strings.ToLower(f.Name)
 	if _, ok := aggFuncMap[fn]; ok {
 		return true
+	} else if isCustomAggFunc(fn) {
+		return true
 	} else if _, ok := strFuncMap[fn]; ok {
 		return false
 	} else if _, ok := convFuncMap[fn]; ok {
@@ -155,13 +195,21 @@ func isAggFunc(f *Call) bool {
 		return false
 	} else if _, ok := otherFuncMap[fn]; ok {
 		return false
+	} else if _, ok := dateTimeFuncMap[fn]; ok {
+		return false
+	} else if _, ok := arrayFuncMap[fn]; ok {
+		return false
 	} else if _, ok := mathFuncMap[fn]; ok {
 		return false
+	} else if _, ok := analyticFuncMap[fn]; ok {
+		return false
 	} else {
 		if nf, _, err := parserFuncRuntime.getCustom(f.Name); err == nil {
 			if nf.IsAggregate() {
 				//Add cache
-				aggFuncMap[fn] = ""
+				customAggLock.Lock()
+				customAggFuncMap[fn] = ""
+				customAggLock.Unlock()
 				return true
 			}
 		}
@@ -3,6 +3,7 @@ package xsql
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
 	"strconv"
 	"strings"
@@ -47,6 +48,15 @@ const (
 	GT  // >
 	GTE // >=
 
+	IN         // IN
+	NOTIN      // NOT IN
+	BETWEEN    // BETWEEN
+	NOTBETWEEN // NOT BETWEEN
+	LIKE       // LIKE
+	NOTLIKE    // NOT LIKE
+	ISNULL     // IS NULL
+	ISNOTNULL  // IS NOT NULL
+
 	SUBSET //[
 	ARROW  //->
 
@@ -83,6 +93,11 @@ const (
 	ASC
 	DESC
 	FILTER
+	DISTINCT
+	LIMIT
+	OFFSET
+	OVER
+	PARTITION
 	CASE
 	WHEN
 	THEN
@@ -92,6 +107,10 @@ const (
 	TRUE
 	FALSE
 
+	NOT
+	IS
+	NULL
+
 	CREATE
 	DROP
 	EXPLAIN
@@ -101,6 +120,8 @@ const (
 	TABLE
 	STREAMS
 	TABLES
+	FUNCTION
+	FUNCTIONS
 	WITH
 
 	XBIGINT
@@ -121,12 +142,17 @@ const (
 	TIMESTAMP
 	TIMESTAMP_FORMAT
 	RETAIN_SIZE
+	SCHEMAID
+	KIND
+	LANGUAGE
 
 	DD
 	HH
 	MI
 	SS
 	MS
+
+	DURATION // 30s
 )
 
 var tokens = []string{
@@ -155,6 +181,15 @@ var tokens = []string{
 	GT:  ">",
 	GTE: ">=",
 
+	IN:         "IN",
+	NOTIN:      "NOT IN",
+	BETWEEN:    "BETWEEN",
+	NOTBETWEEN: "NOT BETWEEN",
+	LIKE:       "LIKE",
+	NOTLIKE:    "NOT LIKE",
+	ISNULL:     "IS NULL",
+	ISNOTNULL:  "IS NOT NULL",
+
 	SUBSET: "[]",
 	ARROW:  "->",
 
@@ -185,16 +220,22 @@ var tokens = []string{
 	ASC:    "ASC",
 	DESC:   "DESC",
 
-	CREATE:   "CREATE",
-	DROP:     "RROP",
-	EXPLAIN:  "EXPLAIN",
-	DESCRIBE: "DESCRIBE",
-	SHOW:     "SHOW",
-	STREAM:   "STREAM",
-	TABLE:    "TABLE",
-	STREAMS:  "STREAMS",
-	TABLES:   "TABLES",
-	WITH:     "WITH",
+	DISTINCT: "DISTINCT",
+	LIMIT:    "LIMIT",
+	OFFSET:   "OFFSET",
+
+	CREATE:    "CREATE",
+	DROP:      "RROP",
+	EXPLAIN:   "EXPLAIN",
+	DESCRIBE:  "DESCRIBE",
+	SHOW:      "SHOW",
+	STREAM:    "STREAM",
+	TABLE:     "TABLE",
+	STREAMS:   "STREAMS",
+	TABLES:    "TABLES",
+	FUNCTION:  "FUNCTION",
+	FUNCTIONS: "FUNCTIONS",
+	WITH:      "WITH",
 
 	XBIGINT:   "BIGINT",
 	XFLOAT:    "FLOAT",
@@ -214,17 +255,25 @@ var tokens = []string{
 	TIMESTAMP:         "TIMESTAMP",
 	TIMESTAMP_FORMAT:  "TIMESTAMP_FORMAT",
 	RETAIN_SIZE:       "RETAIN_SIZE",
+	SCHEMAID:          "SCHEMAID",
+	KIND:              "KIND",
+	LANGUAGE:          "LANGUAGE",
 
 	AND:   "AND",
 	OR:    "OR",
 	TRUE:  "TRUE",
 	FALSE: "FALSE",
+	NOT:   "NOT",
+	IS:    "IS",
+	NULL:  "NULL",
 
 	DD: "DD",
 	HH: "HH",
 	MI: "MI",
 	SS: "SS",
 	MS: "MS",
+
+	DURATION: "DURATION",
 }
 
 func (tok Token) String() string {
@@ -236,6 +285,8 @@ func (tok Token) String() string {
 
 type Scanner struct {
 	r *bufio.Reader
+	// Scan the integers followed by a time unit like 30s as durations. It is only set where a time interval is expected.
+	durations bool
 }
 
 func NewScanner(r io.Reader) *Scanner {
@@ -389,6 +440,18 @@ func (s *Scanner) ScanIdent() (tok Token, lit string) {
 		return AND, lit
 	case "OR":
 		return OR, lit
+	case "NOT":
+		return NOT, lit
+	case "IN":
+		return IN, lit
+	case "BETWEEN":
+		return BETWEEN, lit
+	case "LIKE":
+		return LIKE, lit
+	case "IS":
+		return IS, lit
+	case "NULL":
+		return NULL, lit
 	case "GROUP":
 		return GROUP, lit
 	case "HAVING":
@@ -403,6 +466,16 @@ func (s *Scanner) ScanIdent() (tok Token, lit string) {
 		return ASC, lit
 	case "FILTER":
 		return FILTER, lit
+	case "DISTINCT":
+		return DISTINCT, lit
+	case "LIMIT":
+		return LIMIT, lit
+	case "OFFSET":
+		return OFFSET, lit
+	case "OVER":
+		return OVER, lit
+	case "PARTITION":
+		return PARTITION, lit
 	case "INNER":
 		return INNER, lit
 	case "LEFT":
@@ -445,6 +518,10 @@ func (s *Scanner) ScanIdent() (tok Token, lit string) {
 		return TABLE, lit
 	case "TABLES":
 		return TABLES, lit
+	case "FUNCTION":
+		return FUNCTION, lit
+	case "FUNCTIONS":
+		return FUNCTIONS, lit
 	case "WITH":
 		return WITH, lit
 	case "BIGINT":
@@ -485,6 +562,12 @@ func (s *Scanner) ScanIdent() (tok Token, lit string) {
 		return TIMESTAMP_FORMAT, lit
 	case "RETAIN_SIZE":
 		return RETAIN_SIZE, lit
+	case "SCHEMAID":
+		return SCHEMAID, lit
+	case "KIND":
+		return KIND, lit
+	case "LANGUAGE":
+		return LANGUAGE, lit
 	case "DD":
 		return DD, lit
 	case "HH":
@@ -567,9 +650,56 @@ func (s *Scanner) ScanNumber(startWithDot bool, isNeg bool) (tok Token, lit stri
 	}
 	if isNum || startWithDot {
 		return NUMBER, buf.String()
-	} else {
-		return INTEGER, buf.String()
 	}
+	if s.durations {
+		if unit := s.peekDurationUnit(); unit != "" {
+			for range unit {
+				s.read()
+			}
+			return DURATION, buf.String() + unit
+		}
+	}
+	return INTEGER, buf.String()
+}
+
+// peekDurationUnit returns the time unit right after the scanned integer without consuming it. The letters which are
+// not a time unit are left to be scanned as an identifier.
+func (s *Scanner) peekDurationUnit() string {
+	b, _ := s.r.Peek(3)
+	n := 0
+	for n < len(b) && isLetter(rune(b[n])) {
+		n++
+	}
+	if n == 0 || (n < len(b) && (isDigit(rune(b[n])) || b[n] == '_')) {
+		return ""
+	}
+	unit := string(b[:n])
+	if _, ok := durationUnits[strings.ToLower(unit)]; !ok {
+		return ""
+	}
+	return unit
+}
+
+// The time units of the duration literal in milliseconds
+var durationUnits = map[string]int{
+	"ms": 1,
+	"s":  1000,
+	"m":  60 * 1000,
+	"h":  60 * 60 * 1000,
+	"d":  24 * 60 * 60 * 1000,
+}
+
+// Convert the duration literal like 30s to milliseconds
+func durationToMilli(lit string) (int, error) {
+	i := strings.IndexFunc(lit, isLetter)
+	if i < 0 {
+		return 0, fmt.Errorf("found %q, invalid duration value.", lit)
+	}
+	val, err := strconv.Atoi(lit[:i])
+	if err != nil {
+		return 0, fmt.Errorf("found %q, invalid duration value.", lit)
+	}
+	return val * durationUnits[strings.ToLower(lit[i:])], nil
 }
 
 func (s *Scanner) ScanBackquoteIdent() (tok Token, lit string) {
@@ -664,7 +794,7 @@ func (tok Token) allowedSourceToken() bool {
 	return tok == IDENT || tok == DIV || tok == HASH || tok == ADD
 }
 
-//Allowed special field name token
+// Allowed special field name token
 func (tok Token) allowedSFNToken() bool { return tok == DOT }
 
 func (tok Token) Precedence() int {
@@ -673,12 +803,14 @@ func (tok Token) Precedence() int {
 		return 1
 	case AND:
 		return 2
-	case EQ, NEQ, LT, LTE, GT, GTE:
+	case NOT:
 		return 3
-	case ADD, SUB, BITWISE_OR, BITWISE_XOR:
+	case EQ, NEQ, LT, LTE, GT, GTE, IN, NOTIN, BETWEEN, NOTBETWEEN, LIKE, NOTLIKE, ISNULL, ISNOTNULL:
 		return 4
-	case MUL, DIV, MOD, BITWISE_AND, SUBSET, ARROW:
+	case ADD, SUB, BITWISE_OR, BITWISE_XOR:
 		return 5
+	case MUL, DIV, MOD, BITWISE_AND, SUBSET, ARROW:
+		return 6
 	}
 	return 0
 }
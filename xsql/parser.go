@@ -24,6 +24,19 @@ type Parser struct {
 		lit string
 	}
 	inmeta bool
+	// The common table expressions defined in the WITH clause of the current statement
+	ctes map[string]*cte
+	// The id of the next analytic function call in the current statement
+	funcId int
+	// The parameters of the enclosing lambda expressions
+	lambdaParams []string
+	// The lowercase names of the functions which are not created yet. They are not validated.
+	pendingFuncs map[string]bool
+}
+
+type cte struct {
+	stmt *SelectStatement
+	used bool
 }
 
 func (p *Parser) parseCondition() (Expr, error) {
@@ -107,14 +120,56 @@ func (p *Parser) ParseQueries() (SelectStatements, error) {
 }
 
 func (p *Parser) Parse() (*SelectStatement, error) {
+	if tok, _ := p.scanIgnoreWhitespace(); tok == EOF {
+		return nil, nil
+	}
+	p.unscan()
+
+	p.ctes = make(map[string]*cte)
+	p.funcId = 0
+	if err := p.parseWith(); err != nil {
+		return nil, err
+	}
+
+	selects, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+
+	for name, c := range p.ctes {
+		if !c.used {
+			return nil, fmt.Errorf("common table expression %s is not used.", name)
+		}
+	}
+
+	if tok, lit := p.scanIgnoreWhitespace(); tok == SEMICOLON {
+		p.unscan()
+		return selects, nil
+	} else if tok != EOF {
+		return nil, fmt.Errorf("found %q, expected EOF.", lit)
+	}
+
+	if err := Validate(selects); err != nil {
+		return nil, err
+	}
+
+	return selects, nil
+}
+
+// Parse the select statement without the trailing tokens, so that it can be used as a subquery
+func (p *Parser) parseSelect() (*SelectStatement, error) {
 	selects := &SelectStatement{}
 
-	if tok, lit := p.scanIgnoreWhitespace(); tok == EOF {
-		return nil, nil
-	} else if tok != SELECT {
+	if tok, lit := p.scanIgnoreWhitespace(); tok != SELECT {
 		return nil, fmt.Errorf("Found %q, Expected SELECT.\n", lit)
 	}
 
+	if tok, _ := p.scanIgnoreWhitespace(); tok == DISTINCT {
+		selects.Distinct = true
+	} else {
+		p.unscan()
+	}
+
 	if fields, err := p.parseFields(); err != nil {
 		return nil, err
 	} else {
@@ -130,6 +185,12 @@ func (p *Parser) Parse() (*SelectStatement, error) {
 	if joins, err := p.parseJoins(); err != nil {
 		return nil, err
 	} else {
+		if sq, ok := selects.Sources[0].(*SubQuery); ok && joins != nil {
+			return nil, fmt.Errorf("subquery %s cannot be used with join.", sq.Alias)
+		}
+		if len(selects.Sources) > 1 && joins != nil {
+			return nil, fmt.Errorf("the union of sources cannot be used with join.")
+		}
 		selects.Joins = joins
 	}
 
@@ -159,18 +220,60 @@ func (p *Parser) Parse() (*SelectStatement, error) {
 		selects.SortFields = sorts
 	}
 
-	if tok, lit := p.scanIgnoreWhitespace(); tok == SEMICOLON {
+	if limit, err := p.parseLimit(); err != nil {
+		return nil, err
+	} else {
+		selects.Limit = limit
+	}
+
+	return selects, nil
+}
+
+// Parse the common table expressions in the WITH clause. Each expression can be referred by the later expressions
+// and the main statement as a source
+func (p *Parser) parseWith() error {
+	if tok, _ := p.scanIgnoreWhitespace(); tok != WITH {
 		p.unscan()
-		return selects, nil
-	} else if tok != EOF {
-		return nil, fmt.Errorf("found %q, expected EOF.", lit)
+		return nil
+	}
+	for {
+		tok, name := p.scanIgnoreWhitespace()
+		if tok != IDENT {
+			return fmt.Errorf("found %q, expected the name of the common table expression.", name)
+		}
+		if _, ok := p.ctes[name]; ok {
+			return fmt.Errorf("duplicate common table expression %s.", name)
+		}
+		if tok, lit := p.scanIgnoreWhitespace(); tok != AS {
+			return fmt.Errorf("found %q, expected AS after the common table expression %s.", lit, name)
+		}
+		stmt, err := p.parseSubQuery()
+		if err != nil {
+			return err
+		}
+		p.ctes[name] = &cte{stmt: stmt}
+		if tok, _ := p.scanIgnoreWhitespace(); tok != COMMA {
+			p.unscan()
+			return nil
+		}
 	}
+}
 
-	if err := Validate(selects); err != nil {
+func (p *Parser) parseSubQuery() (*SelectStatement, error) {
+	if tok, lit := p.scanIgnoreWhitespace(); tok != LPAREN {
+		return nil, fmt.Errorf("found %q, expected left paren before the subquery.", lit)
+	}
+	stmt, err := p.parseSelect()
+	if err != nil {
 		return nil, err
 	}
-
-	return selects, nil
+	if tok, lit := p.scanIgnoreWhitespace(); tok != RPAREN {
+		return nil, fmt.Errorf("found %q, expected right paren after the subquery.", lit)
+	}
+	if err := Validate(stmt); err != nil {
+		return nil, err
+	}
+	return stmt, nil
 }
 
 func (p *Parser) parseSource() (Sources, error) {
@@ -179,13 +282,66 @@ func (p *Parser) parseSource() (Sources, error) {
 		return nil, fmt.Errorf("found %q, expected FROM.", lit)
 	}
 
+	for {
+		if src, err := p.parseSourceItem(); err != nil {
+			return nil, err
+		} else {
+			sources = append(sources, src)
+		}
+		if tok, _ := p.scanIgnoreWhitespace(); tok != COMMA {
+			p.unscan()
+			break
+		}
+		if tok, lit := p.scanIgnoreWhitespace(); !tok.allowedSourceToken() && tok != LPAREN {
+			return nil, fmt.Errorf("found %q, expected the source after comma.", lit)
+		}
+		p.unscan()
+	}
+
+	// The sources separated by comma are the union of the streams
+	if len(sources) > 1 {
+		for _, src := range sources {
+			if sq, ok := src.(*SubQuery); ok {
+				return nil, fmt.Errorf("subquery %s cannot be used in the union of sources.", sq.Alias)
+			}
+		}
+	}
+
+	return sources, nil
+}
+
+func (p *Parser) parseSourceItem() (Source, error) {
+	if tok, _ := p.scanIgnoreWhitespace(); tok == LPAREN {
+		p.unscan()
+		stmt, err := p.parseSubQuery()
+		if err != nil {
+			return nil, err
+		}
+		if tok, lit := p.scanIgnoreWhitespace(); tok != AS {
+			return nil, fmt.Errorf("found %q, expected AS and the alias of the subquery.", lit)
+		}
+		if tok, lit := p.scanIgnoreWhitespace(); tok != IDENT {
+			return nil, fmt.Errorf("found %q, expected the alias of the subquery.", lit)
+		} else {
+			return &SubQuery{Stmt: stmt, Alias: lit}, nil
+		}
+	}
+	p.unscan()
+
 	if src, alias, err := p.parseSourceLiteral(); err != nil {
 		return nil, err
+	} else if c, ok := p.ctes[src]; ok {
+		if c.used {
+			return nil, fmt.Errorf("common table expression %s can only be referred once.", src)
+		}
+		c.used = true
+		if alias == "" {
+			alias = src
+		}
+		return &SubQuery{Stmt: c.stmt, Alias: alias}, nil
 	} else {
-		sources = append(sources, &Table{Name: src, Alias: alias})
+		return &Table{Name: src, Alias: alias}, nil
 	}
-
-	return sources, nil
 }
 
 //TODO Current func has problems when the source includes white space.
@@ -281,17 +437,23 @@ func (p *Parser) ParseJoin(joinType JoinType) (*Join, error) {
 	if src, alias, err := p.parseSourceLiteral(); err != nil {
 		return nil, err
 	} else {
+		if _, ok := p.ctes[src]; ok {
+			return nil, fmt.Errorf("common table expression %s cannot be used in join.", src)
+		}
 		j.Name = src
 		j.Alias = alias
 		if tok1, _ := p.scanIgnoreWhitespace(); tok1 == ON {
 			if CROSS_JOIN == joinType {
 				return nil, fmt.Errorf("On expression is not required for cross join type.\n")
 			}
-			if exp, err := p.ParseExpr(); err != nil {
+			// The time interval bounds of the stream join like 30s are only allowed in the join condition
+			p.s.durations = true
+			exp, err := p.ParseExpr()
+			p.s.durations = false
+			if err != nil {
 				return nil, err
-			} else {
-				j.Expr = exp
 			}
+			j.Expr = exp
 		} else {
 			p.unscan()
 		}
@@ -380,6 +542,48 @@ func (p *Parser) parseSorts() (SortFields, error) {
 	return ss, nil
 }
 
+func (p *Parser) parseLimit() (*Limit, error) {
+	if tok, _ := p.scanIgnoreWhitespace(); tok != LIMIT {
+		p.unscan()
+		return nil, nil
+	}
+	limit := &Limit{}
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok != INTEGER || strings.HasPrefix(lit, "-") {
+		return nil, fmt.Errorf("found %q, expected a non-negative integer after LIMIT.", lit)
+	}
+	limit.Count, _ = strconv.Atoi(lit)
+	if tok, _ := p.scanIgnoreWhitespace(); tok != OFFSET {
+		p.unscan()
+		return limit, p.parseLimitBy(limit)
+	}
+	tok, lit = p.scanIgnoreWhitespace()
+	if tok != INTEGER || strings.HasPrefix(lit, "-") {
+		return nil, fmt.Errorf("found %q, expected a non-negative integer after OFFSET.", lit)
+	}
+	limit.Offset, _ = strconv.Atoi(lit)
+	return limit, p.parseLimitBy(limit)
+}
+
+// Parse the optional BY columns of the LIMIT clause to limit the rows of each group
+func (p *Parser) parseLimitBy(limit *Limit) error {
+	if tok, _ := p.scanIgnoreWhitespace(); tok != BY {
+		p.unscan()
+		return nil
+	}
+	for {
+		tok, lit := p.scanIgnoreWhitespace()
+		if tok != IDENT {
+			return fmt.Errorf("found %q, expected a column name after LIMIT BY.", lit)
+		}
+		limit.By = append(limit.By, lit)
+		if tok, _ := p.scanIgnoreWhitespace(); tok != COMMA {
+			p.unscan()
+			return nil
+		}
+	}
+}
+
 func (p *Parser) parseFields() (Fields, error) {
 	var fields Fields
 
@@ -446,6 +650,11 @@ func (p *Parser) parseAlias() (string, error) {
 }
 
 func (p *Parser) ParseExpr() (Expr, error) {
+	return p.parseExprWithPrecedence(0)
+}
+
+// Parse the expression until an operator whose precedence is not higher than the minimum precedence
+func (p *Parser) parseExprWithPrecedence(minPrecedence int) (Expr, error) {
 	var err error
 	root := &BinaryExpr{}
 
@@ -455,8 +664,36 @@ func (p *Parser) ParseExpr() (Expr, error) {
 	}
 
 	for {
-		op, _ := p.scanIgnoreWhitespace()
-		if !op.isOperator() {
+		op, lit := p.scanIgnoreWhitespace()
+		var rhs Expr
+		if op == NOT || op == IS {
+			// The predicate operators are composed by multiple tokens
+			if op, err = p.parsePredicateOp(op); err != nil {
+				return nil, err
+			}
+		}
+		if minPrecedence > 0 && op.isOperator() && op.Precedence() <= minPrecedence {
+			p.unscanPredicateOp(op)
+			return root.RHS, nil
+		}
+		if (op == INTEGER || op == NUMBER || op == DURATION) && strings.HasPrefix(lit, "-") {
+			// The scanner reads the subtraction like `a - 1` as `a` followed by a negative number
+			if op == INTEGER {
+				val, _ := strconv.Atoi(lit[1:])
+				rhs = &IntegerLiteral{Val: val}
+			} else if op == DURATION {
+				val, err := durationToMilli(lit[1:])
+				if err != nil {
+					return nil, err
+				}
+				rhs = &IntegerLiteral{Val: val}
+			} else if v, err := strconv.ParseFloat(lit[1:], 64); err != nil {
+				return nil, fmt.Errorf("found %q, invalid number value.", lit)
+			} else {
+				rhs = &NumberLiteral{Val: v}
+			}
+			op = SUB
+		} else if !op.isOperator() {
 			p.unscan()
 			return root.RHS, nil
 		} else if op == ASTERISK { //Change the asterisk to Mul token.
@@ -466,24 +703,127 @@ func (p *Parser) ParseExpr() (Expr, error) {
 			p.unscan()
 		}
 
-		var rhs Expr
-		if rhs, err = p.parseUnaryExpr(op == ARROW); err != nil {
-			return nil, err
+		if rhs == nil {
+			switch op {
+			case IN, NOTIN, BETWEEN, NOTBETWEEN, LIKE, NOTLIKE, ISNULL, ISNOTNULL:
+				rhs, err = p.parsePredicateRHS(op)
+			default:
+				rhs, err = p.parseUnaryExpr(op == ARROW)
+			}
+			if err != nil {
+				return nil, err
+			}
 		}
 
-		for node := root; ; {
-			r, ok := node.RHS.(*BinaryExpr)
-			if !ok || r.OP.Precedence() >= op.Precedence() {
-				node.RHS = &BinaryExpr{LHS: node.RHS, RHS: rhs, OP: op}
+		for node := &root.RHS; ; {
+			if r, ok := (*node).(*BinaryExpr); ok && r.OP.Precedence() < op.Precedence() {
+				node = &r.RHS
+			} else if r, ok := (*node).(*NotExpr); ok && NOT.Precedence() < op.Precedence() {
+				node = &r.Expr
+			} else {
+				*node = &BinaryExpr{LHS: *node, RHS: rhs, OP: op}
 				break
 			}
-			node = r
 		}
 	}
 
 	return nil, nil
 }
 
+// Read the following tokens of NOT or IS to compose the predicate operator
+func (p *Parser) parsePredicateOp(tok Token) (Token, error) {
+	if tok == IS {
+		next, lit := p.scanIgnoreWhitespace()
+		if next == NULL {
+			return ISNULL, nil
+		} else if next == NOT {
+			if next, lit = p.scanIgnoreWhitespace(); next == NULL {
+				return ISNOTNULL, nil
+			}
+		}
+		return ILLEGAL, fmt.Errorf("found %q after IS, expected NULL or NOT NULL.", lit)
+	}
+	next, lit := p.scanIgnoreWhitespace()
+	switch next {
+	case IN:
+		return NOTIN, nil
+	case BETWEEN:
+		return NOTBETWEEN, nil
+	case LIKE:
+		return NOTLIKE, nil
+	}
+	return ILLEGAL, fmt.Errorf("found %q after NOT, expected IN, BETWEEN or LIKE.", lit)
+}
+
+// Unscan all the tokens of an operator
+func (p *Parser) unscanPredicateOp(op Token) {
+	switch op {
+	case NOTIN, NOTBETWEEN, NOTLIKE, ISNULL:
+		p.unscan()
+	case ISNOTNULL:
+		p.unscan()
+		p.unscan()
+	}
+	p.unscan()
+}
+
+func (p *Parser) parsePredicateRHS(op Token) (Expr, error) {
+	switch op {
+	case IN, NOTIN:
+		if tok, _ := p.scanIgnoreWhitespace(); tok != LPAREN {
+			p.unscan()
+			expr, err := p.parseUnaryExpr(false)
+			if err != nil {
+				return nil, err
+			}
+			return &ValueSetExpr{ArrayExpr: expr}, nil
+		}
+		var exprs []Expr
+		for {
+			expr, err := p.ParseExpr()
+			if err != nil {
+				return nil, err
+			}
+			exprs = append(exprs, expr)
+			if tok, _ := p.scanIgnoreWhitespace(); tok != COMMA {
+				p.unscan()
+				break
+			}
+		}
+		if tok, lit := p.scanIgnoreWhitespace(); tok != RPAREN {
+			return nil, fmt.Errorf("found %q, expected right paren after the IN value list.", lit)
+		}
+		return &ValueSetExpr{LiteralExprs: exprs}, nil
+	case BETWEEN, NOTBETWEEN:
+		lower, err := p.parseExprWithPrecedence(EQ.Precedence())
+		if err != nil {
+			return nil, err
+		}
+		if tok, lit := p.scanIgnoreWhitespace(); tok != AND {
+			return nil, fmt.Errorf("found %q, expected AND in the BETWEEN expression.", lit)
+		}
+		higher, err := p.parseExprWithPrecedence(EQ.Precedence())
+		if err != nil {
+			return nil, err
+		}
+		return &BetweenExpr{Lower: lower, Higher: higher}, nil
+	case LIKE, NOTLIKE:
+		expr, err := p.parseUnaryExpr(false)
+		if err != nil {
+			return nil, err
+		}
+		l := &LikePattern{Expr: expr}
+		if s, ok := expr.(*StringLiteral); ok {
+			if l.Pattern, err = compileLikePattern(s.Val); err != nil {
+				return nil, err
+			}
+		}
+		return l, nil
+	default: // IS NULL and IS NOT NULL have no right hand side
+		return nil, nil
+	}
+}
+
 func (p *Parser) parseUnaryExpr(isSubField bool) (Expr, error) {
 	if tok1, _ := p.scanIgnoreWhitespace(); tok1 == LPAREN {
 		expr, err := p.ParseExpr()
@@ -505,6 +845,12 @@ func (p *Parser) parseUnaryExpr(isSubField bool) (Expr, error) {
 	tok, lit := p.scanIgnoreWhitespace()
 	if tok == CASE {
 		return p.parseCaseExpr()
+	} else if tok == NOT {
+		expr, err := p.parseUnaryExpr(false)
+		if err != nil {
+			return nil, err
+		}
+		return &NotExpr{Expr: expr}, nil
 	} else if tok == IDENT {
 		if tok1, _ := p.scanIgnoreWhitespace(); tok1 == LPAREN {
 			return p.parseCall(lit)
@@ -526,6 +872,9 @@ func (p *Parser) parseUnaryExpr(isSubField bool) (Expr, error) {
 				if len(n) == 2 {
 					return &FieldRef{StreamName: StreamName(n[0]), Name: n[1]}, nil
 				}
+				if !isSubField && p.isLambdaParam(n[0]) {
+					return &LambdaParamRef{Name: n[0]}, nil
+				}
 				if isSubField {
 					return &FieldRef{StreamName: "", Name: n[0]}, nil
 				}
@@ -537,6 +886,12 @@ func (p *Parser) parseUnaryExpr(isSubField bool) (Expr, error) {
 	} else if tok == INTEGER {
 		val, _ := strconv.Atoi(lit)
 		return &IntegerLiteral{Val: val}, nil
+	} else if tok == DURATION {
+		if v, err := durationToMilli(lit); err != nil {
+			return nil, err
+		} else {
+			return &IntegerLiteral{Val: v}, nil
+		}
 	} else if tok == NUMBER {
 		if v, err := strconv.ParseFloat(lit, 64); err != nil {
 			return nil, fmt.Errorf("found %q, invalid number value.", lit)
@@ -608,6 +963,38 @@ func (p *Parser) parseAs(f *Field) (*Field, error) {
 	return f, nil
 }
 
+// Parse the lambda expression like x -> x * 2 as the argument of the higher-order function
+func (p *Parser) parseLambda(name string) (Expr, error) {
+	tok, param := p.scanIgnoreWhitespace()
+	if tok != IDENT {
+		return nil, fmt.Errorf("found %q, expected lambda expression like x -> expr in function %s.", param, name)
+	}
+	if tok, lit := p.scanIgnoreWhitespace(); tok != ARROW {
+		return nil, fmt.Errorf("found %q, expected -> of the lambda expression in function %s.", lit, name)
+	}
+	p.lambdaParams = append(p.lambdaParams, param)
+	defer func() {
+		p.lambdaParams = p.lambdaParams[:len(p.lambdaParams)-1]
+	}()
+	body, err := p.ParseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if HasAggFuncs(body) {
+		return nil, fmt.Errorf("Not allowed to call aggregate functions in lambda expression.")
+	}
+	return &LambdaExpr{Param: param, Body: body}, nil
+}
+
+func (p *Parser) isLambdaParam(name string) bool {
+	for _, param := range p.lambdaParams {
+		if strings.EqualFold(param, name) {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *Parser) parseCall(name string) (Expr, error) {
 	if strings.ToLower(name) == "meta" || strings.ToLower(name) == "mqtt" {
 		p.inmeta = true
@@ -615,14 +1002,22 @@ func (p *Parser) parseCall(name string) (Expr, error) {
 			p.inmeta = false
 		}()
 	}
-	var args []Expr
+	var (
+		args     []Expr
+		distinct bool
+	)
+	if tok, _ := p.scanIgnoreWhitespace(); tok == DISTINCT {
+		distinct = true
+	} else {
+		p.unscan()
+	}
 	for {
 		if tok, _ := p.scanIgnoreWhitespace(); tok == RPAREN {
-			if valErr := validateFuncs(name, nil); valErr != nil {
+			if valErr := p.validateFuncs(name, nil); valErr != nil {
 				return nil, valErr
 			}
 			return &Call{Name: name, Args: args}, nil
-		} else if tok == ASTERISK {
+		} else if tok == ASTERISK && !distinct {
 			if tok2, lit2 := p.scanIgnoreWhitespace(); tok2 != RPAREN {
 				return nil, fmt.Errorf("found %q, expected right paren.", lit2)
 			} else {
@@ -637,13 +1032,25 @@ func (p *Parser) parseCall(name string) (Expr, error) {
 			p.unscan()
 		}
 
-		if exp, err := p.ParseExpr(); err != nil {
-			return nil, err
+		var (
+			exp Expr
+			err error
+		)
+		if _, ok := lambdaFuncMap[strings.ToLower(name)]; ok && len(args) == 1 {
+			exp, err = p.parseLambda(name)
 		} else {
-			args = append(args, exp)
+			exp, err = p.ParseExpr()
 		}
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, exp)
 
 		if tok, _ := p.scanIgnoreWhitespace(); tok != COMMA {
+			// extract(unit FROM ts) is the same as extract(unit, ts)
+			if tok == FROM && len(args) == 1 && strings.ToLower(name) == "extract" {
+				continue
+			}
 			p.unscan()
 			break
 		}
@@ -652,19 +1059,44 @@ func (p *Parser) parseCall(name string) (Expr, error) {
 	if tok, lit := p.scanIgnoreWhitespace(); tok != RPAREN {
 		return nil, fmt.Errorf("found function call %q, expected ), but with %q.", name, lit)
 	}
+	convertTimeUnitArg(name, args)
 	if wt, error := validateWindows(name, args); wt == NOT_WINDOW {
-		if valErr := validateFuncs(name, args); valErr != nil {
+		if valErr := p.validateFuncs(name, args); valErr != nil {
 			return nil, valErr
 		}
+		if distinct {
+			if len(args) != 1 || !isAggFunc(&Call{Name: name}) {
+				return nil, fmt.Errorf("DISTINCT is only allowed in the aggregate function with one argument, but found %s.", name)
+			}
+			return &Call{Name: name, Args: args, Distinct: true}, nil
+		}
 		// Add context for some aggregate func
 		if name == "deduplicate" {
 			args = append([]Expr{&Wildcard{Token: ASTERISK}}, args...)
 		}
-		return &Call{Name: name, Args: args}, nil
+		if !isAnalyticFunc(name) {
+			if tok, _ := p.scanIgnoreWhitespace(); tok == OVER {
+				return nil, fmt.Errorf("OVER clause is only allowed for analytic functions, but found %s.", name)
+			}
+			p.unscan()
+			return &Call{Name: name, Args: args}, nil
+		}
+		c := &Call{Name: name, Args: args, FuncId: p.funcId}
+		p.funcId++
+		// parse partition clause of the analytic function
+		if pt, err := p.parsePartition(); err != nil {
+			return nil, err
+		} else if pt != nil {
+			c.Partition = pt
+		}
+		return c, nil
 	} else {
 		if error != nil {
 			return nil, error
 		}
+		if distinct {
+			return nil, fmt.Errorf("DISTINCT is only allowed in the aggregate function with one argument, but found %s.", name)
+		}
 		win, err := p.ConvertToWindows(wt, args)
 		if err != nil {
 			return nil, error
@@ -676,6 +1108,12 @@ func (p *Parser) parseCall(name string) (Expr, error) {
 		} else if f != nil {
 			win.Filter = f
 		}
+		// parse partition clause
+		if pt, err := p.parsePartition(); err != nil {
+			return nil, err
+		} else if pt != nil {
+			win.Partition = pt
+		}
 		return win, nil
 	}
 }
@@ -853,8 +1291,10 @@ func (p *Parser) ParseCreateStmt() (Statement, error) {
 			stmt.StreamType = TypeStream
 		case TABLE:
 			stmt.StreamType = TypeTable
+		case FUNCTION:
+			return p.parseCreateFunctionStmt()
 		default:
-			return nil, fmt.Errorf("found %q, expected keyword stream or table.", lit1)
+			return nil, fmt.Errorf("found %q, expected keyword stream, table or function.", lit1)
 		}
 		if tok2, lit2 := p.scanIgnoreWhitespace(); tok2 == IDENT {
 			stmt.Name = StreamName(lit2)
@@ -889,6 +1329,123 @@ func (p *Parser) ParseCreateStmt() (Statement, error) {
 
 }
 
+// Parse the statement like CREATE FUNCTION name(a, b) AS "a * b" WITH (LANGUAGE="sql", TYPE="scalar")
+func (p *Parser) parseCreateFunctionStmt() (Statement, error) {
+	stmt := &FunctionStmt{}
+	if tok, lit := p.scanIgnoreWhitespace(); tok == IDENT {
+		stmt.Name = lit
+	} else {
+		return nil, fmt.Errorf("found %q, expected function name.", lit)
+	}
+	if tok, lit := p.scanIgnoreWhitespace(); tok != LPAREN {
+		return nil, fmt.Errorf("found %q, expected lparen after function name.", lit)
+	}
+	if tok, _ := p.scanIgnoreWhitespace(); tok != RPAREN {
+		p.unscan()
+		for {
+			tok, lit := p.scanIgnoreWhitespace()
+			if tok != IDENT {
+				return nil, fmt.Errorf("found %q, expected parameter name.", lit)
+			}
+			for _, param := range stmt.Params {
+				if strings.EqualFold(param, lit) {
+					return nil, fmt.Errorf("duplicate parameter %s in function %s.", lit, stmt.Name)
+				}
+			}
+			stmt.Params = append(stmt.Params, lit)
+			if tok1, lit1 := p.scanIgnoreWhitespace(); tok1 == RPAREN {
+				break
+			} else if tok1 != COMMA {
+				return nil, fmt.Errorf("found %q, expected comma or rparen.", lit1)
+			}
+		}
+	}
+	if tok, lit := p.scanIgnoreWhitespace(); tok != AS {
+		return nil, fmt.Errorf("found %q, expected keyword as.", lit)
+	}
+	if tok, lit := p.scanIgnoreWhitespace(); tok == STRING {
+		stmt.Body = lit
+	} else {
+		return nil, fmt.Errorf("found %q, expected string of the function body.", lit)
+	}
+	if tok, _ := p.scanIgnoreWhitespace(); tok == WITH {
+		if err := p.parseFunctionOptions(stmt); err != nil {
+			return nil, err
+		}
+	} else {
+		p.unscan()
+	}
+	if tok, lit := p.scanIgnoreWhitespace(); tok == SEMICOLON {
+		p.unscan()
+	} else if tok != EOF {
+		return nil, fmt.Errorf("found %q, expected semicolon or EOF.", lit)
+	}
+	if err := validateFunction(stmt); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+func (p *Parser) parseFunctionOptions(stmt *FunctionStmt) error {
+	if tok, lit := p.scanIgnoreWhitespace(); tok != LPAREN {
+		return fmt.Errorf("found %q, expect function options.", lit)
+	}
+	for {
+		tok1, lit1 := p.scanIgnoreWhitespace()
+		if tok1 != LANGUAGE && tok1 != TYPE {
+			return fmt.Errorf("found %q, unknown option keys(LANGUAGE|TYPE).", lit1)
+		}
+		if tok2, lit2 := p.scanIgnoreWhitespace(); tok2 != EQ {
+			return fmt.Errorf("found %q, expect equals(=) in options.", lit2)
+		}
+		tok3, lit3 := p.scanIgnoreWhitespace()
+		if tok3 != STRING {
+			return fmt.Errorf("found %q, expect string value in option.", lit3)
+		}
+		if tok1 == LANGUAGE {
+			stmt.Language = strings.ToLower(lit3)
+		} else {
+			stmt.FuncType = strings.ToLower(lit3)
+		}
+		if tok4, lit4 := p.scanIgnoreWhitespace(); tok4 == RPAREN {
+			return nil
+		} else if tok4 != COMMA {
+			return fmt.Errorf("found %q, expect comma or rparen in options.", lit4)
+		}
+	}
+}
+
+func (p *Parser) validateFuncs(name string, args []Expr) error {
+	if p.pendingFuncs[strings.ToLower(name)] && !IsBuiltinFunc(name) {
+		return nil
+	}
+	return validateFuncs(name, args)
+}
+
+func validateFunction(stmt *FunctionStmt) error {
+	if IsBuiltinFunc(stmt.Name) {
+		return fmt.Errorf("function %s is a built-in function", stmt.Name)
+	}
+	if strings.TrimSpace(stmt.Body) == "" {
+		return fmt.Errorf("the body of function %s is empty", stmt.Name)
+	}
+	switch stmt.Language {
+	case "":
+		stmt.Language = FUNC_LANG_SQL
+	case FUNC_LANG_SQL, FUNC_LANG_STARLARK:
+		//do nothing
+	default:
+		return fmt.Errorf("option 'language=%s' is invalid, expect sql or starlark", stmt.Language)
+	}
+	switch stmt.FuncType {
+	case "", FUNC_TYPE_SCALAR, FUNC_TYPE_AGGREGATE:
+		//do nothing
+	default:
+		return fmt.Errorf("option 'type=%s' is invalid, expect scalar or aggregate", stmt.FuncType)
+	}
+	return nil
+}
+
 // TODO more accurate validation for table
 func validateStream(stmt *StreamStmt) error {
 	f := stmt.Options.FORMAT
@@ -916,8 +1473,24 @@ func validateStream(stmt *StreamStmt) error {
 		default:
 			return fmt.Errorf("'binary' format stream can have only one field")
 		}
+	case common.FORMAT_PROTOBUF, common.FORMAT_AVRO:
+		if stmt.Options.SCHEMAID == "" {
+			return fmt.Errorf("option 'schemaid' is required for '%s' format", strings.ToLower(f))
+		}
 	default:
-		return fmt.Errorf("option 'format=%s' is invalid", f)
+		if !common.IsFormatSupported(f) {
+			return fmt.Errorf("option 'format=%s' is invalid", f)
+		}
+	}
+	switch strings.ToLower(stmt.Options.KIND) {
+	case "", TABLE_KIND_SCAN:
+		//do nothing
+	case TABLE_KIND_LOOKUP:
+		if stmt.StreamType != TypeTable {
+			return fmt.Errorf("option 'kind=lookup' is only supported for table")
+		}
+	default:
+		return fmt.Errorf("option 'kind=%s' is invalid, expect scan or lookup", stmt.Options.KIND)
 	}
 	return nil
 }
@@ -940,8 +1513,15 @@ func (p *Parser) parseShowStmt() (Statement, error) {
 			} else {
 				return nil, fmt.Errorf("found %q, expected semecolon or EOF.", lit2)
 			}
+		case FUNCTIONS:
+			ss := &ShowFunctionsStatement{}
+			if tok2, lit2 := p.scanIgnoreWhitespace(); tok2 == EOF || tok2 == SEMICOLON {
+				return ss, nil
+			} else {
+				return nil, fmt.Errorf("found %q, expected semecolon or EOF.", lit2)
+			}
 		default:
-			return nil, fmt.Errorf("found %q, expected keyword streams or tables.", lit1)
+			return nil, fmt.Errorf("found %q, expected keyword streams, tables or functions.", lit1)
 		}
 	} else {
 		p.unscan()
@@ -969,8 +1549,16 @@ func (p *Parser) parseDescribeStmt() (Statement, error) {
 			} else {
 				return nil, fmt.Errorf("found %q, expected table name.", lit2)
 			}
+		case FUNCTION:
+			dfs := &DescribeFunctionStatement{}
+			if tok2, lit2 := p.scanIgnoreWhitespace(); tok2 == IDENT {
+				dfs.Name = lit2
+				return dfs, nil
+			} else {
+				return nil, fmt.Errorf("found %q, expected function name.", lit2)
+			}
 		default:
-			return nil, fmt.Errorf("found %q, expected keyword stream or table.", lit1)
+			return nil, fmt.Errorf("found %q, expected keyword stream, table or function.", lit1)
 		}
 	} else {
 		p.unscan()
@@ -1027,8 +1615,16 @@ func (p *Parser) parseDropStmt() (Statement, error) {
 			} else {
 				return nil, fmt.Errorf("found %q, expected table name.", lit2)
 			}
+		case FUNCTION:
+			dfs := &DropFunctionStatement{}
+			if tok2, lit2 := p.scanIgnoreWhitespace(); tok2 == IDENT {
+				dfs.Name = lit2
+				return dfs, nil
+			} else {
+				return nil, fmt.Errorf("found %q, expected function name.", lit2)
+			}
 		default:
-			return nil, fmt.Errorf("found %q, expected keyword stream or table.", lit1)
+			return nil, fmt.Errorf("found %q, expected keyword stream, table or function.", lit1)
 		}
 	} else {
 		p.unscan()
@@ -1197,7 +1793,7 @@ func (p *Parser) parseStreamOptions() (*Options, error) {
 	if tok, lit := p.scanIgnoreWhitespace(); tok == LPAREN {
 		lStack.Push(LPAREN)
 		for {
-			if tok1, lit1 := p.scanIgnoreWhitespace(); tok1 == DATASOURCE || tok1 == FORMAT || tok1 == KEY || tok1 == CONF_KEY || tok1 == STRICT_VALIDATION || tok1 == TYPE || tok1 == TIMESTAMP || tok1 == TIMESTAMP_FORMAT || tok1 == RETAIN_SIZE {
+			if tok1, lit1 := p.scanIgnoreWhitespace(); tok1 == DATASOURCE || tok1 == FORMAT || tok1 == KEY || tok1 == CONF_KEY || tok1 == STRICT_VALIDATION || tok1 == TYPE || tok1 == TIMESTAMP || tok1 == TIMESTAMP_FORMAT || tok1 == RETAIN_SIZE || tok1 == SCHEMAID || tok1 == KIND {
 				if tok2, lit2 := p.scanIgnoreWhitespace(); tok2 == EQ {
 					if tok3, lit3 := p.scanIgnoreWhitespace(); tok3 == STRING {
 						switch tok1 {
@@ -1237,7 +1833,7 @@ func (p *Parser) parseStreamOptions() (*Options, error) {
 					return nil, fmt.Errorf("Parenthesis is not matched in options definition.")
 				}
 			} else {
-				return nil, fmt.Errorf("found %q, unknown option keys(DATASOURCE|FORMAT|KEY|CONF_KEY|STRICT_VALIDATION|TYPE|TIMESTAMP|TIMESTAMP_FORMAT|RETAIN_SIZE).", lit1)
+				return nil, fmt.Errorf("found %q, unknown option keys(DATASOURCE|FORMAT|KEY|CONF_KEY|STRICT_VALIDATION|TYPE|TIMESTAMP|TIMESTAMP_FORMAT|RETAIN_SIZE|SCHEMAID|KIND).", lit1)
 			}
 		}
 	} else {
@@ -1246,6 +1842,42 @@ func (p *Parser) parseStreamOptions() (*Options, error) {
 	return opts, nil
 }
 
+// Parse the partition clause like OVER (PARTITION BY deviceId). Only support partition on window now
+func (p *Parser) parsePartition() ([]Expr, error) {
+	if tok, _ := p.scanIgnoreWhitespace(); tok != OVER {
+		p.unscan()
+		return nil, nil
+	}
+	if tok, lit := p.scanIgnoreWhitespace(); tok != LPAREN {
+		return nil, fmt.Errorf("Found %q after OVER, expect parentheses.", lit)
+	}
+	if tok, lit := p.scanIgnoreWhitespace(); tok != PARTITION {
+		return nil, fmt.Errorf("Found %q after OVER(, expect PARTITION.", lit)
+	}
+	if tok, lit := p.scanIgnoreWhitespace(); tok != BY {
+		return nil, fmt.Errorf("Found %q after PARTITION, expect BY.", lit)
+	}
+	var exprs []Expr
+	for {
+		expr, err := p.ParseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if HasAggFuncs(expr) {
+			return nil, fmt.Errorf("Not allowed to call aggregate functions in PARTITION BY clause.")
+		}
+		exprs = append(exprs, expr)
+		if tok, _ := p.scanIgnoreWhitespace(); tok != COMMA {
+			p.unscan()
+			break
+		}
+	}
+	if tok, lit := p.scanIgnoreWhitespace(); tok != RPAREN {
+		return nil, fmt.Errorf("Found %q after PARTITION BY, expect right parentheses.", lit)
+	}
+	return exprs, nil
+}
+
 // Only support filter on window now
 func (p *Parser) parseFilter() (Expr, error) {
 	if tok, _ := p.scanIgnoreWhitespace(); tok != FILTER {
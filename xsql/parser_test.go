@@ -5,6 +5,7 @@ import (
 	"github.com/emqx/kuiper/common"
 	"math"
 	"reflect"
+	"regexp"
 	"strings"
 	"testing"
 )
@@ -499,6 +500,18 @@ func TestParser_ParseStatement(t *testing.T) {
 			},
 		},
 
+		{
+			s:    `SELECT abc FROM tbl WHERE abc > ts - 30s `,
+			stmt: nil,
+			err:  `found "s", expected EOF.`,
+		},
+
+		{
+			s:    `SELECT abc FROM tbl WHERE abc > 3abc `,
+			stmt: nil,
+			err:  `found "abc", expected EOF.`,
+		},
+
 		{
 			s: `SELECT abc FROM tbl WHERE abc = "hello" `,
 			stmt: &SelectStatement{
@@ -1394,6 +1407,322 @@ func TestParser_ParseStatement(t *testing.T) {
 				},
 				Sources: []Source{&Table{Name: "tbl"}},
 			},
+		}, {
+			s: `SELECT a - 1, b -2.5 * c FROM tbl`,
+			stmt: &SelectStatement{
+				Fields: []Field{
+					{
+						AName: "",
+						Name:  "",
+						Expr: &BinaryExpr{
+							LHS: &FieldRef{Name: "a", StreamName: DEFAULT_STREAM},
+							OP:  SUB,
+							RHS: &IntegerLiteral{Val: 1},
+						},
+					}, {
+						AName: "",
+						Name:  "",
+						Expr: &BinaryExpr{
+							LHS: &FieldRef{Name: "b", StreamName: DEFAULT_STREAM},
+							OP:  SUB,
+							RHS: &BinaryExpr{
+								LHS: &NumberLiteral{Val: 2.5},
+								OP:  MUL,
+								RHS: &FieldRef{Name: "c", StreamName: DEFAULT_STREAM},
+							},
+						},
+					},
+				},
+				Sources: []Source{&Table{Name: "tbl"}},
+			},
+		}, {
+			s: `SELECT a FROM tbl WHERE a IN (1, b + 2) AND c NOT BETWEEN 1 AND 5 OR d IS NOT NULL`,
+			stmt: &SelectStatement{
+				Fields: []Field{
+					{
+						Expr:  &FieldRef{Name: "a", StreamName: DEFAULT_STREAM},
+						Name:  "a",
+						AName: ""},
+				},
+				Sources: []Source{&Table{Name: "tbl"}},
+				Condition: &BinaryExpr{
+					LHS: &BinaryExpr{
+						LHS: &BinaryExpr{
+							LHS: &FieldRef{Name: "a", StreamName: DEFAULT_STREAM},
+							OP:  IN,
+							RHS: &ValueSetExpr{LiteralExprs: []Expr{
+								&IntegerLiteral{Val: 1},
+								&BinaryExpr{LHS: &FieldRef{Name: "b", StreamName: DEFAULT_STREAM}, OP: ADD, RHS: &IntegerLiteral{Val: 2}},
+							}},
+						},
+						OP: AND,
+						RHS: &BinaryExpr{
+							LHS: &FieldRef{Name: "c", StreamName: DEFAULT_STREAM},
+							OP:  NOTBETWEEN,
+							RHS: &BetweenExpr{Lower: &IntegerLiteral{Val: 1}, Higher: &IntegerLiteral{Val: 5}},
+						},
+					},
+					OP:  OR,
+					RHS: &BinaryExpr{LHS: &FieldRef{Name: "d", StreamName: DEFAULT_STREAM}, OP: ISNOTNULL},
+				},
+			},
+		}, {
+			s: `SELECT a FROM tbl WHERE NOT a LIKE "a%" AND b NOT IN arr`,
+			stmt: &SelectStatement{
+				Fields: []Field{
+					{
+						Expr:  &FieldRef{Name: "a", StreamName: DEFAULT_STREAM},
+						Name:  "a",
+						AName: ""},
+				},
+				Sources: []Source{&Table{Name: "tbl"}},
+				Condition: &BinaryExpr{
+					LHS: &NotExpr{
+						Expr: &BinaryExpr{
+							LHS: &FieldRef{Name: "a", StreamName: DEFAULT_STREAM},
+							OP:  LIKE,
+							RHS: &LikePattern{Expr: &StringLiteral{Val: "a%"}, Pattern: regexp.MustCompile("(?s)^a.*$")},
+						},
+					},
+					OP: AND,
+					RHS: &BinaryExpr{
+						LHS: &FieldRef{Name: "b", StreamName: DEFAULT_STREAM},
+						OP:  NOTIN,
+						RHS: &ValueSetExpr{ArrayExpr: &FieldRef{Name: "arr", StreamName: DEFAULT_STREAM}},
+					},
+				},
+			},
+		}, {
+			s: `SELECT CASE WHEN a IS NULL THEN 0 ELSE a END AS t FROM tbl`,
+			stmt: &SelectStatement{
+				Fields: []Field{
+					{
+						AName: "t",
+						Name:  "",
+						Expr: &CaseExpr{
+							WhenClauses: []*WhenClause{
+								{
+									Expr:   &BinaryExpr{LHS: &FieldRef{Name: "a", StreamName: DEFAULT_STREAM}, OP: ISNULL},
+									Result: &IntegerLiteral{Val: 0},
+								},
+							},
+							ElseClause: &FieldRef{Name: "a", StreamName: DEFAULT_STREAM},
+						},
+					},
+				},
+				Sources: []Source{&Table{Name: "tbl"}},
+			},
+		}, {
+			s:    `SELECT a FROM tbl WHERE a BETWEEN 1 OR 5`,
+			stmt: nil,
+			err:  "found \"OR\", expected AND in the BETWEEN expression.",
+		}, {
+			s:    `SELECT a FROM tbl WHERE a IS 1`,
+			stmt: nil,
+			err:  "found \"1\" after IS, expected NULL or NOT NULL.",
+		}, {
+			s:    `SELECT a FROM tbl WHERE a NOT 1`,
+			stmt: nil,
+			err:  "found \"1\" after NOT, expected IN, BETWEEN or LIKE.",
+		}, {
+			s:    `SELECT a FROM tbl WHERE a IN (1, 2`,
+			stmt: nil,
+			err:  "found \"EOF\", expected right paren after the IN value list.",
+		}, {
+			s: `SELECT DISTINCT a FROM tbl ORDER BY a DESC LIMIT 3 OFFSET 1`,
+			stmt: &SelectStatement{
+				Distinct: true,
+				Fields: []Field{
+					{
+						Expr:  &FieldRef{Name: "a", StreamName: DEFAULT_STREAM},
+						Name:  "a",
+						AName: ""},
+				},
+				Sources:    []Source{&Table{Name: "tbl"}},
+				SortFields: []SortField{{Name: "a", Ascending: false}},
+				Limit:      &Limit{Count: 3, Offset: 1},
+			},
+		}, {
+			s: `SELECT a FROM tbl LIMIT 0`,
+			stmt: &SelectStatement{
+				Fields: []Field{
+					{
+						Expr:  &FieldRef{Name: "a", StreamName: DEFAULT_STREAM},
+						Name:  "a",
+						AName: ""},
+				},
+				Sources: []Source{&Table{Name: "tbl"}},
+				Limit:   &Limit{Count: 0},
+			},
+		}, {
+			s: `SELECT a, b, c FROM tbl ORDER BY c DESC LIMIT 2 OFFSET 1 BY a, b`,
+			stmt: &SelectStatement{
+				Fields: []Field{
+					{
+						Expr:  &FieldRef{Name: "a", StreamName: DEFAULT_STREAM},
+						Name:  "a",
+						AName: ""},
+					{
+						Expr:  &FieldRef{Name: "b", StreamName: DEFAULT_STREAM},
+						Name:  "b",
+						AName: ""},
+					{
+						Expr:  &FieldRef{Name: "c", StreamName: DEFAULT_STREAM},
+						Name:  "c",
+						AName: ""},
+				},
+				Sources:    []Source{&Table{Name: "tbl"}},
+				SortFields: []SortField{{Name: "c", Ascending: false}},
+				Limit:      &Limit{Count: 2, Offset: 1, By: []string{"a", "b"}},
+			},
+		}, {
+			s: `SELECT a FROM tbl LIMIT 1 BY a`,
+			stmt: &SelectStatement{
+				Fields: []Field{
+					{
+						Expr:  &FieldRef{Name: "a", StreamName: DEFAULT_STREAM},
+						Name:  "a",
+						AName: ""},
+				},
+				Sources: []Source{&Table{Name: "tbl"}},
+				Limit:   &Limit{Count: 1, By: []string{"a"}},
+			},
+		}, {
+			s:    `SELECT a FROM tbl LIMIT 1 BY 2`,
+			stmt: nil,
+			err:  "found \"2\", expected a column name after LIMIT BY.",
+		}, {
+			s:    `SELECT a FROM tbl LIMIT -1`,
+			stmt: nil,
+			err:  "found \"-1\", expected a non-negative integer after LIMIT.",
+		}, {
+			s:    `SELECT a FROM tbl LIMIT 1 OFFSET b`,
+			stmt: nil,
+			err:  "found \"b\", expected a non-negative integer after OFFSET.",
+		}, {
+			s:    `SELECT a FROM tbl LIMIT 1 ORDER BY a`,
+			stmt: nil,
+			err:  "found \"ORDER\", expected EOF.",
+		}, {
+			s: `SELECT t.a FROM (SELECT a FROM tbl WHERE a > 1) AS t`,
+			stmt: &SelectStatement{
+				Fields: []Field{
+					{
+						Expr:  &FieldRef{Name: "a", StreamName: StreamName("t")},
+						Name:  "a",
+						AName: ""},
+				},
+				Sources: []Source{&SubQuery{
+					Stmt: &SelectStatement{
+						Fields: []Field{
+							{
+								Expr:  &FieldRef{Name: "a", StreamName: DEFAULT_STREAM},
+								Name:  "a",
+								AName: ""},
+						},
+						Sources: []Source{&Table{Name: "tbl"}},
+						Condition: &BinaryExpr{
+							LHS: &FieldRef{Name: "a", StreamName: DEFAULT_STREAM},
+							OP:  GT,
+							RHS: &IntegerLiteral{Val: 1},
+						},
+					},
+					Alias: "t",
+				}},
+			},
+		}, {
+			s: `WITH m AS (SELECT a FROM tbl), n AS (SELECT a FROM m) SELECT a FROM n AS x`,
+			stmt: &SelectStatement{
+				Fields: []Field{
+					{
+						Expr:  &FieldRef{Name: "a", StreamName: DEFAULT_STREAM},
+						Name:  "a",
+						AName: ""},
+				},
+				Sources: []Source{&SubQuery{
+					Stmt: &SelectStatement{
+						Fields: []Field{
+							{
+								Expr:  &FieldRef{Name: "a", StreamName: DEFAULT_STREAM},
+								Name:  "a",
+								AName: ""},
+						},
+						Sources: []Source{&SubQuery{
+							Stmt: &SelectStatement{
+								Fields: []Field{
+									{
+										Expr:  &FieldRef{Name: "a", StreamName: DEFAULT_STREAM},
+										Name:  "a",
+										AName: ""},
+								},
+								Sources: []Source{&Table{Name: "tbl"}},
+							},
+							Alias: "m",
+						}},
+					},
+					Alias: "x",
+				}},
+			},
+		}, {
+			s:    `SELECT a FROM (SELECT a FROM tbl)`,
+			stmt: nil,
+			err:  "found \"EOF\", expected AS and the alias of the subquery.",
+		}, {
+			s:    `SELECT a FROM (SELECT a FROM tbl AS t`,
+			stmt: nil,
+			err:  "found \"EOF\", expected right paren after the subquery.",
+		}, {
+			s:    `SELECT a FROM (SELECT a FROM tbl) AS t LEFT JOIN tbl2 ON t.a = tbl2.a`,
+			stmt: nil,
+			err:  "subquery t cannot be used with join.",
+		}, {
+			s:    `WITH m AS (SELECT a FROM tbl) SELECT a FROM tbl`,
+			stmt: nil,
+			err:  "common table expression m is not used.",
+		}, {
+			s:    `WITH m AS (SELECT a FROM tbl), m AS (SELECT b FROM tbl) SELECT a FROM m`,
+			stmt: nil,
+			err:  "duplicate common table expression m.",
+		}, {
+			s:    `WITH m (SELECT a FROM tbl) SELECT a FROM m`,
+			stmt: nil,
+			err:  "found \"(\", expected AS after the common table expression m.",
+		}, {
+			s:    `WITH m AS (SELECT a FROM tbl) SELECT a FROM tbl2 INNER JOIN m ON tbl2.a = m.a`,
+			stmt: nil,
+			err:  "common table expression m cannot be used in join.",
+		}, {
+			s:    `WITH m AS (SELECT a FROM tbl), n AS (SELECT a FROM m) SELECT a FROM m`,
+			stmt: nil,
+			err:  "common table expression m can only be referred once.",
+		}, {
+			s: `SELECT a FROM line1, line2 , line3 WHERE a > 1`,
+			stmt: &SelectStatement{
+				Fields: []Field{
+					{
+						Expr:  &FieldRef{Name: "a", StreamName: DEFAULT_STREAM},
+						Name:  "a",
+						AName: ""},
+				},
+				Sources: []Source{&Table{Name: "line1"}, &Table{Name: "line2"}, &Table{Name: "line3"}},
+				Condition: &BinaryExpr{
+					LHS: &FieldRef{Name: "a", StreamName: DEFAULT_STREAM},
+					OP:  GT,
+					RHS: &IntegerLiteral{Val: 1},
+				},
+			},
+		}, {
+			s:    `SELECT a FROM line1, WHERE a > 1`,
+			stmt: nil,
+			err:  "found \"WHERE\", expected the source after comma.",
+		}, {
+			s:    `SELECT a FROM line1, line2 INNER JOIN line3 ON line1.a = line3.a`,
+			stmt: nil,
+			err:  "the union of sources cannot be used with join.",
+		}, {
+			s:    `SELECT a FROM line1, (SELECT a FROM line2) AS t`,
+			stmt: nil,
+			err:  "subquery t cannot be used in the union of sources.",
 		},
 	}
 
@@ -1632,6 +1961,161 @@ func TestParser_ParseWindowsExpr(t *testing.T) {
 			s:    `SELECT * FROM demo GROUP BY COUNTWINDOW(3,1) where revenue > 100`,
 			stmt: nil,
 			err:  "found \"WHERE\", expected EOF.",
+		}, {
+			s: `SELECT * FROM demo GROUP BY SESSIONWINDOW(ss, 10, 2) FILTER( where revenue > 100 ) OVER (PARTITION BY deviceId, region), deviceId`,
+			stmt: &SelectStatement{
+				Fields: []Field{
+					{
+						Expr:  &Wildcard{Token: ASTERISK},
+						Name:  "",
+						AName: ""},
+				},
+				Sources: []Source{&Table{Name: "demo"}},
+				Dimensions: Dimensions{
+					Dimension{
+						Expr: &Window{
+							WindowType: SESSION_WINDOW,
+							Length:     &IntegerLiteral{Val: 10000},
+							Interval:   &IntegerLiteral{Val: 2000},
+							Filter: &BinaryExpr{
+								LHS: &FieldRef{Name: "revenue", StreamName: DEFAULT_STREAM},
+								OP:  GT,
+								RHS: &IntegerLiteral{Val: 100},
+							},
+							Partition: []Expr{
+								&FieldRef{Name: "deviceId", StreamName: DEFAULT_STREAM},
+								&FieldRef{Name: "region", StreamName: DEFAULT_STREAM},
+							},
+						},
+					},
+					Dimension{Expr: &FieldRef{Name: "deviceId", StreamName: DEFAULT_STREAM}},
+				},
+			},
+		},
+		{
+			s: `SELECT count(*) FROM demo GROUP BY TUMBLINGWINDOW(ss, 10) OVER (PARTITION BY deviceId)`,
+			stmt: &SelectStatement{
+				Fields: []Field{
+					{
+						Expr:  &Call{Name: "count", Args: []Expr{&Wildcard{Token: ASTERISK}}},
+						Name:  "count",
+						AName: ""},
+				},
+				Sources: []Source{&Table{Name: "demo"}},
+				Dimensions: Dimensions{
+					Dimension{
+						Expr: &Window{
+							WindowType: TUMBLING_WINDOW,
+							Length:     &IntegerLiteral{Val: 10000},
+							Interval:   &IntegerLiteral{Val: 0},
+							Partition: []Expr{
+								&FieldRef{Name: "deviceId", StreamName: DEFAULT_STREAM},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			s:    `SELECT * FROM demo GROUP BY TUMBLINGWINDOW(ss, 10) OVER (deviceId)`,
+			stmt: nil,
+			err:  "Found \"deviceId\" after OVER(, expect PARTITION.",
+		},
+		{
+			s:    `SELECT * FROM demo GROUP BY TUMBLINGWINDOW(ss, 10) OVER (PARTITION BY count(*))`,
+			stmt: nil,
+			err:  "Not allowed to call aggregate functions in PARTITION BY clause.",
+		},
+		{
+			s: `SELECT count(DISTINCT color) AS c, percentile_cont(size, 0.9) FROM demo GROUP BY TUMBLINGWINDOW(ss, 10)`,
+			stmt: &SelectStatement{
+				Fields: []Field{
+					{
+						Expr:  &Call{Name: "count", Args: []Expr{&FieldRef{Name: "color", StreamName: DEFAULT_STREAM}}, Distinct: true},
+						Name:  "count",
+						AName: "c"},
+					{
+						Expr:  &Call{Name: "percentile_cont", Args: []Expr{&FieldRef{Name: "size", StreamName: DEFAULT_STREAM}, &NumberLiteral{Val: 0.9}}},
+						Name:  "percentile_cont",
+						AName: ""},
+				},
+				Sources: []Source{&Table{Name: "demo"}},
+				Dimensions: Dimensions{
+					Dimension{
+						Expr: &Window{
+							WindowType: TUMBLING_WINDOW,
+							Length:     &IntegerLiteral{Val: 10000},
+							Interval:   &IntegerLiteral{Val: 0},
+						},
+					},
+				},
+			},
+		},
+		{
+			s:    `SELECT count(DISTINCT *) FROM demo`,
+			stmt: nil,
+			err:  "found \"*\", expected expression.",
+		},
+		{
+			s:    `SELECT lag(temp) OVER (PARTITION BY deviceId) AS t, acc_sum(temp, 1) FROM demo`,
+			stmt: nil,
+			err:  "The arguments for acc_sum should be 1.",
+		},
+		{
+			s: `SELECT lag(temp, 2, 0) OVER (PARTITION BY deviceId) AS t, acc_avg(temp), deviceId FROM demo WHERE had_changed(true, status) OVER (PARTITION BY deviceId)`,
+			stmt: &SelectStatement{
+				Fields: []Field{
+					{
+						Expr: &Call{
+							Name:      "lag",
+							Args:      []Expr{&FieldRef{Name: "temp", StreamName: DEFAULT_STREAM}, &IntegerLiteral{Val: 2}, &IntegerLiteral{Val: 0}},
+							FuncId:    0,
+							Partition: []Expr{&FieldRef{Name: "deviceId", StreamName: DEFAULT_STREAM}},
+						},
+						Name:  "lag",
+						AName: "t"},
+					{
+						Expr:  &Call{Name: "acc_avg", Args: []Expr{&FieldRef{Name: "temp", StreamName: DEFAULT_STREAM}}, FuncId: 1},
+						Name:  "acc_avg",
+						AName: ""},
+					{
+						Expr:  &FieldRef{Name: "deviceId", StreamName: DEFAULT_STREAM},
+						Name:  "deviceId",
+						AName: ""},
+				},
+				Sources: []Source{&Table{Name: "demo"}},
+				Condition: &Call{
+					Name:      "had_changed",
+					Args:      []Expr{&BooleanLiteral{Val: true}, &FieldRef{Name: "status", StreamName: DEFAULT_STREAM}},
+					FuncId:    2,
+					Partition: []Expr{&FieldRef{Name: "deviceId", StreamName: DEFAULT_STREAM}},
+				},
+			},
+		},
+		{
+			s:    `SELECT lag(temp, 0) FROM demo`,
+			stmt: nil,
+			err:  "The offset of lag should be a positive integer.",
+		},
+		{
+			s:    `SELECT changed_col("true", temp) FROM demo`,
+			stmt: nil,
+			err:  "Expect boolean type for 1 parameter of function changed_col.",
+		},
+		{
+			s:    `SELECT lead(temp) FROM demo`,
+			stmt: nil,
+			err:  "lead is not supported because the following events are unknown when the current event is processed.",
+		},
+		{
+			s:    `SELECT abs(temp) OVER (PARTITION BY deviceId) FROM demo`,
+			stmt: nil,
+			err:  "OVER clause is only allowed for analytic functions, but found abs.",
+		},
+		{
+			s:    `SELECT latest(temp) OVER (PARTITION BY max(temp)) FROM demo`,
+			stmt: nil,
+			err:  "Not allowed to call aggregate functions in PARTITION BY clause.",
 		},
 	}
 
@@ -1949,6 +2433,45 @@ func TestParser_ParseJoins(t *testing.T) {
 			},
 		},
 
+		{
+			s: `SELECT * FROM topic/sensor1 AS t1 INNER JOIN topic1 AS t2 ON t1.ts BETWEEN t2.ts - 30s AND t2.ts + 1m`,
+			stmt: &SelectStatement{
+				Fields: []Field{
+					{
+						Expr:  &Wildcard{Token: ASTERISK},
+						Name:  "",
+						AName: ""},
+				},
+				Sources: []Source{&Table{Name: "topic/sensor1", Alias: "t1"}},
+				Joins: []Join{
+					{
+						Name: "topic1", Alias: "t2", JoinType: INNER_JOIN, Expr: &BinaryExpr{
+							LHS: &FieldRef{Name: "ts", StreamName: StreamName("t1")},
+							OP:  BETWEEN,
+							RHS: &BetweenExpr{
+								Lower: &BinaryExpr{
+									LHS: &FieldRef{Name: "ts", StreamName: StreamName("t2")},
+									OP:  SUB,
+									RHS: &IntegerLiteral{Val: 30000},
+								},
+								Higher: &BinaryExpr{
+									LHS: &FieldRef{Name: "ts", StreamName: StreamName("t2")},
+									OP:  ADD,
+									RHS: &IntegerLiteral{Val: 60000},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+
+		{
+			s:    `SELECT * FROM topic/sensor1 AS t1 INNER JOIN topic1 AS t2 ON t1.ts > t2.ts - 30sec`,
+			stmt: nil,
+			err:  `found "sec", expected EOF.`,
+		},
+
 		{
 			s: `SELECT * FROM topic/sensor1 AS t1 INNER JOIN topic1 AS t2 ON f=k`,
 			stmt: &SelectStatement{
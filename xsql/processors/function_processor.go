@@ -0,0 +1,86 @@
+package processors
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/emqx/kuiper/udf"
+	"github.com/emqx/kuiper/xsql"
+	"strings"
+)
+
+// ExecCreateFunction runs the statement to create a user-defined function
+func ExecCreateFunction(statement string) (string, error) {
+	stmt, err := xsql.NewParser(strings.NewReader(statement)).ParseCreateStmt()
+	if err != nil {
+		return "", err
+	}
+	s, ok := stmt.(*xsql.FunctionStmt)
+	if !ok {
+		return "", fmt.Errorf("Invalid function statement: %s", statement)
+	}
+	return execCreateFunction(s, statement)
+}
+
+func execCreateFunction(stmt *xsql.FunctionStmt, statement string) (string, error) {
+	m, err := udf.GetManager()
+	if err != nil {
+		return "", err
+	}
+	if err := m.Create(stmt, statement); err != nil {
+		return "", fmt.Errorf("Create function fails: %v.", err)
+	}
+	r := fmt.Sprintf("Function %s is created.", stmt.Name)
+	log.Printf("%s", r)
+	return r, nil
+}
+
+func execShowFunctions() ([]string, error) {
+	m, err := udf.GetManager()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := m.List()
+	if err != nil {
+		return nil, fmt.Errorf("Show functions fails, error when loading data from db: %v.", err)
+	}
+	if len(keys) == 0 {
+		keys = append(keys, "No function definitions are found.")
+	}
+	return keys, nil
+}
+
+func execDescribeFunction(name string) (string, error) {
+	m, err := udf.GetManager()
+	if err != nil {
+		return "", err
+	}
+	stmt, err := m.Describe(name)
+	if err != nil {
+		return "", fmt.Errorf("Describe function fails, %s.", err)
+	}
+	var buff bytes.Buffer
+	buff.WriteString(fmt.Sprintf("Parameters: %s\n", strings.Join(stmt.Params, ", ")))
+	buff.WriteString(fmt.Sprintf("Language: %s\n", stmt.Language))
+	if isAgg, err := udf.IsAggregate(stmt); err != nil {
+		buff.WriteString(fmt.Sprintf("Error: %v\n", err))
+	} else if isAgg {
+		buff.WriteString(fmt.Sprintf("Type: %s\n", xsql.FUNC_TYPE_AGGREGATE))
+	} else {
+		buff.WriteString(fmt.Sprintf("Type: %s\n", xsql.FUNC_TYPE_SCALAR))
+	}
+	buff.WriteString("Body\n--------------------------------------------------------------------------------\n")
+	buff.WriteString(stmt.Body)
+	buff.WriteString("\n")
+	return buff.String(), nil
+}
+
+func ExecDropFunction(name string) (string, error) {
+	m, err := udf.GetManager()
+	if err != nil {
+		return "", err
+	}
+	if err := m.Drop(name); err != nil {
+		return "", fmt.Errorf("Drop function fails: %s.", err)
+	}
+	return fmt.Sprintf("Function %s is dropped.", name), nil
+}
@@ -0,0 +1,67 @@
+package processors
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/xstream/api"
+	"github.com/emqx/kuiper/xstream/states"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestRuleDropSavepoints(t *testing.T) {
+	ruleId := "ruleDropSavepoints"
+	p := NewRuleProcessor(path.Join(DbDir, "ruleTest"))
+	ruleJson := `{"sql": "SELECT * FROM demo", "actions": [{"log": {}}]}`
+	if _, err := p.ExecCreate(ruleId, ruleJson); err != nil {
+		t.Fatal(err)
+	}
+	store, err := states.CreateStore(ruleId, api.AtLeastOnce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveState(1, "op1", map[string]interface{}{"a": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveCheckpoint(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := states.CreateSavepoint(ruleId, "sp1", 1); err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		action string
+		result []string
+		err    string
+	}{
+		{action: "list", result: []string{"sp1"}},
+		{action: "drop"},
+		{action: "list", result: []string{}},
+		{action: "create"},
+		{action: "list", result: []string{}},
+		{action: "drop"},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		var result []string
+		switch tt.action {
+		case "create":
+			_, err = p.ExecCreate(ruleId, ruleJson)
+		case "drop":
+			_, err = p.ExecDrop(ruleId)
+		case "list":
+			var sps []*states.Savepoint
+			sps, err = states.ListSavepoints(ruleId)
+			result = []string{}
+			for _, sp := range sps {
+				result = append(result, sp.Name)
+			}
+		}
+		if !reflect.DeepEqual(tt.err, common.Errstring(err)) {
+			t.Errorf("%d. %s error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.action, tt.err, err)
+		} else if !reflect.DeepEqual(tt.result, result) {
+			t.Errorf("%d. %s result mismatch:\n  exp=%v\n  got=%v\n\n", i, tt.action, tt.result, result)
+		}
+	}
+}
@@ -189,3 +189,53 @@ func TestTableProcessor(t *testing.T) {
 		}
 	}
 }
+
+func TestFunctionProcessor(t *testing.T) {
+	var tests = []struct {
+		s   string
+		r   []string
+		err string
+	}{
+		{
+			s: `CREATE FUNCTION procArea(w, h) AS "w * h";`,
+			r: []string{"Function procArea is created."},
+		},
+		{
+			s:   `CREATE FUNCTION procArea(w) AS "w * w";`,
+			err: "Create function fails: Item procarea already exists.",
+		},
+		{
+			s:   `CREATE FUNCTION procBad(w) AS "w * h";`,
+			err: "Create function fails: unknown parameter h in the body of function procBad.",
+		},
+		{
+			s: `DESCRIBE FUNCTION procArea;`,
+			r: []string{"Parameters: w, h\nLanguage: sql\nType: scalar\nBody\n--------------------------------------------------------------------------------\nw * h\n"},
+		},
+		{
+			s: `DROP FUNCTION procArea;`,
+			r: []string{"Function procArea is dropped."},
+		},
+		{
+			s:   `DESCRIBE FUNCTION procArea;`,
+			err: "Describe function fails, function procArea is not found.",
+		},
+		{
+			s:   `DROP FUNCTION procArea;`,
+			err: "Drop function fails: function procArea is not found.",
+		},
+	}
+
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+
+	for i, tt := range tests {
+		results, err := NewStreamProcessor(path.Join(DbDir, "streamTest")).ExecStmt(tt.s)
+		if !reflect.DeepEqual(tt.err, common.Errstring(err)) {
+			t.Errorf("%d. %q: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.s, tt.err, err)
+		} else if tt.err == "" {
+			if !reflect.DeepEqual(tt.r, results) {
+				t.Errorf("%d. %q\n\nstmt mismatch:\nexp=%s\ngot=%#v\n\n", i, tt.s, tt.r, results)
+			}
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/emqx/kuiper/xstream/api"
 	"github.com/emqx/kuiper/xstream/nodes"
 	"github.com/emqx/kuiper/xstream/planner"
+	"github.com/emqx/kuiper/xstream/states"
 	"os"
 	"path"
 	"strings"
@@ -78,6 +79,20 @@ func (p *StreamProcessor) ExecStmt(statement string) (result []string, err error
 		var r string
 		r, err = p.execDrop(s, xsql.TypeTable)
 		result = append(result, r)
+	case *xsql.FunctionStmt:
+		var r string
+		r, err = execCreateFunction(s, statement)
+		result = append(result, r)
+	case *xsql.ShowFunctionsStatement:
+		result, err = execShowFunctions()
+	case *xsql.DescribeFunctionStatement:
+		var r string
+		r, err = execDescribeFunction(s.Name)
+		result = append(result, r)
+	case *xsql.DropFunctionStatement:
+		var r string
+		r, err = ExecDropFunction(s.Name)
+		result = append(result, r)
 	default:
 		return nil, fmt.Errorf("Invalid stream statement: %s", statement)
 	}
@@ -106,6 +121,32 @@ func (p *StreamProcessor) execSave(stmt *xsql.StreamStmt, statement string, repl
 	return err
 }
 
+// ExecCreateStream only creates the stream or table of the given type. Other statements are rejected so that the
+// statement cannot bypass the permission of the API, such as creating a function by the stream API.
+func (p *StreamProcessor) ExecCreateStream(statement string, st xsql.StreamType) (string, error) {
+	parser := xsql.NewParser(strings.NewReader(statement))
+	stmt, err := xsql.Language.Parse(parser)
+	if err != nil {
+		return "", err
+	}
+	stt := xsql.StreamTypeMap[st]
+	switch s := stmt.(type) {
+	case *xsql.StreamStmt:
+		if s.StreamType != st {
+			return "", fmt.Errorf("Invalid %s statement: %s", stt, statement)
+		}
+		err = p.execSave(s, statement, false)
+		if err != nil {
+			return "", fmt.Errorf("Create %s fails: %v.", stt, err)
+		}
+		info := fmt.Sprintf("%s %s is created.", strings.Title(stt), s.Name)
+		log.Printf("%s", info)
+		return info, nil
+	default:
+		return "", fmt.Errorf("Invalid %s statement: %s", stt, statement)
+	}
+}
+
 func (p *StreamProcessor) ExecReplaceStream(statement string, st xsql.StreamType) (string, error) {
 	parser := xsql.NewParser(strings.NewReader(statement))
 	stmt, err := xsql.Language.Parse(parser)
@@ -185,6 +226,11 @@ func (p *StreamProcessor) getStream(name string, st xsql.StreamType) (string, er
 	return "", common.NewErrorWithCode(common.NOT_FOUND, fmt.Sprintf("%s %s is not found", xsql.StreamTypeMap[st], name))
 }
 
+// GetStatement returns the saved definition of a stream or table
+func (p *StreamProcessor) GetStatement(name string) (*xsql.StreamInfo, error) {
+	return xsql.GetDataSourceStatement(p.db, name)
+}
+
 func (p *StreamProcessor) execDescribe(stmt xsql.NameNode, st xsql.StreamType) (string, error) {
 	streamStmt, err := p.DescStream(stmt.GetName(), st)
 	if err != nil {
@@ -224,6 +270,12 @@ func printOptions(opts *xsql.Options, buff *bytes.Buffer) {
 	if opts.RETAIN_SIZE != 0 {
 		buff.WriteString(fmt.Sprintf("RETAIN_SIZE: %d\n", opts.RETAIN_SIZE))
 	}
+	if opts.SCHEMAID != "" {
+		buff.WriteString(fmt.Sprintf("SCHEMAID: %s\n", opts.SCHEMAID))
+	}
+	if opts.KIND != "" {
+		buff.WriteString(fmt.Sprintf("KIND: %s\n", opts.KIND))
+	}
 	if opts.STRICT_VALIDATION {
 		buff.WriteString(fmt.Sprintf("STRICT_VALIDATION: %v\n", opts.STRICT_VALIDATION))
 	}
@@ -401,6 +453,11 @@ func (p *RuleProcessor) getDefaultRule(name, sql string) *api.Rule {
 	}
 }
 
+// GetRuleByJson parses and validates the rule definition with the default options
+func (p *RuleProcessor) GetRuleByJson(name, ruleJson string) (*api.Rule, error) {
+	return p.getRuleByJson(name, ruleJson)
+}
+
 func (p *RuleProcessor) getRuleByJson(name, ruleJson string) (*api.Rule, error) {
 	opt := common.Config.Rule
 	//set default rule options
@@ -446,6 +503,9 @@ func (p *RuleProcessor) getRuleByJson(name, ruleJson string) (*api.Rule, error)
 	if rule.Options.LateTol < 0 {
 		return nil, fmt.Errorf("rule option lateTolerance %d is invalid, require a positive integer", rule.Options.LateTol)
 	}
+	if rule.Options.AllowedLateness < 0 {
+		return nil, fmt.Errorf("rule option allowedLateness %d is invalid, require a positive integer", rule.Options.AllowedLateness)
+	}
 	return rule, nil
 }
 
@@ -516,6 +576,9 @@ func (p *RuleProcessor) ExecDrop(name string) (string, error) {
 		if err := cleanCheckpoint(name); err != nil {
 			result = fmt.Sprintf("%s. Clean checkpoint cache faile: %s.", result, err)
 		}
+		if err := states.DeleteSavepoints(name); err != nil {
+			result = fmt.Sprintf("%s. Clean savepoints fail: %s.", result, err)
+		}
 	}
 	err = p.db.Delete(name)
 	if err != nil {
@@ -0,0 +1,126 @@
+package xsql
+
+import (
+	"math"
+	"sort"
+)
+
+// The groups with more values than the limit estimate the percentiles by the t-digest instead of sorting all the values
+const percentileExactLimit = 10000
+
+const (
+	// The larger compression keeps more centroids and gives more accurate percentiles
+	tDigestCompression = 200
+	// The number of values buffered before they are merged into the centroids
+	tDigestBufferSize = 1000
+)
+
+type centroid struct {
+	mean  float64
+	count float64
+}
+
+// tDigest is the merging t-digest sketch to estimate the percentiles in one pass with bounded memory. The centroids
+// near the two ends are kept small so that the extreme percentiles are more accurate. Refer to
+// https://github.com/tdunning/t-digest for the details of the algorithm.
+type tDigest struct {
+	centroids []centroid
+	buffer    []centroid
+	count     float64
+	min       float64
+	max       float64
+}
+
+func newTDigest() *tDigest {
+	return &tDigest{
+		buffer: make([]centroid, 0, tDigestBufferSize),
+		min:    math.Inf(1),
+		max:    math.Inf(-1),
+	}
+}
+
+func (t *tDigest) add(v float64) {
+	t.buffer = append(t.buffer, centroid{mean: v, count: 1})
+	t.count++
+	if v < t.min {
+		t.min = v
+	}
+	if v > t.max {
+		t.max = v
+	}
+	if len(t.buffer) == cap(t.buffer) {
+		t.compress()
+	}
+}
+
+// compress merges the buffered values into the centroids. A centroid absorbs its neighbour while its size is within
+// the bound 4*n*q*(1-q)/compression where q is the quantile of the merged centroid.
+func (t *tDigest) compress() {
+	if len(t.buffer) == 0 {
+		return
+	}
+	all := append(t.centroids, t.buffer...)
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+	merged := make([]centroid, 0, len(t.centroids)+1)
+	cur := all[0]
+	var soFar float64
+	for _, c := range all[1:] {
+		q := (soFar + (cur.count+c.count)/2) / t.count
+		if cur.count+c.count <= 4*t.count*q*(1-q)/tDigestCompression {
+			cur.count += c.count
+			cur.mean += (c.mean - cur.mean) * c.count / cur.count
+			continue
+		}
+		soFar += cur.count
+		merged = append(merged, cur)
+		cur = c
+	}
+	t.centroids = append(merged, cur)
+	t.buffer = t.buffer[:0]
+}
+
+// percentileCont estimates the percentile with linear interpolation the same as percentileCont of the sorted values.
+// The i-th value of the sorted values is at the position i+0.5, so the centroid is at the middle of its values.
+func (t *tDigest) percentileCont(p float64) float64 {
+	t.compress()
+	index := p*(t.count-1) + 0.5
+	first, last := t.centroids[0], t.centroids[len(t.centroids)-1]
+	if index <= first.count/2 {
+		return t.min + (first.mean-t.min)*index/(first.count/2)
+	}
+	if index >= t.count-last.count/2 {
+		return t.max - (t.max-last.mean)*(t.count-index)/(last.count/2)
+	}
+	pos := first.count / 2
+	for i := 1; i < len(t.centroids); i++ {
+		c := t.centroids[i]
+		next := pos + (t.centroids[i-1].count+c.count)/2
+		if index <= next {
+			prev := t.centroids[i-1].mean
+			return prev + (c.mean-prev)*(index-pos)/(next-pos)
+		}
+		pos = next
+	}
+	return t.max
+}
+
+// percentileDisc estimates the percentile by the mean of the centroid which contains the value whose cumulative
+// distribution is not less than the percentile
+func (t *tDigest) percentileDisc(p float64) float64 {
+	t.compress()
+	rank := math.Ceil(p * t.count)
+	if rank <= 1 {
+		return t.min
+	}
+	if rank >= t.count {
+		return t.max
+	}
+	var soFar float64
+	for _, c := range t.centroids {
+		soFar += c.count
+		if rank <= soFar {
+			return c.mean
+		}
+	}
+	return t.max
+}
@@ -0,0 +1,74 @@
+package xsql
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestTDigest(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var tests = []struct {
+		name string
+		n    int
+		gen  func(i int) float64
+		// The max error of the rank of the estimated percentile relative to the count of the values
+		rankErr float64
+	}{
+		{
+			name:    "small",
+			n:       100,
+			gen:     func(i int) float64 { return float64((i * 37) % 100) },
+			rankErr: 0,
+		}, {
+			name:    "uniform",
+			n:       100000,
+			gen:     func(_ int) float64 { return r.Float64() * 1000 },
+			rankErr: 0.005,
+		}, {
+			name:    "normal",
+			n:       100000,
+			gen:     func(_ int) float64 { return r.NormFloat64()*10 + 50 },
+			rankErr: 0.005,
+		}, {
+			name:    "duplicate",
+			n:       100000,
+			gen:     func(_ int) float64 { return float64(r.Intn(5)) },
+			rankErr: 0,
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		d := newTDigest()
+		sorted := make([]float64, tt.n)
+		for j := range sorted {
+			sorted[j] = tt.gen(j)
+			d.add(sorted[j])
+		}
+		sort.Float64s(sorted)
+		n := float64(len(sorted))
+		for _, p := range []float64{0, 0.001, 0.01, 0.25, 0.5, 0.75, 0.99, 0.999, 1} {
+			for _, c := range []struct {
+				f     string
+				exact float64
+				est   float64
+			}{
+				{"cont", percentileCont(sorted, p), d.percentileCont(p)},
+				{"disc", percentileDisc(sorted, p), d.percentileDisc(p)},
+			} {
+				// Compare the ranks so that the error does not depend on the distribution
+				lower := float64(sort.SearchFloat64s(sorted, c.est))
+				upper := float64(sort.Search(len(sorted), func(j int) bool { return sorted[j] > c.est }))
+				expected := p * (n - 1)
+				if c.f == "disc" {
+					expected = math.Max(math.Ceil(p*n)-1, 0)
+				}
+				if expected < lower-tt.rankErr*n-1 || expected > upper+tt.rankErr*n {
+					t.Errorf("%d. %s percentile_%s(%v)\n\nresult mismatch:\n\nexp=%v\n\ngot=%v, rank [%v, %v] of %v\n\n", i, tt.name, c.f, p, c.exact, c.est, lower, upper, expected)
+				}
+			}
+		}
+	}
+}
@@ -17,6 +17,29 @@ func Validate(stmt *SelectStatement) error {
 		}
 	}
 
+	unnests := 0
+	for _, f := range stmt.Fields {
+		if IsUnnest(f.Expr) {
+			unnests++
+		}
+	}
+	if unnests > 1 {
+		return fmt.Errorf("Only one unnest function is allowed in the select fields.")
+	}
+	for _, node := range []Node{stmt.Fields, stmt.Condition, stmt.Dimensions, stmt.Having, stmt.Joins} {
+		if node == nil {
+			continue
+		}
+		WalkFunc(node, func(n Node) {
+			if c, ok := n.(*Call); ok && IsUnnest(c) {
+				unnests--
+			}
+		})
+	}
+	if unnests < 0 {
+		return fmt.Errorf("The unnest function can only be used as a select field.")
+	}
+
 	//Cannot GROUP BY alias fields with aggregate funcs
 	//	for _, d := range stmt.Dimensions {
 	//		if f, ok := d.Expr.(*FieldRef); ok {
@@ -86,13 +86,17 @@ func doPrintFieldTypeForJson(ft FieldType) (result string, isLiteral bool) {
 	return result, false
 }
 
+// GetStreams returns the names of all the streams and tables of the statement, including those used in the subqueries
 func GetStreams(stmt *SelectStatement) (result []string) {
 	if stmt == nil {
 		return nil
 	}
 	for _, source := range stmt.Sources {
-		if s, ok := source.(*Table); ok {
+		switch s := source.(type) {
+		case *Table:
 			result = append(result, s.Name)
+		case *SubQuery:
+			result = append(result, GetStreams(s.Stmt)...)
 		}
 	}
 
@@ -115,7 +119,14 @@ func LowercaseKeyMap(m map[string]interface{}) map[string]interface{} {
 }
 
 func GetStatementFromSql(sql string) (*SelectStatement, error) {
+	return GetStatementWithPendingFuncs(sql, nil)
+}
+
+// GetStatementWithPendingFuncs parses the select statement which may call the functions to be created. The calls of
+// the pending functions are not validated.
+func GetStatementWithPendingFuncs(sql string, pendingFuncs map[string]bool) (*SelectStatement, error) {
 	parser := NewParser(strings.NewReader(sql))
+	parser.pendingFuncs = pendingFuncs
 	if stmt, err := Language.Parse(parser); err != nil {
 		return nil, fmt.Errorf("Parse SQL %s error: %s.", sql, err)
 	} else {
@@ -324,6 +324,93 @@ func TestCase(t *testing.T) {
 	}
 }
 
+func TestPredicate(t *testing.T) {
+	data := []struct {
+		m Message
+		r []interface{}
+	}{
+		{
+			m: map[string]interface{}{
+				"a": int64(32),
+				"b": "Kuiper_rule",
+				"c": []interface{}{float64(1), float64(32)},
+			},
+			r: []interface{}{
+				true, false, true, false, true,
+				true, false, true,
+				false, true, true,
+				true, errors.New("invalid operation NOT int64(32)"), false,
+			},
+		}, {
+			m: map[string]interface{}{
+				"a": float64(72),
+				"b": "kuiper rule",
+				"c": []interface{}{},
+			},
+			r: []interface{}{
+				false, true, false, true, false,
+				false, true, false,
+				false, true, true,
+				false, errors.New("invalid operation NOT float64(72)"), true,
+			},
+		}, {
+			m: map[string]interface{}{
+				"a": "32",
+				"b": int64(1),
+			},
+			r: []interface{}{
+				errors.New("invalid operation string(32) = int64(1)"), errors.New("invalid operation string(32) = int64(1)"), errors.New("invalid operation string(32) >= int64(30)"), errors.New("invalid operation string(32) >= int64(30)"), false,
+				errors.New("invalid operation int64(1) LIKE, the left side must be a string"), errors.New("invalid operation int64(1) LIKE, the left side must be a string"), errors.New("invalid operation int64(1) LIKE, the left side must be a string"),
+				false, true, false,
+				errors.New("invalid operation string(32) = int64(1)"), errors.New("invalid operation NOT string(32)"), errors.New("invalid operation string(32) = int64(1)"),
+			},
+		}, {
+			m: map[string]interface{}{},
+			r: []interface{}{
+				false, true, false, true, false,
+				false, true, false,
+				true, false, true,
+				false, nil, true,
+			},
+		},
+	}
+	sqls := []string{
+		"select * from src where a IN (1, 32, 50)",
+		"select * from src where a NOT IN (1, 32, 50)",
+		"select * from src where a BETWEEN 30 AND 40",
+		"select * from src where a NOT BETWEEN 30 AND 20 + 20",
+		"select * from src where a IN c",
+		"select * from src where b LIKE \"Kuiper%\"",
+		"select * from src where b NOT LIKE \"_uiper\\\\_%\"",
+		"select * from src where b LIKE \"%\\\\_rule\"",
+		"select * from src where a IS NULL",
+		"select * from src where a IS NOT NULL",
+		"select * from src where c IS NOT NULL OR b IS NULL",
+		"select * from src where a IN (1, 32) AND a BETWEEN 30 AND 40",
+		"select * from src where NOT a",
+		"select * from src where NOT a IN (1, 32) OR a IS NULL",
+	}
+	var conditions []Expr
+	for _, sql := range sqls {
+		stmt, err := NewParser(strings.NewReader(sql)).Parse()
+		if err != nil {
+			t.Errorf("parse sql %s error: %v", sql, err)
+		}
+		conditions = append(conditions, stmt.Condition)
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(data)*len(sqls))
+	for i, tt := range data {
+		for j, c := range conditions {
+			tuple := &Tuple{Emitter: "src", Message: tt.m, Timestamp: common.GetNowInMilli(), Metadata: nil}
+			ve := &ValuerEval{Valuer: MultiValuer(tuple)}
+			result := ve.Eval(c)
+			if !reflect.DeepEqual(tt.r[j], result) {
+				t.Errorf("%d-%d. \nstmt mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, j, tt.r[j], result)
+			}
+		}
+	}
+}
+
 func TestArray(t *testing.T) {
 	data := []struct {
 		m Message
@@ -2,6 +2,7 @@ package xsql
 
 import (
 	"fmt"
+	"strings"
 )
 
 var (
@@ -47,6 +48,11 @@ func init() {
 		return p.Parse()
 	})
 
+	// The select statement with common table expressions
+	Language.Handle(WITH, func(p *Parser) (Statement, error) {
+		return p.Parse()
+	})
+
 	Language.Handle(CREATE, func(p *Parser) (statement Statement, e error) {
 		return p.ParseCreateStmt()
 	})
@@ -74,3 +80,12 @@ func InitFuncRegisters(registers ...FunctionRegister) {
 	FuncRegisters = registers
 	parserFuncRuntime = NewFuncRuntime(nil, registers)
 }
+
+// UnloadFunction removes the cached instance of the custom function so that the parser loads it again when it is
+// redefined. The running rules keep their instances until they are restarted.
+func UnloadFunction(name string) {
+	parserFuncRuntime.remove(name)
+	customAggLock.Lock()
+	delete(customAggFuncMap, strings.ToLower(name))
+	customAggLock.Unlock()
+}
@@ -0,0 +1,84 @@
+package xsql
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/emqx/kuiper/xstream/api"
+	"github.com/emqx/kuiper/xstream/contexts"
+)
+
+// countFunc is a custom function which counts the values if it is an aggregate function or returns the value otherwise
+type countFunc struct {
+	agg bool
+}
+
+func (f *countFunc) Validate(_ []interface{}) error {
+	return nil
+}
+
+func (f *countFunc) Exec(args []interface{}, _ api.FunctionContext) (interface{}, bool) {
+	if f.agg {
+		return len(args[0].([]interface{})), true
+	}
+	return args[0], true
+}
+
+func (f *countFunc) IsAggregate() bool {
+	return f.agg
+}
+
+type countRegister struct {
+	agg bool
+}
+
+func (r *countRegister) HasFunction(name string) bool {
+	return name == "mycount"
+}
+
+func (r *countRegister) Function(_ string) (api.Function, error) {
+	return &countFunc{agg: r.agg}, nil
+}
+
+func TestUnloadFunction(t *testing.T) {
+	saved := FuncRegisters
+	defer InitFuncRegisters(saved...)
+	reg := &countRegister{agg: true}
+	InitFuncRegisters(reg)
+	call := &Call{Name: "mycount"}
+	if !isAggFunc(call) {
+		t.Fatalf("mycount is not an aggregate function")
+	}
+	// The valuer of a running rule
+	fv, afv := NewFunctionValuersForOp(contexts.Background(), FuncRegisters)
+	valuer := MultiAggregateValuer(nil, fv, fv, afv)
+	args := []interface{}{[]interface{}{1, 2, 3}}
+	if r, ok := valuer.(CallValuer).Call("mycount", args); !ok || r != 3 {
+		t.Errorf("result mismatch before unloading, got %v", r)
+	}
+
+	// Redefine the function as a non aggregate function while the rules are planned
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			isAggFunc(call)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			UnloadFunction("mycount")
+		}
+	}()
+	wg.Wait()
+	reg.agg = false
+	UnloadFunction("mycount")
+	if isAggFunc(call) {
+		t.Errorf("mycount is still an aggregate function after it is redefined")
+	}
+	if r, ok := valuer.(CallValuer).Call("mycount", args); !ok || r != 3 {
+		t.Errorf("result mismatch of the running rule after unloading, got %v", r)
+	}
+}
@@ -81,7 +81,7 @@ func TestParser_ParseTree(t *testing.T) {
 		{
 			s:    `SHOW STREAMSf`,
 			stmt: nil,
-			err:  `found "STREAMSf", expected keyword streams or tables.`,
+			err:  `found "STREAMSf", expected keyword streams, tables or functions.`,
 		},
 
 		{
@@ -136,6 +136,69 @@ func TestParser_ParseTree(t *testing.T) {
 			},
 			err: ``,
 		},
+		{
+			s: `CREATE FUNCTION area(w, h) AS "w * h";`,
+			stmt: &FunctionStmt{
+				Name:     "area",
+				Params:   []string{"w", "h"},
+				Body:     "w * h",
+				Language: FUNC_LANG_SQL,
+			},
+		},
+		{
+			s: `CREATE FUNCTION total(v) AS "return len(v)" WITH (LANGUAGE="Starlark", TYPE="aggregate")`,
+			stmt: &FunctionStmt{
+				Name:     "total",
+				Params:   []string{"v"},
+				Body:     "return len(v)",
+				Language: FUNC_LANG_STARLARK,
+				FuncType: FUNC_TYPE_AGGREGATE,
+			},
+		},
+		{
+			s: `CREATE FUNCTION now2() AS "now()"`,
+			stmt: &FunctionStmt{
+				Name:     "now2",
+				Body:     "now()",
+				Language: FUNC_LANG_SQL,
+			},
+		},
+		{
+			s:   `CREATE FUNCTION area(w, w) AS "w * w"`,
+			err: `duplicate parameter w in function area.`,
+		},
+		{
+			s:   `CREATE FUNCTION area(w, h) "w * h"`,
+			err: `found "w * h", expected keyword as.`,
+		},
+		{
+			s:   `CREATE FUNCTION abs(a) AS "a"`,
+			err: `function abs is a built-in function`,
+		},
+		{
+			s:   `CREATE FUNCTION area(w, h) AS "w * h" WITH (LANGUAGE="lua")`,
+			err: `option 'language=lua' is invalid, expect sql or starlark`,
+		},
+		{
+			s:   `CREATE FUNCTION area(w, h) AS "w * h" WITH (KIND="scan")`,
+			err: `found "KIND", unknown option keys(LANGUAGE|TYPE).`,
+		},
+		{
+			s:    `SHOW FUNCTIONS`,
+			stmt: &ShowFunctionsStatement{},
+		},
+		{
+			s: `DESCRIBE FUNCTION area`,
+			stmt: &DescribeFunctionStatement{
+				Name: "area",
+			},
+		},
+		{
+			s: `DROP FUNCTION area`,
+			stmt: &DropFunctionStatement{
+				Name: "area",
+			},
+		},
 	}
 
 	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
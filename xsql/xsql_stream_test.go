@@ -239,7 +239,7 @@ func TestParser_ParseCreateStream(t *testing.T) {
 				StreamFields: nil,
 				Options:      nil,
 			},
-			err: `found "sources", unknown option keys(DATASOURCE|FORMAT|KEY|CONF_KEY|STRICT_VALIDATION|TYPE|TIMESTAMP|TIMESTAMP_FORMAT|RETAIN_SIZE).`,
+			err: `found "sources", unknown option keys(DATASOURCE|FORMAT|KEY|CONF_KEY|STRICT_VALIDATION|TYPE|TIMESTAMP|TIMESTAMP_FORMAT|RETAIN_SIZE|SCHEMAID|KIND).`,
 		},
 
 		{
@@ -396,6 +396,92 @@ func TestParser_ParseCreateStream(t *testing.T) {
 					FORMAT:     "BINARY",
 				},
 			},
+		}, {
+			s: `CREATE STREAM demo (
+					name STRING
+				) WITH (DATASOURCE="users", FORMAT="PROTOBUF", SCHEMAID="hw.HelloRequest");`,
+			stmt: &StreamStmt{
+				Name: StreamName("demo"),
+				StreamFields: []StreamField{
+					{Name: "name", FieldType: &BasicType{Type: STRINGS}},
+				},
+				Options: &Options{
+					DATASOURCE: "users",
+					FORMAT:     "PROTOBUF",
+					SCHEMAID:   "hw.HelloRequest",
+				},
+			},
+		}, {
+			s: `CREATE STREAM demo (
+					name STRING
+				) WITH (DATASOURCE="users", FORMAT="PROTOBUF");`,
+			stmt: &StreamStmt{
+				Name:         "",
+				StreamFields: nil,
+				Options:      nil,
+			},
+			err: "option 'schemaid' is required for 'protobuf' format",
+		}, {
+			s: `CREATE STREAM demo () WITH (DATASOURCE="users", FORMAT="avro");`,
+			stmt: &StreamStmt{
+				Name:         "",
+				StreamFields: nil,
+				Options:      nil,
+			},
+			err: "option 'schemaid' is required for 'avro' format",
+		}, {
+			s: `CREATE STREAM demo () WITH (DATASOURCE="users", FORMAT="CSV", SCHEMAID="id,name");`,
+			stmt: &StreamStmt{
+				Name:         StreamName("demo"),
+				StreamFields: nil,
+				Options: &Options{
+					DATASOURCE: "users",
+					FORMAT:     "CSV",
+					SCHEMAID:   "id,name",
+				},
+			},
+		}, {
+			s: `CREATE STREAM demo () WITH (DATASOURCE="users", FORMAT="THRIFT");`,
+			stmt: &StreamStmt{
+				Name:         "",
+				StreamFields: nil,
+				Options:      nil,
+			},
+			err: "option 'format=THRIFT' is invalid",
+		}, {
+			s: `CREATE TABLE demo (
+					id BIGINT,
+					name STRING
+				) WITH (DATASOURCE="users", TYPE="sql", KIND="lookup");`,
+			stmt: &StreamStmt{
+				Name: StreamName("demo"),
+				StreamFields: []StreamField{
+					{Name: "id", FieldType: &BasicType{Type: BIGINT}},
+					{Name: "name", FieldType: &BasicType{Type: STRINGS}},
+				},
+				Options: &Options{
+					DATASOURCE: "users",
+					TYPE:       "sql",
+					KIND:       "lookup",
+				},
+				StreamType: TypeTable,
+			},
+		}, {
+			s: `CREATE STREAM demo () WITH (DATASOURCE="users", KIND="lookup");`,
+			stmt: &StreamStmt{
+				Name:         "",
+				StreamFields: nil,
+				Options:      nil,
+			},
+			err: "option 'kind=lookup' is only supported for table",
+		}, {
+			s: `CREATE TABLE demo () WITH (DATASOURCE="users", KIND="cache");`,
+			stmt: &StreamStmt{
+				Name:         "",
+				StreamFields: nil,
+				Options:      nil,
+			},
+			err: "option 'kind=cache' is invalid, expect scan or lookup",
 		},
 	}
 
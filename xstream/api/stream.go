@@ -71,6 +71,24 @@ type TableSource interface {
 	Configure(datasource string, props map[string]interface{}) error
 }
 
+type LookupSource interface {
+	//Called when the rule starts. Connect to the external store
+	Open(ctx StreamContext) error
+	//Called during initialization. Configure the source with the data source(e.g. table name for sql) and the properties
+	//read from the yaml
+	Configure(datasource string, props map[string]interface{}) error
+	//Query the rows whose key columns equal to the values. The fields are the columns to return, nil for all columns
+	Lookup(ctx StreamContext, fields []string, keys []string, values []interface{}) ([]map[string]interface{}, error)
+	Closable
+}
+
+// BatchLookupSource queries multiple sets of key values in one round trip
+type BatchLookupSource interface {
+	LookupSource
+	//Query the rows for each set of key values. The result must be in the same order of the values
+	LookupBatch(ctx StreamContext, fields []string, keys []string, values [][]interface{}) ([][]map[string]interface{}, error)
+}
+
 type Sink interface {
 	//Should be sync function for normal case. The container will run it in go func
 	Open(ctx StreamContext) error
@@ -81,6 +99,25 @@ type Sink interface {
 	Closable
 }
 
+// TwoPhaseCommitSink writes the data in transactions which are aligned with the checkpoints. For the rules of exactly
+// once qos, the data collected between two checkpoints belongs to one transaction which is pre-committed when the
+// checkpoint barrier arrives and committed when the checkpoint completes. The methods may be called in different
+// goroutines with Collect.
+type TwoPhaseCommitSink interface {
+	Sink
+	//Start a new transaction. The data collected after it belongs to the transaction
+	Begin(ctx StreamContext) error
+	//Called when the checkpoint barrier arrives. Persist the current transaction so that it can be committed later,
+	//even after restarting. The state saved by ctx.PutState in it is included in the checkpoint
+	PreCommit(ctx StreamContext, checkpointId int64) error
+	//Make all the pre-committed transactions of the checkpoint and the previous ones visible. Must be idempotent as
+	//it is called again when restoring from the checkpoint
+	Commit(ctx StreamContext, checkpointId int64) error
+	//Called when restoring from a checkpoint after the pre-committed transactions of it are committed. Discard all
+	//the other transactions
+	Abort(ctx StreamContext) error
+}
+
 type Emitter interface {
 	AddOutput(chan<- interface{}, string) error
 }
@@ -101,6 +138,7 @@ type Rewindable interface {
 type RuleOption struct {
 	IsEventTime        bool  `json:"isEventTime" yaml:"isEventTime"`
 	LateTol            int64 `json:"lateTolerance" yaml:"lateTolerance"`
+	AllowedLateness    int64 `json:"allowedLateness" yaml:"allowedLateness"`
 	Concurrency        int   `json:"concurrency" yaml:"concurrency"`
 	BufferLength       int   `json:"bufferLength" yaml:"bufferLength"`
 	SendMetaToSink     bool  `json:"sendMetaToSink" yaml:"sendMetaToSink"`
@@ -1,6 +1,7 @@
 package checkpoints
 
 import (
+	"fmt"
 	"github.com/benbjohnson/clock"
 	"github.com/emqx/kuiper/common"
 	"github.com/emqx/kuiper/xstream/api"
@@ -83,6 +84,14 @@ type Coordinator struct {
 	store                   api.Store
 	ctx                     api.StreamContext
 	activated               bool
+	manual                  chan chan<- *manualResult //trigger a checkpoint manually like savepoint
+	waiters                 *sync.Map                 //checkpointId -> chan<- *manualResult
+	lastCheckpointId        int64
+}
+
+type manualResult struct {
+	checkpointId int64
+	err          error
 }
 
 func NewCoordinator(ruleId string, sources []StreamTask, operators []NonSourceTask, sinks []SinkTask, qos api.Qos, store api.Store, interval int, ctx api.StreamContext) *Coordinator {
@@ -128,6 +137,8 @@ func NewCoordinator(ruleId string, sources []StreamTask, operators []NonSourceTa
 		timeout:      200000,
 		store:        store,
 		ctx:          ctx,
+		manual:       make(chan chan<- *manualResult),
+		waiters:      new(sync.Map),
 	}
 }
 
@@ -159,33 +170,14 @@ func (c *Coordinator) Activate() error {
 
 				// TODO Check if all tasks are running
 
-				//Create a pending checkpoint
-				checkpointId := common.TimeToUnixMilli(n)
-				checkpoint := newPendingCheckpoint(checkpointId, c.tasksToWaitFor)
-				logger.Debugf("Create checkpoint %d", checkpointId)
-				c.pendingCheckpoints.Store(checkpointId, checkpoint)
-				//Let the sources send out a barrier
-				for _, r := range c.tasksToTrigger {
-					go func(t Responder) {
-						if err := t.TriggerCheckpoint(checkpointId); err != nil {
-							logger.Infof("Fail to trigger checkpoint for source %s with error %v, cancel it", t.GetName(), err)
-							c.cancel(checkpointId)
-						} else {
-							timeout := common.GetTicker(c.timeout)
-							select {
-							case <-timeout.C:
-								logger.Debugf("Try to cancel checkpoint %d for timeout", checkpointId)
-								c.cancel(checkpointId)
-							case <-c.ctx.Done():
-								if timeout != nil {
-									timeout.Stop()
-									logger.Infoln("Stop ongoing checkpoint %d", checkpointId)
-									c.cancel(checkpointId)
-								}
-							}
-						}
-					}(r)
+				c.triggerCheckpoint(common.TimeToUnixMilli(n))
+			case w := <-c.manual:
+				checkpointId := common.GetNowInMilli()
+				if checkpointId <= c.lastCheckpointId {
+					checkpointId = c.lastCheckpointId + 1
 				}
+				c.waiters.Store(checkpointId, w)
+				c.triggerCheckpoint(checkpointId)
 			case s := <-c.signal:
 				switch s.Message {
 				case STOP:
@@ -222,6 +214,63 @@ func (c *Coordinator) Activate() error {
 	return nil
 }
 
+func (c *Coordinator) triggerCheckpoint(checkpointId int64) {
+	logger := c.ctx.GetLogger()
+	c.lastCheckpointId = checkpointId
+	//Create a pending checkpoint
+	checkpoint := newPendingCheckpoint(checkpointId, c.tasksToWaitFor)
+	logger.Debugf("Create checkpoint %d", checkpointId)
+	c.pendingCheckpoints.Store(checkpointId, checkpoint)
+	//Let the sources send out a barrier
+	for _, r := range c.tasksToTrigger {
+		go func(t Responder) {
+			if err := t.TriggerCheckpoint(checkpointId); err != nil {
+				logger.Infof("Fail to trigger checkpoint for source %s with error %v, cancel it", t.GetName(), err)
+				c.cancel(checkpointId)
+			} else {
+				timeout := common.GetTicker(c.timeout)
+				select {
+				case <-timeout.C:
+					logger.Debugf("Try to cancel checkpoint %d for timeout", checkpointId)
+					c.cancel(checkpointId)
+				case <-c.ctx.Done():
+					if timeout != nil {
+						timeout.Stop()
+						logger.Infoln("Stop ongoing checkpoint %d", checkpointId)
+						c.cancel(checkpointId)
+					}
+				}
+			}
+		}(r)
+	}
+}
+
+// TriggerCheckpoint triggers a checkpoint immediately and waits until it completes. Return the completed checkpoint id
+func (c *Coordinator) TriggerCheckpoint() (int64, error) {
+	if !c.activated {
+		return 0, fmt.Errorf("checkpoint coordinator of rule %s is not activated", c.ruleId)
+	}
+	w := make(chan *manualResult, 1)
+	select {
+	case c.manual <- w:
+	case <-c.ctx.Done():
+		return 0, fmt.Errorf("rule %s is stopped", c.ruleId)
+	}
+	select {
+	case r := <-w:
+		return r.checkpointId, r.err
+	case <-c.ctx.Done():
+		return 0, fmt.Errorf("rule %s is stopped", c.ruleId)
+	}
+}
+
+func (c *Coordinator) notifyWaiter(checkpointId int64, err error) {
+	if w, ok := c.waiters.Load(checkpointId); ok {
+		c.waiters.Delete(checkpointId)
+		w.(chan<- *manualResult) <- &manualResult{checkpointId: checkpointId, err: err}
+	}
+}
+
 func (c *Coordinator) Deactivate() error {
 	if c.ticker != nil {
 		c.ticker.Stop()
@@ -235,6 +284,7 @@ func (c *Coordinator) cancel(checkpointId int64) {
 	if checkpoint, ok := c.pendingCheckpoints.Load(checkpointId); ok {
 		c.pendingCheckpoints.Delete(checkpointId)
 		checkpoint.(*pendingCheckpoint).dispose(true)
+		c.notifyWaiter(checkpointId, fmt.Errorf("checkpoint %d is cancelled", checkpointId))
 	} else {
 		logger.Debugf("Cancel for non existing checkpoint %d. Just ignored", checkpointId)
 	}
@@ -247,12 +297,14 @@ func (c *Coordinator) complete(checkpointId int64) {
 		err := c.store.SaveCheckpoint(checkpointId)
 		if err != nil {
 			logger.Infof("Cannot save checkpoint %d due to storage error: %v", checkpointId, err)
+			c.notifyWaiter(checkpointId, err)
 			//TODO handle checkpoint error
 			return
 		}
-		//sink save cache
+		//sink save cache and commit the transactions
 		for _, sink := range c.sinkTasks {
 			sink.SaveCache()
+			sink.Commit(checkpointId)
 		}
 		c.completedCheckpoints.add(ccp.(*pendingCheckpoint).finalize())
 		c.pendingCheckpoints.Delete(checkpointId)
@@ -264,9 +316,11 @@ func (c *Coordinator) complete(checkpointId int64) {
 				//TODO revisit how to abort a checkpoint, discard callback
 				cp.isDiscarded = true
 				c.pendingCheckpoints.Delete(cid)
+				c.notifyWaiter(cid, fmt.Errorf("checkpoint %d is discarded", cid))
 			}
 			return true
 		})
+		c.notifyWaiter(checkpointId, nil)
 		logger.Debugf("Totally complete checkpoint %d", checkpointId)
 	} else {
 		logger.Infof("Cannot find checkpoint %d to complete", checkpointId)
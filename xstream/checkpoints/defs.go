@@ -23,6 +23,10 @@ type SinkTask interface {
 	NonSourceTask
 
 	SaveCache()
+	//Pre-commit the transactions of the sinks before taking the snapshot
+	PreCommit(checkpointId int64) error
+	//Commit the transactions of the sinks after the checkpoint completes
+	Commit(checkpointId int64)
 }
 
 type BufferOrEvent struct {
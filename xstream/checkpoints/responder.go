@@ -39,6 +39,12 @@ func (re *ResponderExecutor) TriggerCheckpoint(checkpointId int64) error {
 	}
 	//broadcast barrier
 	re.task.Broadcast(barrier)
+	//Sinks persist the transactions before the snapshot so that they are restorable
+	if st, ok := re.task.(SinkTask); ok {
+		if err := st.PreCommit(checkpointId); err != nil {
+			return err
+		}
+	}
 	//Save key state to the global state
 	err := sctx.Snapshot()
 	if err != nil {
@@ -6,7 +6,10 @@ import (
 	"github.com/emqx/kuiper/common"
 	"github.com/go-yaml/yaml"
 	"github.com/urfave/cli"
+	"io"
 	"io/ioutil"
+	"net"
+	"net/http"
 	"net/rpc"
 	"os"
 	"sort"
@@ -17,6 +20,8 @@ import (
 type clientConf struct {
 	Host string `yaml:"host"`
 	Port int    `yaml:"port"`
+	// The api token or JWT token if the authentication of the server is enabled
+	Token string `yaml:"token"`
 }
 
 var clientYaml = "client.yaml"
@@ -74,9 +79,13 @@ func main() {
 
 	fmt.Printf("Connecting to %s:%d... \n", config.Host, config.Port)
 	// Create a TCP connection to localhost on port 1234
-	client, err := rpc.DialHTTP("tcp", fmt.Sprintf("%s:%d", config.Host, config.Port))
+	client, err := dialHTTP(fmt.Sprintf("%s:%d", config.Host, config.Port), config.Token)
 	if err != nil {
-		fmt.Printf("Failed to connect the server, please start the server.\n")
+		if _, ok := err.(*authError); ok {
+			fmt.Println(err)
+		} else {
+			fmt.Printf("Failed to connect the server, please start the server.\n")
+		}
 		return
 	}
 
@@ -134,7 +143,7 @@ func main() {
 		{
 			Name:    "create",
 			Aliases: []string{"create"},
-			Usage:   "create stream $stream_name | create stream $stream_name -f $stream_def_file | create table $table_name | create table $table_name -f $table_def_file| create rule $rule_name $rule_json | create rule $rule_name -f $rule_def_file | create plugin $plugin_type $plugin_name $plugin_json | create plugin $plugin_type $plugin_name -f $plugin_def_file | create service $service_name $service_json ",
+			Usage:   "create stream $stream_name | create stream $stream_name -f $stream_def_file | create table $table_name | create table $table_name -f $table_def_file| create function $function_name | create function $function_name -f $function_def_file | create rule $rule_name $rule_json | create rule $rule_name -f $rule_def_file | create plugin $plugin_type $plugin_name $plugin_json | create plugin $plugin_type $plugin_name -f $plugin_def_file | create service $service_name $service_json | create secret $secret_name $secret_json",
 
 			Subcommands: []cli.Command{
 				{
@@ -191,6 +200,33 @@ func main() {
 						}
 					},
 				},
+				{
+					Name:  "function",
+					Usage: "create function $function_name [-f function_def_file]",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "file, f",
+							Usage:    "the location of function definition file",
+							FilePath: "/home/myfunction.txt",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						sfile := c.String("file")
+						if sfile != "" {
+							if function, err := readDef(sfile, "function"); err != nil {
+								fmt.Printf("%s", err)
+								return nil
+							} else {
+								args := strings.Join([]string{"CREATE FUNCTION ", string(function)}, " ")
+								streamProcess(client, args)
+								return nil
+							}
+						} else {
+							streamProcess(client, "")
+							return nil
+						}
+					},
+				},
 				{
 					Name:  "rule",
 					Usage: "create rule $rule_name [$rule_json | -f rule_def_file]",
@@ -319,12 +355,33 @@ func main() {
 						return nil
 					},
 				},
+				{
+					Name:  "secret",
+					Usage: "create secret $secret_name $secret_json",
+					Action: func(c *cli.Context) error {
+						if len(c.Args()) < 2 {
+							fmt.Printf("Expect secret name and json.\n")
+							return nil
+						}
+						var reply string
+						err = client.Call("Server.CreateSecret", &common.RPCArgDesc{
+							Name: c.Args()[0],
+							Json: c.Args()[1],
+						}, &reply)
+						if err != nil {
+							fmt.Println(err)
+						} else {
+							fmt.Println(reply)
+						}
+						return nil
+					},
+				},
 			},
 		},
 		{
 			Name:    "describe",
 			Aliases: []string{"describe"},
-			Usage:   "describe stream $stream_name | describe table $table_name | describe rule $rule_name | describe plugin $plugin_type $plugin_name | describe udf $udf_name | describe service $service_name | describe service_func $service_func_name",
+			Usage:   "describe stream $stream_name | describe table $table_name | describe function $function_name | describe rule $rule_name | describe plugin $plugin_type $plugin_name | describe udf $udf_name | describe service $service_name | describe service_func $service_func_name | describe secret $secret_name",
 			Subcommands: []cli.Command{
 				{
 					Name:  "stream",
@@ -344,6 +401,15 @@ func main() {
 						return nil
 					},
 				},
+				{
+					Name:  "function",
+					Usage: "describe function $function_name",
+					//Flags: nflag,
+					Action: func(c *cli.Context) error {
+						streamProcess(client, "")
+						return nil
+					},
+				},
 				{
 					Name:  "rule",
 					Usage: "describe rule $rule_name",
@@ -453,13 +519,31 @@ func main() {
 						return nil
 					},
 				},
+				{
+					Name:  "secret",
+					Usage: "describe secret $secret_name",
+					Action: func(c *cli.Context) error {
+						if len(c.Args()) != 1 {
+							fmt.Printf("Expect secret name.\n")
+							return nil
+						}
+						var reply string
+						err = client.Call("Server.DescSecret", c.Args()[0], &reply)
+						if err != nil {
+							fmt.Println(err)
+						} else {
+							fmt.Println(reply)
+						}
+						return nil
+					},
+				},
 			},
 		},
 
 		{
 			Name:    "drop",
 			Aliases: []string{"drop"},
-			Usage:   "drop stream $stream_name | drop table $table_name |drop rule $rule_name | drop plugin $plugin_type $plugin_name -r $stop | drop service $service_name",
+			Usage:   "drop stream $stream_name | drop table $table_name | drop function $function_name |drop rule $rule_name | drop plugin $plugin_type $plugin_name -r $stop | drop service $service_name | drop savepoint $rule_name $savepoint_name | drop secret $secret_name",
 			Subcommands: []cli.Command{
 				{
 					Name:  "stream",
@@ -479,6 +563,15 @@ func main() {
 						return nil
 					},
 				},
+				{
+					Name:  "function",
+					Usage: "drop function $function_name",
+					//Flags: nflag,
+					Action: func(c *cli.Context) error {
+						streamProcess(client, "")
+						return nil
+					},
+				},
 				{
 					Name:  "rule",
 					Usage: "drop rule $rule_name",
@@ -499,6 +592,24 @@ func main() {
 						return nil
 					},
 				},
+				{
+					Name:  "savepoint",
+					Usage: "drop savepoint $rule_name $savepoint_name",
+					Action: func(c *cli.Context) error {
+						if len(c.Args()) != 2 {
+							fmt.Printf("Expect rule name and savepoint name.\n")
+							return nil
+						}
+						var reply string
+						err = client.Call("Server.DropSavepoint", &common.RPCArgDesc{Name: c.Args()[0], Json: c.Args()[1]}, &reply)
+						if err != nil {
+							fmt.Println(err)
+						} else {
+							fmt.Println(reply)
+						}
+						return nil
+					},
+				},
 				{
 					Name:  "plugin",
 					Usage: "drop plugin $plugin_type $plugin_name -s stop",
@@ -561,13 +672,31 @@ func main() {
 						return nil
 					},
 				},
+				{
+					Name:  "secret",
+					Usage: "drop secret $secret_name",
+					Action: func(c *cli.Context) error {
+						if len(c.Args()) != 1 {
+							fmt.Printf("Expect secret name.\n")
+							return nil
+						}
+						var reply string
+						err = client.Call("Server.DropSecret", c.Args()[0], &reply)
+						if err != nil {
+							fmt.Println(err)
+						} else {
+							fmt.Println(reply)
+						}
+						return nil
+					},
+				},
 			},
 		},
 
 		{
 			Name:    "show",
 			Aliases: []string{"show"},
-			Usage:   "show streams | show tables | show rules | show plugins $plugin_type | show services | show service_funcs",
+			Usage:   "show streams | show tables | show functions | show rules | show plugins $plugin_type | show services | show service_funcs | show secrets | show savepoints $rule_name",
 
 			Subcommands: []cli.Command{
 				{
@@ -586,6 +715,14 @@ func main() {
 						return nil
 					},
 				},
+				{
+					Name:  "functions",
+					Usage: "show functions",
+					Action: func(c *cli.Context) error {
+						streamProcess(client, "")
+						return nil
+					},
+				},
 				{
 					Name:  "rules",
 					Usage: "show rules",
@@ -600,6 +737,24 @@ func main() {
 						return nil
 					},
 				},
+				{
+					Name:  "savepoints",
+					Usage: "show savepoints $rule_name",
+					Action: func(c *cli.Context) error {
+						if len(c.Args()) != 1 {
+							fmt.Printf("Expect rule name.\n")
+							return nil
+						}
+						var reply string
+						err = client.Call("Server.ShowSavepoints", c.Args()[0], &reply)
+						if err != nil {
+							fmt.Println(err)
+						} else {
+							fmt.Println(reply)
+						}
+						return nil
+					},
+				},
 				{
 					Name:  "plugins",
 					Usage: "show plugins $plugin_type",
@@ -662,6 +817,19 @@ func main() {
 						}
 						return nil
 					},
+				}, {
+					Name:  "secrets",
+					Usage: "show secrets",
+					Action: func(c *cli.Context) error {
+						var reply string
+						err = client.Call("Server.ShowSecrets", 0, &reply)
+						if err != nil {
+							fmt.Println(err)
+						} else {
+							fmt.Println(reply)
+						}
+						return nil
+					},
 				},
 			},
 		},
@@ -723,12 +891,17 @@ func main() {
 		{
 			Name:    "start",
 			Aliases: []string{"start"},
-			Usage:   "start rule $rule_name",
+			Usage:   "start rule $rule_name [-s savepoint_name]",
 			Subcommands: []cli.Command{
 				{
 					Name:  "rule",
-					Usage: "start rule $rule_name",
-					//Flags: nflag,
+					Usage: "start rule $rule_name [-s savepoint_name]",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "savepoint, s",
+							Usage: "the savepoint to restore the rule states from",
+						},
+					},
 					Action: func(c *cli.Context) error {
 						if len(c.Args()) != 1 {
 							fmt.Printf("Expect rule name.\n")
@@ -736,7 +909,11 @@ func main() {
 						}
 						rname := c.Args()[0]
 						var reply string
-						err = client.Call("Server.StartRule", rname, &reply)
+						if sp := c.String("savepoint"); sp != "" {
+							err = client.Call("Server.StartRuleFromSavepoint", &common.RPCArgDesc{Name: rname, Json: sp}, &reply)
+						} else {
+							err = client.Call("Server.StartRule", rname, &reply)
+						}
 						if err != nil {
 							fmt.Println(err)
 						} else {
@@ -774,6 +951,145 @@ func main() {
 				},
 			},
 		},
+		{
+			Name:    "savepoint",
+			Aliases: []string{"savepoint"},
+			Usage:   "savepoint rule $rule_name [$savepoint_name]",
+			Subcommands: []cli.Command{
+				{
+					Name:  "rule",
+					Usage: "savepoint rule $rule_name [$savepoint_name]",
+					Action: func(c *cli.Context) error {
+						if len(c.Args()) < 1 || len(c.Args()) > 2 {
+							fmt.Printf("Expect rule name and optional savepoint name.\n")
+							return nil
+						}
+						arg := &common.RPCArgDesc{Name: c.Args()[0]}
+						if len(c.Args()) == 2 {
+							arg.Json = c.Args()[1]
+						}
+						var reply string
+						err = client.Call("Server.SavepointRule", arg, &reply)
+						if err != nil {
+							fmt.Println(err)
+						} else {
+							fmt.Println(reply)
+						}
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:    "test",
+			Aliases: []string{"test"},
+			Usage:   "test rule [$rule_test_json | -f rule_test_def_file]",
+			Subcommands: []cli.Command{
+				{
+					Name:  "rule",
+					Usage: "test rule [$rule_test_json | -f rule_test_def_file]",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "file, f",
+							Usage:    "the location of rule test definition file",
+							FilePath: "/home/myruletest.txt",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var def string
+						if sfile := c.String("file"); sfile != "" {
+							if _, err := os.Stat(sfile); os.IsNotExist(err) {
+								fmt.Printf("The specified rule test defenition file %s is not existed.\n", sfile)
+								return nil
+							}
+							if d, err := ioutil.ReadFile(sfile); err != nil {
+								fmt.Printf("Failed to read from rule test definition file %s.\n", sfile)
+								return nil
+							} else {
+								def = string(d)
+							}
+						} else {
+							if len(c.Args()) != 1 {
+								fmt.Printf("Expect rule test json.\nBut found %d args:%s.\n", len(c.Args()), c.Args())
+								return nil
+							}
+							def = c.Args()[0]
+						}
+						var reply string
+						err = client.Call("Server.TestRule", def, &reply)
+						if err != nil {
+							fmt.Println(err)
+						} else {
+							fmt.Println(reply)
+						}
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:    "export",
+			Aliases: []string{"export"},
+			Usage:   "export $bundle_file",
+			Action: func(c *cli.Context) error {
+				if len(c.Args()) != 1 {
+					fmt.Printf("Expect the bundle file.\n")
+					return nil
+				}
+				var reply string
+				err = client.Call("Server.Export", 0, &reply)
+				if err != nil {
+					fmt.Println(err)
+					return nil
+				}
+				if err := ioutil.WriteFile(c.Args()[0], []byte(reply), 0600); err != nil {
+					fmt.Printf("Failed to write the bundle file %s: %v.\n", c.Args()[0], err)
+				} else {
+					fmt.Printf("The configuration is exported to %s.\n", c.Args()[0])
+				}
+				return nil
+			},
+		},
+		{
+			Name:    "import",
+			Aliases: []string{"import"},
+			Usage:   "import $bundle_file [-p skip|replace|fail] [--dryrun]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "policy, p",
+					Usage: "the policy for the existing items: skip, replace or fail",
+					Value: "skip",
+				},
+				cli.BoolFlag{
+					Name:  "dryrun",
+					Usage: "validate the bundle and show the planned actions without any change",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if len(c.Args()) != 1 {
+					fmt.Printf("Expect the bundle file.\n")
+					return nil
+				}
+				content, err := ioutil.ReadFile(c.Args()[0])
+				if err != nil {
+					fmt.Printf("Failed to read from the bundle file %s.\n", c.Args()[0])
+					return nil
+				}
+				arg := &common.ImportDesc{
+					Content: string(content),
+					Policy:  c.String("policy"),
+					DryRun:  c.Bool("dryrun"),
+				}
+				var reply string
+				err = client.Call("Server.Import", arg, &reply)
+				if err != nil {
+					fmt.Println(err)
+				} else {
+					fmt.Println(reply)
+				}
+				return nil
+			},
+		},
 		{
 			Name:    "restart",
 			Aliases: []string{"restart"},
@@ -892,8 +1208,10 @@ func getPluginType(arg string) (ptype int, err error) {
 		ptype = 1
 	case "function":
 		ptype = 2
+	case "portable":
+		ptype = 3
 	default:
-		err = fmt.Errorf("Invalid plugin type %s, should be \"source\", \"sink\" or \"function\".\n", arg)
+		err = fmt.Errorf("Invalid plugin type %s, should be \"source\", \"sink\", \"function\" or \"portable\".\n", arg)
 	}
 	return
 }
@@ -909,3 +1227,40 @@ func readDef(sfile string, t string) ([]byte, error) {
 		return rule, nil
 	}
 }
+
+type authError struct {
+	status string
+}
+
+func (e *authError) Error() string {
+	return fmt.Sprintf("Failed to connect the server: %s, please check the token in client.yaml.", e.status)
+}
+
+// dialHTTP connects to the rpc server like rpc.DialHTTP and sends the token in the CONNECT request
+func dialHTTP(address string, token string) (*rpc.Client, error) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	req := "CONNECT " + rpc.DefaultRPCPath + " HTTP/1.0\n"
+	if token != "" {
+		req += "Authorization: Bearer " + token + "\n"
+	}
+	if _, err := io.WriteString(conn, req+"\n"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		if resp.StatusCode == http.StatusUnauthorized {
+			return nil, &authError{status: resp.Status}
+		}
+		return nil, fmt.Errorf("unexpected HTTP response: %s", resp.Status)
+	}
+	return rpc.NewClient(conn), nil
+}
@@ -5,15 +5,33 @@ import (
 	"github.com/emqx/kuiper/xstream/api"
 )
 
+// The prefixes of the state keys. The custom functions and the analytic function calls are numbered separately, so
+// they use different prefixes to avoid sharing the states of the same id
+const (
+	funcKeyPrefix     = "$$func"
+	analyticKeyPrefix = "$$analytic"
+)
+
 type DefaultFuncContext struct {
 	api.StreamContext
 	funcId int
+	prefix string
 }
 
 func NewDefaultFuncContext(ctx api.StreamContext, id int) *DefaultFuncContext {
 	return &DefaultFuncContext{
 		StreamContext: ctx,
 		funcId:        id,
+		prefix:        funcKeyPrefix,
+	}
+}
+
+// NewAnalyticFuncContext creates the context of the analytic function call whose id is the index of the call in the rule
+func NewAnalyticFuncContext(ctx api.StreamContext, id int) *DefaultFuncContext {
+	return &DefaultFuncContext{
+		StreamContext: ctx,
+		funcId:        id,
+		prefix:        analyticKeyPrefix,
 	}
 }
 
@@ -42,5 +60,5 @@ func (c *DefaultFuncContext) GetFuncId() int {
 }
 
 func (c *DefaultFuncContext) convertKey(key string) string {
-	return fmt.Sprintf("$$func%d_%s", c.funcId, key)
+	return fmt.Sprintf("%s%d_%s", c.prefix, c.funcId, key)
 }
@@ -0,0 +1,47 @@
+package contexts
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/xstream/api"
+	"github.com/emqx/kuiper/xstream/states"
+	"reflect"
+	"testing"
+)
+
+func TestFuncContextState(t *testing.T) {
+	store, err := states.CreateStore("testFuncContext", api.AtMostOnce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := Background().WithMeta("testFuncContext", "op1", store)
+	// The custom function and the analytic function call have the same id
+	var tests = []struct {
+		fctx  *DefaultFuncContext
+		value interface{}
+	}{
+		{
+			fctx:  NewDefaultFuncContext(ctx, 0),
+			value: "custom",
+		}, {
+			fctx:  NewAnalyticFuncContext(ctx, 0),
+			value: "analytic",
+		}, {
+			fctx:  NewAnalyticFuncContext(ctx, 1),
+			value: "analytic1",
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		if err := tt.fctx.PutState("lag_", tt.value); err != nil {
+			t.Fatalf("%d. put state error: %v", i, err)
+		}
+	}
+	for i, tt := range tests {
+		v, err := tt.fctx.GetState("lag_")
+		if err != nil {
+			t.Errorf("%d. get state error: %v", i, err)
+		} else if !reflect.DeepEqual(tt.value, v) {
+			t.Errorf("%d. state mismatch:\n  exp=%v\n  got=%v\n\n", i, tt.value, v)
+		}
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"github.com/emqx/kuiper/common"
 	"github.com/emqx/kuiper/xstream/api"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -15,10 +17,12 @@ type FileType string
 
 const (
 	JSON_TYPE FileType = "json"
+	CSV_TYPE  FileType = "csv"
 )
 
 var fileTypes = map[FileType]bool{
 	JSON_TYPE: true,
+	CSV_TYPE:  true,
 }
 
 type FileSourceConfig struct {
@@ -26,6 +30,9 @@ type FileSourceConfig struct {
 	Path       string   `json:"path"`
 	Interval   int      `json:"interval"`
 	RetainSize int      `json:"$retainSize"`
+	// For csv file type, the first line is the header if no schemaId specified
+	SchemaId  string `json:"schemaId"`
+	Delimiter string `json:"delimiter"`
 }
 
 // The BATCH to load data from file at once
@@ -47,7 +54,7 @@ func (fs *FileSource) Configure(fileName string, props map[string]interface{}) e
 		return fmt.Errorf("read properties %v fail with error: %v", props, err)
 	}
 	if cfg.FileType == "" {
-		return errors.New("missing or invalid property fileType, must be 'json'")
+		return errors.New("missing or invalid property fileType, must be 'json' or 'csv'")
 	}
 	if _, ok := fileTypes[cfg.FileType]; !ok {
 		return fmt.Errorf("invalid property fileType: %s", cfg.FileType)
@@ -104,38 +111,82 @@ func (fs *FileSource) Open(ctx api.StreamContext, consumer chan<- api.SourceTupl
 }
 
 func (fs *FileSource) Load(ctx api.StreamContext, consumer chan<- api.SourceTuple) error {
+	var resultMap []map[string]interface{}
+	ctx.GetLogger().Debugf("Start to load from file %s", fs.file)
 	switch fs.config.FileType {
 	case JSON_TYPE:
-		ctx.GetLogger().Debugf("Start to load from file %s", fs.file)
-		resultMap := make([]map[string]interface{}, 0)
+		resultMap = make([]map[string]interface{}, 0)
 		err := common.ReadJsonUnmarshal(fs.file, &resultMap)
 		if err != nil {
 			return fmt.Errorf("loaded %s, check error %s", fs.file, err)
 		}
-		ctx.GetLogger().Debug("Sending tuples")
-		if fs.config.RetainSize > 0 && fs.config.RetainSize < len(resultMap) {
-			resultMap = resultMap[(len(resultMap) - fs.config.RetainSize):]
-			ctx.GetLogger().Debug("Sending tuples for retain size %d", fs.config.RetainSize)
+	case CSV_TYPE:
+		var err error
+		resultMap, err = fs.readCsv()
+		if err != nil {
+			return fmt.Errorf("loaded %s, check error %s", fs.file, err)
 		}
-		for _, m := range resultMap {
-			select {
-			case consumer <- api.NewDefaultSourceTuple(m, nil):
-				// do nothing
-			case <-ctx.Done():
-				return nil
-			}
+	default:
+		return fmt.Errorf("invalid file type %s", fs.config.FileType)
+	}
+	ctx.GetLogger().Debug("Sending tuples")
+	if fs.config.RetainSize > 0 && fs.config.RetainSize < len(resultMap) {
+		resultMap = resultMap[(len(resultMap) - fs.config.RetainSize):]
+		ctx.GetLogger().Debug("Sending tuples for retain size %d", fs.config.RetainSize)
+	}
+	for _, m := range resultMap {
+		select {
+		case consumer <- api.NewDefaultSourceTuple(m, nil):
+			// do nothing
+		case <-ctx.Done():
+			return nil
 		}
-		// Send EOF if retain size not set
-		if fs.config.RetainSize == 0 {
-			select {
-			case consumer <- api.NewDefaultSourceTuple(nil, nil):
-				// do nothing
-			case <-ctx.Done():
-				return nil
-			}
+	}
+	// Send EOF if retain size not set
+	if fs.config.RetainSize == 0 {
+		select {
+		case consumer <- api.NewDefaultSourceTuple(nil, nil):
+			// do nothing
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	ctx.GetLogger().Debug("All tuples sent")
+	return nil
+}
+
+// Decode each line of the file with the csv codec
+func (fs *FileSource) readCsv() ([]map[string]interface{}, error) {
+	content, err := ioutil.ReadFile(fs.file)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+	conf := &common.CodecConf{SchemaId: fs.config.SchemaId, Delimiter: fs.config.Delimiter}
+	if conf.SchemaId == "" {
+		if len(lines) == 0 || lines[0] == "" {
+			return nil, errors.New("missing header line for csv file")
+		}
+		conf.SchemaId = lines[0]
+		if conf.Delimiter != "" {
+			conf.SchemaId = strings.ReplaceAll(conf.SchemaId, conf.Delimiter, ",")
+		}
+		lines = lines[1:]
+	}
+	c, err := common.GetCodec(common.FORMAT_CSV, conf)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]map[string]interface{}, 0, len(lines))
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		m, err := c.Decode([]byte(line))
+		if err != nil {
+			return nil, err
 		}
-		ctx.GetLogger().Debug("All tuples sent")
-		return nil
+		result = append(result, m)
 	}
-	return fmt.Errorf("invalid file type %s", fs.config.FileType)
+	return result, nil
 }
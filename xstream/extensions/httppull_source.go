@@ -26,6 +26,7 @@ type HTTPPullSource struct {
 	bodyType      string
 	headers       map[string]string
 	messageFormat string
+	codec         common.MessageCodec
 
 	client *http.Client
 }
@@ -100,6 +101,11 @@ func (hps *HTTPPullSource) Configure(device string, props map[string]interface{}
 			return fmt.Errorf("Not valid format value %v.", c)
 		}
 	}
+	if c, err := common.GetCodecFromProps(props); err != nil {
+		return err
+	} else {
+		hps.codec = c
+	}
 
 	if b, ok := props["body"]; ok {
 		if b1, ok1 := b.(string); ok1 {
@@ -174,7 +180,7 @@ func (hps *HTTPPullSource) initTimerPull(ctx api.StreamContext, consumer chan<-
 					}
 				}
 
-				result, e := common.MessageDecode(c, hps.messageFormat)
+				result, e := hps.codec.Decode(c)
 				meta := make(map[string]interface{})
 				if e != nil {
 					logger.Errorf("Invalid data format, cannot decode %s to %s format with error %s", string(c), hps.messageFormat, e)
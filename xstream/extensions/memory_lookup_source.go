@@ -0,0 +1,111 @@
+package extensions
+
+import (
+	"context"
+	"fmt"
+	"github.com/emqx/kuiper/xstream/api"
+	"github.com/emqx/kuiper/xstream/memory"
+	"sync"
+)
+
+// The memory lookup source keeps the latest row of each key which is published to the memory topic. It works like
+// a key value store that is updated by other rules with the memory sink. The table KEY option is required as the index.
+type MemoryLookupSource struct {
+	MemorySource
+	key    string
+	mu     sync.RWMutex
+	rows   map[string]map[string]interface{}
+	cancel context.CancelFunc
+}
+
+func (s *MemoryLookupSource) Configure(topic string, props map[string]interface{}) error {
+	if err := s.MemorySource.Configure(topic, props); err != nil {
+		return err
+	}
+	k, ok := props["$key"].(string)
+	if !ok || k == "" {
+		return fmt.Errorf("option KEY is required for memory lookup table")
+	}
+	s.key = k
+	s.rows = make(map[string]map[string]interface{})
+	return nil
+}
+
+func (s *MemoryLookupSource) Open(ctx api.StreamContext) error {
+	sub, err := memory.Subscribe(s.filter, s.config.BufferLength, memory.OverflowPolicy(s.config.Overflow))
+	if err != nil {
+		return err
+	}
+	if !s.setSub(sub) {
+		return fmt.Errorf("memory lookup source for topic %s is closed", s.filter)
+	}
+	c, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	go func() {
+		logger := ctx.GetLogger()
+		for {
+			select {
+			case msg := <-sub.Messages():
+				results, err := s.decode(msg.Payload)
+				if err != nil {
+					logger.Errorf("Invalid data format, cannot decode %s to %s format with error %s", string(msg.Payload), s.config.Format, err)
+					continue
+				}
+				s.mu.Lock()
+				for _, r := range results {
+					if v, ok := r[s.key]; ok && v != nil {
+						s.rows[fmt.Sprintf("%v", v)] = r
+					}
+				}
+				s.mu.Unlock()
+			case <-c.Done():
+				return
+			}
+		}
+	}()
+	ctx.GetLogger().Infof("Successfully subscribe to memory topic %s for lookup", s.filter)
+	return nil
+}
+
+func (s *MemoryLookupSource) Lookup(_ api.StreamContext, fields []string, keys []string, values []interface{}) ([]map[string]interface{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var result []map[string]interface{}
+	if len(keys) == 1 && keys[0] == s.key {
+		if r, ok := s.rows[fmt.Sprintf("%v", values[0])]; ok {
+			result = append(result, project(r, fields))
+		}
+		return result, nil
+	}
+	target := keyString(values)
+	for _, r := range s.rows {
+		kv := make([]interface{}, len(keys))
+		for i, k := range keys {
+			kv[i] = r[k]
+		}
+		if keyString(kv) == target {
+			result = append(result, project(r, fields))
+		}
+	}
+	return result, nil
+}
+
+func (s *MemoryLookupSource) Close(ctx api.StreamContext) error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	return s.MemorySource.Close(ctx)
+}
+
+func project(row map[string]interface{}, fields []string) map[string]interface{} {
+	if len(fields) == 0 {
+		return row
+	}
+	r := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		if v, ok := row[f]; ok {
+			r[f] = v
+		}
+	}
+	return r
+}
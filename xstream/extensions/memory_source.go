@@ -0,0 +1,133 @@
+package extensions
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/xstream/api"
+	"github.com/emqx/kuiper/xstream/memory"
+	"sync"
+)
+
+type MemorySourceConfig struct {
+	Format       string `json:"format"`
+	BufferLength int    `json:"bufferLength"`
+	Overflow     string `json:"overflow"`
+}
+
+// The memory source subscribes to the in process message bus. It is used to consume the results of the rules which
+// have memory sinks without an external broker.
+type MemorySource struct {
+	filter string
+	config *MemorySourceConfig
+	codec  common.MessageCodec
+	// The subscription is set in the source goroutine and closed in the rule stopping goroutine
+	subLock sync.Mutex
+	sub     *memory.Subscription
+	closed  bool
+}
+
+func (ms *MemorySource) Configure(topic string, props map[string]interface{}) error {
+	cfg := &MemorySourceConfig{
+		BufferLength: 1024,
+		Overflow:     string(memory.OVERFLOW_BLOCK),
+	}
+	err := common.MapToStruct(props, cfg)
+	if err != nil {
+		return fmt.Errorf("read properties %v fail with error: %v", props, err)
+	}
+	if err := memory.ValidateFilter(topic); err != nil {
+		return err
+	}
+	if cfg.BufferLength <= 0 {
+		return fmt.Errorf("invalid property bufferLength %d, must be positive", cfg.BufferLength)
+	}
+	if cfg.Overflow != string(memory.OVERFLOW_BLOCK) && cfg.Overflow != string(memory.OVERFLOW_DROP) {
+		return fmt.Errorf("invalid property overflow %s, must be block or drop", cfg.Overflow)
+	}
+	ms.codec, err = common.GetCodecFromProps(props)
+	if err != nil {
+		return err
+	}
+	ms.filter = topic
+	ms.config = cfg
+	return nil
+}
+
+func (ms *MemorySource) Open(ctx api.StreamContext, consumer chan<- api.SourceTuple, errCh chan<- error) {
+	logger := ctx.GetLogger()
+	sub, err := memory.Subscribe(ms.filter, ms.config.BufferLength, memory.OverflowPolicy(ms.config.Overflow))
+	if err != nil {
+		errCh <- err
+		return
+	}
+	if !ms.setSub(sub) {
+		return
+	}
+	logger.Infof("Successfully subscribe to memory topic %s", ms.filter)
+	for {
+		select {
+		case msg := <-sub.Messages():
+			logger.Debugf("instance %d received %s", ctx.GetInstanceId(), msg.Payload)
+			results, err := ms.decode(msg.Payload)
+			if err != nil {
+				logger.Errorf("Invalid data format, cannot decode %s to %s format with error %s", string(msg.Payload), ms.config.Format, err)
+				continue
+			}
+			meta := map[string]interface{}{"topic": msg.Topic}
+			for _, r := range results {
+				select {
+				case consumer <- api.NewDefaultSourceTuple(r, meta):
+					logger.Debugf("send data to source node")
+				case <-ctx.Done():
+					return
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// The rule results are json arrays by default, decode them into multiple messages
+func (ms *MemorySource) decode(payload []byte) ([]map[string]interface{}, error) {
+	if (ms.config.Format == "" || ms.config.Format == common.FORMAT_JSON) && len(payload) > 0 && payload[0] == '[' {
+		var results []map[string]interface{}
+		if err := json.Unmarshal(payload, &results); err != nil {
+			return nil, err
+		}
+		return results, nil
+	}
+	r, err := ms.codec.Decode(payload)
+	if err != nil {
+		return nil, err
+	}
+	return []map[string]interface{}{r}, nil
+}
+
+// Keep the subscription to close it later. If the source is already closed, close the subscription at once and
+// return false
+func (ms *MemorySource) setSub(sub *memory.Subscription) bool {
+	ms.subLock.Lock()
+	defer ms.subLock.Unlock()
+	if ms.closed {
+		sub.Close()
+		return false
+	}
+	ms.sub = sub
+	return true
+}
+
+func (ms *MemorySource) Close(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Memory source instance %d Done", ctx.GetInstanceId())
+	ms.subLock.Lock()
+	defer ms.subLock.Unlock()
+	ms.closed = true
+	if ms.sub != nil {
+		if d := ms.sub.Dropped(); d > 0 {
+			ctx.GetLogger().Warnf("Memory source for topic %s has dropped %d messages due to full buffer", ms.filter, d)
+		}
+		ms.sub.Close()
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package extensions
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/xstream/api"
+	"github.com/emqx/kuiper/xstream/contexts"
+	"github.com/emqx/kuiper/xstream/memory"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMemorySource(t *testing.T) {
+	var tests = []struct {
+		props   map[string]interface{}
+		payload []byte
+		result  []map[string]interface{}
+		err     string
+	}{
+		{
+			props:   map[string]interface{}{"format": "json"},
+			payload: []byte(`[{"color":"red","size":3},{"color":"blue","size":5}]`),
+			result:  []map[string]interface{}{{"color": "red", "size": 3.0}, {"color": "blue", "size": 5.0}},
+		}, {
+			props:   map[string]interface{}{"format": "json", "overflow": "drop", "bufferLength": 2},
+			payload: []byte(`{"color":"red","size":3}`),
+			result:  []map[string]interface{}{{"color": "red", "size": 3.0}},
+		}, {
+			props:   map[string]interface{}{"format": "csv", "schemaId": "color,size"},
+			payload: []byte(`red,3`),
+			result:  []map[string]interface{}{{"color": "red", "size": 3.0}},
+		}, {
+			props: map[string]interface{}{"format": "json", "overflow": "retry"},
+			err:   "invalid property overflow retry, must be block or drop",
+		}, {
+			props: map[string]interface{}{"format": "json", "bufferLength": -1},
+			err:   "invalid property bufferLength -1, must be positive",
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	contextLogger := common.Log.WithField("rule", "TestMemorySource")
+	for i, tt := range tests {
+		ms := &MemorySource{}
+		err := ms.Configure("test/+", tt.props)
+		if !reflect.DeepEqual(tt.err, common.Errstring(err)) {
+			t.Errorf("%d. error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.err, err)
+		}
+		if err != nil {
+			continue
+		}
+		ctx, cancel := contexts.WithValue(contexts.Background(), contexts.LoggerKey, contextLogger).WithCancel()
+		consumer := make(chan api.SourceTuple, 10)
+		go ms.Open(ctx, consumer, make(chan error))
+		// Wait for the subscription
+		time.Sleep(50 * time.Millisecond)
+		if err := memory.Publish("test/out", tt.payload, nil); err != nil {
+			t.Errorf("%d. publish error: %v", i, err)
+		}
+		var result []map[string]interface{}
+		for range tt.result {
+			select {
+			case st := <-consumer:
+				result = append(result, st.Message())
+				if topic := st.Meta()["topic"]; topic != "test/out" {
+					t.Errorf("%d. meta topic mismatch, got %v", i, topic)
+				}
+			case <-time.After(time.Second):
+				t.Errorf("%d. timeout to receive message", i)
+			}
+		}
+		if !reflect.DeepEqual(tt.result, result) {
+			t.Errorf("%d. result mismatch:\n  exp=%v\n  got=%v\n\n", i, tt.result, result)
+		}
+		cancel()
+		ms.Close(ctx)
+	}
+}
+
+func TestMemorySourceCloseBeforeOpen(t *testing.T) {
+	ms := &MemorySource{}
+	if err := ms.Configure("test/closed", map[string]interface{}{"bufferLength": 1}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := contexts.Background().WithCancel()
+	defer cancel()
+	// The rule is stopped before the source goroutine subscribes
+	ms.Close(ctx)
+	done := make(chan struct{})
+	go func() {
+		ms.Open(ctx, make(chan api.SourceTuple), make(chan error))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the closed source is still running")
+	}
+	// The publisher is not blocked by the subscription of the closed source
+	timeout := make(chan struct{})
+	time.AfterFunc(time.Second, func() { close(timeout) })
+	for i := 0; i < 2; i++ {
+		if err := memory.Publish("test/closed", []byte(`{"a":1}`), timeout); err != nil {
+			t.Errorf("%d. publish error: %v", i, err)
+		}
+	}
+}
@@ -26,6 +26,7 @@ type MQTTSource struct {
 
 	model  modelVersion
 	schema map[string]interface{}
+	codec  common.MessageCodec
 	conn   MQTT.Client
 }
 
@@ -61,6 +62,10 @@ func (ms *MQTTSource) Configure(topic string, props map[string]interface{}) erro
 	}
 
 	ms.format = cfg.Format
+	ms.codec, err = common.GetCodecFromProps(props)
+	if err != nil {
+		return err
+	}
 	ms.clientid = cfg.Clientid
 
 	ms.pVersion = 3
@@ -138,7 +143,7 @@ func (ms *MQTTSource) Open(ctx api.StreamContext, consumer chan<- api.SourceTupl
 	opts.SetConnectionLostHandler(func(client MQTT.Client, e error) {
 		log.Errorf("The connection %s is disconnected due to error %s, will try to re-connect later.", ms.srv+": "+ms.clientid, e)
 		reconn = true
-		subscribe(ms.tpc, client, ctx, consumer, ms.model, ms.format)
+		subscribe(ms.tpc, client, ctx, consumer, ms.model, ms.format, ms.codec)
 	})
 
 	opts.SetOnConnectHandler(func(client MQTT.Client) {
@@ -153,15 +158,15 @@ func (ms *MQTTSource) Open(ctx api.StreamContext, consumer chan<- api.SourceTupl
 	}
 	log.Infof("The connection to server %s was established successfully", ms.srv)
 	ms.conn = c
-	subscribe(ms.tpc, c, ctx, consumer, ms.model, ms.format)
+	subscribe(ms.tpc, c, ctx, consumer, ms.model, ms.format, ms.codec)
 	log.Infof("Successfully subscribe to topic %s", ms.srv+": "+ms.clientid)
 }
 
-func subscribe(topic string, client MQTT.Client, ctx api.StreamContext, consumer chan<- api.SourceTuple, model modelVersion, format string) {
+func subscribe(topic string, client MQTT.Client, ctx api.StreamContext, consumer chan<- api.SourceTuple, model modelVersion, format string, codec common.MessageCodec) {
 	log := ctx.GetLogger()
 	h := func(client MQTT.Client, msg MQTT.Message) {
 		log.Debugf("instance %d received %s", ctx.GetInstanceId(), msg.Payload())
-		result, e := common.MessageDecode(msg.Payload(), format)
+		result, e := codec.Decode(msg.Payload())
 		//The unmarshal type can only be bool, float64, string, []interface{}, map[string]interface{}, nil
 		if e != nil {
 			log.Errorf("Invalid data format, cannot decode %s to %s format with error %s", string(msg.Payload()), format, e)
@@ -0,0 +1,151 @@
+package extensions
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/xstream/api"
+	_ "github.com/mattn/go-sqlite3"
+	"regexp"
+	"strings"
+)
+
+var identifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+type SQLLookupConfig struct {
+	Driver string `json:"driver"`
+	Url    string `json:"url"`
+}
+
+// The sql lookup source queries the database table on demand. The data source is the table name.
+type SQLLookupSource struct {
+	table string
+	conf  *SQLLookupConfig
+	db    *sql.DB
+}
+
+func (s *SQLLookupSource) Configure(table string, props map[string]interface{}) error {
+	cfg := &SQLLookupConfig{Driver: "sqlite3"}
+	err := common.MapToStruct(props, cfg)
+	if err != nil {
+		return fmt.Errorf("read properties %v fail with error: %v", props, err)
+	}
+	if cfg.Url == "" {
+		return fmt.Errorf("missing property url")
+	}
+	if !identifierRegex.MatchString(table) {
+		return fmt.Errorf("invalid table name %s", table)
+	}
+	s.table = table
+	s.conf = cfg
+	return nil
+}
+
+func (s *SQLLookupSource) Open(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Opening sql lookup source for table %s", s.table)
+	db, err := openDB(s.conf.Driver, s.conf.Url)
+	if err != nil {
+		return err
+	}
+	s.db = db
+	return nil
+}
+
+func (s *SQLLookupSource) Lookup(ctx api.StreamContext, fields []string, keys []string, values []interface{}) ([]map[string]interface{}, error) {
+	r, err := s.LookupBatch(ctx, fields, keys, [][]interface{}{values})
+	if err != nil {
+		return nil, err
+	}
+	return r[0], nil
+}
+
+// Query all the key values with one statement like `SELECT * FROM t WHERE (k1 = ? AND k2 = ?) OR (k1 = ? AND k2 = ?)`
+// and dispatch the rows to the key values
+func (s *SQLLookupSource) LookupBatch(ctx api.StreamContext, fields []string, keys []string, values [][]interface{}) ([][]map[string]interface{}, error) {
+	var selected []string
+	selected = append(selected, fields...)
+	// The key columns are required to dispatch the rows
+	for _, k := range keys {
+		if !contains(fields, k) {
+			selected = append(selected, k)
+		}
+	}
+	for _, c := range selected {
+		if !identifierRegex.MatchString(c) {
+			return nil, fmt.Errorf("invalid column name %s", c)
+		}
+	}
+	columns := "*"
+	if len(fields) > 0 {
+		columns = strings.Join(selected, ",")
+	}
+	conds := make([]string, len(keys))
+	for i, k := range keys {
+		conds[i] = k + " = ?"
+	}
+	cond := "(" + strings.Join(conds, " AND ") + ")"
+	var (
+		where []string
+		args  []interface{}
+	)
+	index := make(map[string]int, len(values))
+	for i, v := range values {
+		if len(v) != len(keys) {
+			return nil, fmt.Errorf("expect %d key values but got %d", len(keys), len(v))
+		}
+		where = append(where, cond)
+		args = append(args, v...)
+		index[keyString(v)] = i
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s", columns, s.table, strings.Join(where, " OR "))
+	ctx.GetLogger().Debugf("sql lookup source query %s with %v", query, args)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := make([][]map[string]interface{}, len(values))
+	for rows.Next() {
+		row, err := scanRow(rows, cols)
+		if err != nil {
+			return nil, err
+		}
+		kv := make([]interface{}, len(keys))
+		for i, k := range keys {
+			kv[i] = row[k]
+		}
+		if i, ok := index[keyString(kv)]; ok {
+			result[i] = append(result[i], row)
+		}
+	}
+	return result, rows.Err()
+}
+
+func (s *SQLLookupSource) Close(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Closing sql lookup source for table %s", s.table)
+	if s.db != nil {
+		return s.db.Close()
+	}
+	return nil
+}
+
+func keyString(values []interface{}) string {
+	strs := make([]string, len(values))
+	for i, v := range values {
+		strs[i] = fmt.Sprintf("%v", v)
+	}
+	return strings.Join(strs, ",")
+}
+
+func contains(s []string, e string) bool {
+	for _, v := range s {
+		if v == e {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+package extensions
+
+import (
+	"database/sql"
+	"encoding/gob"
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/xstream/api"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	// The index of timestamp column is saved in the checkpoint
+	gob.Register(time.Time{})
+}
+
+type SQLSourceConfig struct {
+	SQLLookupConfig
+	Interval   int         `json:"interval"`
+	IndexField string      `json:"indexField"`
+	IndexInit  interface{} `json:"indexInit"`
+	Limit      int         `json:"limit"`
+}
+
+// The sql source polls the database table in the interval. The data source is the table name. If the index field is
+// set, only the rows whose index is greater than the last read one are queried, so that each row is read only once.
+// The index is the offset of the source which is saved in the checkpoint.
+type SQLSource struct {
+	table string
+	conf  *SQLSourceConfig
+	db    *sql.DB
+
+	mu    sync.Mutex
+	index interface{}
+}
+
+func (s *SQLSource) Configure(table string, props map[string]interface{}) error {
+	cfg := &SQLSourceConfig{
+		SQLLookupConfig: SQLLookupConfig{Driver: "sqlite3"},
+		Interval:        DEFAULT_INTERVAL,
+	}
+	err := common.MapToStruct(props, cfg)
+	if err != nil {
+		return fmt.Errorf("read properties %v fail with error: %v", props, err)
+	}
+	if cfg.Url == "" {
+		return fmt.Errorf("missing property url")
+	}
+	if cfg.Interval <= 0 {
+		return fmt.Errorf("invalid property interval %d, must be positive", cfg.Interval)
+	}
+	if cfg.Limit < 0 {
+		return fmt.Errorf("invalid property limit %d, must not be negative", cfg.Limit)
+	}
+	if !identifierRegex.MatchString(table) {
+		return fmt.Errorf("invalid table name %s", table)
+	}
+	if cfg.IndexField != "" && !identifierRegex.MatchString(cfg.IndexField) {
+		return fmt.Errorf("invalid property indexField %s", cfg.IndexField)
+	}
+	s.table = table
+	s.conf = cfg
+	s.index = cfg.IndexInit
+	return nil
+}
+
+func (s *SQLSource) Open(ctx api.StreamContext, consumer chan<- api.SourceTuple, errCh chan<- error) {
+	logger := ctx.GetLogger()
+	logger.Infof("Opening sql source for table %s", s.table)
+	db, err := openDB(s.conf.Driver, s.conf.Url)
+	if err != nil {
+		select {
+		case errCh <- err:
+		case <-ctx.Done():
+		}
+		return
+	}
+	s.db = db
+	ticker := common.GetTicker(s.conf.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.poll(ctx, consumer); err != nil {
+				logger.Warnf("Found error %s when polling table %s", err, s.table)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *SQLSource) poll(ctx api.StreamContext, consumer chan<- api.SourceTuple) error {
+	var (
+		query strings.Builder
+		args  []interface{}
+	)
+	query.WriteString("SELECT * FROM ")
+	query.WriteString(s.table)
+	if s.conf.IndexField != "" {
+		if index, _ := s.GetOffset(); index != nil {
+			query.WriteString(" WHERE " + s.conf.IndexField + " > ?")
+			args = append(args, index)
+		}
+		query.WriteString(" ORDER BY " + s.conf.IndexField + " ASC")
+	}
+	if s.conf.Limit > 0 {
+		query.WriteString(fmt.Sprintf(" LIMIT %d", s.conf.Limit))
+	}
+	ctx.GetLogger().Debugf("sql source query %s with %v", query.String(), args)
+	rows, err := s.db.QueryContext(ctx, query.String(), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	meta := map[string]interface{}{"table": s.table}
+	for rows.Next() {
+		row, err := scanRow(rows, cols)
+		if err != nil {
+			return err
+		}
+		select {
+		case consumer <- api.NewDefaultSourceTuple(row, meta):
+		case <-ctx.Done():
+			return nil
+		}
+		if s.conf.IndexField != "" {
+			s.mu.Lock()
+			s.index = row[s.conf.IndexField]
+			s.mu.Unlock()
+		}
+	}
+	return rows.Err()
+}
+
+func (s *SQLSource) GetOffset() (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.index, nil
+}
+
+func (s *SQLSource) Rewind(offset interface{}) error {
+	if s.conf.IndexField == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.index = offset
+	return nil
+}
+
+func (s *SQLSource) Close(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Closing sql source for table %s", s.table)
+	if s.db != nil {
+		return s.db.Close()
+	}
+	return nil
+}
+
+func openDB(driver, url string) (*sql.DB, error) {
+	db, err := sql.Open(driver, url)
+	if err != nil {
+		return nil, fmt.Errorf("fail to open database with driver %s: %v", driver, err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("fail to connect to database with driver %s: %v", driver, err)
+	}
+	return db, nil
+}
+
+// Scan the current row into a map. Text columns are converted from []byte to string
+func scanRow(rows *sql.Rows, cols []string) (map[string]interface{}, error) {
+	data := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range data {
+		ptrs[i] = &data[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return nil, err
+	}
+	row := make(map[string]interface{}, len(cols))
+	for i, c := range cols {
+		if b, ok := data[i].([]byte); ok {
+			row[c] = string(b)
+		} else {
+			row[c] = data[i]
+		}
+	}
+	return row, nil
+}
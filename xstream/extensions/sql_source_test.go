@@ -0,0 +1,91 @@
+package extensions
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/xstream/api"
+	"github.com/emqx/kuiper/xstream/contexts"
+	"reflect"
+	"testing"
+)
+
+const sqlSourceTestUrl = "file:sqlSourceTest?mode=memory&cache=shared"
+
+func TestSQLSource(t *testing.T) {
+	// Keep the shared memory database alive during the test
+	db, err := sql.Open("sqlite3", sqlSourceTestUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE t1 (id INTEGER PRIMARY KEY, color TEXT); INSERT INTO t1 VALUES (1, 'red'), (2, 'blue'), (3, 'yellow')"); err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		props  map[string]interface{}
+		rewind interface{}
+		result [][]map[string]interface{}
+		err    string
+	}{
+		{
+			props: map[string]interface{}{},
+			result: [][]map[string]interface{}{
+				{{"id": int64(1), "color": "red"}, {"id": int64(2), "color": "blue"}, {"id": int64(3), "color": "yellow"}},
+				{{"id": int64(1), "color": "red"}, {"id": int64(2), "color": "blue"}, {"id": int64(3), "color": "yellow"}},
+			},
+		}, {
+			props: map[string]interface{}{"indexField": "id", "limit": 2},
+			result: [][]map[string]interface{}{
+				{{"id": int64(1), "color": "red"}, {"id": int64(2), "color": "blue"}},
+				{{"id": int64(3), "color": "yellow"}},
+				nil,
+			},
+		}, {
+			props:  map[string]interface{}{"indexField": "id", "indexInit": 1},
+			result: [][]map[string]interface{}{{{"id": int64(2), "color": "blue"}, {"id": int64(3), "color": "yellow"}}},
+		}, {
+			props:  map[string]interface{}{"indexField": "id"},
+			rewind: int64(2),
+			result: [][]map[string]interface{}{{{"id": int64(3), "color": "yellow"}}, nil},
+		}, {
+			props: map[string]interface{}{"indexField": "id desc"},
+			err:   "invalid property indexField id desc",
+		}, {
+			props: map[string]interface{}{"interval": 0},
+			err:   "invalid property interval 0, must be positive",
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	contextLogger := common.Log.WithField("rule", "TestSQLSource")
+	ctx := contexts.WithValue(contexts.Background(), contexts.LoggerKey, contextLogger)
+	for i, tt := range tests {
+		tt.props["url"] = sqlSourceTestUrl
+		s := &SQLSource{}
+		err := s.Configure("t1", tt.props)
+		if !reflect.DeepEqual(tt.err, common.Errstring(err)) {
+			t.Errorf("%d. error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.err, err)
+		}
+		if err != nil {
+			continue
+		}
+		if tt.rewind != nil {
+			s.Rewind(tt.rewind)
+		}
+		s.db = db
+		for j, exp := range tt.result {
+			consumer := make(chan api.SourceTuple, 10)
+			if err := s.poll(ctx, consumer); err != nil {
+				t.Errorf("%d.%d poll error: %v", i, j, err)
+			}
+			close(consumer)
+			var result []map[string]interface{}
+			for tuple := range consumer {
+				result = append(result, tuple.Message())
+			}
+			if !reflect.DeepEqual(exp, result) {
+				t.Errorf("%d.%d result mismatch:\n  exp=%v\n  got=%v\n\n", i, j, exp, result)
+			}
+		}
+	}
+}
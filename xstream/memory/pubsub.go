@@ -0,0 +1,165 @@
+package memory
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type OverflowPolicy string
+
+const (
+	// Block the publisher until the subscriber has room in its buffer
+	OVERFLOW_BLOCK OverflowPolicy = "block"
+	// Drop the newly published message if the subscriber buffer is full
+	OVERFLOW_DROP OverflowPolicy = "drop"
+)
+
+type Message struct {
+	Topic   string
+	Payload []byte
+}
+
+// Subscription receives the messages of all the topics which match its filter. The filter can use the mqtt like
+// wildcards: `+` matches exactly one topic level and `#` matches the rest of the levels.
+type Subscription struct {
+	filter  []string
+	policy  OverflowPolicy
+	ch      chan *Message
+	done    chan struct{}
+	once    sync.Once
+	dropped int64
+}
+
+// The in process message bus shared by the memory sources and sinks
+type pubsub struct {
+	sync.RWMutex
+	subs map[*Subscription]bool
+}
+
+var bus = &pubsub{subs: make(map[*Subscription]bool)}
+
+func ValidateTopic(topic string) error {
+	if topic == "" {
+		return fmt.Errorf("topic cannot be empty")
+	}
+	if strings.ContainsAny(topic, "+#") {
+		return fmt.Errorf("invalid topic %s: wildcards are not allowed to publish", topic)
+	}
+	return nil
+}
+
+func ValidateFilter(filter string) error {
+	if filter == "" {
+		return fmt.Errorf("topic filter cannot be empty")
+	}
+	levels := strings.Split(filter, "/")
+	for i, l := range levels {
+		if l == "#" && i != len(levels)-1 {
+			return fmt.Errorf("invalid topic filter %s: # must be the last level", filter)
+		}
+		if l != "#" && l != "+" && strings.ContainsAny(l, "+#") {
+			return fmt.Errorf("invalid topic filter %s: wildcard must occupy an entire level", filter)
+		}
+	}
+	return nil
+}
+
+func Subscribe(filter string, bufferLength int, policy OverflowPolicy) (*Subscription, error) {
+	if err := ValidateFilter(filter); err != nil {
+		return nil, err
+	}
+	if bufferLength <= 0 {
+		return nil, fmt.Errorf("invalid bufferLength %d, must be positive", bufferLength)
+	}
+	switch policy {
+	case "":
+		policy = OVERFLOW_BLOCK
+	case OVERFLOW_BLOCK, OVERFLOW_DROP:
+	default:
+		return nil, fmt.Errorf("invalid overflow policy %s, must be block or drop", policy)
+	}
+	s := &Subscription{
+		filter: strings.Split(filter, "/"),
+		policy: policy,
+		ch:     make(chan *Message, bufferLength),
+		done:   make(chan struct{}),
+	}
+	bus.Lock()
+	bus.subs[s] = true
+	bus.Unlock()
+	return s, nil
+}
+
+// Publish the payload to all the matched subscriptions. For the subscriptions with block policy, it will wait until
+// the message is buffered or the done channel is closed.
+func Publish(topic string, payload []byte, done <-chan struct{}) error {
+	if err := ValidateTopic(topic); err != nil {
+		return err
+	}
+	levels := strings.Split(topic, "/")
+	msg := &Message{Topic: topic, Payload: payload}
+	// Copy the matched subscriptions so that a blocking send does not hold the lock
+	var subs []*Subscription
+	bus.RLock()
+	for s := range bus.subs {
+		if match(s.filter, levels) {
+			subs = append(subs, s)
+		}
+	}
+	bus.RUnlock()
+	for _, s := range subs {
+		if s.policy == OVERFLOW_DROP {
+			select {
+			case s.ch <- msg:
+			default:
+				atomic.AddInt64(&s.dropped, 1)
+				common.Log.Debugf("memory topic %s drops message as the subscriber buffer is full", topic)
+			}
+			continue
+		}
+		select {
+		case s.ch <- msg:
+		case <-s.done:
+		case <-done:
+			return fmt.Errorf("publish to memory topic %s is cancelled", topic)
+		}
+	}
+	return nil
+}
+
+func (s *Subscription) Messages() <-chan *Message {
+	return s.ch
+}
+
+// Dropped returns the count of the messages dropped because of the full buffer
+func (s *Subscription) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		// Close done first to release the blocking publishers
+		close(s.done)
+		bus.Lock()
+		delete(bus.subs, s)
+		bus.Unlock()
+	})
+}
+
+func match(filter []string, levels []string) bool {
+	for i, f := range filter {
+		if f == "#" {
+			return true
+		}
+		if i >= len(levels) {
+			return false
+		}
+		if f != "+" && f != levels[i] {
+			return false
+		}
+	}
+	return len(filter) == len(levels)
+}
@@ -0,0 +1,161 @@
+package memory
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	var tests = []struct {
+		filter string
+		topic  string
+		result bool
+	}{
+		{filter: "rule1/out", topic: "rule1/out", result: true},
+		{filter: "rule1/out", topic: "rule1/out/1", result: false},
+		{filter: "rule1/out/1", topic: "rule1/out", result: false},
+		{filter: "+/out", topic: "rule1/out", result: true},
+		{filter: "+/out", topic: "rule1/in", result: false},
+		{filter: "rule1/+", topic: "rule1", result: false},
+		{filter: "rule1/#", topic: "rule1/out/1", result: true},
+		{filter: "rule1/#", topic: "rule1", result: true},
+		{filter: "#", topic: "rule2/out", result: true},
+		{filter: "+/+/1", topic: "rule1/out/1", result: true},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		r := match(strings.Split(tt.filter, "/"), strings.Split(tt.topic, "/"))
+		if r != tt.result {
+			t.Errorf("%d. %s with %s result mismatch:\n  exp=%v\n  got=%v\n\n", i, tt.filter, tt.topic, tt.result, r)
+		}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	var tests = []struct {
+		filter string
+		length int
+		policy OverflowPolicy
+		err    string
+	}{
+		{filter: "rule1/#", length: 10, policy: OVERFLOW_DROP},
+		{filter: "", length: 10, err: "topic filter cannot be empty"},
+		{filter: "rule1/#/out", length: 10, err: "invalid topic filter rule1/#/out: # must be the last level"},
+		{filter: "rule1/o+", length: 10, err: "invalid topic filter rule1/o+: wildcard must occupy an entire level"},
+		{filter: "rule1", length: 0, err: "invalid bufferLength 0, must be positive"},
+		{filter: "rule1", length: 10, policy: "retry", err: "invalid overflow policy retry, must be block or drop"},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		s, err := Subscribe(tt.filter, tt.length, tt.policy)
+		if !reflect.DeepEqual(tt.err, common.Errstring(err)) {
+			t.Errorf("%d. error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.err, err)
+		}
+		if s != nil {
+			s.Close()
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	all, _ := Subscribe("rule1/#", 10, OVERFLOW_BLOCK)
+	defer all.Close()
+	drop, _ := Subscribe("rule1/out", 1, OVERFLOW_DROP)
+	defer drop.Close()
+	other, _ := Subscribe("rule2/out", 1, OVERFLOW_BLOCK)
+	defer other.Close()
+
+	for _, topic := range []string{"rule1/out", "rule1/out", "rule1/err"} {
+		if err := Publish(topic, []byte(topic), nil); err != nil {
+			t.Errorf("publish %s error: %v", topic, err)
+		}
+	}
+	var got []string
+	for len(all.Messages()) > 0 {
+		got = append(got, (<-all.Messages()).Topic)
+	}
+	if exp := []string{"rule1/out", "rule1/out", "rule1/err"}; !reflect.DeepEqual(exp, got) {
+		t.Errorf("block subscription result mismatch:\n  exp=%v\n  got=%v\n\n", exp, got)
+	}
+	if l, d := len(drop.Messages()), drop.Dropped(); l != 1 || d != 1 {
+		t.Errorf("drop subscription expect 1 buffered and 1 dropped, but got %d and %d", l, d)
+	}
+	if l := len(other.Messages()); l != 0 {
+		t.Errorf("unmatched subscription expect no message, but got %d", l)
+	}
+	if err := Publish("rule1/+", nil, nil); common.Errstring(err) != "invalid topic rule1/+: wildcards are not allowed to publish" {
+		t.Errorf("publish to wildcard topic error mismatch, got %v", err)
+	}
+
+	// The full blocking subscription blocks the publisher until cancelled
+	done := make(chan struct{})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(done)
+	}()
+	if err := Publish("rule2/out", nil, nil); err != nil {
+		t.Errorf("publish error: %v", err)
+	}
+	if err := Publish("rule2/out", nil, done); common.Errstring(err) != "publish to memory topic rule2/out is cancelled" {
+		t.Errorf("blocked publish error mismatch, got %v", err)
+	}
+	// Closing the subscription releases the blocked publisher
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		other.Close()
+	}()
+	if err := Publish("rule2/out", nil, nil); err != nil {
+		t.Errorf("publish error: %v", err)
+	}
+}
+
+func TestSubscribeWhilePublishBlocked(t *testing.T) {
+	full, _ := Subscribe("rule3/out", 1, OVERFLOW_BLOCK)
+	defer full.Close()
+	if err := Publish("rule3/out", nil, nil); err != nil {
+		t.Fatalf("publish error: %v", err)
+	}
+	// The publisher blocks on the full subscription
+	done := make(chan struct{})
+	published := make(chan error)
+	go func() {
+		published <- Publish("rule3/out", nil, done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// Subscribing and publishing to the other topics are not blocked
+	subscribed := make(chan struct{})
+	go func() {
+		defer close(subscribed)
+		s, err := Subscribe("rule4/#", 1, OVERFLOW_BLOCK)
+		if err != nil {
+			t.Errorf("subscribe error: %v", err)
+			return
+		}
+		defer s.Close()
+		if err := Publish("rule4/out", nil, nil); err != nil {
+			t.Errorf("publish error: %v", err)
+		}
+	}()
+	select {
+	case <-subscribed:
+	case <-time.After(time.Second):
+		t.Fatal("subscribe is blocked by the blocking publisher")
+	}
+
+	// Consume to release the blocked publisher
+	<-full.Messages()
+	select {
+	case err := <-published:
+		if err != nil {
+			t.Errorf("publish error: %v", err)
+		}
+	case <-time.After(time.Second):
+		close(done)
+		t.Errorf("publish is not released after consuming")
+	}
+}
@@ -0,0 +1,308 @@
+package nodes
+
+import (
+	"encoding/gob"
+	"fmt"
+	"github.com/emqx/kuiper/xsql"
+	"github.com/emqx/kuiper/xstream/api"
+	"strings"
+)
+
+/*
+ *  This node joins two streams without window. Each tuple is buffered by the join key and joined with the tuples
+ *  of the other stream whose timestamp difference is within the interval: right.ts - left.ts in [lower, upper].
+ *  The buffered tuples are expired by the watermark in event time mode or by the latest timestamp in processing time mode.
+ *  The input MUST be *xsql.Tuple and the output is xsql.JoinTupleSets
+ */
+type IntervalJoinNode struct {
+	*defaultSinkNode
+	leftStream         string
+	rightStream        string
+	join               xsql.Join
+	lower              int64
+	upper              int64
+	leftKeys           []xsql.Expr
+	rightKeys          []xsql.Expr
+	isEventTime        bool
+	watermarkGenerator *WatermarkGenerator //For event time only
+	statManager        StatManager
+	// states
+	lefts  map[string][]*xsql.Tuple
+	rights map[string][]*xsql.Tuple
+}
+
+const INTERVAL_JOIN_LEFT_KEY = "$$intervalJoinLeft"
+const INTERVAL_JOIN_RIGHT_KEY = "$$intervalJoinRight"
+
+func init() {
+	gob.Register(map[string][]*xsql.Tuple{})
+}
+
+func NewIntervalJoinNode(name string, leftStream string, rightStream string, join xsql.Join, lower int64, upper int64, leftKeys []xsql.Expr, rightKeys []xsql.Expr, streams []string, options *api.RuleOption) (*IntervalJoinNode, error) {
+	if lower > upper {
+		return nil, fmt.Errorf("invalid interval join bound [%d, %d]", lower, upper)
+	}
+	if len(leftKeys) != len(rightKeys) {
+		return nil, fmt.Errorf("the number of interval join keys mismatch: %d and %d", len(leftKeys), len(rightKeys))
+	}
+	n := &IntervalJoinNode{
+		leftStream:  leftStream,
+		rightStream: rightStream,
+		join:        join,
+		lower:       lower,
+		upper:       upper,
+		leftKeys:    leftKeys,
+		rightKeys:   rightKeys,
+		isEventTime: options.IsEventTime,
+	}
+	n.defaultSinkNode = &defaultSinkNode{
+		input: make(chan interface{}, options.BufferLength),
+		defaultNode: &defaultNode{
+			outputs:   make(map[string]chan<- interface{}),
+			name:      name,
+			sendError: options.SendError,
+		},
+	}
+	if options.IsEventTime {
+		w, err := NewWatermarkGenerator(&WindowConfig{Type: xsql.NOT_WINDOW}, options.LateTol, streams, n.input)
+		if err != nil {
+			return nil, err
+		}
+		n.watermarkGenerator = w
+	}
+	return n, nil
+}
+
+func (n *IntervalJoinNode) Exec(ctx api.StreamContext, errCh chan<- error) {
+	n.ctx = ctx
+	log := ctx.GetLogger()
+	log.Debugf("IntervalJoinNode %s is started", n.name)
+
+	if len(n.outputs) <= 0 {
+		go func() { errCh <- fmt.Errorf("no output channel found") }()
+		return
+	}
+	stats, err := NewStatManager("op", ctx)
+	if err != nil {
+		go func() { errCh <- err }()
+		return
+	}
+	n.statManager = stats
+	go func() {
+		n.lefts = n.restoreBuffer(ctx, INTERVAL_JOIN_LEFT_KEY, errCh)
+		n.rights = n.restoreBuffer(ctx, INTERVAL_JOIN_RIGHT_KEY, errCh)
+		if n.isEventTime {
+			n.watermarkGenerator.lastWatermarkTs = 0
+			if s, err := ctx.GetState(WATERMARK_KEY); err == nil && s != nil {
+				if si, ok := s.(int64); ok {
+					n.watermarkGenerator.lastWatermarkTs = si
+				} else {
+					errCh <- fmt.Errorf("restore interval join state `lastWatermarkTs` %v error, invalid type", s)
+				}
+			}
+			log.Infof("Start with interval join state lastWatermarkTs: %d", n.watermarkGenerator.lastWatermarkTs)
+		}
+		fv, _ := xsql.NewFunctionValuersForOp(ctx, xsql.FuncRegisters)
+
+		for {
+			log.Debugf("IntervalJoinNode %s is looping", n.name)
+			select {
+			case item, opened := <-n.input:
+				processed := false
+				if item, processed = n.preprocess(item); processed {
+					break
+				}
+				n.statManager.ProcessTimeStart()
+				if !opened {
+					n.statManager.IncTotalExceptions()
+					break
+				}
+				switch d := item.(type) {
+				case error:
+					n.statManager.IncTotalRecordsIn()
+					n.Broadcast(d)
+					n.statManager.IncTotalExceptions()
+				case xsql.Event:
+					if d.IsWatermark() {
+						n.expire(ctx, d.GetTimestamp())
+						break
+					}
+					n.statManager.IncTotalRecordsIn()
+					t, ok := d.(*xsql.Tuple)
+					if !ok {
+						n.Broadcast(fmt.Errorf("run IntervalJoinNode error: expect *xsql.Tuple type but got %[1]T(%[1]v)", d))
+						n.statManager.IncTotalExceptions()
+						break
+					}
+					log.Debugf("IntervalJoinNode receive tuple input %s", t)
+					if n.isEventTime && !n.watermarkGenerator.track(t.Emitter, t.Timestamp, ctx) {
+						log.Warnf("IntervalJoinNode drops late event %v", t)
+						break
+					}
+					if err := n.process(ctx, t, fv); err != nil {
+						n.Broadcast(err)
+						n.statManager.IncTotalExceptions()
+						break
+					}
+					if !n.isEventTime {
+						n.expire(ctx, t.Timestamp)
+					}
+				default:
+					n.statManager.IncTotalRecordsIn()
+					n.Broadcast(fmt.Errorf("run IntervalJoinNode error: invalid input type but got %[1]T(%[1]v)", d))
+					n.statManager.IncTotalExceptions()
+				}
+			case <-ctx.Done():
+				log.Infoln("Cancelling interval join node....")
+				return
+			}
+		}
+	}()
+}
+
+func (n *IntervalJoinNode) restoreBuffer(ctx api.StreamContext, key string, errCh chan<- error) map[string][]*xsql.Tuple {
+	log := ctx.GetLogger()
+	if s, err := ctx.GetState(key); err == nil {
+		switch st := s.(type) {
+		case map[string][]*xsql.Tuple:
+			log.Infof("Restore interval join state %s %+v", key, st)
+			return st
+		case nil:
+			log.Debugf("Restore interval join state %s, nothing", key)
+		default:
+			errCh <- fmt.Errorf("restore interval join state %s %v error, invalid type", key, st)
+		}
+	} else {
+		log.Warnf("Restore interval join state fails: %s", err)
+	}
+	return make(map[string][]*xsql.Tuple)
+}
+
+// Buffer the tuple and join it with the buffered tuples of the other stream
+func (n *IntervalJoinNode) process(ctx api.StreamContext, t *xsql.Tuple, fv *xsql.FunctionValuer) error {
+	var (
+		isLeft bool
+		keys   []xsql.Expr
+	)
+	switch t.Emitter {
+	case n.leftStream:
+		isLeft, keys = true, n.leftKeys
+	case n.rightStream:
+		isLeft, keys = false, n.rightKeys
+	default:
+		return fmt.Errorf("run IntervalJoinNode error: receive tuple from unknown emitter %s", t.Emitter)
+	}
+	key, err := n.evalKey(t, keys, fv)
+	if err != nil {
+		return err
+	}
+	sets := xsql.JoinTupleSets{}
+	if isLeft {
+		n.lefts[key] = append(n.lefts[key], t)
+		for _, r := range n.rights[key] {
+			if ok, err := n.match(t, r, fv); err != nil {
+				return err
+			} else if ok {
+				sets = append(sets, xsql.JoinTuple{Tuples: []xsql.Tuple{*t, *r}})
+			}
+		}
+		ctx.PutState(INTERVAL_JOIN_LEFT_KEY, n.lefts)
+	} else {
+		n.rights[key] = append(n.rights[key], t)
+		for _, l := range n.lefts[key] {
+			if ok, err := n.match(l, t, fv); err != nil {
+				return err
+			} else if ok {
+				sets = append(sets, xsql.JoinTuple{Tuples: []xsql.Tuple{*l, *t}})
+			}
+		}
+		ctx.PutState(INTERVAL_JOIN_RIGHT_KEY, n.rights)
+	}
+	if len(sets) > 0 {
+		n.Broadcast(sets)
+		n.statManager.IncTotalRecordsOut()
+	}
+	n.statManager.ProcessTimeEnd()
+	n.statManager.SetBufferLength(int64(len(n.input)))
+	return nil
+}
+
+func (n *IntervalJoinNode) evalKey(t *xsql.Tuple, keys []xsql.Expr, fv *xsql.FunctionValuer) (string, error) {
+	if len(keys) == 0 {
+		return "", nil
+	}
+	ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(&xsql.JoinTuple{Tuples: []xsql.Tuple{*t}}, fv)}
+	values := make([]string, len(keys))
+	for i, k := range keys {
+		v := ve.Eval(k)
+		if err, ok := v.(error); ok {
+			return "", fmt.Errorf("run IntervalJoinNode error: evaluate join key %s fails: %v", k, err)
+		}
+		values[i] = fmt.Sprintf("%v", v)
+	}
+	return strings.Join(values, ","), nil
+}
+
+func (n *IntervalJoinNode) match(left *xsql.Tuple, right *xsql.Tuple, fv *xsql.FunctionValuer) (bool, error) {
+	d := right.Timestamp - left.Timestamp
+	if d < n.lower || d > n.upper {
+		return false, nil
+	}
+	if n.join.Expr == nil {
+		return true, nil
+	}
+	temp := &xsql.JoinTuple{Tuples: []xsql.Tuple{*left, *right}}
+	ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(temp, fv)}
+	switch r := ve.Eval(n.join.Expr).(type) {
+	case error:
+		return false, fmt.Errorf("run IntervalJoinNode error: %s", r)
+	case bool:
+		return r, nil
+	case nil:
+		return false, nil
+	default:
+		return false, fmt.Errorf("run IntervalJoinNode error: invalid join condition that returns non-bool value %[1]T(%[1]v)", r)
+	}
+}
+
+// Remove the tuples which can never be joined by the later tuples whose timestamp is not less than ts
+func (n *IntervalJoinNode) expire(ctx api.StreamContext, ts int64) {
+	if expireBuffer(n.lefts, func(t *xsql.Tuple) bool { return t.Timestamp+n.upper < ts }) {
+		ctx.PutState(INTERVAL_JOIN_LEFT_KEY, n.lefts)
+	}
+	if expireBuffer(n.rights, func(t *xsql.Tuple) bool { return t.Timestamp-n.lower < ts }) {
+		ctx.PutState(INTERVAL_JOIN_RIGHT_KEY, n.rights)
+	}
+}
+
+func expireBuffer(buffer map[string][]*xsql.Tuple, expired func(t *xsql.Tuple) bool) bool {
+	changed := false
+	for k, tuples := range buffer {
+		i := 0
+		for _, t := range tuples {
+			if !expired(t) {
+				tuples[i] = t
+				i++
+			}
+		}
+		if i < len(tuples) {
+			changed = true
+			if i == 0 {
+				delete(buffer, k)
+			} else {
+				buffer[k] = tuples[:i]
+			}
+		}
+	}
+	return changed
+}
+
+func (n *IntervalJoinNode) GetMetrics() [][]interface{} {
+	if n.statManager != nil {
+		return [][]interface{}{
+			n.statManager.GetMetrics(),
+		}
+	} else {
+		return nil
+	}
+}
@@ -0,0 +1,78 @@
+package nodes
+
+import (
+	"container/list"
+	"github.com/emqx/kuiper/common"
+)
+
+type LookupCacheConf struct {
+	Cache           bool `json:"cache"`
+	CacheTtl        int  `json:"cacheTtl"`
+	CacheSize       int  `json:"cacheSize"`
+	CacheMissingKey bool `json:"cacheMissingKey"`
+}
+
+type cacheEntry struct {
+	key     string
+	rows    []map[string]interface{}
+	expires int64
+}
+
+// The LRU cache of lookup results with ttl. It is only accessed by the lookup node goroutine, so no lock is needed
+type lookupCache struct {
+	ttl          int64
+	size         int
+	cacheMissing bool
+	entries      map[string]*list.Element
+	lru          *list.List
+}
+
+func newLookupCache(conf *LookupCacheConf) *lookupCache {
+	if !conf.Cache {
+		return nil
+	}
+	return &lookupCache{
+		ttl:          int64(conf.CacheTtl),
+		size:         conf.CacheSize,
+		cacheMissing: conf.CacheMissingKey,
+		entries:      make(map[string]*list.Element),
+		lru:          list.New(),
+	}
+}
+
+func (c *lookupCache) get(key string) ([]map[string]interface{}, bool) {
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*cacheEntry)
+	if c.ttl > 0 && entry.expires < common.GetNowInMilli() {
+		c.lru.Remove(e)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return entry.rows, true
+}
+
+func (c *lookupCache) set(key string, rows []map[string]interface{}) {
+	if len(rows) == 0 && !c.cacheMissing {
+		return
+	}
+	var expires int64
+	if c.ttl > 0 {
+		expires = common.GetNowInMilli() + c.ttl
+	}
+	if e, ok := c.entries[key]; ok {
+		entry := e.Value.(*cacheEntry)
+		entry.rows, entry.expires = rows, expires
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, rows: rows, expires: expires})
+	if c.size > 0 && c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
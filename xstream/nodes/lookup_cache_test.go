@@ -0,0 +1,55 @@
+package nodes
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/xstream/topotest/mockclock"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLookupCache(t *testing.T) {
+	mockclock.ResetClock(1541152486000)
+	c := newLookupCache(&LookupCacheConf{Cache: true, CacheTtl: 1000, CacheSize: 2})
+	red := []map[string]interface{}{{"color": "red"}}
+	blue := []map[string]interface{}{{"color": "blue"}}
+	c.set("red", red)
+	c.set("blue", blue)
+	// missing keys are not cached by default
+	c.set("yellow", nil)
+	var tests = []struct {
+		key    string
+		leap   int64
+		result []map[string]interface{}
+		ok     bool
+	}{
+		{key: "red", result: red, ok: true},
+		{key: "yellow", ok: false},
+		{key: "blue", leap: 500, result: blue, ok: true},
+		{key: "red", leap: 600, ok: false},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		mockclock.GetMockClock().Add(time.Duration(tt.leap) * time.Millisecond)
+		r, ok := c.get(tt.key)
+		if ok != tt.ok || !reflect.DeepEqual(tt.result, r) {
+			t.Errorf("%d. get %s mismatch:\n  exp=%v %v\n  got=%v %v\n\n", i, tt.key, tt.result, tt.ok, r, ok)
+		}
+	}
+	// red has expired, so blue is the least recently used one to be evicted
+	c.set("green", red)
+	c.set("white", red)
+	if _, ok := c.get("green"); !ok {
+		t.Errorf("green should be cached")
+	}
+	if _, ok := c.get("blue"); ok {
+		t.Errorf("blue should be evicted")
+	}
+	if c.lru.Len() != 2 {
+		t.Errorf("cache size should be 2 but got %d", c.lru.Len())
+	}
+
+	if newLookupCache(&LookupCacheConf{Cache: false}) != nil {
+		t.Errorf("cache should be disabled")
+	}
+}
@@ -0,0 +1,316 @@
+package nodes
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/secrets"
+	"github.com/emqx/kuiper/xsql"
+	"github.com/emqx/kuiper/xstream/api"
+	"github.com/emqx/kuiper/xstream/extensions"
+	"strings"
+)
+
+/*
+ *  This node joins the stream with a lookup table. For each input row, it queries the lookup source by the join keys
+ *  and joins the returned rows. The lookup results are cached if the cache is enabled in the source configuration.
+ *  The input could be *xsql.Tuple, xsql.WindowTuplesSet or xsql.JoinTupleSets and the output is xsql.JoinTupleSets
+ */
+type LookupNode struct {
+	*defaultSinkNode
+	sourceType  string
+	options     *xsql.Options
+	join        xsql.Join
+	fields      []string
+	keys        []string
+	keyExprs    []xsql.Expr
+	source      api.LookupSource
+	cache       *lookupCache
+	statManager StatManager
+}
+
+func NewLookupNode(name string, fields []string, keys []string, keyExprs []xsql.Expr, join xsql.Join, sourceType string, options *xsql.Options, ruleOptions *api.RuleOption) (*LookupNode, error) {
+	if len(keys) == 0 || len(keys) != len(keyExprs) {
+		return nil, fmt.Errorf("invalid lookup keys %v", keys)
+	}
+	switch join.JoinType {
+	case xsql.INNER_JOIN, xsql.LEFT_JOIN:
+	default:
+		return nil, fmt.Errorf("lookup table %s only supports inner join and left join", join.Name)
+	}
+	n := &LookupNode{
+		sourceType: sourceType,
+		options:    options,
+		join:       join,
+		fields:     fields,
+		keys:       keys,
+		keyExprs:   keyExprs,
+	}
+	n.defaultSinkNode = &defaultSinkNode{
+		input: make(chan interface{}, ruleOptions.BufferLength),
+		defaultNode: &defaultNode{
+			outputs:   make(map[string]chan<- interface{}),
+			name:      name,
+			sendError: ruleOptions.SendError,
+		},
+	}
+	return n, nil
+}
+
+func (n *LookupNode) Exec(ctx api.StreamContext, errCh chan<- error) {
+	n.ctx = ctx
+	log := ctx.GetLogger()
+	log.Debugf("LookupNode %s is started", n.name)
+
+	if len(n.outputs) <= 0 {
+		go func() { errCh <- fmt.Errorf("no output channel found") }()
+		return
+	}
+	stats, err := NewStatManager("op", ctx)
+	if err != nil {
+		go func() { errCh <- err }()
+		return
+	}
+	n.statManager = stats
+	go func() {
+		err := n.openSource(ctx)
+		if err != nil {
+			select {
+			case errCh <- err:
+			case <-ctx.Done():
+			}
+			return
+		}
+		fv, _ := xsql.NewFunctionValuersForOp(ctx, xsql.FuncRegisters)
+		for {
+			log.Debugf("LookupNode %s is looping", n.name)
+			select {
+			case item, opened := <-n.input:
+				processed := false
+				if item, processed = n.preprocess(item); processed {
+					break
+				}
+				n.statManager.IncTotalRecordsIn()
+				n.statManager.ProcessTimeStart()
+				if !opened {
+					n.statManager.IncTotalExceptions()
+					break
+				}
+				if err := n.process(ctx, item, fv); err != nil {
+					n.Broadcast(err)
+					n.statManager.IncTotalExceptions()
+				}
+				n.statManager.ProcessTimeEnd()
+				n.statManager.SetBufferLength(int64(len(n.input)))
+			case <-ctx.Done():
+				log.Infoln("Cancelling lookup node....")
+				if err := n.source.Close(ctx); err != nil {
+					log.Warnf("close lookup source error: %v", err)
+				}
+				return
+			}
+		}
+	}()
+}
+
+func (n *LookupNode) openSource(ctx api.StreamContext) error {
+	props := getSourceConf(ctx, n.sourceType, n.options)
+	if n.options.KEY != "" {
+		props["$key"] = n.options.KEY
+	}
+	conf := &LookupCacheConf{}
+	if err := common.MapToStruct(props, conf); err != nil {
+		return fmt.Errorf("read lookup cache properties %v fail with error: %v", props, err)
+	}
+	n.cache = newLookupCache(conf)
+	s, err := getLookupSource(n.sourceType)
+	if err != nil {
+		return err
+	}
+	cprops, err := secrets.Resolve(props)
+	if err != nil {
+		return err
+	}
+	if err := s.Configure(n.options.DATASOURCE, cprops); err != nil {
+		return err
+	}
+	if err := s.Open(ctx); err != nil {
+		return err
+	}
+	n.source = s
+	return nil
+}
+
+func getLookupSource(t string) (api.LookupSource, error) {
+	switch t {
+	case "sql":
+		return &extensions.SQLLookupSource{}, nil
+	case "memory":
+		return &extensions.MemoryLookupSource{}, nil
+	default:
+		return nil, fmt.Errorf("lookup table type %s is not supported", t)
+	}
+}
+
+// Process one input and send the joined rows. The errors including the error inputs are returned to be sent
+// and counted by the caller
+func (n *LookupNode) process(ctx api.StreamContext, item interface{}, fv *xsql.FunctionValuer) error {
+	var rows xsql.JoinTupleSets
+	switch d := item.(type) {
+	case error:
+		return d
+	case *xsql.Tuple:
+		rows = xsql.JoinTupleSets{{Tuples: []xsql.Tuple{*d}}}
+	case xsql.WindowTuplesSet:
+		for _, wt := range d {
+			for _, t := range wt.Tuples {
+				rows = append(rows, xsql.JoinTuple{Tuples: []xsql.Tuple{t}})
+			}
+		}
+	case xsql.JoinTupleSets:
+		rows = d
+	default:
+		return fmt.Errorf("run lookup node error: invalid input type but got %[1]T(%[1]v)", d)
+	}
+	result, err := n.lookup(ctx, rows, fv)
+	if err != nil {
+		return err
+	}
+	if len(result) > 0 {
+		n.Broadcast(result)
+		n.statManager.IncTotalRecordsOut()
+	}
+	return nil
+}
+
+// Query the lookup rows of all the distinct keys in the input at batch and join them
+func (n *LookupNode) lookup(ctx api.StreamContext, rows xsql.JoinTupleSets, fv *xsql.FunctionValuer) (xsql.JoinTupleSets, error) {
+	keys := make([]string, len(rows))
+	lookupRows := make(map[string][]map[string]interface{})
+	var (
+		missingKeys   []string
+		missingValues [][]interface{}
+	)
+	for i, row := range rows {
+		k, values, err := n.evalKey(&row, fv)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = k
+		if values == nil {
+			continue
+		}
+		if _, ok := lookupRows[k]; ok {
+			continue
+		}
+		if n.cache != nil {
+			if r, ok := n.cache.get(k); ok {
+				lookupRows[k] = r
+				continue
+			}
+		}
+		lookupRows[k] = nil
+		missingKeys = append(missingKeys, k)
+		missingValues = append(missingValues, values)
+	}
+	if len(missingKeys) > 0 {
+		results, err := n.query(ctx, missingValues)
+		if err != nil {
+			return nil, fmt.Errorf("run lookup node error: query lookup table %s fails: %v", n.join.Name, err)
+		}
+		for i, k := range missingKeys {
+			lookupRows[k] = results[i]
+			if n.cache != nil {
+				n.cache.set(k, results[i])
+			}
+		}
+	}
+	var result xsql.JoinTupleSets
+	for i, row := range rows {
+		matched := false
+		for _, r := range lookupRows[keys[i]] {
+			merged := xsql.JoinTuple{Tuples: make([]xsql.Tuple, len(row.Tuples), len(row.Tuples)+1)}
+			copy(merged.Tuples, row.Tuples)
+			merged.AddTuple(xsql.Tuple{Emitter: n.join.Name, Message: r, Timestamp: row.Tuples[0].Timestamp})
+			ok, err := n.match(&merged, fv)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				result = append(result, merged)
+				matched = true
+			}
+		}
+		if !matched && n.join.JoinType == xsql.LEFT_JOIN {
+			result = append(result, row)
+		}
+	}
+	return result, nil
+}
+
+func (n *LookupNode) query(ctx api.StreamContext, values [][]interface{}) ([][]map[string]interface{}, error) {
+	if bs, ok := n.source.(api.BatchLookupSource); ok && len(values) > 1 {
+		r, err := bs.LookupBatch(ctx, n.fields, n.keys, values)
+		if err != nil {
+			return nil, err
+		}
+		if len(r) != len(values) {
+			return nil, fmt.Errorf("expect %d results from batch lookup but got %d", len(values), len(r))
+		}
+		return r, nil
+	}
+	results := make([][]map[string]interface{}, len(values))
+	for i, v := range values {
+		r, err := n.source.Lookup(ctx, n.fields, n.keys, v)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = r
+	}
+	return results, nil
+}
+
+// Evaluate the key values of the row. Return nil values if any key is nil which cannot match any lookup row
+func (n *LookupNode) evalKey(row *xsql.JoinTuple, fv *xsql.FunctionValuer) (string, []interface{}, error) {
+	ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(row, fv)}
+	values := make([]interface{}, len(n.keyExprs))
+	strs := make([]string, len(n.keyExprs))
+	for i, k := range n.keyExprs {
+		v := ve.Eval(k)
+		switch vt := v.(type) {
+		case error:
+			return "", nil, fmt.Errorf("run lookup node error: evaluate lookup key %s fails: %v", k, vt)
+		case nil:
+			return "", nil, nil
+		}
+		values[i] = v
+		strs[i] = fmt.Sprintf("%v", v)
+	}
+	return strings.Join(strs, ","), values, nil
+}
+
+func (n *LookupNode) match(row *xsql.JoinTuple, fv *xsql.FunctionValuer) (bool, error) {
+	if n.join.Expr == nil {
+		return true, nil
+	}
+	ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(row, fv)}
+	switch r := ve.Eval(n.join.Expr).(type) {
+	case error:
+		return false, fmt.Errorf("run lookup node error: %s", r)
+	case bool:
+		return r, nil
+	case nil:
+		return false, nil
+	default:
+		return false, fmt.Errorf("run lookup node error: invalid join condition that returns non-bool value %[1]T(%[1]v)", r)
+	}
+}
+
+func (n *LookupNode) GetMetrics() [][]interface{} {
+	if n.statManager != nil {
+		return [][]interface{}{
+			n.statManager.GetMetrics(),
+		}
+	} else {
+		return nil
+	}
+}
@@ -196,6 +196,9 @@ func getSourceConf(ctx api.StreamContext, sourceType string, options *xsql.Optio
 		f = "json"
 	}
 	props["format"] = strings.ToLower(f)
+	if options.SCHEMAID != "" {
+		props["schemaId"] = options.SCHEMAID
+	}
 	logger.Debugf("get conf for %s with conf key %s: %v", sourceType, confkey, props)
 	return props
 }
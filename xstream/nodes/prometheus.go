@@ -11,9 +11,11 @@ const ExceptionsTotal = "exceptions_total"
 const ProcessLatencyUs = "process_latency_us"
 const LastInvocation = "last_invocation"
 const BufferLength = "buffer_length"
+const LateEventsTotal = "late_events_total"
 
 var (
-	MetricNames        = []string{RecordsInTotal, RecordsOutTotal, ExceptionsTotal, ProcessLatencyUs, BufferLength, LastInvocation}
+	// LateEventsTotal is only reported by the event time window operators
+	MetricNames        = []string{RecordsInTotal, RecordsOutTotal, ExceptionsTotal, ProcessLatencyUs, BufferLength, LastInvocation, LateEventsTotal}
 	prometheuseMetrics *PrometheusMetrics
 	mutex              sync.RWMutex
 )
@@ -7,6 +7,7 @@ import (
 	"github.com/emqx/kuiper/common"
 	"github.com/emqx/kuiper/common/templates"
 	"github.com/emqx/kuiper/plugins"
+	"github.com/emqx/kuiper/secrets"
 	"github.com/emqx/kuiper/xstream/api"
 	"github.com/emqx/kuiper/xstream/sinks"
 	"sync"
@@ -14,6 +15,9 @@ import (
 	"time"
 )
 
+// The checkpoint id of the last pre-committed transactions
+const PRECOMMIT_KEY = "$$precommit"
+
 type SinkNode struct {
 	*defaultSinkNode
 	//static
@@ -23,8 +27,14 @@ type SinkNode struct {
 	options map[string]interface{}
 	isMock  bool
 	//states varies after restart
-	sinks []api.Sink
-	tch   chan struct{} //channel to trigger cache saved, will be trigger by checkpoint only
+	sinks    []api.Sink
+	tpcSinks []*tpcSinkInstance //two phase commit sinks, only for exactly once qos
+	tch      chan struct{}      //channel to trigger cache saved, will be trigger by checkpoint only
+}
+
+type tpcSinkInstance struct {
+	sink api.TwoPhaseCommitSink
+	ctx  api.StreamContext
 }
 
 func NewSinkNode(name string, sinkType string, props map[string]interface{}) *SinkNode {
@@ -160,6 +170,20 @@ func (m *SinkNode) Open(ctx api.StreamContext, result chan<- error) {
 			}
 		}
 
+		var codec common.MessageCodec
+		if f, ok := m.options["format"]; ok && f != common.FORMAT_JSON {
+			if tp != nil {
+				logger.Warnf("format property %v is ignored as dataTemplate is set", f)
+			} else if c, err := common.GetCodecFromProps(m.options); err != nil {
+				msg := fmt.Sprintf("property format %v is invalid: %v", f, err)
+				logger.Warnf(msg)
+				result <- fmt.Errorf(msg)
+				return
+			} else {
+				codec = c
+			}
+		}
+
 		m.reset()
 		logger.Infof("open sink node %d instances", m.concurrency)
 		for i := 0; i < m.concurrency; i++ { // workers
@@ -168,7 +192,11 @@ func (m *SinkNode) Open(ctx api.StreamContext, result chan<- error) {
 				var err error
 				if !m.isMock {
 					logger.Debugf("Trying to get sink for rule %s with options %v\n", ctx.GetRuleId(), m.options)
-					sink, err = getSink(m.sinkType, m.options)
+					var props map[string]interface{}
+					props, err = secrets.Resolve(m.options)
+					if err == nil {
+						sink, err = getSink(m.sinkType, props)
+					}
 					if err != nil {
 						m.drainError(result, err, ctx, logger)
 						return
@@ -187,6 +215,19 @@ func (m *SinkNode) Open(ctx api.StreamContext, result chan<- error) {
 					sink = m.sinks[instance]
 				}
 
+				// The two phase commit sink writes in transactions instead of the cache. Each instance has its own
+				// context so that it can save the state separately
+				sctx := ctx
+				tpc, isTpc := sink.(api.TwoPhaseCommitSink)
+				isTpc = isTpc && m.qos == api.ExactlyOnce
+				if isTpc {
+					sctx = ctx.WithInstance(instance)
+					if err := m.recoverTransactions(tpc, sctx); err != nil {
+						m.drainError(result, err, ctx, logger)
+						return
+					}
+				}
+
 				stats, err := NewStatManager("sink", ctx)
 				if err != nil {
 					m.drainError(result, err, ctx, logger)
@@ -196,7 +237,7 @@ func (m *SinkNode) Open(ctx api.StreamContext, result chan<- error) {
 				m.statManagers = append(m.statManagers, stats)
 				m.mutex.Unlock()
 
-				if common.Config.Sink.DisableCache {
+				if common.Config.Sink.DisableCache || isTpc {
 					for {
 						select {
 						case data := <-m.input:
@@ -207,13 +248,13 @@ func (m *SinkNode) Open(ctx api.StreamContext, result chan<- error) {
 							}
 							stats.SetBufferLength(int64(len(m.input)))
 							if runAsync {
-								go doCollect(sink, data, stats, omitIfEmpty, sendSingle, tp, ctx)
+								go doCollect(sink, data, stats, omitIfEmpty, sendSingle, tp, codec, sctx)
 							} else {
-								doCollect(sink, data, stats, omitIfEmpty, sendSingle, tp, ctx)
+								doCollect(sink, data, stats, omitIfEmpty, sendSingle, tp, codec, sctx)
 							}
 						case <-ctx.Done():
 							logger.Infof("sink node %s instance %d done", m.name, instance)
-							if err := sink.Close(ctx); err != nil {
+							if err := sink.Close(sctx); err != nil {
 								logger.Warnf("close sink node %s instance %d fails: %v", m.name, instance, err)
 							}
 							return
@@ -239,9 +280,9 @@ func (m *SinkNode) Open(ctx api.StreamContext, result chan<- error) {
 							}
 							stats.SetBufferLength(int64(len(m.input)))
 							if runAsync {
-								go doCollectCacheTuple(sink, data, stats, retryInterval, retryCount, omitIfEmpty, sendSingle, tp, cache.Complete, ctx)
+								go doCollectCacheTuple(sink, data, stats, retryInterval, retryCount, omitIfEmpty, sendSingle, tp, codec, cache.Complete, ctx)
 							} else {
-								doCollectCacheTuple(sink, data, stats, retryInterval, retryCount, omitIfEmpty, sendSingle, tp, cache.Complete, ctx)
+								doCollectCacheTuple(sink, data, stats, retryInterval, retryCount, omitIfEmpty, sendSingle, tp, codec, cache.Complete, ctx)
 							}
 						case <-ctx.Done():
 							logger.Infof("sink node %s instance %d done", m.name, instance)
@@ -257,13 +298,47 @@ func (m *SinkNode) Open(ctx api.StreamContext, result chan<- error) {
 	}()
 }
 
+// GetOptions returns the properties of the sink action
+func (m *SinkNode) GetOptions() map[string]interface{} {
+	return m.options
+}
+
 func (m *SinkNode) reset() {
 	if !m.isMock {
 		m.sinks = nil
 	}
+	m.tpcSinks = nil
 	m.statManagers = nil
 }
 
+// Commit the transactions which are pre-committed in the restored checkpoint and abort the others. Then begin a new
+// transaction.
+func (m *SinkNode) recoverTransactions(sink api.TwoPhaseCommitSink, ctx api.StreamContext) error {
+	logger := ctx.GetLogger()
+	if v, err := ctx.GetState(PRECOMMIT_KEY); err != nil {
+		return err
+	} else if v != nil {
+		checkpointId, ok := v.(int64)
+		if !ok {
+			return fmt.Errorf("invalid pre-commit checkpoint id %v", v)
+		}
+		logger.Infof("sink node %s instance %d commits the transactions of restored checkpoint %d", m.name, ctx.GetInstanceId(), checkpointId)
+		if err := sink.Commit(ctx, checkpointId); err != nil {
+			return err
+		}
+	}
+	if err := sink.Abort(ctx); err != nil {
+		return err
+	}
+	if err := sink.Begin(ctx); err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	m.tpcSinks = append(m.tpcSinks, &tpcSinkInstance{sink: sink, ctx: ctx})
+	m.mutex.Unlock()
+	return nil
+}
+
 func extractInput(v []byte) ([]map[string]interface{}, error) {
 	var j []map[string]interface{}
 	if err := json.Unmarshal(v, &j); err != nil {
@@ -272,12 +347,12 @@ func extractInput(v []byte) ([]map[string]interface{}, error) {
 	return j, nil
 }
 
-func doCollect(sink api.Sink, item interface{}, stats StatManager, omitIfEmpty bool, sendSingle bool, tp *template.Template, ctx api.StreamContext) {
+func doCollect(sink api.Sink, item interface{}, stats StatManager, omitIfEmpty bool, sendSingle bool, tp *template.Template, codec common.MessageCodec, ctx api.StreamContext) {
 	stats.IncTotalRecordsIn()
 	stats.ProcessTimeStart()
 	defer stats.ProcessTimeEnd()
 	logger := ctx.GetLogger()
-	outdatas := getOutData(stats, ctx, item, omitIfEmpty, sendSingle, tp)
+	outdatas := getOutData(stats, ctx, item, omitIfEmpty, sendSingle, tp, codec)
 
 	for _, outdata := range outdatas {
 		if err := sink.Collect(ctx, outdata); err != nil {
@@ -289,7 +364,7 @@ func doCollect(sink api.Sink, item interface{}, stats StatManager, omitIfEmpty b
 	}
 }
 
-func getOutData(stats StatManager, ctx api.StreamContext, item interface{}, omitIfEmpty bool, sendSingle bool, tp *template.Template) [][]byte {
+func getOutData(stats StatManager, ctx api.StreamContext, item interface{}, omitIfEmpty bool, sendSingle bool, tp *template.Template, codec common.MessageCodec) [][]byte {
 	logger := ctx.GetLogger()
 	var outdatas [][]byte
 	switch val := item.(type) {
@@ -301,7 +376,7 @@ func getOutData(stats StatManager, ctx api.StreamContext, item interface{}, omit
 			err error
 			j   []map[string]interface{}
 		)
-		if sendSingle || tp != nil {
+		if sendSingle || tp != nil || codec != nil {
 			j, err = extractInput(val)
 			if err != nil {
 				logger.Warnf("sink node %s instance %d publish %s error: %v", ctx.GetOpId(), ctx.GetInstanceId(), val, err)
@@ -320,6 +395,14 @@ func getOutData(stats StatManager, ctx api.StreamContext, item interface{}, omit
 					return nil
 				}
 				outdatas = append(outdatas, output.Bytes())
+			} else if codec != nil {
+				ot, e := codec.Encode(j)
+				if e != nil {
+					logger.Warnf("sink node %s instance %d publish %s encode error: %v", ctx.GetOpId(), ctx.GetInstanceId(), val, e)
+					stats.IncTotalExceptions()
+					return nil
+				}
+				outdatas = [][]byte{ot}
 			} else {
 				outdatas = [][]byte{val}
 			}
@@ -334,6 +417,14 @@ func getOutData(stats StatManager, ctx api.StreamContext, item interface{}, omit
 						return nil
 					}
 					outdatas = append(outdatas, output.Bytes())
+				} else if codec != nil {
+					if ot, e := codec.Encode(r); e != nil {
+						logger.Warnf("sink node %s instance %d publish %s encode error: %v", ctx.GetOpId(), ctx.GetInstanceId(), r, e)
+						stats.IncTotalExceptions()
+						return nil
+					} else {
+						outdatas = append(outdatas, ot)
+					}
 				} else {
 					if ot, e := json.Marshal(r); e != nil {
 						logger.Warnf("sink node %s instance %d publish %s marshal error: %v", ctx.GetOpId(), ctx.GetInstanceId(), r, e)
@@ -354,12 +445,12 @@ func getOutData(stats StatManager, ctx api.StreamContext, item interface{}, omit
 	return outdatas
 }
 
-func doCollectCacheTuple(sink api.Sink, item *CacheTuple, stats StatManager, retryInterval, retryCount int, omitIfEmpty bool, sendSingle bool, tp *template.Template, signalCh chan<- int, ctx api.StreamContext) {
+func doCollectCacheTuple(sink api.Sink, item *CacheTuple, stats StatManager, retryInterval, retryCount int, omitIfEmpty bool, sendSingle bool, tp *template.Template, codec common.MessageCodec, signalCh chan<- int, ctx api.StreamContext) {
 	stats.IncTotalRecordsIn()
 	stats.ProcessTimeStart()
 	defer stats.ProcessTimeEnd()
 	logger := ctx.GetLogger()
-	outdatas := getOutData(stats, ctx, item.data, omitIfEmpty, sendSingle, tp)
+	outdatas := getOutData(stats, ctx, item.data, omitIfEmpty, sendSingle, tp, codec)
 	for _, outdata := range outdatas {
 	outerloop:
 		for {
@@ -394,28 +485,36 @@ func doCollectCacheTuple(sink api.Sink, item *CacheTuple, stats StatManager, ret
 	}
 }
 
-func doGetSink(name string, action map[string]interface{}) (api.Sink, error) {
-	var (
-		s   api.Sink
-		err error
-	)
-	switch name {
-	case "log":
-		s = sinks.NewLogSink()
-	case "logToMemory":
-		s = sinks.NewLogSinkToMemory()
-	case "mqtt":
-		s = &sinks.MQTTSink{}
-	case "rest":
-		s = &sinks.RestSink{}
-	case "nop":
-		s = &sinks.NopSink{}
-	default:
-		s, err = plugins.GetSink(name)
-		if err != nil {
-			return nil, err
+// ValidateExactlyOnce checks the sink options for the rule of exactly once qos. The transactions of the two phase
+// commit sink are aligned with the checkpoint barrier received by the sink node, so the data must be collected in
+// order by one sink instance.
+func ValidateExactlyOnce(name string, action map[string]interface{}) error {
+	concurrency := 1
+	if c, ok := action["concurrency"]; ok {
+		if t, err := common.ToInt(c, common.STRICT); err == nil {
+			concurrency = t
 		}
 	}
+	runAsync, _ := action["runAsync"].(bool)
+	if concurrency <= 1 && !runAsync {
+		return nil
+	}
+	// The unknown sink is reported when the rule starts
+	s, err := newSink(name)
+	if err != nil {
+		return nil
+	}
+	if _, ok := s.(api.TwoPhaseCommitSink); ok {
+		return fmt.Errorf("sink %s writes in transactions for the exactly once qos, concurrency and runAsync are not supported", name)
+	}
+	return nil
+}
+
+func doGetSink(name string, action map[string]interface{}) (api.Sink, error) {
+	s, err := newSink(name)
+	if err != nil {
+		return nil, err
+	}
 	err = s.Configure(action)
 	if err != nil {
 		return nil, err
@@ -423,6 +522,24 @@ func doGetSink(name string, action map[string]interface{}) (api.Sink, error) {
 	return s, nil
 }
 
+// The built-in sinks by name
+var builtinSinks = map[string]func() api.Sink{
+	"log":         func() api.Sink { return sinks.NewLogSink() },
+	"logToMemory": func() api.Sink { return sinks.NewLogSinkToMemory() },
+	"mqtt":        func() api.Sink { return &sinks.MQTTSink{} },
+	"rest":        func() api.Sink { return &sinks.RestSink{} },
+	"nop":         func() api.Sink { return &sinks.NopSink{} },
+	"memory":      func() api.Sink { return &sinks.MemorySink{} },
+	"sql":         func() api.Sink { return &sinks.SQLSink{} },
+}
+
+func newSink(name string) (api.Sink, error) {
+	if f, ok := builtinSinks[name]; ok {
+		return f(), nil
+	}
+	return plugins.GetSink(name)
+}
+
 //Override defaultNode
 func (m *SinkNode) AddOutput(_ chan<- interface{}, name string) error {
 	return fmt.Errorf("fail to add output %s, sink %s cannot add output", name, m.name)
@@ -460,3 +577,32 @@ func (m *SinkNode) close(ctx api.StreamContext, logger api.Logger) {
 func (m *SinkNode) SaveCache() {
 	m.tch <- struct{}{}
 }
+
+// Only called when checkpoint enabled. Called when the barrier arrives before taking the snapshot
+func (m *SinkNode) PreCommit(checkpointId int64) error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if len(m.tpcSinks) == 0 {
+		return nil
+	}
+	for _, s := range m.tpcSinks {
+		if err := s.sink.PreCommit(s.ctx, checkpointId); err != nil {
+			return fmt.Errorf("sink %s instance %d fails to pre-commit checkpoint %d: %v", m.name, s.ctx.GetInstanceId(), checkpointId, err)
+		}
+		if err := s.sink.Begin(s.ctx); err != nil {
+			return fmt.Errorf("sink %s instance %d fails to begin transaction: %v", m.name, s.ctx.GetInstanceId(), err)
+		}
+	}
+	return m.ctx.PutState(PRECOMMIT_KEY, checkpointId)
+}
+
+// Only called when checkpoint enabled. If the commit fails, it will be committed again in the next checkpoint
+func (m *SinkNode) Commit(checkpointId int64) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for _, s := range m.tpcSinks {
+		if err := s.sink.Commit(s.ctx, checkpointId); err != nil {
+			s.ctx.GetLogger().Warnf("sink %s instance %d fails to commit checkpoint %d: %v", m.name, s.ctx.GetInstanceId(), checkpointId, err)
+		}
+	}
+}
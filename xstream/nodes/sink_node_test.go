@@ -100,3 +100,89 @@ func TestSinkTemplate_Apply(t *testing.T) {
 		}
 	}
 }
+
+func TestSinkFormat_Apply(t *testing.T) {
+	common.InitConf()
+	var tests = []struct {
+		config map[string]interface{}
+		data   []byte
+		result [][]byte
+	}{
+		{
+			config: map[string]interface{}{
+				"format":   "csv",
+				"schemaId": "ab,cd",
+			},
+			data:   []byte(`[{"ab":"hello1","cd":1},{"ab":"hello2","cd":2.5}]`),
+			result: [][]byte{[]byte("hello1,1\nhello2,2.5")},
+		}, {
+			config: map[string]interface{}{
+				"sendSingle": true,
+				"format":     "csv",
+				"delimiter":  ";",
+			},
+			data:   []byte(`[{"ab":"hello1","cd":1},{"ab":"hello2","cd":2.5}]`),
+			result: [][]byte{[]byte(`hello1;1`), []byte(`hello2;2.5`)},
+		}, {
+			config: map[string]interface{}{
+				"sendSingle": true,
+				"format":     "binary",
+			},
+			data:   []byte(`[{"self":"aGVsbG8="}]`),
+			result: [][]byte{[]byte(`hello`)},
+		}, {
+			config: map[string]interface{}{
+				"format": "json",
+			},
+			data:   []byte(`[{"ab":"hello1"},{"ab":"hello2"}]`),
+			result: [][]byte{[]byte(`[{"ab":"hello1"},{"ab":"hello2"}]`)},
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	contextLogger := common.Log.WithField("rule", "TestSinkFormat_Apply")
+	ctx := contexts.WithValue(contexts.Background(), contexts.LoggerKey, contextLogger)
+
+	for i, tt := range tests {
+		mockSink := mocknodes.NewMockSink()
+		s := NewSinkNodeWithSink("mockSink", mockSink, tt.config)
+		s.Open(ctx, make(chan error))
+		s.input <- tt.data
+		time.Sleep(100 * time.Millisecond)
+		s.close(ctx, contextLogger)
+		results := mockSink.GetResults()
+		if !reflect.DeepEqual(tt.result, results) {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%s\n\ngot=%s\n\n", i, tt.result, results)
+		}
+	}
+}
+
+func TestValidateExactlyOnce(t *testing.T) {
+	var tests = []struct {
+		name   string
+		action map[string]interface{}
+		err    string
+	}{
+		{
+			name:   "sql",
+			action: map[string]interface{}{"url": "file:test?mode=memory", "table": "t1"},
+		}, {
+			name:   "sql",
+			action: map[string]interface{}{"url": "file:test?mode=memory", "table": "t1", "concurrency": 2},
+			err:    "sink sql writes in transactions for the exactly once qos, concurrency and runAsync are not supported",
+		}, {
+			name:   "sql",
+			action: map[string]interface{}{"url": "file:test?mode=memory", "table": "t1", "runAsync": true},
+			err:    "sink sql writes in transactions for the exactly once qos, concurrency and runAsync are not supported",
+		}, {
+			name:   "log",
+			action: map[string]interface{}{"concurrency": 2, "runAsync": true},
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		err := ValidateExactlyOnce(tt.name, tt.action)
+		if !reflect.DeepEqual(tt.err, common.Errstring(err)) {
+			t.Errorf("%d: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.err, err)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package nodes
 import (
 	"github.com/emqx/kuiper/common"
 	"github.com/emqx/kuiper/plugins"
+	"github.com/emqx/kuiper/plugins/portable"
+	"github.com/emqx/kuiper/secrets"
 	"github.com/emqx/kuiper/xsql"
 	"github.com/emqx/kuiper/xstream/api"
 	"github.com/emqx/kuiper/xstream/extensions"
@@ -82,6 +84,12 @@ func (m *SourceNode) Open(ctx api.StreamContext, errCh chan<- error) {
 		if m.options.RETAIN_SIZE > 0 && m.streamType == xsql.TypeTable {
 			props["$retainSize"] = m.options.RETAIN_SIZE
 		}
+		// The secret values are only passed to the source and are not kept in the node
+		cprops, err := secrets.Resolve(props)
+		if err != nil {
+			m.drainError(errCh, err, ctx, logger)
+			return
+		}
 		m.reset()
 		logger.Infof("open source node %d instances", m.concurrency)
 		for i := 0; i < m.concurrency; i++ { // workers
@@ -95,7 +103,7 @@ func (m *SourceNode) Open(ctx api.StreamContext, errCh chan<- error) {
 						m.drainError(errCh, err, ctx, logger)
 						return
 					}
-					err = source.Configure(m.options.DATASOURCE, props)
+					err = source.Configure(m.options.DATASOURCE, cprops)
 					if err != nil {
 						m.drainError(errCh, err, ctx, logger)
 						return
@@ -179,25 +187,33 @@ func (m *SourceNode) reset() {
 	m.statManagers = nil
 }
 
-func doGetSource(t string) (api.Source, error) {
-	var (
-		s   api.Source
-		err error
-	)
-	switch t {
-	case "mqtt":
-		s = &extensions.MQTTSource{}
-	case "httppull":
-		s = &extensions.HTTPPullSource{}
-	case "file":
-		s = &extensions.FileSource{}
-	default:
-		s, err = plugins.GetSource(t)
-		if err != nil {
-			return nil, err
+// The built-in sources by type
+var builtinSources = map[string]func() api.Source{
+	"mqtt":     func() api.Source { return &extensions.MQTTSource{} },
+	"httppull": func() api.Source { return &extensions.HTTPPullSource{} },
+	"file":     func() api.Source { return &extensions.FileSource{} },
+	"memory":   func() api.Source { return &extensions.MemorySource{} },
+	"sql":      func() api.Source { return &extensions.SQLSource{} },
+}
+
+func init() {
+	portable.SetSymbolChecker(func(t int, name string) bool {
+		var ok bool
+		switch t {
+		case portable.SOURCE:
+			_, ok = builtinSources[name]
+		case portable.SINK:
+			_, ok = builtinSinks[name]
 		}
+		return ok || plugins.HasNativeSymbol(plugins.PluginType(t), name)
+	})
+}
+
+func doGetSource(t string) (api.Source, error) {
+	if f, ok := builtinSources[t]; ok {
+		return f(), nil
 	}
-	return s, nil
+	return plugins.GetSource(t)
 }
 
 func (m *SourceNode) drainError(errCh chan<- error, err error, ctx api.StreamContext, logger api.Logger) {
@@ -0,0 +1,105 @@
+package nodes
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/xsql"
+	"github.com/emqx/kuiper/xstream/api"
+)
+
+/*
+ *  This node receives the result of a subquery and emits each row as a tuple, so that the outer statement can
+ *  consume the subquery like a stream named by the subquery alias.
+ *  The input must be the json encoded result array of a project, distinct or limit operator.
+ */
+type SubQueryNode struct {
+	*defaultSinkNode
+	statManager StatManager
+	emitter     string
+}
+
+func NewSubQueryNode(name string, emitter string, options *api.RuleOption) *SubQueryNode {
+	n := &SubQueryNode{
+		emitter: emitter,
+	}
+	n.defaultSinkNode = &defaultSinkNode{
+		input: make(chan interface{}, options.BufferLength),
+		defaultNode: &defaultNode{
+			outputs:   make(map[string]chan<- interface{}),
+			name:      name,
+			sendError: options.SendError,
+		},
+	}
+	return n
+}
+
+func (n *SubQueryNode) Exec(ctx api.StreamContext, errCh chan<- error) {
+	n.ctx = ctx
+	log := ctx.GetLogger()
+	log.Debugf("SubQueryNode %s is started", n.name)
+
+	if len(n.outputs) <= 0 {
+		go func() { errCh <- fmt.Errorf("no output channel found") }()
+		return
+	}
+	stats, err := NewStatManager("op", ctx)
+	if err != nil {
+		go func() { errCh <- err }()
+		return
+	}
+	n.statManager = stats
+	go func() {
+		for {
+			log.Debugf("SubQueryNode %s is looping", n.name)
+			select {
+			case item, opened := <-n.input:
+				processed := false
+				if item, processed = n.preprocess(item); processed {
+					break
+				}
+				n.statManager.IncTotalRecordsIn()
+				n.statManager.ProcessTimeStart()
+				if !opened {
+					n.statManager.IncTotalExceptions()
+					break
+				}
+				switch d := item.(type) {
+				case error:
+					n.Broadcast(d)
+					n.statManager.IncTotalExceptions()
+				case []byte:
+					var rows []map[string]interface{}
+					if err := json.Unmarshal(d, &rows); err != nil {
+						n.Broadcast(fmt.Errorf("run SubQueryNode error: invalid subquery result %s", d))
+						n.statManager.IncTotalExceptions()
+						break
+					}
+					ts := common.GetNowInMilli()
+					for _, row := range rows {
+						n.Broadcast(&xsql.Tuple{Emitter: n.emitter, Message: row, Timestamp: ts})
+					}
+					n.statManager.ProcessTimeEnd()
+					n.statManager.IncTotalRecordsOut()
+					n.statManager.SetBufferLength(int64(len(n.input)))
+				default:
+					n.Broadcast(fmt.Errorf("run SubQueryNode error: invalid input type but got %[1]T(%[1]v)", d))
+					n.statManager.IncTotalExceptions()
+				}
+			case <-ctx.Done():
+				log.Infoln("Cancelling subquery node....")
+				return
+			}
+		}
+	}()
+}
+
+func (n *SubQueryNode) GetMetrics() [][]interface{} {
+	if n.statManager != nil {
+		return [][]interface{}{
+			n.statManager.GetMetrics(),
+		}
+	} else {
+		return nil
+	}
+}
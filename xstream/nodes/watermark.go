@@ -7,6 +7,7 @@ import (
 	"github.com/emqx/kuiper/xstream/api"
 	"math"
 	"sort"
+	"sync/atomic"
 )
 
 type WatermarkTuple struct {
@@ -157,14 +158,8 @@ func (w *WatermarkGenerator) getNextWindow(inputs []*xsql.Tuple, current int64,
 	}
 }
 
-func (o *WindowOperator) execEventWindow(ctx api.StreamContext, inputs []*xsql.Tuple, errCh chan<- error) {
+func (o *WindowOperator) execEventWindow(ctx api.StreamContext, errCh chan<- error) {
 	log := ctx.GetLogger()
-	var (
-		triggered       bool
-		nextWindowEndTs int64
-		prevWindowEndTs int64
-	)
-
 	o.watermarkGenerator.lastWatermarkTs = 0
 	if s, err := ctx.GetState(WATERMARK_KEY); err == nil && s != nil {
 		if si, ok := s.(int64); ok {
@@ -174,6 +169,14 @@ func (o *WindowOperator) execEventWindow(ctx api.StreamContext, inputs []*xsql.T
 		}
 	}
 	log.Infof("Start with window state lastWatermarkTs: %d", o.watermarkGenerator.lastWatermarkTs)
+	atomic.StoreInt64(&o.lateEvents, 0)
+	if s, err := ctx.GetState(WINDOW_LATE_EVENTS_KEY); err == nil && s != nil {
+		if si, ok := s.(int64); ok {
+			atomic.StoreInt64(&o.lateEvents, si)
+		} else {
+			errCh <- fmt.Errorf("restore window state `lateEvents` %v error, invalid type", s)
+		}
+	}
 	for {
 		select {
 		// process incoming item
@@ -195,21 +198,25 @@ func (o *WindowOperator) execEventWindow(ctx api.StreamContext, inputs []*xsql.T
 			case xsql.Event:
 				if d.IsWatermark() {
 					watermarkTs := d.GetTimestamp()
-					windowEndTs := nextWindowEndTs
-					//Session window needs a recalculation of window because its window end depends the inputs
-					if windowEndTs == math.MaxInt64 || o.window.Type == xsql.SESSION_WINDOW || o.window.Type == xsql.SLIDING_WINDOW {
-						windowEndTs = o.watermarkGenerator.getNextWindow(inputs, prevWindowEndTs, watermarkTs, triggered)
-					}
-					for windowEndTs <= watermarkTs && windowEndTs >= 0 {
-						log.Debugf("Window end ts %d Watermark ts %d", windowEndTs, watermarkTs)
-						log.Debugf("Current input count %d", len(inputs))
-						//scan all events and find out the event in the current window
-						inputs, triggered = o.scan(inputs, windowEndTs, ctx)
-						prevWindowEndTs = windowEndTs
-						windowEndTs = o.watermarkGenerator.getNextWindow(inputs, windowEndTs, watermarkTs, triggered)
+					for _, key := range o.sortedKeys() {
+						ws := o.states[key]
+						windowEndTs := ws.NextWindowEndTs
+						//Session window needs a recalculation of window because its window end depends the inputs
+						if windowEndTs == math.MaxInt64 || o.window.Type == xsql.SESSION_WINDOW || o.window.Type == xsql.SLIDING_WINDOW {
+							windowEndTs = o.watermarkGenerator.getNextWindow(ws.Inputs, ws.PrevWindowEndTs, watermarkTs, ws.Triggered)
+						}
+						for windowEndTs <= watermarkTs && windowEndTs >= 0 {
+							log.Debugf("Window end ts %d Watermark ts %d", windowEndTs, watermarkTs)
+							log.Debugf("Current input count %d", len(ws.Inputs))
+							//scan all events and find out the event in the current window
+							ws.Inputs, ws.Triggered = o.scan(ws, windowEndTs, ctx)
+							ws.PrevWindowEndTs = windowEndTs
+							windowEndTs = o.watermarkGenerator.getNextWindow(ws.Inputs, windowEndTs, watermarkTs, ws.Triggered)
+						}
+						ws.NextWindowEndTs = windowEndTs
+						log.Debugf("next window end %d", ws.NextWindowEndTs)
+						o.purgeFired(ws, watermarkTs)
 					}
-					nextWindowEndTs = windowEndTs
-					log.Debugf("next window end %d", nextWindowEndTs)
 				} else {
 					o.statManager.IncTotalRecordsIn()
 					tuple, ok := d.(*xsql.Tuple)
@@ -218,11 +225,18 @@ func (o *WindowOperator) execEventWindow(ctx api.StreamContext, inputs []*xsql.T
 					}
 					log.Debugf("event window receive tuple %s", tuple.Message)
 					if o.watermarkGenerator.track(tuple.Emitter, d.GetTimestamp(), ctx) {
-						inputs = append(inputs, tuple)
+						if ws, err := o.getState(tuple); err != nil {
+							o.Broadcast(fmt.Errorf("run Window error: %s", err))
+							o.statManager.IncTotalExceptions()
+						} else {
+							ws.Inputs = append(ws.Inputs, tuple)
+						}
+					} else {
+						o.processLate(tuple, ctx)
 					}
 				}
 				o.statManager.ProcessTimeEnd()
-				ctx.PutState(WINDOW_INPUTS_KEY, inputs)
+				o.putState(ctx)
 			default:
 				o.statManager.IncTotalRecordsIn()
 				o.Broadcast(fmt.Errorf("run Window error: expect xsql.Event type but got %[1]T(%[1]v)", d))
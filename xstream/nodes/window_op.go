@@ -2,41 +2,103 @@ package nodes
 
 import (
 	"encoding/gob"
+	"encoding/json"
 	"fmt"
 	"github.com/benbjohnson/clock"
 	"github.com/emqx/kuiper/common"
 	"github.com/emqx/kuiper/xsql"
 	"github.com/emqx/kuiper/xstream/api"
+	"github.com/emqx/kuiper/xstream/checkpoints"
 	"math"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
 type WindowConfig struct {
-	Type     xsql.WindowType
-	Length   int
-	Interval int //If interval is not set, it is equals to Length
+	Type      xsql.WindowType
+	Length    int
+	Interval  int         //If interval is not set, it is equals to Length
+	Partition []xsql.Expr //If partition is set, each partition key has its own window state
+	// If aggregates are set, the window accumulates them for each group instead of keeping the tuples. Each emitted
+	// tuple is a group whose aggregate results are saved in the fields of the cache keys of the calls
+	Aggregates []*xsql.Call
+	Dimensions xsql.Dimensions
+}
+
+// WindowState is the state of one window partition. If the window is not partitioned, there is only one state with empty key
+type WindowState struct {
+	Inputs      []*xsql.Tuple
+	TriggerTime int64
+	MsgCount    int
+	// For event time only
+	NextWindowEndTs int64
+	PrevWindowEndTs int64
+	Triggered       bool
+	// For event time with allowed lateness only, the inputs of the fired windows which may re-fire for late events
+	Fired []*xsql.Tuple
+	// For processing time session window only, the time when the session times out
+	TimeoutTs int64
+	// For incremental aggregation only, the accumulated groups of the windows which have not fired, ordered by the end
+	Accumulations []*WindowAccumulation
+}
+
+// Whether the event time windows of the partition have progressed
+func (s *WindowState) hasProgress() bool {
+	return s.NextWindowEndTs != 0 || s.PrevWindowEndTs != 0 || s.Triggered
+}
+
+// WindowAccumulation is the accumulated groups of one window for incremental aggregation
+type WindowAccumulation struct {
+	End    int64
+	Groups []*AccumulatedGroup
+	// The index of the groups by the group key, rebuilt after restoring
+	index map[string]int
+}
+
+// AccumulatedGroup keeps the first tuple of the group to evaluate the non-aggregate fields and the running
+// accumulators of the aggregate functions
+type AccumulatedGroup struct {
+	Key   string
+	First *xsql.Tuple
+	Accs  []*xsql.Accumulator
 }
 
 type WindowOperator struct {
+	// For event time only, the count of the late events. It is read by the metrics api so it must be accessed
+	// atomically. Keep it the first field to be 64-bit aligned on the 32-bit platforms.
+	lateEvents int64
 	*defaultSinkNode
 	window             *WindowConfig
 	interval           int
 	isEventTime        bool
 	watermarkGenerator *WatermarkGenerator //For event time only
+	allowedLateness    int64               //For event time only
+	lateOutput         *defaultNode        //For event time only, the side output of the late events
 
 	statManager StatManager
 	ticker      *clock.Ticker //For processing time only
+	tickerStart int64         //For incremental aggregation only, the windows end at tickerStart + n * length
+	lastEnd     int64         //For incremental aggregation only, the end of the last emitted windows
+	fv          *xsql.FunctionValuer
 	// states
-	triggerTime int64
-	msgCount    int
+	states map[string]*WindowState
 }
 
 const WINDOW_INPUTS_KEY = "$$windowInputs"
 const TRIGGER_TIME_KEY = "$$triggerTime"
 const MSG_COUNT_KEY = "$$msgCount"
+const WINDOW_STATES_KEY = "$$windowStates"
+const WINDOW_FIRED_KEY = "$$windowFired"
+const WINDOW_ACCUMULATIONS_KEY = "$$windowAccumulations"
+const WINDOW_TIMEOUT_KEY = "$$windowTimeout"
+const WINDOW_LATE_EVENTS_KEY = "$$windowLateEvents"
 
 func init() {
 	gob.Register([]*xsql.Tuple{})
+	gob.Register([]*WindowAccumulation{})
+	gob.Register(map[string]*WindowState{})
 }
 
 func NewWindowOp(name string, w WindowConfig, streams []string, options *api.RuleOption) (*WindowOperator, error) {
@@ -51,6 +113,12 @@ func NewWindowOp(name string, w WindowConfig, streams []string, options *api.Rul
 		},
 	}
 	o.isEventTime = options.IsEventTime
+	o.allowedLateness = options.AllowedLateness
+	o.lateOutput = &defaultNode{
+		outputs:   make(map[string]chan<- interface{}),
+		name:      name,
+		sendError: options.SendError,
+	}
 	o.window = &w
 	if o.window.Interval == 0 && o.window.Type == xsql.COUNT_WINDOW {
 		//if no interval value is set and it's count window, then set interval to length value.
@@ -72,6 +140,7 @@ func NewWindowOp(name string, w WindowConfig, streams []string, options *api.Rul
 // output: xsql.WindowTuplesSet
 func (o *WindowOperator) Exec(ctx api.StreamContext, errCh chan<- error) {
 	o.ctx = ctx
+	o.lateOutput.ctx = ctx
 	log := ctx.GetLogger()
 	log.Debugf("Window operator %s is started", o.name)
 
@@ -85,45 +154,161 @@ func (o *WindowOperator) Exec(ctx api.StreamContext, errCh chan<- error) {
 		return
 	}
 	o.statManager = stats
-	var inputs []*xsql.Tuple
-	if s, err := ctx.GetState(WINDOW_INPUTS_KEY); err == nil {
-		switch st := s.(type) {
-		case []*xsql.Tuple:
-			inputs = st
-			log.Infof("Restore window state %+v", inputs)
-		case nil:
-			log.Debugf("Restore window state, nothing")
-		default:
-			errCh <- fmt.Errorf("restore window state `inputs` %v error, invalid type", st)
+	o.states = make(map[string]*WindowState)
+	if len(o.window.Partition) > 0 {
+		if s, err := ctx.GetState(WINDOW_STATES_KEY); err == nil {
+			switch st := s.(type) {
+			case map[string]*WindowState:
+				o.states = st
+				log.Infof("Restore window state %+v", st)
+			case nil:
+				log.Debugf("Restore window state, nothing")
+			default:
+				errCh <- fmt.Errorf("restore window state `states` %v error, invalid type", st)
+			}
+		} else {
+			log.Warnf("Restore window state fails: %s", err)
 		}
 	} else {
-		log.Warnf("Restore window state fails: %s", err)
-	}
-	o.triggerTime = 0
-	if s, err := ctx.GetState(TRIGGER_TIME_KEY); err == nil && s != nil {
-		if si, ok := s.(int64); ok {
-			o.triggerTime = si
+		ws := &WindowState{}
+		if o.isIncremental() {
+			if s, err := ctx.GetState(WINDOW_ACCUMULATIONS_KEY); err == nil && s != nil {
+				if st, ok := s.([]*WindowAccumulation); ok {
+					ws.Accumulations = st
+					log.Infof("Restore window accumulations %+v", st)
+				} else {
+					errCh <- fmt.Errorf("restore window state `accumulations` %v error, invalid type", s)
+				}
+			}
+		} else if s, err := ctx.GetState(WINDOW_INPUTS_KEY); err == nil {
+			switch st := s.(type) {
+			case []*xsql.Tuple:
+				ws.Inputs = st
+				log.Infof("Restore window state %+v", st)
+			case nil:
+				log.Debugf("Restore window state, nothing")
+			default:
+				errCh <- fmt.Errorf("restore window state `inputs` %v error, invalid type", st)
+			}
 		} else {
-			errCh <- fmt.Errorf("restore window state `triggerTime` %v error, invalid type", s)
+			log.Warnf("Restore window state fails: %s", err)
+		}
+		if s, err := ctx.GetState(TRIGGER_TIME_KEY); err == nil && s != nil {
+			if si, ok := s.(int64); ok {
+				ws.TriggerTime = si
+			} else {
+				errCh <- fmt.Errorf("restore window state `triggerTime` %v error, invalid type", s)
+			}
+		}
+		if s, err := ctx.GetState(MSG_COUNT_KEY); err == nil && s != nil {
+			if si, ok := s.(int); ok {
+				ws.MsgCount = si
+			} else {
+				errCh <- fmt.Errorf("restore window state `msgCount` %v error, invalid type", s)
+			}
 		}
+		if s, err := ctx.GetState(WINDOW_FIRED_KEY); err == nil && s != nil {
+			if st, ok := s.([]*xsql.Tuple); ok {
+				ws.Fired = st
+			} else {
+				errCh <- fmt.Errorf("restore window state `fired` %v error, invalid type", s)
+			}
+		}
+		if s, err := ctx.GetState(WINDOW_TIMEOUT_KEY); err == nil && s != nil {
+			if si, ok := s.(int64); ok {
+				ws.TimeoutTs = si
+			} else {
+				errCh <- fmt.Errorf("restore window state `timeout` %v error, invalid type", s)
+			}
+		}
+		log.Infof("Start with window state triggerTime: %d, msgCount: %d", ws.TriggerTime, ws.MsgCount)
+		o.states[""] = ws
 	}
-	o.msgCount = 0
-	if s, err := ctx.GetState(MSG_COUNT_KEY); err == nil && s != nil {
-		if si, ok := s.(int); ok {
-			o.msgCount = si
-		} else {
-			errCh <- fmt.Errorf("restore window state `msgCount` %v error, invalid type", s)
+	o.fv, _ = xsql.NewFunctionValuersForOp(ctx, xsql.FuncRegisters)
+	if o.isEventTime {
+		go o.execEventWindow(ctx, errCh)
+	} else {
+		go o.execProcessingWindow(ctx, errCh)
+	}
+}
+
+// Get the state of the partition which the tuple belongs to. Create a new state if not found
+func (o *WindowOperator) getState(tuple *xsql.Tuple) (*WindowState, error) {
+	var key string
+	if len(o.window.Partition) > 0 {
+		ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(tuple, o.fv)}
+		values := make([]string, len(o.window.Partition))
+		for i, p := range o.window.Partition {
+			v := ve.Eval(p)
+			if err, ok := v.(error); ok {
+				return nil, fmt.Errorf("evaluate partition key %s error: %v", p, err)
+			}
+			values[i] = fmt.Sprintf("%v", v)
 		}
+		key = strings.Join(values, ",")
+	}
+	s, ok := o.states[key]
+	if !ok {
+		s = &WindowState{}
+		o.states[key] = s
+	}
+	return s, nil
+}
+
+// Return the partition keys in order so that the partitions are triggered in a constant order
+func (o *WindowOperator) sortedKeys() []string {
+	keys := make([]string, 0, len(o.states))
+	for k := range o.states {
+		keys = append(keys, k)
 	}
-	log.Infof("Start with window state triggerTime: %d, msgCount: %d", o.triggerTime, o.msgCount)
+	sort.Strings(keys)
+	return keys
+}
+
+// Save the states. For the window without partition, keep saving in the separate keys
+func (o *WindowOperator) putState(ctx api.StreamContext) {
 	if o.isEventTime {
-		go o.execEventWindow(ctx, inputs, errCh)
+		ctx.PutState(WINDOW_LATE_EVENTS_KEY, atomic.LoadInt64(&o.lateEvents))
+	}
+	if len(o.window.Partition) > 0 {
+		// Remove the empty partitions to release the memory. The idle partitions of event time window keep the window
+		// progress, otherwise their windows are calculated from the beginning again
+		for k, s := range o.states {
+			if len(s.Inputs) == 0 && s.MsgCount == 0 && len(s.Fired) == 0 && len(s.Accumulations) == 0 && !s.hasProgress() {
+				delete(o.states, k)
+			}
+		}
+		ctx.PutState(WINDOW_STATES_KEY, o.states)
+		return
+	}
+	s := o.states[""]
+	if o.isIncremental() {
+		ctx.PutState(WINDOW_ACCUMULATIONS_KEY, s.Accumulations)
 	} else {
-		go o.execProcessingWindow(ctx, inputs, errCh)
+		ctx.PutState(WINDOW_INPUTS_KEY, s.Inputs)
+	}
+	ctx.PutState(TRIGGER_TIME_KEY, s.TriggerTime)
+	ctx.PutState(MSG_COUNT_KEY, s.MsgCount)
+	if o.allowedLateness > 0 {
+		ctx.PutState(WINDOW_FIRED_KEY, s.Fired)
+	}
+	if o.window.Type == xsql.SESSION_WINDOW && !o.isEventTime {
+		ctx.PutState(WINDOW_TIMEOUT_KEY, s.TimeoutTs)
 	}
 }
 
-func (o *WindowOperator) execProcessingWindow(ctx api.StreamContext, inputs []*xsql.Tuple, errCh chan<- error) {
+// Get the earliest timeout of all the session window partitions
+func (o *WindowOperator) nextTimeout() int64 {
+	var r int64
+	for _, s := range o.states {
+		if s.TimeoutTs > 0 && (r == 0 || s.TimeoutTs < r) {
+			r = s.TimeoutTs
+		}
+	}
+	return r
+}
+
+func (o *WindowOperator) execProcessingWindow(ctx api.StreamContext, errCh chan<- error) {
 	log := ctx.GetLogger()
 	var (
 		c             <-chan time.Time
@@ -134,6 +319,7 @@ func (o *WindowOperator) execProcessingWindow(ctx api.StreamContext, inputs []*x
 	case xsql.NOT_WINDOW:
 	case xsql.TUMBLING_WINDOW:
 		o.ticker = common.GetTicker(o.window.Length)
+		o.tickerStart = common.GetNowInMilli()
 		o.interval = o.window.Length
 	case xsql.HOPPING_WINDOW:
 		o.ticker = common.GetTicker(o.window.Interval)
@@ -143,6 +329,15 @@ func (o *WindowOperator) execProcessingWindow(ctx api.StreamContext, inputs []*x
 	case xsql.SESSION_WINDOW:
 		o.ticker = common.GetTicker(o.window.Length)
 		o.interval = o.window.Interval
+		// Wait for the timeout of the restored sessions
+		if next := o.nextTimeout(); next > 0 {
+			d := next - common.GetNowInMilli()
+			if d < 0 {
+				d = 0
+			}
+			timeoutTicker = common.GetTimer(int(d))
+			timeout = timeoutTicker.C
+		}
 	case xsql.COUNT_WINDOW:
 		o.interval = o.window.Interval
 	}
@@ -150,59 +345,10 @@ func (o *WindowOperator) execProcessingWindow(ctx api.StreamContext, inputs []*x
 	if o.ticker != nil {
 		c = o.ticker.C
 		//resume previous window
-		if len(inputs) > 0 && o.triggerTime > 0 {
-			nextTick := common.GetNowInMilli() + int64(o.interval)
-			next := o.triggerTime
-			switch o.window.Type {
-			case xsql.TUMBLING_WINDOW, xsql.HOPPING_WINDOW:
-				for {
-					next = next + int64(o.interval)
-					if next > nextTick {
-						break
-					}
-					log.Debugf("triggered by restore inputs")
-					inputs, _ = o.scan(inputs, next, ctx)
-					ctx.PutState(WINDOW_INPUTS_KEY, inputs)
-					ctx.PutState(TRIGGER_TIME_KEY, o.triggerTime)
-				}
-			case xsql.SESSION_WINDOW:
-				timeout, duration := int64(o.window.Interval), int64(o.window.Length)
-				for {
-					et := inputs[0].Timestamp
-					tick := et + (duration - et%duration)
-					if et%duration == 0 {
-						tick = et
-					}
-					var p int64
-					for _, tuple := range inputs {
-						var r int64 = math.MaxInt64
-						if p > 0 {
-							if tuple.Timestamp-p > timeout {
-								r = p + timeout
-							}
-						}
-						if tuple.Timestamp > tick {
-							if tick-duration > et && tick < r {
-								r = tick
-							}
-							tick += duration
-						}
-						if r < math.MaxInt64 {
-							next = r
-							break
-						}
-						p = tuple.Timestamp
-					}
-					if next > nextTick {
-						break
-					}
-					log.Debugf("triggered by restore inputs")
-					inputs, _ = o.scan(inputs, next, ctx)
-					ctx.PutState(WINDOW_INPUTS_KEY, inputs)
-					ctx.PutState(TRIGGER_TIME_KEY, o.triggerTime)
-				}
-			}
+		for _, key := range o.sortedKeys() {
+			o.resume(o.states[key], ctx)
 		}
+		o.putState(ctx)
 	}
 
 	for {
@@ -225,30 +371,46 @@ func (o *WindowOperator) execProcessingWindow(ctx api.StreamContext, inputs []*x
 				o.statManager.IncTotalExceptions()
 			case *xsql.Tuple:
 				log.Debugf("Event window receive tuple %s", d.Message)
-				inputs = append(inputs, d)
+				ws, err := o.getState(d)
+				if err != nil {
+					o.Broadcast(fmt.Errorf("run Window error: %s", err))
+					o.statManager.IncTotalExceptions()
+					break
+				}
+				if o.isIncremental() {
+					if err := o.accumulate(ws, d); err != nil {
+						o.Broadcast(fmt.Errorf("run Window error: %s", err))
+						o.statManager.IncTotalExceptions()
+						break
+					}
+				} else {
+					ws.Inputs = append(ws.Inputs, d)
+				}
 				switch o.window.Type {
 				case xsql.NOT_WINDOW:
-					inputs, _ = o.scan(inputs, d.Timestamp, ctx)
+					ws.Inputs, _ = o.scan(ws, d.Timestamp, ctx)
 				case xsql.SLIDING_WINDOW:
-					inputs, _ = o.scan(inputs, d.Timestamp, ctx)
+					ws.Inputs, _ = o.scan(ws, d.Timestamp, ctx)
 				case xsql.SESSION_WINDOW:
+					now := common.GetNowInMilli()
+					ws.TimeoutTs = now + int64(o.window.Interval)
 					if timeoutTicker != nil {
 						timeoutTicker.Stop()
-						timeoutTicker.Reset(time.Duration(o.window.Interval) * time.Millisecond)
+						timeoutTicker.Reset(time.Duration(o.nextTimeout()-now) * time.Millisecond)
 					} else {
 						timeoutTicker = common.GetTimer(o.window.Interval)
 						timeout = timeoutTicker.C
 					}
 				case xsql.COUNT_WINDOW:
-					o.msgCount++
-					log.Debugf(fmt.Sprintf("msgCount: %d", o.msgCount))
-					if o.msgCount%o.window.Interval != 0 {
+					ws.MsgCount++
+					log.Debugf(fmt.Sprintf("msgCount: %d", ws.MsgCount))
+					if ws.MsgCount%o.window.Interval != 0 {
 						continue
 					} else {
-						o.msgCount = 0
+						ws.MsgCount = 0
 					}
 
-					if tl, er := NewTupleList(inputs, o.window.Length); er != nil {
+					if tl, er := NewTupleList(ws.Inputs, o.window.Length); er != nil {
 						log.Error(fmt.Sprintf("Found error when trying to "))
 						errCh <- er
 					} else {
@@ -260,49 +422,40 @@ func (o *WindowOperator) execProcessingWindow(ctx api.StreamContext, inputs []*x
 							o.Broadcast(tsets)
 							o.statManager.IncTotalRecordsOut()
 						}
-						inputs = tl.getRestTuples()
+						ws.Inputs = tl.getRestTuples()
 					}
 				}
 				o.statManager.ProcessTimeEnd()
 				o.statManager.SetBufferLength(int64(len(o.input)))
-				ctx.PutState(WINDOW_INPUTS_KEY, inputs)
-				ctx.PutState(MSG_COUNT_KEY, o.msgCount)
+				o.putState(ctx)
 			default:
 				o.Broadcast(fmt.Errorf("run Window error: expect xsql.Tuple type but got %[1]T(%[1]v)", d))
 				o.statManager.IncTotalExceptions()
 			}
 		case now := <-c:
+			o.tick(common.TimeToUnixMilli(now), ctx)
+		case now := <-timeout:
 			n := common.TimeToUnixMilli(now)
-			if o.window.Type == xsql.SESSION_WINDOW {
-				lastTriggerTime := o.triggerTime
-				o.triggerTime = n
-				log.Debugf("session window update trigger time %d with %d inputs", n, len(inputs))
-				if len(inputs) == 0 || lastTriggerTime < inputs[0].Timestamp {
-					if len(inputs) > 0 {
-						log.Debugf("session window last trigger time %d < first tuple %d", lastTriggerTime, inputs[0].Timestamp)
-					}
-					break
+			for _, key := range o.sortedKeys() {
+				ws := o.states[key]
+				if ws.TimeoutTs <= 0 || ws.TimeoutTs > n {
+					continue
+				}
+				ws.TimeoutTs = 0
+				if len(ws.Inputs) > 0 {
+					o.statManager.ProcessTimeStart()
+					log.Debugf("triggered by timeout")
+					ws.Inputs, _ = o.scan(ws, n, ctx)
+					//expire all inputs, so that when timer scan there is no item
+					ws.Inputs = make([]*xsql.Tuple, 0)
+					o.statManager.ProcessTimeEnd()
 				}
 			}
-			if len(inputs) > 0 {
-				o.statManager.ProcessTimeStart()
-				log.Debugf("triggered by ticker at %d", n)
-				inputs, _ = o.scan(inputs, n, ctx)
-				o.statManager.ProcessTimeEnd()
-				ctx.PutState(WINDOW_INPUTS_KEY, inputs)
-				ctx.PutState(TRIGGER_TIME_KEY, o.triggerTime)
-			}
-		case now := <-timeout:
-			if len(inputs) > 0 {
-				o.statManager.ProcessTimeStart()
-				log.Debugf("triggered by timeout")
-				inputs, _ = o.scan(inputs, common.TimeToUnixMilli(now), ctx)
-				//expire all inputs, so that when timer scan there is no item
-				inputs = make([]*xsql.Tuple, 0)
-				o.statManager.ProcessTimeEnd()
-				ctx.PutState(WINDOW_INPUTS_KEY, inputs)
-				ctx.PutState(TRIGGER_TIME_KEY, o.triggerTime)
+			// Wait for the timeout of other partitions
+			if next := o.nextTimeout(); next > 0 {
+				timeoutTicker.Reset(time.Duration(next-n) * time.Millisecond)
 			}
+			o.putState(ctx)
 		// is cancelling
 		case <-ctx.Done():
 			log.Infoln("Cancelling window....")
@@ -314,6 +467,194 @@ func (o *WindowOperator) execProcessingWindow(ctx api.StreamContext, inputs []*x
 	}
 }
 
+// Trigger the windows of all partitions by the ticker
+func (o *WindowOperator) tick(n int64, ctx api.StreamContext) {
+	log := ctx.GetLogger()
+	var end int64
+	if o.isIncremental() {
+		end = o.tickEnd(n)
+	}
+	for _, key := range o.sortedKeys() {
+		ws := o.states[key]
+		if o.window.Type == xsql.SESSION_WINDOW {
+			lastTriggerTime := ws.TriggerTime
+			ws.TriggerTime = n
+			log.Debugf("session window update trigger time %d with %d inputs", n, len(ws.Inputs))
+			if len(ws.Inputs) == 0 || lastTriggerTime < ws.Inputs[0].Timestamp {
+				if len(ws.Inputs) > 0 {
+					log.Debugf("session window last trigger time %d < first tuple %d", lastTriggerTime, ws.Inputs[0].Timestamp)
+				}
+				continue
+			}
+		}
+		if len(ws.Inputs) > 0 {
+			o.statManager.ProcessTimeStart()
+			log.Debugf("triggered by ticker at %d", n)
+			ws.Inputs, _ = o.scan(ws, n, ctx)
+			o.statManager.ProcessTimeEnd()
+		}
+		if len(ws.Accumulations) > 0 {
+			o.statManager.ProcessTimeStart()
+			o.emitAccumulations(ws, end, ctx)
+			o.statManager.ProcessTimeEnd()
+		}
+	}
+	o.lastEnd = end
+	o.putState(ctx)
+}
+
+// Trigger the windows which should have been triggered during the restart
+func (o *WindowOperator) resume(ws *WindowState, ctx api.StreamContext) {
+	log := ctx.GetLogger()
+	if len(ws.Inputs) > 0 && ws.TriggerTime > 0 {
+		nextTick := common.GetNowInMilli() + int64(o.interval)
+		next := ws.TriggerTime
+		switch o.window.Type {
+		case xsql.TUMBLING_WINDOW, xsql.HOPPING_WINDOW:
+			for {
+				next = next + int64(o.interval)
+				if next > nextTick {
+					break
+				}
+				log.Debugf("triggered by restore inputs")
+				ws.Inputs, _ = o.scan(ws, next, ctx)
+			}
+		case xsql.SESSION_WINDOW:
+			timeout, duration := int64(o.window.Interval), int64(o.window.Length)
+			for len(ws.Inputs) > 0 {
+				et := ws.Inputs[0].Timestamp
+				tick := et + (duration - et%duration)
+				if et%duration == 0 {
+					tick = et
+				}
+				var p int64
+				for _, tuple := range ws.Inputs {
+					var r int64 = math.MaxInt64
+					if p > 0 {
+						if tuple.Timestamp-p > timeout {
+							r = p + timeout
+						}
+					}
+					if tuple.Timestamp > tick {
+						if tick-duration > et && tick < r {
+							r = tick
+						}
+						tick += duration
+					}
+					if r < math.MaxInt64 {
+						next = r
+						break
+					}
+					p = tuple.Timestamp
+				}
+				if next > nextTick {
+					break
+				}
+				log.Debugf("triggered by restore inputs")
+				ws.Inputs, _ = o.scan(ws, next, ctx)
+			}
+		}
+	}
+}
+
+func (o *WindowOperator) isIncremental() bool {
+	return len(o.window.Aggregates) > 0
+}
+
+// tickEnd returns the end of the windows triggered by the tick. The tickerStart is read after the ticker is created
+// and the ticks may be delayed, so the end is the nearest one to the tick time instead of the last one before it.
+func (o *WindowOperator) tickEnd(n int64) int64 {
+	length := int64(o.window.Length)
+	k := (n - o.tickerStart + length/2) / length
+	if k < 1 {
+		k = 1
+	}
+	return o.tickerStart + k*length
+}
+
+// Accumulate the tuple into its group of the window which ends at the first tick not earlier than the tuple timestamp.
+// Like the scan, the tuple arrives after a tick belongs to the next window even if its timestamp is not later.
+func (o *WindowOperator) accumulate(ws *WindowState, tuple *xsql.Tuple) error {
+	length := int64(o.window.Length)
+	end := o.tickerStart + length
+	if ts := tuple.Timestamp; ts > end {
+		end = o.tickerStart + (ts-o.tickerStart+length-1)/length*length
+	}
+	if end <= o.lastEnd {
+		end = o.lastEnd + length
+	}
+	var key string
+	ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(tuple, o.fv)}
+	for _, d := range o.window.Dimensions {
+		r := ve.Eval(d.Expr)
+		if err, ok := r.(error); ok {
+			return fmt.Errorf("evaluate dimension %s error: %v", d.Expr, err)
+		}
+		key += fmt.Sprintf("%v,", r)
+	}
+	// Find the window or insert it by the end order. The tuple usually belongs to the last window
+	i := len(ws.Accumulations)
+	for i > 0 && ws.Accumulations[i-1].End > end {
+		i--
+	}
+	var wa *WindowAccumulation
+	if i > 0 && ws.Accumulations[i-1].End == end {
+		wa = ws.Accumulations[i-1]
+	} else {
+		wa = &WindowAccumulation{End: end}
+		ws.Accumulations = append(ws.Accumulations, nil)
+		copy(ws.Accumulations[i+1:], ws.Accumulations[i:])
+		ws.Accumulations[i] = wa
+	}
+	if wa.index == nil {
+		wa.index = make(map[string]int, len(wa.Groups))
+		for j, g := range wa.Groups {
+			wa.index[g.Key] = j
+		}
+	}
+	var g *AccumulatedGroup
+	if j, ok := wa.index[key]; ok {
+		g = wa.Groups[j]
+	} else {
+		g = &AccumulatedGroup{Key: key, First: tuple, Accs: make([]*xsql.Accumulator, len(o.window.Aggregates))}
+		for j, c := range o.window.Aggregates {
+			g.Accs[j] = xsql.NewAccumulator(c.Name)
+		}
+		wa.index[key] = len(wa.Groups)
+		wa.Groups = append(wa.Groups, g)
+	}
+	for j, c := range o.window.Aggregates {
+		g.Accs[j].Add(tuple.AggregateEval(c.Args[0], o.fv)[0])
+	}
+	return nil
+}
+
+// Emit the accumulated windows which end no later than the end. Each group is emitted as a copy of its first tuple
+// with the aggregate results
+func (o *WindowOperator) emitAccumulations(ws *WindowState, end int64, ctx api.StreamContext) {
+	log := ctx.GetLogger()
+	i := 0
+	for ; i < len(ws.Accumulations) && ws.Accumulations[i].End <= end; i++ {
+		wa := ws.Accumulations[i]
+		var results xsql.WindowTuplesSet = make([]xsql.WindowTuples, 0)
+		for _, g := range wa.Groups {
+			message := make(xsql.Message, len(g.First.Message)+len(g.Accs))
+			for k, v := range g.First.Message {
+				message[k] = v
+			}
+			for j, acc := range g.Accs {
+				message[o.window.Aggregates[j].CacheKey] = acc.Result()
+			}
+			results = results.AddTuple(&xsql.Tuple{Emitter: g.First.Emitter, Message: message, Timestamp: g.First.Timestamp, Metadata: g.First.Metadata})
+		}
+		log.Debugf("window %s ends at %d for %d accumulated groups", o.name, wa.End, len(wa.Groups))
+		//blocking if one of the channel is full
+		o.Broadcast(results)
+		o.statManager.IncTotalRecordsOut()
+	}
+	ws.Accumulations = ws.Accumulations[i:]
+}
+
 type TupleList struct {
 	tuples []*xsql.Tuple
 	index  int //Current index
@@ -363,23 +704,29 @@ func (tl *TupleList) getRestTuples() []*xsql.Tuple {
 	return tl.tuples[len(tl.tuples)-tl.size+1:]
 }
 
-func (o *WindowOperator) scan(inputs []*xsql.Tuple, triggerTime int64, ctx api.StreamContext) ([]*xsql.Tuple, bool) {
+func (o *WindowOperator) scan(ws *WindowState, triggerTime int64, ctx api.StreamContext) ([]*xsql.Tuple, bool) {
 	log := ctx.GetLogger()
 	log.Debugf("window %s triggered at %s(%d)", o.name, time.Unix(triggerTime/1000, triggerTime%1000), triggerTime)
+	inputs := ws.Inputs
 	var delta int64
 	if o.window.Type == xsql.HOPPING_WINDOW || o.window.Type == xsql.SLIDING_WINDOW {
-		delta = o.calDelta(triggerTime, delta, log)
+		delta = o.calDelta(ws, triggerTime, delta, log)
 	}
 	var results xsql.WindowTuplesSet = make([]xsql.WindowTuples, 0)
 	i := 0
+	//Keep the removed inputs if the window may re-fire for the late events
+	retain := o.canRefire()
 	//Sync table
 	for _, tuple := range inputs {
 		if o.window.Type == xsql.HOPPING_WINDOW || o.window.Type == xsql.SLIDING_WINDOW {
-			diff := o.triggerTime - tuple.Timestamp
+			diff := ws.TriggerTime - tuple.Timestamp
 			if diff > int64(o.window.Length)+delta {
 				log.Debugf("diff: %d, length: %d, delta: %d", diff, o.window.Length, delta)
 				log.Debugf("tuple %s emitted at %d expired", tuple, tuple.Timestamp)
 				//Expired tuple, remove it by not adding back to inputs
+				if retain {
+					ws.Fired = append(ws.Fired, tuple)
+				}
 				continue
 			}
 			//Added back all inputs for non expired events
@@ -389,6 +736,8 @@ func (o *WindowOperator) scan(inputs []*xsql.Tuple, triggerTime int64, ctx api.S
 			//Only added back early arrived events
 			inputs[i] = tuple
 			i++
+		} else if retain {
+			ws.Fired = append(ws.Fired, tuple)
 		}
 		if tuple.Timestamp <= triggerTime {
 			results = results.AddTuple(tuple)
@@ -411,16 +760,16 @@ func (o *WindowOperator) scan(inputs []*xsql.Tuple, triggerTime int64, ctx api.S
 	return inputs[:i], triggered
 }
 
-func (o *WindowOperator) calDelta(triggerTime int64, delta int64, log api.Logger) int64 {
-	lastTriggerTime := o.triggerTime
-	o.triggerTime = triggerTime
+func (o *WindowOperator) calDelta(ws *WindowState, triggerTime int64, delta int64, log api.Logger) int64 {
+	lastTriggerTime := ws.TriggerTime
+	ws.TriggerTime = triggerTime
 	if lastTriggerTime <= 0 {
 		delta = math.MaxInt16 //max int, all events for the initial window
 	} else {
 		if !o.isEventTime && o.window.Interval > 0 {
-			delta = o.triggerTime - lastTriggerTime - int64(o.window.Interval)
+			delta = ws.TriggerTime - lastTriggerTime - int64(o.window.Interval)
 			if delta > 100 {
-				log.Warnf("Possible long computation in window; Previous eviction time: %d, current eviction time: %d", lastTriggerTime, o.triggerTime)
+				log.Warnf("Possible long computation in window; Previous eviction time: %d, current eviction time: %d", lastTriggerTime, ws.TriggerTime)
 			}
 		} else {
 			delta = 0
@@ -431,10 +780,132 @@ func (o *WindowOperator) calDelta(triggerTime int64, delta int64, log api.Logger
 
 func (o *WindowOperator) GetMetrics() [][]interface{} {
 	if o.statManager != nil {
+		metrics := o.statManager.GetMetrics()
+		if o.isEventTime {
+			metrics = append(metrics, atomic.LoadInt64(&o.lateEvents))
+		}
 		return [][]interface{}{
-			o.statManager.GetMetrics(),
+			metrics,
 		}
 	} else {
 		return nil
 	}
 }
+
+// GetLateOutput returns the side output emitter of the late events which arrive after the watermark and are not
+// accepted by any window. The late events are sent as the json array of the event message.
+func (o *WindowOperator) GetLateOutput() api.Emitter {
+	return o.lateOutput
+}
+
+func (o *WindowOperator) SetQos(qos api.Qos) {
+	o.defaultNode.SetQos(qos)
+	o.lateOutput.SetQos(qos)
+}
+
+// Broadcast the checkpoint barriers to the side output too so that its sinks can take part in the checkpoint
+func (o *WindowOperator) Broadcast(val interface{}) error {
+	if _, ok := val.(*checkpoints.Barrier); ok && len(o.lateOutput.outputs) > 0 {
+		o.lateOutput.Broadcast(val)
+	}
+	return o.defaultNode.Broadcast(val)
+}
+
+// Only tumbling and hopping windows can re-fire, because the windows of other types depend on the inputs
+func (o *WindowOperator) canRefire() bool {
+	return o.isEventTime && o.allowedLateness > 0 && (o.window.Type == xsql.TUMBLING_WINDOW || o.window.Type == xsql.HOPPING_WINDOW)
+}
+
+// Process the tuple which arrives after the watermark. If any window of the tuple has not fired or is still within
+// the allowed lateness, add the tuple to the window and re-fire the fired windows with the updated inputs. Otherwise,
+// send it to the late side output.
+func (o *WindowOperator) processLate(tuple *xsql.Tuple, ctx api.StreamContext) {
+	log := ctx.GetLogger()
+	atomic.AddInt64(&o.lateEvents, 1)
+	if o.canRefire() {
+		ws, err := o.getState(tuple)
+		if err != nil {
+			o.Broadcast(fmt.Errorf("run Window error: %s", err))
+			o.statManager.IncTotalExceptions()
+			return
+		}
+		if o.refire(ws, tuple, ctx) {
+			return
+		}
+	}
+	log.Debugf("window %s receive late tuple %s at %d", o.name, tuple.Message, tuple.Timestamp)
+	if len(o.lateOutput.outputs) > 0 {
+		if r, err := json.Marshal([]map[string]interface{}{tuple.Message}); err != nil {
+			o.Broadcast(fmt.Errorf("run Window error: encode late tuple error %s", err))
+			o.statManager.IncTotalExceptions()
+		} else {
+			o.lateOutput.Broadcast(r)
+		}
+	}
+}
+
+// Re-fire the fired windows which contain the tuple. Return false if all the windows are beyond the allowed lateness
+func (o *WindowOperator) refire(ws *WindowState, tuple *xsql.Tuple, ctx api.StreamContext) bool {
+	watermark := o.watermarkGenerator.lastWatermarkTs
+	length, interval := int64(o.window.Length), int64(o.window.Length)
+	if o.window.Type == xsql.HOPPING_WINDOW {
+		interval = int64(o.window.Interval)
+	}
+	//Like the scan, the tumbling window is (end-length, end] and the hopping window is [end-length, end]
+	inWindow := func(ts, end int64) bool {
+		if o.window.Type == xsql.HOPPING_WINDOW {
+			return ts >= end-length && ts <= end
+		}
+		return ts > end-length && ts <= end
+	}
+	end := tuple.Timestamp
+	if end%interval != 0 {
+		end += interval - end%interval
+	}
+	var accepted, pending bool
+	for ; inWindow(tuple.Timestamp, end); end += interval {
+		if end > watermark {
+			pending = true
+			break
+		}
+		if end+o.allowedLateness < watermark {
+			continue
+		}
+		accepted = true
+		var results xsql.WindowTuplesSet = make([]xsql.WindowTuples, 0)
+		for _, tuples := range [][]*xsql.Tuple{ws.Fired, ws.Inputs, {tuple}} {
+			for _, t := range tuples {
+				if inWindow(t.Timestamp, end) {
+					results = results.AddTuple(t)
+				}
+			}
+		}
+		results.Sort()
+		ctx.GetLogger().Debugf("window %s re-fired at %d for late tuple at %d", o.name, end, tuple.Timestamp)
+		o.Broadcast(results)
+		o.statManager.IncTotalRecordsOut()
+	}
+	if pending {
+		ws.Inputs = append(ws.Inputs, tuple)
+		return true
+	}
+	if accepted {
+		ws.Fired = append(ws.Fired, tuple)
+	}
+	return accepted
+}
+
+// Remove the fired inputs whose windows are all beyond the allowed lateness
+func (o *WindowOperator) purgeFired(ws *WindowState, watermark int64) {
+	if len(ws.Fired) == 0 {
+		return
+	}
+	i := 0
+	for _, t := range ws.Fired {
+		if t.Timestamp+int64(o.window.Length)+o.allowedLateness >= watermark {
+			ws.Fired[i] = t
+			i++
+		}
+	}
+	ws.Fired = ws.Fired[:i]
+}
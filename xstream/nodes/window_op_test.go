@@ -1,8 +1,17 @@
 package nodes
 
 import (
+	"bytes"
+	"encoding/gob"
 	"fmt"
+	"github.com/emqx/kuiper/common"
 	"github.com/emqx/kuiper/xsql"
+	"github.com/emqx/kuiper/xstream/api"
+	"github.com/emqx/kuiper/xstream/checkpoints"
+	"github.com/emqx/kuiper/xstream/contexts"
+	"github.com/emqx/kuiper/xstream/states"
+	"os"
+	"path"
 	"reflect"
 	"testing"
 )
@@ -260,3 +269,190 @@ func TestCountWindow(t *testing.T) {
 		}
 	}
 }
+
+func TestWindowStateEncode(t *testing.T) {
+	var tests = []map[string]*WindowState{
+		{
+			"": &WindowState{TriggerTime: 1541152486013, TimeoutTs: 1541152487013},
+		}, {
+			"red":  &WindowState{Inputs: fivet[:1], MsgCount: 1, TimeoutTs: 1541152487013},
+			"blue": &WindowState{Inputs: fivet[1:2], TimeoutTs: 1541152488013},
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		var buf bytes.Buffer
+		var v interface{} = tt
+		if err := gob.NewEncoder(&buf).Encode(&v); err != nil {
+			t.Errorf("%d: encode error %v", i, err)
+			continue
+		}
+		var r interface{}
+		if err := gob.NewDecoder(&buf).Decode(&r); err != nil {
+			t.Errorf("%d: decode error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt, r) {
+			t.Errorf("%d. window states mismatch:\n  exp=%#v\n  got=%#v\n\n", i, tt, r)
+		}
+	}
+}
+
+func TestIncrementalWindowSkewedStart(t *testing.T) {
+	store, err := states.CreateStore("rule1", api.AtMostOnce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := contexts.Background().WithMeta("rule1", "op1", store)
+	sum := &xsql.Call{Name: "sum", Args: []xsql.Expr{&xsql.FieldRef{Name: "a", StreamName: xsql.DEFAULT_STREAM}}, CacheKey: "$$a_sum"}
+	o, err := NewWindowOp("window", WindowConfig{Type: xsql.TUMBLING_WINDOW, Length: 1000, Aggregates: []*xsql.Call{sum}}, nil, &api.RuleOption{BufferLength: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := make(chan interface{}, 10)
+	o.AddOutput(output, "test")
+	o.ctx = ctx
+	o.statManager, _ = NewStatManager("op", ctx)
+	o.fv, _ = xsql.NewFunctionValuersForOp(ctx, nil)
+	o.states = map[string]*WindowState{"": {}}
+	// The ticker ticks at 1000 + n * 1000 but the start is read 7ms later
+	o.tickerStart = 1007
+	var tests = []struct {
+		inputs []int64
+		tick   int64
+		result interface{}
+	}{
+		{
+			inputs: []int64{1500, 2000},
+			tick:   2000,
+			result: 3,
+		}, {
+			// The tuple arrives after the tick belongs to the next window
+			inputs: []int64{2003, 2800},
+			tick:   3001,
+			result: 7,
+		}, {
+			tick: 4000,
+		}, {
+			inputs: []int64{4999},
+			tick:   5000,
+			result: 5,
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	var a int
+	for i, tt := range tests {
+		for _, ts := range tt.inputs {
+			a++
+			if err := o.accumulate(o.states[""], &xsql.Tuple{Emitter: "demo", Message: xsql.Message{"a": a}, Timestamp: ts}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		o.tick(tt.tick, ctx)
+		var result interface{}
+		select {
+		case r := <-output:
+			result = r.(xsql.WindowTuplesSet)[0].Tuples[0].Message["$$a_sum"]
+		default:
+		}
+		if !reflect.DeepEqual(tt.result, result) {
+			t.Errorf("%d. tick at %d result mismatch:\n  exp=%v\n  got=%v\n\n", i, tt.tick, tt.result, result)
+		}
+	}
+}
+
+func TestLateEventsMetrics(t *testing.T) {
+	ctx := contexts.Background()
+	o, err := NewWindowOp("window", WindowConfig{Type: xsql.TUMBLING_WINDOW, Length: 1000}, []string{"demo"}, &api.RuleOption{BufferLength: 10, IsEventTime: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.statManager, _ = NewStatManager("op", ctx)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			o.processLate(&xsql.Tuple{Emitter: "demo", Message: xsql.Message{"a": i}, Timestamp: int64(i)}, ctx)
+		}
+		close(done)
+	}()
+	// Read the metrics from the rest api while the operator processes the late events
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+			o.GetMetrics()
+		}
+	}
+	m := o.GetMetrics()[0]
+	if r := m[len(m)-1]; r != int64(100) {
+		t.Errorf("late events metric mismatch, expect 100 but got %v", r)
+	}
+}
+
+func TestWindowStateCheckpoint(t *testing.T) {
+	ruleId := "testWindowStateCheckpoint"
+	defer func() {
+		dbDir, _ := common.GetDataLoc()
+		os.RemoveAll(path.Join(dbDir, ruleId))
+	}()
+	var tests = []struct {
+		states map[string]*WindowState
+		result map[string]*WindowState
+	}{
+		{
+			states: map[string]*WindowState{
+				// The idle partition keeps the window progress
+				"red":  {NextWindowEndTs: 3000, PrevWindowEndTs: 2000, Triggered: true},
+				"blue": {Inputs: fivet[:1], NextWindowEndTs: 3000, PrevWindowEndTs: 2000, Triggered: true},
+				// The partition without any window progress is removed
+				"green": {},
+			},
+			result: map[string]*WindowState{
+				"red":  {NextWindowEndTs: 3000, PrevWindowEndTs: 2000, Triggered: true},
+				"blue": {Inputs: fivet[:1], NextWindowEndTs: 3000, PrevWindowEndTs: 2000, Triggered: true},
+			},
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		store, err := states.CreateStore(ruleId, api.AtLeastOnce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := contexts.Background().WithMeta(ruleId, "op1", store)
+		o, err := NewWindowOp("window", WindowConfig{
+			Type:      xsql.TUMBLING_WINDOW,
+			Length:    1000,
+			Partition: []xsql.Expr{&xsql.FieldRef{Name: "color", StreamName: xsql.DEFAULT_STREAM}},
+		}, []string{"demo"}, &api.RuleOption{BufferLength: 10, IsEventTime: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		o.states = tt.states
+		o.putState(ctx)
+		cid := int64(i + 1)
+		sctx := ctx.(checkpoints.StreamCheckpointContext)
+		if err := sctx.Snapshot(); err != nil {
+			t.Fatal(err)
+		}
+		if err := sctx.SaveState(cid); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.SaveCheckpoint(cid); err != nil {
+			t.Fatal(err)
+		}
+		// Restore from the checkpoint as the rule restarts
+		restored, err := states.CreateStore(ruleId, api.AtLeastOnce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := contexts.Background().WithMeta(ruleId, "op1", restored).GetState(WINDOW_STATES_KEY)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(tt.result, r) {
+			t.Errorf("%d. window states mismatch:\n  exp=%#v\n  got=%#v\n\n", i, tt.result, r)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package operators
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/xsql"
+	"github.com/emqx/kuiper/xstream/contexts"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestArrayFunc_Apply1(t *testing.T) {
+	var tests = []struct {
+		sql    string
+		data   *xsql.Tuple
+		result []map[string]interface{}
+	}{
+		{
+			sql: "SELECT array_contains(a, 2) AS c, array_position(a, 3) AS p, array_position(a, 9) AS n FROM test",
+			data: &xsql.Tuple{
+				Emitter: "test",
+				Message: xsql.Message{
+					"a": []interface{}{float64(1), float64(2), float64(3)},
+				},
+			},
+			result: []map[string]interface{}{{
+				"c": true,
+				"p": float64(2),
+				"n": float64(-1),
+			}},
+		}, {
+			sql: "SELECT array_distinct(a) AS d, array_concat(a, b) AS c, array_slice(a, 1, -1) AS s FROM test",
+			data: &xsql.Tuple{
+				Emitter: "test",
+				Message: xsql.Message{
+					"a": []int{1, 2, 2, 3},
+					"b": []interface{}{"x"},
+				},
+			},
+			result: []map[string]interface{}{{
+				"d": []interface{}{float64(1), float64(2), float64(3)},
+				"c": []interface{}{float64(1), float64(2), float64(2), float64(3), "x"},
+				"s": []interface{}{float64(2), float64(2)},
+			}},
+		}, {
+			sql: "SELECT object_keys(o) AS k, object_values(o) AS v, object_construct(\"k\", a, \"n\", c) AS c FROM test",
+			data: &xsql.Tuple{
+				Emitter: "test",
+				Message: xsql.Message{
+					"a": "va",
+					"o": map[string]interface{}{"b": 2, "a": 1},
+				},
+			},
+			result: []map[string]interface{}{{
+				"k": []interface{}{"a", "b"},
+				"v": []interface{}{float64(1), float64(2)},
+				"c": map[string]interface{}{"k": "va"},
+			}},
+		}, {
+			sql: "SELECT zip(a, b) AS z FROM test",
+			data: &xsql.Tuple{
+				Emitter: "test",
+				Message: xsql.Message{
+					"a": []interface{}{1, 2, 3},
+					"b": []interface{}{"x", "y"},
+				},
+			},
+			result: []map[string]interface{}{{
+				"z": []interface{}{[]interface{}{float64(1), "x"}, []interface{}{float64(2), "y"}},
+			}},
+		}, {
+			sql: "SELECT array_map(a, x -> x * 2) AS m, array_filter(a, x -> x > t) AS f FROM test",
+			data: &xsql.Tuple{
+				Emitter: "test",
+				Message: xsql.Message{
+					"a": []interface{}{1, 2, 3},
+					"t": 1,
+				},
+			},
+			result: []map[string]interface{}{{
+				"m": []interface{}{float64(2), float64(4), float64(6)},
+				"f": []interface{}{float64(2), float64(3)},
+			}},
+		}, {
+			sql: "SELECT array_map(a, x -> x->name) AS names, array_map(a, x -> array_filter(b, y -> y > x->id)) AS bigger FROM test",
+			data: &xsql.Tuple{
+				Emitter: "test",
+				Message: xsql.Message{
+					"a": []interface{}{
+						map[string]interface{}{"id": 1, "name": "n1"},
+						map[string]interface{}{"id": 2, "name": "n2"},
+					},
+					"b": []interface{}{1, 2, 3},
+				},
+			},
+			result: []map[string]interface{}{{
+				"names":  []interface{}{"n1", "n2"},
+				"bigger": []interface{}{[]interface{}{float64(2), float64(3)}, []interface{}{float64(3)}},
+			}},
+		}, {
+			sql: "SELECT id, unnest(a) AS v FROM test",
+			data: &xsql.Tuple{
+				Emitter: "test",
+				Message: xsql.Message{
+					"id": 1,
+					"a":  []interface{}{"x", "y"},
+				},
+			},
+			result: []map[string]interface{}{{
+				"id": float64(1),
+				"v":  "x",
+			}, {
+				"id": float64(1),
+				"v":  "y",
+			}},
+		}, {
+			sql: "SELECT id, unnest(a) FROM test",
+			data: &xsql.Tuple{
+				Emitter: "test",
+				Message: xsql.Message{
+					"id": 1,
+					"a": []interface{}{
+						map[string]interface{}{"id": 11, "name": "n1"},
+						map[string]interface{}{"name": "n2"},
+					},
+				},
+			},
+			result: []map[string]interface{}{{
+				"id":   float64(1),
+				"name": "n1",
+			}, {
+				"id":   float64(1),
+				"name": "n2",
+			}},
+		},
+	}
+
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	contextLogger := common.Log.WithField("rule", "TestArrayFunc_Apply1")
+	ctx := contexts.WithValue(contexts.Background(), contexts.LoggerKey, contextLogger)
+	for i, tt := range tests {
+		stmt, err := xsql.NewParser(strings.NewReader(tt.sql)).Parse()
+		if err != nil || stmt == nil {
+			t.Errorf("parse sql %s error %v", tt.sql, err)
+		}
+		pp := &ProjectOp{Fields: stmt.Fields}
+		pp.isTest = true
+		fv, afv := xsql.NewFunctionValuersForOp(nil, xsql.FuncRegisters)
+		result := pp.Apply(ctx, tt.data, fv, afv)
+		var mapRes []map[string]interface{}
+		if v, ok := result.([]byte); ok {
+			err := json.Unmarshal(v, &mapRes)
+			if err != nil {
+				t.Errorf("Failed to parse the input into map.\n")
+				continue
+			}
+			if !reflect.DeepEqual(tt.result, mapRes) {
+				t.Errorf("%d. %q\n\nresult mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.sql, tt.result, mapRes)
+			}
+		} else {
+			t.Errorf("%d. The returned result is not type of []byte\n", i)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package operators
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/xsql"
+	"github.com/emqx/kuiper/xstream/contexts"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDateTimeFunc_Apply1(t *testing.T) {
+	var tests = []struct {
+		sql    string
+		data   *xsql.Tuple
+		result []map[string]interface{}
+	}{
+		{
+			sql: "SELECT date_trunc(hour, a) AS h, date_trunc(\"month\", a) AS m, date_trunc(week, a) AS w FROM test",
+			data: &xsql.Tuple{
+				Emitter: "test",
+				Message: xsql.Message{
+					"a": int64(1568854515123),
+				},
+			},
+			result: []map[string]interface{}{{
+				"h": float64(1568851200000),
+				"m": float64(1567296000000),
+				"w": float64(1568592000000),
+			}},
+		}, {
+			sql: "SELECT date_trunc(dd, a, \"Asia/Shanghai\") AS d FROM test",
+			data: &xsql.Tuple{
+				Emitter: "test",
+				Message: xsql.Message{
+					"a": int64(1568854515123),
+				},
+			},
+			result: []map[string]interface{}{{
+				"d": float64(1568822400000),
+			}},
+		}, {
+			sql: "SELECT date_add(month, 1, a) AS a1, date_add(hh, -2, a) AS a2 FROM test",
+			data: &xsql.Tuple{
+				Emitter: "test",
+				Message: xsql.Message{
+					"a": common.TimeFromUnixMilli(1568854515123),
+				},
+			},
+			result: []map[string]interface{}{{
+				"a1": float64(1571446515123),
+				"a2": float64(1568847315123),
+			}},
+		}, {
+			sql: "SELECT date_diff(day, a, b) AS d, date_diff(month, \"2019-01-31T00:00:00.000Z\", \"2019-03-30T00:00:00.000Z\") AS m FROM test",
+			data: &xsql.Tuple{
+				Emitter: "test",
+				Message: xsql.Message{
+					"a": float64(1568854515123),
+					"b": "2019-09-21T10:00:00.000+08:00",
+				},
+			},
+			result: []map[string]interface{}{{
+				"d": float64(2),
+				"m": float64(1),
+			}},
+		}, {
+			sql: "SELECT extract(hour FROM a) AS h, extract(dow FROM a) AS w, extract(doy, a) AS y, extract(hour, a, \"Asia/Shanghai\") AS lh FROM test",
+			data: &xsql.Tuple{
+				Emitter: "test",
+				Message: xsql.Message{
+					"a": int64(1568854515123),
+				},
+			},
+			result: []map[string]interface{}{{
+				"h":  float64(0),
+				"w":  float64(4),
+				"y":  float64(262),
+				"lh": float64(8),
+			}},
+		}, {
+			sql: "SELECT to_timestamp(a, \"yyyy-MM-dd HH:mm:ss\", \"Asia/Shanghai\") AS t, to_char(b, \"yyyy-MM-dd HH:mm\", \"America/New_York\") AS s FROM test",
+			data: &xsql.Tuple{
+				Emitter: "test",
+				Message: xsql.Message{
+					"a": "2019-09-19 08:55:15",
+					"b": int64(1568854515123),
+				},
+			},
+			result: []map[string]interface{}{{
+				"t": float64(1568854515000),
+				"s": "2019-09-18 20:55",
+			}},
+		}, {
+			sql: "SELECT day_of_week(a) AS d, hour_of_day(a, \"Asia/Tokyo\") AS h, convert_tz(a, \"Asia/Tokyo\") AS c, extract(hour FROM convert_tz(a, \"Asia/Tokyo\")) AS ch FROM test",
+			data: &xsql.Tuple{
+				Emitter: "test",
+				Message: xsql.Message{
+					"a": int64(1568854515123),
+				},
+			},
+			result: []map[string]interface{}{{
+				"d":  float64(4),
+				"h":  float64(9),
+				"c":  "2019-09-19T09:55:15.123+09:00",
+				"ch": float64(9),
+			}},
+		}, {
+			sql: "SELECT date_trunc(day, b) AS d FROM test",
+			data: &xsql.Tuple{
+				Emitter: "test",
+				Message: xsql.Message{
+					"a": int64(1568854515123),
+				},
+			},
+			result: []map[string]interface{}{{}},
+		},
+	}
+
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	contextLogger := common.Log.WithField("rule", "TestDateTimeFunc_Apply1")
+	ctx := contexts.WithValue(contexts.Background(), contexts.LoggerKey, contextLogger)
+	for i, tt := range tests {
+		stmt, err := xsql.NewParser(strings.NewReader(tt.sql)).Parse()
+		if err != nil || stmt == nil {
+			t.Errorf("parse sql %s error %v", tt.sql, err)
+		}
+		pp := &ProjectOp{Fields: stmt.Fields}
+		pp.isTest = true
+		fv, afv := xsql.NewFunctionValuersForOp(nil, xsql.FuncRegisters)
+		result := pp.Apply(ctx, tt.data, fv, afv)
+		var mapRes []map[string]interface{}
+		if v, ok := result.([]byte); ok {
+			err := json.Unmarshal(v, &mapRes)
+			if err != nil {
+				t.Errorf("Failed to parse the input into map.\n")
+				continue
+			}
+			if !reflect.DeepEqual(tt.result, mapRes) {
+				t.Errorf("%d. %q\n\nresult mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.sql, tt.result, mapRes)
+			}
+		} else {
+			t.Errorf("%d. The returned result is not type of []byte\n", i)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package operators
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/emqx/kuiper/xsql"
+	"github.com/emqx/kuiper/xstream/api"
+)
+
+type DistinctOp struct {
+}
+
+/**
+ *  input: []byte from projectOp
+ *  output: []byte without the duplicate rows, the first occurrence is kept
+ */
+func (p *DistinctOp) Apply(ctx api.StreamContext, data interface{}, _ *xsql.FunctionValuer, _ *xsql.AggregateFunctionValuer) interface{} {
+	log := ctx.GetLogger()
+	log.Debugf("distinct plan receive %s", data)
+	switch input := data.(type) {
+	case error:
+		return input
+	case []byte:
+		results, err := decodeResults(input)
+		if err != nil {
+			return fmt.Errorf("run Distinct error: %s", err)
+		}
+		keys := make(map[string]bool)
+		r := results[:0]
+		for _, m := range results {
+			// The map keys are sorted when marshalling, so the same rows have the same key
+			k, err := json.Marshal(m)
+			if err != nil {
+				return fmt.Errorf("run Distinct error: %s", err)
+			}
+			if !keys[string(k)] {
+				keys[string(k)] = true
+				r = append(r, m)
+			}
+		}
+		if len(r) == len(results) {
+			return input
+		}
+		if ret, err := json.Marshal(r); err == nil {
+			return ret
+		} else {
+			return fmt.Errorf("run Distinct error: %v", err)
+		}
+	default:
+		return fmt.Errorf("run Distinct error: invalid input %[1]T(%[1]v)", input)
+	}
+}
@@ -0,0 +1,43 @@
+package operators
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/xsql"
+	"github.com/emqx/kuiper/xstream/contexts"
+	"reflect"
+	"testing"
+)
+
+func TestDistinctPlan_Apply(t *testing.T) {
+	var tests = []struct {
+		data   interface{}
+		result interface{}
+	}{
+		{
+			data:   []byte(`[{"a":1,"b":"x"},{"b":"x","a":1},{"a":2,"b":"x"},{"a":1,"b":"y"}]`),
+			result: []byte(`[{"a":1,"b":"x"},{"a":2,"b":"x"},{"a":1,"b":"y"}]`),
+		}, {
+			data:   []byte(`[{"a":1},{"a":2}]`),
+			result: []byte(`[{"a":1},{"a":2}]`),
+		}, {
+			data:   []byte(`[{"a":{"c":[1,2]}},{"a":{"c":[1,2]}},{"a":{"c":[2,1]}}]`),
+			result: []byte(`[{"a":{"c":[1,2]}},{"a":{"c":[2,1]}}]`),
+		}, {
+			data:   []byte(`[{"a":1}`),
+			result: fmt.Errorf("run Distinct error: unexpected EOF"),
+		},
+	}
+
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	contextLogger := common.Log.WithField("rule", "TestDistinctPlan_Apply")
+	ctx := contexts.WithValue(contexts.Background(), contexts.LoggerKey, contextLogger)
+	for i, tt := range tests {
+		pp := &DistinctOp{}
+		fv, afv := xsql.NewFunctionValuersForOp(nil, xsql.FuncRegisters)
+		result := pp.Apply(ctx, tt.data, fv, afv)
+		if !reflect.DeepEqual(tt.result, result) {
+			t.Errorf("%d. %s\n\nresult mismatch:\n\nexp=%s\n\ngot=%s\n\n", i, tt.data, tt.result, result)
+		}
+	}
+}
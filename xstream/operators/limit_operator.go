@@ -0,0 +1,85 @@
+package operators
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/emqx/kuiper/xsql"
+	"github.com/emqx/kuiper/xstream/api"
+)
+
+type LimitOp struct {
+	Limit  int
+	Offset int
+	// The columns to group the rows. If set, the limit and offset are applied to each group
+	By []string
+}
+
+/**
+ *  input: []byte from projectOp or distinctOp
+ *  output: []byte
+ */
+func (p *LimitOp) Apply(ctx api.StreamContext, data interface{}, _ *xsql.FunctionValuer, _ *xsql.AggregateFunctionValuer) interface{} {
+	log := ctx.GetLogger()
+	log.Debugf("limit plan receive %s", data)
+	switch input := data.(type) {
+	case error:
+		return input
+	case []byte:
+		results, err := decodeResults(input)
+		if err != nil {
+			return fmt.Errorf("run Limit error: %s", err)
+		}
+		if len(p.By) > 0 {
+			results = p.limitGroups(results)
+		} else if p.Offset >= len(results) {
+			return nil
+		} else {
+			results = results[p.Offset:]
+			if p.Limit < len(results) {
+				results = results[:p.Limit]
+			}
+		}
+		if len(results) == 0 {
+			return nil
+		}
+		if ret, err := json.Marshal(results); err == nil {
+			return ret
+		} else {
+			return fmt.Errorf("run Limit error: %v", err)
+		}
+	default:
+		return fmt.Errorf("run Limit error: invalid input %[1]T(%[1]v)", input)
+	}
+}
+
+// Keep the rows of each group whose rank is within the offset and limit. The rows are kept in their original order
+// so that the order by ranks the rows within each group
+func (p *LimitOp) limitGroups(results []map[string]interface{}) []map[string]interface{} {
+	ranks := make(map[string]int)
+	var r []map[string]interface{}
+	for _, row := range results {
+		values := make([]interface{}, len(p.By))
+		for i, col := range p.By {
+			values[i] = row[col]
+		}
+		key := fmt.Sprintf("%v", values)
+		rank := ranks[key]
+		ranks[key] = rank + 1
+		if rank >= p.Offset && rank < p.Offset+p.Limit {
+			r = append(r, row)
+		}
+	}
+	return r
+}
+
+// Decode the project result and keep the numbers as they are
+func decodeResults(data []byte) ([]map[string]interface{}, error) {
+	var results []map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,81 @@
+package operators
+
+import (
+	"errors"
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/xsql"
+	"github.com/emqx/kuiper/xstream/contexts"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLimitPlan_Apply(t *testing.T) {
+	var tests = []struct {
+		sql    string
+		data   interface{}
+		result interface{}
+	}{
+		{
+			sql:    "SELECT a FROM tbl LIMIT 2",
+			data:   []byte(`[{"a":1},{"a":2},{"a":3}]`),
+			result: []byte(`[{"a":1},{"a":2}]`),
+		}, {
+			sql:    "SELECT a FROM tbl LIMIT 2 OFFSET 2",
+			data:   []byte(`[{"a":1},{"a":2},{"a":3}]`),
+			result: []byte(`[{"a":3}]`),
+		}, {
+			sql:    "SELECT a FROM tbl LIMIT 5",
+			data:   []byte(`[{"a":12345678901234567890,"b":1.50},{"a":2}]`),
+			result: []byte(`[{"a":12345678901234567890,"b":1.50},{"a":2}]`),
+		}, {
+			sql:    "SELECT a FROM tbl LIMIT 2 OFFSET 3",
+			data:   []byte(`[{"a":1},{"a":2},{"a":3}]`),
+			result: nil,
+		}, {
+			sql:    "SELECT a FROM tbl LIMIT 0",
+			data:   []byte(`[{"a":1},{"a":2},{"a":3}]`),
+			result: nil,
+		}, {
+			// The top 2 devices of each region
+			sql:    "SELECT region, device, t FROM tbl ORDER BY t DESC LIMIT 2 BY region",
+			data:   []byte(`[{"region":"east","device":"d1","t":30},{"region":"west","device":"d4","t":28},{"region":"east","device":"d2","t":25},{"region":"east","device":"d3","t":20},{"region":"west","device":"d5","t":18},{"region":"west","device":"d6","t":15}]`),
+			result: []byte(`[{"device":"d1","region":"east","t":30},{"device":"d4","region":"west","t":28},{"device":"d2","region":"east","t":25},{"device":"d5","region":"west","t":18}]`),
+		}, {
+			sql:    "SELECT region, device, t FROM tbl LIMIT 1 OFFSET 1 BY region",
+			data:   []byte(`[{"region":"east","device":"d1","t":30},{"region":"west","device":"d4","t":28},{"region":"east","device":"d2","t":25},{"region":"west","device":"d5","t":18}]`),
+			result: []byte(`[{"device":"d2","region":"east","t":25},{"device":"d5","region":"west","t":18}]`),
+		}, {
+			sql:    "SELECT region, device FROM tbl LIMIT 1 OFFSET 1 BY region",
+			data:   []byte(`[{"region":"east","device":"d1"},{"region":"west","device":"d4"}]`),
+			result: nil,
+		}, {
+			sql:    "SELECT a FROM tbl LIMIT 1",
+			data:   errors.New("an error from upstream"),
+			result: errors.New("an error from upstream"),
+		}, {
+			sql:    "SELECT a FROM tbl LIMIT 1",
+			data:   []byte(`{"a":1}`),
+			result: errors.New("run Limit error: json: cannot unmarshal object into Go value of type []map[string]interface {}"),
+		},
+	}
+
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	contextLogger := common.Log.WithField("rule", "TestLimitPlan_Apply")
+	ctx := contexts.WithValue(contexts.Background(), contexts.LoggerKey, contextLogger)
+	for i, tt := range tests {
+		stmt, err := xsql.NewParser(strings.NewReader(tt.sql)).Parse()
+		if err != nil {
+			t.Errorf("statement parse error %s", err)
+			break
+		}
+
+		pp := &LimitOp{Limit: stmt.Limit.Count, Offset: stmt.Limit.Offset, By: stmt.Limit.By}
+		fv, afv := xsql.NewFunctionValuersForOp(nil, xsql.FuncRegisters)
+		result := pp.Apply(ctx, tt.data, fv, afv)
+		if !reflect.DeepEqual(tt.result, result) {
+			t.Errorf("%d. %q\n\nresult mismatch:\n\nexp=%s\n\ngot=%s\n\n", i, tt.sql, tt.result, result)
+		}
+	}
+}
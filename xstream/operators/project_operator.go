@@ -34,9 +34,11 @@ func (pp *ProjectOp) Apply(ctx api.StreamContext, data interface{}, fv *xsql.Fun
 			return fmt.Errorf("run Select error: %s", err)
 		} else {
 			if pp.SendMeta && input.Metadata != nil {
-				r[common.MetaKey] = input.Metadata
+				for _, m := range r {
+					m[common.MetaKey] = input.Metadata
+				}
 			}
-			results = append(results, r)
+			results = append(results, r...)
 		}
 	case xsql.WindowTuplesSet:
 		if len(input) != 1 {
@@ -48,7 +50,7 @@ func (pp *ProjectOp) Apply(ctx api.StreamContext, data interface{}, fv *xsql.Fun
 			if r, err := project(pp.Fields, ve, pp.isTest); err != nil {
 				return fmt.Errorf("run Select error: %s", err)
 			} else {
-				results = append(results, r)
+				results = append(results, r...)
 			}
 			if pp.IsAggregate {
 				break
@@ -61,7 +63,7 @@ func (pp *ProjectOp) Apply(ctx api.StreamContext, data interface{}, fv *xsql.Fun
 			if r, err := project(pp.Fields, ve, pp.isTest); err != nil {
 				return err
 			} else {
-				results = append(results, r)
+				results = append(results, r...)
 			}
 			if pp.IsAggregate {
 				break
@@ -73,13 +75,17 @@ func (pp *ProjectOp) Apply(ctx api.StreamContext, data interface{}, fv *xsql.Fun
 			if r, err := project(pp.Fields, ve, pp.isTest); err != nil {
 				return fmt.Errorf("run Select error: %s", err)
 			} else {
-				results = append(results, r)
+				results = append(results, r...)
 			}
 		}
 	default:
 		return fmt.Errorf("run Select error: invalid input %[1]T(%[1]v)", input)
 	}
 
+	// All the rows are expanded by unnest to nothing
+	if len(results) == 0 && pp.hasUnnest() {
+		return nil
+	}
 	if ret, err := json.Marshal(results); err == nil {
 		return ret
 	} else {
@@ -87,6 +93,15 @@ func (pp *ProjectOp) Apply(ctx api.StreamContext, data interface{}, fv *xsql.Fun
 	}
 }
 
+func (pp *ProjectOp) hasUnnest() bool {
+	for _, f := range pp.Fields {
+		if xsql.IsUnnest(f.Expr) {
+			return true
+		}
+	}
+	return false
+}
+
 func (pp *ProjectOp) getVE(tuple xsql.DataValuer, agg xsql.AggregateData, fv *xsql.FunctionValuer, afv *xsql.AggregateFunctionValuer) *xsql.ValuerEval {
 	afv.SetData(agg)
 	if pp.IsAggregate {
@@ -96,18 +111,28 @@ func (pp *ProjectOp) getVE(tuple xsql.DataValuer, agg xsql.AggregateData, fv *xs
 	}
 }
 
-func project(fs xsql.Fields, ve *xsql.ValuerEval, isTest bool) (map[string]interface{}, error) {
+// Project the fields of one row. If there is an unnest field, the row is expanded into a row for each array element
+func project(fs xsql.Fields, ve *xsql.ValuerEval, isTest bool) ([]map[string]interface{}, error) {
 	result := make(map[string]interface{})
-	for _, f := range fs {
+	var (
+		unnestField *xsql.Field
+		unnestValue interface{}
+	)
+	for i, f := range fs {
 		expr := f.Expr
 		//Avoid to re-evaluate for non-agg field has alias name, which was already evaluated in pre-processor operator.
-		if f.AName != "" && !isTest {
+		//The analytic field is always evaluated here so that its states only include the projected rows.
+		if f.AName != "" && !isTest && !xsql.HasAnalyticFuncs(expr) {
 			expr = &xsql.FieldRef{StreamName: xsql.DEFAULT_STREAM, Name: f.AName}
 		}
 		v := ve.Eval(expr)
 		if e, ok := v.(error); ok {
 			return nil, e
 		}
+		if xsql.IsUnnest(f.Expr) {
+			unnestField, unnestValue = &fs[i], v
+			continue
+		}
 		if _, ok := f.Expr.(*xsql.Wildcard); ok || f.Name == "*" {
 			switch val := v.(type) {
 			case map[string]interface{}:
@@ -134,7 +159,40 @@ func project(fs xsql.Fields, ve *xsql.ValuerEval, isTest bool) (map[string]inter
 			}
 		}
 	}
-	return result, nil
+	if unnestField == nil {
+		return []map[string]interface{}{result}, nil
+	}
+	return unnest(result, unnestField, unnestValue)
+}
+
+// Expand the row for each element of the unnest array. If the element is an object, its keys become the columns,
+// otherwise the element is the value of the unnest field. A null or empty array produces no rows.
+func unnest(row map[string]interface{}, f *xsql.Field, v interface{}) ([]map[string]interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	a, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("the argument of unnest must be an array but found %[1]T(%[1]v)", v)
+	}
+	results := make([]map[string]interface{}, 0, len(a))
+	for _, e := range a {
+		r := make(map[string]interface{}, len(row)+1)
+		for k, v := range row {
+			r[k] = v
+		}
+		if m, ok := e.(map[string]interface{}); ok {
+			for k, v := range m {
+				if _, ok := r[k]; !ok {
+					r[k] = v
+				}
+			}
+		} else if e != nil {
+			r[assignName(f.Name, f.AName, r)] = e
+		}
+		results = append(results, r)
+	}
+	return results, nil
 }
 
 const DEFAULT_FIELD_NAME_PREFIX string = "kuiper_field_"
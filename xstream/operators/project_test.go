@@ -1975,6 +1975,57 @@ func TestProjectPlan_AggFuncs(t *testing.T) {
 				},
 			},
 			result: []map[string]interface{}{{}},
+		}, {
+			sql: "SELECT stddev(a) AS sd, stddevs(a) AS sds, var(a) AS v, vars(a) AS vs, median(a) AS m, percentile_cont(a, 0.25) AS pc, percentile_disc(a, 0.25) AS pd, mode(a) AS mo, first_value(a) AS f, last_value(a) AS l, count(DISTINCT a) AS c, count(DISTINCT b) AS cb FROM test GROUP BY TumblingWindow(ss, 10)",
+			data: xsql.WindowTuplesSet{
+				xsql.WindowTuples{
+					Emitter: "test",
+					Tuples: []xsql.Tuple{
+						{
+							Emitter: "src1",
+							Message: xsql.Message{"a": 2, "b": "x"},
+						}, {
+							Emitter: "src1",
+							Message: xsql.Message{"a": 4, "b": "x"},
+						}, {
+							Emitter: "src1",
+							Message: xsql.Message{"b": "y"},
+						}, {
+							Emitter: "src1",
+							Message: xsql.Message{"a": 4, "b": "x"},
+						}, {
+							Emitter: "src1",
+							Message: xsql.Message{"a": 4, "b": "x"},
+						}, {
+							Emitter: "src1",
+							Message: xsql.Message{"a": 5, "b": "x"},
+						}, {
+							Emitter: "src1",
+							Message: xsql.Message{"a": 5, "b": "x"},
+						}, {
+							Emitter: "src1",
+							Message: xsql.Message{"a": 7, "b": "x"},
+						}, {
+							Emitter: "src1",
+							Message: xsql.Message{"a": 9, "b": "x"},
+						},
+					},
+				},
+			},
+			result: []map[string]interface{}{{
+				"sd":  float64(2),
+				"sds": 2.138089935299395,
+				"v":   float64(4),
+				"vs":  4.571428571428571,
+				"m":   4.5,
+				"pc":  float64(4),
+				"pd":  float64(4),
+				"mo":  float64(4),
+				"f":   float64(2),
+				"l":   float64(9),
+				"c":   float64(5),
+				"cb":  float64(2),
+			}},
 		},
 	}
 
@@ -0,0 +1,41 @@
+package operators
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/xsql"
+	"github.com/emqx/kuiper/xstream/api"
+	"sort"
+)
+
+type UnionOp struct {
+}
+
+/**
+ *  input: *xsql.Tuple from preprocessors | xsql.WindowTuplesSet from windowOp
+ *  output: *xsql.Tuple | xsql.WindowTuplesSet with only one WindowTuples which has the tuples of all the streams
+ *  ordered by timestamp. Each tuple keeps its emitter.
+ */
+func (p *UnionOp) Apply(ctx api.StreamContext, data interface{}, _ *xsql.FunctionValuer, _ *xsql.AggregateFunctionValuer) interface{} {
+	log := ctx.GetLogger()
+	log.Debugf("union plan receive %s", data)
+	switch input := data.(type) {
+	case error:
+		return input
+	case *xsql.Tuple:
+		return input
+	case xsql.WindowTuplesSet:
+		if len(input) <= 1 {
+			return input
+		}
+		var tuples []xsql.Tuple
+		for _, wt := range input {
+			tuples = append(tuples, wt.Tuples...)
+		}
+		sort.SliceStable(tuples, func(i, j int) bool {
+			return tuples[i].Timestamp < tuples[j].Timestamp
+		})
+		return xsql.WindowTuplesSet{{Emitter: input[0].Emitter, Tuples: tuples}}
+	default:
+		return fmt.Errorf("run Union error: invalid input %[1]T(%[1]v)", input)
+	}
+}
@@ -0,0 +1,82 @@
+package operators
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/xsql"
+	"github.com/emqx/kuiper/xstream/contexts"
+	"reflect"
+	"testing"
+)
+
+func TestUnionPlan_Apply(t *testing.T) {
+	var tests = []struct {
+		data   interface{}
+		result interface{}
+	}{
+		{
+			data: xsql.WindowTuplesSet{
+				xsql.WindowTuples{
+					Emitter: "line1",
+					Tuples: []xsql.Tuple{
+						{Emitter: "line1", Message: xsql.Message{"a": 1}, Timestamp: 100},
+						{Emitter: "line1", Message: xsql.Message{"a": 3}, Timestamp: 300},
+					},
+				},
+				xsql.WindowTuples{
+					Emitter: "line2",
+					Tuples: []xsql.Tuple{
+						{Emitter: "line2", Message: xsql.Message{"a": 2}, Timestamp: 200},
+						{Emitter: "line2", Message: xsql.Message{"a": 4}, Timestamp: 300},
+					},
+				},
+			},
+			result: xsql.WindowTuplesSet{
+				xsql.WindowTuples{
+					Emitter: "line1",
+					Tuples: []xsql.Tuple{
+						{Emitter: "line1", Message: xsql.Message{"a": 1}, Timestamp: 100},
+						{Emitter: "line2", Message: xsql.Message{"a": 2}, Timestamp: 200},
+						{Emitter: "line1", Message: xsql.Message{"a": 3}, Timestamp: 300},
+						{Emitter: "line2", Message: xsql.Message{"a": 4}, Timestamp: 300},
+					},
+				},
+			},
+		}, {
+			data: xsql.WindowTuplesSet{
+				xsql.WindowTuples{
+					Emitter: "line2",
+					Tuples: []xsql.Tuple{
+						{Emitter: "line2", Message: xsql.Message{"a": 2}, Timestamp: 200},
+					},
+				},
+			},
+			result: xsql.WindowTuplesSet{
+				xsql.WindowTuples{
+					Emitter: "line2",
+					Tuples: []xsql.Tuple{
+						{Emitter: "line2", Message: xsql.Message{"a": 2}, Timestamp: 200},
+					},
+				},
+			},
+		}, {
+			data:   &xsql.Tuple{Emitter: "line2", Message: xsql.Message{"a": 2}, Timestamp: 200},
+			result: &xsql.Tuple{Emitter: "line2", Message: xsql.Message{"a": 2}, Timestamp: 200},
+		}, {
+			data:   []byte(`[{"a":1}]`),
+			result: fmt.Errorf("run Union error: invalid input []uint8([91 123 34 97 34 58 49 125 93])"),
+		},
+	}
+
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	contextLogger := common.Log.WithField("rule", "TestUnionPlan_Apply")
+	ctx := contexts.WithValue(contexts.Background(), contexts.LoggerKey, contextLogger)
+	for i, tt := range tests {
+		pp := &UnionOp{}
+		fv, afv := xsql.NewFunctionValuersForOp(nil, xsql.FuncRegisters)
+		result := pp.Apply(ctx, tt.data, fv, afv)
+		if !reflect.DeepEqual(tt.result, result) {
+			t.Errorf("%d. %v\n\nresult mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.data, tt.result, result)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package planner
+
+// DistinctPlan removes the duplicate rows of the projected result set
+type DistinctPlan struct {
+	baseLogicalPlan
+}
+
+func (p DistinctPlan) Init() *DistinctPlan {
+	p.baseLogicalPlan.self = &p
+	return &p
+}
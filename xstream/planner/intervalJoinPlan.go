@@ -0,0 +1,195 @@
+package planner
+
+import (
+	"github.com/emqx/kuiper/xsql"
+	"math"
+)
+
+// IntervalJoinPlan joins two streams without window. The right stream tuple is joined with the left
+// stream tuple whose timestamp is within [right.ts - upper, right.ts - lower].
+type IntervalJoinPlan struct {
+	baseLogicalPlan
+	from      *xsql.Table
+	to        *xsql.Table
+	join      xsql.Join
+	lower     int64
+	upper     int64
+	leftKeys  []xsql.Expr
+	rightKeys []xsql.Expr
+}
+
+func (p IntervalJoinPlan) Init() *IntervalJoinPlan {
+	p.baseLogicalPlan.self = &p
+	return &p
+}
+
+func (p *IntervalJoinPlan) PushDownPredicate(condition xsql.Expr) (xsql.Expr, LogicalPlan) {
+	a := combine(condition, p.join.Expr)
+	multipleSourcesCondition, singleSourceCondition := extractCondition(a)
+	rest, _ := p.baseLogicalPlan.PushDownPredicate(singleSourceCondition)
+	p.join.Expr = combine(multipleSourcesCondition, rest) //always swallow all conditions
+	return nil, p
+}
+
+func (p *IntervalJoinPlan) PruneColumns(fields []xsql.Expr) error {
+	f := getFields(&p.join)
+	return p.baseLogicalPlan.PruneColumns(append(fields, f...))
+}
+
+// Try to create an interval join plan for the inner join of two streams. The join condition must have both
+// the lower and upper bound of the time difference between the two streams, for example
+// `a.id = b.id AND b.ts >= a.ts - 30s AND b.ts <= a.ts + 30000` or `b.ts BETWEEN a.ts - 30s AND a.ts + 30s`.
+// In event time mode, only the TIMESTAMP fields of the streams are taken as the bounds, the other comparisons are left
+// in the join filter. In processing time mode, the records are matched by the arrival time so any fields can be the
+// bounds. Return nil if it is not an interval join.
+func newIntervalJoinPlan(from *xsql.Table, joins xsql.Joins, streamStmts []*xsql.StreamStmt, isEventTime bool) *IntervalJoinPlan {
+	if len(joins) != 1 || joins[0].JoinType != xsql.INNER_JOIN || joins[0].Expr == nil {
+		return nil
+	}
+	join := joins[0]
+	p := IntervalJoinPlan{
+		from:  from,
+		to:    &xsql.Table{Name: join.Name, Alias: join.Alias},
+		join:  join,
+		lower: math.MinInt64,
+		upper: math.MaxInt64,
+	}.Init()
+	var timestamps map[string]string
+	if isEventTime {
+		timestamps = make(map[string]string)
+		for _, s := range streamStmts {
+			if s.Options != nil && s.Options.TIMESTAMP != "" {
+				timestamps[string(s.Name)] = s.Options.TIMESTAMP
+			}
+		}
+	}
+	for _, cond := range splitConjunction(join.Expr) {
+		be, ok := cond.(*xsql.BinaryExpr)
+		if !ok {
+			continue
+		}
+		switch be.OP {
+		case xsql.EQ:
+			l, lok := be.LHS.(*xsql.FieldRef)
+			r, rok := be.RHS.(*xsql.FieldRef)
+			if lok && rok {
+				if isTable(string(l.StreamName), from) && isTable(string(r.StreamName), p.to) {
+					p.leftKeys = append(p.leftKeys, l)
+					p.rightKeys = append(p.rightKeys, r)
+				} else if isTable(string(r.StreamName), from) && isTable(string(l.StreamName), p.to) {
+					p.leftKeys = append(p.leftKeys, r)
+					p.rightKeys = append(p.rightKeys, l)
+				}
+			}
+		case xsql.LT, xsql.LTE, xsql.GT, xsql.GTE:
+			p.addBound(be.OP, be.LHS, be.RHS, timestamps)
+		case xsql.BETWEEN:
+			if b, ok := be.RHS.(*xsql.BetweenExpr); ok {
+				p.addBound(xsql.GTE, be.LHS, b.Lower, timestamps)
+				p.addBound(xsql.LTE, be.LHS, b.Higher, timestamps)
+			}
+		}
+	}
+	if p.lower == math.MinInt64 || p.upper == math.MaxInt64 || p.lower > p.upper {
+		return nil
+	}
+	return p
+}
+
+// Normalize the condition to `right - left OP c` and update the bound. If the timestamps are set, the fields must be
+// the TIMESTAMP fields of the two streams.
+func (p *IntervalJoinPlan) addBound(op xsql.Token, lhs xsql.Expr, rhs xsql.Expr, timestamps map[string]string) {
+	lf, lc, lok := timeOperand(lhs)
+	rf, rc, rok := timeOperand(rhs)
+	if !lok || !rok {
+		return
+	}
+	if timestamps != nil && (!isTimestampField(lf, p.from, p.to, timestamps) || !isTimestampField(rf, p.from, p.to, timestamps)) {
+		return
+	}
+	ls, rs := string(lf.StreamName), string(rf.StreamName)
+	var c int64
+	if isTable(ls, p.to) && isTable(rs, p.from) {
+		c = rc - lc
+	} else if isTable(ls, p.from) && isTable(rs, p.to) {
+		c = lc - rc
+		switch op {
+		case xsql.LT:
+			op = xsql.GT
+		case xsql.LTE:
+			op = xsql.GTE
+		case xsql.GT:
+			op = xsql.LT
+		case xsql.GTE:
+			op = xsql.LTE
+		}
+	} else {
+		return
+	}
+	switch op {
+	case xsql.GT, xsql.GTE:
+		if c > p.lower {
+			p.lower = c
+		}
+	case xsql.LT, xsql.LTE:
+		if c < p.upper {
+			p.upper = c
+		}
+	}
+}
+
+// Parse the expression in the form of `stream.field [+|- integer]`
+func timeOperand(expr xsql.Expr) (*xsql.FieldRef, int64, bool) {
+	switch e := expr.(type) {
+	case *xsql.FieldRef:
+		return e, 0, true
+	case *xsql.ParenExpr:
+		return timeOperand(e.Expr)
+	case *xsql.BinaryExpr:
+		if e.OP != xsql.ADD && e.OP != xsql.SUB {
+			return nil, 0, false
+		}
+		if f, ok := e.LHS.(*xsql.FieldRef); ok {
+			if c, ok := e.RHS.(*xsql.IntegerLiteral); ok {
+				if e.OP == xsql.SUB {
+					return f, -int64(c.Val), true
+				}
+				return f, int64(c.Val), true
+			}
+		} else if c, ok := e.LHS.(*xsql.IntegerLiteral); ok && e.OP == xsql.ADD {
+			if f, ok := e.RHS.(*xsql.FieldRef); ok {
+				return f, int64(c.Val), true
+			}
+		}
+	}
+	return nil, 0, false
+}
+
+func isTimestampField(f *xsql.FieldRef, from *xsql.Table, to *xsql.Table, timestamps map[string]string) bool {
+	var name string
+	if isTable(string(f.StreamName), from) {
+		name = from.Name
+	} else if isTable(string(f.StreamName), to) {
+		name = to.Name
+	} else {
+		return false
+	}
+	ts, ok := timestamps[name]
+	return ok && ts == f.Name
+}
+
+func splitConjunction(expr xsql.Expr) []xsql.Expr {
+	switch e := expr.(type) {
+	case *xsql.BinaryExpr:
+		if e.OP == xsql.AND {
+			return append(splitConjunction(e.LHS), splitConjunction(e.RHS)...)
+		}
+	case *xsql.ParenExpr:
+		return splitConjunction(e.Expr)
+	}
+	return []xsql.Expr{expr}
+}
+
+func isTable(name string, t *xsql.Table) bool {
+	return name != "" && (name == t.Name || name == t.Alias)
+}
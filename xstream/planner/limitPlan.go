@@ -0,0 +1,14 @@
+package planner
+
+// LimitPlan truncates each projected result set. Together with the order plan, it emits the top N rows of each window
+type LimitPlan struct {
+	baseLogicalPlan
+	limit  int
+	offset int
+	by     []string
+}
+
+func (p LimitPlan) Init() *LimitPlan {
+	p.baseLogicalPlan.self = &p
+	return &p
+}
@@ -0,0 +1,128 @@
+package planner
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/xsql"
+	"strings"
+)
+
+// LookupPlan joins the input with a lookup table by querying the table on demand
+type LookupPlan struct {
+	baseLogicalPlan
+	join       xsql.Join
+	table      *xsql.StreamStmt
+	keys       []string
+	keyExprs   []xsql.Expr
+	fields     []string
+	isWildCard bool
+}
+
+func (p LookupPlan) Init() *LookupPlan {
+	p.baseLogicalPlan.self = &p
+	return &p
+}
+
+// Create the lookup plan by extracting the equal conditions between the lookup table columns and other expressions
+// as the lookup keys. Other join conditions are evaluated after the lookup
+func newLookupPlan(join xsql.Join, table *xsql.StreamStmt) (*LookupPlan, error) {
+	if join.JoinType != xsql.INNER_JOIN && join.JoinType != xsql.LEFT_JOIN {
+		return nil, fmt.Errorf("lookup table %s only supports inner join and left join", join.Name)
+	}
+	p := LookupPlan{
+		join:  join,
+		table: table,
+	}.Init()
+	var rest xsql.Expr
+	if join.Expr != nil {
+		for _, cond := range splitConjunction(join.Expr) {
+			if k, e, ok := p.lookupKey(cond); ok {
+				p.keys = append(p.keys, k)
+				p.keyExprs = append(p.keyExprs, e)
+			} else {
+				rest = combine(rest, cond)
+			}
+		}
+	}
+	if len(p.keys) == 0 {
+		return nil, fmt.Errorf("lookup table %s must be joined with equal conditions on its columns", join.Name)
+	}
+	p.join.Expr = rest
+	return p, nil
+}
+
+// Check if the condition is like `table.col = expr` in which the expr does not refer to the lookup table
+func (p *LookupPlan) lookupKey(cond xsql.Expr) (string, xsql.Expr, bool) {
+	be, ok := cond.(*xsql.BinaryExpr)
+	if !ok || be.OP != xsql.EQ {
+		return "", nil, false
+	}
+	if f, ok := be.LHS.(*xsql.FieldRef); ok && p.isTableField(f) && !p.refersTable(be.RHS) {
+		return f.Name, be.RHS, true
+	}
+	if f, ok := be.RHS.(*xsql.FieldRef); ok && p.isTableField(f) && !p.refersTable(be.LHS) {
+		return f.Name, be.LHS, true
+	}
+	return "", nil, false
+}
+
+func (p *LookupPlan) isTableField(f *xsql.FieldRef) bool {
+	return string(f.StreamName) == string(p.table.Name)
+}
+
+func (p *LookupPlan) refersTable(expr xsql.Expr) bool {
+	for _, s := range getRefSources(expr) {
+		if s == string(p.table.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// The conditions which refer to the lookup table cannot be pushed down. For inner join, they are swallowed as
+// the join condition.
+func (p *LookupPlan) PushDownPredicate(condition xsql.Expr) (xsql.Expr, LogicalPlan) {
+	var unpushable, pushable xsql.Expr
+	if condition != nil {
+		for _, cond := range splitConjunction(condition) {
+			if p.refersTable(cond) {
+				unpushable = combine(unpushable, cond)
+			} else {
+				pushable = combine(pushable, cond)
+			}
+		}
+	}
+	rest, _ := p.baseLogicalPlan.PushDownPredicate(pushable)
+	if p.join.JoinType == xsql.INNER_JOIN {
+		p.join.Expr = combine(p.join.Expr, combine(unpushable, rest))
+		return nil, p
+	}
+	return combine(unpushable, rest), p
+}
+
+func (p *LookupPlan) PruneColumns(fields []xsql.Expr) error {
+	f := append(fields, getFields(&p.join)...)
+	for _, e := range p.keyExprs {
+		f = append(f, getFields(e)...)
+	}
+	var childFields []xsql.Expr
+	set := make(map[string]bool)
+	for _, field := range f {
+		switch t := field.(type) {
+		case *xsql.Wildcard:
+			p.isWildCard = true
+		case *xsql.FieldRef:
+			if p.isTableField(t) {
+				if !set[strings.ToLower(t.Name)] {
+					set[strings.ToLower(t.Name)] = true
+					p.fields = append(p.fields, t.Name)
+				}
+				continue
+			}
+		}
+		childFields = append(childFields, field)
+	}
+	if p.isWildCard {
+		p.fields = nil
+	}
+	return p.baseLogicalPlan.PruneColumns(childFields)
+}
@@ -47,6 +47,10 @@ func PlanWithSourcesAndSinks(rule *api.Rule, storePath string, sources []*nodes.
 	if err != nil {
 		return nil, err
 	}
+	streamsFromStmt, err = getInputs(stmt, store)
+	if err != nil {
+		return nil, err
+	}
 	tp, err := createTopo(rule, lp, sources, sinks, streamsFromStmt)
 	if err != nil {
 		return nil, err
@@ -54,29 +58,96 @@ func PlanWithSourcesAndSinks(rule *api.Rule, storePath string, sources []*nodes.
 	return tp, nil
 }
 
+// Get the names of the direct inputs of the statement. The subqueries are named by their aliases. Lookup tables have
+// no source node, so they are not the input of the nodes
+func getInputs(stmt *xsql.SelectStatement, store kv.KeyValue) ([]string, error) {
+	var result []string
+	for _, name := range getSourceNames(stmt) {
+		if _, ok := getSubQuery(stmt, name); ok {
+			result = append(result, name)
+			continue
+		}
+		streams, err := excludeLookupTables([]string{name}, store)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, streams...)
+	}
+	return result, nil
+}
+
+// Get the names of the sources and joins of the statement without going into the subqueries
+func getSourceNames(stmt *xsql.SelectStatement) (result []string) {
+	for _, source := range stmt.Sources {
+		switch s := source.(type) {
+		case *xsql.Table:
+			result = append(result, s.Name)
+		case *xsql.SubQuery:
+			result = append(result, s.Alias)
+		}
+	}
+	for _, join := range stmt.Joins {
+		result = append(result, join.Name)
+	}
+	return
+}
+
+func getSubQuery(stmt *xsql.SelectStatement, name string) (*xsql.SubQuery, bool) {
+	for _, source := range stmt.Sources {
+		if sq, ok := source.(*xsql.SubQuery); ok && sq.Alias == name {
+			return sq, true
+		}
+	}
+	return nil, false
+}
+
+func excludeLookupTables(streams []string, store kv.KeyValue) ([]string, error) {
+	var result []string
+	for _, s := range streams {
+		streamStmt, err := xsql.GetDataSource(store, s)
+		if err != nil {
+			return nil, fmt.Errorf("fail to get stream %s, please check if stream is created", s)
+		}
+		if !streamStmt.IsLookupTable() {
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
+
 type aliasInfo struct {
 	alias       xsql.Field
 	refSources  []string
 	isAggregate bool
+	// The analytic alias is evaluated in the project for the rows which pass the WHERE clause
+	isAnalytic bool
 }
 
 // Analyze the select statement by decorating the info from stream statement.
 // Typically, set the correct stream name for fieldRefs
 func decorateStmt(s *xsql.SelectStatement, store kv.KeyValue) ([]*xsql.StreamStmt, map[string]*aliasInfo, error) {
-	streamsFromStmt := xsql.GetStreams(s)
+	streamsFromStmt := getSourceNames(s)
 	streamStmts := make([]*xsql.StreamStmt, len(streamsFromStmt))
 	aliasSourceMap := make(map[string]*aliasInfo)
 	isSchemaless := false
-	for i, s := range streamsFromStmt {
-		streamStmt, err := xsql.GetDataSource(store, s)
+	for i, name := range streamsFromStmt {
+		// The result of a subquery is regarded as a schemaless stream
+		if _, ok := getSubQuery(s, name); ok {
+			streamStmts[i] = &xsql.StreamStmt{Name: xsql.StreamName(name), StreamType: xsql.TypeStream}
+			isSchemaless = true
+			continue
+		}
+		streamStmt, err := xsql.GetDataSource(store, name)
 		if err != nil {
-			return nil, nil, fmt.Errorf("fail to get stream %s, please check if stream is created", s)
+			return nil, nil, fmt.Errorf("fail to get stream %s, please check if stream is created", name)
 		}
 		streamStmts[i] = streamStmt
 		if streamStmt.StreamFields == nil {
 			isSchemaless = true
 		}
 	}
+	// The streams in FROM clause are the union of them, so the fields are not bound to a specific stream
+	isUnion := len(s.Sources) > 1
 	var walkErr error
 	for _, f := range s.Fields {
 		if f.AName != "" {
@@ -87,7 +158,7 @@ func decorateStmt(s *xsql.SelectStatement, store kv.KeyValue) ([]*xsql.StreamStm
 			xsql.WalkFunc(f.Expr, func(n xsql.Node) {
 				switch expr := n.(type) {
 				case *xsql.FieldRef:
-					err := updateFieldRefStream(expr, streamStmts, isSchemaless)
+					err := updateFieldRefStream(expr, streamStmts, isSchemaless, isUnion)
 					if err != nil {
 						walkErr = err
 						return
@@ -110,9 +181,13 @@ func decorateStmt(s *xsql.SelectStatement, store kv.KeyValue) ([]*xsql.StreamStm
 				alias:       f,
 				refSources:  refStreamKeys,
 				isAggregate: xsql.HasAggFuncs(f.Expr),
+				isAnalytic:  xsql.HasAnalyticFuncs(f.Expr),
 			}
 		}
 	}
+	if err := validateAnalyticAlias(s, aliasSourceMap); err != nil {
+		return nil, nil, err
+	}
 	// Select fields are visited firstly to make sure all aliases have streamName set
 	xsql.WalkFunc(s, func(n xsql.Node) {
 		//skip alias field
@@ -138,7 +213,7 @@ func decorateStmt(s *xsql.SelectStatement, store kv.KeyValue) ([]*xsql.StreamStm
 
 				}
 			}
-			err := updateFieldRefStream(f, streamStmts, isSchemaless)
+			err := updateFieldRefStream(f, streamStmts, isSchemaless, isUnion)
 			if err != nil {
 				walkErr = err
 			}
@@ -147,12 +222,55 @@ func decorateStmt(s *xsql.SelectStatement, store kv.KeyValue) ([]*xsql.StreamStm
 	return streamStmts, aliasSourceMap, walkErr
 }
 
-func updateFieldRefStream(f *xsql.FieldRef, streamStmts []*xsql.StreamStmt, isSchemaless bool) (err error) {
+// The analytic alias is only evaluated in the project, so it cannot be referred by the other clauses
+func validateAnalyticAlias(s *xsql.SelectStatement, aliasMap map[string]*aliasInfo) error {
+	var err error
+	for _, node := range []xsql.Node{s.Condition, s.Dimensions, s.Having, s.SortFields} {
+		if node == nil {
+			continue
+		}
+		xsql.WalkFunc(node, func(n xsql.Node) {
+			if f, ok := n.(*xsql.FieldRef); ok && f.StreamName == xsql.DEFAULT_STREAM {
+				if ainfo, ok := aliasMap[strings.ToLower(f.Name)]; ok && ainfo.isAnalytic {
+					err = fmt.Errorf("alias %s of the analytic function can only be used in the select fields", f.Name)
+				}
+			}
+		})
+	}
+	return err
+}
+
+// The LIMIT BY columns group the projected rows, so they must be the output names of the select fields
+func validateLimitBy(s *xsql.SelectStatement) error {
+	names := make(map[string]bool)
+	for _, f := range s.Fields {
+		if _, ok := f.Expr.(*xsql.Wildcard); ok {
+			return nil
+		}
+		if f.AName != "" {
+			names[f.AName] = true
+		} else {
+			names[f.Name] = true
+		}
+	}
+	for _, col := range s.Limit.By {
+		if !names[col] {
+			return fmt.Errorf("column %s of LIMIT BY must be one of the select fields", col)
+		}
+	}
+	return nil
+}
+
+func updateFieldRefStream(f *xsql.FieldRef, streamStmts []*xsql.StreamStmt, isSchemaless bool, isUnion bool) (err error) {
 	count := 0
 	for _, streamStmt := range streamStmts {
 		for _, field := range streamStmt.StreamFields {
 			if strings.EqualFold(f.Name, field.Name) {
 				if f.StreamName == xsql.DEFAULT_STREAM {
+					if isUnion {
+						// The field of the union can be from any stream
+						return nil
+					}
 					f.StreamName = streamStmt.Name
 					count++
 				} else if f.StreamName == streamStmt.Name {
@@ -181,7 +299,8 @@ func createTopo(rule *api.Rule, lp LogicalPlan, sources []*nodes.SourceNode, sin
 		return nil, err
 	}
 
-	input, _, err := buildOps(lp, tp, rule.Options, sources, streamsFromStmt, 0)
+	var lateOutputs []api.Emitter
+	input, _, err := buildOps(lp, tp, rule.Options, sources, streamsFromStmt, 0, &lateOutputs)
 	if err != nil {
 		return nil, err
 	}
@@ -189,7 +308,11 @@ func createTopo(rule *api.Rule, lp LogicalPlan, sources []*nodes.SourceNode, sin
 	// Add actions
 	if len(sinks) > 0 { // For use of mock sink in testing
 		for _, sink := range sinks {
-			tp.AddSink(inputs, sink)
+			sinkInputs, err := getSinkInputs(sink.GetName(), sink.GetOptions(), inputs, lateOutputs)
+			if err != nil {
+				return nil, err
+			}
+			tp.AddSink(sinkInputs, sink)
 		}
 	} else {
 		for i, m := range rule.Actions {
@@ -198,7 +321,16 @@ func createTopo(rule *api.Rule, lp LogicalPlan, sources []*nodes.SourceNode, sin
 				if !ok {
 					return nil, fmt.Errorf("expect map[string]interface{} type for the action properties, but found %v", action)
 				}
-				tp.AddSink(inputs, nodes.NewSinkNode(fmt.Sprintf("%s_%d", name, i), name, props))
+				sinkInputs, err := getSinkInputs(name, props, inputs, lateOutputs)
+				if err != nil {
+					return nil, err
+				}
+				if rule.Options.Qos == api.ExactlyOnce {
+					if err := nodes.ValidateExactlyOnce(name, props); err != nil {
+						return nil, err
+					}
+				}
+				tp.AddSink(sinkInputs, nodes.NewSinkNode(fmt.Sprintf("%s_%d", name, i), name, props))
 			}
 		}
 	}
@@ -206,11 +338,34 @@ func createTopo(rule *api.Rule, lp LogicalPlan, sources []*nodes.SourceNode, sin
 	return tp, nil
 }
 
-func buildOps(lp LogicalPlan, tp *xstream.TopologyNew, options *api.RuleOption, sources []*nodes.SourceNode, streamsFromStmt []string, index int) (api.Emitter, int, error) {
+// The action consumes the side output instead of the rule result if the sideOutput property is set
+func getSinkInputs(name string, props map[string]interface{}, inputs []api.Emitter, lateOutputs []api.Emitter) ([]api.Emitter, error) {
+	so, ok := props["sideOutput"]
+	if !ok {
+		return inputs, nil
+	}
+	if so != "late" {
+		return nil, fmt.Errorf("invalid sideOutput %v of action %s, only late is supported", so, name)
+	}
+	switch len(lateOutputs) {
+	case 0:
+		return nil, fmt.Errorf("the late side output of action %s requires an event time window", name)
+	case 1:
+		return lateOutputs, nil
+	default:
+		return nil, fmt.Errorf("the late side output of action %s is ambiguous as the rule has %d event time windows", name, len(lateOutputs))
+	}
+}
+
+func buildOps(lp LogicalPlan, tp *xstream.TopologyNew, options *api.RuleOption, sources []*nodes.SourceNode, streamsFromStmt []string, index int, lateOutputs *[]api.Emitter) (api.Emitter, int, error) {
 	var inputs []api.Emitter
 	newIndex := index
+	childStreams := streamsFromStmt
+	if sq, ok := lp.(*SubQueryPlan); ok {
+		childStreams = sq.streams
+	}
 	for _, c := range lp.Children() {
-		input, ni, err := buildOps(c, tp, options, sources, streamsFromStmt, newIndex)
+		input, ni, err := buildOps(c, tp, options, sources, childStreams, newIndex, lateOutputs)
 		if err != nil {
 			return nil, 0, err
 		}
@@ -259,6 +414,15 @@ func buildOps(lp LogicalPlan, tp *xstream.TopologyNew, options *api.RuleOption,
 			op = Transform(pp, fmt.Sprintf("%d_tableprocessor_%s", newIndex, t.name), options)
 			inputs = []api.Emitter{srcNode}
 		}
+	case *SubQueryPlan:
+		sqNode := nodes.NewSubQueryNode(fmt.Sprintf("%d_subquery_%s", newIndex, t.name), t.name, options)
+		tp.AddOperator(inputs, sqNode)
+		pp, err := operators.NewPreprocessor(nil, t.alias, false, nil, false, "", "", false)
+		if err != nil {
+			return nil, 0, err
+		}
+		op = Transform(pp, fmt.Sprintf("%d_preprocessor_%s", newIndex, t.name), options)
+		inputs = []api.Emitter{sqNode}
 	case *WindowPlan:
 		if t.condition != nil {
 			wfilterOp := Transform(&operators.FilterOp{Condition: t.condition}, fmt.Sprintf("%d_windowFilter", newIndex), options)
@@ -267,16 +431,34 @@ func buildOps(lp LogicalPlan, tp *xstream.TopologyNew, options *api.RuleOption,
 			inputs = []api.Emitter{wfilterOp}
 		}
 
-		op, err = nodes.NewWindowOp(fmt.Sprintf("%d_window", newIndex), nodes.WindowConfig{
-			Type:     t.wtype,
-			Length:   t.length,
-			Interval: t.interval,
+		var wop *nodes.WindowOperator
+		wop, err = nodes.NewWindowOp(fmt.Sprintf("%d_window", newIndex), nodes.WindowConfig{
+			Type:       t.wtype,
+			Length:     t.length,
+			Interval:   t.interval,
+			Partition:  t.partition,
+			Aggregates: t.aggregates,
+			Dimensions: t.dimensions,
 		}, streamsFromStmt, options)
 		if err != nil {
 			return nil, 0, err
 		}
+		if options.IsEventTime {
+			*lateOutputs = append(*lateOutputs, wop.GetLateOutput())
+		}
+		op = wop
 	case *JoinAlignPlan:
 		op, err = nodes.NewJoinAlignNode(fmt.Sprintf("%d_join_aligner", newIndex), t.Emitters, options)
+	case *IntervalJoinPlan:
+		op, err = nodes.NewIntervalJoinNode(fmt.Sprintf("%d_interval_join", newIndex), t.from.Name, t.join.Name, t.join, t.lower, t.upper, t.leftKeys, t.rightKeys, streamsFromStmt, options)
+		if err != nil {
+			return nil, 0, err
+		}
+	case *LookupPlan:
+		op, err = nodes.NewLookupNode(fmt.Sprintf("%d_lookup_%s", newIndex, t.join.Name), t.fields, t.keys, t.keyExprs, t.join, t.table.Options.TYPE, t.table.Options, options)
+		if err != nil {
+			return nil, 0, err
+		}
 	case *JoinPlan:
 		op = Transform(&operators.JoinOp{Joins: t.joins, From: t.from}, fmt.Sprintf("%d_join", newIndex), options)
 	case *FilterPlan:
@@ -289,6 +471,12 @@ func buildOps(lp LogicalPlan, tp *xstream.TopologyNew, options *api.RuleOption,
 		op = Transform(&operators.OrderOp{SortFields: t.SortFields}, fmt.Sprintf("%d_order", newIndex), options)
 	case *ProjectPlan:
 		op = Transform(&operators.ProjectOp{Fields: t.fields, IsAggregate: t.isAggregate, SendMeta: t.sendMeta}, fmt.Sprintf("%d_project", newIndex), options)
+	case *UnionPlan:
+		op = Transform(&operators.UnionOp{}, fmt.Sprintf("%d_union", newIndex), options)
+	case *DistinctPlan:
+		op = Transform(&operators.DistinctOp{}, fmt.Sprintf("%d_distinct", newIndex), options)
+	case *LimitPlan:
+		op = Transform(&operators.LimitOp{Limit: t.limit, Offset: t.offset, By: t.by}, fmt.Sprintf("%d_limit", newIndex), options)
 	default:
 		return nil, 0, fmt.Errorf("unknown logical plan %v", t)
 	}
@@ -317,6 +505,7 @@ func createLogicalPlan(stmt *xsql.SelectStatement, opt *api.RuleOption, store kv
 		// If there are tables, the plan graph will be different for join/window
 		tableChildren []LogicalPlan
 		tableEmitters []string
+		lookupTables  = make(map[string]*xsql.StreamStmt)
 		w             *xsql.Window
 		ds            xsql.Dimensions
 	)
@@ -327,12 +516,44 @@ func createLogicalPlan(stmt *xsql.SelectStatement, opt *api.RuleOption, store kv
 	}
 
 	for i, streamStmt := range streamStmts {
+		if sq, ok := getSubQuery(stmt, string(streamStmt.Name)); ok {
+			if opt.IsEventTime {
+				return nil, fmt.Errorf("subquery %s is not supported in event time rule", sq.Alias)
+			}
+			sp, err := createLogicalPlan(sq.Stmt, opt, store)
+			if err != nil {
+				return nil, err
+			}
+			streams, err := getInputs(sq.Stmt, store)
+			if err != nil {
+				return nil, err
+			}
+			p = SubQueryPlan{
+				name:    sq.Alias,
+				alias:   aliasFieldsForSource(aliasMap, streamStmt.Name, i == 0),
+				streams: streams,
+			}.Init()
+			p.SetChildren([]LogicalPlan{sp})
+			children = append(children, p)
+			continue
+		}
+		if len(stmt.Sources) > 1 && streamStmt.StreamType != xsql.TypeStream {
+			return nil, fmt.Errorf("table %s cannot be used in the union of sources", streamStmt.Name)
+		}
+		if streamStmt.IsLookupTable() {
+			if i == 0 {
+				return nil, fmt.Errorf("lookup table %s can only be used in join", streamStmt.Name)
+			}
+			lookupTables[string(streamStmt.Name)] = streamStmt
+			continue
+		}
 		p = DataSourcePlan{
 			name:       string(streamStmt.Name),
 			streamStmt: streamStmt,
 			iet:        opt.IsEventTime,
-			alias:      aliasFieldsForSource(aliasMap, streamStmt.Name, i == 0),
-			allMeta:    opt.SendMetaToSink,
+			// Each stream of the union must evaluate all the aliases as any of them can be the input of a row
+			alias:   aliasFieldsForSource(aliasMap, streamStmt.Name, i == 0 || len(stmt.Sources) > 1),
+			allMeta: opt.SendMetaToSink,
 		}.Init()
 		if streamStmt.StreamType == xsql.TypeStream {
 			children = append(children, p)
@@ -362,30 +583,69 @@ func createLogicalPlan(stmt *xsql.SelectStatement, opt *api.RuleOption, store kv
 			if w.Filter != nil {
 				wp.condition = w.Filter
 			}
+			wp.partition = w.Partition
+			if aggregates := getIncrementalAggregates(stmt, w, opt); len(aggregates) > 0 {
+				wp.aggregates = aggregates
+				wp.dimensions = dimensions.GetGroups()
+			}
 			// TODO calculate limit
-			// TODO incremental aggregate
 			wp.SetChildren(children)
 			children = []LogicalPlan{wp}
 			p = wp
 		}
 	}
+	if len(stmt.Sources) > 1 {
+		p = UnionPlan{}.Init()
+		p.SetChildren(children)
+		children = []LogicalPlan{p}
+	}
 	if stmt.Joins != nil {
-		if len(tableChildren) > 0 {
-			p = JoinAlignPlan{
-				Emitters: tableEmitters,
-			}.Init()
-			p.SetChildren(append(children, tableChildren...))
+		var joins, lookupJoins xsql.Joins
+		for _, j := range stmt.Joins {
+			if _, ok := lookupTables[j.Name]; ok {
+				lookupJoins = append(lookupJoins, j)
+			} else {
+				joins = append(joins, j)
+			}
+		}
+		if len(joins) > 0 {
+			if len(tableChildren) > 0 {
+				p = JoinAlignPlan{
+					Emitters: tableEmitters,
+				}.Init()
+				p.SetChildren(append(children, tableChildren...))
+				children = []LogicalPlan{p}
+			}
+			if len(tableChildren) == 0 && w == nil {
+				// Without window, two streams can only be joined by the time interval
+				ip := newIntervalJoinPlan(stmt.Sources[0].(*xsql.Table), joins, streamStmts, opt.IsEventTime)
+				if ip == nil {
+					if opt.IsEventTime {
+						return nil, errors.New("need to run stream join in windows or with a time interval condition on the TIMESTAMP fields")
+					}
+					return nil, errors.New("need to run stream join in windows or with a time interval condition")
+				}
+				p = ip
+			} else {
+				// TODO extract on filter
+				p = JoinPlan{
+					from:  stmt.Sources[0].(*xsql.Table),
+					joins: joins,
+				}.Init()
+			}
+			p.SetChildren(children)
 			children = []LogicalPlan{p}
-		} else if w == nil {
-			return nil, errors.New("need to run stream join in windows")
 		}
-		// TODO extract on filter
-		p = JoinPlan{
-			from:  stmt.Sources[0].(*xsql.Table),
-			joins: stmt.Joins,
-		}.Init()
-		p.SetChildren(children)
-		children = []LogicalPlan{p}
+		// Lookup tables are joined after all the other sources
+		for _, j := range lookupJoins {
+			lp, err := newLookupPlan(j, lookupTables[j.Name])
+			if err != nil {
+				return nil, err
+			}
+			lp.SetChildren(children)
+			children = []LogicalPlan{lp}
+			p = lp
+		}
 	}
 	if stmt.Condition != nil {
 		p = FilterPlan{
@@ -430,6 +690,25 @@ func createLogicalPlan(stmt *xsql.SelectStatement, opt *api.RuleOption, store kv
 			sendMeta:    opt.SendMetaToSink,
 		}.Init()
 		p.SetChildren(children)
+		children = []LogicalPlan{p}
+	}
+
+	if stmt.Distinct {
+		p = DistinctPlan{}.Init()
+		p.SetChildren(children)
+		children = []LogicalPlan{p}
+	}
+
+	if stmt.Limit != nil {
+		if err := validateLimitBy(stmt); err != nil {
+			return nil, err
+		}
+		p = LimitPlan{
+			limit:  stmt.Limit.Count,
+			offset: stmt.Limit.Offset,
+			by:     stmt.Limit.By,
+		}.Init()
+		p.SetChildren(children)
 	}
 
 	return optimize(p)
@@ -437,7 +716,7 @@ func createLogicalPlan(stmt *xsql.SelectStatement, opt *api.RuleOption, store kv
 
 func aliasFieldsForSource(aliasMap map[string]*aliasInfo, name xsql.StreamName, isFirst bool) (result xsql.Fields) {
 	for _, ainfo := range aliasMap {
-		if ainfo.isAggregate {
+		if ainfo.isAggregate || ainfo.isAnalytic {
 			continue
 		}
 		switch len(ainfo.refSources) {
@@ -446,7 +725,8 @@ func aliasFieldsForSource(aliasMap map[string]*aliasInfo, name xsql.StreamName,
 				result = append(result, ainfo.alias)
 			}
 		case 1:
-			if strings.EqualFold(ainfo.refSources[0], string(name)) {
+			// The alias of the union or schemaless fields is not bound to a stream, so it is evaluated in all streams
+			if strings.EqualFold(ainfo.refSources[0], string(name)) || ainfo.refSources[0] == xsql.DEFAULT_STREAM {
 				result = append(result, ainfo.alias)
 			}
 		}
@@ -458,6 +738,9 @@ func aliasFieldsForSource(aliasMap map[string]*aliasInfo, name xsql.StreamName,
 
 func complexAlias(aliasMap map[string]*aliasInfo) (aggregateAlias xsql.Fields, joinAlias xsql.Fields) {
 	for _, ainfo := range aliasMap {
+		if ainfo.isAnalytic {
+			continue
+		}
 		if ainfo.isAggregate {
 			aggregateAlias = append(aggregateAlias, ainfo.alias)
 			continue
@@ -31,22 +31,28 @@ func Test_createLogicalPlan(t *testing.T) {
 					id1 BIGINT,
 					temp BIGINT,
 					name string
-				) WITH (DATASOURCE="src1", FORMAT="json", KEY="ts");`,
+				) WITH (DATASOURCE="src1", FORMAT="json", KEY="ts", TIMESTAMP="temp");`,
 		"src2": `CREATE STREAM src2 (
 					id2 BIGINT,
 					hum BIGINT
-				) WITH (DATASOURCE="src2", FORMAT="json", KEY="ts");`,
+				) WITH (DATASOURCE="src2", FORMAT="json", KEY="ts", TIMESTAMP="hum");`,
 		"tableInPlanner": `CREATE TABLE tableInPlanner (
 					id BIGINT,
 					name STRING,
 					value STRING,
 					hum BIGINT
 				) WITH (TYPE="file");`,
+		"lookupInPlanner": `CREATE TABLE lookupInPlanner (
+					id BIGINT,
+					name STRING,
+					city STRING
+				) WITH (DATASOURCE="users", TYPE="sql", KIND="lookup");`,
 	}
 	types := map[string]xsql.StreamType{
-		"src1":           xsql.TypeStream,
-		"src2":           xsql.TypeStream,
-		"tableInPlanner": xsql.TypeTable,
+		"src1":            xsql.TypeStream,
+		"src2":            xsql.TypeStream,
+		"tableInPlanner":  xsql.TypeTable,
+		"lookupInPlanner": xsql.TypeTable,
 	}
 	for name, sql := range streamSqls {
 		s, err := json.Marshal(&xsql.StreamInfo{
@@ -1013,6 +1019,559 @@ func Test_createLogicalPlan(t *testing.T) {
 				isAggregate: false,
 				sendMeta:    false,
 			}.Init(),
+		}, { // 12 interval join without window
+			sql: `SELECT id1 FROM src1 INNER JOIN src2 on src1.id1 = src2.id2 AND src2.hum >= src1.temp - 1000 AND src2.hum <= src1.temp + 3000 AND src1.temp > 20`,
+			p: ProjectPlan{
+				baseLogicalPlan: baseLogicalPlan{
+					children: []LogicalPlan{
+						IntervalJoinPlan{
+							baseLogicalPlan: baseLogicalPlan{
+								children: []LogicalPlan{
+									FilterPlan{
+										baseLogicalPlan: baseLogicalPlan{
+											children: []LogicalPlan{
+												DataSourcePlan{
+													name: "src1",
+													streamFields: []interface{}{
+														&xsql.StreamField{
+															Name:      "id1",
+															FieldType: &xsql.BasicType{Type: xsql.BIGINT},
+														},
+														&xsql.StreamField{
+															Name:      "temp",
+															FieldType: &xsql.BasicType{Type: xsql.BIGINT},
+														},
+													},
+													streamStmt: streams["src1"],
+													metaFields: []string{},
+												}.Init(),
+											},
+										},
+										condition: &xsql.BinaryExpr{
+											OP:  xsql.GT,
+											LHS: &xsql.FieldRef{Name: "temp", StreamName: "src1"},
+											RHS: &xsql.IntegerLiteral{Val: 20},
+										},
+									}.Init(),
+									DataSourcePlan{
+										name: "src2",
+										streamFields: []interface{}{
+											&xsql.StreamField{
+												Name:      "hum",
+												FieldType: &xsql.BasicType{Type: xsql.BIGINT},
+											},
+											&xsql.StreamField{
+												Name:      "id2",
+												FieldType: &xsql.BasicType{Type: xsql.BIGINT},
+											},
+										},
+										streamStmt: streams["src2"],
+										metaFields: []string{},
+									}.Init(),
+								},
+							},
+							from: &xsql.Table{Name: "src1"},
+							to:   &xsql.Table{Name: "src2"},
+							join: xsql.Join{
+								Name:     "src2",
+								JoinType: xsql.INNER_JOIN,
+								Expr: &xsql.BinaryExpr{
+									OP: xsql.AND,
+									LHS: &xsql.BinaryExpr{
+										OP: xsql.AND,
+										LHS: &xsql.BinaryExpr{
+											OP:  xsql.EQ,
+											LHS: &xsql.FieldRef{Name: "id1", StreamName: "src1"},
+											RHS: &xsql.FieldRef{Name: "id2", StreamName: "src2"},
+										},
+										RHS: &xsql.BinaryExpr{
+											OP:  xsql.GTE,
+											LHS: &xsql.FieldRef{Name: "hum", StreamName: "src2"},
+											RHS: &xsql.BinaryExpr{
+												OP:  xsql.SUB,
+												LHS: &xsql.FieldRef{Name: "temp", StreamName: "src1"},
+												RHS: &xsql.IntegerLiteral{Val: 1000},
+											},
+										},
+									},
+									RHS: &xsql.BinaryExpr{
+										OP:  xsql.LTE,
+										LHS: &xsql.FieldRef{Name: "hum", StreamName: "src2"},
+										RHS: &xsql.BinaryExpr{
+											OP:  xsql.ADD,
+											LHS: &xsql.FieldRef{Name: "temp", StreamName: "src1"},
+											RHS: &xsql.IntegerLiteral{Val: 3000},
+										},
+									},
+								},
+							},
+							lower:     -1000,
+							upper:     3000,
+							leftKeys:  []xsql.Expr{&xsql.FieldRef{Name: "id1", StreamName: "src1"}},
+							rightKeys: []xsql.Expr{&xsql.FieldRef{Name: "id2", StreamName: "src2"}},
+						}.Init(),
+					},
+				},
+				fields: []xsql.Field{
+					{
+						Expr:  &xsql.FieldRef{Name: "id1", StreamName: "src1"},
+						Name:  "id1",
+						AName: "",
+					},
+				},
+				isAggregate: false,
+				sendMeta:    false,
+			}.Init(),
+		}, { // 13 stream join without window or interval
+			sql: `SELECT id1 FROM src1 INNER JOIN src2 on src1.id1 = src2.id2 AND src2.hum >= src1.temp - 1000`,
+			p:   nil,
+			err: "need to run stream join in windows or with a time interval condition",
+		}, { // 14 lookup table join
+			sql: `SELECT src1.name, lookupInPlanner.city FROM src1 INNER JOIN lookupInPlanner ON src1.id1 = lookupInPlanner.id WHERE lookupInPlanner.city = "sz" AND src1.temp > 20`,
+			p: ProjectPlan{
+				baseLogicalPlan: baseLogicalPlan{
+					children: []LogicalPlan{
+						LookupPlan{
+							baseLogicalPlan: baseLogicalPlan{
+								children: []LogicalPlan{
+									FilterPlan{
+										baseLogicalPlan: baseLogicalPlan{
+											children: []LogicalPlan{
+												DataSourcePlan{
+													name: "src1",
+													streamFields: []interface{}{
+														&xsql.StreamField{
+															Name:      "id1",
+															FieldType: &xsql.BasicType{Type: xsql.BIGINT},
+														},
+														&xsql.StreamField{
+															Name:      "name",
+															FieldType: &xsql.BasicType{Type: xsql.STRINGS},
+														},
+														&xsql.StreamField{
+															Name:      "temp",
+															FieldType: &xsql.BasicType{Type: xsql.BIGINT},
+														},
+													},
+													streamStmt: streams["src1"],
+													metaFields: []string{},
+												}.Init(),
+											},
+										},
+										condition: &xsql.BinaryExpr{
+											OP:  xsql.GT,
+											LHS: &xsql.FieldRef{Name: "temp", StreamName: "src1"},
+											RHS: &xsql.IntegerLiteral{Val: 20},
+										},
+									}.Init(),
+								},
+							},
+							join: xsql.Join{
+								Name:     "lookupInPlanner",
+								JoinType: xsql.INNER_JOIN,
+								Expr: &xsql.BinaryExpr{
+									OP:  xsql.EQ,
+									LHS: &xsql.FieldRef{Name: "city", StreamName: "lookupInPlanner"},
+									RHS: &xsql.StringLiteral{Val: "sz"},
+								},
+							},
+							table:    streams["lookupInPlanner"],
+							keys:     []string{"id"},
+							keyExprs: []xsql.Expr{&xsql.FieldRef{Name: "id1", StreamName: "src1"}},
+							fields:   []string{"city"},
+						}.Init(),
+					},
+				},
+				fields: []xsql.Field{
+					{
+						Expr:  &xsql.FieldRef{Name: "name", StreamName: "src1"},
+						Name:  "name",
+						AName: "",
+					}, {
+						Expr:  &xsql.FieldRef{Name: "city", StreamName: "lookupInPlanner"},
+						Name:  "city",
+						AName: "",
+					},
+				},
+				isAggregate: false,
+				sendMeta:    false,
+			}.Init(),
+		}, { // 15 lookup table without key condition
+			sql: `SELECT src1.name FROM src1 INNER JOIN lookupInPlanner ON src1.id1 > lookupInPlanner.id`,
+			p:   nil,
+			err: "lookup table lookupInPlanner must be joined with equal conditions on its columns",
+		}, { // 16 lookup table as the main source
+			sql: `SELECT id FROM lookupInPlanner`,
+			p:   nil,
+			err: "lookup table lookupInPlanner can only be used in join",
+		}, { // 17 interval join with between condition
+			sql: `SELECT id1 FROM src1 INNER JOIN src2 on src1.id1 = src2.id2 AND src2.hum BETWEEN src1.temp - 1s AND src1.temp + 3s WHERE src1.temp IN (20, 30)`,
+			p: ProjectPlan{
+				baseLogicalPlan: baseLogicalPlan{
+					children: []LogicalPlan{
+						IntervalJoinPlan{
+							baseLogicalPlan: baseLogicalPlan{
+								children: []LogicalPlan{
+									FilterPlan{
+										baseLogicalPlan: baseLogicalPlan{
+											children: []LogicalPlan{
+												DataSourcePlan{
+													name: "src1",
+													streamFields: []interface{}{
+														&xsql.StreamField{
+															Name:      "id1",
+															FieldType: &xsql.BasicType{Type: xsql.BIGINT},
+														},
+														&xsql.StreamField{
+															Name:      "temp",
+															FieldType: &xsql.BasicType{Type: xsql.BIGINT},
+														},
+													},
+													streamStmt: streams["src1"],
+													metaFields: []string{},
+												}.Init(),
+											},
+										},
+										condition: &xsql.BinaryExpr{
+											OP:  xsql.IN,
+											LHS: &xsql.FieldRef{Name: "temp", StreamName: "src1"},
+											RHS: &xsql.ValueSetExpr{LiteralExprs: []xsql.Expr{&xsql.IntegerLiteral{Val: 20}, &xsql.IntegerLiteral{Val: 30}}},
+										},
+									}.Init(),
+									DataSourcePlan{
+										name: "src2",
+										streamFields: []interface{}{
+											&xsql.StreamField{
+												Name:      "hum",
+												FieldType: &xsql.BasicType{Type: xsql.BIGINT},
+											},
+											&xsql.StreamField{
+												Name:      "id2",
+												FieldType: &xsql.BasicType{Type: xsql.BIGINT},
+											},
+										},
+										streamStmt: streams["src2"],
+										metaFields: []string{},
+									}.Init(),
+								},
+							},
+							from: &xsql.Table{Name: "src1"},
+							to:   &xsql.Table{Name: "src2"},
+							join: xsql.Join{
+								Name:     "src2",
+								JoinType: xsql.INNER_JOIN,
+								Expr: &xsql.BinaryExpr{
+									OP: xsql.AND,
+									LHS: &xsql.BinaryExpr{
+										OP:  xsql.EQ,
+										LHS: &xsql.FieldRef{Name: "id1", StreamName: "src1"},
+										RHS: &xsql.FieldRef{Name: "id2", StreamName: "src2"},
+									},
+									RHS: &xsql.BinaryExpr{
+										OP:  xsql.BETWEEN,
+										LHS: &xsql.FieldRef{Name: "hum", StreamName: "src2"},
+										RHS: &xsql.BetweenExpr{
+											Lower: &xsql.BinaryExpr{
+												OP:  xsql.SUB,
+												LHS: &xsql.FieldRef{Name: "temp", StreamName: "src1"},
+												RHS: &xsql.IntegerLiteral{Val: 1000},
+											},
+											Higher: &xsql.BinaryExpr{
+												OP:  xsql.ADD,
+												LHS: &xsql.FieldRef{Name: "temp", StreamName: "src1"},
+												RHS: &xsql.IntegerLiteral{Val: 3000},
+											},
+										},
+									},
+								},
+							},
+							lower:     -1000,
+							upper:     3000,
+							leftKeys:  []xsql.Expr{&xsql.FieldRef{Name: "id1", StreamName: "src1"}},
+							rightKeys: []xsql.Expr{&xsql.FieldRef{Name: "id2", StreamName: "src2"}},
+						}.Init(),
+					},
+				},
+				fields: []xsql.Field{
+					{
+						Expr:  &xsql.FieldRef{Name: "id1", StreamName: "src1"},
+						Name:  "id1",
+						AName: "",
+					},
+				},
+				isAggregate: false,
+				sendMeta:    false,
+			}.Init(),
+		}, { // 18 distinct and limit
+			sql: `SELECT DISTINCT name FROM src1 GROUP BY TUMBLINGWINDOW(ss, 10) LIMIT 3 OFFSET 1`,
+			p: LimitPlan{
+				baseLogicalPlan: baseLogicalPlan{
+					children: []LogicalPlan{
+						DistinctPlan{
+							baseLogicalPlan: baseLogicalPlan{
+								children: []LogicalPlan{
+									ProjectPlan{
+										baseLogicalPlan: baseLogicalPlan{
+											children: []LogicalPlan{
+												WindowPlan{
+													baseLogicalPlan: baseLogicalPlan{
+														children: []LogicalPlan{
+															DataSourcePlan{
+																name: "src1",
+																streamFields: []interface{}{
+																	&xsql.StreamField{
+																		Name:      "name",
+																		FieldType: &xsql.BasicType{Type: xsql.STRINGS},
+																	},
+																},
+																streamStmt: streams["src1"],
+																metaFields: []string{},
+															}.Init(),
+														},
+													},
+													condition: nil,
+													wtype:     xsql.TUMBLING_WINDOW,
+													length:    10000,
+													interval:  0,
+													limit:     0,
+												}.Init(),
+											},
+										},
+										fields: []xsql.Field{
+											{
+												Expr:  &xsql.FieldRef{Name: "name", StreamName: "src1"},
+												Name:  "name",
+												AName: ""},
+										},
+										isAggregate: false,
+										sendMeta:    false,
+									}.Init(),
+								},
+							},
+						}.Init(),
+					},
+				},
+				limit:  3,
+				offset: 1,
+			}.Init(),
+		}, { // 19 subquery
+			sql: `SELECT temp FROM (SELECT temp FROM src1 WHERE temp > 20) AS s WHERE temp < 30 GROUP BY TUMBLINGWINDOW(ss, 10)`,
+			p: ProjectPlan{
+				baseLogicalPlan: baseLogicalPlan{
+					children: []LogicalPlan{
+						WindowPlan{
+							baseLogicalPlan: baseLogicalPlan{
+								children: []LogicalPlan{
+									SubQueryPlan{
+										baseLogicalPlan: baseLogicalPlan{
+											children: []LogicalPlan{
+												ProjectPlan{
+													baseLogicalPlan: baseLogicalPlan{
+														children: []LogicalPlan{
+															FilterPlan{
+																baseLogicalPlan: baseLogicalPlan{
+																	children: []LogicalPlan{
+																		DataSourcePlan{
+																			name: "src1",
+																			streamFields: []interface{}{
+																				&xsql.StreamField{
+																					Name:      "temp",
+																					FieldType: &xsql.BasicType{Type: xsql.BIGINT},
+																				},
+																			},
+																			streamStmt: streams["src1"],
+																			metaFields: []string{},
+																		}.Init(),
+																	},
+																},
+																condition: &xsql.BinaryExpr{
+																	LHS: &xsql.FieldRef{Name: "temp", StreamName: "src1"},
+																	OP:  xsql.GT,
+																	RHS: &xsql.IntegerLiteral{Val: 20},
+																},
+															}.Init(),
+														},
+													},
+													fields: []xsql.Field{
+														{
+															Expr:  &xsql.FieldRef{Name: "temp", StreamName: "src1"},
+															Name:  "temp",
+															AName: ""},
+													},
+													isAggregate: false,
+													sendMeta:    false,
+												}.Init(),
+											},
+										},
+										name:    "s",
+										streams: []string{"src1"},
+									}.Init(),
+								},
+							},
+							condition: &xsql.BinaryExpr{
+								LHS: &xsql.FieldRef{Name: "temp", StreamName: "s"},
+								OP:  xsql.LT,
+								RHS: &xsql.IntegerLiteral{Val: 30},
+							},
+							wtype:    xsql.TUMBLING_WINDOW,
+							length:   10000,
+							interval: 0,
+							limit:    0,
+						}.Init(),
+					},
+				},
+				fields: []xsql.Field{
+					{
+						Expr:  &xsql.FieldRef{Name: "temp", StreamName: "s"},
+						Name:  "temp",
+						AName: ""},
+				},
+				isAggregate: false,
+				sendMeta:    false,
+			}.Init(),
+		}, { // 20 union of streams
+			sql: `SELECT id1, hum FROM src1, src2 WHERE hum > 20 GROUP BY TUMBLINGWINDOW(ss, 10)`,
+			p: ProjectPlan{
+				baseLogicalPlan: baseLogicalPlan{
+					children: []LogicalPlan{
+						UnionPlan{
+							baseLogicalPlan: baseLogicalPlan{
+								children: []LogicalPlan{
+									WindowPlan{
+										baseLogicalPlan: baseLogicalPlan{
+											children: []LogicalPlan{
+												DataSourcePlan{
+													name: "src1",
+													streamFields: []interface{}{
+														&xsql.StreamField{
+															Name:      "id1",
+															FieldType: &xsql.BasicType{Type: xsql.BIGINT},
+														},
+													},
+													streamStmt: streams["src1"],
+													metaFields: []string{},
+												}.Init(),
+												DataSourcePlan{
+													name: "src2",
+													streamFields: []interface{}{
+														&xsql.StreamField{
+															Name:      "hum",
+															FieldType: &xsql.BasicType{Type: xsql.BIGINT},
+														},
+													},
+													streamStmt: streams["src2"],
+													metaFields: []string{},
+												}.Init(),
+											},
+										},
+										condition: &xsql.BinaryExpr{
+											LHS: &xsql.FieldRef{Name: "hum", StreamName: xsql.DEFAULT_STREAM},
+											OP:  xsql.GT,
+											RHS: &xsql.IntegerLiteral{Val: 20},
+										},
+										wtype:    xsql.TUMBLING_WINDOW,
+										length:   10000,
+										interval: 0,
+										limit:    0,
+									}.Init(),
+								},
+							},
+						}.Init(),
+					},
+				},
+				fields: []xsql.Field{
+					{
+						Expr:  &xsql.FieldRef{Name: "id1", StreamName: xsql.DEFAULT_STREAM},
+						Name:  "id1",
+						AName: ""},
+					{
+						Expr:  &xsql.FieldRef{Name: "hum", StreamName: xsql.DEFAULT_STREAM},
+						Name:  "hum",
+						AName: ""},
+				},
+				isAggregate: false,
+				sendMeta:    false,
+			}.Init(),
+		}, { // 21 alias of analytic function referred in where
+			sql: `SELECT lag(temp) AS t FROM src1 WHERE t > 10`,
+			p:   nil,
+			err: "alias t of the analytic function can only be used in the select fields",
+		}, { // 22 incremental aggregate
+			sql: `SELECT name, max(temp) FROM src1 WHERE name = "v1" GROUP BY TUMBLINGWINDOW(ss, 10), name`,
+			p: ProjectPlan{
+				baseLogicalPlan: baseLogicalPlan{
+					children: []LogicalPlan{
+						AggregatePlan{
+							baseLogicalPlan: baseLogicalPlan{
+								children: []LogicalPlan{
+									WindowPlan{
+										baseLogicalPlan: baseLogicalPlan{
+											children: []LogicalPlan{
+												FilterPlan{
+													baseLogicalPlan: baseLogicalPlan{
+														children: []LogicalPlan{
+															DataSourcePlan{
+																name: "src1",
+																streamFields: []interface{}{
+																	&xsql.StreamField{
+																		Name:      "name",
+																		FieldType: &xsql.BasicType{Type: xsql.STRINGS},
+																	},
+																	&xsql.StreamField{
+																		Name:      "temp",
+																		FieldType: &xsql.BasicType{Type: xsql.BIGINT},
+																	},
+																},
+																streamStmt: streams["src1"],
+																metaFields: []string{},
+															}.Init(),
+														},
+													},
+													condition: &xsql.BinaryExpr{
+														LHS: &xsql.FieldRef{Name: "name", StreamName: "src1"},
+														OP:  xsql.EQ,
+														RHS: &xsql.StringLiteral{Val: "v1"},
+													},
+												}.Init(),
+											},
+										},
+										condition: nil,
+										wtype:     xsql.TUMBLING_WINDOW,
+										length:    10000,
+										interval:  0,
+										limit:     0,
+										aggregates: []*xsql.Call{
+											{Name: "max", Args: []xsql.Expr{&xsql.FieldRef{Name: "temp", StreamName: "src1"}}, CacheKey: "$$agg_0"},
+										},
+										dimensions: xsql.Dimensions{
+											xsql.Dimension{Expr: &xsql.FieldRef{Name: "name", StreamName: "src1"}},
+										},
+									}.Init(),
+								},
+							},
+							dimensions: xsql.Dimensions{
+								xsql.Dimension{Expr: &xsql.FieldRef{Name: "name", StreamName: "src1"}},
+							},
+						}.Init(),
+					},
+				},
+				fields: []xsql.Field{
+					{
+						Expr:  &xsql.FieldRef{Name: "name", StreamName: "src1"},
+						Name:  "name",
+						AName: ""},
+					{
+						Expr:  &xsql.Call{Name: "max", Args: []xsql.Expr{&xsql.FieldRef{Name: "temp", StreamName: "src1"}}, CacheKey: "$$agg_0"},
+						Name:  "max",
+						AName: ""},
+				},
+				isAggregate: true,
+				sendMeta:    false,
+			}.Init(),
+		}, { // 23 limit by the column which is not selected
+			sql: `SELECT name, max(temp) AS m FROM src1 GROUP BY TUMBLINGWINDOW(ss, 10), name, id1 ORDER BY m DESC LIMIT 1 BY id1`,
+			p:   nil,
+			err: "column id1 of LIMIT BY must be one of the select fields",
 		},
 	}
 	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
@@ -1040,3 +1599,53 @@ func Test_createLogicalPlan(t *testing.T) {
 		}
 	}
 }
+
+func Test_newIntervalJoinPlan(t *testing.T) {
+	streamStmts := []*xsql.StreamStmt{
+		{Name: "src1", Options: &xsql.Options{TIMESTAMP: "temp"}},
+		{Name: "src2", Options: &xsql.Options{TIMESTAMP: "hum"}},
+	}
+	var tests = []struct {
+		sql         string
+		isEventTime bool
+		lower       int64
+		upper       int64
+		isInterval  bool
+	}{
+		{ // 0
+			sql:         `SELECT id1 FROM src1 INNER JOIN src2 on src1.id1 = src2.id2 AND src2.hum BETWEEN src1.temp - 1s AND src1.temp + 3s`,
+			isEventTime: true,
+			lower:       -1000,
+			upper:       3000,
+			isInterval:  true,
+		}, { // 1 the comparisons of non TIMESTAMP fields are not the bounds in event time mode
+			sql:         `SELECT id1 FROM src1 INNER JOIN src2 on src1.id1 = src2.id2 AND src2.id2 >= src1.id1 - 10 AND src2.id2 <= src1.id1 + 10`,
+			isEventTime: true,
+			isInterval:  false,
+		}, { // 2 any fields can be the bounds in processing time mode
+			sql:         `SELECT id1 FROM src1 INNER JOIN src2 on src1.id1 = src2.id2 AND src2.id2 >= src1.id1 - 10 AND src2.id2 <= src1.id1 + 10`,
+			isEventTime: false,
+			lower:       -10,
+			upper:       10,
+			isInterval:  true,
+		}, { // 3
+			sql:         `SELECT id1 FROM src1 INNER JOIN src2 on src1.id1 = src2.id2 AND src2.id2 >= src1.id1 - 10`,
+			isEventTime: false,
+			isInterval:  false,
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		stmt, err := xsql.NewParser(strings.NewReader(tt.sql)).Parse()
+		if err != nil {
+			t.Errorf("%d. %q: error compile sql: %s\n", i, tt.sql, err)
+			continue
+		}
+		p := newIntervalJoinPlan(stmt.Sources[0].(*xsql.Table), stmt.Joins, streamStmts, tt.isEventTime)
+		if (p != nil) != tt.isInterval {
+			t.Errorf("%d. %q: interval join mismatch:\n  exp=%v\n  got=%v\n\n", i, tt.sql, tt.isInterval, p != nil)
+		} else if p != nil && (p.lower != tt.lower || p.upper != tt.upper) {
+			t.Errorf("%d. %q: bound mismatch:\n  exp=[%d, %d]\n  got=[%d, %d]\n\n", i, tt.sql, tt.lower, tt.upper, p.lower, p.upper)
+		}
+	}
+}
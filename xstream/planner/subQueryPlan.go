@@ -0,0 +1,28 @@
+package planner
+
+import "github.com/emqx/kuiper/xsql"
+
+// SubQueryPlan converts the result of the subquery, which is its child, to the tuples of a schemaless stream
+// named by the alias of the subquery
+type SubQueryPlan struct {
+	baseLogicalPlan
+	name  string
+	alias xsql.Fields
+	// The inputs of the subquery
+	streams []string
+}
+
+func (p SubQueryPlan) Init() *SubQueryPlan {
+	p.baseLogicalPlan.self = &p
+	return &p
+}
+
+// The subquery has its own scope, so the conditions of the outer statement cannot be pushed into it
+func (p *SubQueryPlan) PushDownPredicate(condition xsql.Expr) (xsql.Expr, LogicalPlan) {
+	return condition, p
+}
+
+// The subquery is already pruned by its own fields
+func (p *SubQueryPlan) PruneColumns(_ []xsql.Expr) error {
+	return nil
+}
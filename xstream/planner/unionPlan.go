@@ -0,0 +1,11 @@
+package planner
+
+// UnionPlan merges the inputs of all the streams in the FROM clause
+type UnionPlan struct {
+	baseLogicalPlan
+}
+
+func (p UnionPlan) Init() *UnionPlan {
+	p.baseLogicalPlan.self = &p
+	return &p
+}
@@ -1,6 +1,10 @@
 package planner
 
-import "github.com/emqx/kuiper/xsql"
+import (
+	"fmt"
+	"github.com/emqx/kuiper/xsql"
+	"github.com/emqx/kuiper/xstream/api"
+)
 
 type WindowPlan struct {
 	baseLogicalPlan
@@ -10,6 +14,10 @@ type WindowPlan struct {
 	interval    int //If interval is not set, it is equals to Length
 	limit       int //If limit is not positive, there will be no limit
 	isEventTime bool
+	partition   []xsql.Expr
+	// If set, the window calculates these aggregate functions incrementally for each group instead of keeping the tuples
+	aggregates []*xsql.Call
+	dimensions xsql.Dimensions
 }
 
 func (p WindowPlan) Init() *WindowPlan {
@@ -38,5 +46,41 @@ func (p *WindowPlan) PushDownPredicate(condition xsql.Expr) (xsql.Expr, LogicalP
 
 func (p *WindowPlan) PruneColumns(fields []xsql.Expr) error {
 	f := getFields(p.condition)
+	for _, e := range p.partition {
+		f = append(f, getFields(e)...)
+	}
 	return p.baseLogicalPlan.PruneColumns(append(fields, f...))
 }
+
+// Get the aggregate function calls to calculate incrementally in the window and set their cache keys. Return nil if the
+// statement refers to the tuples of the window other than the decomposable aggregate functions. Only the processing
+// time tumbling window of a single stream is supported.
+func getIncrementalAggregates(stmt *xsql.SelectStatement, w *xsql.Window, opt *api.RuleOption) []*xsql.Call {
+	if opt.IsEventTime || w.WindowType != xsql.TUMBLING_WINDOW || len(stmt.Sources) != 1 || len(stmt.Joins) > 0 {
+		return nil
+	}
+	nodes := []xsql.Node{stmt.Fields}
+	for _, f := range stmt.Fields {
+		if _, ok := f.Expr.(*xsql.Wildcard); ok {
+			return nil
+		}
+	}
+	if stmt.Having != nil {
+		nodes = append(nodes, stmt.Having)
+	}
+	if stmt.SortFields != nil {
+		nodes = append(nodes, stmt.SortFields)
+	}
+	var aggregates []*xsql.Call
+	for _, node := range nodes {
+		calls, ok := xsql.GetIncrementalAggFuncs(node)
+		if !ok {
+			return nil
+		}
+		aggregates = append(aggregates, calls...)
+	}
+	for i, c := range aggregates {
+		c.CacheKey = fmt.Sprintf("$$agg_%d", i)
+	}
+	return aggregates
+}
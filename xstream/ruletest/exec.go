@@ -0,0 +1,40 @@
+package ruletest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Command is the argument of the server binary to run as the rule test process
+const Command = "ruletest"
+
+const execTimeout = 60 * time.Second
+
+// Exec runs the rule test definition in a child process of the current binary. The mock clock is global, so the test
+// must not run inside the server process where other rules are running.
+func Exec(def []byte) ([]byte, error) {
+	bin, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, bin, Command)
+	cmd.Stdin = bytes.NewReader(def)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("rule test timeout after %v", execTimeout)
+		}
+		if out.Len() > 0 {
+			return nil, fmt.Errorf("%s", out.String())
+		}
+		return nil, fmt.Errorf("run rule test error: %v", err)
+	}
+	return out.Bytes(), nil
+}
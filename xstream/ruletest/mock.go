@@ -0,0 +1,81 @@
+package ruletest
+
+import (
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/xstream/api"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The mock source sends out each event when the mock clock reaches its timestamp
+type mockSource struct {
+	events []*Event
+}
+
+func newMockSource(events []*Event) *mockSource {
+	sorted := make([]*Event, len(events))
+	copy(sorted, events)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Timestamp < sorted[j].Timestamp })
+	return &mockSource{events: sorted}
+}
+
+func (m *mockSource) Open(ctx api.StreamContext, consumer chan<- api.SourceTuple, _ chan<- error) {
+	for _, e := range m.events {
+		if diff := e.Timestamp - common.GetNowInMilli(); diff > 0 {
+			select {
+			case <-common.Clock.After(time.Duration(diff) * time.Millisecond):
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case consumer <- api.NewDefaultSourceTuple(e.Data, map[string]interface{}{"topic": "mock"}):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *mockSource) Configure(_ string, _ map[string]interface{}) error {
+	return nil
+}
+
+func (m *mockSource) Close(_ api.StreamContext) error {
+	return nil
+}
+
+// The mock sink captures all the results
+type mockSink struct {
+	sync.Mutex
+	results [][]byte
+}
+
+func (m *mockSink) Configure(_ map[string]interface{}) error {
+	return nil
+}
+
+func (m *mockSink) Open(_ api.StreamContext) error {
+	return nil
+}
+
+func (m *mockSink) Collect(ctx api.StreamContext, item interface{}) error {
+	if v, ok := item.([]byte); ok {
+		m.Lock()
+		m.results = append(m.results, v)
+		m.Unlock()
+	} else {
+		ctx.GetLogger().Warnf("rule test sink receive non byte data %v", item)
+	}
+	return nil
+}
+
+func (m *mockSink) Close(_ api.StreamContext) error {
+	return nil
+}
+
+func (m *mockSink) getResults() [][]byte {
+	m.Lock()
+	defer m.Unlock()
+	return m.results
+}
@@ -0,0 +1,234 @@
+package ruletest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/benbjohnson/clock"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/plugins"
+	"github.com/emqx/kuiper/plugins/portable"
+	"github.com/emqx/kuiper/services"
+	"github.com/emqx/kuiper/udf"
+	"github.com/emqx/kuiper/xsql"
+	"github.com/emqx/kuiper/xsql/processors"
+	"github.com/emqx/kuiper/xstream"
+	"github.com/emqx/kuiper/xstream/api"
+	"github.com/emqx/kuiper/xstream/nodes"
+	"github.com/emqx/kuiper/xstream/planner"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Definition is the rule to test with its stream definitions and the mock inputs
+type Definition struct {
+	Id      string              `json:"id"`
+	Sql     string              `json:"sql"`
+	Options *api.RuleOption     `json:"options"`
+	Streams []string            `json:"streams"`
+	Inputs  map[string][]*Event `json:"inputs"`
+	// The milliseconds to move the mock clock forward after the last event, so that the pending windows can trigger
+	PostLeap int64 `json:"postleap"`
+}
+
+type Event struct {
+	Timestamp int64                  `json:"timestamp"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// Result is the captured sink results and the metrics of the rule. The time related metrics are not included
+type Result struct {
+	Results []interface{}          `json:"results"`
+	Metrics map[string]interface{} `json:"metrics"`
+}
+
+const (
+	// The interval to check if the rule has processed all the data
+	settleInterval = 20 * time.Millisecond
+	settleTimeout  = 5 * time.Second
+)
+
+// Run the rule in the mock clock with the mock sources and sink. Because the clock is global, it must not run in the
+// process which has other running rules.
+func Run(def *Definition) (*Result, error) {
+	if def.Sql == "" {
+		return nil, fmt.Errorf("missing rule sql")
+	}
+	if def.Id == "" {
+		def.Id = "ruletest"
+	}
+	opt := common.Config.Rule
+	if def.Options != nil {
+		opt = *def.Options
+	}
+	// The checkpoints are not supported in the test
+	opt.Qos = api.AtMostOnce
+	dir, err := ioutil.TempDir("", "kuiper_ruletest")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	sp := processors.NewStreamProcessor(path.Join(dir, "stream"))
+	for _, s := range def.Streams {
+		if _, err := sp.ExecStmt(s); err != nil {
+			return nil, err
+		}
+	}
+	stmt, err := xsql.GetStatementFromSql(def.Sql)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		start   int64 = -1
+		count   int
+		sources []*nodes.SourceNode
+		events  []int64
+	)
+	for name, data := range def.Inputs {
+		for _, e := range data {
+			if start < 0 || e.Timestamp < start {
+				start = e.Timestamp
+			}
+			events = append(events, e.Timestamp)
+		}
+		count += len(data)
+		if !contains(xsql.GetStreams(stmt), name) {
+			return nil, fmt.Errorf("input stream %s is not used in the rule", name)
+		}
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("missing rule inputs")
+	}
+	// The streams without inputs receive nothing
+	for _, name := range xsql.GetStreams(stmt) {
+		sources = append(sources, nodes.NewSourceNodeWithSource(name, newMockSource(def.Inputs[name]), &xsql.Options{
+			DATASOURCE: name,
+		}))
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i] < events[j] })
+
+	mockClock := clock.NewMock()
+	mockClock.Set(common.TimeFromUnixMilli(start))
+	common.Clock = mockClock
+	mockSink := &mockSink{}
+	sink := nodes.NewSinkNodeWithSink("ruletest", mockSink, nil)
+	tp, err := planner.PlanWithSourcesAndSinks(&api.Rule{Id: def.Id, Sql: def.Sql, Options: &opt}, dir, sources, []*nodes.SinkNode{sink})
+	if err != nil {
+		return nil, err
+	}
+	errCh := tp.Open()
+	defer tp.Cancel()
+	// Move the clock to each event time and wait for the rule to process it
+	for _, ts := range append(events, events[len(events)-1]+def.PostLeap) {
+		if ts > common.GetNowInMilli() {
+			mockClock.Set(common.TimeFromUnixMilli(ts))
+		}
+		if err := settle(tp, errCh); err != nil {
+			return nil, err
+		}
+	}
+	result := &Result{Results: make([]interface{}, 0), Metrics: make(map[string]interface{})}
+	for _, r := range mockSink.getResults() {
+		var v interface{}
+		if err := json.Unmarshal(r, &v); err != nil {
+			result.Results = append(result.Results, string(r))
+		} else {
+			result.Results = append(result.Results, v)
+		}
+	}
+	keys, values := tp.GetMetrics()
+	for i, k := range keys {
+		if strings.HasSuffix(k, nodes.LastInvocation) || strings.HasSuffix(k, nodes.ProcessLatencyUs) {
+			continue
+		}
+		result.Metrics[k] = values[i]
+	}
+	return result, nil
+}
+
+// Wait until the metrics do not change which means the rule has processed all the received data. It fails if the
+// metrics are still changing after the timeout.
+func settle(tp *xstream.TopologyNew, errCh <-chan error) error {
+	var last []interface{}
+	timeout := time.After(settleTimeout)
+	for {
+		select {
+		case err := <-errCh:
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("rule exits unexpectedly")
+		case <-timeout:
+			return fmt.Errorf("rule does not settle in %v", settleTimeout)
+		case <-time.After(settleInterval):
+			_, values := tp.GetMetrics()
+			if last != nil && reflect.DeepEqual(last, values) {
+				return nil
+			}
+			last = values
+		}
+	}
+}
+
+func contains(s []string, name string) bool {
+	for _, n := range s {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Main is the entry of the rule test process. It reads the definition json from stdin and writes the result json to
+// stdout. If failed, the error message is written and exits with code 1.
+func Main() {
+	common.InitConf()
+	// Keep stdout for the result only
+	common.Log.SetOutput(os.Stderr)
+	if err := initFuncRegisters(); err != nil {
+		exit(err)
+	}
+	def := &Definition{}
+	if err := json.NewDecoder(os.Stdin).Decode(def); err != nil {
+		exit(fmt.Errorf("invalid rule test definition: %v", err))
+	}
+	r, err := Run(def)
+	if err != nil {
+		exit(err)
+	}
+	if err := json.NewEncoder(os.Stdout).Encode(r); err != nil {
+		exit(err)
+	}
+}
+
+func initFuncRegisters() error {
+	pluginManager, err := plugins.NewPluginManager()
+	if err != nil {
+		return err
+	}
+	serviceManager, err := services.GetServiceManager()
+	if err != nil {
+		return err
+	}
+	udfManager, err := udf.GetManager()
+	if err != nil {
+		return err
+	}
+	// Only start the portable plugins used by the rule
+	portableManager, err := portable.GetRegistry()
+	if err != nil {
+		return err
+	}
+	xsql.InitFuncRegisters(serviceManager, pluginManager, udfManager, portableManager)
+	return nil
+}
+
+func exit(err error) {
+	fmt.Fprint(os.Stdout, err.Error())
+	os.Exit(1)
+}
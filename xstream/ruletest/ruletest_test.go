@@ -0,0 +1,120 @@
+package ruletest
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/xstream/api"
+	"reflect"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	common.InitConf()
+	var tests = []struct {
+		def    *Definition
+		result *Result
+		err    string
+	}{
+		{
+			def: &Definition{
+				Sql:     "SELECT color, size FROM demo WHERE size > 3",
+				Streams: []string{`CREATE STREAM demo (color STRING, size BIGINT) WITH (DATASOURCE="demo", FORMAT="JSON")`},
+				Inputs: map[string][]*Event{
+					"demo": {
+						{Timestamp: 1541152486013, Data: map[string]interface{}{"color": "red", "size": 3}},
+						{Timestamp: 1541152486822, Data: map[string]interface{}{"color": "blue", "size": 6}},
+						{Timestamp: 1541152487632, Data: map[string]interface{}{"color": "blue", "size": 2}},
+						{Timestamp: 1541152488442, Data: map[string]interface{}{"color": "yellow", "size": 4}},
+					},
+				},
+			},
+			result: &Result{
+				Results: []interface{}{
+					[]interface{}{map[string]interface{}{"color": "blue", "size": float64(6)}},
+					[]interface{}{map[string]interface{}{"color": "yellow", "size": float64(4)}},
+				},
+				Metrics: map[string]interface{}{
+					"source_demo_0_records_in_total":             int64(4),
+					"source_demo_0_records_out_total":            int64(4),
+					"source_demo_0_exceptions_total":             int64(0),
+					"source_demo_0_buffer_length":                int64(0),
+					"op_1_preprocessor_demo_0_records_in_total":  int64(4),
+					"op_1_preprocessor_demo_0_records_out_total": int64(4),
+					"op_1_preprocessor_demo_0_exceptions_total":  int64(0),
+					"op_1_preprocessor_demo_0_buffer_length":     int64(0),
+					"op_2_filter_0_records_in_total":             int64(4),
+					"op_2_filter_0_records_out_total":            int64(2),
+					"op_2_filter_0_exceptions_total":             int64(0),
+					"op_2_filter_0_buffer_length":                int64(0),
+					"op_3_project_0_records_in_total":            int64(2),
+					"op_3_project_0_records_out_total":           int64(2),
+					"op_3_project_0_exceptions_total":            int64(0),
+					"op_3_project_0_buffer_length":               int64(0),
+					"sink_ruletest_0_records_in_total":           int64(2),
+					"sink_ruletest_0_records_out_total":          int64(2),
+					"sink_ruletest_0_exceptions_total":           int64(0),
+					"sink_ruletest_0_buffer_length":              int64(0),
+				},
+			},
+		}, {
+			def: &Definition{
+				Sql:     "SELECT count(*) AS c FROM demo GROUP BY TUMBLINGWINDOW(ss, 1)",
+				Options: &api.RuleOption{BufferLength: 100, SendError: true},
+				Streams: []string{`CREATE STREAM demo (color STRING, size BIGINT) WITH (DATASOURCE="demo", FORMAT="JSON")`},
+				Inputs: map[string][]*Event{
+					"demo": {
+						{Timestamp: 1541152486013, Data: map[string]interface{}{"color": "red", "size": 3}},
+						{Timestamp: 1541152486822, Data: map[string]interface{}{"color": "blue", "size": 6}},
+						{Timestamp: 1541152487632, Data: map[string]interface{}{"color": "blue", "size": 2}},
+					},
+				},
+				PostLeap: 1000,
+			},
+			result: &Result{
+				Results: []interface{}{
+					[]interface{}{map[string]interface{}{"c": float64(2)}},
+					[]interface{}{map[string]interface{}{"c": float64(1)}},
+				},
+			},
+		}, {
+			def: &Definition{
+				Sql:     "SELECT * FROM demo",
+				Streams: []string{`CREATE STREAM demo (color STRING, size BIGINT) WITH (DATASOURCE="demo", FORMAT="JSON")`},
+				Inputs: map[string][]*Event{
+					"demo1": {
+						{Timestamp: 1541152486013, Data: map[string]interface{}{"color": "red", "size": 3}},
+					},
+				},
+			},
+			err: "input stream demo1 is not used in the rule",
+		}, {
+			def: &Definition{
+				Sql:     "SELECT * FROM demo",
+				Streams: []string{`CREATE STREAM demo (color STRING, size BIGINT) WITH (DATASOURCE="demo", FORMAT="JSON")`},
+			},
+			err: "missing rule inputs",
+		}, {
+			def: &Definition{
+				Streams: []string{`CREATE STREAM demo (color STRING, size BIGINT) WITH (DATASOURCE="demo", FORMAT="JSON")`},
+			},
+			err: "missing rule sql",
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		r, err := Run(tt.def)
+		if !reflect.DeepEqual(tt.err, common.Errstring(err)) {
+			t.Errorf("%d: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.err, err)
+			continue
+		}
+		if tt.err != "" {
+			continue
+		}
+		if !reflect.DeepEqual(tt.result.Results, r.Results) {
+			t.Errorf("%d: results mismatch:\n  exp=%v\n  got=%v\n\n", i, tt.result.Results, r.Results)
+		}
+		if tt.result.Metrics != nil && !reflect.DeepEqual(tt.result.Metrics, r.Metrics) {
+			t.Errorf("%d: metrics mismatch:\n  exp=%v\n  got=%v\n\n", i, tt.result.Metrics, r.Metrics)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package main
 
-import "github.com/emqx/kuiper/xstream/server/server"
+import (
+	"github.com/emqx/kuiper/xstream/ruletest"
+	"github.com/emqx/kuiper/xstream/server/server"
+	"os"
+)
 
 var (
 	Version      = "unknown"
@@ -8,5 +12,9 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == ruletest.Command {
+		ruletest.Main()
+		return
+	}
 	server.StartUp(Version, LoadFileType)
 }
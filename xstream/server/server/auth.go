@@ -0,0 +1,367 @@
+package server
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/rpc"
+	"strings"
+	"sync"
+
+	"github.com/emqx/kuiper/common"
+)
+
+type role int
+
+// The roles are ordered. A role is granted all the permissions of the lower roles.
+const (
+	roleNone role = iota
+	// Read only
+	roleViewer
+	// Manage the streams, tables and rules
+	roleOperator
+	// Manage the plugins, services, functions and configurations which may run code or access the file system
+	roleAdmin
+)
+
+var roleNames = []string{"none", "viewer", "operator", "admin"}
+
+func (r role) String() string {
+	return roleNames[r]
+}
+
+func parseRole(s string) (role, error) {
+	for i, n := range roleNames {
+		if i > 0 && strings.EqualFold(n, s) {
+			return role(i), nil
+		}
+	}
+	return roleNone, fmt.Errorf("invalid role %s, expect viewer, operator or admin", s)
+}
+
+// authenticator identifies the role of the REST and RPC requests. A nil authenticator accepts all requests as admin.
+type authenticator struct {
+	tokens   map[string]role
+	jwt      *jwtVerifier
+	mtlsPool *x509.CertPool
+	mtlsRole role
+}
+
+func newAuthenticator(conf *common.AuthConf) (*authenticator, error) {
+	if conf == nil {
+		return nil, nil
+	}
+	a := &authenticator{tokens: make(map[string]role)}
+	for _, t := range conf.Tokens {
+		if t.Token == "" {
+			return nil, fmt.Errorf("empty api token")
+		}
+		r, err := parseRole(t.Role)
+		if err != nil {
+			return nil, fmt.Errorf("api token role: %v", err)
+		}
+		a.tokens[t.Token] = r
+	}
+	if conf.Jwt != nil {
+		v, err := newJwtVerifier(conf.Jwt)
+		if err != nil {
+			return nil, err
+		}
+		a.jwt = v
+	}
+	if conf.Mtls != nil {
+		b, err := ioutil.ReadFile(conf.Mtls.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read mtls ca file: %v", err)
+		}
+		a.mtlsPool = x509.NewCertPool()
+		if !a.mtlsPool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("invalid mtls ca file %s", conf.Mtls.CaFile)
+		}
+		a.mtlsRole = roleViewer
+		if conf.Mtls.Role != "" {
+			if a.mtlsRole, err = parseRole(conf.Mtls.Role); err != nil {
+				return nil, fmt.Errorf("mtls role: %v", err)
+			}
+		}
+	}
+	return a, nil
+}
+
+// tlsConfig requests the client certificates if mutual TLS is enabled. The requests without a certificate can still
+// be authenticated by the tokens.
+func (a *authenticator) tlsConfig() *tls.Config {
+	if a == nil || a.mtlsPool == nil {
+		return nil
+	}
+	return &tls.Config{
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		ClientCAs:  a.mtlsPool,
+	}
+}
+
+// authenticate returns the role of the request by the verified client certificate or the bearer token
+func (a *authenticator) authenticate(r *http.Request) (role, error) {
+	if a.mtlsPool != nil && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		// The organizational unit of the client certificate can specify the role
+		for _, ou := range r.TLS.VerifiedChains[0][0].Subject.OrganizationalUnit {
+			if ro, err := parseRole(ou); err == nil {
+				return ro, nil
+			}
+		}
+		return a.mtlsRole, nil
+	}
+	h := r.Header.Get("Authorization")
+	if h == "" {
+		return roleNone, fmt.Errorf("missing authorization header")
+	}
+	if len(h) < 7 || !strings.EqualFold(h[:7], "Bearer ") {
+		return roleNone, fmt.Errorf("authorization header must be a bearer token")
+	}
+	return a.authenticateToken(strings.TrimSpace(h[7:]))
+}
+
+func (a *authenticator) authenticateToken(token string) (role, error) {
+	for t, ro := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return ro, nil
+		}
+	}
+	if a.jwt != nil && strings.Count(token, ".") == 2 {
+		claims, err := a.jwt.verify(token)
+		if err != nil {
+			return roleNone, err
+		}
+		rs, ok := claims[a.jwt.roleClaim].(string)
+		if !ok {
+			return roleNone, fmt.Errorf("missing %s claim in token", a.jwt.roleClaim)
+		}
+		return parseRole(rs)
+	}
+	return roleNone, fmt.Errorf("invalid token")
+}
+
+// The REST routes whose write methods require the admin role. The other write methods require the operator role and
+// the read methods require the viewer role.
+var adminRoutes = []string{"/plugins", "/services", "/functions", "/metadata", "/secrets", "/data"}
+
+// The REST routes which do not need authentication
+var publicRoutes = []string{"/ping"}
+
+func restRole(r *http.Request) role {
+	for _, p := range publicRoutes {
+		if r.URL.Path == p {
+			return roleNone
+		}
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return roleViewer
+	}
+	for _, p := range adminRoutes {
+		if r.URL.Path == p || strings.HasPrefix(r.URL.Path, p+"/") {
+			return roleAdmin
+		}
+	}
+	return roleOperator
+}
+
+// middleware rejects the REST requests which are not authenticated or do not have the required role
+func (a *authenticator) middleware(next http.Handler) http.Handler {
+	if a == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		required := restRole(r)
+		if required == roleNone {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ro, err := a.authenticate(r)
+		if err != nil {
+			logger.Warnf("unauthorized request %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, fmt.Sprintf("unauthorized: %v", err), http.StatusUnauthorized)
+			return
+		}
+		if ro < required {
+			logger.Warnf("forbidden request %s %s from %s: role %s", r.Method, r.URL.Path, r.RemoteAddr, ro)
+			http.Error(w, fmt.Sprintf("forbidden: %s role is required", required), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The roles required by the RPC methods. The methods not listed require the admin role.
+var rpcRoles = map[string]role{
+	"Server.GetStatusRule":    roleViewer,
+	"Server.GetTopoRule":      roleViewer,
+	"Server.DescRule":         roleViewer,
+	"Server.ShowRules":        roleViewer,
+	"Server.ShowSavepoints":   roleViewer,
+	"Server.ShowPlugins":      roleViewer,
+	"Server.ShowUdfs":         roleViewer,
+	"Server.DescPlugin":       roleViewer,
+	"Server.DescUdf":          roleViewer,
+	"Server.DescService":      roleViewer,
+	"Server.DescServiceFunc":  roleViewer,
+	"Server.ShowServices":     roleViewer,
+	"Server.ShowServiceFuncs": roleViewer,
+	"Server.ShowSecrets":      roleViewer,
+	"Server.DescSecret":       roleViewer,
+	"Server.Export":           roleViewer,
+
+	"Server.CreateQuery":            roleOperator,
+	"Server.GetQueryResult":         roleOperator,
+	"Server.CreateRule":             roleOperator,
+	"Server.StartRule":              roleOperator,
+	"Server.StopRule":               roleOperator,
+	"Server.RestartRule":            roleOperator,
+	"Server.DropRule":               roleOperator,
+	"Server.StartRuleFromSavepoint": roleOperator,
+	"Server.SavepointRule":          roleOperator,
+	"Server.TestRule":               roleOperator,
+	"Server.DropSavepoint":          roleOperator,
+}
+
+// streamRole returns the role required by the statement of the Server.Stream method
+func streamRole(stmt string) role {
+	words := strings.Fields(strings.ToUpper(stmt))
+	if len(words) == 0 {
+		return roleViewer
+	}
+	switch words[0] {
+	case "SHOW", "DESCRIBE", "EXPLAIN":
+		return roleViewer
+	}
+	if len(words) > 1 && words[1] == "FUNCTION" {
+		return roleAdmin
+	}
+	return roleOperator
+}
+
+// rpcHandler serves the RPC server over HTTP like rpc.Server.ServeHTTP. The CONNECT request is authenticated and each
+// call of the connection is checked against the role.
+func (a *authenticator) rpcHandler(srv *rpc.Server) http.Handler {
+	if a == nil {
+		return srv
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			io.WriteString(w, "405 must CONNECT\n")
+			return
+		}
+		ro, err := a.authenticate(r)
+		if err != nil {
+			logger.Warnf("unauthorized rpc connection from %s: %v", r.RemoteAddr, err)
+			http.Error(w, fmt.Sprintf("unauthorized: %v", err), http.StatusUnauthorized)
+			return
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			logger.Errorf("rpc hijacking %s: %v", r.RemoteAddr, err)
+			return
+		}
+		io.WriteString(conn, "HTTP/1.0 200 Connected to Go RPC\n\n")
+		buf := bufio.NewWriter(conn)
+		srv.ServeCodec(&authCodec{
+			rwc:    conn,
+			dec:    gob.NewDecoder(conn),
+			enc:    gob.NewEncoder(buf),
+			encBuf: buf,
+			role:   ro,
+			denied: make(map[uint64]string),
+		})
+	})
+}
+
+// authCodec is the gob codec of net/rpc which denies the calls not permitted by the role. A denied call is renamed to
+// a method that does not exist so that the server discards its body, and its error is replaced.
+type authCodec struct {
+	rwc    io.ReadWriteCloser
+	dec    *gob.Decoder
+	enc    *gob.Encoder
+	encBuf *bufio.Writer
+	role   role
+
+	sync.Mutex
+	denied map[uint64]string
+	// The body which is read in advance to check the permission
+	body interface{}
+}
+
+const deniedMethod = "Denied.Method"
+
+func (c *authCodec) ReadRequestHeader(r *rpc.Request) error {
+	if err := c.dec.Decode(r); err != nil {
+		return err
+	}
+	required, ok := rpcRoles[r.ServiceMethod]
+	if !ok {
+		required = roleAdmin
+	}
+	if r.ServiceMethod == "Server.Stream" {
+		var stmt string
+		if err := c.dec.Decode(&stmt); err != nil {
+			return err
+		}
+		c.body = stmt
+		required = streamRole(stmt)
+	}
+	if c.role < required {
+		logger.Warnf("forbidden rpc call %s: role %s", r.ServiceMethod, c.role)
+		c.Lock()
+		c.denied[r.Seq] = fmt.Sprintf("forbidden: %s role is required to call %s", required, r.ServiceMethod)
+		c.Unlock()
+		r.ServiceMethod = deniedMethod
+	}
+	return nil
+}
+
+func (c *authCodec) ReadRequestBody(body interface{}) error {
+	if c.body != nil {
+		b := c.body
+		c.body = nil
+		if s, ok := body.(*string); ok {
+			*s = b.(string)
+		}
+		return nil
+	}
+	return c.dec.Decode(body)
+}
+
+func (c *authCodec) WriteResponse(r *rpc.Response, body interface{}) (err error) {
+	c.Lock()
+	if msg, ok := c.denied[r.Seq]; ok {
+		delete(c.denied, r.Seq)
+		r.Error = msg
+		r.ServiceMethod = ""
+	}
+	c.Unlock()
+	if err = c.enc.Encode(r); err != nil {
+		if c.encBuf.Flush() == nil {
+			c.Close()
+		}
+		return
+	}
+	if err = c.enc.Encode(body); err != nil {
+		if c.encBuf.Flush() == nil {
+			c.Close()
+		}
+		return
+	}
+	return c.encBuf.Flush()
+}
+
+func (c *authCodec) Close() error {
+	return c.rwc.Close()
+}
@@ -0,0 +1,371 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/rpc"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/xsql"
+)
+
+func writePublicKey(t *testing.T, file string, key crypto.PublicKey) {
+	b, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b}), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func signToken(t *testing.T, alg string, key crypto.Signer, claims map[string]interface{}) string {
+	h, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	c, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	d := crypto.SHA256.New()
+	d.Write([]byte(signed))
+	digest := d.Sum(nil)
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(padBytes(r, 32), padBytes(s, 32)...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func padBytes(i *big.Int, size int) []byte {
+	b := i.Bytes()
+	return append(make([]byte, size-len(b)), b...)
+}
+
+func TestAuthenticate(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePublicKey(t, filepath.Join(dir, "rsa.pem"), &rsaKey.PublicKey)
+	writePublicKey(t, filepath.Join(dir, "ec.pem"), &ecKey.PublicKey)
+
+	a, err := newAuthenticator(&common.AuthConf{
+		Tokens: []*common.TokenConf{{Token: "t1", Role: "viewer"}, {Token: "t2", Role: "Admin"}},
+		Jwt:    &common.JwtConf{PublicKeyFile: filepath.Join(dir, "rsa.pem"), Issuer: "iss1", Audience: "kuiper"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecAuth, err := newAuthenticator(&common.AuthConf{
+		Jwt: &common.JwtConf{PublicKeyFile: filepath.Join(dir, "ec.pem"), RoleClaim: "kuiper_role"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+	var tests = []struct {
+		auth   *authenticator
+		header string
+		role   role
+		err    string
+	}{
+		{
+			auth: a,
+			err:  "missing authorization header",
+		}, {
+			auth:   a,
+			header: "Basic dXNlcjpwYXNz",
+			err:    "authorization header must be a bearer token",
+		}, {
+			auth:   a,
+			header: "Bearer t1",
+			role:   roleViewer,
+		}, {
+			auth:   a,
+			header: "bearer t2",
+			role:   roleAdmin,
+		}, {
+			auth:   a,
+			header: "Bearer t3",
+			err:    "invalid token",
+		}, {
+			auth:   a,
+			header: "Bearer " + signToken(t, "RS256", rsaKey, map[string]interface{}{"role": "operator", "iss": "iss1", "aud": []string{"kuiper"}, "exp": exp}),
+			role:   roleOperator,
+		}, {
+			auth:   a,
+			header: "Bearer " + signToken(t, "RS256", rsaKey, map[string]interface{}{"role": "operator", "iss": "iss1", "aud": "kuiper", "exp": time.Now().Add(-time.Minute).Unix()}),
+			err:    "token is expired",
+		}, {
+			auth:   a,
+			header: "Bearer " + signToken(t, "RS256", rsaKey, map[string]interface{}{"role": "operator", "iss": "iss2", "aud": "kuiper"}),
+			err:    "invalid token issuer iss2",
+		}, {
+			auth:   a,
+			header: "Bearer " + signToken(t, "RS256", rsaKey, map[string]interface{}{"role": "operator", "iss": "iss1", "aud": "other"}),
+			err:    "invalid token audience other",
+		}, {
+			auth:   a,
+			header: "Bearer " + signToken(t, "RS256", rsaKey, map[string]interface{}{"iss": "iss1", "aud": "kuiper"}),
+			err:    "missing role claim in token",
+		}, {
+			auth:   a,
+			header: "Bearer " + signToken(t, "RS256", rsaKey, map[string]interface{}{"role": "root", "iss": "iss1", "aud": "kuiper"}),
+			err:    "invalid role root, expect viewer, operator or admin",
+		}, {
+			auth:   a,
+			header: "Bearer " + signToken(t, "ES256", ecKey, map[string]interface{}{"role": "admin", "iss": "iss1", "aud": "kuiper"}),
+			err:    "algorithm ES256 does not match the public key",
+		}, {
+			auth:   a,
+			header: "Bearer " + signToken(t, "HS256", rsaKey, map[string]interface{}{"role": "admin", "iss": "iss1", "aud": "kuiper"}),
+			err:    "unsupported algorithm HS256",
+		}, {
+			auth:   ecAuth,
+			header: "Bearer " + signToken(t, "ES256", ecKey, map[string]interface{}{"kuiper_role": "admin", "nbf": time.Now().Add(-time.Minute).Unix()}),
+			role:   roleAdmin,
+		}, {
+			auth:   ecAuth,
+			header: "Bearer " + signToken(t, "ES256", ecKey, map[string]interface{}{"kuiper_role": "admin", "nbf": exp}),
+			err:    "token is not valid yet",
+		}, {
+			auth:   ecAuth,
+			header: "Bearer " + signToken(t, "ES256", ecKey, map[string]interface{}{"kuiper_role": "admin"})[:10] + "xx",
+			err:    "invalid token",
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/rules", nil)
+		if tt.header != "" {
+			r.Header.Set("Authorization", tt.header)
+		}
+		ro, err := tt.auth.authenticate(r)
+		if !reflect.DeepEqual(tt.err, common.Errstring(err)) {
+			t.Errorf("%d: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.err, err)
+		} else if tt.role != ro {
+			t.Errorf("%d: role mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.role, ro)
+		}
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	a, err := newAuthenticator(&common.AuthConf{
+		Tokens: []*common.TokenConf{{Token: "v", Role: "viewer"}, {Token: "o", Role: "operator"}, {Token: "a", Role: "admin"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := a.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	var tests = []struct {
+		method string
+		path   string
+		token  string
+		code   int
+	}{
+		{method: http.MethodGet, path: "/ping", code: http.StatusOK},
+		{method: http.MethodGet, path: "/rules", code: http.StatusUnauthorized},
+		{method: http.MethodGet, path: "/rules", token: "x", code: http.StatusUnauthorized},
+		{method: http.MethodGet, path: "/rules", token: "v", code: http.StatusOK},
+		{method: http.MethodPost, path: "/rules", token: "v", code: http.StatusForbidden},
+		{method: http.MethodPost, path: "/rules", token: "o", code: http.StatusOK},
+		{method: http.MethodDelete, path: "/streams/demo", token: "o", code: http.StatusOK},
+		{method: http.MethodGet, path: "/plugins/sources", token: "v", code: http.StatusOK},
+		{method: http.MethodPost, path: "/plugins/sources", token: "o", code: http.StatusForbidden},
+		{method: http.MethodPost, path: "/plugins/sources", token: "a", code: http.StatusOK},
+		{method: http.MethodDelete, path: "/services/s1", token: "o", code: http.StatusForbidden},
+		{method: http.MethodPut, path: "/metadata/sources/mqtt/confKeys/test", token: "o", code: http.StatusForbidden},
+		{method: http.MethodPost, path: "/functions", token: "a", code: http.StatusOK},
+		{method: http.MethodPost, path: "/functionsX", token: "o", code: http.StatusOK},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%d: %s %s code mismatch:\n  exp=%d\n  got=%d\n\n", i, tt.method, tt.path, tt.code, w.Code)
+		}
+	}
+}
+
+func TestStreamApiPermission(t *testing.T) {
+	setupBundleTest(t)
+	a, err := newAuthenticator(&common.AuthConf{
+		Tokens: []*common.TokenConf{{Token: "o", Role: "operator"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := createRestServer("127.0.0.1", 0, a).Handler
+	defer udfManager.Drop("apiFunc")
+	var tests = []struct {
+		method string
+		path   string
+		sql    string
+		code   int
+	}{
+		{method: http.MethodPost, path: "/streams", sql: `CREATE FUNCTION apiFunc(a) AS "a + 1"`, code: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/tables", sql: `CREATE FUNCTION apiFunc(a) AS "a + 1"`, code: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/streams", sql: `DROP FUNCTION apiFunc`, code: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/streams", sql: `CREATE TABLE apiTable() WITH (DATASOURCE="apiTable", FORMAT="JSON")`, code: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/streams", sql: `DROP STREAM apiStream`, code: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/streams", sql: `CREATE STREAM apiStream() WITH (DATASOURCE="apiStream", FORMAT="JSON")`, code: http.StatusCreated},
+		{method: http.MethodPut, path: "/streams/apiStream", sql: `CREATE FUNCTION apiFunc(a) AS "a + 1"`, code: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/functions", sql: `CREATE FUNCTION apiFunc(a) AS "a + 1"`, code: http.StatusForbidden},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		b, _ := json.Marshal(map[string]string{"sql": tt.sql})
+		r := httptest.NewRequest(tt.method, tt.path, bytes.NewReader(b))
+		r.Header.Set("Authorization", "Bearer o")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%d: %s %s %s code mismatch:\n  exp=%d\n  got=%d %s\n\n", i, tt.method, tt.path, tt.sql, tt.code, w.Code, w.Body.String())
+		}
+	}
+	if udfManager.HasFunction("apiFunc") {
+		t.Errorf("the operator creates function apiFunc by the stream api")
+	}
+	if s, _ := streamProcessor.ShowStream(xsql.TypeTable); len(s) != 0 {
+		t.Errorf("the table is created by the stream api, got %v", s)
+	}
+}
+
+type testRpcServer int
+
+func (t *testRpcServer) ShowRules(_ int, reply *string) error {
+	*reply = "rules"
+	return nil
+}
+
+func (t *testRpcServer) DropRule(name string, reply *string) error {
+	*reply = "dropped " + name
+	return nil
+}
+
+func (t *testRpcServer) CreatePlugin(name string, reply *string) error {
+	*reply = "created " + name
+	return nil
+}
+
+func (t *testRpcServer) Stream(stmt string, reply *string) error {
+	*reply = "run " + stmt
+	return nil
+}
+
+func dialRpc(t *testing.T, addr string, token string) (*rpc.Client, string) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(conn, "CONNECT %s HTTP/1.0\nAuthorization: Bearer %s\n\n", rpc.DefaultRPCPath, token)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, resp.Status
+	}
+	return rpc.NewClient(conn), ""
+}
+
+func TestRpcAuth(t *testing.T) {
+	a, err := newAuthenticator(&common.AuthConf{
+		Tokens: []*common.TokenConf{{Token: "v", Role: "viewer"}, {Token: "o", Role: "operator"}, {Token: "a", Role: "admin"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("Server", new(testRpcServer)); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(a.rpcHandler(srv))
+	defer ts.Close()
+	addr := strings.TrimPrefix(ts.URL, "http://")
+
+	if _, status := dialRpc(t, addr, "x"); status != "401 Unauthorized" {
+		t.Errorf("connect with invalid token status mismatch, got %s", status)
+	}
+
+	var tests = []struct {
+		token  string
+		method string
+		arg    interface{}
+		reply  string
+		err    string
+	}{
+		{token: "v", method: "Server.ShowRules", arg: 0, reply: "rules"},
+		{token: "v", method: "Server.DropRule", arg: "r1", err: "forbidden: operator role is required to call Server.DropRule"},
+		{token: "v", method: "Server.Stream", arg: "show streams", reply: "run show streams"},
+		{token: "v", method: "Server.Stream", arg: "drop stream demo", err: "forbidden: operator role is required to call Server.Stream"},
+		{token: "o", method: "Server.Stream", arg: "drop stream demo", reply: "run drop stream demo"},
+		{token: "o", method: "Server.DropRule", arg: "r1", reply: "dropped r1"},
+		{token: "o", method: "Server.Stream", arg: "CREATE FUNCTION f1(a) AS a+1", err: "forbidden: admin role is required to call Server.Stream"},
+		{token: "o", method: "Server.CreatePlugin", arg: "p1", err: "forbidden: admin role is required to call Server.CreatePlugin"},
+		{token: "a", method: "Server.CreatePlugin", arg: "p1", reply: "created p1"},
+		{token: "a", method: "Server.Stream", arg: "CREATE FUNCTION f1(a) AS a+1", reply: "run CREATE FUNCTION f1(a) AS a+1"},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	clients := make(map[string]*rpc.Client)
+	for i, tt := range tests {
+		c, ok := clients[tt.token]
+		if !ok {
+			var status string
+			c, status = dialRpc(t, addr, tt.token)
+			if c == nil {
+				t.Fatalf("%d: connect error %s", i, status)
+			}
+			defer c.Close()
+			clients[tt.token] = c
+		}
+		var reply string
+		err := c.Call(tt.method, tt.arg, &reply)
+		if !reflect.DeepEqual(tt.err, common.Errstring(err)) {
+			t.Errorf("%d: %s error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.method, tt.err, err)
+		} else if tt.reply != reply {
+			t.Errorf("%d: %s reply mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.method, tt.reply, reply)
+		}
+	}
+}
@@ -0,0 +1,593 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/emqx/kuiper/plugins"
+	"github.com/emqx/kuiper/services"
+	"github.com/emqx/kuiper/xsql"
+	"github.com/emqx/kuiper/xsql/processors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const bundleVersion = "1"
+
+// bundle is the whole configuration of a node. The sections are declared in the order they are imported so that the
+// dependencies are created before the items depending on them. The secret values are never exported, the references
+// are kept as they are and the secrets must be created in the target node.
+type bundle struct {
+	Version string `json:"version"`
+	// The plugin registrations by type and name. A plugin which is installed manually only has its name.
+	Plugins map[string]map[string]json.RawMessage `json:"plugins,omitempty"`
+	// The file url of the services by name. It is empty if the service is installed manually.
+	Services map[string]string `json:"services,omitempty"`
+	// The properties of the confKeys by source name and confKey
+	SourceConfig map[string]map[string]json.RawMessage `json:"sourceConfig,omitempty"`
+	Functions    map[string]string                     `json:"functions,omitempty"`
+	Streams      map[string]string                     `json:"streams,omitempty"`
+	Tables       map[string]string                     `json:"tables,omitempty"`
+	Rules        map[string]json.RawMessage            `json:"rules,omitempty"`
+}
+
+// The conflict policies of import for the items which already exist in the node
+const (
+	// Keep the existing item
+	policySkip = "skip"
+	// Replace the existing item by the one in the bundle
+	policyReplace = "replace"
+	// Abort the whole import before any change if there is a conflict or an invalid item
+	policyFail = "fail"
+)
+
+const (
+	actionCreate  = "create"
+	actionReplace = "replace"
+	actionSkip    = "skip"
+)
+
+type importResult struct {
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+// importReport lists the result of each item in the import order. In dry run, the results are the planned actions and
+// the validation errors.
+type importReport struct {
+	DryRun    bool            `json:"dryRun"`
+	Policy    string          `json:"policy"`
+	Aborted   bool            `json:"aborted"`
+	Succeeded int             `json:"succeeded"`
+	Skipped   int             `json:"skipped"`
+	Failed    int             `json:"failed"`
+	Results   []*importResult `json:"results"`
+}
+
+type importItem struct {
+	result *importResult
+	apply  func(replace bool) error
+}
+
+// Only one import or export runs at a time so that the bundle is consistent
+var bundleMutex sync.Mutex
+
+func exportBundle() (*bundle, error) {
+	bundleMutex.Lock()
+	defer bundleMutex.Unlock()
+	b := &bundle{
+		Version:      bundleVersion,
+		Plugins:      make(map[string]map[string]json.RawMessage),
+		Services:     make(map[string]string),
+		SourceConfig: make(map[string]map[string]json.RawMessage),
+		Functions:    make(map[string]string),
+		Rules:        make(map[string]json.RawMessage),
+	}
+	for t := plugins.SOURCE; t <= plugins.PORTABLE; t++ {
+		names, err := pluginManager.List(t)
+		if err != nil {
+			return nil, fmt.Errorf("fail to list %s plugins: %v", plugins.PluginTypes[t], err)
+		}
+		for _, name := range names {
+			if r, ok := pluginManager.Get(t, name); !ok || r["version"] == plugins.DELETED {
+				continue
+			}
+			j, ok := pluginManager.GetInstallation(t, name)
+			if !ok {
+				j = plugins.NewPluginByType(t)
+				j.SetName(name)
+			}
+			raw, err := json.Marshal(j)
+			if err != nil {
+				return nil, err
+			}
+			if b.Plugins[plugins.PluginTypes[t]] == nil {
+				b.Plugins[plugins.PluginTypes[t]] = make(map[string]json.RawMessage)
+			}
+			b.Plugins[plugins.PluginTypes[t]][name] = raw
+		}
+	}
+	names, err := serviceManager.List()
+	if err != nil {
+		return nil, fmt.Errorf("fail to list services: %v", err)
+	}
+	for _, name := range names {
+		b.Services[name], _ = serviceManager.GetFile(name)
+	}
+	for _, src := range plugins.GetSources() {
+		c, err := plugins.GetSourceConf(src.Name, "en_US")
+		if err != nil {
+			return nil, fmt.Errorf("fail to read the configuration of source %s: %v", src.Name, err)
+		}
+		conf := make(map[string]json.RawMessage)
+		if err := json.Unmarshal(c, &conf); err != nil {
+			return nil, fmt.Errorf("invalid configuration of source %s: %v", src.Name, err)
+		}
+		if len(conf) > 0 {
+			b.SourceConfig[src.Name] = conf
+		}
+	}
+	if names, err = udfManager.List(); err != nil {
+		return nil, fmt.Errorf("fail to list functions: %v", err)
+	}
+	for _, name := range names {
+		if b.Functions[name], err = udfManager.GetStatement(name); err != nil {
+			return nil, err
+		}
+	}
+	if b.Streams, err = listStatements(xsql.TypeStream); err != nil {
+		return nil, err
+	}
+	if b.Tables, err = listStatements(xsql.TypeTable); err != nil {
+		return nil, err
+	}
+	if names, err = ruleProcessor.GetAllRules(); err != nil {
+		return nil, fmt.Errorf("fail to list rules: %v", err)
+	}
+	for _, name := range names {
+		r, err := ruleProcessor.ExecDesc(name)
+		if err != nil {
+			return nil, err
+		}
+		b.Rules[name] = json.RawMessage(strings.TrimSpace(r))
+	}
+	return b, nil
+}
+
+// importBundle validates all the items of the bundle and plans their actions by the conflict policy, then applies them
+// in the dependency order unless it is a dry run. A failed item does not stop the others, so the report must be
+// checked for the partial failures. The error is returned only if the bundle or the policy is invalid.
+func importBundle(content []byte, policy string, dryRun bool) (*importReport, error) {
+	if policy == "" {
+		policy = policySkip
+	}
+	switch policy {
+	case policySkip, policyReplace, policyFail:
+	default:
+		return nil, fmt.Errorf("invalid conflict policy %s, expect skip, replace or fail", policy)
+	}
+	b := &bundle{}
+	if err := json.Unmarshal(content, b); err != nil {
+		return nil, fmt.Errorf("invalid bundle: %v", err)
+	}
+	if b.Version != bundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %q, expect %s", b.Version, bundleVersion)
+	}
+	bundleMutex.Lock()
+	defer bundleMutex.Unlock()
+
+	sections := planBundle(b, policy)
+	report := &importReport{DryRun: dryRun, Policy: policy, Results: make([]*importResult, 0)}
+	for _, items := range sections {
+		for _, item := range items {
+			report.Results = append(report.Results, item.result)
+		}
+	}
+	if policy == policyFail {
+		for _, r := range report.Results {
+			if r.Error != "" {
+				report.Aborted = true
+			}
+		}
+	}
+	if !dryRun && !report.Aborted {
+		for i, items := range sections {
+			// The user-defined functions may call each other, so the failed ones are retried until no more progress
+			applyItems(items, i == functionSection)
+		}
+	}
+	for _, r := range report.Results {
+		switch {
+		case r.Error != "":
+			report.Failed++
+		case r.Action == actionSkip:
+			report.Skipped++
+		default:
+			report.Succeeded++
+		}
+	}
+	return report, nil
+}
+
+func applyItems(items []*importItem, retry bool) {
+	pending := make([]*importItem, 0, len(items))
+	for _, item := range items {
+		if item.result.Error == "" && item.result.Action != actionSkip {
+			pending = append(pending, item)
+		}
+	}
+	for len(pending) > 0 {
+		failed := pending[:0:0]
+		for _, item := range pending {
+			if err := item.apply(item.result.Action == actionReplace); err != nil {
+				item.result.Error = err.Error()
+				failed = append(failed, item)
+			} else {
+				item.result.Error = ""
+			}
+		}
+		if !retry || len(failed) == len(pending) {
+			break
+		}
+		pending = failed
+	}
+}
+
+const functionSection = 3
+
+// planBundle returns the items of each section in the import order
+func planBundle(b *bundle, policy string) [][]*importItem {
+	return [][]*importItem{
+		planPlugins(b, policy),
+		planServices(b, policy),
+		planSourceConfig(b, policy),
+		planFunctions(b, policy),
+		planStreams(b.Streams, xsql.TypeStream, policy),
+		planStreams(b.Tables, xsql.TypeTable, policy),
+		planRules(b, policy),
+	}
+}
+
+// newItem decides the action of an item by whether it exists and the policy
+func newItem(typ, name string, exists bool, policy string, err error, apply func(replace bool) error) *importItem {
+	r := &importResult{Type: typ, Name: name, Action: actionCreate}
+	if exists {
+		switch policy {
+		case policyReplace:
+			r.Action = actionReplace
+		case policyFail:
+			r.Action = actionSkip
+			if err == nil {
+				err = fmt.Errorf("%s %s already exists", typ, name)
+			}
+		default:
+			r.Action = actionSkip
+		}
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return &importItem{result: r, apply: apply}
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch t := m.(type) {
+	case map[string]string:
+		for k := range t {
+			keys = append(keys, k)
+		}
+	case map[string]json.RawMessage:
+		for k := range t {
+			keys = append(keys, k)
+		}
+	case map[string]map[string]json.RawMessage:
+		for k := range t {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func planPlugins(b *bundle, policy string) []*importItem {
+	var items []*importItem
+	for _, tn := range sortedKeys(b.Plugins) {
+		t := plugins.PluginType(-1)
+		for i, n := range plugins.PluginTypes {
+			if n == tn {
+				t = plugins.PluginType(i)
+			}
+		}
+		for _, name := range sortedKeys(b.Plugins[tn]) {
+			name := name
+			typ := "plugin " + tn
+			if t < 0 {
+				items = append(items, newItem(typ, name, false, policy, fmt.Errorf("invalid plugin type %s", tn), nil))
+				continue
+			}
+			j := plugins.NewPluginByType(t)
+			err := json.Unmarshal(b.Plugins[tn][name], j)
+			if err != nil {
+				err = fmt.Errorf("invalid plugin %s: %v", name, err)
+			}
+			j.SetName(name)
+			r, exists := pluginManager.Get(t, name)
+			if exists && r["version"] == plugins.DELETED {
+				err = fmt.Errorf("plugin %s is marked as deleted, restart the node before importing it", name)
+			} else if !exists && err == nil && j.GetFile() == "" {
+				err = fmt.Errorf("plugin %s has no file url, it must be installed manually", name)
+			}
+			item := newItem(typ, name, exists, policy, err, func(replace bool) error {
+				if replace {
+					if err := pluginManager.Delete(t, name, true); err != nil {
+						return err
+					}
+				}
+				return pluginManager.Register(t, j)
+			})
+			// The native plugins cannot be reloaded at runtime, so the existing ones are always kept
+			if exists && t != plugins.PORTABLE && item.result.Action == actionReplace {
+				item.result.Action = actionSkip
+			}
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func planServices(b *bundle, policy string) []*importItem {
+	var items []*importItem
+	for _, name := range sortedKeys(b.Services) {
+		req := &services.ServiceCreationRequest{Name: name, File: b.Services[name]}
+		_, err := serviceManager.Get(name)
+		exists := err == nil
+		err = nil
+		if req.File == "" {
+			err = fmt.Errorf("service %s has no file url, it must be installed manually", name)
+			if exists && policy != policyFail {
+				err = nil
+			}
+		}
+		item := newItem("service", name, exists, policy, err, func(replace bool) error {
+			if replace {
+				return serviceManager.Update(req)
+			}
+			return serviceManager.Create(req)
+		})
+		// The service cannot be installed again without the file url
+		if req.File == "" && item.result.Action == actionReplace {
+			item.result.Action = actionSkip
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func planSourceConfig(b *bundle, policy string) []*importItem {
+	sources := make(map[string]bool)
+	for _, src := range plugins.GetSources() {
+		sources[src.Name] = true
+	}
+	for _, tn := range []string{plugins.PluginTypes[plugins.SOURCE], plugins.PluginTypes[plugins.PORTABLE]} {
+		for name := range b.Plugins[tn] {
+			sources[name] = true
+		}
+	}
+	var items []*importItem
+	for _, src := range sortedKeys(b.SourceConfig) {
+		keys := make(map[string]bool)
+		for _, k := range plugins.GetSourceConfKeys(src) {
+			keys[k] = true
+		}
+		for _, confKey := range sortedKeys(b.SourceConfig[src]) {
+			src, confKey := src, confKey
+			var (
+				content = b.SourceConfig[src][confKey]
+				err     error
+				props   map[string]interface{}
+			)
+			if !sources[src] {
+				err = fmt.Errorf("source %s is not found", src)
+			} else if e := json.Unmarshal(content, &props); e != nil {
+				err = fmt.Errorf("invalid properties of %s: %v", confKey, e)
+			}
+			items = append(items, newItem("source config", src+"/"+confKey, keys[confKey], policy, err, func(replace bool) error {
+				if replace {
+					if err := plugins.DelSourceConfKey(src, confKey, "en_US"); err != nil {
+						return err
+					}
+				}
+				return plugins.AddSourceConfKey(src, confKey, "en_US", content)
+			}))
+		}
+	}
+	return items
+}
+
+func planFunctions(b *bundle, policy string) []*importItem {
+	var items []*importItem
+	for _, name := range sortedKeys(b.Functions) {
+		name := name
+		statement := b.Functions[name]
+		var err error
+		stmt, e := xsql.NewParser(strings.NewReader(statement)).ParseCreateStmt()
+		if e != nil {
+			err = e
+		} else if s, ok := stmt.(*xsql.FunctionStmt); !ok {
+			err = fmt.Errorf("invalid function statement: %s", statement)
+		} else if !strings.EqualFold(s.Name, name) {
+			err = fmt.Errorf("function name %s is not consistent with the statement", name)
+		}
+		_, e = udfManager.Describe(name)
+		items = append(items, newItem("function", name, e == nil, policy, err, func(replace bool) error {
+			if replace {
+				if _, err := processors.ExecDropFunction(name); err != nil {
+					return err
+				}
+			}
+			_, err := processors.ExecCreateFunction(statement)
+			return err
+		}))
+	}
+	return items
+}
+
+func planStreams(m map[string]string, st xsql.StreamType, policy string) []*importItem {
+	var (
+		items []*importItem
+		typ   = xsql.StreamTypeMap[st]
+	)
+	for _, name := range sortedKeys(m) {
+		statement := m[name]
+		err := validateStream(name, statement, st)
+		info, e := streamProcessor.GetStatement(name)
+		exists := e == nil
+		if exists && info.StreamType != st && err == nil {
+			err = fmt.Errorf("%s %s already exists as a %s", typ, name, xsql.StreamTypeMap[info.StreamType])
+		}
+		items = append(items, newItem(typ, name, exists, policy, err, func(replace bool) error {
+			if replace {
+				_, err := streamProcessor.ExecReplaceStream(statement, st)
+				return err
+			}
+			_, err := streamProcessor.ExecStmt(statement)
+			return err
+		}))
+	}
+	return items
+}
+
+func planRules(b *bundle, policy string) []*importItem {
+	var items []*importItem
+	funcs, hasPortables := bundleFunctions(b)
+	for _, name := range sortedKeys(b.Rules) {
+		name := name
+		ruleJson := string(b.Rules[name])
+		pending := funcs
+		// The rule may call the functions of the portable plugins which are validated when the rule is created
+		if hasPortables {
+			pending = make(map[string]bool)
+			for f := range funcs {
+				pending[f] = true
+			}
+			r := &struct {
+				Sql string `json:"sql"`
+			}{}
+			_ = json.Unmarshal(b.Rules[name], r)
+			for _, f := range xsql.GetFunctionCalls(r.Sql) {
+				pending[strings.ToLower(f)] = true
+			}
+		}
+		_, start, err := validateRule(name, b.Rules[name], pending, func(s string) bool {
+			if _, ok := b.Streams[s]; ok {
+				return true
+			}
+			if _, ok := b.Tables[s]; ok {
+				return true
+			}
+			_, e := streamProcessor.GetStatement(s)
+			return e == nil
+		})
+		_, e := ruleProcessor.GetRuleByName(name)
+		items = append(items, newItem("rule", name, e == nil, policy, err, func(replace bool) error {
+			if replace {
+				deleteRule(name)
+				if _, err := ruleProcessor.ExecUpdate(name, ruleJson); err != nil {
+					return err
+				}
+			} else if _, err := ruleProcessor.ExecCreate(name, ruleJson); err != nil {
+				return err
+			}
+			if !start {
+				registry.Store(name, &RuleState{Name: name})
+				return nil
+			}
+			return startRule(name)
+		}))
+	}
+	return items
+}
+
+// bundleFunctions returns the lowercase names of the functions in the bundle. They are created before the rules, so the
+// rules are validated with them as known functions. The functions of the portable plugins are only known after the
+// plugins are installed, so it also returns whether the bundle has portable plugins.
+func bundleFunctions(b *bundle) (map[string]bool, bool) {
+	funcs := make(map[string]bool)
+	for name := range b.Functions {
+		funcs[strings.ToLower(name)] = true
+	}
+	for name, raw := range b.Plugins[plugins.PluginTypes[plugins.FUNCTION]] {
+		fp := &plugins.FuncPlugin{}
+		if err := json.Unmarshal(raw, fp); err != nil || len(fp.Functions) == 0 {
+			funcs[strings.ToLower(name)] = true
+			continue
+		}
+		for _, f := range fp.Functions {
+			funcs[strings.ToLower(f)] = true
+		}
+	}
+	return funcs, len(b.Plugins[plugins.PluginTypes[plugins.PORTABLE]]) > 0
+}
+
+// listStatements returns the statements of the streams or tables by name
+func listStatements(st xsql.StreamType) (map[string]string, error) {
+	names, err := streamProcessor.ShowStream(st)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string, len(names))
+	for _, name := range names {
+		info, err := streamProcessor.GetStatement(name)
+		if err != nil {
+			return nil, err
+		}
+		result[name] = info.Statement
+	}
+	return result, nil
+}
+
+func validateStream(name, statement string, st xsql.StreamType) error {
+	typ := xsql.StreamTypeMap[st]
+	stmt, err := xsql.NewParser(strings.NewReader(statement)).ParseCreateStmt()
+	if err != nil {
+		return err
+	}
+	if s, ok := stmt.(*xsql.StreamStmt); !ok || s.StreamType != st {
+		return fmt.Errorf("invalid %s statement: %s", typ, statement)
+	} else if string(s.Name) != name {
+		return fmt.Errorf("%s name %s is not consistent with the statement", typ, name)
+	}
+	return nil
+}
+
+// validateRule checks the rule definition and whether the streams and tables it uses exist. The calls of the pending
+// functions are not validated because they are not created yet. It returns the streams and tables of the rule and
+// whether the rule is started, which is true unless the triggered is false explicitly.
+func validateRule(name string, raw json.RawMessage, pendingFuncs map[string]bool, exists func(string) bool) ([]string, bool, error) {
+	r := &struct {
+		Id        string `json:"id"`
+		Sql       string `json:"sql"`
+		Triggered *bool  `json:"triggered"`
+	}{}
+	if err := json.Unmarshal(raw, r); err != nil {
+		return nil, false, fmt.Errorf("invalid rule %s: %v", name, err)
+	}
+	start := r.Triggered == nil || *r.Triggered
+	if r.Id != "" && r.Id != name {
+		return nil, start, fmt.Errorf("rule name %s is not consistent with the rule id %s", name, r.Id)
+	}
+	stmt, err := xsql.GetStatementWithPendingFuncs(r.Sql, pendingFuncs)
+	if err != nil {
+		return nil, start, err
+	}
+	sources := xsql.GetStreams(stmt)
+	for _, s := range sources {
+		if !exists(s) {
+			return sources, start, fmt.Errorf("stream or table %s of rule %s is not found", s, name)
+		}
+	}
+	return sources, start, nil
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/plugins"
+	"github.com/emqx/kuiper/services"
+	"github.com/emqx/kuiper/udf"
+	"github.com/emqx/kuiper/xsql"
+	"github.com/emqx/kuiper/xsql/processors"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func setupBundleTest(t *testing.T) string {
+	common.IsTesting = true
+	common.InitConf()
+	dbDir, err := common.GetDataLoc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := path.Join(dbDir, "bundle")
+	os.RemoveAll(dir)
+	ruleProcessor = processors.NewRuleProcessor(dir)
+	streamProcessor = processors.NewStreamProcessor(path.Join(dir, "stream"))
+	if pluginManager, err = plugins.NewPluginManager(); err != nil {
+		t.Fatal(err)
+	}
+	if serviceManager, err = services.GetServiceManager(); err != nil {
+		t.Fatal(err)
+	}
+	if udfManager, err = udf.GetManager(); err != nil {
+		t.Fatal(err)
+	}
+	registry = &RuleRegistry{internal: make(map[string]*RuleState)}
+	return dir
+}
+
+func TestImportBundle(t *testing.T) {
+	dir := setupBundleTest(t)
+	defer os.RemoveAll(dir)
+
+	content := `{
+		"version": "1",
+		"streams": {"demoBundle": "CREATE STREAM demoBundle () WITH (DATASOURCE=\"demo\", FORMAT=\"JSON\")"},
+		"tables": {"tableBundle": "CREATE TABLE tableBundle () WITH (DATASOURCE=\"lookup.json\", FORMAT=\"JSON\", TYPE=\"file\")"},
+		"rules": {
+			"ruleBundle": {"id":"ruleBundle","sql":"SELECT * FROM demoBundle","actions":[{"log":{}}],"triggered":false},
+			"ruleMissing": {"id":"ruleMissing","sql":"SELECT * FROM unknownStream","actions":[{"log":{}}],"triggered":false}
+		}
+	}`
+	missing := &importResult{Type: "rule", Name: "ruleMissing", Action: actionCreate, Error: "stream or table unknownStream of rule ruleMissing is not found"}
+	var tests = []struct {
+		content string
+		policy  string
+		dryRun  bool
+		report  *importReport
+		err     string
+	}{
+		{
+			content: `{"version": "2"}`,
+			err:     `unsupported bundle version "2", expect 1`,
+		}, {
+			content: content,
+			policy:  "merge",
+			err:     "invalid conflict policy merge, expect skip, replace or fail",
+		}, {
+			content: content,
+			dryRun:  true,
+			report: &importReport{DryRun: true, Policy: policySkip, Succeeded: 3, Failed: 1, Results: []*importResult{
+				{Type: "stream", Name: "demoBundle", Action: actionCreate},
+				{Type: "table", Name: "tableBundle", Action: actionCreate},
+				{Type: "rule", Name: "ruleBundle", Action: actionCreate},
+				missing,
+			}},
+		}, {
+			content: content,
+			report: &importReport{Policy: policySkip, Succeeded: 3, Failed: 1, Results: []*importResult{
+				{Type: "stream", Name: "demoBundle", Action: actionCreate},
+				{Type: "table", Name: "tableBundle", Action: actionCreate},
+				{Type: "rule", Name: "ruleBundle", Action: actionCreate},
+				missing,
+			}},
+		}, {
+			content: content,
+			policy:  policySkip,
+			report: &importReport{Policy: policySkip, Skipped: 3, Failed: 1, Results: []*importResult{
+				{Type: "stream", Name: "demoBundle", Action: actionSkip},
+				{Type: "table", Name: "tableBundle", Action: actionSkip},
+				{Type: "rule", Name: "ruleBundle", Action: actionSkip},
+				missing,
+			}},
+		}, {
+			content: content,
+			policy:  policyFail,
+			report: &importReport{Policy: policyFail, Aborted: true, Failed: 4, Results: []*importResult{
+				{Type: "stream", Name: "demoBundle", Action: actionSkip, Error: "stream demoBundle already exists"},
+				{Type: "table", Name: "tableBundle", Action: actionSkip, Error: "table tableBundle already exists"},
+				{Type: "rule", Name: "ruleBundle", Action: actionSkip, Error: "rule ruleBundle already exists"},
+				missing,
+			}},
+		}, {
+			content: content,
+			policy:  policyReplace,
+			report: &importReport{Policy: policyReplace, Succeeded: 3, Failed: 1, Results: []*importResult{
+				{Type: "stream", Name: "demoBundle", Action: actionReplace},
+				{Type: "table", Name: "tableBundle", Action: actionReplace},
+				{Type: "rule", Name: "ruleBundle", Action: actionReplace},
+				missing,
+			}},
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		r, err := importBundle([]byte(tt.content), tt.policy, tt.dryRun)
+		if !reflect.DeepEqual(tt.err, common.Errstring(err)) {
+			t.Errorf("%d: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.err, err)
+		} else if !reflect.DeepEqual(tt.report, r) {
+			e, _ := json.Marshal(tt.report)
+			g, _ := json.Marshal(r)
+			t.Errorf("%d: report mismatch:\n  exp=%s\n  got=%s\n\n", i, e, g)
+		}
+	}
+
+	// The imported items are exported as they are
+	b, err := exportBundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &bundle{}
+	json.Unmarshal([]byte(content), src)
+	if !reflect.DeepEqual(src.Streams, b.Streams) || !reflect.DeepEqual(src.Tables, b.Tables) {
+		t.Errorf("exported streams mismatch, got %v %v", b.Streams, b.Tables)
+	}
+	exp, got := &bytes.Buffer{}, &bytes.Buffer{}
+	json.Compact(exp, src.Rules["ruleBundle"])
+	json.Compact(got, b.Rules["ruleBundle"])
+	if len(b.Rules) != 1 || exp.String() != got.String() {
+		t.Errorf("exported rules mismatch, got %v", b.Rules)
+	}
+	if rs, ok := registry.Load("ruleBundle"); !ok || rs.Triggered {
+		t.Errorf("the stopped rule should be registered without running")
+	}
+}
+
+func TestImportBundleFunctions(t *testing.T) {
+	dir := setupBundleTest(t)
+	defer os.RemoveAll(dir)
+	xsql.InitFuncRegisters(serviceManager, pluginManager, udfManager)
+	defer udfManager.Drop("bundleDouble")
+
+	content := `{
+		"version": "1",
+		"functions": {"bundleDouble": "CREATE FUNCTION bundleDouble(a) AS \"a * 2\""},
+		"streams": {"demoFunc": "CREATE STREAM demoFunc (size BIGINT) WITH (DATASOURCE=\"demo\", FORMAT=\"JSON\")"},
+		"rules": {
+			"ruleFunc": {"id":"ruleFunc","sql":"SELECT bundleDouble(size) AS d FROM demoFunc","actions":[{"log":{}}],"triggered":false},
+			"ruleUnknownFunc": {"id":"ruleUnknownFunc","sql":"SELECT unknownFunc(size) FROM demoFunc","actions":[{"log":{}}],"triggered":false},
+			"ruleBadArgs": {"id":"ruleBadArgs","sql":"SELECT bundleDouble(abs(size, 1)) FROM demoFunc","actions":[{"log":{}}],"triggered":false}
+		}
+	}`
+	results := func(action string) []*importResult {
+		return []*importResult{
+			{Type: "function", Name: "bundleDouble", Action: action},
+			{Type: "stream", Name: "demoFunc", Action: action},
+			{Type: "rule", Name: "ruleBadArgs", Action: actionCreate, Error: "Parse SQL SELECT bundleDouble(abs(size, 1)) FROM demoFunc error: The arguments for abs should be 1.."},
+			{Type: "rule", Name: "ruleFunc", Action: action},
+			{Type: "rule", Name: "ruleUnknownFunc", Action: actionCreate, Error: "Parse SQL SELECT unknownFunc(size) FROM demoFunc error: error getting function unknownFunc: not found."},
+		}
+	}
+	var tests = []struct {
+		dryRun bool
+		report *importReport
+	}{
+		{
+			dryRun: true,
+			report: &importReport{DryRun: true, Policy: policySkip, Succeeded: 3, Failed: 2, Results: results(actionCreate)},
+		}, {
+			report: &importReport{Policy: policySkip, Succeeded: 3, Failed: 2, Results: results(actionCreate)},
+		}, {
+			report: &importReport{Policy: policySkip, Skipped: 3, Failed: 2, Results: results(actionSkip)},
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		r, err := importBundle([]byte(content), policySkip, tt.dryRun)
+		if err != nil {
+			t.Errorf("%d: import error: %v", i, err)
+		} else if !reflect.DeepEqual(tt.report, r) {
+			e, _ := json.Marshal(tt.report)
+			g, _ := json.Marshal(r)
+			t.Errorf("%d: report mismatch:\n  exp=%s\n  got=%s\n\n", i, e, g)
+		}
+	}
+	if _, err := ruleProcessor.GetRuleByName("ruleFunc"); err != nil {
+		t.Errorf("the rule using the function of the bundle is not created: %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/emqx/kuiper/common"
+)
+
+// jwtVerifier verifies the signature and the registered claims of the JWT tokens signed by the configured key. The
+// RS, PS, ES and EdDSA algorithms are supported.
+type jwtVerifier struct {
+	key       crypto.PublicKey
+	issuer    string
+	audience  string
+	roleClaim string
+}
+
+func newJwtVerifier(conf *common.JwtConf) (*jwtVerifier, error) {
+	b, err := ioutil.ReadFile(conf.PublicKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read jwt public key file: %v", err)
+	}
+	key, err := parsePublicKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwt public key file %s: %v", conf.PublicKeyFile, err)
+	}
+	roleClaim := conf.RoleClaim
+	if roleClaim == "" {
+		roleClaim = "role"
+	}
+	return &jwtVerifier{
+		key:       key,
+		issuer:    conf.Issuer,
+		audience:  conf.Audience,
+		roleClaim: roleClaim,
+	}, nil
+}
+
+func parsePublicKey(b []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data is found")
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM type %s", block.Type)
+	}
+}
+
+// verify returns the claims of a valid token
+func (v *jwtVerifier) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+	header := struct {
+		Alg string `json:"alg"`
+	}{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid token header: %v", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token signature: %v", err)
+	}
+	if err := v.verifySignature(header.Alg, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+	claims := make(map[string]interface{})
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %v", err)
+	}
+	now := float64(time.Now().Unix())
+	if exp, ok := claims["exp"].(float64); ok && now >= exp {
+		return nil, fmt.Errorf("token is expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now < nbf {
+		return nil, fmt.Errorf("token is not valid yet")
+	}
+	if v.issuer != "" && claims["iss"] != v.issuer {
+		return nil, fmt.Errorf("invalid token issuer %v", claims["iss"])
+	}
+	if v.audience != "" && !hasAudience(claims["aud"], v.audience) {
+		return nil, fmt.Errorf("invalid token audience %v", claims["aud"])
+	}
+	return claims, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func hasAudience(aud interface{}, expected string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == expected
+	case []interface{}:
+		for _, e := range a {
+			if e == expected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (v *jwtVerifier) verifySignature(alg string, signed string, sig []byte) error {
+	if alg == "EdDSA" {
+		key, ok := v.key.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s does not match the public key", alg)
+		}
+		if !ed25519.Verify(key, []byte(signed), sig) {
+			return fmt.Errorf("invalid token signature")
+		}
+		return nil
+	}
+	var hash crypto.Hash
+	if len(alg) == 5 {
+		switch alg[2:] {
+		case "256":
+			hash = crypto.SHA256
+		case "384":
+			hash = crypto.SHA384
+		case "512":
+			hash = crypto.SHA512
+		}
+	}
+	if hash == 0 || !hash.Available() {
+		return fmt.Errorf("unsupported algorithm %s", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+	var err error
+	switch alg[:2] {
+	case "RS":
+		key, ok := v.key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s does not match the public key", alg)
+		}
+		err = rsa.VerifyPKCS1v15(key, hash, digest, sig)
+	case "PS":
+		key, ok := v.key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s does not match the public key", alg)
+		}
+		err = rsa.VerifyPSS(key, hash, digest, sig, nil)
+	case "ES":
+		key, ok := v.key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s does not match the public key", alg)
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return fmt.Errorf("invalid token signature")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			err = fmt.Errorf("invalid token signature")
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm %s", alg)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid token signature")
+	}
+	return nil
+}
@@ -0,0 +1,482 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/services"
+	"github.com/emqx/kuiper/xsql"
+	"github.com/emqx/kuiper/xstream/api"
+	"github.com/go-yaml/yaml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The kinds of drift between the manifest and the node
+const (
+	// In the manifest but not in the node
+	driftMissing = "missing"
+	// The definition in the node is different from the manifest
+	driftChanged = "changed"
+	// In the node but not in the manifest
+	driftExtra = "extra"
+	// The rule should run but it is stopped
+	driftStopped = "stopped"
+	// The rule should be stopped but it is running
+	driftRunning = "running"
+	// The rule runs with the old definition of its streams or tables which are changed
+	driftStale = "stale"
+	// The rule is in sync but its definition in the manifest is invalid, e.g. its stream is deleted
+	driftInvalid = "invalid"
+)
+
+const (
+	reconcileCreate  = "create"
+	reconcileUpdate  = "update"
+	reconcileDelete  = "delete"
+	reconcileStart   = "start"
+	reconcileStop    = "stop"
+	reconcileRestart = "restart"
+	// The drift is only reported, e.g. the extra items when prune is disabled
+	reconcileNone = "none"
+)
+
+type driftItem struct {
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Drift  string `json:"drift"`
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+	apply  func() error
+}
+
+// reconcileStatus is the result of the last reconciliation. The drift lists what was found and the action taken, and
+// inSync is true if all the drift is fixed.
+type reconcileStatus struct {
+	Path     string       `json:"path"`
+	Prune    bool         `json:"prune"`
+	LastSync int64        `json:"lastSync"`
+	InSync   bool         `json:"inSync"`
+	Error    string       `json:"error,omitempty"`
+	Drift    []*driftItem `json:"drift"`
+}
+
+// reconciler converges the streams, tables, rules and services of the node to the manifest periodically. So the changes
+// made by the REST API or the CLI are reverted in the next reconciliation.
+type reconciler struct {
+	path     string
+	interval time.Duration
+	prune    bool
+	trigger  chan chan *reconcileStatus
+
+	sync.RWMutex
+	status *reconcileStatus
+}
+
+// The reconciler if the declarative management is enabled, otherwise nil
+var reconcileManager *reconciler
+
+func newReconciler(c *common.ReconcileConf) (*reconciler, error) {
+	if c.Path == "" {
+		return nil, fmt.Errorf("missing the manifest path")
+	}
+	if c.Interval < 0 {
+		return nil, fmt.Errorf("invalid interval %d, require a positive integer", c.Interval)
+	}
+	interval := 30
+	if c.Interval > 0 {
+		interval = c.Interval
+	}
+	return &reconciler{
+		path:     c.Path,
+		interval: time.Duration(interval) * time.Second,
+		prune:    c.Prune,
+		trigger:  make(chan chan *reconcileStatus),
+		status:   &reconcileStatus{Path: c.Path, Prune: c.Prune, Drift: make([]*driftItem, 0)},
+	}, nil
+}
+
+// run reconciles at start, in every interval and when triggered until stopped
+func (r *reconciler) run(stop <-chan struct{}) {
+	r.reconcile()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			r.reconcile()
+		case c := <-r.trigger:
+			c <- r.reconcile()
+		}
+	}
+}
+
+// sync reconciles immediately and returns the result
+func (r *reconciler) sync() *reconcileStatus {
+	c := make(chan *reconcileStatus, 1)
+	r.trigger <- c
+	return <-c
+}
+
+func (r *reconciler) getStatus() *reconcileStatus {
+	r.RLock()
+	defer r.RUnlock()
+	return r.status
+}
+
+func (r *reconciler) reconcile() *reconcileStatus {
+	bundleMutex.Lock()
+	defer bundleMutex.Unlock()
+	status := &reconcileStatus{
+		Path:     r.path,
+		Prune:    r.prune,
+		LastSync: common.GetNowInMilli(),
+		Drift:    make([]*driftItem, 0),
+	}
+	m, err := loadManifest(r.path)
+	if err == nil {
+		status.Drift, err = r.diff(m)
+	}
+	if err != nil {
+		status.Error = err.Error()
+		logger.Errorf("reconcile error: %v", err)
+	} else {
+		status.InSync = true
+		for _, d := range status.Drift {
+			if d.apply != nil && d.Error == "" {
+				logger.Infof("reconcile %s %s: %s for %s drift", d.Type, d.Name, d.Action, d.Drift)
+				if err := d.apply(); err != nil {
+					d.Error = err.Error()
+				}
+			}
+			if d.Error != "" {
+				logger.Errorf("reconcile %s %s error: %s", d.Type, d.Name, d.Error)
+			}
+			if d.Error != "" || d.Action == reconcileNone {
+				status.InSync = false
+			}
+		}
+	}
+	r.Lock()
+	r.status = status
+	r.Unlock()
+	return status
+}
+
+// loadManifest reads the manifest file or all the yaml and json files in the manifest folder. The manifest has the
+// format of the exported bundle, and only its streams, tables, rules and services are reconciled.
+func loadManifest(p string) (*bundle, error) {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the manifest: %v", err)
+	}
+	files := []string{p}
+	if fi.IsDir() {
+		infos, err := ioutil.ReadDir(p)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the manifest folder: %v", err)
+		}
+		files = files[:0]
+		for _, info := range infos {
+			switch filepath.Ext(info.Name()) {
+			case ".yaml", ".yml", ".json":
+				if !info.IsDir() && !strings.HasPrefix(info.Name(), ".") {
+					files = append(files, filepath.Join(p, info.Name()))
+				}
+			}
+		}
+		sort.Strings(files)
+	}
+	m := &bundle{}
+	for _, f := range files {
+		content, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the manifest file %s: %v", f, err)
+		}
+		// The json is parsed as yaml too
+		raw := make(map[interface{}]interface{})
+		if err := yaml.Unmarshal(content, &raw); err != nil {
+			return nil, fmt.Errorf("invalid manifest file %s: %v", f, err)
+		}
+		j, err := json.Marshal(common.ConvertMap(raw))
+		if err != nil {
+			return nil, fmt.Errorf("invalid manifest file %s: %v", f, err)
+		}
+		part := &bundle{}
+		if err := json.Unmarshal(j, part); err != nil {
+			return nil, fmt.Errorf("invalid manifest file %s: %v", f, err)
+		}
+		if part.Version != "" && part.Version != bundleVersion {
+			return nil, fmt.Errorf("unsupported version %q of manifest file %s, expect %s", part.Version, f, bundleVersion)
+		}
+		if part.Services != nil && m.Services == nil {
+			m.Services = make(map[string]string)
+		}
+		if part.Streams != nil && m.Streams == nil {
+			m.Streams = make(map[string]string)
+		}
+		if part.Tables != nil && m.Tables == nil {
+			m.Tables = make(map[string]string)
+		}
+		if part.Rules != nil && m.Rules == nil {
+			m.Rules = make(map[string]json.RawMessage)
+		}
+		for name, v := range part.Services {
+			if _, ok := m.Services[name]; ok {
+				return nil, fmt.Errorf("duplicate service %s in manifest file %s", name, f)
+			}
+			m.Services[name] = v
+		}
+		for name, v := range part.Streams {
+			if _, ok := m.Streams[name]; ok {
+				return nil, fmt.Errorf("duplicate stream %s in manifest file %s", name, f)
+			}
+			m.Streams[name] = v
+		}
+		for name, v := range part.Tables {
+			if _, ok := m.Tables[name]; ok {
+				return nil, fmt.Errorf("duplicate table %s in manifest file %s", name, f)
+			}
+			m.Tables[name] = v
+		}
+		for name, v := range part.Rules {
+			if _, ok := m.Rules[name]; ok {
+				return nil, fmt.Errorf("duplicate rule %s in manifest file %s", name, f)
+			}
+			m.Rules[name] = v
+		}
+	}
+	return m, nil
+}
+
+// diff compares the manifest with the node and returns the drift in the order to fix. The extra items are deleted first
+// from the rules to the services, then the others are fixed from the services to the rules. The sections which are not
+// in the manifest are not managed.
+func (r *reconciler) diff(m *bundle) ([]*driftItem, error) {
+	var (
+		extras = make(map[string][]*driftItem)
+		fixes  []*driftItem
+	)
+	addExtra := func(typ, name string, del func() error) {
+		d := &driftItem{Type: typ, Name: name, Drift: driftExtra, Action: reconcileNone}
+		if r.prune {
+			d.Action, d.apply = reconcileDelete, del
+		}
+		extras[typ] = append(extras[typ], d)
+	}
+
+	// Services
+	if m.Services != nil {
+		names, err := serviceManager.List()
+		if err != nil {
+			return nil, fmt.Errorf("fail to list services: %v", err)
+		}
+		sort.Strings(names)
+		current := make(map[string]bool)
+		for _, name := range names {
+			name := name
+			current[name] = true
+			if _, ok := m.Services[name]; !ok {
+				addExtra("service", name, func() error {
+					return serviceManager.Delete(name)
+				})
+			}
+		}
+		for _, name := range sortedKeys(m.Services) {
+			req := &services.ServiceCreationRequest{Name: name, File: m.Services[name]}
+			if !current[name] {
+				fixes = append(fixes, &driftItem{Type: "service", Name: name, Drift: driftMissing, Action: reconcileCreate, apply: func() error {
+					return serviceManager.Create(req)
+				}})
+			} else if f, _ := serviceManager.GetFile(name); f != req.File {
+				fixes = append(fixes, &driftItem{Type: "service", Name: name, Drift: driftChanged, Action: reconcileUpdate, apply: func() error {
+					return serviceManager.Update(req)
+				}})
+			}
+		}
+	}
+
+	// Streams and tables share the names. The current ones which are kept can be used by the rules.
+	desired := map[xsql.StreamType]map[string]string{xsql.TypeStream: m.Streams, xsql.TypeTable: m.Tables}
+	statements := make(map[xsql.StreamType]map[string]string)
+	currentSources := make(map[string]xsql.StreamType)
+	keptSources := make(map[string]bool)
+	for st := range desired {
+		var err error
+		if statements[st], err = listStatements(st); err != nil {
+			return nil, err
+		}
+		for name := range statements[st] {
+			currentSources[name] = st
+			if _, ok := desired[st][name]; ok || desired[st] == nil || !r.prune {
+				keptSources[name] = true
+			}
+		}
+	}
+	changedSources := make(map[string]bool)
+	for _, st := range []xsql.StreamType{xsql.TypeStream, xsql.TypeTable} {
+		if desired[st] == nil {
+			continue
+		}
+		st := st
+		typ := xsql.StreamTypeMap[st]
+		for _, name := range sortedKeys(statements[st]) {
+			name := name
+			if _, ok := desired[st][name]; !ok {
+				addExtra(typ, name, func() error {
+					_, err := streamProcessor.DropStream(name, st)
+					return err
+				})
+			}
+		}
+		for _, name := range sortedKeys(desired[st]) {
+			statement := desired[st][name]
+			old, ok := statements[st][name]
+			if ok && strings.TrimSpace(old) == strings.TrimSpace(statement) {
+				continue
+			}
+			d := &driftItem{Type: typ, Name: name, Drift: driftMissing, Action: reconcileCreate, apply: func() error {
+				_, err := streamProcessor.ExecStmt(statement)
+				return err
+			}}
+			if ok {
+				d.Drift, d.Action = driftChanged, reconcileUpdate
+				d.apply = func() error {
+					_, err := streamProcessor.ExecReplaceStream(statement, st)
+					return err
+				}
+				changedSources[name] = true
+			}
+			if err := validateStream(name, statement, st); err != nil {
+				d.Error = err.Error()
+			} else if ot, exists := currentSources[name]; exists && ot != st {
+				d.Error = fmt.Sprintf("%s %s already exists as a %s", typ, name, xsql.StreamTypeMap[ot])
+			}
+			fixes = append(fixes, d)
+		}
+	}
+
+	// Rules
+	if m.Rules != nil {
+		names, err := ruleProcessor.GetAllRules()
+		if err != nil {
+			return nil, fmt.Errorf("fail to list rules: %v", err)
+		}
+		sort.Strings(names)
+		currentRules := make(map[string]*api.Rule)
+		for _, name := range names {
+			name := name
+			if _, ok := m.Rules[name]; !ok {
+				addExtra("rule", name, func() error {
+					deleteRule(name)
+					_, err := ruleProcessor.ExecDrop(name)
+					return err
+				})
+				continue
+			}
+			if currentRules[name], err = ruleProcessor.GetRuleByName(name); err != nil {
+				return nil, err
+			}
+		}
+		for _, name := range sortedKeys(m.Rules) {
+			if d := r.diffRule(name, m, currentRules[name], keptSources, changedSources); d != nil {
+				fixes = append(fixes, d)
+			}
+		}
+	}
+
+	result := make([]*driftItem, 0)
+	for _, typ := range []string{"rule", xsql.StreamTypeMap[xsql.TypeTable], xsql.StreamTypeMap[xsql.TypeStream], "service"} {
+		result = append(result, extras[typ]...)
+	}
+	return append(result, fixes...), nil
+}
+
+// diffRule returns the drift of a rule in the manifest or nil if it is in sync
+func (r *reconciler) diffRule(name string, m *bundle, old *api.Rule, keptSources, changedSources map[string]bool) *driftItem {
+	ruleJson := string(m.Rules[name])
+	sources, start, err := validateRule(name, m.Rules[name], nil, func(s string) bool {
+		if _, ok := m.Streams[s]; ok {
+			return true
+		}
+		if _, ok := m.Tables[s]; ok {
+			return true
+		}
+		return keptSources[s]
+	})
+	var d *driftItem
+	if old == nil {
+		d = &driftItem{Type: "rule", Name: name, Drift: driftMissing, Action: reconcileCreate, apply: func() error {
+			if _, err := ruleProcessor.ExecCreate(name, ruleJson); err != nil {
+				return err
+			}
+			return runRule(name, start)
+		}}
+	} else if !sameRule(old, name, ruleJson) {
+		d = &driftItem{Type: "rule", Name: name, Drift: driftChanged, Action: reconcileUpdate, apply: func() error {
+			deleteRule(name)
+			if _, err := ruleProcessor.ExecUpdate(name, ruleJson); err != nil {
+				return err
+			}
+			return runRule(name, start)
+		}}
+	} else {
+		rs, ok := registry.Load(name)
+		running := ok && rs.Triggered
+		switch {
+		case start && !running:
+			d = &driftItem{Type: "rule", Name: name, Drift: driftStopped, Action: reconcileStart, apply: func() error {
+				return startRule(name)
+			}}
+		case !start && running:
+			d = &driftItem{Type: "rule", Name: name, Drift: driftRunning, Action: reconcileStop, apply: func() error {
+				stopRule(name)
+				return nil
+			}}
+		case running:
+			for _, s := range sources {
+				if changedSources[s] {
+					d = &driftItem{Type: "rule", Name: name, Drift: driftStale, Action: reconcileRestart, apply: func() error {
+						return restartRule(name)
+					}}
+					break
+				}
+			}
+		}
+	}
+	if err != nil {
+		if d == nil {
+			d = &driftItem{Type: "rule", Name: name, Drift: driftInvalid, Action: reconcileNone}
+		}
+		d.Error = err.Error()
+	}
+	return d
+}
+
+// runRule starts the rule or registers it as stopped
+func runRule(name string, start bool) error {
+	if !start {
+		registry.Store(name, &RuleState{Name: name})
+		return nil
+	}
+	return startRule(name)
+}
+
+// sameRule compares the definitions of the rules with the default options except the running state
+func sameRule(old *api.Rule, name, ruleJson string) bool {
+	r, err := ruleProcessor.GetRuleByJson(name, ruleJson)
+	if err != nil {
+		return false
+	}
+	o := *old
+	o.Triggered, r.Triggered = false, false
+	return reflect.DeepEqual(&o, r)
+}
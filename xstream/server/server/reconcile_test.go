@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestReconcile(t *testing.T) {
+	dir := setupBundleTest(t)
+	defer os.RemoveAll(dir)
+	manifestDir := path.Join(dir, "manifest")
+	if err := os.MkdirAll(manifestDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	streams := `
+streams:
+  demoRec: CREATE STREAM demoRec () WITH (DATASOURCE="demo", FORMAT="JSON")
+tables:
+  tableRec: CREATE TABLE tableRec () WITH (DATASOURCE="lookup.json", FORMAT="JSON", TYPE="file")
+`
+	rules := `{"rules": {"ruleRec": {"sql": "SELECT * FROM demoRec", "actions": [{"log": {}}], "triggered": false}}}`
+	var tests = []struct {
+		files  map[string]string
+		prune  bool
+		drift  []*driftItem
+		inSync bool
+		err    string
+	}{
+		{
+			files: map[string]string{"streams.yaml": streams, "rules.json": rules},
+			drift: []*driftItem{
+				{Type: "stream", Name: "demoRec", Drift: driftMissing, Action: reconcileCreate},
+				{Type: "table", Name: "tableRec", Drift: driftMissing, Action: reconcileCreate},
+				{Type: "rule", Name: "ruleRec", Drift: driftMissing, Action: reconcileCreate},
+			},
+			inSync: true,
+		}, {
+			files:  map[string]string{"streams.yaml": streams, "rules.json": rules},
+			drift:  []*driftItem{},
+			inSync: true,
+		}, {
+			files: map[string]string{
+				"streams.yaml": `{streams: {demoRec: 'CREATE STREAM demoRec (id bigint) WITH (DATASOURCE="demo", FORMAT="JSON")'}, tables: {}}`,
+				"rules.json":   `{"rules": {"ruleRec": {"sql": "SELECT id FROM demoRec", "actions": [{"log": {}}], "triggered": false}}}`,
+			},
+			drift: []*driftItem{
+				{Type: "table", Name: "tableRec", Drift: driftExtra, Action: reconcileNone},
+				{Type: "stream", Name: "demoRec", Drift: driftChanged, Action: reconcileUpdate},
+				{Type: "rule", Name: "ruleRec", Drift: driftChanged, Action: reconcileUpdate},
+			},
+			inSync: false,
+		}, {
+			files: map[string]string{
+				"streams.yaml": `{streams: {demoRec: 'CREATE STREAM demoRec (id bigint) WITH (DATASOURCE="demo", FORMAT="JSON")'}, tables: {}}`,
+				"rules.json":   `{"rules": {}}`,
+			},
+			prune: true,
+			drift: []*driftItem{
+				{Type: "rule", Name: "ruleRec", Drift: driftExtra, Action: reconcileDelete},
+				{Type: "table", Name: "tableRec", Drift: driftExtra, Action: reconcileDelete},
+			},
+			inSync: true,
+		}, {
+			files: map[string]string{
+				"streams.yaml": `{streams: {demoRec: 'CREATE STREAM demoRec (id bigint) WITH (DATASOURCE="demo", FORMAT="JSON")'}, tables: {}}`,
+				"rules.json":   `{"rules": {"ruleBad": {"sql": "SELECT * FROM unknownRec", "actions": [{"log": {}}]}}}`,
+			},
+			drift: []*driftItem{
+				{Type: "rule", Name: "ruleBad", Drift: driftMissing, Action: reconcileCreate, Error: "stream or table unknownRec of rule ruleBad is not found"},
+			},
+			inSync: false,
+		}, {
+			files: map[string]string{
+				"streams.yaml": streams,
+				"more.yml":     `streams: {demoRec: 'CREATE STREAM demoRec () WITH (DATASOURCE="demo")'}`,
+			},
+			err: "duplicate stream demoRec in manifest file " + path.Join(manifestDir, "streams.yaml"),
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		files, _ := ioutil.ReadDir(manifestDir)
+		for _, f := range files {
+			os.Remove(path.Join(manifestDir, f.Name()))
+		}
+		for name, content := range tt.files {
+			if err := ioutil.WriteFile(path.Join(manifestDir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		r, err := newReconciler(&common.ReconcileConf{Path: manifestDir, Prune: tt.prune})
+		if err != nil {
+			t.Fatal(err)
+		}
+		status := r.reconcile()
+		if tt.err != status.Error {
+			t.Errorf("%d: error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.err, status.Error)
+			continue
+		}
+		if tt.err != "" {
+			continue
+		}
+		exp, _ := json.Marshal(tt.drift)
+		got, _ := json.Marshal(status.Drift)
+		if string(exp) != string(got) || tt.inSync != status.InSync {
+			t.Errorf("%d: drift mismatch:\n  exp=%s %v\n  got=%s %v\n\n", i, exp, tt.inSync, got, status.InSync)
+		}
+	}
+	if r, err := ruleProcessor.GetRuleByName("ruleRec"); err == nil {
+		t.Errorf("the pruned rule still exists: %v", r)
+	}
+	if s, err := streamProcessor.GetStatement("demoRec"); err != nil || s.Statement != `CREATE STREAM demoRec (id bigint) WITH (DATASOURCE="demo", FORMAT="JSON")` {
+		t.Errorf("the stream is not updated: %v %v", s, err)
+	}
+}
@@ -6,9 +6,12 @@ import (
 	"fmt"
 	"github.com/emqx/kuiper/common"
 	"github.com/emqx/kuiper/plugins"
+	"github.com/emqx/kuiper/secrets"
 	"github.com/emqx/kuiper/services"
 	"github.com/emqx/kuiper/xsql"
+	"github.com/emqx/kuiper/xsql/processors"
 	"github.com/emqx/kuiper/xstream/api"
+	"github.com/emqx/kuiper/xstream/states"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"golang.org/x/net/html"
@@ -17,6 +20,7 @@ import (
 	"net/http"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -73,8 +77,9 @@ func jsonResponse(i interface{}, w http.ResponseWriter, logger api.Logger) {
 	}
 }
 
-func createRestServer(ip string, port int) *http.Server {
+func createRestServer(ip string, port int, auth *authenticator) *http.Server {
 	r := mux.NewRouter()
+	r.Use(auth.middleware)
 	r.HandleFunc("/", rootHandler).Methods(http.MethodGet, http.MethodPost)
 	r.HandleFunc("/ping", pingHandler).Methods(http.MethodGet)
 	r.HandleFunc("/streams", streamsHandler).Methods(http.MethodGet, http.MethodPost)
@@ -88,6 +93,10 @@ func createRestServer(ip string, port int) *http.Server {
 	r.HandleFunc("/rules/{name}/stop", stopRuleHandler).Methods(http.MethodPost)
 	r.HandleFunc("/rules/{name}/restart", restartRuleHandler).Methods(http.MethodPost)
 	r.HandleFunc("/rules/{name}/topo", getTopoRuleHandler).Methods(http.MethodGet)
+	r.HandleFunc("/rules/{name}/savepoint", savepointRuleHandler).Methods(http.MethodPost)
+	r.HandleFunc("/rules/{name}/savepoints", savepointsHandler).Methods(http.MethodGet)
+	r.HandleFunc("/rules/{name}/savepoints/{savepoint}", savepointHandler).Methods(http.MethodGet, http.MethodDelete)
+	r.HandleFunc("/ruletest", ruletestHandler).Methods(http.MethodPost)
 
 	r.HandleFunc("/plugins/sources", sourcesHandler).Methods(http.MethodGet, http.MethodPost)
 	r.HandleFunc("/plugins/sources/prebuild", prebuildSourcePlugins).Methods(http.MethodGet)
@@ -100,6 +109,8 @@ func createRestServer(ip string, port int) *http.Server {
 	r.HandleFunc("/plugins/functions/prebuild", prebuildFuncsPlugins).Methods(http.MethodGet)
 	r.HandleFunc("/plugins/functions/{name}", functionHandler).Methods(http.MethodDelete, http.MethodGet)
 	r.HandleFunc("/plugins/functions/{name}/register", functionRegisterHandler).Methods(http.MethodPost)
+	r.HandleFunc("/plugins/portables", portablesHandler).Methods(http.MethodGet, http.MethodPost)
+	r.HandleFunc("/plugins/portables/{name}", portableHandler).Methods(http.MethodDelete, http.MethodGet)
 	r.HandleFunc("/plugins/udfs", functionsListHandler).Methods(http.MethodGet)
 	r.HandleFunc("/plugins/udfs/{name}", functionsGetHandler).Methods(http.MethodGet)
 
@@ -121,13 +132,24 @@ func createRestServer(ip string, port int) *http.Server {
 	r.HandleFunc("/services/functions/{name}", serviceFunctionHandler).Methods(http.MethodGet)
 	r.HandleFunc("/services/{name}", serviceHandler).Methods(http.MethodDelete, http.MethodGet, http.MethodPut)
 
+	r.HandleFunc("/functions", userFunctionsHandler).Methods(http.MethodGet, http.MethodPost)
+	r.HandleFunc("/secrets", secretsHandler).Methods(http.MethodGet, http.MethodPost)
+	r.HandleFunc("/secrets/{name}", secretHandler).Methods(http.MethodDelete, http.MethodGet, http.MethodPut)
+	r.HandleFunc("/data/export", exportHandler).Methods(http.MethodGet)
+	r.HandleFunc("/data/import", importHandler).Methods(http.MethodPost)
+	r.HandleFunc("/reconcile", reconcileHandler).Methods(http.MethodPost)
+	r.HandleFunc("/reconcile/status", reconcileStatusHandler).Methods(http.MethodGet)
+
+	r.HandleFunc("/functions/{name}", userFunctionHandler).Methods(http.MethodDelete, http.MethodGet)
+
 	server := &http.Server{
 		Addr: fmt.Sprintf("%s:%d", ip, port),
 		// Good practice to set timeouts to avoid Slowloris attacks.
 		WriteTimeout: time.Second * 60 * 5,
 		ReadTimeout:  time.Second * 60 * 5,
 		IdleTimeout:  time.Second * 60,
-		Handler:      handlers.CORS(handlers.AllowedHeaders([]string{"Accept", "Accept-Language", "Content-Type", "Content-Language", "Origin"}))(r),
+		Handler:      handlers.CORS(handlers.AllowedHeaders([]string{"Accept", "Accept-Language", "Content-Type", "Content-Language", "Origin", "Authorization"}))(r),
+		TLSConfig:    auth.tlsConfig(),
 	}
 	server.SetKeepAlivesEnabled(false)
 	return server
@@ -174,7 +196,7 @@ func sourcesManageHandler(w http.ResponseWriter, r *http.Request, st xsql.Stream
 			handleError(w, err, "Invalid body", logger)
 			return
 		}
-		content, err := streamProcessor.ExecStreamSql(v.Sql)
+		content, err := streamProcessor.ExecCreateStream(v.Sql, st)
 		if err != nil {
 			handleError(w, err, fmt.Sprintf("%s command error", strings.Title(xsql.StreamTypeMap[st])), logger)
 			return
@@ -317,16 +339,20 @@ func ruleHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		r, err := ruleProcessor.ExecUpdate(name, string(body))
+		rule, err := ruleProcessor.ExecUpdate(name, string(body))
 		var result string
 		if err != nil {
 			handleError(w, err, "Update rule error", logger)
 			return
 		} else {
-			result = fmt.Sprintf("Rule %s was updated successfully.", r.Id)
+			result = fmt.Sprintf("Rule %s was updated successfully.", rule.Id)
 		}
 
-		err = restartRule(name)
+		if sp := r.URL.Query().Get("savepoint"); sp != "" {
+			err = startRuleFromSavepoint(name, sp)
+		} else {
+			err = restartRule(name)
+		}
 		if err != nil {
 			handleError(w, err, "restart rule error", logger)
 			return
@@ -357,7 +383,12 @@ func startRuleHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	name := vars["name"]
 
-	err := startRule(name)
+	var err error
+	if sp := r.URL.Query().Get("savepoint"); sp != "" {
+		err = startRuleFromSavepoint(name, sp)
+	} else {
+		err = startRule(name)
+	}
 	if err != nil {
 		handleError(w, err, "start rule error", logger)
 		return
@@ -407,6 +438,84 @@ func getTopoRuleHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(content))
 }
 
+type savepointDescriptor struct {
+	Name string `json:"name,omitempty"`
+}
+
+//create a savepoint of a running rule
+func savepointRuleHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	vars := mux.Vars(r)
+	name := vars["name"]
+
+	sd := savepointDescriptor{}
+	if err := json.NewDecoder(r.Body).Decode(&sd); err != nil && err != io.EOF {
+		handleError(w, err, "Invalid body", logger)
+		return
+	}
+	sp, err := savepointRule(name, sd.Name)
+	if err != nil {
+		handleError(w, err, "create savepoint error", logger)
+		return
+	}
+	jsonResponse(sp, w, logger)
+}
+
+//list the savepoints of a rule
+func savepointsHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	vars := mux.Vars(r)
+	name := vars["name"]
+
+	sps, err := states.ListSavepoints(name)
+	if err != nil {
+		handleError(w, err, "list savepoints error", logger)
+		return
+	}
+	jsonResponse(sps, w, logger)
+}
+
+func savepointHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	vars := mux.Vars(r)
+	name := vars["name"]
+	spName := vars["savepoint"]
+
+	switch r.Method {
+	case http.MethodGet:
+		sp, err := states.GetSavepoint(name, spName)
+		if err != nil {
+			handleError(w, err, "describe savepoint error", logger)
+			return
+		}
+		sp.State = nil
+		jsonResponse(sp, w, logger)
+	case http.MethodDelete:
+		if err := states.DeleteSavepoint(name, spName); err != nil {
+			handleError(w, err, "delete savepoint error", logger)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(fmt.Sprintf("Savepoint %s of rule %s is deleted.", spName, name)))
+	}
+}
+
+//run the rule with the mock inputs on the mock clock and return the sink results
+func ruletestHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handleError(w, err, "Invalid body", logger)
+		return
+	}
+	result, err := testRule(body)
+	if err != nil {
+		handleError(w, err, "rule test error", logger)
+		return
+	}
+	jsonResponse(result, w, logger)
+}
+
 func pluginsHandler(w http.ResponseWriter, r *http.Request, t plugins.PluginType) {
 	defer r.Body.Close()
 	switch r.Method {
@@ -451,7 +560,9 @@ func pluginHandler(w http.ResponseWriter, r *http.Request, t plugins.PluginType)
 		}
 		w.WriteHeader(http.StatusOK)
 		result := fmt.Sprintf("%s plugin %s is deleted", plugins.PluginTypes[t], name)
-		if r {
+		if t == plugins.PORTABLE {
+			result = fmt.Sprintf("%s.", result)
+		} else if r {
 			result = fmt.Sprintf("%s and Kuiper will be stopped", result)
 		} else {
 			result = fmt.Sprintf("%s and Kuiper must restart for the change to take effect.", result)
@@ -518,6 +629,16 @@ func functionHandler(w http.ResponseWriter, r *http.Request) {
 	pluginHandler(w, r, plugins.FUNCTION)
 }
 
+//list or create portable plugin
+func portablesHandler(w http.ResponseWriter, r *http.Request) {
+	pluginsHandler(w, r, plugins.PORTABLE)
+}
+
+//delete or describe a portable plugin
+func portableHandler(w http.ResponseWriter, r *http.Request) {
+	pluginHandler(w, r, plugins.PORTABLE)
+}
+
 type functionList struct {
 	Functions []string `json:"functions,omitempty"`
 }
@@ -947,3 +1068,177 @@ func serviceFunctionHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	jsonResponse(j, w, logger)
 }
+
+//list or create the user-defined functions
+func userFunctionsHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	switch r.Method {
+	case http.MethodGet:
+		content, err := udfManager.List()
+		if err != nil {
+			handleError(w, err, "function list command error", logger)
+			return
+		}
+		jsonResponse(content, w, logger)
+	case http.MethodPost:
+		v, err := decodeStatementDescriptor(r.Body)
+		if err != nil {
+			handleError(w, err, "Invalid body", logger)
+			return
+		}
+		content, err := processors.ExecCreateFunction(v.Sql)
+		if err != nil {
+			handleError(w, err, "function create command error", logger)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(content))
+	}
+}
+
+//describe or drop a user-defined function
+func userFunctionHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	vars := mux.Vars(r)
+	name := vars["name"]
+
+	switch r.Method {
+	case http.MethodGet:
+		content, err := udfManager.Describe(name)
+		if err != nil {
+			handleError(w, err, fmt.Sprintf("describe function %s error", name), logger)
+			return
+		}
+		jsonResponse(content, w, logger)
+	case http.MethodDelete:
+		content, err := processors.ExecDropFunction(name)
+		if err != nil {
+			handleError(w, err, fmt.Sprintf("delete function %s error", name), logger)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(content))
+	}
+}
+
+//list or create secrets, the values are never returned
+func secretsHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	switch r.Method {
+	case http.MethodGet:
+		content, err := secretManager.List()
+		if err != nil {
+			handleError(w, err, "secret list command error", logger)
+			return
+		}
+		jsonResponse(content, w, logger)
+	case http.MethodPost:
+		sd := &secrets.SecretCreationRequest{}
+		if err := json.NewDecoder(r.Body).Decode(sd); err != nil {
+			handleError(w, err, "Invalid body: Error decoding the secret request payload", logger)
+			return
+		}
+		if err := secretManager.Create(sd.Name, sd.Value); err != nil {
+			handleError(w, err, "secret create command error", logger)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(fmt.Sprintf("secret %s is created", sd.Name)))
+	}
+}
+
+//describe, update or delete a secret
+func secretHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	vars := mux.Vars(r)
+	name := vars["name"]
+
+	switch r.Method {
+	case http.MethodGet:
+		content, err := secretManager.Describe(name)
+		if err != nil {
+			handleError(w, err, fmt.Sprintf("describe secret %s error", name), logger)
+			return
+		}
+		jsonResponse(content, w, logger)
+	case http.MethodPut:
+		sd := &secrets.SecretCreationRequest{}
+		if err := json.NewDecoder(r.Body).Decode(sd); err != nil {
+			handleError(w, err, "Invalid body: Error decoding the secret request payload", logger)
+			return
+		}
+		if err := secretManager.Update(name, sd.Value); err != nil {
+			handleError(w, err, fmt.Sprintf("update secret %s error", name), logger)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(fmt.Sprintf("secret %s is updated", name)))
+	case http.MethodDelete:
+		if err := secretManager.Delete(name); err != nil {
+			handleError(w, err, fmt.Sprintf("delete secret %s error", name), logger)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(fmt.Sprintf("secret %s is deleted", name)))
+	}
+}
+
+//export the configuration of the node as a bundle
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	b, err := exportBundle()
+	if err != nil {
+		handleError(w, err, "export error", logger)
+		return
+	}
+	jsonResponse(b, w, logger)
+}
+
+//import a bundle exported by another node
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handleError(w, err, "Invalid body", logger)
+		return
+	}
+	dryRun := false
+	if v := r.URL.Query().Get("dryRun"); v != "" {
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			handleError(w, fmt.Errorf("invalid dryRun %s", v), "import error", logger)
+			return
+		}
+	}
+	report, err := importBundle(body, r.URL.Query().Get("policy"), dryRun)
+	if err != nil {
+		handleError(w, err, "import error", logger)
+		return
+	}
+	if report.Aborted {
+		w.Header().Add(ContentType, ContentTypeJSON)
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(report)
+		return
+	}
+	jsonResponse(report, w, logger)
+}
+
+//reconcile the node to the manifest immediately
+func reconcileHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if reconcileManager == nil {
+		handleError(w, common.NewErrorWithCode(common.NOT_FOUND, "reconcile is not enabled"), "", logger)
+		return
+	}
+	jsonResponse(reconcileManager.sync(), w, logger)
+}
+
+//get the drift found by the last reconciliation
+func reconcileStatusHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if reconcileManager == nil {
+		handleError(w, common.NewErrorWithCode(common.NOT_FOUND, "reconcile is not enabled"), "", logger)
+		return
+	}
+	jsonResponse(reconcileManager.getStatus(), w, logger)
+}
@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"github.com/emqx/kuiper/common"
 	"github.com/emqx/kuiper/plugins"
+	"github.com/emqx/kuiper/secrets"
 	"github.com/emqx/kuiper/services"
 	"github.com/emqx/kuiper/xstream/sinks"
+	"github.com/emqx/kuiper/xstream/states"
 	"strings"
 	"time"
 )
@@ -187,6 +189,62 @@ func (t *Server) DropRule(name string, reply *string) error {
 	return nil
 }
 
+func (t *Server) StartRuleFromSavepoint(arg *common.RPCArgDesc, reply *string) error {
+	if err := startRuleFromSavepoint(arg.Name, arg.Json); err != nil {
+		return err
+	} else {
+		*reply = fmt.Sprintf("Rule %s was started from savepoint %s", arg.Name, arg.Json)
+	}
+	return nil
+}
+
+func (t *Server) SavepointRule(arg *common.RPCArgDesc, reply *string) error {
+	sp, err := savepointRule(arg.Name, arg.Json)
+	if err != nil {
+		return fmt.Errorf("Savepoint rule error : %s.", err)
+	}
+	*reply = fmt.Sprintf("Savepoint %s of rule %s was created.", sp.Name, arg.Name)
+	return nil
+}
+
+func (t *Server) TestRule(def string, reply *string) error {
+	r, err := testRule([]byte(def))
+	if err != nil {
+		return fmt.Errorf("Test rule error : %s.", err)
+	}
+	result, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Test rule error : %s.", err)
+	}
+	*reply = string(result)
+	return nil
+}
+
+func (t *Server) ShowSavepoints(name string, reply *string) error {
+	sps, err := states.ListSavepoints(name)
+	if err != nil {
+		return fmt.Errorf("Show savepoints error : %s.", err)
+	}
+	if len(sps) == 0 {
+		*reply = fmt.Sprintf("No savepoints are found for rule %s.", name)
+	} else {
+		result, err := json.MarshalIndent(sps, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Show savepoints error : %s.", err)
+		}
+		*reply = string(result)
+	}
+	return nil
+}
+
+func (t *Server) DropSavepoint(arg *common.RPCArgDesc, reply *string) error {
+	if err := states.DeleteSavepoint(arg.Name, arg.Json); err != nil {
+		return fmt.Errorf("Drop savepoint error : %s.", err)
+	}
+	*reply = fmt.Sprintf("Savepoint %s of rule %s was dropped.", arg.Json, arg.Name)
+	return nil
+}
+
 func (t *Server) CreatePlugin(arg *common.PluginDesc, reply *string) error {
 	pt := plugins.PluginType(arg.Type)
 	p, err := getPluginByJson(arg, pt)
@@ -232,7 +290,9 @@ func (t *Server) DropPlugin(arg *common.PluginDesc, reply *string) error {
 	if err != nil {
 		return fmt.Errorf("Drop plugin error: %s", err)
 	} else {
-		if arg.Stop {
+		if pt == plugins.PORTABLE {
+			*reply = fmt.Sprintf("Plugin %s is dropped.", p.GetName())
+		} else if arg.Stop {
 			*reply = fmt.Sprintf("Plugin %s is dropped and Kuiper will be stopped.", p.GetName())
 		} else {
 			*reply = fmt.Sprintf("Plugin %s is dropped and Kuiper must restart for the change to take effect.", p.GetName())
@@ -399,6 +459,91 @@ func (t *Server) ShowServiceFuncs(_ int, reply *string) error {
 	return nil
 }
 
+func (t *Server) CreateSecret(arg *common.RPCArgDesc, reply *string) error {
+	sd := &secrets.SecretCreationRequest{}
+	if arg.Json != "" {
+		if err := json.Unmarshal([]byte(arg.Json), sd); err != nil {
+			return fmt.Errorf("Parse secret error : %s.", err)
+		}
+	}
+	if sd.Name != "" && sd.Name != arg.Name {
+		return fmt.Errorf("Create secret error: name mismatch.")
+	}
+	err := secretManager.Create(arg.Name, sd.Value)
+	if err != nil {
+		return fmt.Errorf("Create secret error: %s", err)
+	} else {
+		*reply = fmt.Sprintf("Secret %s is created.", arg.Name)
+	}
+	return nil
+}
+
+func (t *Server) DescSecret(name string, reply *string) error {
+	s, err := secretManager.Describe(name)
+	if err != nil {
+		return fmt.Errorf("Desc secret error : %s.", err)
+	} else {
+		r, err := marshalDesc(s)
+		if err != nil {
+			return fmt.Errorf("Describe secret error: %v", err)
+		}
+		*reply = r
+	}
+	return nil
+}
+
+func (t *Server) DropSecret(name string, reply *string) error {
+	err := secretManager.Delete(name)
+	if err != nil {
+		return fmt.Errorf("Drop secret error : %s.", err)
+	}
+	*reply = fmt.Sprintf("Secret %s is dropped", name)
+	return nil
+}
+
+func (t *Server) ShowSecrets(_ int, reply *string) error {
+	s, err := secretManager.List()
+	if err != nil {
+		return fmt.Errorf("Show secret error: %s.", err)
+	}
+	if len(s) == 0 {
+		*reply = "No secret definitions are found."
+	} else {
+		r, err := marshalDesc(s)
+		if err != nil {
+			return fmt.Errorf("Show secret error: %v", err)
+		}
+		*reply = r
+	}
+	return nil
+}
+
+func (t *Server) Export(_ int, reply *string) error {
+	b, err := exportBundle()
+	if err != nil {
+		return fmt.Errorf("Export error: %s.", err)
+	}
+	r, err := marshalDesc(b)
+	if err != nil {
+		return fmt.Errorf("Export error: %v", err)
+	}
+	*reply = r
+	return nil
+}
+
+func (t *Server) Import(arg *common.ImportDesc, reply *string) error {
+	report, err := importBundle([]byte(arg.Content), arg.Policy, arg.DryRun)
+	if err != nil {
+		return fmt.Errorf("Import error: %s.", err)
+	}
+	r, err := marshalDesc(report)
+	if err != nil {
+		return fmt.Errorf("Import error: %v", err)
+	}
+	*reply = r
+	return nil
+}
+
 func marshalDesc(m interface{}) (string, error) {
 	s, err := json.Marshal(m)
 	if err != nil {
@@ -12,6 +12,8 @@ import (
 	"github.com/emqx/kuiper/common"
 	"github.com/emqx/kuiper/xstream"
 	"github.com/emqx/kuiper/xstream/api"
+	"github.com/emqx/kuiper/xstream/ruletest"
+	"github.com/emqx/kuiper/xstream/states"
 )
 
 var registry *RuleRegistry
@@ -256,6 +258,44 @@ func restartRule(name string) error {
 	return startRule(name)
 }
 
+// Trigger a checkpoint of the running rule and keep it as a savepoint. The rule must enable checkpoint by qos
+func savepointRule(name string, spName string) (*states.Savepoint, error) {
+	rs, ok := registry.Load(name)
+	if !ok {
+		return nil, common.NewErrorWithCode(common.NOT_FOUND, fmt.Sprintf("Rule %s is not found", name))
+	}
+	if !rs.Triggered || rs.Topology == nil || rs.Topology.GetCoordinator() == nil {
+		return nil, common.NewError(fmt.Sprintf("Rule %s must be running with qos 1 or 2 to create savepoint", name))
+	}
+	checkpointId, err := rs.Topology.GetCoordinator().TriggerCheckpoint()
+	if err != nil {
+		return nil, common.NewError(fmt.Sprintf("Fail to create savepoint for rule %s: %v", name, err))
+	}
+	if spName == "" {
+		spName = fmt.Sprintf("savepoint_%d", checkpointId)
+	}
+	return states.CreateSavepoint(name, spName, checkpointId)
+}
+
+// Restart the rule and restore its states from the savepoint
+func startRuleFromSavepoint(name string, spName string) error {
+	r, err := ruleProcessor.GetRuleByName(name)
+	if err != nil {
+		return err
+	}
+	if r.Options.Qos < api.AtLeastOnce {
+		return common.NewError(fmt.Sprintf("Rule %s must set qos 1 or 2 to start from savepoint", name))
+	}
+	if _, err := states.GetSavepoint(name, spName); err != nil {
+		return err
+	}
+	stopRule(name)
+	if err := states.RestoreSavepoint(name, spName); err != nil {
+		return err
+	}
+	return startRule(name)
+}
+
 func recoverRule(name string) string {
 	rule, err := ruleProcessor.GetRuleByName(name)
 	if err != nil {
@@ -277,3 +317,23 @@ func recoverRule(name string) string {
 	return fmt.Sprintf("Rule %s was started.", name)
 
 }
+
+// Run the rule test in a separated process because the mock clock is global
+func testRule(def []byte) (*ruletest.Result, error) {
+	d := &ruletest.Definition{}
+	if err := json.Unmarshal(def, d); err != nil {
+		return nil, fmt.Errorf("invalid rule test definition: %v", err)
+	}
+	if d.Sql == "" {
+		return nil, fmt.Errorf("missing rule sql")
+	}
+	out, err := ruletest.Exec(def)
+	if err != nil {
+		return nil, err
+	}
+	result := &ruletest.Result{}
+	if err := json.Unmarshal(out, result); err != nil {
+		return nil, fmt.Errorf("invalid rule test result: %v", err)
+	}
+	return result, nil
+}
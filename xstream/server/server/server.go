@@ -3,7 +3,10 @@ package server
 import (
 	"github.com/emqx/kuiper/common"
 	"github.com/emqx/kuiper/plugins"
+	"github.com/emqx/kuiper/plugins/portable"
+	"github.com/emqx/kuiper/secrets"
 	"github.com/emqx/kuiper/services"
+	"github.com/emqx/kuiper/udf"
 	"github.com/emqx/kuiper/xsql"
 	"github.com/emqx/kuiper/xsql/processors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -28,6 +31,9 @@ var (
 	streamProcessor *processors.StreamProcessor
 	pluginManager   *plugins.Manager
 	serviceManager  *services.Manager
+	udfManager      *udf.Manager
+	portableManager *portable.Manager
+	secretManager   *secrets.Manager
 )
 
 func StartUp(Version, LoadFileType string) {
@@ -54,7 +60,19 @@ func StartUp(Version, LoadFileType string) {
 	if err != nil {
 		logger.Panic(err)
 	}
-	xsql.InitFuncRegisters(serviceManager, pluginManager)
+	udfManager, err = udf.GetManager()
+	if err != nil {
+		logger.Panic(err)
+	}
+	portableManager, err = portable.GetManager()
+	if err != nil {
+		logger.Panic(err)
+	}
+	secretManager, err = secrets.GetManager()
+	if err != nil {
+		logger.Panic(err)
+	}
+	xsql.InitFuncRegisters(serviceManager, pluginManager, udfManager, portableManager)
 
 	registry = &RuleRegistry{internal: make(map[string]*RuleState)}
 
@@ -74,6 +92,17 @@ func StartUp(Version, LoadFileType string) {
 		}
 	}
 
+	//Start the reconciliation of the manifest
+	stopReconcile := make(chan struct{})
+	if c := common.Config.Basic.Reconcile; c != nil {
+		reconcileManager, err = newReconciler(c)
+		if err != nil {
+			logger.Fatal("Invalid reconcile configuration: ", err)
+		}
+		logger.Infof("Reconcile the node to the manifest %s", c.Path)
+		go reconcileManager.run(stopReconcile)
+	}
+
 	//Start prometheus service
 	var srvPrometheus *http.Server = nil
 	if common.Config.Basic.Prometheus {
@@ -100,8 +129,19 @@ func StartUp(Version, LoadFileType string) {
 		fmt.Println(msg)
 	}
 
+	auth, err := newAuthenticator(common.Config.Basic.Authentication)
+	if err != nil {
+		logger.Fatal("Invalid authentication configuration: ", err)
+	}
+	if auth.tlsConfig() != nil && common.Config.Basic.RestTls == nil {
+		logger.Fatal("Invalid authentication configuration: mtls requires restTls")
+	}
+	if auth == nil {
+		logger.Warn("Authentication is disabled, the rest and rpc services are open to anyone")
+	}
+
 	//Start rest service
-	srvRest := createRestServer(common.Config.Basic.RestIp, common.Config.Basic.RestPort)
+	srvRest := createRestServer(common.Config.Basic.RestIp, common.Config.Basic.RestPort, auth)
 	go func() {
 		var err error
 		if common.Config.Basic.RestTls == nil {
@@ -127,7 +167,7 @@ func StartUp(Version, LoadFileType string) {
 		WriteTimeout: time.Second * 15,
 		ReadTimeout:  time.Second * 15,
 		IdleTimeout:  time.Second * 60,
-		Handler:      rpcSrv,
+		Handler:      auth.rpcHandler(rpcSrv),
 	}
 	go func() {
 		if err = srvRpc.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -148,6 +188,7 @@ func StartUp(Version, LoadFileType string) {
 	sigint := make(chan os.Signal, 1)
 	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
 	<-sigint
+	close(stopReconcile)
 
 	if err = srvRpc.Shutdown(context.TODO()); err != nil {
 		logger.Errorf("rpc server shutdown error: %v", err)
@@ -166,5 +207,8 @@ func StartUp(Version, LoadFileType string) {
 		logger.Info("prometheus server successfully shutdown.")
 	}
 
+	portableManager.Shutdown()
+	logger.Info("portable plugins are stopped.")
+
 	os.Exit(0)
 }
@@ -0,0 +1,50 @@
+package sinks
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/xstream/api"
+	"github.com/emqx/kuiper/xstream/memory"
+)
+
+// The memory sink publishes the results to the in process message bus so that they can be consumed by the memory
+// sources of other rules.
+type MemorySink struct {
+	topic string
+}
+
+func (ms *MemorySink) Configure(ps map[string]interface{}) error {
+	t, ok := ps["topic"]
+	if !ok {
+		return fmt.Errorf("memory sink is missing property topic")
+	}
+	topic, ok := t.(string)
+	if !ok {
+		return fmt.Errorf("memory sink property topic %v is not a string", t)
+	}
+	if err := memory.ValidateTopic(topic); err != nil {
+		return err
+	}
+	ms.topic = topic
+	return nil
+}
+
+func (ms *MemorySink) Open(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Opening memory sink to topic %s", ms.topic)
+	return nil
+}
+
+func (ms *MemorySink) Collect(ctx api.StreamContext, item interface{}) error {
+	logger := ctx.GetLogger()
+	v, ok := item.([]byte)
+	if !ok {
+		logger.Warnf("memory sink receive non byte data %v", item)
+		return nil
+	}
+	logger.Debugf("memory sink publish %s to topic %s", v, ms.topic)
+	return memory.Publish(ms.topic, v, ctx.Done())
+}
+
+func (ms *MemorySink) Close(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Closing memory sink")
+	return nil
+}
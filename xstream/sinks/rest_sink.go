@@ -137,7 +137,12 @@ func (ms *RestSink) Open(ctx api.StreamContext) error {
 	ms.client = &http.Client{
 		Transport: tr,
 		Timeout:   time.Duration(ms.timeout) * time.Millisecond}
-	logger.Infof("open rest sink with configuration: {method: %s, url: %s, bodyType: %s, timeout: %d,header: %v, sendSingle: %v, insecureSkipVerify: %v", ms.method, ms.url, ms.bodyType, ms.timeout, ms.headers, ms.sendSingle, ms.insecureSkipVerify)
+	// The header values may be secrets, only print the names
+	headerNames := make([]string, 0, len(ms.headers))
+	for k := range ms.headers {
+		headerNames = append(headerNames, k)
+	}
+	logger.Infof("open rest sink with configuration: {method: %s, url: %s, bodyType: %s, timeout: %d,header: %v, sendSingle: %v, insecureSkipVerify: %v", ms.method, ms.url, ms.bodyType, ms.timeout, headerNames, ms.sendSingle, ms.insecureSkipVerify)
 
 	if _, err := url.Parse(ms.url); err != nil {
 		return err
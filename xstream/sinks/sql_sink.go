@@ -0,0 +1,491 @@
+package sinks
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/xstream/api"
+	_ "github.com/mattn/go-sqlite3"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	SQL_MODE_INSERT = "insert"
+	SQL_MODE_UPSERT = "upsert"
+)
+
+var columnRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+func init() {
+	gob.Register(map[int64][][]byte{})
+}
+
+type SQLSinkConfig struct {
+	Driver        string   `json:"driver"`
+	Url           string   `json:"url"`
+	Table         string   `json:"table"`
+	Mode          string   `json:"mode"`
+	Keys          []string `json:"keys"`
+	Fields        []string `json:"fields"`
+	BatchSize     int      `json:"batchSize"`
+	FlushInterval int      `json:"flushInterval"`
+	CommitTable   string   `json:"commitTable"`
+}
+
+// The sql sink writes the result rows into the database table. The columns are the fields of the rule's SELECT
+// clause unless the fields property is set. In upsert mode, the rows with the same keys are updated.
+// For exactly once qos, the results between two checkpoints are written in one database transaction when the
+// checkpoint completes. The last committed checkpoint id is recorded in the commit table in the same transaction
+// so that the results are never written twice.
+type SQLSink struct {
+	conf *SQLSinkConfig
+	db   *sql.DB
+
+	mu     sync.Mutex
+	buffer []map[string]interface{}
+	done   chan struct{}
+	// two phase commit states
+	tpc     bool
+	txn     [][]byte
+	pending map[int64][][]byte
+}
+
+func (s *SQLSink) Configure(props map[string]interface{}) error {
+	cfg := &SQLSinkConfig{
+		Driver:        "sqlite3",
+		Mode:          SQL_MODE_INSERT,
+		BatchSize:     1,
+		FlushInterval: 1000,
+		CommitTable:   "kuiper_sink_commit",
+	}
+	err := common.MapToStruct(props, cfg)
+	if err != nil {
+		return fmt.Errorf("read properties %v fail with error: %v", props, err)
+	}
+	if cfg.Url == "" {
+		return fmt.Errorf("sql sink is missing property url")
+	}
+	if !columnRegex.MatchString(cfg.Table) {
+		return fmt.Errorf("sql sink property table %s is invalid", cfg.Table)
+	}
+	if !columnRegex.MatchString(cfg.CommitTable) {
+		return fmt.Errorf("sql sink property commitTable %s is invalid", cfg.CommitTable)
+	}
+	for _, f := range append(cfg.Keys, cfg.Fields...) {
+		if !columnRegex.MatchString(f) {
+			return fmt.Errorf("sql sink column name %s is invalid", f)
+		}
+	}
+	switch cfg.Mode {
+	case SQL_MODE_INSERT:
+	case SQL_MODE_UPSERT:
+		if len(cfg.Keys) == 0 {
+			return fmt.Errorf("sql sink property keys is required for upsert mode")
+		}
+	default:
+		return fmt.Errorf("invalid property mode %s, must be insert or upsert", cfg.Mode)
+	}
+	if cfg.BatchSize <= 0 {
+		return fmt.Errorf("invalid property batchSize %d, must be positive", cfg.BatchSize)
+	}
+	if cfg.BatchSize > 1 && cfg.FlushInterval <= 0 {
+		return fmt.Errorf("invalid property flushInterval %d, must be positive", cfg.FlushInterval)
+	}
+	s.conf = cfg
+	return nil
+}
+
+func (s *SQLSink) Open(ctx api.StreamContext) error {
+	logger := ctx.GetLogger()
+	logger.Infof("Opening sql sink for table %s", s.conf.Table)
+	db, err := sql.Open(s.conf.Driver, s.conf.Url)
+	if err != nil {
+		return fmt.Errorf("fail to open database with driver %s: %v", s.conf.Driver, err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return fmt.Errorf("fail to connect to database with driver %s: %v", s.conf.Driver, err)
+	}
+	s.db = db
+	if s.conf.BatchSize > 1 {
+		done := make(chan struct{})
+		s.done = done
+		go func() {
+			ticker := common.GetTicker(s.conf.FlushInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					s.mu.Lock()
+					if err := s.flush(ctx); err != nil {
+						logger.Errorf("sql sink fail to write table %s: %v", s.conf.Table, err)
+					}
+					s.mu.Unlock()
+				case <-done:
+					return
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+func (s *SQLSink) Collect(ctx api.StreamContext, item interface{}) error {
+	logger := ctx.GetLogger()
+	v, ok := item.([]byte)
+	if !ok {
+		logger.Warnf("sql sink receive non byte data %v", item)
+		return nil
+	}
+	rows, err := decodeRows(v)
+	if err != nil {
+		return fmt.Errorf("sql sink can only write json rows: %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tpc {
+		s.txn = append(s.txn, v)
+		return nil
+	}
+	n := len(s.buffer)
+	s.buffer = append(s.buffer, rows...)
+	if len(s.buffer) < s.conf.BatchSize {
+		return nil
+	}
+	if err := s.flush(ctx); err != nil {
+		// The sink node resends the data on error, so only keep the rows buffered before
+		s.buffer = s.buffer[:n]
+		return err
+	}
+	return nil
+}
+
+// Write all the buffered rows in one transaction. The buffer is cleared only after the transaction is committed
+// so that the rows are written in the next flush if the writing fails.
+// The writing is not bound to the context so that the remaining rows can be flushed when closing.
+// Must be called with the lock held.
+func (s *SQLSink) flush(ctx api.StreamContext) error {
+	if len(s.buffer) == 0 {
+		return nil
+	}
+	if s.db == nil {
+		return fmt.Errorf("sql sink for table %s is closed", s.conf.Table)
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := s.writeRows(ctx, tx, s.buffer); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.buffer = nil
+	return nil
+}
+
+func (s *SQLSink) writeRows(ctx api.StreamContext, tx *sql.Tx, rows []map[string]interface{}) error {
+	stmts := make(map[string]*sql.Stmt)
+	defer func() {
+		for _, stmt := range stmts {
+			stmt.Close()
+		}
+	}()
+	for _, row := range rows {
+		cols := s.columns(row)
+		if len(cols) == 0 {
+			continue
+		}
+		query, err := s.statement(cols)
+		if err != nil {
+			return err
+		}
+		stmt, ok := stmts[query]
+		if !ok {
+			stmt, err = tx.Prepare(query)
+			if err != nil {
+				return err
+			}
+			stmts[query] = stmt
+		}
+		args := make([]interface{}, len(cols))
+		for i, c := range cols {
+			args[i] = toSQLValue(row[c])
+		}
+		ctx.GetLogger().Debugf("sql sink exec %s with %v", query, args)
+		if _, err := stmt.Exec(args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The columns to write for the row. If the fields property is not set, all the fields of the row are written.
+func (s *SQLSink) columns(row map[string]interface{}) []string {
+	if len(s.conf.Fields) > 0 {
+		return s.conf.Fields
+	}
+	cols := make([]string, 0, len(row))
+	for k := range row {
+		cols = append(cols, k)
+	}
+	sort.Strings(cols)
+	return cols
+}
+
+func (s *SQLSink) statement(cols []string) (string, error) {
+	for _, c := range cols {
+		if !columnRegex.MatchString(c) {
+			return "", fmt.Errorf("sql sink column name %s is invalid", c)
+		}
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(cols)), ",")
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", s.conf.Table, strings.Join(cols, ","), placeholders)
+	if s.conf.Mode != SQL_MODE_UPSERT {
+		return query, nil
+	}
+	var updates []string
+	for _, c := range cols {
+		if contains(s.conf.Keys, c) {
+			continue
+		}
+		if s.conf.Driver == "mysql" {
+			updates = append(updates, fmt.Sprintf("%s=VALUES(%s)", c, c))
+		} else {
+			updates = append(updates, fmt.Sprintf("%s=excluded.%s", c, c))
+		}
+	}
+	if s.conf.Driver == "mysql" {
+		if len(updates) == 0 {
+			return "INSERT IGNORE" + strings.TrimPrefix(query, "INSERT"), nil
+		}
+		return query + " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ","), nil
+	}
+	conflict := " ON CONFLICT (" + strings.Join(s.conf.Keys, ",") + ")"
+	if len(updates) == 0 {
+		return query + conflict + " DO NOTHING", nil
+	}
+	return query + conflict + " DO UPDATE SET " + strings.Join(updates, ","), nil
+}
+
+func (s *SQLSink) Begin(ctx api.StreamContext) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.tpc {
+		// The results are written when committing, so stop the batch flushing
+		if s.done != nil {
+			close(s.done)
+			s.done = nil
+		}
+		if err := s.loadPending(ctx); err != nil {
+			return err
+		}
+		s.tpc = true
+	}
+	s.txn = nil
+	return nil
+}
+
+// Move the current transaction to the pending ones which are saved in the checkpoint state
+func (s *SQLSink) PreCommit(ctx api.StreamContext, checkpointId int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadPending(ctx); err != nil {
+		return err
+	}
+	if len(s.txn) > 0 {
+		s.pending[checkpointId] = s.txn
+	}
+	s.txn = nil
+	return s.savePending(ctx)
+}
+
+// Write the pending transactions up to the checkpoint in order. Each checkpoint is written in a database transaction
+// which also updates the commit table. The checkpoints which have been committed before are skipped.
+func (s *SQLSink) Commit(ctx api.StreamContext, checkpointId int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadPending(ctx); err != nil {
+		return err
+	}
+	var ids []int64
+	for id := range s.pending {
+		if id <= checkpointId {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if s.db == nil {
+		return fmt.Errorf("sql sink for table %s is closed", s.conf.Table)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	sinkId := fmt.Sprintf("%s_%s_%d", ctx.GetRuleId(), ctx.GetOpId(), ctx.GetInstanceId())
+	if _, err := s.db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (sink_id VARCHAR(255) PRIMARY KEY, checkpoint_id BIGINT)", s.conf.CommitTable)); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := s.commitTransaction(ctx, sinkId, id, s.pending[id]); err != nil {
+			return fmt.Errorf("commit checkpoint %d error: %v", id, err)
+		}
+		delete(s.pending, id)
+	}
+	return s.savePending(ctx)
+}
+
+func (s *SQLSink) commitTransaction(ctx api.StreamContext, sinkId string, checkpointId int64, data [][]byte) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	var last int64
+	err = tx.QueryRow(fmt.Sprintf("SELECT checkpoint_id FROM %s WHERE sink_id = ?", s.conf.CommitTable), sinkId).Scan(&last)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = tx.Exec(fmt.Sprintf("INSERT INTO %s (sink_id, checkpoint_id) VALUES (?, ?)", s.conf.CommitTable), sinkId, checkpointId)
+	case err != nil:
+	case last >= checkpointId:
+		ctx.GetLogger().Infof("sql sink skips checkpoint %d which has been committed", checkpointId)
+		tx.Rollback()
+		return nil
+	default:
+		_, err = tx.Exec(fmt.Sprintf("UPDATE %s SET checkpoint_id = ? WHERE sink_id = ?", s.conf.CommitTable), checkpointId, sinkId)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, v := range data {
+		rows, err := decodeRows(v)
+		if err == nil {
+			err = s.writeRows(ctx, tx, rows)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLSink) Abort(ctx api.StreamContext) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.txn = nil
+	s.pending = make(map[int64][][]byte)
+	return s.savePending(ctx)
+}
+
+func (s *SQLSink) pendingKey(ctx api.StreamContext) string {
+	return fmt.Sprintf("$$sql_sink_pending_%d", ctx.GetInstanceId())
+}
+
+// Load the pending transactions from the restored state
+func (s *SQLSink) loadPending(ctx api.StreamContext) error {
+	if s.pending != nil {
+		return nil
+	}
+	s.pending = make(map[int64][][]byte)
+	v, err := ctx.GetState(s.pendingKey(ctx))
+	if err != nil || v == nil {
+		return err
+	}
+	p, ok := v.(map[int64][][]byte)
+	if !ok {
+		return fmt.Errorf("invalid pending transactions state %v", v)
+	}
+	for k, t := range p {
+		s.pending[k] = t
+	}
+	return nil
+}
+
+func (s *SQLSink) savePending(ctx api.StreamContext) error {
+	p := make(map[int64][][]byte, len(s.pending))
+	for k, t := range s.pending {
+		p[k] = t
+	}
+	return ctx.PutState(s.pendingKey(ctx), p)
+}
+
+func (s *SQLSink) Close(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Closing sql sink for table %s", s.conf.Table)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done != nil {
+		close(s.done)
+		s.done = nil
+	}
+	if s.db == nil {
+		return nil
+	}
+	var err error
+	// The uncommitted transactions are discarded and will be recomputed after restarting
+	if !s.tpc {
+		err = s.flush(ctx)
+	}
+	if e := s.db.Close(); err == nil {
+		err = e
+	}
+	s.db = nil
+	return err
+}
+
+// The sink receives a json array by default or a single json object if sendSingle is true. Numbers are decoded as
+// json.Number to keep the integers.
+func decodeRows(v []byte) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	if err := unmarshalWithNumber(v, &rows); err == nil {
+		return rows, nil
+	}
+	var row map[string]interface{}
+	if err := unmarshalWithNumber(v, &row); err != nil {
+		return nil, err
+	}
+	return []map[string]interface{}{row}, nil
+}
+
+func unmarshalWithNumber(v []byte, out interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(v))
+	d.UseNumber()
+	return d.Decode(out)
+}
+
+// Nested values are written as json strings
+func toSQLValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		if f, err := t.Float64(); err == nil {
+			return f
+		}
+		return t.String()
+	case map[string]interface{}, []interface{}:
+		if b, err := json.Marshal(v); err == nil {
+			return string(b)
+		}
+	}
+	return v
+}
+
+func contains(s []string, e string) bool {
+	for _, v := range s {
+		if v == e {
+			return true
+		}
+	}
+	return false
+}
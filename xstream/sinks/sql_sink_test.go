@@ -0,0 +1,281 @@
+package sinks
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/xstream/api"
+	"github.com/emqx/kuiper/xstream/contexts"
+	"github.com/emqx/kuiper/xstream/states"
+	"reflect"
+	"testing"
+)
+
+const sqlSinkTestUrl = "file:sqlSinkTest?mode=memory&cache=shared"
+
+func TestSQLSink_Configure(t *testing.T) {
+	var tests = []struct {
+		props map[string]interface{}
+		err   string
+	}{
+		{
+			props: map[string]interface{}{"url": sqlSinkTestUrl, "table": "t1"},
+		}, {
+			props: map[string]interface{}{"table": "t1"},
+			err:   "sql sink is missing property url",
+		}, {
+			props: map[string]interface{}{"url": sqlSinkTestUrl, "table": "t1;drop"},
+			err:   "sql sink property table t1;drop is invalid",
+		}, {
+			props: map[string]interface{}{"url": sqlSinkTestUrl, "table": "t1", "mode": "upsert"},
+			err:   "sql sink property keys is required for upsert mode",
+		}, {
+			props: map[string]interface{}{"url": sqlSinkTestUrl, "table": "t1", "mode": "update"},
+			err:   "invalid property mode update, must be insert or upsert",
+		}, {
+			props: map[string]interface{}{"url": sqlSinkTestUrl, "table": "t1", "batchSize": 0},
+			err:   "invalid property batchSize 0, must be positive",
+		}, {
+			props: map[string]interface{}{"url": sqlSinkTestUrl, "table": "t1", "fields": []interface{}{"a b"}},
+			err:   "sql sink column name a b is invalid",
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		s := &SQLSink{}
+		err := s.Configure(tt.props)
+		if !reflect.DeepEqual(tt.err, common.Errstring(err)) {
+			t.Errorf("%d. error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.err, err)
+		}
+	}
+}
+
+func TestSQLSink_Collect(t *testing.T) {
+	// Keep the shared memory database alive during the test
+	db, err := sql.Open("sqlite3", sqlSinkTestUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var tests = []struct {
+		props  map[string]interface{}
+		data   [][]byte
+		result [][]interface{}
+	}{
+		{
+			props: map[string]interface{}{"table": "t1"},
+			data: [][]byte{
+				[]byte(`[{"id":1,"color":"red","size":3},{"id":2,"color":"blue","size":5}]`),
+				[]byte(`{"id":3,"color":"red","size":{"w":2}}`),
+			},
+			result: [][]interface{}{{int64(1), "red", "3"}, {int64(2), "blue", "5"}, {int64(3), "red", `{"w":2}`}},
+		}, {
+			props: map[string]interface{}{"table": "t1", "fields": []interface{}{"id", "color"}},
+			data: [][]byte{
+				[]byte(`[{"id":1,"color":"red","size":3}]`),
+			},
+			result: [][]interface{}{{int64(1), "red", nil}},
+		}, {
+			props: map[string]interface{}{"table": "t1", "mode": "upsert", "keys": []interface{}{"id"}},
+			data: [][]byte{
+				[]byte(`[{"id":1,"color":"red","size":3},{"id":2,"color":"blue","size":5}]`),
+				[]byte(`[{"id":1,"color":"green","size":4}]`),
+			},
+			result: [][]interface{}{{int64(1), "green", "4"}, {int64(2), "blue", "5"}},
+		}, {
+			props: map[string]interface{}{"table": "t1", "batchSize": 10},
+			data: [][]byte{
+				[]byte(`[{"id":1,"color":"red","size":3}]`),
+				[]byte(`[{"id":2,"color":"blue","size":5}]`),
+			},
+			result: [][]interface{}{{int64(1), "red", "3"}, {int64(2), "blue", "5"}},
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	contextLogger := common.Log.WithField("rule", "TestSQLSink_Collect")
+	ctx := contexts.WithValue(contexts.Background(), contexts.LoggerKey, contextLogger)
+	for i, tt := range tests {
+		if _, err := db.Exec("DROP TABLE IF EXISTS t1; CREATE TABLE t1 (id INTEGER PRIMARY KEY, color TEXT, size TEXT)"); err != nil {
+			t.Fatal(err)
+		}
+		tt.props["url"] = sqlSinkTestUrl
+		s := &SQLSink{}
+		if err := s.Configure(tt.props); err != nil {
+			t.Errorf("%d. configure error: %v", i, err)
+			continue
+		}
+		if err := s.Open(ctx); err != nil {
+			t.Errorf("%d. open error: %v", i, err)
+			continue
+		}
+		for _, d := range tt.data {
+			if err := s.Collect(ctx, d); err != nil {
+				t.Errorf("%d. collect error: %v", i, err)
+			}
+		}
+		// The batched rows are flushed when closing
+		if err := s.Close(ctx); err != nil {
+			t.Errorf("%d. close error: %v", i, err)
+		}
+		rows, err := db.Query("SELECT id, color, size FROM t1 ORDER BY id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result [][]interface{}
+		for rows.Next() {
+			var (
+				id          int64
+				color, size sql.NullString
+			)
+			if err := rows.Scan(&id, &color, &size); err != nil {
+				t.Fatal(err)
+			}
+			r := []interface{}{id, color.String, nil}
+			if size.Valid {
+				r[2] = size.String
+			}
+			result = append(result, r)
+		}
+		rows.Close()
+		if !reflect.DeepEqual(tt.result, result) {
+			t.Errorf("%d. result mismatch:\n  exp=%v\n  got=%v\n\n", i, tt.result, result)
+		}
+	}
+}
+
+func TestSQLSink_TwoPhaseCommit(t *testing.T) {
+	db, err := sql.Open("sqlite3", sqlSinkTestUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("DROP TABLE IF EXISTS t2; DROP TABLE IF EXISTS kuiper_sink_commit; CREATE TABLE t2 (id INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	contextLogger := common.Log.WithField("rule", "TestSQLSink_TwoPhaseCommit")
+	store, err := states.CreateStore("TestSQLSink_TwoPhaseCommit", api.AtMostOnce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := contexts.WithValue(contexts.Background(), contexts.LoggerKey, contextLogger).WithMeta("TestSQLSink_TwoPhaseCommit", "sink1", store)
+	newSink := func() *SQLSink {
+		s := &SQLSink{}
+		if err := s.Configure(map[string]interface{}{"url": sqlSinkTestUrl, "table": "t2"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Open(ctx); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	count := func() (c int) {
+		if err := db.QueryRow("SELECT count(*) FROM t2").Scan(&c); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	var tests = []struct {
+		action string
+		arg    interface{}
+		count  int
+	}{
+		{action: "begin"},
+		{action: "collect", arg: `[{"id":1},{"id":2}]`},
+		{action: "precommit", arg: int64(1)},
+		{action: "collect", arg: `[{"id":3}]`},
+		{action: "precommit", arg: int64(2)},
+		{action: "collect", arg: `[{"id":4}]`},
+		{action: "commit", arg: int64(1), count: 2},
+		// Restart the rule and restore from checkpoint 2. The committed checkpoint 1 is skipped
+		{action: "restart", count: 2},
+		{action: "commit", arg: int64(1), count: 2},
+		{action: "commit", arg: int64(2), count: 3},
+		{action: "abort", count: 3},
+		{action: "begin", count: 3},
+		{action: "collect", arg: `[{"id":5}]`, count: 3},
+		{action: "precommit", arg: int64(3), count: 3},
+		{action: "commit", arg: int64(3), count: 4},
+		// The data after the last checkpoint is discarded when closing
+		{action: "collect", arg: `[{"id":6}]`, count: 4},
+		{action: "restart", count: 4},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	s := newSink()
+	for i, tt := range tests {
+		var err error
+		switch tt.action {
+		case "begin":
+			err = s.Begin(ctx)
+		case "collect":
+			err = s.Collect(ctx, []byte(tt.arg.(string)))
+		case "precommit":
+			err = s.PreCommit(ctx, tt.arg.(int64))
+		case "commit":
+			err = s.Commit(ctx, tt.arg.(int64))
+		case "abort":
+			err = s.Abort(ctx)
+		case "restart":
+			err = s.Close(ctx)
+			s = newSink()
+		}
+		if err != nil {
+			t.Errorf("%d. %s error: %v", i, tt.action, err)
+		}
+		if c := count(); c != tt.count {
+			t.Errorf("%d. %s count mismatch:\n  exp=%d\n  got=%d\n\n", i, tt.action, tt.count, c)
+		}
+	}
+	s.Close(ctx)
+}
+
+func TestSQLSink_FlushError(t *testing.T) {
+	db, err := sql.Open("sqlite3", sqlSinkTestUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("DROP TABLE IF EXISTS t3"); err != nil {
+		t.Fatal(err)
+	}
+	contextLogger := common.Log.WithField("rule", "TestSQLSink_FlushError")
+	ctx := contexts.WithValue(contexts.Background(), contexts.LoggerKey, contextLogger)
+	s := &SQLSink{}
+	// A long flush interval so that only the batch size triggers the flushing
+	if err := s.Configure(map[string]interface{}{"url": sqlSinkTestUrl, "table": "t3", "batchSize": 2, "flushInterval": 3600000}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close(ctx)
+	if err := s.Collect(ctx, []byte(`{"id":1}`)); err != nil {
+		t.Errorf("collect error: %v", err)
+	}
+	// The table does not exist, so the writing fails
+	if err := s.Collect(ctx, []byte(`{"id":2}`)); common.Errstring(err) != "no such table: t3" {
+		t.Errorf("collect error mismatch, got %v", err)
+	}
+	if len(s.buffer) != 1 {
+		t.Errorf("expect the rows collected before to be kept, but got %v", s.buffer)
+	}
+	s.mu.Lock()
+	err = s.flush(ctx)
+	s.mu.Unlock()
+	if err == nil || len(s.buffer) != 1 {
+		t.Errorf("expect the failed flushing to keep the buffer, but got %v and %v", err, s.buffer)
+	}
+	// The resent data is written together with the kept rows
+	if _, err := db.Exec("CREATE TABLE t3 (id INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Collect(ctx, []byte(`{"id":2}`)); err != nil {
+		t.Errorf("collect error: %v", err)
+	}
+	var c int
+	if err := db.QueryRow("SELECT count(*) FROM t3").Scan(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c != 2 || len(s.buffer) != 0 {
+		t.Errorf("expect 2 rows written and the buffer cleared, but got %d rows and %v", c, s.buffer)
+	}
+}
@@ -0,0 +1,176 @@
+package states
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"github.com/emqx/kuiper/common/kv"
+	"path"
+	"regexp"
+	"sort"
+)
+
+var savepointNameRegex = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+
+// Savepoint is a named copy of a completed checkpoint of a rule. Unlike the checkpoints which are rotated, it is kept
+// until deleted manually and can be restored to start the rule from its states.
+type Savepoint struct {
+	Name         string                 `json:"name"`
+	RuleId       string                 `json:"ruleId"`
+	CheckpointId int64                  `json:"checkpointId"`
+	Timestamp    int64                  `json:"timestamp"`
+	State        map[string]interface{} `json:"-"`
+}
+
+//Store in path ./data/savepoints/$ruleId with the savepoint name as the key
+func getSavepointStore(ruleId string) (kv.KeyValue, error) {
+	dr, err := common.GetDataLoc()
+	if err != nil {
+		return nil, err
+	}
+	db := kv.GetDefaultKVStore(path.Join(dr, "savepoints", ruleId))
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func getCheckpointStore(ruleId string) (kv.KeyValue, error) {
+	dr, err := common.GetDataLoc()
+	if err != nil {
+		return nil, err
+	}
+	db := kv.GetDefaultKVStore(path.Join(dr, ruleId, "checkpoints"))
+	if err := db.Open(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// CreateSavepoint copies the completed checkpoint of the rule as a savepoint with the name
+func CreateSavepoint(ruleId string, name string, checkpointId int64) (*Savepoint, error) {
+	if !savepointNameRegex.MatchString(name) {
+		return nil, common.NewError(fmt.Sprintf("invalid savepoint name %s, only letters, digits, _ and - are allowed", name))
+	}
+	cdb, err := getCheckpointStore(ruleId)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	ok, err := cdb.Get(fmt.Sprintf("%d", checkpointId), &m)
+	cdb.Close()
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("checkpoint %d of rule %s is not found", checkpointId, ruleId)
+	}
+	sp := &Savepoint{
+		Name:         name,
+		RuleId:       ruleId,
+		CheckpointId: checkpointId,
+		Timestamp:    common.GetNowInMilli(),
+		State:        m,
+	}
+	db, err := getSavepointStore(ruleId)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	if ok, _ := db.Get(name, &Savepoint{}); ok {
+		return nil, common.NewError(fmt.Sprintf("savepoint %s of rule %s already exists", name, ruleId))
+	}
+	if err := db.Setnx(name, sp); err != nil {
+		return nil, err
+	}
+	return sp, nil
+}
+
+// ListSavepoints returns the savepoints of the rule in time order. The states are not loaded.
+func ListSavepoints(ruleId string) ([]*Savepoint, error) {
+	db, err := getSavepointStore(ruleId)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	keys, err := db.Keys()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*Savepoint, 0, len(keys))
+	for _, k := range keys {
+		sp := &Savepoint{}
+		if ok, err := db.Get(k, sp); ok && err == nil {
+			sp.State = nil
+			result = append(result, sp)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Timestamp == result[j].Timestamp {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].Timestamp < result[j].Timestamp
+	})
+	return result, nil
+}
+
+func GetSavepoint(ruleId string, name string) (*Savepoint, error) {
+	db, err := getSavepointStore(ruleId)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	sp := &Savepoint{}
+	ok, err := db.Get(name, sp)
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, common.NewErrorWithCode(common.NOT_FOUND, fmt.Sprintf("savepoint %s of rule %s is not found", name, ruleId))
+	}
+	return sp, nil
+}
+
+func DeleteSavepoint(ruleId string, name string) error {
+	db, err := getSavepointStore(ruleId)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := db.Delete(name); err != nil {
+		if e, ok := err.(*common.Error); ok && e.Code() == common.NOT_FOUND {
+			return common.NewErrorWithCode(common.NOT_FOUND, fmt.Sprintf("savepoint %s of rule %s is not found", name, ruleId))
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteSavepoints deletes all the savepoints of the rule when the rule is dropped, so that a new rule with the same id
+// cannot restore from them
+func DeleteSavepoints(ruleId string) error {
+	db, err := getSavepointStore(ruleId)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Clean()
+}
+
+// RestoreSavepoint replaces the checkpoints of the rule with the savepoint, so that the rule will restore from it
+// when starting. Must be called when the rule is stopped.
+func RestoreSavepoint(ruleId string, name string) error {
+	sp, err := GetSavepoint(ruleId, name)
+	if err != nil {
+		return err
+	}
+	db, err := getCheckpointStore(ruleId)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := db.Clean(); err != nil {
+		return err
+	}
+	if err := db.Set(fmt.Sprintf("%d", sp.CheckpointId), sp.State); err != nil {
+		return err
+	}
+	return db.Set(CheckpointListKey, []int64{sp.CheckpointId})
+}
@@ -0,0 +1,99 @@
+package states
+
+import (
+	"fmt"
+	"github.com/emqx/kuiper/common"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestSavepoint(t *testing.T) {
+	ruleId := "testSavepoint"
+	defer cleanSavepointData(ruleId)
+	store, err := getKVStore(ruleId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cid := range []int64{1, 2} {
+		if err := store.SaveState(cid, "op1", map[string]interface{}{"ci": cid}); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.SaveCheckpoint(cid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var tests = []struct {
+		action string
+		name   string
+		cid    int64
+		result []string
+		state  map[string]interface{}
+		err    string
+	}{
+		{action: "create", name: "sp1", cid: 1},
+		{action: "create", name: "sp2", cid: 2},
+		{action: "create", name: "sp1", cid: 2, err: "savepoint sp1 of rule testSavepoint already exists"},
+		{action: "create", name: "sp 3", cid: 2, err: "invalid savepoint name sp 3, only letters, digits, _ and - are allowed"},
+		{action: "create", name: "sp3", cid: 5, err: "checkpoint 5 of rule testSavepoint is not found"},
+		{action: "list", result: []string{"sp1", "sp2"}},
+		{action: "restore", name: "sp1", state: map[string]interface{}{"ci": int64(1)}},
+		{action: "restore", name: "sp2", state: map[string]interface{}{"ci": int64(2)}},
+		{action: "restore", name: "sp3", err: "savepoint sp3 of rule testSavepoint is not found"},
+		{action: "delete", name: "sp1"},
+		{action: "delete", name: "sp1", err: "savepoint sp1 of rule testSavepoint is not found"},
+		{action: "list", result: []string{"sp2"}},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		var (
+			result []string
+			state  map[string]interface{}
+		)
+		switch tt.action {
+		case "create":
+			_, err = CreateSavepoint(ruleId, tt.name, tt.cid)
+		case "list":
+			var sps []*Savepoint
+			sps, err = ListSavepoints(ruleId)
+			for _, sp := range sps {
+				result = append(result, sp.Name)
+			}
+		case "restore":
+			err = RestoreSavepoint(ruleId, tt.name)
+			if err == nil {
+				var s *KVStore
+				s, err = getKVStore(ruleId)
+				if err == nil {
+					if sm, e := s.GetOpState("op1"); e != nil {
+						err = e
+					} else {
+						state = common.SyncMapToMap(sm)
+					}
+				}
+			}
+		case "delete":
+			err = DeleteSavepoint(ruleId, tt.name)
+		}
+		if !reflect.DeepEqual(tt.err, common.Errstring(err)) {
+			t.Errorf("%d. %s error mismatch:\n  exp=%s\n  got=%s\n\n", i, tt.action, tt.err, err)
+		}
+		if !reflect.DeepEqual(tt.result, result) {
+			t.Errorf("%d. %s result mismatch:\n  exp=%v\n  got=%v\n\n", i, tt.action, tt.result, result)
+		}
+		if !reflect.DeepEqual(tt.state, state) {
+			t.Errorf("%d. %s state mismatch:\n  exp=%v\n  got=%v\n\n", i, tt.action, tt.state, state)
+		}
+	}
+}
+
+func cleanSavepointData(ruleId string) {
+	dbDir, err := common.GetDataLoc()
+	if err != nil {
+		common.Log.Error(err)
+		return
+	}
+	os.RemoveAll(path.Join(dbDir, ruleId))
+	os.RemoveAll(path.Join(dbDir, "savepoints"))
+}
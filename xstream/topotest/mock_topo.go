@@ -1203,7 +1203,8 @@ func sendData(t *testing.T, dataLength int, metrics map[string]interface{}, data
 	return nil
 }
 
-func createStream(t *testing.T, tt RuleTest, j int, opt *api.RuleOption, sinkProps map[string]interface{}) ([][]*xsql.Tuple, int, *xstream.TopologyNew, *mocknodes.MockSink, <-chan error) {
+// The extra sinks are added to the rule besides the mock sink, e.g. to consume the side output
+func createStream(t *testing.T, tt RuleTest, j int, opt *api.RuleOption, sinkProps map[string]interface{}, extraSinks ...*nodes.SinkNode) ([][]*xsql.Tuple, int, *xstream.TopologyNew, *mocknodes.MockSink, <-chan error) {
 	mockclock.ResetClock(1541152486000)
 	// Create stream
 	var (
@@ -1236,7 +1237,7 @@ func createStream(t *testing.T, tt RuleTest, j int, opt *api.RuleOption, sinkPro
 	}
 	mockSink := mocknodes.NewMockSink()
 	sink := nodes.NewSinkNodeWithSink("mockSink", mockSink, sinkProps)
-	tp, err := planner.PlanWithSourcesAndSinks(&api.Rule{Id: fmt.Sprintf("%s_%d", tt.Name, j), Sql: tt.Sql, Options: opt}, DbDir, sources, []*nodes.SinkNode{sink})
+	tp, err := planner.PlanWithSourcesAndSinks(&api.Rule{Id: fmt.Sprintf("%s_%d", tt.Name, j), Sql: tt.Sql, Options: opt}, DbDir, sources, append([]*nodes.SinkNode{sink}, extraSinks...))
 	if err != nil {
 		t.Error(err)
 		return nil, 0, nil, nil, nil
@@ -1329,6 +1330,11 @@ func HandleStream(createOrDrop bool, names []string, t *testing.T) {
 					size BIGINT,
 					id BIGINT
 				) WITH (DATASOURCE="lookup.json", FORMAT="json", CONF_KEY="test");`
+			case "tableLookup":
+				sql = `CREATE TABLE tableLookup (
+					color STRING,
+					hex STRING
+				) WITH (DATASOURCE="colors", TYPE="sql", KIND="lookup", CONF_KEY="test");`
 			case "helloStr":
 				sql = `CREATE STREAM helloStr (name string) WITH (DATASOURCE="hello", FORMAT="JSON")`
 			case "commands":
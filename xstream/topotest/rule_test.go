@@ -1,6 +1,7 @@
 package topotest
 
 import (
+	"database/sql"
 	"encoding/json"
 	"github.com/emqx/kuiper/xstream"
 	"github.com/emqx/kuiper/xstream/api"
@@ -510,6 +511,142 @@ func TestSingleSQL(t *testing.T) {
 				"source_demoTable_0_records_in_total":  int64(5),
 				"source_demoTable_0_records_out_total": int64(5),
 			},
+		}, {
+			Name: `TestSingleSQLRule12`,
+			Sql:  `SELECT color, size FROM demo WHERE color IN ("red", "yellow") AND size BETWEEN 2 AND 4 AND NOT color LIKE "y%" OR ts IS NULL`,
+			R: [][]map[string]interface{}{
+				{{
+					"color": "red",
+					"size":  float64(3),
+				}},
+			},
+			M: map[string]interface{}{
+				"op_1_preprocessor_demo_0_exceptions_total":   int64(0),
+				"op_1_preprocessor_demo_0_process_latency_us": int64(0),
+				"op_1_preprocessor_demo_0_records_in_total":   int64(5),
+				"op_1_preprocessor_demo_0_records_out_total":  int64(5),
+
+				"op_2_filter_0_exceptions_total":   int64(0),
+				"op_2_filter_0_process_latency_us": int64(0),
+				"op_2_filter_0_records_in_total":   int64(5),
+				"op_2_filter_0_records_out_total":  int64(1),
+
+				"op_3_project_0_exceptions_total":   int64(0),
+				"op_3_project_0_process_latency_us": int64(0),
+				"op_3_project_0_records_in_total":   int64(1),
+				"op_3_project_0_records_out_total":  int64(1),
+
+				"sink_mockSink_0_exceptions_total":  int64(0),
+				"sink_mockSink_0_records_in_total":  int64(1),
+				"sink_mockSink_0_records_out_total": int64(1),
+
+				"source_demo_0_exceptions_total":  int64(0),
+				"source_demo_0_records_in_total":  int64(5),
+				"source_demo_0_records_out_total": int64(5),
+			},
+		}, {
+			Name: `TestSingleSQLRule13`,
+			Sql:  `WITH s AS (SELECT color, size * 2 AS d FROM demo WHERE size > 1) SELECT color, d FROM s WHERE d > 6`,
+			R: [][]map[string]interface{}{
+				{{
+					"color": "blue",
+					"d":     float64(12),
+				}},
+				{{
+					"color": "yellow",
+					"d":     float64(8),
+				}},
+			},
+			M: map[string]interface{}{
+				"op_1_preprocessor_demo_0_exceptions_total":   int64(0),
+				"op_1_preprocessor_demo_0_process_latency_us": int64(0),
+				"op_1_preprocessor_demo_0_records_in_total":   int64(5),
+				"op_1_preprocessor_demo_0_records_out_total":  int64(5),
+
+				"op_2_filter_0_exceptions_total":   int64(0),
+				"op_2_filter_0_process_latency_us": int64(0),
+				"op_2_filter_0_records_in_total":   int64(5),
+				"op_2_filter_0_records_out_total":  int64(4),
+
+				"op_3_project_0_exceptions_total":   int64(0),
+				"op_3_project_0_process_latency_us": int64(0),
+				"op_3_project_0_records_in_total":   int64(4),
+				"op_3_project_0_records_out_total":  int64(4),
+
+				"op_4_subquery_s_0_exceptions_total":   int64(0),
+				"op_4_subquery_s_0_process_latency_us": int64(0),
+				"op_4_subquery_s_0_records_in_total":   int64(4),
+				"op_4_subquery_s_0_records_out_total":  int64(4),
+
+				"op_4_preprocessor_s_0_exceptions_total":   int64(0),
+				"op_4_preprocessor_s_0_process_latency_us": int64(0),
+				"op_4_preprocessor_s_0_records_in_total":   int64(4),
+				"op_4_preprocessor_s_0_records_out_total":  int64(4),
+
+				"op_5_filter_0_exceptions_total":   int64(0),
+				"op_5_filter_0_process_latency_us": int64(0),
+				"op_5_filter_0_records_in_total":   int64(4),
+				"op_5_filter_0_records_out_total":  int64(2),
+
+				"op_6_project_0_exceptions_total":   int64(0),
+				"op_6_project_0_process_latency_us": int64(0),
+				"op_6_project_0_records_in_total":   int64(2),
+				"op_6_project_0_records_out_total":  int64(2),
+
+				"sink_mockSink_0_exceptions_total":  int64(0),
+				"sink_mockSink_0_records_in_total":  int64(2),
+				"sink_mockSink_0_records_out_total": int64(2),
+
+				"source_demo_0_exceptions_total":  int64(0),
+				"source_demo_0_records_in_total":  int64(5),
+				"source_demo_0_records_out_total": int64(5),
+			},
+		}, {
+			Name: `TestSingleSQLRule14`,
+			Sql:  `SELECT color, lag(size) OVER (PARTITION BY color) AS p, acc_sum(size) AS total FROM demo WHERE had_changed(true, color)`,
+			R: [][]map[string]interface{}{
+				{{
+					"color": "red",
+					"total": float64(3),
+				}},
+				{{
+					"color": "blue",
+					"total": float64(9),
+				}},
+				{{
+					"color": "yellow",
+					"total": float64(13),
+				}},
+				{{
+					"color": "red",
+					"p":     float64(3),
+					"total": float64(14),
+				}},
+			},
+			M: map[string]interface{}{
+				"op_1_preprocessor_demo_0_exceptions_total":   int64(0),
+				"op_1_preprocessor_demo_0_process_latency_us": int64(0),
+				"op_1_preprocessor_demo_0_records_in_total":   int64(5),
+				"op_1_preprocessor_demo_0_records_out_total":  int64(5),
+
+				"op_2_filter_0_exceptions_total":   int64(0),
+				"op_2_filter_0_process_latency_us": int64(0),
+				"op_2_filter_0_records_in_total":   int64(5),
+				"op_2_filter_0_records_out_total":  int64(4),
+
+				"op_3_project_0_exceptions_total":   int64(0),
+				"op_3_project_0_process_latency_us": int64(0),
+				"op_3_project_0_records_in_total":   int64(4),
+				"op_3_project_0_records_out_total":  int64(4),
+
+				"sink_mockSink_0_exceptions_total":  int64(0),
+				"sink_mockSink_0_records_in_total":  int64(4),
+				"sink_mockSink_0_records_out_total": int64(4),
+
+				"source_demo_0_exceptions_total":  int64(0),
+				"source_demo_0_records_in_total":  int64(5),
+				"source_demo_0_records_out_total": int64(5),
+			},
 		},
 	}
 	HandleStream(true, streamList, t)
@@ -909,3 +1046,141 @@ func TestSingleSQLForBinary(t *testing.T) {
 		doRuleTestBySinkProps(t, tests, j, opt, 0, nil, byteFunc)
 	}
 }
+
+func TestLookupTable(t *testing.T) {
+	//Reset
+	streamList := []string{"demo", "tableLookup"}
+	HandleStream(false, streamList, t)
+	// The in memory database lives until the last connection is closed
+	db, err := sql.Open("sqlite3", "file:lookupTest?mode=memory&cache=shared")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer db.Close()
+	for _, s := range []string{
+		"CREATE TABLE IF NOT EXISTS colors (color TEXT PRIMARY KEY, hex TEXT)",
+		"DELETE FROM colors",
+		"INSERT INTO colors VALUES ('red', '#f00'), ('blue', '#00f')",
+	} {
+		if _, err := db.Exec(s); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	//Data setup
+	var tests = []RuleTest{
+		{
+			Name: `TestLookupTableRule1`,
+			Sql:  `SELECT demo.color, size, hex FROM demo INNER JOIN tableLookup ON demo.color = tableLookup.color`,
+			R: [][]map[string]interface{}{
+				{{
+					"color": "red",
+					"size":  float64(3),
+					"hex":   "#f00",
+				}},
+				{{
+					"color": "blue",
+					"size":  float64(6),
+					"hex":   "#00f",
+				}},
+				{{
+					"color": "blue",
+					"size":  float64(2),
+					"hex":   "#00f",
+				}},
+				{{
+					"color": "red",
+					"size":  float64(1),
+					"hex":   "#f00",
+				}},
+			},
+			M: map[string]interface{}{
+				"op_1_preprocessor_demo_0_exceptions_total":  int64(0),
+				"op_1_preprocessor_demo_0_records_in_total":  int64(5),
+				"op_1_preprocessor_demo_0_records_out_total": int64(5),
+
+				"op_2_lookup_tableLookup_0_exceptions_total":  int64(0),
+				"op_2_lookup_tableLookup_0_records_in_total":  int64(5),
+				"op_2_lookup_tableLookup_0_records_out_total": int64(4),
+
+				"op_3_project_0_exceptions_total":  int64(0),
+				"op_3_project_0_records_in_total":  int64(4),
+				"op_3_project_0_records_out_total": int64(4),
+
+				"sink_mockSink_0_exceptions_total":  int64(0),
+				"sink_mockSink_0_records_in_total":  int64(4),
+				"sink_mockSink_0_records_out_total": int64(4),
+			},
+		}, {
+			Name: `TestLookupTableRule2`,
+			Sql:  `SELECT demo.color, hex FROM demo LEFT JOIN tableLookup ON demo.color = tableLookup.color WHERE size > 2`,
+			R: [][]map[string]interface{}{
+				{{
+					"color": "red",
+					"hex":   "#f00",
+				}},
+				{{
+					"color": "blue",
+					"hex":   "#00f",
+				}},
+				{{
+					"color": "yellow",
+				}},
+			},
+			M: map[string]interface{}{
+				"op_1_preprocessor_demo_0_exceptions_total":  int64(0),
+				"op_1_preprocessor_demo_0_records_in_total":  int64(5),
+				"op_1_preprocessor_demo_0_records_out_total": int64(5),
+
+				"op_2_filter_0_exceptions_total":  int64(0),
+				"op_2_filter_0_records_in_total":  int64(5),
+				"op_2_filter_0_records_out_total": int64(3),
+
+				"op_3_lookup_tableLookup_0_exceptions_total":  int64(0),
+				"op_3_lookup_tableLookup_0_records_in_total":  int64(3),
+				"op_3_lookup_tableLookup_0_records_out_total": int64(3),
+
+				"op_4_project_0_exceptions_total":  int64(0),
+				"op_4_project_0_records_in_total":  int64(3),
+				"op_4_project_0_records_out_total": int64(3),
+			},
+		}, {
+			Name: `TestLookupTableRule3`,
+			Sql:  `SELECT hex, count(*) AS c FROM demo INNER JOIN tableLookup ON demo.color = tableLookup.color GROUP BY hex, TUMBLINGWINDOW(ss, 2) ORDER BY hex DESC`,
+			R: [][]map[string]interface{}{
+				{{
+					"hex": "#f00",
+					"c":   float64(1),
+				}, {
+					"hex": "#00f",
+					"c":   float64(2),
+				}},
+				{{
+					"hex": "#f00",
+					"c":   float64(1),
+				}},
+			},
+			M: map[string]interface{}{
+				"op_3_lookup_tableLookup_0_exceptions_total":  int64(0),
+				"op_3_lookup_tableLookup_0_records_in_total":  int64(2),
+				"op_3_lookup_tableLookup_0_records_out_total": int64(2),
+			},
+		},
+	}
+	HandleStream(true, streamList, t)
+	options := []*api.RuleOption{
+		{
+			BufferLength: 100,
+			SendError:    true,
+		}, {
+			BufferLength:       100,
+			SendError:          true,
+			Qos:                api.AtLeastOnce,
+			CheckpointInterval: 5000,
+		},
+	}
+	for j, opt := range options {
+		DoRuleTest(t, tests, j, opt, 0)
+	}
+}
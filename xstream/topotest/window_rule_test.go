@@ -1,8 +1,13 @@
 package topotest
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/emqx/kuiper/xstream"
 	"github.com/emqx/kuiper/xstream/api"
+	"github.com/emqx/kuiper/xstream/nodes"
+	"github.com/emqx/kuiper/xstream/topotest/mocknodes"
+	"reflect"
 	"testing"
 )
 
@@ -343,6 +348,44 @@ func TestWindow(t *testing.T) {
 				"op_2_window_0_records_in_total":   int64(11),
 				"op_2_window_0_records_out_total":  int64(4),
 			},
+		}, {
+			Name: `TestWindowRule5Partition`,
+			Sql:  `SELECT color, count(*) as c FROM demo GROUP BY SessionWindow(ss, 2, 1) OVER (PARTITION BY color), color`,
+			R: [][]map[string]interface{}{
+				{{
+					"color": "red",
+					"c":     float64(1),
+				}}, {{
+					"color": "blue",
+					"c":     float64(2),
+				}}, {{
+					"color": "yellow",
+					"c":     float64(1),
+				}}, {{
+					"color": "red",
+					"c":     float64(1),
+				}},
+			},
+			M: map[string]interface{}{
+				"op_1_preprocessor_demo_0_exceptions_total":   int64(0),
+				"op_1_preprocessor_demo_0_process_latency_us": int64(0),
+				"op_1_preprocessor_demo_0_records_in_total":   int64(5),
+				"op_1_preprocessor_demo_0_records_out_total":  int64(5),
+
+				"op_2_window_0_exceptions_total":   int64(0),
+				"op_2_window_0_process_latency_us": int64(0),
+				"op_2_window_0_records_in_total":   int64(5),
+				"op_2_window_0_records_out_total":  int64(4),
+
+				"op_4_project_0_exceptions_total":   int64(0),
+				"op_4_project_0_process_latency_us": int64(0),
+				"op_4_project_0_records_in_total":   int64(4),
+				"op_4_project_0_records_out_total":  int64(4),
+
+				"sink_mockSink_0_exceptions_total":  int64(0),
+				"sink_mockSink_0_records_in_total":  int64(4),
+				"sink_mockSink_0_records_out_total": int64(4),
+			},
 		}, {
 			Name: `TestWindowRule6`,
 			Sql:  `SELECT max(temp) as m, count(color) as c FROM demo INNER JOIN demo1 ON demo.ts = demo1.ts GROUP BY SlidingWindow(ss, 1)`,
@@ -702,6 +745,371 @@ func TestWindow(t *testing.T) {
 				"source_table1_0_records_in_total":  int64(4),
 				"source_table1_0_records_out_total": int64(4),
 			},
+		}, {
+			Name: `TestWindowRule12`,
+			Sql:  `SELECT color, max(size) AS m FROM demo GROUP BY HOPPINGWINDOW(ss, 2, 1), color ORDER BY m DESC LIMIT 1`,
+			R: [][]map[string]interface{}{
+				{{
+					"color": "blue",
+					"m":     float64(6),
+				}},
+				{{
+					"color": "blue",
+					"m":     float64(6),
+				}},
+				{{
+					"color": "yellow",
+					"m":     float64(4),
+				}},
+				{{
+					"color": "yellow",
+					"m":     float64(4),
+				}},
+			},
+			M: map[string]interface{}{
+				"op_1_preprocessor_demo_0_exceptions_total":   int64(0),
+				"op_1_preprocessor_demo_0_process_latency_us": int64(0),
+				"op_1_preprocessor_demo_0_records_in_total":   int64(5),
+				"op_1_preprocessor_demo_0_records_out_total":  int64(5),
+
+				"op_2_window_0_exceptions_total":   int64(0),
+				"op_2_window_0_process_latency_us": int64(0),
+				"op_2_window_0_records_in_total":   int64(5),
+				"op_2_window_0_records_out_total":  int64(4),
+
+				"op_3_aggregate_0_exceptions_total":   int64(0),
+				"op_3_aggregate_0_process_latency_us": int64(0),
+				"op_3_aggregate_0_records_in_total":   int64(4),
+				"op_3_aggregate_0_records_out_total":  int64(4),
+
+				"op_4_order_0_exceptions_total":   int64(0),
+				"op_4_order_0_process_latency_us": int64(0),
+				"op_4_order_0_records_in_total":   int64(4),
+				"op_4_order_0_records_out_total":  int64(4),
+
+				"op_5_project_0_exceptions_total":   int64(0),
+				"op_5_project_0_process_latency_us": int64(0),
+				"op_5_project_0_records_in_total":   int64(4),
+				"op_5_project_0_records_out_total":  int64(4),
+
+				"op_6_limit_0_exceptions_total":   int64(0),
+				"op_6_limit_0_process_latency_us": int64(0),
+				"op_6_limit_0_records_in_total":   int64(4),
+				"op_6_limit_0_records_out_total":  int64(4),
+
+				"sink_mockSink_0_exceptions_total":  int64(0),
+				"sink_mockSink_0_records_in_total":  int64(4),
+				"sink_mockSink_0_records_out_total": int64(4),
+
+				"source_demo_0_exceptions_total":  int64(0),
+				"source_demo_0_records_in_total":  int64(5),
+				"source_demo_0_records_out_total": int64(5),
+			},
+		}, {
+			Name: `TestWindowRule13`,
+			Sql:  `SELECT DISTINCT color FROM demo GROUP BY HOPPINGWINDOW(ss, 2, 1) LIMIT 2 OFFSET 1`,
+			R: [][]map[string]interface{}{
+				{{
+					"color": "blue",
+				}},
+				{{
+					"color": "blue",
+				}},
+				{{
+					"color": "yellow",
+				}},
+				{{
+					"color": "red",
+				}},
+			},
+			M: map[string]interface{}{
+				"op_1_preprocessor_demo_0_exceptions_total":   int64(0),
+				"op_1_preprocessor_demo_0_process_latency_us": int64(0),
+				"op_1_preprocessor_demo_0_records_in_total":   int64(5),
+				"op_1_preprocessor_demo_0_records_out_total":  int64(5),
+
+				"op_2_window_0_exceptions_total":   int64(0),
+				"op_2_window_0_process_latency_us": int64(0),
+				"op_2_window_0_records_in_total":   int64(5),
+				"op_2_window_0_records_out_total":  int64(4),
+
+				"op_3_project_0_exceptions_total":   int64(0),
+				"op_3_project_0_process_latency_us": int64(0),
+				"op_3_project_0_records_in_total":   int64(4),
+				"op_3_project_0_records_out_total":  int64(4),
+
+				"op_4_distinct_0_exceptions_total":   int64(0),
+				"op_4_distinct_0_process_latency_us": int64(0),
+				"op_4_distinct_0_records_in_total":   int64(4),
+				"op_4_distinct_0_records_out_total":  int64(4),
+
+				"op_5_limit_0_exceptions_total":   int64(0),
+				"op_5_limit_0_process_latency_us": int64(0),
+				"op_5_limit_0_records_in_total":   int64(4),
+				"op_5_limit_0_records_out_total":  int64(4),
+
+				"sink_mockSink_0_exceptions_total":  int64(0),
+				"sink_mockSink_0_records_in_total":  int64(4),
+				"sink_mockSink_0_records_out_total": int64(4),
+
+				"source_demo_0_exceptions_total":  int64(0),
+				"source_demo_0_records_in_total":  int64(5),
+				"source_demo_0_records_out_total": int64(5),
+			},
+		}, {
+			Name: `TestWindowRule14`,
+			Sql:  `SELECT avg(m) AS a FROM (SELECT max(size) AS m FROM demo GROUP BY TUMBLINGWINDOW(ss, 1)) AS s GROUP BY COUNTWINDOW(2)`,
+			R: [][]map[string]interface{}{
+				{{
+					"a": float64(4),
+				}},
+				{{
+					"a": float64(2.5),
+				}},
+			},
+			M: map[string]interface{}{
+				"op_1_preprocessor_demo_0_exceptions_total":   int64(0),
+				"op_1_preprocessor_demo_0_process_latency_us": int64(0),
+				"op_1_preprocessor_demo_0_records_in_total":   int64(5),
+				"op_1_preprocessor_demo_0_records_out_total":  int64(5),
+
+				"op_2_window_0_exceptions_total":   int64(0),
+				"op_2_window_0_process_latency_us": int64(0),
+				"op_2_window_0_records_in_total":   int64(5),
+				"op_2_window_0_records_out_total":  int64(4),
+
+				"op_3_aggregate_0_exceptions_total":   int64(0),
+				"op_3_aggregate_0_process_latency_us": int64(0),
+				"op_3_aggregate_0_records_in_total":   int64(4),
+				"op_3_aggregate_0_records_out_total":  int64(4),
+
+				"op_4_project_0_exceptions_total":   int64(0),
+				"op_4_project_0_process_latency_us": int64(0),
+				"op_4_project_0_records_in_total":   int64(4),
+				"op_4_project_0_records_out_total":  int64(4),
+
+				"op_5_subquery_s_0_exceptions_total":   int64(0),
+				"op_5_subquery_s_0_process_latency_us": int64(0),
+				"op_5_subquery_s_0_records_in_total":   int64(4),
+				"op_5_subquery_s_0_records_out_total":  int64(4),
+
+				"op_5_preprocessor_s_0_exceptions_total":   int64(0),
+				"op_5_preprocessor_s_0_process_latency_us": int64(0),
+				"op_5_preprocessor_s_0_records_in_total":   int64(4),
+				"op_5_preprocessor_s_0_records_out_total":  int64(4),
+
+				"op_6_window_0_exceptions_total":   int64(0),
+				"op_6_window_0_process_latency_us": int64(0),
+				"op_6_window_0_records_in_total":   int64(4),
+				"op_6_window_0_records_out_total":  int64(2),
+
+				"op_7_aggregate_0_exceptions_total":   int64(0),
+				"op_7_aggregate_0_process_latency_us": int64(0),
+				"op_7_aggregate_0_records_in_total":   int64(2),
+				"op_7_aggregate_0_records_out_total":  int64(2),
+
+				"op_8_project_0_exceptions_total":   int64(0),
+				"op_8_project_0_process_latency_us": int64(0),
+				"op_8_project_0_records_in_total":   int64(2),
+				"op_8_project_0_records_out_total":  int64(2),
+
+				"sink_mockSink_0_exceptions_total":  int64(0),
+				"sink_mockSink_0_records_in_total":  int64(2),
+				"sink_mockSink_0_records_out_total": int64(2),
+
+				"source_demo_0_exceptions_total":  int64(0),
+				"source_demo_0_records_in_total":  int64(5),
+				"source_demo_0_records_out_total": int64(5),
+			},
+		}, {
+			Name: `TestWindowRule15`,
+			Sql:  `SELECT count(*) AS c, max(size) AS s, max(hum) AS h FROM demo, demo1 GROUP BY TUMBLINGWINDOW(ss, 1)`,
+			R: [][]map[string]interface{}{
+				{{
+					"c": float64(4),
+					"h": float64(65),
+					"s": float64(6),
+				}},
+				{{
+					"c": float64(2),
+					"h": float64(75),
+					"s": float64(2),
+				}},
+				{{
+					"c": float64(2),
+					"h": float64(80),
+					"s": float64(4),
+				}},
+				{{
+					"c": float64(2),
+					"h": float64(62),
+					"s": float64(1),
+				}},
+			},
+			M: map[string]interface{}{
+				"op_1_preprocessor_demo_0_exceptions_total":   int64(0),
+				"op_1_preprocessor_demo_0_process_latency_us": int64(0),
+				"op_1_preprocessor_demo_0_records_in_total":   int64(5),
+				"op_1_preprocessor_demo_0_records_out_total":  int64(5),
+
+				"op_2_preprocessor_demo1_0_exceptions_total":   int64(0),
+				"op_2_preprocessor_demo1_0_process_latency_us": int64(0),
+				"op_2_preprocessor_demo1_0_records_in_total":   int64(5),
+				"op_2_preprocessor_demo1_0_records_out_total":  int64(5),
+
+				"op_3_window_0_exceptions_total":   int64(0),
+				"op_3_window_0_process_latency_us": int64(0),
+				"op_3_window_0_records_in_total":   int64(10),
+				"op_3_window_0_records_out_total":  int64(4),
+
+				"op_4_union_0_exceptions_total":   int64(0),
+				"op_4_union_0_process_latency_us": int64(0),
+				"op_4_union_0_records_in_total":   int64(4),
+				"op_4_union_0_records_out_total":  int64(4),
+
+				"op_5_aggregate_0_exceptions_total":   int64(0),
+				"op_5_aggregate_0_process_latency_us": int64(0),
+				"op_5_aggregate_0_records_in_total":   int64(4),
+				"op_5_aggregate_0_records_out_total":  int64(4),
+
+				"op_6_project_0_exceptions_total":   int64(0),
+				"op_6_project_0_process_latency_us": int64(0),
+				"op_6_project_0_records_in_total":   int64(4),
+				"op_6_project_0_records_out_total":  int64(4),
+
+				"sink_mockSink_0_exceptions_total":  int64(0),
+				"sink_mockSink_0_records_in_total":  int64(4),
+				"sink_mockSink_0_records_out_total": int64(4),
+
+				"source_demo_0_exceptions_total":  int64(0),
+				"source_demo_0_records_in_total":  int64(5),
+				"source_demo_0_records_out_total": int64(5),
+
+				"source_demo1_0_exceptions_total":  int64(0),
+				"source_demo1_0_records_in_total":  int64(5),
+				"source_demo1_0_records_out_total": int64(5),
+			},
+		}, {
+			Name: `TestWindowRule16`,
+			Sql:  `SELECT color, count(*) AS c, sum(size) AS s, avg(size) AS a, min(ts) AS t FROM demo GROUP BY TUMBLINGWINDOW(ss, 2), color ORDER BY color`,
+			R: [][]map[string]interface{}{
+				{{
+					"color": "blue",
+					"c":     float64(2),
+					"s":     float64(8),
+					"a":     float64(4),
+					"t":     float64(1541152486822),
+				}, {
+					"color": "red",
+					"c":     float64(1),
+					"s":     float64(3),
+					"a":     float64(3),
+					"t":     float64(1541152486013),
+				}}, {{
+					"color": "red",
+					"c":     float64(1),
+					"s":     float64(1),
+					"a":     float64(1),
+					"t":     float64(1541152489252),
+				}, {
+					"color": "yellow",
+					"c":     float64(1),
+					"s":     float64(4),
+					"a":     float64(4),
+					"t":     float64(1541152488442),
+				}},
+			},
+			M: map[string]interface{}{
+				"op_1_preprocessor_demo_0_exceptions_total":   int64(0),
+				"op_1_preprocessor_demo_0_process_latency_us": int64(0),
+				"op_1_preprocessor_demo_0_records_in_total":   int64(5),
+				"op_1_preprocessor_demo_0_records_out_total":  int64(5),
+
+				"op_2_window_0_exceptions_total":   int64(0),
+				"op_2_window_0_process_latency_us": int64(0),
+				"op_2_window_0_records_in_total":   int64(5),
+				"op_2_window_0_records_out_total":  int64(2),
+
+				"op_3_aggregate_0_exceptions_total":   int64(0),
+				"op_3_aggregate_0_process_latency_us": int64(0),
+				"op_3_aggregate_0_records_in_total":   int64(2),
+				"op_3_aggregate_0_records_out_total":  int64(2),
+
+				"op_4_order_0_exceptions_total":   int64(0),
+				"op_4_order_0_process_latency_us": int64(0),
+				"op_4_order_0_records_in_total":   int64(2),
+				"op_4_order_0_records_out_total":  int64(2),
+
+				"op_5_project_0_exceptions_total":   int64(0),
+				"op_5_project_0_process_latency_us": int64(0),
+				"op_5_project_0_records_in_total":   int64(2),
+				"op_5_project_0_records_out_total":  int64(2),
+
+				"sink_mockSink_0_exceptions_total":  int64(0),
+				"sink_mockSink_0_records_in_total":  int64(2),
+				"sink_mockSink_0_records_out_total": int64(2),
+
+				"source_demo_0_exceptions_total":  int64(0),
+				"source_demo_0_records_in_total":  int64(5),
+				"source_demo_0_records_out_total": int64(5),
+			},
+		}, {
+			Name: `TestWindowRule17`,
+			Sql:  `SELECT color, size, count(*) AS c FROM demo GROUP BY COUNTWINDOW(5), color, size ORDER BY size DESC LIMIT 1 BY color`,
+			R: [][]map[string]interface{}{
+				{{
+					"color": "blue",
+					"size":  float64(6),
+					"c":     float64(1),
+				}, {
+					"color": "yellow",
+					"size":  float64(4),
+					"c":     float64(1),
+				}, {
+					"color": "red",
+					"size":  float64(3),
+					"c":     float64(1),
+				}},
+			},
+			M: map[string]interface{}{
+				"op_1_preprocessor_demo_0_exceptions_total":   int64(0),
+				"op_1_preprocessor_demo_0_process_latency_us": int64(0),
+				"op_1_preprocessor_demo_0_records_in_total":   int64(5),
+				"op_1_preprocessor_demo_0_records_out_total":  int64(5),
+
+				"op_2_window_0_exceptions_total":   int64(0),
+				"op_2_window_0_process_latency_us": int64(0),
+				"op_2_window_0_records_in_total":   int64(5),
+				"op_2_window_0_records_out_total":  int64(1),
+
+				"op_3_aggregate_0_exceptions_total":   int64(0),
+				"op_3_aggregate_0_process_latency_us": int64(0),
+				"op_3_aggregate_0_records_in_total":   int64(1),
+				"op_3_aggregate_0_records_out_total":  int64(1),
+
+				"op_4_order_0_exceptions_total":   int64(0),
+				"op_4_order_0_process_latency_us": int64(0),
+				"op_4_order_0_records_in_total":   int64(1),
+				"op_4_order_0_records_out_total":  int64(1),
+
+				"op_5_project_0_exceptions_total":   int64(0),
+				"op_5_project_0_process_latency_us": int64(0),
+				"op_5_project_0_records_in_total":   int64(1),
+				"op_5_project_0_records_out_total":  int64(1),
+
+				"op_6_limit_0_exceptions_total":   int64(0),
+				"op_6_limit_0_process_latency_us": int64(0),
+				"op_6_limit_0_records_in_total":   int64(1),
+				"op_6_limit_0_records_out_total":  int64(1),
+
+				"sink_mockSink_0_exceptions_total":  int64(0),
+				"sink_mockSink_0_records_in_total":  int64(1),
+				"sink_mockSink_0_records_out_total": int64(1),
+
+				"source_demo_0_exceptions_total":  int64(0),
+				"source_demo_0_records_in_total":  int64(5),
+				"source_demo_0_records_out_total": int64(5),
+			},
 		},
 	}
 	HandleStream(true, streamList, t)
@@ -1015,6 +1423,44 @@ func TestEventWindow(t *testing.T) {
 				"op_2_window_0_records_in_total":   int64(12),
 				"op_2_window_0_records_out_total":  int64(4),
 			},
+		}, {
+			Name: `TestEventWindowRule5Partition`,
+			Sql:  `SELECT color, count(*) as c FROM demoE GROUP BY TUMBLINGWINDOW(ss, 1) OVER (PARTITION BY color), color`,
+			R: [][]map[string]interface{}{
+				{{
+					"color": "blue",
+					"c":     float64(1),
+				}}, {{
+					"color": "red",
+					"c":     float64(1),
+				}}, {{
+					"color": "red",
+					"c":     float64(1),
+				}}, {{
+					"color": "yellow",
+					"c":     float64(1),
+				}},
+			},
+			M: map[string]interface{}{
+				"op_1_preprocessor_demoE_0_exceptions_total":   int64(0),
+				"op_1_preprocessor_demoE_0_process_latency_us": int64(0),
+				"op_1_preprocessor_demoE_0_records_in_total":   int64(6),
+				"op_1_preprocessor_demoE_0_records_out_total":  int64(6),
+
+				"op_2_window_0_exceptions_total":   int64(0),
+				"op_2_window_0_process_latency_us": int64(0),
+				"op_2_window_0_records_in_total":   int64(6),
+				"op_2_window_0_records_out_total":  int64(4),
+
+				"op_4_project_0_exceptions_total":   int64(0),
+				"op_4_project_0_process_latency_us": int64(0),
+				"op_4_project_0_records_in_total":   int64(4),
+				"op_4_project_0_records_out_total":  int64(4),
+
+				"sink_mockSink_0_exceptions_total":  int64(0),
+				"sink_mockSink_0_records_in_total":  int64(4),
+				"sink_mockSink_0_records_out_total": int64(4),
+			},
 		}, {
 			Name: `TestEventWindowRule6`,
 			Sql:  `SELECT max(temp) as m, count(color) as c FROM demoE INNER JOIN demo1E ON demoE.ts = demo1E.ts GROUP BY SlidingWindow(ss, 1)`,
@@ -1132,6 +1578,137 @@ func TestEventWindow(t *testing.T) {
 				"op_2_window_0_records_in_total":   int64(6),
 				"op_2_window_0_records_out_total":  int64(5),
 			},
+		}, {
+			Name: `TestEventWindowRule3IntervalJoin`,
+			Sql:  `SELECT color, temp FROM demoE INNER JOIN demo1E ON demo1E.ts >= demoE.ts AND demo1E.ts <= demoE.ts + 900`,
+			R: [][]map[string]interface{}{
+				{{
+					"color": "red",
+					"temp":  27.5,
+				}}, {{
+					"color": "red",
+					"temp":  25.5,
+				}}, {{
+					"color": "blue",
+					"temp":  27.4,
+				}}, {{
+					"color": "blue",
+					"temp":  28.1,
+				}}, {{
+					"color": "red",
+					"temp":  25.5,
+				}}, {{
+					"color": "yellow",
+					"temp":  27.4,
+				}, {
+					"color": "yellow",
+					"temp":  25.5,
+				}},
+			},
+			M: map[string]interface{}{
+				"op_1_preprocessor_demoE_0_exceptions_total":   int64(0),
+				"op_1_preprocessor_demoE_0_process_latency_us": int64(0),
+				"op_1_preprocessor_demoE_0_records_in_total":   int64(6),
+				"op_1_preprocessor_demoE_0_records_out_total":  int64(6),
+
+				"op_2_preprocessor_demo1E_0_exceptions_total":   int64(0),
+				"op_2_preprocessor_demo1E_0_process_latency_us": int64(0),
+				"op_2_preprocessor_demo1E_0_records_in_total":   int64(6),
+				"op_2_preprocessor_demo1E_0_records_out_total":  int64(6),
+
+				"op_3_interval_join_0_exceptions_total":   int64(0),
+				"op_3_interval_join_0_process_latency_us": int64(0),
+				"op_3_interval_join_0_records_in_total":   int64(12),
+				"op_3_interval_join_0_records_out_total":  int64(6),
+
+				"op_4_project_0_exceptions_total":   int64(0),
+				"op_4_project_0_process_latency_us": int64(0),
+				"op_4_project_0_records_in_total":   int64(6),
+				"op_4_project_0_records_out_total":  int64(6),
+
+				"sink_mockSink_0_exceptions_total":  int64(0),
+				"sink_mockSink_0_records_in_total":  int64(6),
+				"sink_mockSink_0_records_out_total": int64(6),
+			},
+			T: &xstream.PrintableTopo{
+				Sources: []string{"source_demoE", "source_demo1E"},
+				Edges: map[string][]string{
+					"source_demoE":             {"op_1_preprocessor_demoE"},
+					"source_demo1E":            {"op_2_preprocessor_demo1E"},
+					"op_1_preprocessor_demoE":  {"op_3_interval_join"},
+					"op_2_preprocessor_demo1E": {"op_3_interval_join"},
+					"op_3_interval_join":       {"op_4_project"},
+					"op_4_project":             {"sink_mockSink"},
+				},
+			},
+		}, {
+			Name: `TestEventWindowRuleUnion`,
+			Sql:  `SELECT count(*) AS c, max(size) AS s, max(hum) AS h FROM demoE, demo1E GROUP BY TUMBLINGWINDOW(ss, 1)`,
+			R: [][]map[string]interface{}{
+				{{
+					"c": float64(3),
+					"h": float64(65),
+					"s": float64(3),
+				}},
+				{{
+					"c": float64(2),
+					"h": float64(75),
+					"s": float64(2),
+				}},
+				{{
+					"c": float64(2),
+					"h": float64(80),
+					"s": float64(4),
+				}},
+				{{
+					"c": float64(2),
+					"h": float64(62),
+					"s": float64(1),
+				}},
+			},
+			M: map[string]interface{}{
+				"op_1_preprocessor_demoE_0_exceptions_total":   int64(0),
+				"op_1_preprocessor_demoE_0_process_latency_us": int64(0),
+				"op_1_preprocessor_demoE_0_records_in_total":   int64(6),
+				"op_1_preprocessor_demoE_0_records_out_total":  int64(6),
+
+				"op_2_preprocessor_demo1E_0_exceptions_total":   int64(0),
+				"op_2_preprocessor_demo1E_0_process_latency_us": int64(0),
+				"op_2_preprocessor_demo1E_0_records_in_total":   int64(6),
+				"op_2_preprocessor_demo1E_0_records_out_total":  int64(6),
+
+				"op_4_union_0_exceptions_total":   int64(0),
+				"op_4_union_0_process_latency_us": int64(0),
+				"op_4_union_0_records_in_total":   int64(4),
+				"op_4_union_0_records_out_total":  int64(4),
+
+				"op_5_aggregate_0_exceptions_total":   int64(0),
+				"op_5_aggregate_0_process_latency_us": int64(0),
+				"op_5_aggregate_0_records_in_total":   int64(4),
+				"op_5_aggregate_0_records_out_total":  int64(4),
+
+				"op_6_project_0_exceptions_total":   int64(0),
+				"op_6_project_0_process_latency_us": int64(0),
+				"op_6_project_0_records_in_total":   int64(4),
+				"op_6_project_0_records_out_total":  int64(4),
+
+				"sink_mockSink_0_exceptions_total":  int64(0),
+				"sink_mockSink_0_records_in_total":  int64(4),
+				"sink_mockSink_0_records_out_total": int64(4),
+			},
+			T: &xstream.PrintableTopo{
+				Sources: []string{"source_demoE", "source_demo1E"},
+				Edges: map[string][]string{
+					"source_demoE":             {"op_1_preprocessor_demoE"},
+					"source_demo1E":            {"op_2_preprocessor_demo1E"},
+					"op_1_preprocessor_demoE":  {"op_3_window"},
+					"op_2_preprocessor_demo1E": {"op_3_window"},
+					"op_3_window":              {"op_4_union"},
+					"op_4_union":               {"op_5_aggregate"},
+					"op_5_aggregate":           {"op_6_project"},
+					"op_6_project":             {"sink_mockSink"},
+				},
+			},
 		},
 	}
 	HandleStream(true, streamList, t)
@@ -1162,6 +1739,188 @@ func TestEventWindow(t *testing.T) {
 	}
 }
 
+func TestEventWindowLate(t *testing.T) {
+	//Reset
+	streamList := []string{"demoE"}
+	HandleStream(false, streamList, t)
+	var tests = []RuleTest{
+		{
+			Name: `TestEventWindowLateRule1`,
+			Sql:  `SELECT * FROM demoE GROUP BY TUMBLINGWINDOW(ss, 1)`,
+			R: [][]map[string]interface{}{
+				{{
+					"color": "red",
+					"size":  float64(3),
+					"ts":    float64(1541152486013),
+				}},
+				{{
+					"color": "blue",
+					"size":  float64(2),
+					"ts":    float64(1541152487632),
+				}},
+				// Re-fired by the late event
+				{{
+					"color": "red",
+					"size":  float64(3),
+					"ts":    float64(1541152486013),
+				}, {
+					"color": "blue",
+					"size":  float64(6),
+					"ts":    float64(1541152486822),
+				}},
+				{{
+					"color": "yellow",
+					"size":  float64(4),
+					"ts":    float64(1541152488442),
+				}},
+				{{
+					"color": "red",
+					"size":  float64(1),
+					"ts":    float64(1541152489252),
+				}},
+			},
+			M: map[string]interface{}{
+				"op_1_preprocessor_demoE_0_exceptions_total":  int64(0),
+				"op_1_preprocessor_demoE_0_records_in_total":  int64(6),
+				"op_1_preprocessor_demoE_0_records_out_total": int64(6),
+
+				"op_2_window_0_exceptions_total":  int64(0),
+				"op_2_window_0_records_in_total":  int64(6),
+				"op_2_window_0_records_out_total": int64(5),
+				"op_2_window_0_late_events_total": int64(1),
+
+				"sink_mockSink_0_exceptions_total":  int64(0),
+				"sink_mockSink_0_records_in_total":  int64(5),
+				"sink_mockSink_0_records_out_total": int64(5),
+			},
+		},
+	}
+	HandleStream(true, streamList, t)
+	options := []*api.RuleOption{
+		{
+			BufferLength:    100,
+			SendError:       true,
+			IsEventTime:     true,
+			LateTol:         1000,
+			AllowedLateness: 3000,
+		}, {
+			BufferLength:       100,
+			SendError:          true,
+			Qos:                api.AtLeastOnce,
+			CheckpointInterval: 5000,
+			IsEventTime:        true,
+			LateTol:            1000,
+			AllowedLateness:    3000,
+		},
+	}
+	for j, opt := range options {
+		DoRuleTest(t, tests, j, opt, 10)
+	}
+}
+
+func TestEventWindowLateOutput(t *testing.T) {
+	//Reset
+	streamList := []string{"demoE"}
+	HandleStream(false, streamList, t)
+	var tests = []struct {
+		RuleTest
+		late []map[string]interface{}
+	}{
+		{
+			RuleTest: RuleTest{
+				Name: `TestEventWindowLateOutputRule1`,
+				Sql:  `SELECT * FROM demoE GROUP BY TUMBLINGWINDOW(ss, 1)`,
+				R: [][]map[string]interface{}{
+					{{
+						"color": "red",
+						"size":  float64(3),
+						"ts":    float64(1541152486013),
+					}},
+					{{
+						"color": "blue",
+						"size":  float64(2),
+						"ts":    float64(1541152487632),
+					}},
+					{{
+						"color": "yellow",
+						"size":  float64(4),
+						"ts":    float64(1541152488442),
+					}},
+					{{
+						"color": "red",
+						"size":  float64(1),
+						"ts":    float64(1541152489252),
+					}},
+				},
+				M: map[string]interface{}{
+					"op_2_window_0_exceptions_total":  int64(0),
+					"op_2_window_0_records_in_total":  int64(6),
+					"op_2_window_0_records_out_total": int64(4),
+					"op_2_window_0_late_events_total": int64(1),
+
+					"sink_mockSink_0_records_in_total": int64(4),
+
+					"sink_lateSink_0_exceptions_total":  int64(0),
+					"sink_lateSink_0_records_in_total":  int64(1),
+					"sink_lateSink_0_records_out_total": int64(1),
+				},
+			},
+			late: []map[string]interface{}{{
+				"color": "blue",
+				"size":  float64(6),
+				"ts":    float64(1541152486822),
+			}},
+		},
+	}
+	HandleStream(true, streamList, t)
+	options := []*api.RuleOption{
+		{
+			BufferLength: 100,
+			SendError:    true,
+			IsEventTime:  true,
+			LateTol:      1000,
+		}, {
+			BufferLength:       100,
+			SendError:          true,
+			Qos:                api.AtLeastOnce,
+			CheckpointInterval: 5000,
+			IsEventTime:        true,
+			LateTol:            1000,
+		},
+	}
+	for j, opt := range options {
+		fmt.Printf("The test bucket for option %d size is %d.\n\n", j, len(tests))
+		for i, tt := range tests {
+			lateSink := mocknodes.NewMockSink()
+			datas, dataLength, tp, mockSink, errCh := createStream(t, tt.RuleTest, j, opt, nil, nodes.NewSinkNodeWithSink("lateSink", lateSink, map[string]interface{}{"sideOutput": "late"}))
+			if tp == nil {
+				t.Errorf("topo is not created successfully")
+				break
+			}
+			wait := 10
+			if opt.Qos == api.AtLeastOnce {
+				wait *= 3
+			}
+			if err := sendData(t, dataLength, tt.M, datas, errCh, tp, POSTLEAP, wait); err != nil {
+				t.Errorf("send data error %s", err)
+				break
+			}
+			compareResult(t, mockSink, commonResultFunc, tt.RuleTest, i, tp)
+			var late []map[string]interface{}
+			for _, r := range lateSink.GetResults() {
+				var m []map[string]interface{}
+				if err := json.Unmarshal(r, &m); err != nil {
+					t.Errorf("%d. invalid late output %s", i, r)
+				}
+				late = append(late, m...)
+			}
+			if !reflect.DeepEqual(tt.late, late) {
+				t.Errorf("%d. %q\n\nlate output mismatch:\n\nexp=%#v\n\ngot=%#v\n\n", i, tt.Sql, tt.late, late)
+			}
+		}
+	}
+}
+
 func TestWindowError(t *testing.T) {
 	//Reset
 	streamList := []string{"ldemo", "ldemo1"}